@@ -1,7 +1,7 @@
 const _rootURL = '/';
 
 const _urls = {
-    api: '/api',
+    api: '/api/v1',
     admin: '/admin',
 };
 
@@ -19,6 +19,13 @@ function linesToList(str) {
     return str.trim().split("\n").map((v) => v.trim()).filter(v => v !== "");
 }
 
+// Converts a timestamp to the local time value of a datetime-local input.
+function toDateTimeInput(ts) {
+    const d = new Date(ts);
+    d.setMinutes(d.getMinutes() - d.getTimezoneOffset());
+    return d.toISOString().slice(0, 16);
+}
+
 
 // Global is bound to <body> to provide a global state for all sub components.
 function globalComponent() {
@@ -47,10 +54,13 @@ function globalComponent() {
             return new Promise((resolve, reject) => {
                 this.loading[name] = true;
 
+                // FormData (file uploads) is sent as multipart.
+                const isForm = data instanceof FormData;
+
                 fetch(`${_urls.api}${uri}`, {
                     method: method || 'GET',
-                    body: (method === 'POST' || method == 'PUT') && data ? JSON.stringify(data) : null,
-                    headers: {
+                    body: (method === 'POST' || method == 'PUT') && data ? (isForm ? data : JSON.stringify(data)) : null,
+                    headers: isForm ? {} : {
                         "Content-Type": "application/json; charset=utf-8"
                     }
                 }).then(resp => {
@@ -62,10 +72,11 @@ function globalComponent() {
                         return;
                     }
 
-                    // For non-200 responses, return 'message' in the JSON server error response.
+                    // For non-200 responses, return the error message in the JSON server error response.
                     resp.json().then(data => {
-                        alert(data.message);
-                        reject(Error(data.message));
+                        const msg = data.error ? data.error.message : data.message;
+                        alert(msg);
+                        reject(Error(msg));
                         return;
                     });
                 }).catch((err) => {
@@ -111,11 +122,321 @@ function globalComponent() {
 function homeComponent() {
     return {
         stats: null,
+        days: 30,
+        maintenance: null,
+
+        get maxPerDay() {
+            return Math.max(1, ...this.stats.entries_per_day.map((d) => d.count));
+        },
 
         onLoad() {
-            this.api('stats', '/stats').then((data) => {
+            this.getStats();
+
+            this.api('maintenance', '/maintenance').then((data) => {
+                this.maintenance = data;
+            });
+        },
+
+        getStats() {
+            this.api('stats', `/stats?days=${this.days}`).then((data) => {
                 this.stats = data;
             });
+        },
+
+        onSaveMaintenance() {
+            const data = { enabled: this.maintenance.enabled, message: this.maintenance.message };
+            this.api('maintenance.update', '/maintenance', 'PUT', data).then((data) => {
+                this.maintenance = data;
+            });
+        },
+
+        // Percentage of a value relative to max for rendering bars.
+        barHeight(val, max) {
+            return max > 0 ? Math.round(val / max * 100) : 0;
+        }
+    }
+}
+
+// Background jobs component.
+function jobsComponent() {
+    return {
+        jobs: [],
+        job: null,
+        form: {
+            type: 'import', format: 'csv', langs: '', dryRun: false, restart: false, tags: '', status: '', since: '',
+            find: '', replace: '', regex: false
+        },
+
+        // Changes of the find-and-replace in the form.
+        preview: null,
+        timer: null,
+
+        onLoad() {
+            this.getJobs();
+
+            // Poll the status of running jobs.
+            this.timer = setInterval(() => {
+                if (this.jobs.some((j) => j.status === 'queued' || j.status === 'running')) {
+                    this.getJobs();
+                    if (this.job) {
+                        this.onShowLog(this.job.id);
+                    }
+                }
+            }, 3000);
+        },
+
+        getJobs() {
+            this.api('jobs.get', '/jobs').then((data) => {
+                this.jobs = data.jobs;
+            });
+        },
+
+        onCreate() {
+            const f = new FormData();
+            f.append('type', this.form.type);
+
+            if (this.form.type === 'import' || this.form.type === 'frequency' || this.form.type === 'reverse') {
+                f.append('params', JSON.stringify({
+                    format: this.form.format,
+                    langs: this.form.langs.split(',').map((l) => l.trim()).filter((l) => l),
+                    dry_run: this.form.dryRun,
+                    restart: this.form.restart
+                }));
+            }
+            if (this.form.type === 'reindex' || this.form.type === 'tts') {
+                f.append('params', JSON.stringify({
+                    langs: this.form.langs.split(',').map((l) => l.trim()).filter((l) => l)
+                }));
+            }
+            if (this.form.type === 'export-data') {
+                f.append('params', JSON.stringify({
+                    langs: this.form.langs.split(',').map((l) => l.trim()).filter((l) => l),
+                    tags: this.form.tags.split(',').map((t) => t.trim()).filter((t) => t),
+                    status: this.form.status,
+                    since: this.form.since
+                }));
+            }
+            if (this.form.type === 'replace') {
+                f.append('params', JSON.stringify({
+                    langs: this.form.langs.split(',').map((l) => l.trim()).filter((l) => l),
+                    tags: this.form.tags.split(',').map((t) => t.trim()).filter((t) => t),
+                    find: this.form.find,
+                    replace: this.form.replace,
+                    regex: this.form.regex,
+                    dry_run: this.form.dryRun
+                }));
+            }
+            if (this.form.type === 'import' || this.form.type === 'import-data' || this.form.type === 'frequency') {
+                f.append('file', this.$refs.file.files[0]);
+            }
+
+            this.api('jobs.create', '/jobs', 'POST', f).then(() => {
+                this.getJobs();
+            });
+        },
+
+        onPreview() {
+            const q = new URLSearchParams({ find: this.form.find, replace: this.form.replace, regex: this.form.regex });
+            this.form.langs.split(',').map((l) => l.trim()).filter((l) => l).forEach((l) => q.append('lang', l));
+            this.form.tags.split(',').map((t) => t.trim()).filter((t) => t).forEach((t) => q.append('tag', t));
+
+            this.api('jobs.preview', `/replace/preview?${q.toString()}`).then((data) => {
+                this.preview = data;
+            });
+        },
+
+        onShowLog(id) {
+            this.api('jobs.log', `/jobs/${id}`).then((data) => {
+                this.job = data;
+            });
+        },
+
+        onCancel(id) {
+            if (!confirm('Cancel job?')) {
+                return;
+            }
+            this.api('jobs.cancel', `/jobs/${id}`, 'DELETE').then(() => {
+                this.getJobs();
+            });
+        }
+    }
+}
+
+// Editorial worklist of headwords without translations and definitions that refer to missing headwords.
+function worklistComponent() {
+    return {
+        report: 'missing-translations',
+        fromLang: '',
+        toLang: '',
+        tags: '',
+        entries: [],
+        refs: [],
+        page: 1,
+        totalPages: 0,
+        total: 0,
+
+        onLoad() {
+            const langs = Object.keys(this.config.languages);
+            this.fromLang = langs[0];
+            this.toLang = langs.length > 1 ? langs[1] : langs[0];
+            this.getItems();
+        },
+
+        onFilter() {
+            this.page = 1;
+            this.getItems();
+        },
+
+        onPage(page) {
+            this.page = page;
+            this.getItems();
+        },
+
+        getItems() {
+            const q = new URLSearchParams({ page: this.page, per_page: 50 });
+            this.tags.split(',').map((t) => t.trim()).filter((t) => t).forEach((t) => q.append('tag', t));
+
+            if (this.report === 'missing-translations') {
+                q.set('from_lang', this.fromLang);
+                q.set('to_lang', this.toLang);
+                this.api('reports.get', `/reports/missing-translations?${q.toString()}`).then((data) => {
+                    this.entries = data.entries;
+                    this.refs = [];
+                    this.totalPages = data.total_pages;
+                    this.total = data.total;
+                });
+                return;
+            }
+
+            if (this.fromLang) {
+                q.set('lang', this.fromLang);
+            }
+            this.api('reports.get', `/reports/missing-refs?${q.toString()}`).then((data) => {
+                this.refs = data.refs;
+                this.entries = [];
+                this.totalPages = data.total_pages;
+                this.total = data.total;
+            });
+        }
+    }
+}
+
+function trashComponent() {
+    return {
+        items: [],
+        type: '',
+
+        onLoad() {
+            this.getItems();
+        },
+
+        getItems() {
+            this.api('trash.get', `/trash?type=${this.type}&per_page=100`).then((data) => {
+                this.items = data.items;
+            });
+        },
+
+        onRestore(t) {
+            this.api('trash.restore', `/trash/${t.id}/restore`, 'POST').then(() => {
+                this.getItems();
+            });
+        },
+
+        onDelete(t) {
+            if (!confirm(`Permanently delete '${t.label}'?`)) {
+                return;
+            }
+            this.api('trash.delete', `/trash/${t.id}`, 'DELETE').then(() => {
+                this.getItems();
+            });
+        },
+
+        onEmpty() {
+            if (!confirm('Permanently delete everything in the trash?')) {
+                return;
+            }
+            this.api('trash.delete', '/trash', 'DELETE').then(() => {
+                this.getItems();
+            });
+        }
+    }
+}
+
+function languagesComponent() {
+    return {
+        langs: [],
+        configLangs: [],
+        form: { id: '', config: '{}', dicts: '' },
+        isEditing: false,
+        restarting: false,
+
+        onLoad() {
+            this.getLangs();
+        },
+
+        getLangs() {
+            this.api('languages.get', '/languages').then((data) => {
+                this.langs = data.langs;
+                this.configLangs = data.config;
+            });
+        },
+
+        onEdit(l) {
+            this.isEditing = true;
+            this.form = { id: l.id, config: JSON.stringify(l.config, null, 4), dicts: l.dicts.join(', ') };
+        },
+
+        onReset() {
+            this.isEditing = false;
+            this.form = { id: '', config: '{}', dicts: '' };
+        },
+
+        onSave() {
+            let config = {};
+            try {
+                config = JSON.parse(this.form.config);
+            } catch (e) {
+                alert(`Invalid config JSON: ${e.message}`);
+                return;
+            }
+
+            const data = {
+                id: this.form.id.trim(),
+                config: config,
+                dicts: this.form.dicts.split(',').map((d) => d.trim()).filter((d) => d)
+            };
+
+            const [uri, method] = this.isEditing ? [`/languages/${data.id}`, 'PUT'] : ['/languages', 'POST'];
+            this.api('languages.save', uri, method, data).then(() => {
+                this.onReset();
+                this.onRestart();
+            });
+        },
+
+        onDelete(l) {
+            if (!confirm(`Delete the language '${l.id}'?`)) {
+                return;
+            }
+            this.api('languages.delete', `/languages/${l.id}`, 'DELETE').then(() => {
+                this.onRestart();
+            });
+        },
+
+        // The server restarts to apply language changes. Reload once it's back up.
+        onRestart() {
+            this.restarting = true;
+            const poll = () => {
+                setTimeout(() => {
+                    fetch(`${_ROOT_URL}/healthz`).then((resp) => {
+                        if (!resp.ok) {
+                            poll();
+                            return;
+                        }
+                        document.location.reload();
+                    }).catch(poll);
+                }, 2000);
+            };
+            poll();
         }
     }
 }
@@ -162,6 +483,10 @@ function searchResultsComponent(typ) {
         // from_id-to_id -> []comments
         comments: {},
 
+        // Machine translation of a query that yielded no results.
+        mtLang: '',
+        mt: null,
+
         onLoad() {
             this.refresh();
         },
@@ -228,6 +553,25 @@ function searchResultsComponent(typ) {
             }
         },
 
+        onTranslate() {
+            if (!this.mtLang) {
+                return;
+            }
+
+            this.mt = null;
+            this.api('mt.get', `/mt/${this.fromLang}/${this.mtLang}/${encodeURIComponent(this.query)}`).then((data) => {
+                this.mt = data || { content: '' };
+            });
+        },
+
+        onPromoteMT() {
+            const d = { query: this.query, content: this.mt.content, from_lang: this.mt.from_lang, to_lang: this.mt.to_lang };
+            this.api('mt.promote', '/mt/promote', 'POST', d).then((data) => {
+                this.mt = null;
+                document.location.href = this.makeURL({ id: data.id });
+            });
+        },
+
         onClearComments(id) {
             this.api('entries.delete', `/entries/comments/${id}`, 'DELETE').then(() => this.refresh());
         },
@@ -337,9 +681,15 @@ function entryComponent() {
         isNew: false,
         entry: null,
         parentEntries: [],
+        editorComments: [],
+        newComment: '',
         isVisible: false,
         isFormOpen: localStorage.isFormOpen === 'true' || false,
 
+        // Edit lock on the entry and the timer that renews it.
+        lock: null,
+        lockTimer: null,
+
         // This is triggered by the open-entry-form event.
         onOpen(e) {
             this.$dispatch('close-relation-form');
@@ -352,9 +702,19 @@ function entryComponent() {
                 phones: data.phones.join('\n'),
                 tags: data.tags.join('\n'),
                 tokens: data.tokens.split(' ').join('\n'),
-                meta_str: JSON.stringify(data.meta, null, 2)
+                meta_str: JSON.stringify(data.meta || {}, null, 2),
+                publish_at_str: data.publish_at ? toDateTimeInput(data.publish_at) : '',
+
+                // Custom field values of the language, which are stored in the meta.
+                fields: { ...(data.meta || {}) },
+
+                // Template of a new entry and its definition slots.
+                template: '',
+                defs: []
             };
             this.parentEntries = [];
+            this.editorComments = [];
+            this.newComment = '';
             this.isNew = !this.entry.id ? true : false;
             this.isVisible = true;
 
@@ -365,6 +725,68 @@ function entryComponent() {
             if (this.entry.parent) {
                 this.getParentEntries(this.entry.id);
             }
+
+            if (!this.isNew) {
+                this.getEditorComments(this.entry.guid);
+                this.lockEntry();
+            }
+        },
+
+        // Acquire the edit lock on the entry and keep renewing it while the form is open.
+        lockEntry() {
+            this.unlockEntry();
+
+            const interval = this.config.entry_lock_interval;
+            if (!interval) {
+                return;
+            }
+
+            const id = this.entry.id;
+            const lock = () => {
+                this.api('entries.lock', `/entries/${id}/lock`, 'POST').then((data) => {
+                    this.lock = data;
+                });
+            };
+
+            lock();
+            this.lockTimer = setInterval(lock, interval * 1000 / 2);
+        },
+
+        unlockEntry() {
+            if (this.lockTimer) {
+                clearInterval(this.lockTimer);
+                this.lockTimer = null;
+            }
+
+            if (this.lock && this.lock.own) {
+                this.api('entries.unlock', `/entries/${this.lock.entry_id}/lock`, 'DELETE');
+            }
+            this.lock = null;
+        },
+
+        // Entry templates of the entry's language, if any.
+        templates() {
+            const l = this.config.languages[this.entry.lang];
+            return l && l.templates && Object.keys(l.templates).length > 0 ? l.templates : null;
+        },
+
+        // Pre-fill the tags and the definition slots of the selected template.
+        onTemplate() {
+            const t = (this.templates() || {})[this.entry.template];
+            if (!t) {
+                this.entry.defs = [];
+                return;
+            }
+
+            const tags = linesToList(this.entry.tags);
+            (t.tags || []).forEach((tag) => {
+                if (!tags.includes(tag)) {
+                    tags.push(tag);
+                }
+            });
+            this.entry.tags = tags.join('\n');
+
+            this.entry.defs = (t.definitions || []).map((d) => ({ lang: d.lang, types: d.types || [], content: '' }));
         },
 
         onToggleOptions() {
@@ -379,6 +801,7 @@ function entryComponent() {
         },
 
         onClose() {
+            this.unlockEntry();
             this.isVisible = false;
         },
 
@@ -396,6 +819,30 @@ function entryComponent() {
                 return;
             }
 
+            // Set the typed custom field values in the meta.
+            const fields = (this.config.languages[this.entry.lang] || {}).fields || {};
+            Object.entries(fields).forEach(([id, f]) => {
+                const v = this.entry.fields[id];
+                if (v === undefined || v === null || v === '') {
+                    delete (this.entry.meta[id]);
+                    return;
+                }
+
+                switch (f.type) {
+                    case 'int':
+                        this.entry.meta[id] = parseInt(v, 10);
+                        break;
+                    case 'float':
+                        this.entry.meta[id] = parseFloat(v);
+                        break;
+                    case 'bool':
+                        this.entry.meta[id] = v === true || v === 'true';
+                        break;
+                    default:
+                        this.entry.meta[id] = v;
+                }
+            });
+
             let data = {
                 ...this.entry,
                 initial: this.entry.initial ? this.entry.initial : this.entry.content[0].toUpperCase(),
@@ -405,15 +852,42 @@ function entryComponent() {
             };
 
             delete (data.meta_str);
+            delete (data.fields);
+            delete (data.publish_at_str);
+            delete (data.template);
+            delete (data.defs);
 
             // New entry.
             if (this.isNew) {
-                this.api('entries.create', `/entries`, 'POST', data).then((data) => {
+                // Filled in definition slots of the template are created with the entry.
+                data.relations = this.entry.defs.filter((d) => d.content.trim() !== '').map((d) => ({
+                    content: d.content.trim(),
+                    initial: d.content.trim()[0].toUpperCase(),
+                    lang: d.lang,
+                    tags: [],
+                    phones: [],
+                    tokens: '',
+                    status: this.entry.status,
+                    relation: { types: d.types }
+                }));
+
+                const q = this.entry.template ? `?template=${encodeURIComponent(this.entry.template)}` : '';
+                this.api('entries.create', `/entries${q}`, 'POST', data).then((data) => {
                     this.onClose()
                     document.location.href = `${_urls.admin}/search?id=${data.id}`;
                 });
             } else {
                 this.api('entries.update', `/entries/${this.entry.id}`, 'PUT', data).then(() => {
+                    // Schedule (or unschedule) publishing if the time was changed.
+                    const publishAt = this.entry.status !== 'enabled' && this.entry.publish_at_str ?
+                        new Date(this.entry.publish_at_str).toISOString() : null;
+                    const old = this.entry.publish_at ? new Date(this.entry.publish_at).toISOString() : null;
+                    if (publishAt === old) {
+                        return;
+                    }
+
+                    return this.api('entries.schedule', `/entries/${this.entry.id}/schedule`, 'PUT', { publish_at: publishAt });
+                }).then(() => {
                     this.onClose()
                     this.$dispatch('search');
                 });
@@ -437,6 +911,34 @@ function entryComponent() {
             this.api('entries.getParents', `/entries/${id}/parents`).then((data) => {
                 this.parentEntries = data;
             });
+        },
+
+        getEditorComments(guid) {
+            this.api('entries.getComments', `/entries/${guid}/comments`).then((data) => {
+                this.editorComments = data;
+            });
+        },
+
+        onAddComment() {
+            const comments = this.newComment.trim();
+            if (!comments) {
+                return;
+            }
+
+            this.api('entries.addComment', `/entries/${this.entry.guid}/comments`, 'POST', { comments }).then(() => {
+                this.newComment = '';
+                this.getEditorComments(this.entry.guid);
+            });
+        },
+
+        onDeleteComment(id) {
+            if (!confirm('Delete this comment?')) {
+                return;
+            }
+
+            this.api('entries.deleteComment', `/entries/${this.entry.guid}/comments/${id}`, 'DELETE').then(() => {
+                this.getEditorComments(this.entry.guid);
+            });
         }
     }
 }
@@ -457,7 +959,8 @@ function relationComponent() {
                 ...data,
                 relation: {
                     ...data.relation,
-                    tags: data.relation.tags.join('\n')
+                    tags: data.relation.tags.join('\n'),
+                    domains: data.relation.domains || []
                 },
             };
             this.isVisible = true;
@@ -5,7 +5,6 @@ import (
 	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -13,9 +12,17 @@ import (
 
 	"github.com/knadh/dictpress/internal/data"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 )
 
-const isAuthed = "is_authed"
+const (
+	isAuthed = "is_authed"
+	authUser = "auth_user"
+	authRole = "auth_role"
+)
+
+// Maximum number of the GUIDs of affected entries returned by dry runs.
+const maxDryRunGUIDs = 1000
 
 // handleGetConfig returns the language configuration.
 func handleGetConfig(c echo.Context) error {
@@ -24,22 +31,37 @@ func handleGetConfig(c echo.Context) error {
 	)
 
 	out := struct {
-		RootURL   string       `json:"root_url"`
-		Languages data.LangMap `json:"languages"`
-		Version   string       `json:"version"`
-		BuildStr  string       `json:"build"`
-	}{app.consts.RootURL, app.data.Langs, versionString, buildString}
+		RootURL      string       `json:"root_url"`
+		Languages    data.LangMap `json:"languages"`
+		Version      string       `json:"version"`
+		BuildStr     string       `json:"build"`
+		LockInterval float64      `json:"entry_lock_interval"`
+		MT           bool         `json:"machine_translation"`
+		Readers      bool         `json:"readers"`
+
+		// Licenses of the dictionaries by "fromLang/toLang" and the default ("").
+		Licenses data.Licenses `json:"licenses,omitempty"`
+	}{app.consts.RootURL, app.data.Langs, versionString, buildString, app.consts.EntryLockDuration.Seconds(), app.mt != nil, app.readers != nil,
+		app.data.Licenses}
 
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
-// handleGetStats returns DB statistics.
+// handleGetStats returns DB statistics for the admin dashboard. The
+// ?days param (default 30) is the period of the time series and top lists.
 func handleGetStats(c echo.Context) error {
 	var (
-		app = c.Get("app").(*App)
+		app     = c.Get("app").(*App)
+		days, _ = strconv.Atoi(c.QueryParam("days"))
 	)
 
-	out, err := app.data.GetStats()
+	if days < 1 {
+		days = 30
+	} else if days > 365 {
+		days = 365
+	}
+
+	out, err := app.data.GetStats(days)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -47,7 +69,107 @@ func handleGetStats(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
-// handleInsertEntry inserts a new dictionary entry.
+// handleExplainSearch runs a search query (?q) with EXPLAIN ANALYZE and returns
+// the normalized query, its tokens, the SQL query with its params, and the query
+// plan, for debugging slow searches or unexpected matches. It takes the match,
+// multiword, page, and filter params of the search API.
+func handleExplainSearch(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		fromLang = c.Param("fromLang")
+		toLang   = c.Param("toLang")
+		qp       = c.QueryParams()
+		q        = strings.TrimSpace(qp.Get("q"))
+		pg       = app.resultsPg.NewFromURL(qp)
+	)
+
+	if q == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "no query given")
+	}
+	if _, ok := app.data.Langs[fromLang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `from` language")
+	}
+	if toLang == "*" {
+		toLang = ""
+	} else if _, ok := app.data.Langs[toLang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `to` language")
+	}
+
+	match := qp.Get("match")
+	if match != "" && !data.MatchModes[match] {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `match` mode")
+	}
+
+	multiword := qp.Get("multiword")
+	switch multiword {
+	case "", data.MultiwordPhrase, data.MultiwordAnd, data.MultiwordOr:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `multiword`. Should be phrase|and|or")
+	}
+
+	fields, err := parseFieldFilters(qp, app.data.Langs[fromLang])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	query := data.Query{
+		FromLang:  fromLang,
+		ToLang:    toLang,
+		Types:     qp["type"],
+		Tags:      qp["tag"],
+		Query:     q,
+		Match:     match,
+		Multiword: multiword,
+		Status:    data.StatusEnabled,
+		Offset:    pg.Offset,
+		Limit:     pg.Limit,
+		Fields:    fields,
+		POS:       qp["pos"],
+		Genders:   qp["gender"],
+		Registers: qp["register"],
+		Domains:   qp["domain"],
+	}
+	if err := validateSearchQuery(query, app.data.Langs); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.data.ExplainSearch(query)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleTokenize returns the tokens that a language's tokenizer produces for a
+// string (?q) as an entry and as a search query, to verify tokenizers (and
+// plugins) without inserting entries.
+func handleTokenize(c echo.Context) error {
+	var (
+		app  = c.Get("app").(*App)
+		lang = c.QueryParam("lang")
+		q    = strings.TrimSpace(c.QueryParam("q"))
+	)
+
+	if q == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "no query given")
+	}
+	if _, ok := app.data.Langs[lang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown language")
+	}
+
+	out, err := app.data.Tokenize(q, lang)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error tokenizing: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleInsertEntry inserts a new dictionary entry. The entry's definitions
+// (relations), new or existing entries, with their relations and usage examples
+// can be sent along in `relations` to be created atomically with the entry.
 func handleInsertEntry(c echo.Context) error {
 	app := c.Get("app").(*App)
 
@@ -57,11 +179,75 @@ func handleInsertEntry(c echo.Context) error {
 			fmt.Sprintf("error parsing request: %v", err))
 	}
 
-	if err := validateEntry(e, app); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	// The languages of existing definition entries are required to validate
+	// their relations.
+	var v validator
+	for i, def := range e.Relations {
+		if def.ID == 0 {
+			continue
+		}
+
+		old, err := app.data.GetEntry(def.ID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				v.add(fmt.Sprintf("relations[%d].id", i), "entry not found")
+				continue
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error fetching entry: %v", err))
+		}
+		e.Relations[i].Lang = old.Lang
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	// The entry's template (?template=) pre-fills its tags and definition
+	// types, and requires its fields.
+	if tpl := c.QueryParam("template"); tpl != "" || app.data.Langs[e.Lang].RequireTemplate {
+		t, ok := app.data.Langs[e.Lang].Templates[tpl]
+		if !ok {
+			if tpl == "" {
+				v.add("template", "is required for %s entries", e.Lang)
+			} else {
+				v.add("template", "unknown template '%s' for %s", tpl, e.Lang)
+			}
+			return v.err()
+		}
+
+		e = t.Apply(e)
+		for _, f := range t.Missing(e) {
+			v.add(f, "is required by the template '%s'", tpl)
+		}
+		if err := v.err(); err != nil {
+			return err
+		}
+	}
+
+	e.Slug = strings.TrimSpace(e.Slug)
+	if err := validateEntryTree(e, app); err != nil {
+		return err
+	}
+
+	// Users who can't change statuses can only create pending entries and relations.
+	if !hasPerm(c, permEntriesStatus) {
+		if e.Status != "" && e.Status != data.StatusPending {
+			return echo.NewHTTPError(http.StatusForbidden, "permission denied to set entry status")
+		}
+		e.Status = data.StatusPending
+
+		for i, def := range e.Relations {
+			if (def.ID == 0 && def.Status != "" && def.Status != data.StatusPending) ||
+				(def.Relation != nil && def.Relation.Status != "" && def.Relation.Status != data.StatusPending) {
+				return echo.NewHTTPError(http.StatusForbidden, "permission denied to set relation status")
+			}
+			if def.ID == 0 {
+				e.Relations[i].Status = data.StatusPending
+			}
+		}
 	}
 
-	id, err := app.data.InsertEntry(e)
+	id, err := insertEntry(e, app)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			fmt.Sprintf("error inserting entry: %v", err))
@@ -73,6 +259,27 @@ func handleInsertEntry(c echo.Context) error {
 	return handleGetEntry(c)
 }
 
+// insertEntry inserts an entry, and its definitions, relations, and examples,
+// if any, in a transaction that's rolled back if any of them fail.
+func insertEntry(e data.Entry, app *App) (int, error) {
+	if len(e.Relations) == 0 {
+		return app.data.InsertEntry(e)
+	}
+
+	tx, err := app.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := app.data.InsertEntryTree(tx, e)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
 // handleGetPendingEntries returns the pending entries for moderation.
 func handleGetPendingEntries(c echo.Context) error {
 	var (
@@ -123,6 +330,11 @@ func handleGetEntry(c echo.Context) error {
 		id, _ = strconv.Atoi(c.Param("id"))
 	)
 
+	render, err := parseRender(c.QueryParam("render"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
 	e, err := app.data.GetEntry(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -140,6 +352,10 @@ func handleGetEntry(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "error loading relations")
 	}
 
+	if render {
+		renderEntries(entries, app.data.Langs)
+	}
+
 	return c.JSON(http.StatusOK, okResp{entries[0]})
 }
 
@@ -179,7 +395,66 @@ func handleUpdateEntry(c echo.Context) error {
 			fmt.Sprintf("error parsing request: %v", err))
 	}
 
+	// Users who can't change statuses can only edit entries retaining their status.
+	if !hasPerm(c, permEntriesStatus) {
+		old, err := app.data.GetEntry(id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return echo.NewHTTPError(http.StatusBadRequest, "entry not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error fetching entry: %v", err))
+		}
+
+		if e.Status != "" && e.Status != old.Status {
+			return echo.NewHTTPError(http.StatusForbidden, "permission denied to change entry status")
+		}
+		e.Status = old.Status
+	}
+
+	// Entries being edited by another user can't be saved.
+	username, _ := c.Get(authUser).(string)
+	if app.consts.EntryLockDuration > 0 {
+		l, err := app.data.GetEntryLock(id)
+		if err != nil && err != sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error fetching entry lock: %v", err))
+		}
+		if err == nil && l.Username != username {
+			return echo.NewHTTPError(http.StatusConflict,
+				fmt.Sprintf("entry is being edited by %s", l.Username))
+		}
+	}
+
+	// The entry's language is required to validate the custom fields in the meta
+	// and to sanitize the content as per the language's content format.
+	if e.Lang == "" && (e.Meta != nil || e.Content != "" || e.Notes != "") {
+		old, err := app.data.GetEntry(id)
+		if err != nil && err != sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error fetching entry: %v", err))
+		}
+		e.Lang = old.Lang
+	}
+	e.Slug = strings.TrimSpace(e.Slug)
+	if err := validateEntry(e, true, app); err != nil {
+		return err
+	}
+
 	if err := app.data.UpdateEntry(id, e); err != nil {
+		if p, ok := err.(*pq.Error); ok && p.Code == "23505" {
+			return echo.NewHTTPError(http.StatusBadRequest, "`slug` is already used by another entry in the language.")
+		}
+
+		// The entry doesn't exist, or it was modified after the client loaded it.
+		if err == sql.ErrNoRows {
+			if _, err := app.data.GetEntry(id); err == sql.ErrNoRows {
+				return echo.NewHTTPError(http.StatusNotFound, "entry not found")
+			}
+			return echo.NewHTTPError(http.StatusConflict,
+				"entry has been modified by someone else since it was loaded. Reload it and retry.")
+		}
+
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			fmt.Sprintf("error updating entry: %v", err))
 	}
@@ -190,6 +465,99 @@ func handleUpdateEntry(c echo.Context) error {
 	return handleGetEntry(c)
 }
 
+// handlePreviewContent renders entry content (or notes) from an editor to
+// sanitized HTML as it would be stored and rendered. The format is that of
+// the given language's content format, unless it's explicitly given.
+func handlePreviewContent(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	var req struct {
+		Content string `json:"content"`
+		Lang    string `json:"lang"`
+		Format  string `json:"format"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	lang, ok := app.data.Langs[req.Lang]
+	if req.Lang != "" && !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `lang`.")
+	}
+	if !ok {
+		lang.ContentFormat, lang.Sanitizer = data.ContentText, app.sanitizer
+	}
+	if req.Format != "" {
+		if !data.ContentFormats[req.Format] {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid `format`. Should be text|html|markdown.")
+		}
+		lang.ContentFormat = req.Format
+	}
+
+	out := struct {
+		Format  string `json:"format"`
+		Content string `json:"content"`
+		HTML    string `json:"html"`
+	}{lang.ContentFormat, lang.SanitizeContent(req.Content), lang.RenderHTML(req.Content)}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleLockEntry acquires or renews the edit lock on an entry for the current
+// user. If another user is editing the entry, their lock is returned with `own`
+// set to false.
+func handleLockEntry(c echo.Context) error {
+	var (
+		app         = c.Get("app").(*App)
+		id, _       = strconv.Atoi(c.Param("id"))
+		username, _ = c.Get(authUser).(string)
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+	if app.consts.EntryLockDuration <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "entry locks are disabled")
+	}
+
+	l, err := app.data.LockEntry(id, username, app.consts.EntryLockDuration)
+	if err != nil {
+		if p, ok := err.(*pq.Error); ok && p.Code == "23503" {
+			return echo.NewHTTPError(http.StatusNotFound, "entry not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error locking entry: %v", err))
+	}
+
+	out := struct {
+		data.EntryLock
+		Own bool `json:"own"`
+	}{l, l.Username == username}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUnlockEntry releases the current user's edit lock on an entry.
+func handleUnlockEntry(c echo.Context) error {
+	var (
+		app         = c.Get("app").(*App)
+		id, _       = strconv.Atoi(c.Param("id"))
+		username, _ = c.Get(authUser).(string)
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	if err := app.data.UnlockEntry(id, username); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error unlocking entry: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
 // handleApproveSubmission updates a dictionary entry.
 func handleApproveSubmission(c echo.Context) error {
 	var (
@@ -231,11 +599,21 @@ func handleRejectSubmission(c echo.Context) error {
 // handleDeleteEntry deletes a dictionary entry.
 func handleDeleteEntry(c echo.Context) error {
 	var (
-		app   = c.Get("app").(*App)
-		id, _ = strconv.Atoi(c.Param("id"))
+		app         = c.Get("app").(*App)
+		id, _       = strconv.Atoi(c.Param("id"))
+		username, _ = c.Get(authUser).(string)
 	)
 
-	if err := app.data.DeleteEntry(id); err != nil {
+	if isDryRun(c) {
+		out, err := app.data.PreviewDeleteEntry(id)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error previewing entry deletion: %v", err))
+		}
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	if err := app.data.DeleteEntry(id, username); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			fmt.Sprintf("error deleting entry: %v", err))
 	}
@@ -261,10 +639,31 @@ func handleAddRelation(c echo.Context) error {
 			fmt.Sprintf("error parsing request: %v", err))
 	}
 
-	if _, err := app.data.InsertRelation(fromID, toID, rel); err != nil {
+	def, err := app.data.GetEntry(toID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusBadRequest, "entry not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := validateRelation(rel, app.data.Langs[def.Lang]); err != nil {
+		return err
+	}
+
+	// Users who can't change statuses can only create pending relations.
+	if !hasPerm(c, permEntriesStatus) {
+		if rel.Status != "" && rel.Status != data.StatusPending {
+			return echo.NewHTTPError(http.StatusForbidden, "permission denied to set relation status")
+		}
+		rel.Status = data.StatusPending
+	}
+
+	relID, err := app.data.InsertRelation(fromID, toID, rel)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			fmt.Sprintf("error inserting relation: %v", err))
 	}
+	c.Set(auditNewID, relID)
 
 	return c.JSON(http.StatusOK, okResp{true})
 }
@@ -286,6 +685,17 @@ func handleUpdateRelation(c echo.Context) error {
 			fmt.Sprintf("error parsing request: %v", err))
 	}
 
+	lang, err := app.data.GetRelationLang(relID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "relation not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := validateRelation(rel, app.data.Langs[lang]); err != nil {
+		return err
+	}
+
 	if err := app.data.UpdateRelation(relID, rel); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			fmt.Sprintf("error updating relation: %v", err))
@@ -294,6 +704,58 @@ func handleUpdateRelation(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
+// handleUpdateEtymology updates the etymology of an entry and replaces its
+// etymological links to other entries.
+func handleUpdateEtymology(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	req := struct {
+		Etymology string              `json:"etymology"`
+		Links     []data.EtymologyRef `json:"links"`
+	}{}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	for i, l := range req.Links {
+		if !isEntryID(l.GUID) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid link `guid`.")
+		}
+		if !data.EtymologyTypes[l.Type] {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown link type `%s`.", l.Type))
+		}
+
+		// Links are ordered as given.
+		req.Links[i].Weight = float64(i)
+	}
+
+	if _, err := app.data.GetEntry(id); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "entry not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	if err := app.data.UpdateEtymology(id, strings.TrimSpace(req.Etymology), req.Links); err != nil {
+		// Links to unknown entries, to the entry itself, or duplicate links.
+		if p, ok := err.(*pq.Error); ok && p.Code.Class() == "23" {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid links. Linked entries should exist and be unique.")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error updating etymology: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
 // handleReorderRelations reorders the weights of the relation IDs in the given order.
 func handleReorderRelations(c echo.Context) error {
 	var (
@@ -320,16 +782,26 @@ func handleReorderRelations(c echo.Context) error {
 // handleDeleteRelation deletes a relation between two entres.
 func handleDeleteRelation(c echo.Context) error {
 	var (
-		app       = c.Get("app").(*App)
-		fromID, _ = strconv.Atoi(c.Param("fromID"))
-		relID, _  = strconv.Atoi(c.Param("relID"))
+		app         = c.Get("app").(*App)
+		fromID, _   = strconv.Atoi(c.Param("fromID"))
+		relID, _    = strconv.Atoi(c.Param("relID"))
+		username, _ = c.Get(authUser).(string)
 	)
 
 	if fromID < 1 || relID < 1 {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid IDs.")
 	}
 
-	if err := app.data.DeleteRelation(fromID, relID); err != nil {
+	if isDryRun(c) {
+		out, err := app.data.PreviewDeleteRelation(relID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error previewing relation deletion: %v", err))
+		}
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	if err := app.data.DeleteRelation(fromID, relID, username); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			fmt.Sprintf("error deleting relation: %v", err))
 	}
@@ -373,33 +845,116 @@ func handleDeletecomments(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
-func handleDeletePending(c echo.Context) error {
+// handleGetEditorComments returns the internal editor comments on an entry.
+func handleGetEditorComments(c echo.Context) error {
 	var (
-		app = c.Get("app").(*App)
+		app  = c.Get("app").(*App)
+		guid = c.Param("guid")
 	)
 
-	if err := app.data.DeleteAllPending(); err != nil {
+	if !isEntryID(guid) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `guid`.")
+	}
+
+	out, err := app.data.GetEditorComments(guid)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError,
-			fmt.Sprintf("error deleting pending entries: %v", err))
+			fmt.Sprintf("error fetching comments: %v", err))
 	}
 
-	return c.JSON(http.StatusOK, okResp{true})
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleInsertEditorComment adds an internal editor comment to an entry.
+func handleInsertEditorComment(c echo.Context) error {
+	var (
+		app  = c.Get("app").(*App)
+		guid = c.Param("guid")
+	)
+
+	if !isEntryID(guid) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `guid`.")
+	}
+
+	req := struct {
+		Comments string `json:"comments"`
+	}{}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	req.Comments = strings.TrimSpace(req.Comments)
+	if req.Comments == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `comments`.")
+	}
+
+	author, _ := c.Get(authUser).(string)
+	out, err := app.data.InsertEditorComment(guid, author, req.Comments)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "entry not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error inserting comment: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
 }
 
-func validateEntry(e data.Entry, app *App) error {
-	if strings.TrimSpace(e.Content) == "" {
-		return errors.New("invalid `content`.")
+// handleDeleteEditorComment deletes an internal editor comment.
+func handleDeleteEditorComment(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		guid  = c.Param("guid")
+		id, _ = strconv.Atoi(c.Param("commentID"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+	if !isEntryID(guid) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `guid`.")
+	}
+
+	if err := app.data.DeleteEditorComment(id, guid); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "comment not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error deleting comment: %v", err))
 	}
 
-	if strings.TrimSpace(e.Initial) == "" {
-		return errors.New("invalid `initial`.")
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+func handleDeletePending(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+	)
+
+	if isDryRun(c) {
+		out, err := app.data.PreviewDeleteAllPending(maxDryRunGUIDs)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error previewing pending entries deletion: %v", err))
+		}
+		return c.JSON(http.StatusOK, okResp{out})
 	}
 
-	if _, ok := app.data.Langs[e.Lang]; !ok {
-		return errors.New("unknown `lang`.")
+	if err := app.data.DeleteAllPending(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error deleting pending entries: %v", err))
 	}
 
-	return nil
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// isDryRun checks whether a request is a dry run (?dry_run=1) of a destructive
+// operation that should only report what would change.
+func isDryRun(c echo.Context) bool {
+	ok, _ := strconv.ParseBool(c.QueryParam("dry_run"))
+	return ok
 }
 
 // handleAdminPage is the root handler that renders the Javascript admin frontend.
@@ -424,6 +979,14 @@ func adminPage(tpl string) func(c echo.Context) error {
 
 		case "pending":
 			title = "Pending submissions"
+		case "worklist":
+			title = "Worklist"
+		case "jobs":
+			title = "Jobs"
+		case "trash":
+			title = "Trash"
+		case "languages":
+			title = "Languages"
 		}
 
 		b := &bytes.Buffer{}
@@ -442,12 +1005,22 @@ func adminPage(tpl string) func(c echo.Context) error {
 }
 
 // basicAuth middleware does an HTTP BasicAuth authentication for admin handlers.
+// The admin user in the config is a superadmin. Other users are looked up in the DB.
 func basicAuth(username, password string, c echo.Context) (bool, error) {
 	app := c.Get("app").(*App)
 
 	if subtle.ConstantTimeCompare([]byte(username), app.consts.AdminUsername) == 1 &&
 		subtle.ConstantTimeCompare([]byte(password), app.consts.AdminPassword) == 1 {
 		c.Set(isAuthed, true)
+		c.Set(authUser, username)
+		c.Set(authRole, data.RoleAdmin)
+		return true, nil
+	}
+
+	if u, ok := checkUser(username, password, app); ok {
+		c.Set(isAuthed, true)
+		c.Set(authUser, u.Username)
+		c.Set(authRole, u.Role)
 		return true, nil
 	}
 
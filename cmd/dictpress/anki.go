@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/koanf/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// Name of the default card template.
+const ankiDefaultTpl = "basic"
+
+// ankiOpt represents the flashcard export options.
+type ankiOpt struct {
+	MaxEntries int                     `koanf:"max_entries"`
+	Templates  map[string]ankiTemplate `koanf:"templates"`
+}
+
+// ankiTemplate is a flashcard template. Front and Back are HTML templates
+// that get an entry with its definitions.
+type ankiTemplate struct {
+	Front string `koanf:"front"`
+	Back  string `koanf:"back"`
+}
+
+// ankiTpls are the compiled fronts and backs of a flashcard template.
+type ankiTpls struct {
+	front *template.Template
+	back  *template.Template
+}
+
+var ankiFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// Default card template: the headword and its phones on the front and the
+// definitions with their parts of speech on the back.
+var ankiBasic = ankiTemplate{
+	Front: `{{ .Content }}{{ if .Phones }}<br><small>{{ join .Phones ", " }}</small>{{ end }}`,
+	Back: `<ol>{{ range .Relations }}<li>{{ if .Relation }}{{ if .Relation.Types }}<i>{{ join .Relation.Types ", " }}</i> {{ end }}{{ end }}` +
+		`{{ .Content }}</li>{{ end }}</ol>`,
+}
+
+// initAnki loads the flashcard export options and compiles the card templates.
+func initAnki(ko *koanf.Koanf) (ankiOpt, map[string]ankiTpls) {
+	var o ankiOpt
+	if err := ko.Unmarshal("anki", &o); err != nil {
+		lo.Fatalf("error loading anki config: %v", err)
+	}
+	if o.MaxEntries < 1 {
+		o.MaxEntries = 1000
+	}
+	if o.Templates == nil {
+		o.Templates = make(map[string]ankiTemplate)
+	}
+	if _, ok := o.Templates[ankiDefaultTpl]; !ok {
+		o.Templates[ankiDefaultTpl] = ankiBasic
+	}
+
+	out := make(map[string]ankiTpls, len(o.Templates))
+	for name, t := range o.Templates {
+		front, err := template.New("front").Funcs(ankiFuncs).Parse(t.Front)
+		if err != nil {
+			lo.Fatalf("error parsing anki template %s front: %v", name, err)
+		}
+		back, err := template.New("back").Funcs(ankiFuncs).Parse(t.Back)
+		if err != nil {
+			lo.Fatalf("error parsing anki template %s back: %v", name, err)
+		}
+		out[name] = ankiTpls{front: front, back: back}
+	}
+
+	return o, out
+}
+
+// handleExportAnki exports headwords and their definitions as flashcards in a
+// tab separated text file that can be imported into Anki. The headwords are
+// either the results of a search (?q) or all the headwords in the `from`
+// language, optionally filtered by tags (?tag).
+func handleExportAnki(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		fromLang = c.Param("fromLang")
+		toLang   = c.Param("toLang")
+		q        = strings.TrimSpace(c.QueryParam("q"))
+		tags     = c.QueryParams()["tag"]
+		tplName  = c.QueryParam("template")
+		deck     = strings.TrimSpace(c.QueryParam("deck"))
+		limit, _ = strconv.Atoi(c.QueryParam("limit"))
+	)
+
+	if _, ok := app.data.Langs[fromLang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `from` language")
+	}
+	if _, ok := app.data.Langs[toLang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `to` language")
+	}
+
+	if tplName == "" {
+		tplName = ankiDefaultTpl
+	}
+	tpl, ok := app.ankiTpls[tplName]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `template`")
+	}
+
+	if limit < 1 || limit > app.consts.Anki.MaxEntries {
+		limit = app.consts.Anki.MaxEntries
+	}
+	if deck == "" {
+		deck = fmt.Sprintf("%s-%s", fromLang, toLang)
+		if q != "" {
+			deck += " " + q
+		}
+	}
+
+	// Select the headwords.
+	var entries []data.Entry
+	if q != "" {
+		pg := app.resultsPg.NewFromURL(url.Values{})
+		pg.Offset, pg.Limit = 0, limit
+
+		_, res, err := searchEntries(data.Query{
+			FromLang: fromLang,
+			ToLang:   toLang,
+			Query:    q,
+			Tags:     tags,
+			Match:    app.data.Langs[fromLang].Match,
+			Status:   data.StatusEnabled,
+			Limit:    limit,
+		}, pg, false, app)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		entries = res.Entries
+	} else {
+		res, err := app.data.GetHeadwordsByTags(fromLang, tags, limit)
+		if err != nil {
+			app.lo.Printf("error fetching headwords: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "error fetching entries")
+		}
+		if err := app.data.SearchAndLoadRelations(res, data.Query{ToLang: toLang, Status: data.StatusEnabled}); err != nil {
+			app.lo.Printf("error fetching definitions: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "error fetching entries")
+		}
+		entries = res
+	}
+
+	b, n, err := makeAnkiCards(entries, deck, app.data.GetLicense(fromLang, toLang), tpl)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error rendering card: %v", err))
+	}
+
+	c.Response().Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s-%s.txt"`, fromLang, toLang))
+	c.Response().Header().Set("X-Total-Count", strconv.Itoa(n))
+	return c.Blob(http.StatusOK, "text/plain; charset=utf-8", b)
+}
+
+// makeAnkiCards renders the entries that have definitions as flashcards in
+// Anki's plain text import format with file headers, and returns the number
+// of cards. The dictionary's license is written as comments.
+func makeAnkiCards(entries []data.Entry, deck string, lic data.License, tpl ankiTpls) ([]byte, int, error) {
+	var b bytes.Buffer
+	b.WriteString("#separator:tab\n#html:true\n#tags column:3\n")
+	fmt.Fprintf(&b, "#deck:%s\n", ankiField(deck))
+	for _, c := range [][2]string{{"License", lic.Name}, {"License URL", lic.URL}, {"Source", lic.Source}, {"Attribution", lic.Attribution}} {
+		if c[1] != "" {
+			fmt.Fprintf(&b, "# %s: %s\n", c[0], strings.ReplaceAll(c[1], "\n", " "))
+		}
+	}
+
+	n := 0
+	for _, e := range entries {
+		if len(e.Relations) == 0 {
+			continue
+		}
+
+		var front, back bytes.Buffer
+		if err := tpl.front.Execute(&front, e); err != nil {
+			return nil, 0, err
+		}
+		if err := tpl.back.Execute(&back, e); err != nil {
+			return nil, 0, err
+		}
+
+		// Anki tags can't have spaces.
+		cardTags := make([]string, 0, len(e.Tags))
+		for _, t := range e.Tags {
+			cardTags = append(cardTags, strings.ReplaceAll(t, " ", "_"))
+		}
+
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", ankiField(front.String()), ankiField(back.String()), ankiField(strings.Join(cardTags, " ")))
+		n++
+	}
+
+	return b.Bytes(), n, nil
+}
+
+// ankiField returns a field for Anki's tab separated import format. Newlines
+// are replaced with <br> and fields with quotes or tabs are quoted.
+func ankiField(s string) string {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "<br>")
+	if strings.ContainsAny(s, "\"\t") {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+
+	return s
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/knadh/paginator"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// apiV1 is the prefix of the versioned v1 APIs.
+	apiV1 = "/api/v1"
+
+	// apiLegacy is the prefix of the unversioned legacy APIs.
+	apiLegacy = "/api"
+)
+
+// apiRoute represents an API route in the route registry from which the
+// routes are registered and the OpenAPI spec is generated.
+type apiRoute struct {
+	method  string
+	path    string
+	handler echo.HandlerFunc
+
+	// Permission required to access the route. Public routes have none.
+	perm string
+
+	// Documentation for the OpenAPI spec.
+	tag     string
+	summary string
+	query   []string
+}
+
+// apiRoutes returns the registry of all API routes relative to the API prefix.
+func apiRoutes(ko *koanf.Koanf) []apiRoute {
+	var (
+		search = []string{"q", "type", "tag", "match", "mode", "pos", "gender", "register", "domain", "facets", "highlight", "render", "fields", "expand", "page", "per_page", "cursor"}
+		pages  = []string{"page", "per_page"}
+	)
+
+	out := []apiRoute{
+		// Public APIs.
+		{method: http.MethodGet, path: "/config", handler: handleGetConfig,
+			tag: "public", summary: "Get the dictionary config"},
+		{method: http.MethodGet, path: "/dictionary/:fromLang/:toLang/:q", handler: handleSearch,
+			tag: "public", summary: "Search the dictionary", query: search},
+		{method: http.MethodGet, path: "/index/:fromLang/:toLang", handler: handleGetIndex,
+			tag: "public", summary: "Get the search index of all headwords", query: []string{"format"}},
+		{method: http.MethodGet, path: "/changes", handler: handleGetChanges,
+			tag: "public", summary: "Get entries changed since a timestamp or cursor", query: []string{"since", "cursor", "limit"}},
+		{method: http.MethodPost, path: "/entries/:guid/click", handler: handleRecordClick,
+			tag: "public", summary: "Record a click-through on a search result"},
+		{method: http.MethodGet, path: "/entries/:guid/etymology", handler: handleGetEtymology,
+			tag: "public", summary: "Get the etymology of an entry with its chains of links", query: []string{"depth"}},
+		{method: http.MethodGet, path: "/entries/:guid/similar", handler: handleGetSimilarEntries,
+			tag: "public", summary: "Get headwords similar to an entry", query: []string{"strategy", "limit"}},
+		{method: http.MethodGet, path: "/popular/:lang", handler: handleGetPopularEntries,
+			tag: "public", summary: "Get the most viewed headwords in a language", query: []string{"days", "limit"}},
+		{method: http.MethodGet, path: "/quiz/:fromLang/:toLang", handler: handleGetQuiz,
+			tag: "public", summary: "Get randomized quiz questions", query: []string{"type", "tag", "num", "choices"}},
+		{method: http.MethodGet, path: "/examples/:lang", handler: handleSearchExamples,
+			tag: "public", summary: "Search usage examples containing a word", query: []string{"q", "to", "page", "per_page"}},
+	}
+
+	// Public glossary API.
+	if ko.Bool("glossary.enabled") {
+		out = append(out, apiRoute{method: http.MethodGet, path: "/glossary/:lang", handler: handleGetGlossary,
+			tag: "public", summary: "Stream all the glossary words of a language", query: []string{"initial", "format"}})
+	}
+
+	// Public flashcard export API.
+	if ko.Bool("anki.enabled") {
+		out = append(out, apiRoute{method: http.MethodGet, path: "/anki/:fromLang/:toLang", handler: handleExportAnki,
+			tag: "public", summary: "Export headwords as Anki flashcards", query: []string{"q", "tag", "template", "deck", "limit"}})
+	}
+
+	// Public user submission APIs.
+	if ko.Bool("app.enable_submissions") {
+		out = append(out, []apiRoute{
+			{method: http.MethodPost, path: "/submissions", handler: handleNewSubmission,
+				tag: "submissions", summary: "Submit a new entry"},
+			{method: http.MethodPost, path: "/submissions/comments", handler: handleNewComments,
+				tag: "submissions", summary: "Submit a comment on a relation"},
+		}...)
+	}
+
+	// Site visitor (reader) accounts and word lists. Except for login, the
+	// routes require a reader login session.
+	if ko.Bool("readers.enabled") {
+		out = append(out, []apiRoute{
+			{method: http.MethodPost, path: "/readers/login", handler: handleReaderLoginRequest,
+				tag: "readers", summary: "E-mail a login link to a reader"},
+			{method: http.MethodPost, path: "/readers/logout", handler: handleReaderLogout,
+				tag: "readers", summary: "Log the reader out"},
+			{method: http.MethodGet, path: "/readers/me", handler: requireReader(handleGetReader),
+				tag: "readers", summary: "Get the logged in reader"},
+			{method: http.MethodDelete, path: "/readers/me", handler: requireReader(handleDeleteReader),
+				tag: "readers", summary: "Delete the reader's account and word lists"},
+			{method: http.MethodGet, path: "/readers/lists", handler: requireReader(handleGetWordLists),
+				tag: "readers", summary: "Get the reader's word lists", query: []string{"guid"}},
+			{method: http.MethodPost, path: "/readers/lists", handler: requireReader(handleInsertWordList),
+				tag: "readers", summary: "Create a word list"},
+			{method: http.MethodGet, path: "/readers/lists/:id", handler: requireReader(handleGetWordList),
+				tag: "readers", summary: "Get a word list with its words"},
+			{method: http.MethodPut, path: "/readers/lists/:id", handler: requireReader(handleUpdateWordList),
+				tag: "readers", summary: "Rename a word list"},
+			{method: http.MethodDelete, path: "/readers/lists/:id", handler: requireReader(handleDeleteWordList),
+				tag: "readers", summary: "Delete a word list"},
+			{method: http.MethodPost, path: "/readers/lists/:id/entries", handler: requireReader(handleInsertWordListEntry),
+				tag: "readers", summary: "Save a word to a word list"},
+			{method: http.MethodDelete, path: "/readers/lists/:id/entries/:guid", handler: requireReader(handleDeleteWordListEntry),
+				tag: "readers", summary: "Remove a word from a word list"},
+
+			// Published word lists.
+			{method: http.MethodGet, path: "/lists", handler: handleGetPublicWordLists,
+				tag: "lists", summary: "Get public word lists", query: []string{"featured", "page", "per_page"}},
+			{method: http.MethodGet, path: "/lists/:slug", handler: handleGetPublicWordList,
+				tag: "lists", summary: "Get or export a public word list", query: []string{"format"}},
+		}...)
+	}
+
+	// Machine translation suggestions.
+	if ko.Bool("mt.enabled") {
+		out = append(out, []apiRoute{
+			{method: http.MethodGet, path: "/mt/:fromLang/:toLang/:q", handler: handleGetMT, perm: permEntriesRead,
+				tag: "mt", summary: "Get the machine translation of a query"},
+			{method: http.MethodPost, path: "/mt/promote", handler: handlePromoteMT, perm: permEntriesWrite,
+				tag: "mt", summary: "Save a machine translation as an entry and definition"},
+		}...)
+	}
+
+	// API keys of the public APIs and their usage reports.
+	if ko.Bool("api_keys.enabled") {
+		out = append(out, []apiRoute{
+			{method: http.MethodGet, path: "/usage", handler: handleGetOwnAPIKeyUsage,
+				tag: "public", summary: "Get the usage report of the API key of the request", query: []string{"from", "to"}},
+			{method: http.MethodGet, path: "/api-keys", handler: handleGetAPIKeys, perm: permSettings,
+				tag: "api-keys", summary: "Get the API keys"},
+			{method: http.MethodPost, path: "/api-keys", handler: handleInsertAPIKey, perm: permSettings,
+				tag: "api-keys", summary: "Issue an API key"},
+			{method: http.MethodPut, path: "/api-keys/:id", handler: handleUpdateAPIKey, perm: permSettings,
+				tag: "api-keys", summary: "Update an API key's name, limits, or status"},
+			{method: http.MethodDelete, path: "/api-keys/:id", handler: handleDeleteAPIKey, perm: permSettings,
+				tag: "api-keys", summary: "Revoke an API key"},
+			{method: http.MethodGet, path: "/api-keys/:id/usage", handler: handleGetAPIKeyUsage, perm: permSettings,
+				tag: "api-keys", summary: "Get the usage report of an API key", query: []string{"from", "to"}},
+		}...)
+	}
+
+	// Request counts of the bot filter.
+	if ko.Bool("bots.enabled") {
+		out = append(out, apiRoute{method: http.MethodGet, path: "/bots", handler: handleGetBotStats, perm: permSettings,
+			tag: "bots", summary: "Get the counts of requests allowed and blocked by the bot filter"})
+	}
+
+	// Featuring public word lists on the site.
+	if ko.Bool("readers.enabled") {
+		out = append(out, []apiRoute{
+			{method: http.MethodGet, path: "/word-lists", handler: handleGetPublicWordLists, perm: permEntriesStatus,
+				tag: "lists", summary: "Get public word lists for curation", query: []string{"featured", "page", "per_page"}},
+			{method: http.MethodPut, path: "/word-lists/:id/featured", handler: handleUpdateWordListFeatured, perm: permEntriesStatus,
+				tag: "lists", summary: "Feature or unfeature a public word list"},
+		}...)
+	}
+
+	// Admin APIs.
+	return append(out, []apiRoute{
+		{method: http.MethodGet, path: "/entries/:fromLang/:toLang", handler: handleSearch, perm: permEntriesRead,
+			tag: "entries", summary: "Search entries", query: search},
+		{method: http.MethodGet, path: "/entries/:fromLang/:toLang/:q", handler: handleSearch, perm: permEntriesRead,
+			tag: "entries", summary: "Search entries", query: search},
+
+		{method: http.MethodGet, path: "/stats", handler: handleGetStats, perm: permEntriesRead,
+			tag: "entries", summary: "Get dictionary stats", query: []string{"days"}},
+		{method: http.MethodGet, path: "/reports/missing-translations", handler: handleGetMissingTranslations, perm: permEntriesRead,
+			tag: "reports", summary: "Get headwords without definitions in a language", query: []string{"from_lang", "to_lang", "tag", "page", "per_page"}},
+		{method: http.MethodGet, path: "/reports/missing-refs", handler: handleGetMissingRefs, perm: permEntriesRead,
+			tag: "reports", summary: "Get definitions that refer to missing headwords", query: []string{"lang", "tag", "page", "per_page"}},
+		{method: http.MethodGet, path: "/explain/:fromLang/:toLang", handler: handleExplainSearch, perm: permSettings,
+			tag: "entries", summary: "Explain a search query", query: []string{"q", "type", "tag", "match", "multiword", "pos", "gender", "register", "domain", "page", "per_page"}},
+		{method: http.MethodGet, path: "/tokenize", handler: handleTokenize, perm: permEntriesRead,
+			tag: "entries", summary: "Preview the tokens of a string", query: []string{"lang", "q"}},
+		{method: http.MethodGet, path: "/entries/pending", handler: handleGetPendingEntries, perm: permEntriesRead,
+			tag: "submissions", summary: "Get pending entries", query: pages},
+		{method: http.MethodGet, path: "/entries/comments", handler: handleGetComments, perm: permEntriesRead,
+			tag: "submissions", summary: "Get submitted comments"},
+		{method: http.MethodDelete, path: "/entries/comments/:commentID", handler: handleDeletecomments, perm: permEntriesStatus,
+			tag: "submissions", summary: "Delete a submitted comment"},
+		{method: http.MethodDelete, path: "/entries/pending", handler: handleDeletePending, perm: permEntriesDelete,
+			tag: "submissions", summary: "Delete all pending entries", query: []string{"dry_run"}},
+		{method: http.MethodGet, path: "/entries/scheduled", handler: handleGetScheduledEntries, perm: permEntriesRead,
+			tag: "entries", summary: "Get the entries scheduled for publishing", query: []string{"page", "per_page"}},
+		{method: http.MethodGet, path: "/entries/:id", handler: handleGetEntry, perm: permEntriesRead,
+			tag: "entries", summary: "Get an entry", query: []string{"render"}},
+		{method: http.MethodGet, path: "/entries/:id/parents", handler: handleGetParentEntries, perm: permEntriesRead,
+			tag: "entries", summary: "Get the parent entries of a definition"},
+		{method: http.MethodPost, path: "/entries", handler: handleInsertEntry, perm: permEntriesWrite,
+			tag: "entries", summary: "Create an entry", query: []string{"template"}},
+		{method: http.MethodPut, path: "/entries/:id", handler: handleUpdateEntry, perm: permEntriesWrite,
+			tag: "entries", summary: "Update an entry"},
+		{method: http.MethodPost, path: "/entries/preview", handler: handlePreviewContent, perm: permEntriesWrite,
+			tag: "entries", summary: "Render entry content to sanitized HTML for previewing"},
+		{method: http.MethodDelete, path: "/entries/:id", handler: handleDeleteEntry, perm: permEntriesDelete,
+			tag: "entries", summary: "Delete an entry", query: []string{"dry_run"}},
+		{method: http.MethodPost, path: "/entries/:id/lock", handler: handleLockEntry, perm: permEntriesWrite,
+			tag: "entries", summary: "Acquire or renew the edit lock on an entry"},
+		{method: http.MethodDelete, path: "/entries/:id/lock", handler: handleUnlockEntry, perm: permEntriesWrite,
+			tag: "entries", summary: "Release the edit lock on an entry"},
+		{method: http.MethodDelete, path: "/entries/:fromID/relations/:relID", handler: handleDeleteRelation, perm: permEntriesDelete,
+			tag: "relations", summary: "Delete a relation", query: []string{"dry_run"}},
+		{method: http.MethodPost, path: "/entries/:fromID/relations/:toID", handler: handleAddRelation, perm: permEntriesWrite,
+			tag: "relations", summary: "Add a relation between two entries"},
+		{method: http.MethodPut, path: "/entries/:id/relations/weights", handler: handleReorderRelations, perm: permEntriesWrite,
+			tag: "relations", summary: "Reorder the relations of an entry"},
+		{method: http.MethodPut, path: "/entries/:id/relations/:relID", handler: handleUpdateRelation, perm: permEntriesWrite,
+			tag: "relations", summary: "Update a relation"},
+		{method: http.MethodPut, path: "/entries/:id/etymology", handler: handleUpdateEtymology, perm: permEntriesWrite,
+			tag: "entries", summary: "Update the etymology of an entry and its links"},
+		{method: http.MethodPut, path: "/entries/:id/schedule", handler: handleScheduleEntry, perm: permEntriesStatus,
+			tag: "entries", summary: "Schedule a disabled or pending entry for publishing"},
+		{method: http.MethodGet, path: "/entries/:id/relations/:relID/examples", handler: handleGetExamples, perm: permEntriesRead,
+			tag: "relations", summary: "Get the usage examples of a relation"},
+		{method: http.MethodPost, path: "/entries/:id/relations/:relID/examples", handler: handleInsertExample, perm: permEntriesWrite,
+			tag: "relations", summary: "Add a usage example to a relation"},
+		{method: http.MethodPut, path: "/entries/:id/relations/:relID/examples/:exampleID", handler: handleUpdateExample, perm: permEntriesWrite,
+			tag: "relations", summary: "Update a usage example"},
+		{method: http.MethodDelete, path: "/entries/:id/relations/:relID/examples/:exampleID", handler: handleDeleteExample, perm: permEntriesDelete,
+			tag: "relations", summary: "Delete a usage example"},
+		{method: http.MethodGet, path: "/entries/:id/media", handler: handleGetMedia, perm: permEntriesRead,
+			tag: "entries", summary: "Get the images of an entry and its definitions"},
+		{method: http.MethodPost, path: "/entries/:id/media", handler: handleInsertMedia, perm: permEntriesWrite,
+			tag: "entries", summary: "Upload or link an image to an entry or a definition"},
+		{method: http.MethodDelete, path: "/entries/:id/media/:mediaID", handler: handleDeleteMedia, perm: permEntriesDelete,
+			tag: "entries", summary: "Delete an image"},
+		{method: http.MethodPut, path: "/entries/:id/submission", handler: handleApproveSubmission, perm: permEntriesStatus,
+			tag: "submissions", summary: "Approve a submission"},
+		{method: http.MethodGet, path: "/entries/:guid/comments", handler: handleGetEditorComments, perm: permEntriesRead,
+			tag: "entries", summary: "Get the editor comments on an entry"},
+		{method: http.MethodPost, path: "/entries/:guid/comments", handler: handleInsertEditorComment, perm: permEntriesWrite,
+			tag: "entries", summary: "Add an editor comment to an entry"},
+		{method: http.MethodDelete, path: "/entries/:guid/comments/:commentID", handler: handleDeleteEditorComment, perm: permEntriesDelete,
+			tag: "entries", summary: "Delete an editor comment"},
+		{method: http.MethodDelete, path: "/entries/:id/submission", handler: handleRejectSubmission, perm: permEntriesStatus,
+			tag: "submissions", summary: "Reject a submission"},
+
+		// User management.
+		{method: http.MethodGet, path: "/users", handler: handleGetUsers, perm: permUsers,
+			tag: "users", summary: "Get all users"},
+		{method: http.MethodGet, path: "/users/:id", handler: handleGetUser, perm: permUsers,
+			tag: "users", summary: "Get a user"},
+		{method: http.MethodPost, path: "/users", handler: handleInsertUser, perm: permUsers,
+			tag: "users", summary: "Create a user"},
+		{method: http.MethodPut, path: "/users/:id", handler: handleUpdateUser, perm: permUsers,
+			tag: "users", summary: "Update a user"},
+		{method: http.MethodDelete, path: "/users/:id", handler: handleDeleteUser, perm: permUsers,
+			tag: "users", summary: "Delete a user"},
+
+		{method: http.MethodGet, path: "/export", handler: handleExportData, perm: permJobs,
+			tag: "jobs", summary: "Stream a JSON lines export of all entries and relations", query: []string{"from_lang", "to_lang", "tag", "status", "since"}},
+		{method: http.MethodGet, path: "/jobs", handler: handleGetJobs, perm: permJobs,
+			tag: "jobs", summary: "Get background jobs", query: []string{"status", "page", "per_page"}},
+		{method: http.MethodGet, path: "/jobs/:id", handler: handleGetJob, perm: permJobs,
+			tag: "jobs", summary: "Get a background job with its log"},
+		{method: http.MethodGet, path: "/jobs/:id/file", handler: handleGetJobFile, perm: permJobs,
+			tag: "jobs", summary: "Download the file of a finished export job"},
+		{method: http.MethodPost, path: "/jobs", handler: handleInsertJob, perm: permJobs,
+			tag: "jobs", summary: "Queue an import or export job", query: []string{"dry_run"}},
+		{method: http.MethodDelete, path: "/jobs/:id", handler: handleCancelJob, perm: permJobs,
+			tag: "jobs", summary: "Cancel a queued or running job"},
+		{method: http.MethodGet, path: "/replace/preview", handler: handleReplacePreview, perm: permJobs,
+			tag: "jobs", summary: "Preview the changes of a find-and-replace job on definitions", query: []string{"find", "replace", "regex", "lang", "tag"}},
+		{method: http.MethodGet, path: "/trash", handler: handleGetTrash, perm: permEntriesDelete,
+			tag: "trash", summary: "Get deleted entries and relations", query: []string{"type", "page", "per_page"}},
+		{method: http.MethodGet, path: "/trash/:id", handler: handleGetTrashItem, perm: permEntriesDelete,
+			tag: "trash", summary: "Get a deleted entry or relation with its data"},
+		{method: http.MethodPost, path: "/trash/:id/restore", handler: handleRestoreTrash, perm: permEntriesDelete,
+			tag: "trash", summary: "Restore a deleted entry or relation"},
+		{method: http.MethodDelete, path: "/trash/:id", handler: handleDeleteTrash, perm: permEntriesDelete,
+			tag: "trash", summary: "Permanently delete an item in the trash", query: []string{"dry_run"}},
+		{method: http.MethodDelete, path: "/trash", handler: handleDeleteTrash, perm: permEntriesDelete,
+			tag: "trash", summary: "Empty the trash", query: []string{"dry_run"}},
+		{method: http.MethodGet, path: "/maintenance", handler: handleGetMaintenance, perm: permEntriesRead,
+			tag: "maintenance", summary: "Get the maintenance mode state"},
+		{method: http.MethodPut, path: "/maintenance", handler: handleUpdateMaintenance, perm: permSettings,
+			tag: "maintenance", summary: "Turn maintenance mode on or off"},
+		{method: http.MethodGet, path: "/languages", handler: handleGetLangs, perm: permSettings,
+			tag: "languages", summary: "Get the languages managed from the admin"},
+		{method: http.MethodPost, path: "/languages", handler: handleUpsertLang, perm: permSettings,
+			tag: "languages", summary: "Add a language (restarts the server)"},
+		{method: http.MethodPut, path: "/languages/:id", handler: handleUpsertLang, perm: permSettings,
+			tag: "languages", summary: "Update a language (restarts the server)"},
+		{method: http.MethodDelete, path: "/languages/:id", handler: handleDeleteLang, perm: permSettings,
+			tag: "languages", summary: "Delete a language without entries (restarts the server)"},
+		{method: http.MethodGet, path: "/redirects", handler: handleGetRedirects, perm: permSettings,
+			tag: "redirects", summary: "Get the redirects of old site paths", query: []string{"q", "page", "per_page"}},
+		{method: http.MethodPost, path: "/redirects", handler: handleInsertRedirect, perm: permSettings,
+			tag: "redirects", summary: "Add a redirect"},
+		{method: http.MethodPut, path: "/redirects", handler: handleUpsertRedirects, perm: permSettings,
+			tag: "redirects", summary: "Add or replace redirects in bulk", query: []string{"dry_run"}},
+		{method: http.MethodPut, path: "/redirects/:id", handler: handleUpdateRedirect, perm: permSettings,
+			tag: "redirects", summary: "Update a redirect"},
+		{method: http.MethodDelete, path: "/redirects/:id", handler: handleDeleteRedirect, perm: permSettings,
+			tag: "redirects", summary: "Delete a redirect"},
+		{method: http.MethodGet, path: "/audit", handler: handleGetAuditLogs, perm: permAudit,
+			tag: "audit", summary: "Get the audit log",
+			query: []string{"username", "entity", "entity_id", "method", "from", "to", "page", "per_page"}},
+	}...)
+}
+
+// apiResp is the stable v1 API response envelope. On success, data (and meta
+// for paginated results) is set, and on failure, error is set.
+type apiResp struct {
+	Data  interface{} `json:"data"`
+	Error *apiError   `json:"error"`
+	Meta  *apiMeta    `json:"meta"`
+}
+
+// apiError represents an error in the v1 API response envelope.
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+
+	// Fields in the request body that failed validation (422).
+	Fields []fieldError `json:"fields,omitempty"`
+}
+
+// apiMeta represents the pagination of results in the v1 API response envelope.
+type apiMeta struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	TotalPages int `json:"total_pages"`
+	Total      int `json:"total"`
+
+	// Cursor for the next page of results that support keyset pagination.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// paged is implemented by paginated API responses.
+type paged interface {
+	pageMeta() *apiMeta
+}
+
+// apiSerializer wraps okResp responses of the v1 APIs in the v1 envelope
+// and leaves all other responses as they are.
+type apiSerializer struct {
+	echo.DefaultJSONSerializer
+}
+
+func (s apiSerializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	if r, ok := i.(okResp); ok && isAPIv1(c) {
+		out := apiResp{Data: r.Data}
+		if p, ok := r.Data.(paged); ok {
+			out.Meta = p.pageMeta()
+		}
+		i = out
+	}
+
+	return s.DefaultJSONSerializer.Serialize(c, i, indent)
+}
+
+// httpErrorHandler returns an error handler that responds to v1 API errors
+// with the v1 envelope, to errors on the public site pages with redirects of
+// paths that aren't found or the theme's error page, and to all other errors
+// (the legacy API, the admin) with the default handler.
+func httpErrorHandler(srv *echo.Echo) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		switch {
+		case isAPIv1(c):
+			code, msg := errorStatus(err, srv.Debug)
+			e := apiError{Code: code, Message: msg}
+
+			var he *echo.HTTPError
+			if errors.As(err, &he) {
+				if v, ok := he.Message.(validationError); ok {
+					e.Fields = v.Fields
+				}
+			}
+
+			if c.Request().Method == http.MethodHead {
+				err = c.NoContent(e.Code)
+			} else {
+				err = c.JSON(e.Code, apiResp{Error: &e})
+			}
+			if err != nil {
+				srv.Logger.Error(err)
+			}
+			return
+
+		case isSitePath(c):
+			app, ok := c.Get("app").(*App)
+			if !ok {
+				break
+			}
+
+			// Internal errors aren't shown to site visitors.
+			code, msg := errorStatus(err, false)
+
+			// Paths that aren't found may have been redirected (eg: legacy URLs).
+			if m := c.Request().Method; code == http.StatusNotFound && (m == http.MethodGet || m == http.MethodHead) {
+				if u, rc, ok := matchRedirect(c.Request().URL, app); ok {
+					if err := c.Redirect(rc, u); err != nil {
+						srv.Logger.Error(err)
+					}
+					return
+				}
+			}
+
+			if app.siteTpl == nil {
+				break
+			}
+			if code >= http.StatusInternalServerError {
+				srv.Logger.Error(err)
+			}
+
+			rErr := renderError(c, code, msg)
+			if rErr == nil {
+				return
+			}
+			srv.Logger.Error(rErr)
+		}
+
+		srv.DefaultHTTPErrorHandler(err, c)
+	}
+}
+
+// errorStatus returns the HTTP status code and the message of an error.
+// The messages of errors other than *echo.HTTPError are only returned in
+// debug mode.
+func errorStatus(err error, debug bool) (int, string) {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code, fmt.Sprintf("%v", he.Message)
+	}
+	if debug {
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+}
+
+// isAPIv1 checks if a request is to a v1 API.
+func isAPIv1(c echo.Context) bool {
+	p := c.Request().URL.Path
+	return p == apiV1 || strings.HasPrefix(p, apiV1+"/")
+}
+
+// apiPath returns the unversioned path of an API route, eg: /api/v1/entries => /api/entries.
+func apiPath(path string) string {
+	if path == apiV1 || strings.HasPrefix(path, apiV1+"/") {
+		return apiLegacy + strings.TrimPrefix(path, apiV1)
+	}
+
+	return path
+}
+
+// newAPIMeta returns the v1 API pagination meta from a paginator set.
+func newAPIMeta(pg paginator.Set) *apiMeta {
+	return &apiMeta{
+		Page:       pg.Page,
+		PerPage:    pg.PerPage,
+		TotalPages: pg.TotalPages,
+		Total:      pg.Total,
+	}
+}
+
+func (r *results) pageMeta() *apiMeta {
+	m := newAPIMeta(r.Set)
+	m.NextCursor = r.NextCursor
+	return m
+}
+
+func (g *glossary) pageMeta() *apiMeta {
+	return newAPIMeta(g.Set)
+}
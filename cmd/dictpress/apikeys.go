@@ -0,0 +1,445 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/koanf/v2"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// apiKeyHeader is the request header with the API key.
+	apiKeyHeader = "X-API-Key"
+
+	// authAPIKey is the context key of the ID of the API key of a request.
+	authAPIKey = "auth_api_key"
+
+	// Prefix of generated keys and the length of the prefix stored to identify keys.
+	apiKeyPrefix    = "dp_"
+	apiKeyPrefixLen = 10
+
+	// Max number of days in a usage report.
+	maxUsageDays = 366
+)
+
+type apiKeysOpt struct {
+	Enabled       bool          `koanf:"enabled"`
+	Required      bool          `koanf:"required"`
+	FlushInterval time.Duration `koanf:"flush_interval"`
+}
+
+// apiKeyLimiter authenticates public API requests with API keys and enforces
+// their per-minute rate limits and daily quotas in memory. The request counts
+// are periodically written to the DB and the keys with the counts of the day
+// are reloaded from it, so that with multiple instances, daily quotas are
+// shared, lagging by the flush interval, and rate limits are per instance.
+type apiKeyLimiter struct {
+	opt apiKeysOpt
+
+	// Key hash => key state.
+	keys map[string]*apiKeyState
+	mu   sync.Mutex
+}
+
+type apiKeyState struct {
+	key data.APIKey
+
+	// Requests in the current minute and on the day.
+	minute  time.Time
+	minuteN int
+	day     string
+	dayN    int
+
+	// Requests and rejected requests yet to be written to the DB.
+	requests int
+	rejected int
+}
+
+// rateInfo is the rate limit of an API key for the response headers.
+type rateInfo struct {
+	keyID     int
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// initAPIKeys initializes API keys of the public APIs.
+func initAPIKeys(ko *koanf.Koanf) *apiKeyLimiter {
+	o := apiKeysOpt{FlushInterval: time.Minute}
+	if err := ko.Unmarshal("api_keys", &o); err != nil {
+		lo.Fatalf("error loading api_keys config: %v", err)
+	}
+	if o.FlushInterval < time.Second {
+		o.FlushInterval = time.Minute
+	}
+
+	return &apiKeyLimiter{opt: o, keys: make(map[string]*apiKeyState)}
+}
+
+// load (re)loads the API keys and their request counts of the day from the DB,
+// retaining the counts that are yet to be written.
+func (l *apiKeyLimiter) load(app *App) error {
+	keys, err := app.data.GetAPIKeys()
+	if err != nil {
+		return err
+	}
+
+	day := time.Now().Format("2006-01-02")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	old := l.keys
+	l.keys = make(map[string]*apiKeyState, len(keys))
+	for _, k := range keys {
+		s := &apiKeyState{key: k, day: day, dayN: k.RequestsToday}
+		if o, ok := old[k.KeyHash]; ok {
+			s.minute, s.minuteN = o.minute, o.minuteN
+			s.requests, s.rejected = o.requests, o.rejected
+			s.dayN += o.requests
+		}
+		l.keys[k.KeyHash] = s
+	}
+
+	return nil
+}
+
+// allow checks an API key and counts a request on it, returning an error if
+// the key is invalid or its limits are exceeded.
+func (l *apiKeyLimiter) allow(key string, now time.Time) (rateInfo, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.keys[hashAPIKey(key)]
+	if !ok {
+		return rateInfo{}, echo.NewHTTPError(http.StatusUnauthorized, "invalid API key")
+	}
+	if !s.key.Enabled {
+		return rateInfo{}, echo.NewHTTPError(http.StatusForbidden, "API key is disabled")
+	}
+
+	win := now.Truncate(time.Minute)
+	if !s.minute.Equal(win) {
+		s.minute, s.minuteN = win, 0
+	}
+	if day := now.Format("2006-01-02"); s.day != day {
+		s.day, s.dayN = day, 0
+	}
+
+	out := rateInfo{keyID: s.key.ID, limit: s.key.RateLimit, reset: win.Add(time.Minute)}
+
+	if s.key.DailyQuota > 0 && s.dayN >= s.key.DailyQuota {
+		s.rejected++
+		y, m, d := now.Date()
+		out.reset = time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+		return out, echo.NewHTTPError(http.StatusTooManyRequests, "daily quota of the API key exceeded")
+	}
+	if s.key.RateLimit > 0 && s.minuteN >= s.key.RateLimit {
+		s.rejected++
+		return out, echo.NewHTTPError(http.StatusTooManyRequests, "rate limit of the API key exceeded")
+	}
+
+	s.minuteN++
+	s.dayN++
+	s.requests++
+	out.remaining = s.key.RateLimit - s.minuteN
+
+	return out, nil
+}
+
+// flush writes the counted requests to the DB and resets the counts.
+func (l *apiKeyLimiter) flush(app *App) {
+	var (
+		requests = map[int]int{}
+		rejected = map[int]int{}
+	)
+
+	l.mu.Lock()
+	for _, s := range l.keys {
+		if s.requests == 0 && s.rejected == 0 {
+			continue
+		}
+		requests[s.key.ID], rejected[s.key.ID] = s.requests, s.rejected
+		s.requests, s.rejected = 0, 0
+	}
+	l.mu.Unlock()
+
+	if len(requests) == 0 {
+		return
+	}
+	if err := app.data.RecordAPIKeyUsage(requests, rejected); err != nil {
+		app.lo.Printf("error recording API key usage: %v", err)
+	}
+}
+
+// runAPIKeyFlusher periodically writes the API key request counts to the DB
+// and reloads the keys.
+func runAPIKeyFlusher(app *App) {
+	for {
+		time.Sleep(app.apiKeys.opt.FlushInterval)
+		app.apiKeys.flush(app)
+
+		if err := app.apiKeys.load(app); err != nil {
+			app.lo.Printf("error loading API keys: %v", err)
+		}
+	}
+}
+
+// apiKeyAuth returns a middleware that authenticates public API requests with
+// the API key in the X-API-Key header and enforces its limits. If required is
+// set and keys are required in the config, requests without a key are rejected.
+func apiKeyAuth(required bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			app := c.Get("app").(*App)
+			if app.apiKeys == nil {
+				return next(c)
+			}
+
+			key := c.Request().Header.Get(apiKeyHeader)
+			if key == "" {
+				if required && app.apiKeys.opt.Required {
+					return echo.NewHTTPError(http.StatusUnauthorized, "an API key is required in the "+apiKeyHeader+" header")
+				}
+				return next(c)
+			}
+
+			r, err := app.apiKeys.allow(key, time.Now())
+			if r.limit > 0 {
+				h := c.Response().Header()
+				h.Set("X-RateLimit-Limit", strconv.Itoa(r.limit))
+				h.Set("X-RateLimit-Remaining", strconv.Itoa(r.remaining))
+				h.Set("X-RateLimit-Reset", strconv.FormatInt(r.reset.Unix(), 10))
+			}
+			if err != nil {
+				if e, ok := err.(*echo.HTTPError); ok && e.Code == http.StatusTooManyRequests {
+					c.Response().Header().Set("Retry-After", strconv.Itoa(int(time.Until(r.reset).Seconds())+1))
+				}
+				return err
+			}
+
+			c.Set(authAPIKey, r.keyID)
+			return next(c)
+		}
+	}
+}
+
+// handleGetAPIKeys returns all API keys.
+func handleGetAPIKeys(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	out, err := app.data.GetAPIKeys()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching API keys: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleInsertAPIKey issues a new API key. The key is only returned in the
+// response and only its hash is stored.
+func handleInsertAPIKey(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	k, err := bindAPIKey(c)
+	if err != nil {
+		return err
+	}
+
+	rnd, err := randomString(24)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	key := apiKeyPrefix + rnd
+	k.KeyHash = hashAPIKey(key)
+	k.KeyPrefix = key[:apiKeyPrefixLen]
+
+	out, err := app.data.InsertAPIKey(k)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error creating API key: %v", err))
+	}
+	out.Key = key
+
+	reloadAPIKeys(app)
+	app.notify(clusterAPIKeys)
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateAPIKey updates the name, notes, limits, and the status of an API key.
+func handleUpdateAPIKey(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	k, err := bindAPIKey(c)
+	if err != nil {
+		return err
+	}
+
+	out, err := app.data.UpdateAPIKey(id, k)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "API key not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error updating API key: %v", err))
+	}
+
+	reloadAPIKeys(app)
+	app.notify(clusterAPIKeys)
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteAPIKey deletes (revokes) an API key.
+func handleDeleteAPIKey(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if err := app.data.DeleteAPIKey(id); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "API key not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error deleting API key: %v", err))
+	}
+
+	reloadAPIKeys(app)
+	app.notify(clusterAPIKeys)
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleGetAPIKeyUsage returns the usage report of an API key.
+func handleGetAPIKeyUsage(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	return getAPIKeyUsage(c, id, app)
+}
+
+// handleGetOwnAPIKeyUsage returns the usage report of the API key of the request.
+func handleGetOwnAPIKeyUsage(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	id, ok := c.Get(authAPIKey).(int)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "an API key is required in the "+apiKeyHeader+" header")
+	}
+
+	return getAPIKeyUsage(c, id, app)
+}
+
+// getAPIKeyUsage responds with an API key and its daily request counts between
+// ?from and ?to (YYYY-MM-DD), by default, in the past 30 days.
+func getAPIKeyUsage(c echo.Context, id int, app *App) error {
+	var (
+		now  = time.Now()
+		from = now.AddDate(0, 0, -29)
+		to   = now
+	)
+
+	if s := c.QueryParam("from"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid `from` date. Should be YYYY-MM-DD")
+		}
+		from = t
+	}
+	if s := c.QueryParam("to"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid `to` date. Should be YYYY-MM-DD")
+		}
+		to = t
+	}
+	if to.Before(from) || to.Sub(from) > time.Hour*24*maxUsageDays {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("`to` should be after `from` and within %d days", maxUsageDays))
+	}
+
+	k, err := app.data.GetAPIKey(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "API key not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching API key: %v", err))
+	}
+
+	usage, err := app.data.GetAPIKeyUsage(id, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching API key usage: %v", err))
+	}
+
+	var out struct {
+		Key      data.APIKey        `json:"key"`
+		From     string             `json:"from"`
+		To       string             `json:"to"`
+		Requests int                `json:"requests"`
+		Rejected int                `json:"rejected"`
+		Days     []data.APIKeyUsage `json:"days"`
+	}
+	out.Key = k
+	out.From, out.To = from.Format("2006-01-02"), to.Format("2006-01-02")
+	out.Days = usage
+	for _, u := range usage {
+		out.Requests += u.Requests
+		out.Rejected += u.Rejected
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// bindAPIKey binds and validates the fields of an API key in a request.
+func bindAPIKey(c echo.Context) (data.APIKey, error) {
+	k := data.APIKey{Enabled: true}
+	if err := c.Bind(&k); err != nil {
+		return k, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	k.Name = strings.TrimSpace(k.Name)
+
+	var v validator
+	if v.required("name", k.Name) {
+		v.maxLen("name", k.Name, 200)
+	}
+	v.maxLen("notes", k.Notes, maxNotesLen)
+	if k.RateLimit < 0 {
+		v.add("rate_limit", "should be 0 (unlimited) or more")
+	}
+	if k.DailyQuota < 0 {
+		v.add("daily_quota", "should be 0 (unlimited) or more")
+	}
+
+	return k, v.err()
+}
+
+// reloadAPIKeys reloads the API keys after a change so that it's effective immediately.
+func reloadAPIKeys(app *App) {
+	if err := app.apiKeys.load(app); err != nil {
+		app.lo.Printf("error loading API keys: %v", err)
+	}
+}
+
+// hashAPIKey returns the SHA256 hash of an API key.
+func hashAPIKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/knadh/stuffbin"
+	"github.com/labstack/echo/v4"
+)
+
+// Fingerprinted static files don't change and are cached by browsers for a year.
+const assetCacheControl = "public, max-age=31536000, immutable"
+
+// fingerprintAssets returns the fingerprinted paths of the static files in a
+// site theme (eg: /static/style.css => /static/style.9f86d08188.css), with
+// a hash of the file's contents in the name, and the reverse mapping.
+func fingerprintAssets(fs stuffbin.FileSystem) (map[string]string, map[string]string, error) {
+	var (
+		assets = map[string]string{}
+		files  = map[string]string{}
+	)
+	for _, p := range fs.List() {
+		if !strings.HasPrefix(p, "/static/") {
+			continue
+		}
+
+		b, err := fs.Read(p)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var (
+			h   = sha256.Sum256(b)
+			ext = path.Ext(p)
+			fp  = fmt.Sprintf("%s.%x%s", strings.TrimSuffix(p, ext), h[:5], ext)
+		)
+		assets[p] = fp
+		files[fp] = p
+	}
+
+	return assets, files, nil
+}
+
+// asset returns the fingerprinted path of a file in the theme's static
+// directory (eg: style.css), or its path if it doesn't exist.
+func (t *siteTheme) asset(name string) string {
+	p := "/static/" + strings.TrimPrefix(path.Clean("/"+name), "/")
+	if fp, ok := t.assets[p]; ok {
+		return fp
+	}
+
+	return p
+}
+
+// serveStatic serves a file in the theme's static directory. Fingerprinted
+// files are served with far-future cache headers.
+func (t *siteTheme) serveStatic(c echo.Context) error {
+	req := c.Request()
+	if p, ok := t.files[req.URL.Path]; ok {
+		req = req.Clone(req.Context())
+		req.URL.Path = p
+		req.URL.RawPath = ""
+		c.Response().Header().Set("Cache-Control", assetCacheControl)
+	} else if !strings.HasPrefix(path.Clean(req.URL.Path), "/static/") {
+		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+
+	t.fileServer.ServeHTTP(c.Response(), req)
+	return nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// auditLogs represents a page of audit log records.
+type auditLogs struct {
+	Logs       []data.AuditLog `json:"logs"`
+	Page       int             `json:"page"`
+	PerPage    int             `json:"per_page"`
+	TotalPages int             `json:"total_pages"`
+	Total      int             `json:"total"`
+}
+
+func (a *auditLogs) pageMeta() *apiMeta {
+	return &apiMeta{Page: a.Page, PerPage: a.PerPage, TotalPages: a.TotalPages, Total: a.Total}
+}
+
+// Context key that handlers creating entities set the new entity's ID in
+// for the audit log, if the ID is not in the response.
+const auditNewID = "audit_new_id"
+
+// dumpWriter is an http.ResponseWriter that records the response body.
+type dumpWriter struct {
+	http.ResponseWriter
+	buf *bytes.Buffer
+}
+
+func (w *dumpWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// auditLog is a middleware that records successful mutations made via the
+// admin APIs along with snapshots of the entity loaded from the DB before and
+// after the change. The after snapshot of deleted entities is null.
+func auditLog(app *App) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+
+			// Edit locks are transient and are renewed frequently, and dry runs
+			// don't change anything.
+			if strings.HasSuffix(c.Path(), "/lock") || isDryRun(c) {
+				return next(c)
+			}
+
+			entity, id := auditEntity(c)
+			before := auditSnapshot(entity, id, app)
+
+			// Record the response to get the IDs of new entities.
+			var (
+				w   = c.Response().Writer
+				buf = &bytes.Buffer{}
+			)
+			c.Response().Writer = &dumpWriter{ResponseWriter: w, buf: buf}
+			err := next(c)
+			c.Response().Writer = w
+
+			if err != nil || c.Response().Status >= http.StatusBadRequest {
+				return err
+			}
+
+			// New entities get their IDs only after they're created.
+			if id == 0 {
+				id = auditCreatedID(c, buf.Bytes())
+			}
+
+			username, _ := c.Get(authUser).(string)
+			a := data.AuditLog{
+				Username: username,
+				Method:   c.Request().Method,
+				Endpoint: c.Request().URL.Path,
+				Entity:   entity,
+				EntityID: id,
+				Before:   before,
+				After:    auditSnapshot(entity, id, app),
+				IP:       c.RealIP(),
+			}
+			if err := app.data.InsertAuditLog(a); err != nil {
+				app.lo.Printf("error recording audit log: %v", err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// auditEntity returns the type and ID of the entity that an admin API route operates on.
+func auditEntity(c echo.Context) (string, int) {
+	var (
+		path   = apiPath(c.Path())
+		id, _  = strconv.Atoi(c.Param("id"))
+		cID, _ = strconv.Atoi(c.Param("commentID"))
+	)
+
+	switch {
+	case strings.HasPrefix(path, "/api/users"):
+		return "user", id
+	case strings.HasPrefix(path, "/api/jobs"):
+		return "job", id
+	case strings.HasPrefix(path, "/api/trash"):
+		return "trash", id
+	case strings.HasPrefix(path, "/api/maintenance"), strings.HasPrefix(path, "/api/languages"):
+		return "setting", 0
+	case strings.Contains(path, "/relations/weights"):
+		return "entry", id
+	case strings.Contains(path, "/examples"):
+		exID, _ := strconv.Atoi(c.Param("exampleID"))
+		return "example", exID
+	case strings.Contains(path, "/media"):
+		mID, _ := strconv.Atoi(c.Param("mediaID"))
+		return "media", mID
+	case strings.Contains(path, "/relations/"):
+		relID, _ := strconv.Atoi(c.Param("relID"))
+		return "relation", relID
+	case strings.HasPrefix(path, "/api/mt/promote"):
+		return "entry", 0
+	case strings.HasPrefix(path, "/api/word-lists"):
+		return "word_list", id
+	case strings.HasPrefix(path, "/api/redirects"):
+		return "redirect", id
+	case strings.HasPrefix(path, "/api/api-keys"):
+		return "api_key", id
+	case strings.HasPrefix(path, "/api/entries/comments"):
+		return "comment", cID
+	case strings.HasSuffix(path, "/comments") || strings.Contains(path, "/comments/"):
+		return "editor_comment", cID
+	case strings.HasPrefix(path, "/api/entries"):
+		return "entry", id
+	}
+
+	return "", id
+}
+
+// auditCreatedID returns the ID of an entity created by a handler that's either
+// set in the context or is in the response.
+func auditCreatedID(c echo.Context, resp []byte) int {
+	if id, ok := c.Get(auditNewID).(int); ok {
+		return id
+	}
+
+	var r struct {
+		Data struct {
+			ID int `json:"id"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(resp, &r) != nil {
+		return 0
+	}
+
+	return r.Data.ID
+}
+
+// auditSnapshot returns the JSON snapshot of an entity in the DB. If the entity
+// doesn't exist (eg: before it's created or after it's deleted), it returns nil.
+func auditSnapshot(entity string, id int, app *App) json.RawMessage {
+	if id < 1 {
+		return nil
+	}
+
+	var (
+		v   interface{}
+		err error
+	)
+	switch entity {
+	case "entry":
+		// Entries are recorded with their relations so that changes to
+		// relations (eg: reordering) are visible.
+		var e data.Entry
+		if e, err = app.data.GetEntry(id); err == nil {
+			e.Relations = make([]data.Entry, 0)
+			res := []data.Entry{e}
+			err = app.data.SearchAndLoadRelations(res, data.Query{})
+			v = res[0]
+		}
+	case "user":
+		v, err = app.data.GetUser(id, "")
+	case "redirect":
+		v, err = app.data.GetRedirect(id)
+	case "api_key":
+		v, err = app.data.GetAPIKey(id)
+	case "relation", "comment", "editor_comment", "example", "media", "trash":
+		var b json.RawMessage
+		b, err = app.data.GetAuditRow(entity, id)
+		if err == nil {
+			return b
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		if err != sql.ErrNoRows {
+			app.lo.Printf("error fetching %s %d for audit log: %v", entity, id, err)
+		}
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	return b
+}
+
+// handleGetAuditLogs returns paginated audit log records.
+func handleGetAuditLogs(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		pg  = app.resultsPg.NewFromURL(c.Request().URL.Query())
+	)
+
+	q := data.AuditQuery{
+		Username: c.QueryParam("username"),
+		Entity:   c.QueryParam("entity"),
+		Method:   strings.ToUpper(c.QueryParam("method")),
+	}
+
+	if v := c.QueryParam("entity_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid `entity_id`.")
+		}
+		q.EntityID = id
+	}
+
+	var err error
+	if q.From, err = parseAuditDate(c.QueryParam("from"), false); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid `from`: %v", err))
+	}
+	if q.To, err = parseAuditDate(c.QueryParam("to"), true); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid `to`: %v", err))
+	}
+
+	res, total, err := app.data.GetAuditLogs(q, pg.Offset, pg.Limit)
+	if err != nil {
+		app.lo.Printf("error querying audit log: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	pg.SetTotal(total)
+
+	out := &auditLogs{res, pg.Page, pg.PerPage, pg.TotalPages, total}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// parseAuditDate parses an optional YYYY-MM-DD or RFC3339 timestamp. If endOfDay
+// is set, a YYYY-MM-DD date is moved to the end of the day to make it inclusive.
+func parseAuditDate(s string, endOfDay bool) (null.Time, error) {
+	if s == "" {
+		return null.Time{}, nil
+	}
+
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return null.TimeFrom(t), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return null.Time{}, err
+	}
+
+	return null.TimeFrom(t), nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/oidc"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	sessionCookie = "dictpress_session"
+	oidcCookie    = "dictpress_oidc"
+)
+
+// oidcAuth represents OpenID Connect login for the admin.
+type oidcAuth struct {
+	client *oidc.OIDC
+
+	// role => provider groups.
+	roles map[string][]string
+
+	// Secret for signing session cookies.
+	secret     []byte
+	sessionTTL time.Duration
+}
+
+// session represents a logged in admin session stored in a signed cookie.
+type session struct {
+	Username string `json:"u"`
+	Role     string `json:"r"`
+	Expiry   int64  `json:"e"`
+}
+
+// Roles in the order of precedence when a user belongs to multiple mapped groups.
+var roleOrder = []string{data.RoleAdmin, data.RoleReviewer, data.RoleEditor, data.RoleReadOnly}
+
+// authMiddleware authenticates admin requests with a login session cookie, if
+// OIDC is enabled, falling back to HTTP BasicAuth.
+func authMiddleware(app *App) echo.MiddlewareFunc {
+	ba := middleware.BasicAuth(basicAuth)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		baNext := ba(next)
+
+		return func(c echo.Context) error {
+			if app.oidc == nil {
+				return baNext(c)
+			}
+
+			if s, ok := app.oidc.getSession(c); ok {
+				c.Set(isAuthed, true)
+				c.Set(authUser, s.Username)
+				c.Set(authRole, s.Role)
+				return next(c)
+			}
+
+			// Send browsers requesting admin pages without BasicAuth credentials to the provider.
+			if c.Request().Header.Get(echo.HeaderAuthorization) == "" && strings.HasPrefix(c.Path(), "/admin") {
+				return c.Redirect(http.StatusFound, app.consts.RootURL+"/admin/login")
+			}
+
+			return baNext(c)
+		}
+	}
+}
+
+// handleOIDCLogin redirects to the OIDC provider for logging in.
+func handleOIDCLogin(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	state, err := randomString(16)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	// Remember the state and nonce to validate the callback.
+	c.SetCookie(app.newCookie(oidcCookie, state+":"+nonce, time.Now().Add(time.Minute*10)))
+
+	return c.Redirect(http.StatusFound, app.oidc.client.AuthURL(state, nonce))
+}
+
+// handleOIDCCallback handles the redirect from the OIDC provider after
+// logging in, maps the user's groups to a role, and creates a session.
+func handleOIDCCallback(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	ck, err := c.Cookie(oidcCookie)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "login session expired. Retry.")
+	}
+	c.SetCookie(app.newCookie(oidcCookie, "", time.Unix(0, 0)))
+
+	state, nonce, _ := strings.Cut(ck.Value, ":")
+	if state == "" || !hmac.Equal([]byte(state), []byte(c.QueryParam("state"))) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid login state")
+	}
+
+	if e := c.QueryParam("error"); e != "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login failed: "+e)
+	}
+
+	claims, err := app.oidc.client.Exchange(c.QueryParam("code"), nonce)
+	if err != nil {
+		app.lo.Printf("error logging in with oidc: %v", err)
+		return echo.NewHTTPError(http.StatusUnauthorized, "login failed")
+	}
+
+	role := app.oidc.mapRole(claims.Groups)
+	if role == "" {
+		return echo.NewHTTPError(http.StatusForbidden, "you are not permitted to access the admin")
+	}
+
+	s := session{
+		Username: claims.Username,
+		Role:     role,
+		Expiry:   time.Now().Add(app.oidc.sessionTTL).Unix(),
+	}
+	c.SetCookie(app.newCookie(sessionCookie, app.oidc.sign(s), time.Unix(s.Expiry, 0)))
+
+	return c.Redirect(http.StatusFound, app.consts.RootURL+"/admin")
+}
+
+// handleLogout clears the login session.
+func handleLogout(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	c.SetCookie(app.newCookie(sessionCookie, "", time.Unix(0, 0)))
+	return c.Redirect(http.StatusFound, app.consts.RootURL+"/")
+}
+
+// mapRole returns the highest role that any of the given groups map to.
+func (o *oidcAuth) mapRole(groups []string) string {
+	for _, r := range roleOrder {
+		for _, g := range o.roles[r] {
+			for _, ug := range groups {
+				if g == ug {
+					return r
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// sign encodes and signs a session as a cookie value.
+func (o *oidcAuth) sign(s session) string {
+	return signCookie(o.secret, s)
+}
+
+// getSession returns the valid session in the request's session cookie, if there's one.
+func (o *oidcAuth) getSession(c echo.Context) (session, bool) {
+	ck, err := c.Cookie(sessionCookie)
+	if err != nil || ck.Value == "" {
+		return session{}, false
+	}
+
+	s, err := o.verify(ck.Value)
+	if err != nil {
+		return session{}, false
+	}
+
+	return s, true
+}
+
+// verify verifies a signed cookie value and decodes the session in it.
+func (o *oidcAuth) verify(val string) (session, error) {
+	var s session
+	if err := verifyCookie(o.secret, val, &s); err != nil {
+		return session{}, err
+	}
+
+	if time.Now().Unix() > s.Expiry {
+		return session{}, errors.New("session expired")
+	}
+
+	return s, nil
+}
+
+// signCookie encodes a value as JSON and signs it with a secret as a cookie value.
+func signCookie(secret []byte, v interface{}) string {
+	b, _ := json.Marshal(v)
+	val := base64.RawURLEncoding.EncodeToString(b)
+
+	return val + "." + base64.RawURLEncoding.EncodeToString(hmacHash(secret, val))
+}
+
+// verifyCookie verifies a cookie value signed with signCookie and decodes the
+// value in it into v.
+func verifyCookie(secret []byte, val string, v interface{}) error {
+	val, sig, ok := strings.Cut(val, ".")
+	if !ok {
+		return errors.New("invalid session")
+	}
+
+	h, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(h, hmacHash(secret, val)) {
+		return errors.New("invalid session")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(val)
+	if err != nil {
+		return errors.New("invalid session")
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.New("invalid session")
+	}
+
+	return nil
+}
+
+func hmacHash(secret []byte, v string) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(v))
+	return m.Sum(nil)
+}
+
+// newCookie returns an HTTP only cookie scoped to the app.
+func (app *App) newCookie(name, val string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    val,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(app.consts.RootURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// randomString returns a random hex string of n bytes.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+)
+
+const backupFilePrefix = "dictpress-"
+
+// backupOpt represents the scheduled backup options.
+type backupOpt struct {
+	Enabled   bool          `koanf:"enabled"`
+	Dir       string        `koanf:"dir"`
+	Interval  time.Duration `koanf:"interval"`
+	Retention int           `koanf:"retention"`
+	PgDump    string        `koanf:"pg_dump"`
+	PgRestore string        `koanf:"pg_restore"`
+}
+
+// backupDB dumps the database into a file in the pg_dump custom archive format.
+func backupDB(fPath string, o backupOpt, ko *koanf.Koanf) error {
+	cmd := exec.Command(o.PgDump,
+		"--format=custom",
+		"--no-owner",
+		"--file="+fPath,
+		"--host="+ko.String("db.host"),
+		"--port="+ko.String("db.port"),
+		"--username="+ko.String("db.user"),
+		ko.String("db.db"))
+
+	return runPgCmd(cmd, ko)
+}
+
+// restoreDB restores a pg_dump archive into the database, replacing existing data.
+func restoreDB(fPath string, o backupOpt, prompt bool, ko *koanf.Koanf) error {
+	if _, err := os.Stat(fPath); err != nil {
+		return err
+	}
+
+	if prompt {
+		fmt.Printf("** IMPORTANT: This will replace all data in the DB '%s' with the backup %s **\n",
+			ko.String("db.db"), fPath)
+
+		var ok string
+		fmt.Print("continue (y/n)?  ")
+		if _, err := fmt.Scanf("%s", &ok); err != nil {
+			return fmt.Errorf("error reading value from terminal: %v", err)
+		}
+		if strings.ToLower(ok) != "y" {
+			fmt.Println("restore cancelled.")
+			return nil
+		}
+	}
+
+	cmd := exec.Command(o.PgRestore,
+		"--clean",
+		"--if-exists",
+		"--no-owner",
+		"--single-transaction",
+		"--host="+ko.String("db.host"),
+		"--port="+ko.String("db.port"),
+		"--username="+ko.String("db.user"),
+		"--dbname="+ko.String("db.db"),
+		fPath)
+
+	return runPgCmd(cmd, ko)
+}
+
+// runPgCmd runs a Postgres commandline tool with the DB password from the config.
+func runPgCmd(cmd *exec.Cmd, ko *koanf.Koanf) error {
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+ko.String("db.password"))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running %s: %v", filepath.Base(cmd.Path), err)
+	}
+
+	return nil
+}
+
+// runBackups periodically backs up the database into the backup directory
+// and deletes old backups beyond the retention count.
+func runBackups(o backupOpt, ko *koanf.Koanf) {
+	if err := os.MkdirAll(o.Dir, 0755); err != nil {
+		lo.Printf("error creating backup directory: %v", err)
+		return
+	}
+
+	t := time.NewTicker(o.Interval)
+	defer t.Stop()
+
+	for range t.C {
+		fPath := filepath.Join(o.Dir, backupFilePrefix+time.Now().Format("20060102-150405")+".dump")
+		if err := backupDB(fPath, o, ko); err != nil {
+			lo.Printf("error backing up database: %v", err)
+			continue
+		}
+		lo.Printf("backed up database to %s", fPath)
+
+		if err := pruneBackups(o.Dir, o.Retention); err != nil {
+			lo.Printf("error deleting old backups: %v", err)
+		}
+	}
+}
+
+// pruneBackups deletes the oldest backups in a directory, keeping the latest n.
+func pruneBackups(dir string, n int) error {
+	if n < 1 {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, backupFilePrefix+"*.dump"))
+	if err != nil {
+		return err
+	}
+
+	// Timestamped names sort chronologically.
+	sort.Strings(files)
+	if len(files) <= n {
+		return nil
+	}
+
+	for _, f := range files[:len(files)-n] {
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// initBackupOpt loads the backup options from the config.
+func initBackupOpt(ko *koanf.Koanf) backupOpt {
+	var o backupOpt
+	if err := ko.Unmarshal("backup", &o); err != nil {
+		lo.Fatalf("error loading backup config: %v", err)
+	}
+
+	if o.PgDump == "" {
+		o.PgDump = "pg_dump"
+	}
+	if o.PgRestore == "" {
+		o.PgRestore = "pg_restore"
+	}
+	if o.Interval == 0 {
+		o.Interval = time.Hour * 24
+	}
+
+	return o
+}
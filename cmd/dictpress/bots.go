@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// Reasons for blocking requests that are counted.
+const (
+	botBlockIP        = "ip"
+	botBlockCountry   = "country"
+	botBlockUserAgent = "user_agent"
+	botBlockEmptyUA   = "empty_user_agent"
+	botBlockRobots    = "robots"
+)
+
+var botBlockReasons = []string{botBlockIP, botBlockCountry, botBlockUserAgent, botBlockEmptyUA, botBlockRobots}
+
+type botsOpt struct {
+	Enabled bool `koanf:"enabled"`
+
+	// Use the client IP in X-Forwarded-For / X-Real-IP set by a reverse proxy.
+	TrustProxyHeaders bool `koanf:"trust_proxy_headers"`
+
+	AllowIPs []string `koanf:"allow_ips"`
+	BlockIPs []string `koanf:"block_ips"`
+
+	// Request header with the client's country code set by a CDN or a
+	// reverse proxy (eg: CF-IPCountry) and the countries to block.
+	CountryHeader  string   `koanf:"country_header"`
+	BlockCountries []string `koanf:"block_countries"`
+
+	BlockUserAgents     []string `koanf:"block_user_agents"`
+	BlockEmptyUserAgent bool     `koanf:"block_empty_user_agent"`
+
+	// Serve /robots.txt and block crawlers that ignore it.
+	HonorRobots       bool     `koanf:"honor_robots"`
+	RobotsDisallow    []string `koanf:"robots_disallow"`
+	CrawlerUserAgents []string `koanf:"crawler_user_agents"`
+}
+
+// botFilter blocks requests to the site and the public APIs by IP, country,
+// and user agent before they reach the handlers, so that scrapers don't
+// dominate the DB load, and counts them.
+type botFilter struct {
+	opt botsOpt
+
+	allowIPs  []*net.IPNet
+	blockIPs  []*net.IPNet
+	countries map[string]bool
+	blockUAs  []*regexp.Regexp
+	crawlers  []*regexp.Regexp
+
+	since   time.Time
+	allowed atomic.Int64
+	blocked map[string]*atomic.Int64
+}
+
+// botStats represents the request counts of the bot filter since the start.
+type botStats struct {
+	Since   time.Time        `json:"since"`
+	Allowed int64            `json:"allowed"`
+	Blocked map[string]int64 `json:"blocked"`
+}
+
+// initBots initializes the bot filter.
+func initBots(ko *koanf.Koanf) *botFilter {
+	var o botsOpt
+	if err := ko.Unmarshal("bots", &o); err != nil {
+		lo.Fatalf("error loading bots config: %v", err)
+	}
+
+	b := &botFilter{
+		opt:       o,
+		countries: make(map[string]bool, len(o.BlockCountries)),
+		since:     time.Now(),
+		blocked:   make(map[string]*atomic.Int64, len(botBlockReasons)),
+	}
+	for _, r := range botBlockReasons {
+		b.blocked[r] = &atomic.Int64{}
+	}
+
+	var err error
+	if b.allowIPs, err = parseIPNets(o.AllowIPs); err != nil {
+		lo.Fatalf("error loading bots.allow_ips: %v", err)
+	}
+	if b.blockIPs, err = parseIPNets(o.BlockIPs); err != nil {
+		lo.Fatalf("error loading bots.block_ips: %v", err)
+	}
+	for _, c := range o.BlockCountries {
+		b.countries[strings.ToUpper(strings.TrimSpace(c))] = true
+	}
+	if b.blockUAs, err = compileRegexps(o.BlockUserAgents); err != nil {
+		lo.Fatalf("error loading bots.block_user_agents: %v", err)
+	}
+	if b.crawlers, err = compileRegexps(o.CrawlerUserAgents); err != nil {
+		lo.Fatalf("error loading bots.crawler_user_agents: %v", err)
+	}
+
+	return b
+}
+
+// check returns the reason for blocking a request, or an empty string if it's allowed.
+func (b *botFilter) check(c echo.Context) string {
+	// API key holders are identified and limited by their keys.
+	app := c.Get("app").(*App)
+	if app.apiKeys != nil && c.Request().Header.Get(apiKeyHeader) != "" && isAPIPath(c.Request().URL.Path) {
+		return ""
+	}
+
+	ip := b.clientIP(c)
+	if ip != nil && matchIPNets(b.allowIPs, ip) {
+		return ""
+	}
+	if ip != nil && matchIPNets(b.blockIPs, ip) {
+		return botBlockIP
+	}
+
+	if len(b.countries) > 0 && b.opt.CountryHeader != "" {
+		if b.countries[strings.ToUpper(c.Request().Header.Get(b.opt.CountryHeader))] {
+			return botBlockCountry
+		}
+	}
+
+	ua := c.Request().UserAgent()
+	if ua == "" {
+		if b.opt.BlockEmptyUserAgent {
+			return botBlockEmptyUA
+		}
+		return ""
+	}
+	for _, re := range b.blockUAs {
+		if re.MatchString(ua) {
+			return botBlockUserAgent
+		}
+	}
+
+	// Crawlers that ignore robots.txt.
+	if b.opt.HonorRobots && b.disallowed(c.Request().URL.Path) {
+		for _, re := range b.crawlers {
+			if re.MatchString(ua) {
+				return botBlockRobots
+			}
+		}
+	}
+
+	return ""
+}
+
+// disallowed checks whether a path is disallowed in robots.txt.
+func (b *botFilter) disallowed(p string) bool {
+	for _, d := range b.opt.RobotsDisallow {
+		if d != "" && strings.HasPrefix(p, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP of the client of a request.
+func (b *botFilter) clientIP(c echo.Context) net.IP {
+	return requestIP(c, b.opt.TrustProxyHeaders)
+}
+
+// requestIP returns the IP of the client of a request, from the proxy headers
+// (X-Forwarded-For / X-Real-IP) if trustProxy is set.
+func requestIP(c echo.Context, trustProxy bool) net.IP {
+	if trustProxy {
+		return net.ParseIP(c.RealIP())
+	}
+
+	host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		host = c.Request().RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// stats returns the request counts since the start.
+func (b *botFilter) stats() botStats {
+	out := botStats{
+		Since:   b.since,
+		Allowed: b.allowed.Load(),
+		Blocked: make(map[string]int64, len(b.blocked)),
+	}
+	for r, n := range b.blocked {
+		out.Blocked[r] = n.Load()
+	}
+
+	return out
+}
+
+// filterBots is a middleware that blocks bot requests with 403 before they
+// reach the site and public API handlers.
+func filterBots(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		b := c.Get("app").(*App).bots
+		if b == nil {
+			return next(c)
+		}
+
+		if r := b.check(c); r != "" {
+			b.blocked[r].Add(1)
+			return echo.NewHTTPError(http.StatusForbidden, "Request blocked.")
+		}
+
+		b.allowed.Add(1)
+		return next(c)
+	}
+}
+
+// handleRobots serves robots.txt with the disallowed paths in the config.
+func handleRobots(c echo.Context) error {
+	b := c.Get("app").(*App).bots
+
+	var s strings.Builder
+	s.WriteString("User-agent: *\n")
+	for _, d := range b.opt.RobotsDisallow {
+		s.WriteString("Disallow: " + d + "\n")
+	}
+	if len(b.opt.RobotsDisallow) == 0 {
+		s.WriteString("Disallow:\n")
+	}
+
+	return c.String(http.StatusOK, s.String())
+}
+
+// handleGetBotStats returns the request counts of the bot filter.
+func handleGetBotStats(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	return c.JSON(http.StatusOK, okResp{app.bots.stats()})
+}
+
+// parseIPNets parses a list of IPs and CIDR ranges.
+func parseIPNets(list []string) ([]*net.IPNet, error) {
+	out := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR '%s'", s)
+		}
+		out = append(out, n)
+	}
+
+	return out, nil
+}
+
+func matchIPNets(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileRegexps compiles a list of regular expressions.
+func compileRegexps(list []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(list))
+	for _, s := range list {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp '%s': %v", s, err)
+		}
+		out = append(out, re)
+	}
+
+	return out, nil
+}
+
+// isAPIPath checks whether a path is of the APIs.
+func isAPIPath(p string) bool {
+	return p == apiLegacy || strings.HasPrefix(p, apiLegacy+"/")
+}
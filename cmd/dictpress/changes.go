@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	changesDefaultLimit = 100
+	changesMaxLimit     = 1000
+)
+
+// change represents an entry change in the changes API.
+type change struct {
+	GUID      string      `json:"guid"`
+	Action    string      `json:"action"`
+	ChangedAt time.Time   `json:"changed_at"`
+	Entry     *data.Entry `json:"entry,omitempty"`
+}
+
+// handleGetChanges returns entries that were created, updated, or deleted since
+// a timestamp (?since=RFC3339) or a cursor (?cursor) from a previous response,
+// for clients that keep local copies of the dictionary in sync.
+func handleGetChanges(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		limit, _ = strconv.Atoi(c.QueryParam("limit"))
+
+		since time.Time
+		kind  int
+		id    int64
+	)
+
+	if limit < 1 {
+		limit = changesDefaultLimit
+	} else if limit > changesMaxLimit {
+		limit = changesMaxLimit
+	}
+
+	if cur := c.QueryParam("cursor"); cur != "" {
+		var err error
+		if since, kind, id, err = decodeCursor(cur); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid `cursor`.")
+		}
+	} else if s := c.QueryParam("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid `since`. Should be an RFC3339 timestamp.")
+		}
+		since = t
+	}
+
+	// Fetch one more than the limit to know if there are more changes.
+	res, err := app.data.GetChanges(since, kind, id, limit+1)
+	if err != nil {
+		app.lo.Printf("error fetching changes: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching changes")
+	}
+
+	hasMore := len(res) > limit
+	if hasMore {
+		res = res[:limit]
+	}
+
+	// Load the updated entries with their relations.
+	var ids []int
+	for _, r := range res {
+		if r.Action == "update" {
+			ids = append(ids, int(r.ID))
+		}
+	}
+
+	entries := map[int]*data.Entry{}
+	if len(ids) > 0 {
+		e, err := app.data.GetEntriesByIDs(ids)
+		if err != nil {
+			app.lo.Printf("error fetching changed entries: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "error fetching changes")
+		}
+
+		if err := app.data.SearchAndLoadRelations(e, data.Query{Status: data.StatusEnabled}); err != nil {
+			app.lo.Printf("error fetching changed entries: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "error fetching changes")
+		}
+
+		// Hide the numerical IDs as in the public search API.
+		for i := range e {
+			entries[e[i].ID] = &e[i]
+
+			e[i].ID = 0
+			for j := range e[i].Relations {
+				e[i].Relations[j].ID = 0
+				e[i].Relations[j].Relation.ID = 0
+			}
+		}
+	}
+
+	out := struct {
+		Changes    []change `json:"changes"`
+		NextCursor string   `json:"next_cursor"`
+		HasMore    bool     `json:"has_more"`
+	}{Changes: make([]change, 0, len(res)), HasMore: hasMore}
+
+	for _, r := range res {
+		ch := change{GUID: r.GUID, Action: r.Action, ChangedAt: r.ChangedAt}
+		if r.Action == "update" {
+			ch.Entry = entries[int(r.ID)]
+		}
+		out.Changes = append(out.Changes, ch)
+	}
+
+	// The cursor continues from the last change, or stays where it was if there are none.
+	if len(res) > 0 {
+		last := res[len(res)-1]
+		out.NextCursor = encodeCursor(last.ChangedAt, last.Kind, last.ID)
+	} else {
+		out.NextCursor = encodeCursor(since, kind, id)
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// encodeCursor encodes a changes position into an opaque cursor.
+func encodeCursor(t time.Time, kind int, id int64) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%d", t.UnixNano(), kind, id)))
+}
+
+// decodeCursor decodes an opaque cursor into a changes position.
+func decodeCursor(s string) (time.Time, int, int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+
+	p := strings.Split(string(b), ":")
+	if len(p) != 3 {
+		return time.Time{}, 0, 0, fmt.Errorf("invalid cursor")
+	}
+
+	ts, err := strconv.ParseInt(p[0], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+	kind, err := strconv.Atoi(p[1])
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+	id, err := strconv.ParseInt(p[2], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+
+	return time.Unix(0, ts), kind, id, nil
+}
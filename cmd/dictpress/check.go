@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/koanf/v2"
+	"github.com/lib/pq"
+)
+
+// configChecker prints the results of the checks of --check-config and
+// counts the errors.
+type configChecker struct {
+	errs int
+}
+
+func (c *configChecker) ok(section, msg string, args ...interface{}) {
+	fmt.Printf("ok     [%s] %s\n", section, fmt.Sprintf(msg, args...))
+}
+
+func (c *configChecker) fail(section, msg string, args ...interface{}) {
+	fmt.Printf("error  [%s] %s\n", section, fmt.Sprintf(msg, args...))
+	c.errs++
+}
+
+// checkConfig validates the config, the languages and their tokenizers, the
+// dictionaries, the site theme, and the DB connection and schema without
+// starting the app. Unlike startup, it doesn't stop at the first problem and
+// prints all of them. It returns false if there were errors.
+func checkConfig(ko *koanf.Koanf) bool {
+	var c configChecker
+
+	// Required settings.
+	for _, k := range []string{"app.address", "app.root_url", "db.host", "db.port", "db.user", "db.db"} {
+		if ko.String(k) == "" {
+			c.fail("app", "%s is required", k)
+		}
+	}
+	if len(ko.String("app.admin_username")) < 6 {
+		c.fail("app", "admin_username should be min 6 characters")
+	}
+	if len(ko.String("app.admin_password")) < 8 {
+		c.fail("app", "admin_password should be min 8 characters")
+	}
+	switch s := ko.String("app.id_scheme"); s {
+	case "", idSchemeUUIDv4, idSchemeUUIDv7, idSchemeShort:
+	default:
+		c.fail("app", "unknown id_scheme '%s'. Should be one of %s, %s, %s", s, idSchemeUUIDv4, idSchemeUUIDv7, idSchemeShort)
+	}
+	if c.errs == 0 {
+		c.ok("app", "required settings")
+	}
+
+	// Languages and their tokenizers.
+	var (
+		langs = make(data.LangMap)
+		tks   = initTokenizers()
+		pgCfg = map[string]string{}
+	)
+	for _, id := range ko.MapKeys("lang") {
+		l, err := loadLang(id, ko, tks)
+		if err != nil {
+			c.fail("lang."+id, "%v", err)
+			continue
+		}
+
+		switch l.TokenizerType {
+		case "postgres", "":
+			if l.TokenizerName == "" {
+				c.fail("lang."+id, "tokenizer is required with the postgres tokenizer_type. eg: english, simple")
+				continue
+			}
+			// Configs with ts_config are created on start.
+			if l.TSConfig == nil {
+				pgCfg[l.TokenizerName] = id
+			}
+		case "custom":
+		default:
+			c.fail("lang."+id, "unknown tokenizer_type '%s'. Should be postgres|custom", l.TokenizerType)
+			continue
+		}
+
+		langs[id] = l
+		c.ok("lang."+id, "%s (%s tokenizer '%s')", l.Name, l.TokenizerType, l.TokenizerName)
+	}
+	if len(ko.MapKeys("lang")) == 0 {
+		c.fail("lang", "0 languages defined. Add at least one [lang.*] block")
+	}
+	for id, l := range langs {
+		if err := l.Templates.ValidateDefs(langs); err != nil {
+			c.fail("lang."+id, "error in templates config: %v", err)
+		}
+	}
+
+	// Dictionary pairs.
+	var dicts [][]string
+	if err := ko.Unmarshal("app.dicts", &dicts); err != nil {
+		c.fail("app", "error loading dicts: %v", err)
+	} else if len(dicts) == 0 {
+		c.fail("app", "0 dicts defined. Add [$fromLang, $toLang] pairs to dicts")
+	}
+	for _, d := range dicts {
+		if len(d) != 2 {
+			c.fail("app", "dicts should have [$fromLang, $toLang] pairs: %v", d)
+			continue
+		}
+		for _, id := range d {
+			if !ko.Exists("lang." + id) {
+				c.fail("app", "unknown language '%s' in dicts %v. Define it in a [lang.%s] block", id, d, id)
+			}
+		}
+	}
+
+	// Site theme and its templates.
+	checkTheme(ko, langs, &c)
+
+	// DB connectivity, the schema, and the Postgres tokenizers.
+	checkDB(ko, pgCfg, &c)
+
+	if c.errs > 0 {
+		fmt.Printf("\n%d error(s) found\n", c.errs)
+		return false
+	}
+
+	fmt.Println("\nconfig OK")
+	return true
+}
+
+// checkTheme loads the site theme (and the additional themes) and parses its
+// templates, if there's a theme.
+func checkTheme(ko *koanf.Koanf, langs data.LangMap, c *configChecker) {
+	site := ko.String("site")
+	if s := ko.String("storage.site"); site == "" && (s == storageEmbedded || s == storageS3) {
+		site = s
+	}
+	if site == "" {
+		c.ok("site", "no site theme (--site). Only the APIs will be available")
+		return
+	}
+
+	fs, err := loadSiteFS(initStorageOpt(ko), site, initFS())
+	if err != nil {
+		c.fail("site", "error loading site theme %s: %v", site, err)
+		return
+	}
+
+	pol, err := initSanitizer(ko, "sanitizer")
+	if err != nil {
+		c.fail("sanitizer", "%v", err)
+		return
+	}
+
+	theme, err := loadTheme("default", fs, ko.Bool("app.enable_pages"), pol, langs)
+	if err != nil {
+		c.fail("site", "error parsing site theme %s: %v", site, err)
+		return
+	}
+	c.ok("site", "loaded site theme %s", site)
+
+	if _, err := initThemes(theme, ko, &App{sanitizer: pol, data: &data.Data{Langs: langs}}); err != nil {
+		c.fail("themes", "%v", err)
+		return
+	}
+	if n := len(ko.MapKeys("themes")); n > 0 {
+		c.ok("themes", "loaded %d theme(s)", n)
+	}
+}
+
+// checkDB checks the DB connection, that the schema is installed and upgraded,
+// and that the text search configurations of Postgres tokenizers exist.
+func checkDB(ko *koanf.Koanf, pgCfg map[string]string, c *configChecker) {
+	db, err := connectDB(ko.String("db.host"), ko.Int("db.port"), ko.String("db.user"),
+		ko.String("db.password"), ko.String("db.db"))
+	if err != nil {
+		c.fail("db", "error connecting to the database: %v. Check host, port, user, password, and db", err)
+		return
+	}
+	defer db.Close()
+	c.ok("db", "connected to %s@%s:%d/%s", ko.String("db.user"), ko.String("db.host"), ko.Int("db.port"), ko.String("db.db"))
+
+	lastVer, toRun, err := getPendingMigrations(db)
+	if err != nil {
+		c.fail("db", "error checking the schema: %v", err)
+	} else if lastVer == "v0.0.0" {
+		c.fail("db", "schema not installed. Run --install")
+	} else if len(toRun) > 0 {
+		c.fail("db", "%d pending database upgrade(s) after %s. Back up the database and run --upgrade", len(toRun), lastVer)
+	} else {
+		c.ok("db", "schema is up to date (%s)", lastVer)
+	}
+
+	checkPGTokenizers(db, pgCfg, c)
+}
+
+// checkPGTokenizers checks that the text search configurations of the
+// languages with Postgres tokenizers exist in the DB.
+func checkPGTokenizers(db *sqlx.DB, pgCfg map[string]string, c *configChecker) {
+	if len(pgCfg) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(pgCfg))
+	for n := range pgCfg {
+		names = append(names, n)
+	}
+
+	var found []string
+	if err := db.Select(&found, `SELECT cfgname FROM pg_ts_config WHERE cfgname = ANY($1::TEXT[])`, pq.Array(names)); err != nil {
+		c.fail("db", "error checking Postgres tokenizers: %v", err)
+		return
+	}
+
+	has := make(map[string]bool, len(found))
+	for _, f := range found {
+		has[f] = true
+	}
+	for _, n := range names {
+		if !has[n] {
+			c.fail("lang."+pgCfg[n], "Postgres text search config '%s' doesn't exist in the DB. Create it or change the tokenizer", n)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/lib/pq"
+)
+
+// Postgres LISTEN/NOTIFY channel of the change events of instances.
+const clusterChannel = "dictpress"
+
+// Interval at which the listener connection is checked when there are no events.
+const clusterPingInterval = time.Second * 90
+
+// Types of cluster events. Entry events are sent by a trigger in the DB on all
+// entry changes, including the ones made outside the app (eg: imports).
+const (
+	clusterEntries     = "entries"
+	clusterUsers       = "users"
+	clusterAPIKeys     = "api_keys"
+	clusterMaintenance = "maintenance"
+	clusterCounts      = "counts"
+	clusterLangs       = "langs"
+)
+
+// clusterEvent is a change event sent to all instances.
+type clusterEvent struct {
+	Type string `json:"type"`
+	Lang string `json:"lang,omitempty"`
+
+	// ID of the instance that sent the event.
+	Instance string `json:"instance,omitempty"`
+}
+
+// clusterSync keeps the in-memory state of multiple instances (replicas) that
+// share the DB coherent by propagating changes over Postgres LISTEN/NOTIFY.
+type clusterSync struct {
+	id string
+
+	// Glossary initials of languages, which are only cached with cluster
+	// sync as refreshes of the counts they're read from are notified.
+	initials map[string][]string
+	mu       sync.Mutex
+}
+
+// initCluster initializes cluster sync and starts listening to change events.
+func initCluster(ko *koanf.Koanf, app *App) *clusterSync {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	c := &clusterSync{
+		id:       hex.EncodeToString(b),
+		initials: make(map[string][]string),
+	}
+
+	dsn := dbDSN(ko.MustString("db.host"), ko.MustInt("db.port"), ko.MustString("db.user"),
+		ko.MustString("db.password"), ko.MustString("db.db"))
+	l := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			app.lo.Printf("cluster sync listener: %v", err)
+		}
+	})
+	if err := l.Listen(clusterChannel); err != nil {
+		lo.Fatalf("error listening to cluster events: %v", err)
+	}
+
+	go c.listen(l, app)
+	return c
+}
+
+// listen applies the change events of instances. It's a blocking function
+// that should be run as a goroutine.
+func (c *clusterSync) listen(l *pq.Listener, app *App) {
+	for {
+		select {
+		case n := <-l.Notify:
+			// The connection was re-established and events may have been missed.
+			if n == nil {
+				c.reset(app)
+				continue
+			}
+
+			var ev clusterEvent
+			if err := json.Unmarshal([]byte(n.Extra), &ev); err != nil {
+				app.lo.Printf("error parsing cluster event: %v", err)
+				continue
+			}
+			c.apply(ev, app)
+
+		case <-time.After(clusterPingInterval):
+			go l.Ping()
+		}
+	}
+}
+
+// apply invalidates or reloads the state affected by an event.
+func (c *clusterSync) apply(ev clusterEvent, app *App) {
+	switch ev.Type {
+	case clusterEntries:
+		c.mu.Lock()
+		delete(c.initials, ev.Lang)
+		c.mu.Unlock()
+		app.views.resetPopular(ev.Lang)
+
+	case clusterCounts:
+		if ev.Instance != c.id {
+			app.resetInitials()
+		}
+
+	case clusterUsers:
+		if ev.Instance != c.id {
+			app.userCache.reset()
+		}
+
+	case clusterAPIKeys:
+		if ev.Instance != c.id && app.apiKeys != nil {
+			reloadAPIKeys(app)
+		}
+
+	case clusterMaintenance:
+		if ev.Instance != c.id {
+			if err := app.maintenance.load(app); err != nil {
+				app.lo.Printf("error loading maintenance mode state: %v", err)
+			}
+		}
+
+	// Languages are loaded on startup, so all instances restart to apply changes.
+	case clusterLangs:
+		if ev.Instance != c.id {
+			restartApp(app)
+		}
+	}
+}
+
+// reset invalidates all the state that's kept coherent.
+func (c *clusterSync) reset(app *App) {
+	app.resetInitials()
+	app.views.resetPopular("")
+	app.userCache.reset()
+	if app.apiKeys != nil {
+		reloadAPIKeys(app)
+	}
+	if err := app.maintenance.load(app); err != nil {
+		app.lo.Printf("error loading maintenance mode state: %v", err)
+	}
+}
+
+// notify sends a change event to the other instances.
+func (app *App) notify(typ string) {
+	if app.cluster == nil {
+		return
+	}
+
+	b, _ := json.Marshal(clusterEvent{Type: typ, Instance: app.cluster.id})
+	if _, err := app.queries.NotifyEvent.Exec(string(b)); err != nil {
+		app.lo.Printf("error sending cluster event: %v", err)
+	}
+}
+
+// resetInitials clears the cached glossary initials of all languages.
+func (app *App) resetInitials() {
+	c := app.cluster
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.initials = make(map[string][]string)
+	c.mu.Unlock()
+}
+
+// getInitials returns the glossary initials of a language, cached with cluster sync.
+func (app *App) getInitials(lang string) ([]string, error) {
+	c := app.cluster
+	if c == nil {
+		return app.data.GetInitials(lang)
+	}
+
+	c.mu.Lock()
+	out, ok := c.initials[lang]
+	c.mu.Unlock()
+	if ok {
+		return out, nil
+	}
+
+	out, err := app.data.GetInitials(lang)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.initials[lang] = out
+	c.mu.Unlock()
+
+	return out, nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import "time"
+
+// runCountsRefresher periodically refreshes the materialized entry and relation
+// counts that stats and glossaries are read from. It's a blocking function that
+// should be run as a goroutine.
+func runCountsRefresher(interval time.Duration, app *App) {
+	for {
+		if err := app.data.RefreshCounts(); err != nil {
+			app.lo.Printf("error refreshing counts: %v", err)
+		} else {
+			// Glossary initials cached by instances are read from the counts.
+			app.resetInitials()
+			app.notify(clusterCounts)
+		}
+
+		time.Sleep(interval)
+	}
+}
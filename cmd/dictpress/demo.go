@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/importer"
+	"github.com/knadh/stuffbin"
+)
+
+// Sample English-Italian dictionary (CSV) bundled in the binary for --demo.
+const demoDataFile = "/demo/english-italian.csv"
+
+// Directory of the default site theme next to the binary in the release archives.
+const demoSiteDir = "site"
+
+// loadDemo imports the bundled sample dictionary into a freshly installed DB
+// and picks the default site theme for --demo, so that the site and the admin
+// can be tried out with a single command.
+func loadDemo(langs data.LangMap, q *data.Queries, db *sqlx.DB, app *App) {
+	for _, l := range []string{"english", "italian"} {
+		if _, ok := langs[l]; !ok {
+			lo.Fatalf("--demo requires the '%s' language of the sample config. Generate one with --new-config", l)
+		}
+	}
+
+	b, err := app.fs.Read(demoDataFile)
+	if err != nil {
+		lo.Fatalf("error reading demo data: %v", err)
+	}
+
+	// The importer reads files from the disk.
+	f, err := os.CreateTemp("", "dictpress-demo-*.csv")
+	if err != nil {
+		lo.Fatalf("error creating demo data file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		lo.Fatalf("error writing demo data file: %v", err)
+	}
+	f.Close()
+
+	lo.Println("importing the demo dictionary")
+	imp := importer.New(langs, q.ImportStaged, db, false, lo)
+	if err := imp.Import(f.Name()); err != nil {
+		lo.Fatalf("error importing demo data: %v", err)
+	}
+
+	// Site theme: --site, or the one embedded in the binary, or the default
+	// theme next to the binary.
+	switch {
+	case app.consts.Site != "":
+	case hasEmbeddedSite(app.fs):
+		app.consts.Site = storageEmbedded
+		ko.Set("storage.site", storageEmbedded)
+	default:
+		if s, err := os.Stat(demoSiteDir); err == nil && s.IsDir() {
+			app.consts.Site = demoSiteDir
+			ko.Set("storage.site", storageLocal)
+		}
+	}
+	if app.consts.Site == "" {
+		lo.Println("no site theme found. Only the admin and the APIs will be available. Pass --site=path/to/site to load one")
+	}
+
+	lo.Printf("demo ready. Visit %s for the site and %s/admin for the admin (with admin_username and admin_password in the config)",
+		app.consts.RootURL, app.consts.RootURL)
+}
+
+// hasEmbeddedSite checks whether a site theme is embedded in the binary.
+func hasEmbeddedSite(fs stuffbin.FileSystem) bool {
+	for _, p := range fs.List() {
+		if strings.HasPrefix(p, embeddedSiteDir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+const dumpBatchSize = 1000
+
+// exportData writes all entries and their relations, or the ones that match
+// the filter, as JSON lines (one entry per line) to a file, or to stdout if
+// the path is -. Cancelling ctx stops the export.
+func exportData(ctx context.Context, fPath string, f data.ExportFilter, app *App, l *log.Logger) error {
+	var w io.Writer = os.Stdout
+	if fPath != "-" {
+		f, err := os.Create(fPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := writeData(ctx, w, f, app)
+	if err != nil {
+		return err
+	}
+
+	if fPath != "-" {
+		l.Printf("exported %d entries to %s", n, fPath)
+	}
+	return nil
+}
+
+// writeData streams the entries that match the filter and their relations as
+// JSON lines to w in batches fetched by ID and returns the number of entries written.
+func writeData(ctx context.Context, w io.Writer, f data.ExportFilter, app *App) (int, error) {
+	var (
+		s     = newJSONStream(w, true)
+		after = 0
+	)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return s.n, err
+		}
+
+		res, err := app.data.GetDumpEntries(after, dumpBatchSize, f)
+		if err != nil {
+			return s.n, fmt.Errorf("error fetching entries: %v", err)
+		}
+		if len(res) == 0 {
+			break
+		}
+
+		for _, e := range res {
+			if err := s.Write(e); err != nil {
+				return s.n, err
+			}
+		}
+
+		after = res[len(res)-1].ID
+		if err := s.Flush(); err != nil {
+			return s.n, err
+		}
+	}
+
+	return s.n, s.Close()
+}
+
+// handleExportData streams all entries and their relations, or a subset of
+// them (?from_lang, to_lang, tag, status, since), as a JSON lines download
+// that can be imported with --import-data.
+func handleExportData(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		q   = c.QueryParams()
+	)
+
+	var langs []string
+	if l := q.Get("from_lang"); l != "" {
+		langs = append(langs, l)
+		if l := q.Get("to_lang"); l != "" {
+			langs = append(langs, l)
+		}
+	}
+
+	f, err := makeExportFilter(langs, q["tag"], q.Get("status"), q.Get("since"), app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="dictpress-%s.ndjson"`, time.Now().Format("2006-01-02")))
+	c.Response().WriteHeader(http.StatusOK)
+
+	if _, err := writeData(c.Request().Context(), c.Response(), f, app); err != nil {
+		// Headers have already been sent.
+		app.lo.Printf("error streaming data export: %v", err)
+	}
+
+	return nil
+}
+
+// importData imports a JSON lines file written by exportData, inserting entries
+// and relations, or updating them if they exist (matched by GUIDs). Entries are
+// imported in the first pass, and relations and etymological links in the next
+// ones so that they can refer to entries anywhere in the file. Cancelling ctx
+// rolls back the pass in progress and stops the import. Dry runs import all
+// the passes in one transaction that's rolled back, as the later passes
+// refer to the entries of the first one.
+func importData(ctx context.Context, fPath string, dryRun bool, app *App, l *log.Logger) error {
+	var dryTx *sqlx.Tx
+	if dryRun {
+		tx, err := app.db.Beginx()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		dryTx = tx
+	}
+
+	numEntries, err := importDataPass(ctx, fPath, app.queries.UpsertDumpEntry, dryTx, app, func(stmt *sqlx.Stmt, e data.DumpEntry) (int, error) {
+		if len(e.Meta) == 0 {
+			e.Meta = json.RawMessage("{}")
+		}
+		if e.Tags == nil {
+			e.Tags = []string{}
+		}
+		if e.Phones == nil {
+			e.Phones = []string{}
+		}
+		if e.Status == "" {
+			e.Status = data.StatusEnabled
+		}
+
+		_, err := stmt.Exec(e.GUID, e.Content, e.Initial, e.Weight, e.Tokens, e.Lang, e.Tags, e.Phones,
+			e.Notes, string(e.Meta), e.Status, e.CreatedAt, e.UpdatedAt, e.Slug, e.Etymology,
+			app.data.Langs[e.Lang].Normalized(e.Content), e.ShortID, e.Source, e.License, e.Attribution, e.PublishAt)
+		return 1, err
+	})
+	if err != nil {
+		return err
+	}
+
+	l.Printf("imported %d entries. importing relations", numEntries)
+
+	numRels, err := importDataPass(ctx, fPath, app.queries.UpsertDumpRelation, dryTx, app, func(stmt *sqlx.Stmt, e data.DumpEntry) (int, error) {
+		for _, r := range e.Relations {
+			if r.Types == nil {
+				r.Types = []string{}
+			}
+			if r.Tags == nil {
+				r.Tags = []string{}
+			}
+			if r.Status == "" {
+				r.Status = data.StatusEnabled
+			}
+			if r.Domains == nil {
+				r.Domains = []string{}
+			}
+			if r.Examples == nil {
+				r.Examples = []data.DumpExample{}
+			}
+			ex, err := json.Marshal(r.Examples)
+			if err != nil {
+				return 0, err
+			}
+
+			if _, err := stmt.Exec(e.GUID, r.ToGUID, r.Types, r.Tags, r.Notes, r.Weight, r.Status,
+				r.Gender, r.Register, r.Domains, string(ex)); err != nil {
+				return 0, err
+			}
+		}
+		return len(e.Relations), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := importDataPass(ctx, fPath, app.queries.UpsertDumpEtymology, dryTx, app, func(stmt *sqlx.Stmt, e data.DumpEntry) (int, error) {
+		if len(e.EtymologyLinks) == 0 {
+			e.EtymologyLinks = json.RawMessage("[]")
+		}
+
+		_, err := stmt.Exec(e.GUID, string(e.EtymologyLinks))
+		return 1, err
+	}); err != nil {
+		return err
+	}
+
+	if dryRun {
+		l.Printf("dry run. %d entries and %d relations from %s would be imported. nothing was saved", numEntries, numRels, fPath)
+		return nil
+	}
+
+	l.Printf("imported %d entries and %d relations from %s", numEntries, numRels, fPath)
+	return nil
+}
+
+// importDataPass reads every line in a JSON lines export and runs fn on it
+// with the given statement in a transaction. If a dry run transaction is given,
+// it's used and left uncommitted.
+func importDataPass(ctx context.Context, fPath string, stmt *sqlx.Stmt, dryTx *sqlx.Tx, app *App, fn func(*sqlx.Stmt, data.DumpEntry) (int, error)) (int, error) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	tx := dryTx
+	if tx == nil {
+		if tx, err = app.db.Beginx(); err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+	}
+
+	var (
+		txStmt = tx.Stmtx(stmt)
+		sc     = bufio.NewScanner(f)
+		line   = 0
+		num    = 0
+	)
+	sc.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	for sc.Scan() {
+		line++
+		if line%dumpBatchSize == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var e data.DumpEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return 0, fmt.Errorf("error reading line %d: %v", line, err)
+		}
+
+		if e.GUID == "" {
+			return 0, fmt.Errorf("line %d: entry has no guid", line)
+		}
+
+		n, err := fn(txStmt, e)
+		if err != nil {
+			return 0, fmt.Errorf("error importing line %d: %v", line, err)
+		}
+		num += n
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+
+	if dryTx != nil {
+		return num, nil
+	}
+
+	return num, tx.Commit()
+}
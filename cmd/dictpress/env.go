@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/v2"
+)
+
+// Prefix of the environment variables that override config keys. The rest of
+// the name is the key with __ as the delimiter, eg: DICTPRESS_DB__PASSWORD
+// => db.password, DICTPRESS_LANG__ENGLISH__TOKENIZER => lang.english.tokenizer.
+const envPrefix = "DICTPRESS_"
+
+// Suffix of the environment variables whose values are read from files (eg:
+// Docker and Kubernetes secrets), eg: DICTPRESS_DB__PASSWORD_FILE=/run/secrets/db.
+const envFileSuffix = "_file"
+
+// envVars returns the config keys and values in the environment variables.
+func envVars() map[string]string {
+	out := make(map[string]string)
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, envPrefix) {
+			continue
+		}
+
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(kv[0], envPrefix), "__", "."))
+		if key != "" {
+			out[key] = kv[1]
+		}
+	}
+
+	return out
+}
+
+// loadEnv overrides the config with the environment variables. Values of keys
+// that are strings in the config are used as is, and others (numbers, bools,
+// lists, durations) are parsed as TOML values, eg: DICTPRESS_APP__DICTS='[["english", "italian"]]'.
+func loadEnv(vars map[string]string, ko *koanf.Koanf) error {
+	for key, val := range vars {
+		// Secrets file. Keys that end with _file (eg: lang.*.stopwords_file)
+		// are only read as files if the key without the suffix is in the config.
+		if k := strings.TrimSuffix(key, envFileSuffix); k != key && ko.Exists(k) {
+			b, err := os.ReadFile(val)
+			if err != nil {
+				return fmt.Errorf("error reading %s%s file: %v", envPrefix, strings.ToUpper(strings.ReplaceAll(key, ".", "__")), err)
+			}
+			key, val = k, strings.TrimRight(string(b), "\r\n")
+		}
+
+		if err := ko.Set(key, envValue(key, val, ko)); err != nil {
+			return fmt.Errorf("error setting %s from the environment: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// envValue returns the typed value of an environment variable for a config key.
+func envValue(key, val string, ko *koanf.Koanf) interface{} {
+	if _, ok := ko.Get(key).(string); ok {
+		return val
+	}
+
+	m, err := toml.Parser().Unmarshal([]byte("v = " + val))
+	if err != nil {
+		return val
+	}
+	return m["v"]
+}
+
+// bytesProvider is a koanf provider of raw config bytes, eg: the sample config.
+type bytesProvider []byte
+
+func (b bytesProvider) ReadBytes() ([]byte, error) {
+	return b, nil
+}
+
+func (b bytesProvider) Read() (map[string]interface{}, error) {
+	return nil, errors.New("bytesProvider does not support Read()")
+}
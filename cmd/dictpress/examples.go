@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+// exampleResults represents a page of usage example search results.
+type exampleResults struct {
+	Examples   []data.Example `json:"examples"`
+	Page       int            `json:"page"`
+	PerPage    int            `json:"per_page"`
+	TotalPages int            `json:"total_pages"`
+	Total      int            `json:"total"`
+}
+
+func (e *exampleResults) pageMeta() *apiMeta {
+	return &apiMeta{Page: e.Page, PerPage: e.PerPage, TotalPages: e.TotalPages, Total: e.Total}
+}
+
+// handleSearchExamples searches the usage examples in a language that contain
+// the ?q query, optionally only those of definitions in the ?to language.
+func handleSearchExamples(c echo.Context) error {
+	var (
+		app    = c.Get("app").(*App)
+		lang   = c.Param("lang")
+		toLang = c.QueryParam("to")
+		q      = strings.TrimSpace(c.QueryParam("q"))
+		pg     = app.resultsPg.NewFromURL(c.Request().URL.Query())
+	)
+
+	if _, ok := app.data.Langs[lang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown language")
+	}
+	if _, ok := app.data.Langs[toLang]; toLang != "" && !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `to` language")
+	}
+	if q == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `q`")
+	}
+
+	res, total, err := app.data.SearchExamples(lang, toLang, q, pg.Offset, pg.Limit)
+	if err != nil {
+		app.lo.Printf("error searching examples: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error searching examples")
+	}
+
+	// Internal IDs are not exposed publicly.
+	for i := range res {
+		res[i].ID = 0
+		res[i].RelationID = 0
+	}
+
+	pg.SetTotal(total)
+	return c.JSON(http.StatusOK, okResp{&exampleResults{
+		Examples:   res,
+		Page:       pg.Page,
+		PerPage:    pg.PerPage,
+		TotalPages: pg.TotalPages,
+		Total:      total,
+	}})
+}
+
+// handleGetExamples returns the usage examples of a relation.
+func handleGetExamples(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		relID, _ = strconv.Atoi(c.Param("relID"))
+	)
+
+	if relID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	out, err := app.data.GetExamples([]int{relID})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching examples: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleInsertExample adds a usage example to a relation of an entry. The
+// example's language defaults to that of the entry.
+func handleInsertExample(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		id, _    = strconv.Atoi(c.Param("id"))
+		relID, _ = strconv.Atoi(c.Param("relID"))
+	)
+
+	if id < 1 || relID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	var x data.Example
+	if err := c.Bind(&x); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	if x.Lang == "" {
+		e, err := app.data.GetEntry(id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return echo.NewHTTPError(http.StatusNotFound, "entry not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		x.Lang = e.Lang
+	}
+	if err := validateExample(&x, app); err != nil {
+		return err
+	}
+
+	out, err := app.data.InsertExample(id, relID, x)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "relation not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error inserting example: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateExample updates a usage example of a relation.
+func handleUpdateExample(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		relID, _ = strconv.Atoi(c.Param("relID"))
+		id, _    = strconv.Atoi(c.Param("exampleID"))
+	)
+
+	if id < 1 || relID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	var x data.Example
+	if err := c.Bind(&x); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+	if err := validateExample(&x, app); err != nil {
+		return err
+	}
+
+	out, err := app.data.UpdateExample(id, relID, x)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "example not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error updating example: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteExample deletes a usage example of a relation.
+func handleDeleteExample(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		relID, _ = strconv.Atoi(c.Param("relID"))
+		id, _    = strconv.Atoi(c.Param("exampleID"))
+	)
+
+	if id < 1 || relID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	if err := app.data.DeleteExample(id, relID); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "example not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error deleting example: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+func validateExample(x *data.Example, app *App) error {
+	x.Content = strings.TrimSpace(x.Content)
+	x.Translation = strings.TrimSpace(x.Translation)
+
+	var v validator
+	if v.required("content", x.Content) {
+		v.maxLen("content", x.Content, maxContentLen)
+	}
+	v.maxLen("translation", x.Translation, maxContentLen)
+	v.lang("lang", x.Lang, app.data.Langs)
+
+	return v.err()
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/knadh/dictpress/internal/data"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// glossaryBatchSize is the number of glossary words fetched from the DB at
+// a time when iterating through all the words of a language.
+const glossaryBatchSize = 1000
+
+// exportSite renders every headword's search results page, glossary pages, and
+// static pages through the site theme into a static HTML tree in outDir, along
+// with the theme's static files and a JSON search index per dictionary pair.
+//
+// Pages are written as $path.html (eg: /dictionary/english/italian/apple.html)
+// that static hosts such as GitHub Pages and Netlify serve on $path.
+//
+// The filter optionally limits the export to a dictionary pair and to the
+// headwords with the given tags, which the glossaries and the search index
+// also only list. With UpdatedSince, only the search results pages that have
+// entries or definitions updated since are written, for updating an export.
+func exportSite(app *App, outDir string, f data.ExportFilter) error {
+	if app.siteTpl == nil {
+		return fmt.Errorf("a site theme (--site) is required to export the site")
+	}
+	if f.Status != "" && f.Status != data.StatusEnabled {
+		return fmt.Errorf("the site only has enabled entries and can't be exported with the status '%s'", f.Status)
+	}
+
+	// Homepage.
+	if err := exportPage(app, outDir, "/index.html", "index", pageTpl{PageType: pageIndex}); err != nil {
+		return err
+	}
+
+	// Static pages.
+	for id := range app.sitePageTpls {
+		b := bytes.Buffer{}
+		if err := app.sitePageTpls[id].ExecuteTemplate(&b, "page-"+id, app.newTplData("/p/"+id, pageTpl{
+			PageType: pageStatic,
+			PageID:   id,
+		})); err != nil {
+			return fmt.Errorf("error rendering page %s: %v", id, err)
+		}
+
+		if err := writeExportFile(outDir, "/p/"+id+".html", b.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	// Dictionary pairs.
+	for _, d := range app.data.Dicts {
+		if (f.FromLang != "" && d[0].ID != f.FromLang) || (f.ToLang != "" && d[1].ID != f.ToLang) {
+			continue
+		}
+
+		if err := exportDict(app, outDir, d[0].ID, d[1].ID, f); err != nil {
+			return err
+		}
+	}
+
+	// Theme's static files.
+	if err := copyStatic(app, outDir); err != nil {
+		return fmt.Errorf("error copying static files: %v", err)
+	}
+
+	app.lo.Printf("exported site to %s", outDir)
+	return nil
+}
+
+// exportDict exports the search results pages of all the headwords of a dictionary
+// pair that match the filter, the glossary pages, and the JSON search index of
+// the headwords.
+func exportDict(app *App, outDir, fromLang, toLang string, f data.ExportFilter) error {
+	initials, err := app.data.GetInitials(fromLang)
+	if err != nil {
+		return fmt.Errorf("error fetching initials for %s: %v", fromLang, err)
+	}
+
+	var (
+		n = 0
+
+		// Headwords that are exported with the tags filter, which are the
+		// only ones listed in the glossaries and the search index.
+		words = map[string]bool{}
+	)
+	for _, initial := range initials {
+		// Page through all the words of the initial.
+		for page := 1; ; page++ {
+			pg := app.resultsPg.NewFromURL(url.Values{})
+			if app.glossaryPg != nil {
+				pg = app.glossaryPg.NewFromURL(url.Values{"page": {strconv.Itoa(page)}})
+			} else {
+				pg.Page = page
+				pg.Limit = glossaryBatchSize
+				pg.Offset = (page - 1) * glossaryBatchSize
+			}
+
+			gloss, err := getGlossaryWords(fromLang, initial, pg, app)
+			if err != nil {
+				return err
+			}
+			if len(gloss.Words) == 0 {
+				break
+			}
+
+			// Search results page of every word.
+			all := gloss.Words
+			gloss.Words = gloss.Words[:0:0]
+			for _, w := range all {
+				p, ok := exportWordPath(fromLang, toLang, w.Content)
+				if !ok {
+					app.lo.Printf("skipping word with unsupported characters: %s", w.Content)
+					continue
+				}
+
+				query, res, err := searchEntries(data.Query{
+					FromLang: fromLang,
+					ToLang:   toLang,
+					Query:    w.Content,
+					Tags:     f.Tags,
+					Status:   data.StatusEnabled,
+					Limit:    app.resultsPg.NewFromURL(url.Values{}).Limit,
+				}, app.resultsPg.NewFromURL(url.Values{}), false, app)
+				if err != nil {
+					return fmt.Errorf("error searching '%s': %v", w.Content, err)
+				}
+
+				if len(f.Tags) > 0 {
+					if len(res.Entries) == 0 {
+						continue
+					}
+					words[w.Content] = true
+				}
+				gloss.Words = append(gloss.Words, w)
+
+				if f.UpdatedSince.Valid && !updatedSince(res.Entries, f.UpdatedSince.Time) {
+					continue
+				}
+
+				if err := exportPage(app, outDir, p+".html", "search", pageTpl{
+					PageType: pageSearch,
+					Results:  res,
+					Query:    &query,
+					JSONLD:   makeSearchJSONLD(res, app),
+				}); err != nil {
+					return err
+				}
+
+				n++
+			}
+
+			// Glossary page.
+			if app.consts.EnableGlossary {
+				if err := exportGlossaryPage(app, outDir, fromLang, toLang, initial, initials, gloss); err != nil {
+					return err
+				}
+			}
+
+			if page >= gloss.TotalPages {
+				break
+			}
+		}
+	}
+
+	// JSON search index of all the headwords for client side search.
+	var keep func(data.IndexWord) bool
+	if len(f.Tags) > 0 {
+		keep = func(w data.IndexWord) bool {
+			return words[w.Content]
+		}
+	}
+
+	b := bytes.Buffer{}
+	if _, err := writeIndex(&b, fromLang, toLang, false, keep, app); err != nil {
+		return err
+	}
+	if err := writeExportFile(outDir, fmt.Sprintf("/index/%s-%s.json", fromLang, toLang), b.Bytes()); err != nil {
+		return err
+	}
+
+	app.lo.Printf("exported %d words for %s-%s", n, fromLang, toLang)
+	return nil
+}
+
+// updatedSince checks whether any of the entries or their definitions have
+// been updated since the given time.
+func updatedSince(entries []data.Entry, t time.Time) bool {
+	for _, e := range entries {
+		if e.UpdatedAt.Valid && !e.UpdatedAt.Time.Before(t) {
+			return true
+		}
+
+		for _, r := range e.Relations {
+			if r.UpdatedAt.Valid && !r.UpdatedAt.Time.Before(t) {
+				return true
+			}
+			if r.Relation != nil && r.Relation.UpdatedAt.Valid && !r.Relation.UpdatedAt.Time.Before(t) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// makeExportFilter validates and returns the filter for exporting a subset of
+// the entries. langs are the optional headword and definition languages, and
+// since is a date (2006-01-02) or a timestamp (RFC3339).
+func makeExportFilter(langs, tags []string, status, since string, app *App) (data.ExportFilter, error) {
+	var f data.ExportFilter
+
+	if len(langs) > 2 {
+		return f, fmt.Errorf("the export languages should be the headword and optionally the definition languages")
+	}
+	for i, l := range langs {
+		if _, ok := app.data.Langs[l]; !ok {
+			return f, fmt.Errorf("unknown language '%s'", l)
+		}
+		if i == 0 {
+			f.FromLang = l
+		} else {
+			f.ToLang = l
+		}
+	}
+
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t != "" {
+			f.Tags = append(f.Tags, t)
+		}
+	}
+
+	switch status {
+	case "", data.StatusEnabled, data.StatusDisabled, data.StatusPending:
+		f.Status = status
+	default:
+		return f, fmt.Errorf("unknown status '%s'", status)
+	}
+
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", since); err != nil {
+				return f, fmt.Errorf("invalid since time '%s'. It should be a date (2006-01-02) or an RFC3339 timestamp", since)
+			}
+		}
+		f.UpdatedSince = null.TimeFrom(t)
+	}
+
+	return f, nil
+}
+
+// exportGlossaryPage exports a page of the glossary of an initial to
+// /glossary/$from/$to/$initial/$page.html. The first page is also written to
+// .../$initial.html which the glossary links on other pages point to.
+func exportGlossaryPage(app *App, outDir, fromLang, toLang, initial string, initials []string, gloss *glossary) error {
+	gloss.FromLang = fromLang
+	gloss.ToLang = toLang
+
+	var (
+		base = fmt.Sprintf("/glossary/%s/%s/%s", fromLang, toLang, initial)
+		pg   = app.glossaryPg.NewFromURL(url.Values{"page": {strconv.Itoa(gloss.Page)}})
+	)
+	pg.SetTotal(gloss.Total)
+
+	p := pageTpl{
+		PageType: pageGlossary,
+		Initial:  initial,
+		Initials: initials,
+		Glossary: gloss,
+		Pg:       &pg,
+		PgBar:    template.HTML(pg.HTML(app.consts.RootURL + base + "/%d")),
+		JSONLD:   makeGlossaryJSONLD(gloss, app),
+	}
+	if gloss.Page == 1 {
+		if err := exportPage(app, outDir, base+".html", "glossary", p); err != nil {
+			return err
+		}
+	}
+
+	return exportPage(app, outDir, fmt.Sprintf("%s/%d.html", base, gloss.Page), "glossary", p)
+}
+
+// exportPage renders a site template and writes it to outDir/fPath.
+func exportPage(app *App, outDir, fPath, tpl string, p pageTpl) error {
+	b := bytes.Buffer{}
+	if err := app.siteTpl.ExecuteTemplate(&b, tpl, app.newTplData(strings.TrimSuffix(fPath, ".html"), p)); err != nil {
+		return fmt.Errorf("error rendering %s: %v", fPath, err)
+	}
+
+	return writeExportFile(outDir, fPath, b.Bytes())
+}
+
+// exportWordPath returns the file path of a word's search results page, which
+// is the URL path generated by the UnicodeURL template function (escapeWordURL)
+// as decoded by static web servers. Words that can't be represented as file
+// names are not exportable.
+func exportWordPath(fromLang, toLang, word string) (string, bool) {
+	if word == "." || word == ".." || strings.ContainsAny(word, `/\`) ||
+		strings.IndexFunc(word, unicode.IsControl) >= 0 {
+		return "", false
+	}
+
+	p, err := url.PathUnescape(escapeWordURL(word))
+	if err != nil {
+		return "", false
+	}
+
+	return fmt.Sprintf("/dictionary/%s/%s/%s", fromLang, toLang, p), true
+}
+
+// writeExportFile writes b to outDir/fPath creating all the parent directories.
+func writeExportFile(outDir, fPath string, b []byte) error {
+	fPath = filepath.Join(outDir, filepath.FromSlash(fPath))
+	if err := os.MkdirAll(filepath.Dir(fPath), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(fPath, b, 0644)
+}
+
+// copyStatic copies the theme's static files to outDir/static, along with
+// their fingerprinted copies that pages link to.
+func copyStatic(app *App, outDir string) error {
+	for p, fp := range app.themes.def.assets {
+		b, err := app.siteFS.Read(p)
+		if err != nil {
+			return err
+		}
+
+		if err := writeExportFile(outDir, p, b); err != nil {
+			return err
+		}
+		if err := writeExportFile(outDir, fp, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
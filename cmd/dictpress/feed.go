@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+// feedOpt represents the feed options.
+type feedOpt struct {
+	Enabled    bool   `koanf:"enabled"`
+	Title      string `koanf:"title"`
+	NumEntries int    `koanf:"num_entries"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel struct {
+		Title       string    `xml:"title"`
+		Link        string    `xml:"link"`
+		Description string    `xml:"description"`
+		Items       []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	GUID        struct {
+		Value       string `xml:",chardata"`
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+	} `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+	Summary string   `xml:"summary"`
+}
+
+// handleFeed serves an RSS (or Atom with ?format=atom) feed of the latest
+// published headwords with their first definitions. ?from and ?to
+// optionally filter the headword and definition languages.
+func handleFeed(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		fromLang = c.QueryParam("from")
+		toLang   = c.QueryParam("to")
+	)
+
+	for _, l := range []string{fromLang, toLang} {
+		if _, ok := app.data.Langs[l]; l != "" && !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown language")
+		}
+	}
+
+	res, err := app.data.GetRecentEntries(fromLang, toLang, app.consts.Feed.NumEntries)
+	if err != nil {
+		app.lo.Printf("error fetching recent entries: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching entries")
+	}
+
+	title := app.consts.Feed.Title
+	if fromLang != "" {
+		title += " - " + app.data.Langs[fromLang].Name
+	}
+	if toLang != "" {
+		title += " - " + app.data.Langs[toLang].Name
+	}
+
+	if c.QueryParam("format") == "atom" {
+		out := atomFeed{
+			Title:   title,
+			ID:      app.consts.RootURL + c.Request().URL.RequestURI(),
+			Link:    atomLink{Href: app.consts.RootURL},
+			Updated: time.Now().UTC().Format(time.RFC3339),
+		}
+		if len(res) > 0 {
+			out.Updated = res[0].CreatedAt.UTC().Format(time.RFC3339)
+		}
+
+		for _, e := range res {
+			out.Entries = append(out.Entries, atomEntry{
+				Title:   e.Content,
+				ID:      "urn:uuid:" + e.GUID,
+				Link:    atomLink{Href: feedEntryURL(e, toLang, app)},
+				Updated: e.CreatedAt.UTC().Format(time.RFC3339),
+				Summary: e.Gloss,
+			})
+		}
+
+		return feedXML(c, "application/atom+xml", out)
+	}
+
+	out := rssFeed{Version: "2.0"}
+	out.Channel.Title = title
+	out.Channel.Link = app.consts.RootURL
+	out.Channel.Description = title
+	for _, e := range res {
+		i := rssItem{
+			Title:       e.Content,
+			Link:        feedEntryURL(e, toLang, app),
+			Description: e.Gloss,
+			PubDate:     e.CreatedAt.UTC().Format(time.RFC1123Z),
+		}
+		i.GUID.Value = e.GUID
+		out.Channel.Items = append(out.Channel.Items, i)
+	}
+
+	return feedXML(c, "application/rss+xml", out)
+}
+
+// feedXML writes a feed as an XML response.
+func feedXML(c echo.Context, contentType string, v interface{}) error {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error generating feed: %v", err))
+	}
+
+	return c.Blob(http.StatusOK, contentType+"; charset=utf-8", append([]byte(xml.Header), b...))
+}
+
+// feedEntryURL returns the permalink of a feed entry, or its search page URL
+// if it doesn't have a slug.
+func feedEntryURL(e data.FeedEntry, toLang string, app *App) string {
+	if e.Slug != "" {
+		return fmt.Sprintf("%s/word/%s/%s", app.consts.RootURL, e.Lang, url.PathEscape(e.Slug))
+	}
+
+	return ldSearchURL(e.Content, e.Lang, toLang, app)
+}
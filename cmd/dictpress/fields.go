@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+)
+
+// Maximum depth of nested relations that can be expanded with ?expand=relations(n).
+const maxRelationDepth = 3
+
+var reExpand = regexp.MustCompile(`^relations(?:\((\d+)\))?$`)
+
+// Entry fields that can be selected with ?fields=. gloss is a virtual field
+// with the content of an entry's first definition.
+var entryFields = map[string]bool{
+	"id": true, "guid": true, "weight": true, "initial": true, "lang": true,
+	"content": true, "tokens": true, "tags": true, "phones": true, "notes": true,
+	"slug": true, "meta": true, "status": true, "relations": true, "relation": true,
+	"created_at": true, "updated_at": true, "gloss": true, "media": true,
+	"highlight": true, "content_html": true, "notes_html": true,
+}
+
+// fieldResults represents search results with only the selected entry fields.
+// Its entries and groups shadow the embedded results' fields in the JSON.
+type fieldResults struct {
+	*results
+
+	Entries []map[string]interface{} `json:"entries"`
+	Groups  []fieldGroup             `json:"groups,omitempty"`
+}
+
+type fieldGroup struct {
+	Lang    string                   `json:"lang"`
+	Entries []map[string]interface{} `json:"entries"`
+}
+
+// parseExpand parses the ?expand=relations(n) param into the relation depth.
+func parseExpand(s string) (int, error) {
+	if s == "" {
+		return 1, nil
+	}
+
+	m := reExpand.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid `expand`. Should be relations(depth)")
+	}
+	if m[1] == "" {
+		return 1, nil
+	}
+
+	n, _ := strconv.Atoi(m[1])
+	if n < 1 || n > maxRelationDepth {
+		return 0, fmt.Errorf("relation depth should be between 1 and %d", maxRelationDepth)
+	}
+
+	return n, nil
+}
+
+// parseFields parses the comma separated list of ?fields=.
+func parseFields(s string) (map[string]bool, error) {
+	out := map[string]bool{}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !entryFields[f] {
+			return nil, fmt.Errorf("unknown field `%s`", f)
+		}
+		out[f] = true
+	}
+
+	return out, nil
+}
+
+// selectResultFields returns search results with only the selected fields of
+// entries and their relations.
+func selectResultFields(out *results, fields map[string]bool) (*fieldResults, error) {
+	ents, err := selectFields(out.Entries, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &fieldResults{results: out, Entries: ents}
+	for _, g := range out.Groups {
+		ents, err := selectFields(g.Entries, fields)
+		if err != nil {
+			return nil, err
+		}
+		res.Groups = append(res.Groups, fieldGroup{Lang: g.Lang, Entries: ents})
+	}
+
+	return res, nil
+}
+
+// selectFields converts entries into maps with only the selected fields. The
+// same fields are selected in nested relations.
+func selectFields(entries []data.Entry, fields map[string]bool) ([]map[string]interface{}, error) {
+	out := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+
+		var all map[string]interface{}
+		if err := json.Unmarshal(b, &all); err != nil {
+			return nil, err
+		}
+
+		m := make(map[string]interface{}, len(fields))
+		for f := range fields {
+			switch f {
+			case "gloss":
+				m[f] = ""
+				if len(e.Relations) > 0 {
+					m[f] = e.Relations[0].Content
+				}
+			case "relations":
+				rels, err := selectFields(e.Relations, fields)
+				if err != nil {
+					return nil, err
+				}
+				m[f] = rels
+			default:
+				if v, ok := all[f]; ok {
+					m[f] = v
+				}
+			}
+		}
+		out = append(out, m)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Number of words whose ranks are updated in one batch by frequency list imports.
+const frequencyBatchSize = 5000
+
+// importFrequency imports the word frequency list of a language and sets
+// the frequency ranks of the language's headwords, replacing their existing
+// ranks. The list has a word on every line, most frequent first, optionally
+// followed by its count (eg: "the 2305"), which is ignored. Empty lines
+// and lines starting with # are skipped. Words are matched with headwords
+// case insensitively. It returns the number of headwords ranked.
+func importFrequency(ctx context.Context, fPath, lang string, dryRun bool, app *App, l *log.Logger) (int, error) {
+	if _, ok := app.data.Langs[lang]; !ok {
+		return 0, fmt.Errorf("unknown language '%s'", lang)
+	}
+
+	f, err := os.Open(fPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	tx, err := app.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Stmtx(app.queries.ResetFreqRanks).Exec(lang); err != nil {
+		return 0, fmt.Errorf("error resetting frequency ranks: %v", err)
+	}
+
+	var (
+		stmt  = tx.Stmtx(app.queries.UpdateFreqRanks)
+		seen  = make(map[string]bool)
+		words = make([]string, 0, frequencyBatchSize)
+		ranks = make([]int64, 0, frequencyBatchSize)
+		total = 0
+	)
+	flush := func() error {
+		if len(words) == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		res, err := stmt.Exec(lang, pq.StringArray(words), pq.Int64Array(ranks))
+		if err != nil {
+			return fmt.Errorf("error updating frequency ranks: %v", err)
+		}
+		n, _ := res.RowsAffected()
+		total += int(n)
+
+		words, ranks = words[:0], ranks[:0]
+		return nil
+	}
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		w := frequencyWord(sc.Text())
+		if w == "" || seen[w] {
+			continue
+		}
+		seen[w] = true
+
+		words = append(words, w)
+		ranks = append(ranks, int64(len(seen)))
+		if len(words) == frequencyBatchSize {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+
+	l.Printf("%d words in the frequency list matched %d %s headwords", len(seen), total, lang)
+	if dryRun {
+		return total, nil
+	}
+
+	return total, tx.Commit()
+}
+
+// frequencyWord returns the lowercased word on a line of a frequency list
+// without its optional count, or an empty string for empty and comment lines.
+func frequencyWord(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+
+	// word<tab>count or word count.
+	if w, _, ok := strings.Cut(line, "\t"); ok {
+		line = w
+	} else if i := strings.LastIndexAny(line, " ,"); i > 0 {
+		if _, err := strconv.ParseInt(line[i+1:], 10, 64); err == nil {
+			line = line[:i]
+		}
+	}
+
+	return strings.ToLower(strings.TrimSpace(line))
+}
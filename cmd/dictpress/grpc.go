@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net"
+
+	"github.com/knadh/dictpress/internal/data"
+	pb "github.com/knadh/dictpress/internal/grpc/dictpresspb"
+	"github.com/knadh/koanf/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// Number of headwords fetched from the DB at a time for streaming exports.
+const grpcExportBatchSize = 500
+
+// grpcServer implements the read-only public gRPC API that mirrors the public
+// REST APIs.
+type grpcServer struct {
+	pb.UnimplementedDictpressServer
+
+	app *App
+}
+
+// initGRPCServer starts the gRPC server in the background on the configured address.
+func initGRPCServer(app *App, ko *koanf.Koanf) {
+	addr := ko.MustString("grpc.address")
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		lo.Fatalf("error starting gRPC server: %v", err)
+	}
+
+	srv := grpc.NewServer()
+	pb.RegisterDictpressServer(srv, &grpcServer{app: app})
+
+	lo.Printf("starting gRPC server on %s", addr)
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			lo.Fatalf("error starting gRPC server: %v", err)
+		}
+	}()
+}
+
+// Search searches a dictionary for a query.
+func (s *grpcServer) Search(ctx context.Context, r *pb.SearchRequest) (*pb.SearchResponse, error) {
+	app := s.app
+
+	if _, ok := app.data.Langs[r.GetFromLang()]; !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown `from` language")
+	}
+	if _, ok := app.data.Langs[r.GetToLang()]; !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown `to` language")
+	}
+
+	pg := app.resultsPg.New(int(r.GetPage()), int(r.GetPerPage()))
+	query := data.Query{
+		FromLang: r.GetFromLang(),
+		ToLang:   r.GetToLang(),
+		Types:    r.GetTypes(),
+		Tags:     r.GetTags(),
+		Query:    r.GetQuery(),
+		Match:    app.data.Langs[r.GetFromLang()].Match,
+		Status:   data.StatusEnabled,
+		Offset:   pg.Offset,
+		Limit:    pg.Limit,
+	}
+	if query.Query == "" {
+		return nil, status.Error(codes.InvalidArgument, "no query given")
+	}
+	if err := validateSearchQuery(query, app.data.Langs); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	_, res, err := searchEntries(query, pg, false, app)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	out := &pb.SearchResponse{
+		Entries:    make([]*pb.Entry, 0, len(res.Entries)),
+		Correction: res.Query.Correction,
+		Page:       int32(res.Page),
+		PerPage:    int32(res.PerPage),
+		TotalPages: int32(res.TotalPages),
+		Total:      int32(res.Total),
+	}
+	for _, e := range res.Entries {
+		out.Entries = append(out.Entries, grpcEntry(e))
+	}
+
+	return out, nil
+}
+
+// GetEntry returns a public entry with its definitions by its GUID.
+func (s *grpcServer) GetEntry(ctx context.Context, r *pb.GetEntryRequest) (*pb.Entry, error) {
+	app := s.app
+
+	if !isEntryID(r.GetGuid()) {
+		return nil, status.Error(codes.InvalidArgument, "invalid `guid`")
+	}
+
+	e, err := app.data.GetEntryByGUID(r.GetGuid())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Error(codes.NotFound, "entry not found")
+		}
+
+		app.lo.Printf("error fetching entry: %v", err)
+		return nil, status.Error(codes.Internal, "error fetching entry")
+	}
+
+	entries := []data.Entry{e}
+	if err := app.data.SearchAndLoadRelations(entries, data.Query{Status: data.StatusEnabled}); err != nil {
+		app.lo.Printf("error loading relations: %v", err)
+		return nil, status.Error(codes.Internal, "error loading relations")
+	}
+
+	return grpcEntry(entries[0]), nil
+}
+
+// ListGlossary lists the headwords in a language starting with an initial.
+func (s *grpcServer) ListGlossary(ctx context.Context, r *pb.ListGlossaryRequest) (*pb.ListGlossaryResponse, error) {
+	app := s.app
+
+	if !app.consts.EnableGlossary {
+		return nil, status.Error(codes.Unavailable, "glossary is disabled")
+	}
+	if _, ok := app.data.Langs[r.GetFromLang()]; !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown `from` language")
+	}
+	if r.GetInitial() == "" {
+		return nil, status.Error(codes.InvalidArgument, "no initial given")
+	}
+
+	pg := app.glossaryPg.New(int(r.GetPage()), int(r.GetPerPage()))
+	gloss, err := getGlossaryWords(r.GetFromLang(), r.GetInitial(), pg, app)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	out := &pb.ListGlossaryResponse{
+		Words:      make([]*pb.GlossaryWord, 0, len(gloss.Words)),
+		Page:       int32(gloss.Page),
+		PerPage:    int32(gloss.PerPage),
+		TotalPages: int32(gloss.TotalPages),
+		Total:      int32(gloss.Total),
+	}
+	for _, w := range gloss.Words {
+		out.Words = append(out.Words, &pb.GlossaryWord{Guid: w.GUID, Content: w.Content})
+	}
+
+	return out, nil
+}
+
+// Export streams every headword in a language with its definitions in the
+// target language.
+func (s *grpcServer) Export(r *pb.ExportRequest, stream pb.Dictpress_ExportServer) error {
+	app := s.app
+
+	if _, ok := app.data.Langs[r.GetFromLang()]; !ok {
+		return status.Error(codes.InvalidArgument, "unknown `from` language")
+	}
+	if _, ok := app.data.Langs[r.GetToLang()]; r.GetToLang() != "" && !ok {
+		return status.Error(codes.InvalidArgument, "unknown `to` language")
+	}
+
+	lastID := 0
+	for {
+		words, err := app.data.GetIndexWords(r.GetFromLang(), r.GetToLang(), lastID, grpcExportBatchSize)
+		if err != nil {
+			app.lo.Printf("error fetching entries for export: %v", err)
+			return status.Error(codes.Internal, "error fetching entries")
+		}
+		if len(words) == 0 {
+			return nil
+		}
+
+		ids := make([]int, 0, len(words))
+		for _, w := range words {
+			ids = append(ids, w.ID)
+		}
+		lastID = ids[len(ids)-1]
+
+		entries, err := app.data.GetEntriesByIDs(ids)
+		if err != nil {
+			app.lo.Printf("error fetching entries for export: %v", err)
+			return status.Error(codes.Internal, "error fetching entries")
+		}
+		if err := app.data.SearchAndLoadRelations(entries, data.Query{
+			ToLang: r.GetToLang(),
+			Status: data.StatusEnabled,
+		}); err != nil {
+			app.lo.Printf("error loading relations for export: %v", err)
+			return status.Error(codes.Internal, "error loading relations")
+		}
+
+		for _, e := range entries {
+			if err := stream.Send(grpcEntry(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcEntry converts an entry and its relations into its protobuf message.
+func grpcEntry(e data.Entry) *pb.Entry {
+	out := &pb.Entry{
+		Guid:      e.GUID,
+		Lang:      e.Lang,
+		Content:   e.Content,
+		Initial:   e.Initial,
+		Weight:    e.Weight,
+		Tags:      e.Tags,
+		Phones:    e.Phones,
+		Notes:     e.Notes,
+		CreatedAt: grpcTime(e.CreatedAt),
+		UpdatedAt: grpcTime(e.UpdatedAt),
+	}
+
+	if len(e.Meta) > 0 {
+		if m, err := structpb.NewStruct(e.Meta); err == nil {
+			out.Meta = m
+		}
+	}
+
+	if e.Relation != nil {
+		out.Relation = &pb.Relation{
+			Types:  e.Relation.Types,
+			Tags:   e.Relation.Tags,
+			Notes:  e.Relation.Notes,
+			Weight: e.Relation.Weight,
+		}
+	}
+
+	for _, r := range e.Relations {
+		out.Relations = append(out.Relations, grpcEntry(r))
+	}
+
+	return out
+}
+
+func grpcTime(t null.Time) *timestamppb.Timestamp {
+	if !t.Valid {
+		return nil
+	}
+
+	return timestamppb.New(t.Time)
+}
@@ -1,17 +1,52 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/federation"
 	"github.com/knadh/paginator"
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	// Default and maximum levels of etymological links to load.
+	defaultEtymologyDepth = 3
+	maxEtymologyDepth     = 5
+)
+
+// Query params of search that custom field filters can't use.
+var searchParams = map[string]bool{
+	"q": true, "type": true, "tag": true, "match": true, "fields": true,
+	"expand": true, "page": true, "per_page": true,
+	"pos": true, "gender": true, "register": true, "domain": true,
+	"facets": true, "highlight": true, "cursor": true, "mode": true,
+	"render": true, "sort": true,
+}
+
+// Facets that search matches can be counted by with ?facets=.
+var searchFacets = map[string]bool{"pos": true, "tag": true, "lang": true}
+
+var reGUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Short IDs of entries with the short ID scheme (base58, see new_short_id() in schema.sql).
+var reShortID = regexp.MustCompile(`^[1-9A-HJ-NP-Za-km-z]{10}$`)
+
+// isEntryID checks whether a string is an entry's GUID or short ID, which
+// are interchangeable in the APIs.
+func isEntryID(s string) bool {
+	return reGUID.MatchString(s) || reShortID.MatchString(s)
+}
+
 // results represents a set of results.
 type results struct {
 	Entries []data.Entry `json:"entries"`
@@ -22,12 +57,65 @@ type results struct {
 		ToLang   string   `json:"to_lang"`
 		Types    []string `json:"types"`
 		Tags     []string `json:"tags"`
+		Match    string   `json:"match"`
+		Mode     string   `json:"mode,omitempty"`
+
+		// Filters on the definitions and custom fields of the matches.
+		POS       []string  `json:"pos,omitempty"`
+		Genders   []string  `json:"genders,omitempty"`
+		Registers []string  `json:"registers,omitempty"`
+		Domains   []string  `json:"domains,omitempty"`
+		Fields    data.JSON `json:"fields,omitempty"`
+
+		// Interpretation (phrase|and|or) of a multi-word fulltext query that
+		// yielded the results.
+		Multiword string `json:"multiword,omitempty"`
+
+		// Spelling corrected query, if the original query yielded no
+		// results and was corrected.
+		Correction string `json:"correction,omitempty"`
+
+		// Components of a compound query that were searched for, if the
+		// query itself yielded no results.
+		Compound []string `json:"compound,omitempty"`
+
+		// Detected language of the query if the `from` language was * or a
+		// comma separated list of languages.
+		Detection *data.LangDetection `json:"detection,omitempty"`
 	} `json:"query"`
 
+	// Results grouped by definition language when multiple `to` languages
+	// are searched (* or a comma separated list).
+	Groups []resultGroup `json:"groups,omitempty"`
+
+	// Counts of all the matches by the facets requested with ?facets=.
+	Facets *data.Facets `json:"facets,omitempty"`
+
+	// Machine translation of a query that yielded no results, if the
+	// machine translation hook is enabled.
+	MachineTranslation *mtSuggestion `json:"machine_translation,omitempty"`
+
+	// Results of a query that yielded no results from other instances, if
+	// federation is enabled.
+	Federated []federation.Result `json:"federated,omitempty"`
+
+	// License and attribution of the searched dictionary, if configured.
+	License *data.License `json:"license,omitempty"`
+
+	// Opaque cursor for fetching the next page with ?cursor= (keyset
+	// pagination). Empty if there are no more results.
+	NextCursor string `json:"next_cursor,omitempty"`
+
 	// Pagination fields.
 	paginator.Set
 }
 
+// resultGroup represents the results with definitions in a single language.
+type resultGroup struct {
+	Lang    string       `json:"lang"`
+	Entries []data.Entry `json:"entries"`
+}
+
 // glossary represents a set of glossary words.
 type glossary struct {
 	FromLang string              `json:"from_lang"`
@@ -53,6 +141,15 @@ type httpResp struct {
 func handleSearch(c echo.Context) error {
 	isAuthed := c.Get(isAuthed) != nil
 
+	// Optional selection of entry fields in the results.
+	var fields map[string]bool
+	if f := c.QueryParam("fields"); f != "" {
+		var err error
+		if fields, err = parseFields(f); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
 	_, out, err := doSearch(c, isAuthed)
 	if err != nil {
 		var s int
@@ -67,6 +164,14 @@ func handleSearch(c echo.Context) error {
 		return echo.NewHTTPError(s, err.Error())
 	}
 
+	if len(fields) > 0 {
+		res, err := selectResultFields(out, fields)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, okResp{res})
+	}
+
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
@@ -103,18 +208,161 @@ func doSearch(c echo.Context, isAuthed bool) (data.Query, *results, error) {
 		return data.Query{}, nil, errors.New("no query given")
 	}
 
+	// Optional search syntax in the query, eg: "kick the bucket" tag:idiom to:italian.
+	// The filters are applied as if they were query params.
+	var (
+		syn = parseQuerySyntax(q)
+		raw = q
+	)
+	if syn.Query == "" {
+		return data.Query{}, nil, errors.New("no query given")
+	}
+	q = syn.Query
+	if syn.From != "" {
+		fromLang = syn.From
+	}
+	if syn.To != "" {
+		toLang = syn.To
+	}
+	for k, v := range syn.Filters {
+		qp[k] = append(qp[k], v...)
+	}
+
+	// Detect the language of the query if `from` is * or a comma separated list of languages.
+	var detection *data.LangDetection
+	if fromLang == "*" || strings.Contains(fromLang, ",") {
+		var langs []string
+		if fromLang != "*" {
+			for _, l := range strings.Split(fromLang, ",") {
+				l = strings.TrimSpace(l)
+				if _, ok := app.data.Langs[l]; !ok {
+					return data.Query{}, nil, errors.New("unknown `from` language")
+				}
+				langs = append(langs, l)
+			}
+		}
+
+		d, err := app.data.DetectLang(q, langs)
+		if err != nil {
+			return data.Query{}, nil, err
+		}
+		fromLang = d.Lang
+		detection = &d
+	}
+
 	if _, ok := app.data.Langs[fromLang]; !ok {
 		return data.Query{}, nil, errors.New("unknown `from` language")
 	}
 
-	if toLang == "*" {
+	// Multiple `to` languages: * for all, or a comma separated list.
+	var toLangs []string
+	switch {
+	case toLang == "*":
 		toLang = ""
-	} else {
+	case strings.Contains(toLang, ","):
+		for _, l := range strings.Split(toLang, ",") {
+			l = strings.TrimSpace(l)
+			if _, ok := app.data.Langs[l]; !ok {
+				return data.Query{}, nil, errors.New("unknown `to` language")
+			}
+			toLangs = append(toLangs, l)
+		}
+		toLang = ""
+	default:
 		if _, ok := app.data.Langs[toLang]; !ok {
 			return data.Query{}, nil, errors.New("unknown `to` language")
 		}
 	}
 
+	// Match mode. Defaults to the language's mode.
+	match := qp.Get("match")
+	if match == "" {
+		match = app.data.Langs[fromLang].Match
+	} else if !data.MatchModes[match] {
+		return data.Query{}, nil, errors.New("unknown `match` mode")
+	}
+
+	// Depth of nested relations.
+	depth, err := parseExpand(qp.Get("expand"))
+	if err != nil {
+		return data.Query{}, out, err
+	}
+
+	// Custom field filters, eg: ?dialect=northern.
+	fields, err := parseFieldFilters(qp, app.data.Langs[fromLang])
+	if err != nil {
+		return data.Query{}, out, err
+	}
+
+	// Optional highlighting of the query in results: ?highlight=true for the
+	// whole content or ?highlight=20 for snippets of 20 words.
+	var (
+		highlight bool
+		snippet   int
+	)
+	if h := qp.Get("highlight"); h != "" {
+		if n, err := strconv.Atoi(h); err == nil && n > 0 {
+			highlight, snippet = true, n
+		} else if highlight, err = strconv.ParseBool(h); err != nil {
+			return data.Query{}, out, errors.New("invalid `highlight`. Should be true or a number of words")
+		}
+	}
+
+	// Optional rendering of the content and notes of results to HTML.
+	render, err := parseRender(qp.Get("render"))
+	if err != nil {
+		return data.Query{}, out, err
+	}
+
+	// Keyset pagination with the cursor of the previous page.
+	var after searchCursor
+	if cur := qp.Get("cursor"); cur != "" {
+		if after, err = decodeSearchCursor(cur); err != nil {
+			return data.Query{}, out, errors.New("invalid `cursor`.")
+		}
+		pg.Offset = 0
+	}
+
+	// Optional facet counts, eg: ?facets=pos,tag
+	var facets []string
+	if f := qp.Get("facets"); f != "" {
+		for _, name := range strings.Split(f, ",") {
+			name = strings.TrimSpace(name)
+			if !searchFacets[name] {
+				return data.Query{}, out, fmt.Errorf("unknown facet `%s`. Should be pos|tag|lang", name)
+			}
+			facets = append(facets, name)
+		}
+	}
+
+	// Search mode: ?mode=semantic matches headwords by meaning.
+	mode := qp.Get("mode")
+	switch mode {
+	case "":
+	case data.ModeSemantic:
+		if !app.data.HasSemantic() {
+			return data.Query{}, out, errors.New("semantic search is not enabled")
+		}
+		if after.GUID != "" || len(facets) > 0 || len(qp["pos"])+len(qp["gender"])+len(qp["register"])+len(qp["domain"]) > 0 {
+			return data.Query{}, out, errors.New("`cursor`, `facets`, and definition filters aren't supported with `mode=semantic`")
+		}
+	default:
+		return data.Query{}, out, errors.New("unknown `mode`. Should be semantic")
+	}
+
+	// Sort order: ?sort=frequency orders the matches by word frequency.
+	sortBy := qp.Get("sort")
+	switch sortBy {
+	case "", "relevance":
+		sortBy = ""
+	case data.SortFrequency:
+		if mode != "" {
+			return data.Query{}, out, errors.New("`sort=frequency` isn't supported with `mode=semantic`")
+		}
+	default:
+		return data.Query{}, out, errors.New("unknown `sort`. Should be relevance|frequency")
+	}
+
 	// Search query.
 	query := data.Query{
 		FromLang: fromLang,
@@ -122,59 +370,396 @@ func doSearch(c echo.Context, isAuthed bool) (data.Query, *results, error) {
 		Types:    qp["type"],
 		Tags:     qp["tag"],
 		Query:    q,
+		Match:    match,
+		Mode:     mode,
+		Sort:     sortBy,
 		Status:   data.StatusEnabled,
 		Offset:   pg.Offset,
 		Limit:    pg.Limit,
+
+		RelationDepth: depth,
+		Fields:        fields,
+
+		POS:       qp["pos"],
+		Genders:   qp["gender"],
+		Registers: qp["register"],
+		Domains:   qp["domain"],
+		Facets:    facets,
+
+		Highlight:    highlight,
+		SnippetWords: snippet,
+		RenderHTML:   render,
+
+		Multiword:  after.Multiword,
+		AfterScore: after.Score,
+		AfterGUID:  after.GUID,
+	}
+	if raw != q {
+		query.Input = raw
+	}
+	if syn.Phrase && after.GUID == "" {
+		query.Multiword = data.MultiwordPhrase
 	}
 
 	if err = validateSearchQuery(query, app.data.Langs); err != nil {
 		return query, out, err
 	}
+	if app.data.Backend != nil && mode == "" {
+		if err = data.CheckBackendQuery(query); err != nil {
+			return query, out, err
+		}
+	}
+
+	query, out, err = searchEntries(query, pg, isAuthed, app)
+	if out != nil {
+		out.Query.Detection = detection
+	}
+
+	// Record public searches that yield no results for the admin dashboard.
+	if err == nil && !isAuthed && out.Total == 0 && pg.Page == 1 {
+		go func(to string) {
+			if err := app.data.InsertSearchMiss(fromLang, to, q); err != nil {
+				app.lo.Printf("error recording zero-result search: %v", err)
+			}
+		}(c.Param("toLang"))
+	}
+
+	// Search the other instances for queries that yield no results, except
+	// for the searches of other instances.
+	if err == nil && app.federation != nil && out.Total == 0 && toLang != "" && pg.Page == 1 && query.AfterGUID == "" &&
+		query.Mode == "" && c.Request().Header.Get(federation.Header) == "" {
+		out.Federated = app.federation.Search(c.Request().Context(), q, fromLang, toLang)
+	}
+
+	if err == nil && toLang != "" {
+		if l := app.data.GetLicense(query.FromLang, toLang); l != (data.License{}) {
+			out.License = &l
+		}
+	}
+
+	if err != nil || toLang != "" {
+		return query, out, err
+	}
+
+	if len(toLangs) > 0 {
+		out.Query.ToLang = strings.Join(toLangs, ",")
+	}
+	out.Entries, out.Groups = groupResults(out.Entries, toLangs)
+
+	return query, out, nil
+}
+
+// searchCursor is the position of the last result of a page of search results
+// and the interpretation of the multi-word query that yielded the results.
+type searchCursor struct {
+	Score     float64
+	GUID      string
+	Multiword string
+}
+
+// encodeSearchCursor encodes a search position into an opaque cursor.
+func encodeSearchCursor(c searchCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(
+		strconv.FormatFloat(c.Score, 'g', -1, 64) + ":" + c.GUID + ":" + c.Multiword))
+}
+
+// decodeSearchCursor decodes an opaque cursor into a search position.
+func decodeSearchCursor(s string) (searchCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return searchCursor{}, err
+	}
+
+	p := strings.Split(string(b), ":")
+	if len(p) != 3 || !reGUID.MatchString(p[1]) {
+		return searchCursor{}, errors.New("invalid cursor")
+	}
+	switch p[2] {
+	case "", data.MultiwordPhrase, data.MultiwordAnd, data.MultiwordOr:
+	default:
+		return searchCursor{}, errors.New("invalid cursor")
+	}
+
+	score, err := strconv.ParseFloat(p[0], 64)
+	if err != nil {
+		return searchCursor{}, err
+	}
+
+	return searchCursor{Score: score, GUID: p[1], Multiword: p[2]}, nil
+}
+
+// highlightEntries recursively highlights words in the content of entries
+// and their relations.
+func highlightEntries(entries []data.Entry, words []string, snippet int) {
+	for i := range entries {
+		entries[i].Highlight, _ = data.Highlight(entries[i].Content, words, snippet)
+		highlightEntries(entries[i].Relations, words, snippet)
+	}
+}
+
+// parseRender parses the ?render param that's either empty or html.
+func parseRender(s string) (bool, error) {
+	switch s {
+	case "":
+		return false, nil
+	case "html":
+		return true, nil
+	}
+
+	return false, errors.New("unknown `render`. Should be html")
+}
+
+// renderEntries recursively renders the content and notes of entries and
+// their relations from their languages' content formats to sanitized HTML.
+func renderEntries(entries []data.Entry, langs data.LangMap) {
+	for i := range entries {
+		l := langs[entries[i].Lang]
+		entries[i].ContentHTML = l.RenderHTML(entries[i].Content)
+		if entries[i].Notes != "" {
+			entries[i].NotesHTML = l.RenderHTML(entries[i].Notes)
+		}
+		renderEntries(entries[i].Relations, langs)
+	}
+}
+
+// hideIDs recursively hides the numerical IDs of entries and their relations.
+func hideIDs(entries []data.Entry) {
+	for i := range entries {
+		entries[i].ID = 0
+		hideMediaIDs(entries[i].Media)
+		if r := entries[i].Relation; r != nil {
+			r.ID = 0
+			for j := range r.Examples {
+				r.Examples[j].ID = 0
+				r.Examples[j].RelationID = 0
+			}
+			hideMediaIDs(r.Media)
+		}
+		hideIDs(entries[i].Relations)
+	}
+}
+
+func hideMediaIDs(m []data.Media) {
+	for i := range m {
+		m[i].ID = 0
+		m[i].RelationID = 0
+	}
+}
+
+// groupResults groups search results by the languages of their definitions.
+// If langs is given, definitions in other languages are dropped. Otherwise,
+// the groups are in the order of the languages' first appearance.
+func groupResults(entries []data.Entry, langs []string) ([]data.Entry, []resultGroup) {
+	if len(langs) > 0 {
+		ok := make(map[string]bool, len(langs))
+		for _, l := range langs {
+			ok[l] = true
+		}
+
+		for i, e := range entries {
+			rels := make([]data.Entry, 0, len(e.Relations))
+			for _, r := range e.Relations {
+				if ok[r.Lang] {
+					rels = append(rels, r)
+				}
+			}
+			entries[i].Relations = rels
+		}
+	} else {
+		seen := map[string]bool{}
+		for _, e := range entries {
+			for _, r := range e.Relations {
+				if !seen[r.Lang] {
+					seen[r.Lang] = true
+					langs = append(langs, r.Lang)
+				}
+			}
+		}
+	}
+
+	groups := make([]resultGroup, 0, len(langs))
+	for _, l := range langs {
+		g := resultGroup{Lang: l, Entries: []data.Entry{}}
+		for _, e := range entries {
+			rels := make([]data.Entry, 0)
+			for _, r := range e.Relations {
+				if r.Lang == l {
+					rels = append(rels, r)
+				}
+			}
+			if len(rels) == 0 {
+				continue
+			}
+
+			e.Relations = rels
+			g.Entries = append(g.Entries, e)
+		}
+		groups = append(groups, g)
+	}
+
+	return entries, groups
+}
+
+// searchEntries performs a search for the given query and returns results
+// with relations loaded into the matched entries.
+func searchEntries(query data.Query, pg paginator.Set, isAuthed bool, app *App) (data.Query, *results, error) {
+	var (
+		q        = query.Query
+		fromLang = query.FromLang
+		toLang   = query.ToLang
+	)
 
 	// Search and compose results.
-	out = &results{
+	out := &results{
 		Entries: []data.Entry{},
 	}
-	res, total, err := app.data.Search(query)
-	if err != nil {
-		app.lo.Printf("error querying db: %v", err)
-		return query, nil, errors.New("error querying db")
+
+	// Multi-word fulltext queries are searched as phrases first, falling back
+	// to all the words, and optionally, any of the words.
+	var (
+		lang      = app.data.Langs[fromLang]
+		multiword = []string{""}
+	)
+	if query.AfterGUID != "" || query.Multiword != "" {
+		// Pages after the first one continue with the interpretation that
+		// yielded the first page. Quoted phrases are only searched as phrases.
+		multiword = []string{query.Multiword}
+	} else if query.Match == data.MatchFTS && query.Mode == "" && lang.Tokenizer == nil && app.data.Backend == nil && len(strings.Fields(q)) > 1 {
+		multiword = []string{data.MultiwordPhrase, data.MultiwordAnd}
+		if lang.Multiword == data.MultiwordOr {
+			multiword = append(multiword, data.MultiwordOr)
+		}
+	}
+
+	var (
+		res   []data.Entry
+		total int
+		err   error
+	)
+	for _, m := range multiword {
+		query.Multiword = m
+		res, total, err = app.data.Search(query)
+		if err != nil {
+			app.lo.Printf("error querying db: %v", err)
+			return query, nil, errors.New("error querying db")
+		}
+		if len(res) > 0 {
+			break
+		}
+	}
+
+	// No results. If the language has a compound splitter, search for the
+	// components of the query. Fallbacks only apply to the first page of
+	// non-semantic searches.
+	var compound []string
+	if cp := lang.Compounder; len(res) == 0 && cp != nil && query.AfterGUID == "" && query.Mode == "" {
+		if parts, ok := cp.Split(q); ok {
+			res, total, err = searchCompound(query, parts, app)
+			if err != nil {
+				app.lo.Printf("error querying db: %v", err)
+				return query, nil, errors.New("error querying db")
+			}
+			compound = parts
+		}
+	}
+
+	// No results. If the language has a spelling corrector, try
+	// searching again with the corrected query.
+	correction := ""
+	if sp := lang.Speller; len(res) == 0 && sp != nil && query.AfterGUID == "" && query.Mode == "" {
+		if c, ok := sp.CorrectQuery(q); ok {
+			query.Query = c
+			res, total, err = app.data.Search(query)
+			if err != nil {
+				app.lo.Printf("error querying db: %v", err)
+				return query, nil, errors.New("error querying db")
+			}
+			correction = c
+		}
 	}
 
 	if len(res) == 0 {
+		// Machine translation of the query into the `to` language.
+		if app.mt != nil && toLang != "" && query.AfterGUID == "" && query.Offset == 0 && query.Mode == "" {
+			out.MachineTranslation, _ = translate(q, fromLang, toLang, app)
+		}
+
 		return query, out, nil
 	}
 
+	// Facet counts of all the matches are in the first match. Compound results
+	// are the matches of multiple searches and aren't counted.
+	if len(query.Facets) > 0 && compound == nil && len(res[0].Facets) > 0 {
+		var f data.Facets
+		if err := json.Unmarshal(res[0].Facets, &f); err != nil {
+			app.lo.Printf("error parsing facets: %v", err)
+		} else {
+			out.Facets = &f
+		}
+	}
+
+	// A full page may be followed by more results. Compound and semantic
+	// results can't be paged with a cursor.
+	if len(res) == query.Limit && compound == nil && app.data.Backend == nil && query.Mode == "" {
+		last := res[len(res)-1]
+		out.NextCursor = encodeSearchCursor(searchCursor{last.Score, last.GUID, query.Multiword})
+	}
+
 	// Load relations into the matches.
-	if err := app.data.SearchAndLoadRelations(res, data.Query{
+	relQ := data.Query{
 		ToLang: toLang,
 		Offset: pg.Offset,
 		Limit:  pg.Limit,
 		Status: data.StatusEnabled,
-	}); err != nil {
+	}
+	if err := app.data.SearchAndLoadRelations(res, relQ); err != nil {
 		app.lo.Printf("error querying db for defs: %v", err)
 		return query, nil, errors.New("error querying db for definitions")
 	}
 
+	// Nested relations of relations are in any language.
+	relQ.ToLang = ""
+	if err := app.data.LoadRelationTree(res, relQ, query.RelationDepth); err != nil {
+		app.lo.Printf("error querying db for nested defs: %v", err)
+		return query, nil, errors.New("error querying db for definitions")
+	}
+
 	// If this is an un-authenticated query, hide the numerical IDs.
 	if !isAuthed {
-		for i := range res {
-			res[i].ID = 0
+		hideIDs(res)
+	}
+	app.data.LoadFrequencyBands(res)
 
-			for j := range res[i].Relations {
-				res[i].Relations[j].ID = 0
-				res[i].Relations[j].Relation.ID = 0
-			}
+	// Highlight the words of the query that yielded the results.
+	if query.Highlight {
+		words := lang.HighlightWords(query.Query)
+		if compound != nil {
+			words = lang.HighlightWords(strings.Join(compound, " "))
 		}
+		highlightEntries(res, words, query.SnippetWords)
+	}
+
+	if query.RenderHTML {
+		renderEntries(res, app.data.Langs)
 	}
 
 	pg.SetTotal(total)
 
 	out.Query.FromLang = fromLang
 	out.Query.ToLang = toLang
-	out.Query.Types = qp["type"]
-	out.Query.Tags = qp["tag"]
+	out.Query.Types = query.Types
+	out.Query.Tags = query.Tags
+	out.Query.Match = query.Match
+	out.Query.Mode = query.Mode
+	out.Query.POS = query.POS
+	out.Query.Genders = query.Genders
+	out.Query.Registers = query.Registers
+	out.Query.Domains = query.Domains
+	out.Query.Fields = query.Fields
+	out.Query.Multiword = query.Multiword
 	out.Query.Query = q
+	out.Query.Correction = correction
+	out.Query.Compound = compound
 
 	if out.Query.Types == nil {
 		out.Query.Types = []string{}
@@ -192,6 +777,31 @@ func doSearch(c echo.Context, isAuthed bool) (data.Query, *results, error) {
 	return query, out, nil
 }
 
+// searchCompound searches for every component of a compound word and returns
+// the unique matches of all the components in order.
+func searchCompound(query data.Query, parts []string, app *App) ([]data.Entry, int, error) {
+	var (
+		out  []data.Entry
+		seen = make(map[int]bool)
+	)
+	for _, p := range parts {
+		query.Query = p
+		res, _, err := app.data.Search(query)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, e := range res {
+			if !seen[e.ID] {
+				seen[e.ID] = true
+				out = append(out, e)
+			}
+		}
+	}
+
+	return out, len(out), nil
+}
+
 // getGlossaryWords is a helper function that takes an HTTP query context,
 // gets params from it and returns a glossary of words for a language.
 func getGlossaryWords(lang, initial string, pg paginator.Set, app *App) (*glossary, error) {
@@ -222,6 +832,96 @@ func getGlossaryWords(lang, initial string, pg paginator.Set, app *App) (*glossa
 	return out, nil
 }
 
+// handleRecordClick records a click-through on a search result entry by its
+// guid, which boosts the entry's rank if the clicks ranking is enabled. Clicks
+// are counted in memory and written to the DB periodically. A client's clicks
+// on an entry are counted once per views.flush_interval.
+func handleRecordClick(c echo.Context) error {
+	var (
+		app  = c.Get("app").(*App)
+		guid = c.Param("guid")
+	)
+
+	if !isEntryID(guid) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `guid`")
+	}
+
+	// Only clicks on existing entries are counted so that random GUIDs don't
+	// fill up the counts.
+	if !app.views.counted(guid) {
+		ok, err := app.data.EntryExists(guid)
+		if err != nil {
+			app.lo.Printf("error fetching entry: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "error fetching entry")
+		}
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "entry not found")
+		}
+	}
+
+	app.views.add(guid, viewer(c, app))
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleGetEtymology returns the etymology of a public entry by its guid with
+// its chains of links to other entries up to ?depth levels.
+func handleGetEtymology(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		guid     = c.Param("guid")
+		depth, _ = strconv.Atoi(c.QueryParam("depth"))
+	)
+
+	if !isEntryID(guid) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `guid`")
+	}
+	if depth == 0 {
+		depth = defaultEtymologyDepth
+	}
+	if depth < 1 || depth > maxEtymologyDepth {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("`depth` should be between 1 and %d", maxEtymologyDepth))
+	}
+
+	e, err := app.data.GetEntryByGUID(guid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "entry not found")
+		}
+
+		app.lo.Printf("error fetching entry: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching entry")
+	}
+
+	out, err := app.data.GetEtymology(e, depth)
+	if err != nil {
+		app.lo.Printf("error fetching etymology: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching etymology")
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// parseFieldFilters returns the values of the filterable custom fields of a
+// language in the query params.
+func parseFieldFilters(qp url.Values, lang data.Lang) (data.JSON, error) {
+	out := data.JSON{}
+	for id, f := range lang.Fields {
+		v := qp.Get(id)
+		if !f.Filter || v == "" {
+			continue
+		}
+
+		val, err := f.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("`%s`: %v", id, err)
+		}
+		out[id] = val
+	}
+
+	return out, nil
+}
+
 // validateSearchQuery does basic validation and sanity checks
 // on data.Query (useful for params coming from the outside world).
 func validateSearchQuery(q data.Query, langs data.LangMap) error {
@@ -230,6 +930,41 @@ func validateSearchQuery(q data.Query, langs data.LangMap) error {
 			return fmt.Errorf("unknown type %s", t)
 		}
 	}
+	for _, t := range q.POS {
+		if _, ok := langs[q.FromLang].Types[t]; !ok {
+			return fmt.Errorf("unknown pos %s", t)
+		}
+	}
+
+	// Definition labels are configured in the definitions' languages. With
+	// multiple `to` languages, labels in any language are accepted.
+	hasLabel := func(v string, get func(data.Lang) map[string]string) bool {
+		if l, ok := langs[q.ToLang]; ok {
+			_, ok := get(l)[v]
+			return ok
+		}
+		for _, l := range langs {
+			if _, ok := get(l)[v]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	for _, v := range q.Genders {
+		if !hasLabel(v, func(l data.Lang) map[string]string { return l.Genders }) {
+			return fmt.Errorf("unknown gender %s", v)
+		}
+	}
+	for _, v := range q.Registers {
+		if !hasLabel(v, func(l data.Lang) map[string]string { return l.Registers }) {
+			return fmt.Errorf("unknown register %s", v)
+		}
+	}
+	for _, v := range q.Domains {
+		if !hasLabel(v, func(l data.Lang) map[string]string { return l.Domains }) {
+			return fmt.Errorf("unknown domain %s", v)
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Max time that the DB readiness check waits for the DB.
+const readyDBTimeout = 2 * time.Second
+
+// healthCheck is the result of a single readiness check.
+type healthCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// handleHealthz is the liveness probe. It responds as long as the HTTP server is up.
+func handleHealthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, struct {
+		Status  string `json:"status"`
+		Version string `json:"version"`
+	}{"ok", versionString})
+}
+
+// handleReadyz is the readiness probe. It checks DB connectivity, that the site
+// theme is loaded (if there's one), and that the tokenizers of all languages
+// are available. It responds with 503 if any check fails.
+func handleReadyz(c echo.Context) error {
+	var (
+		app    = c.Get("app").(*App)
+		checks = make(map[string]healthCheck)
+		status = http.StatusOK
+	)
+
+	// DB.
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readyDBTimeout)
+	defer cancel()
+	if err := app.db.PingContext(ctx); err != nil {
+		checks["db"] = healthCheck{Error: err.Error()}
+	} else {
+		checks["db"] = healthCheck{OK: true}
+	}
+
+	// Site theme.
+	if app.consts.Site != "" {
+		if app.siteTpl == nil {
+			checks["theme"] = healthCheck{Error: "site theme not loaded"}
+		} else {
+			checks["theme"] = healthCheck{OK: true}
+		}
+	}
+
+	// Tokenizers. Bundled tokenizers should be loaded and Postgres tokenizers
+	// should exist as text search configurations in the DB.
+	checks["tokenizers"] = checkTokenizers(app, checks["db"].OK)
+
+	for _, ch := range checks {
+		if !ch.OK {
+			status = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	out := struct {
+		Status string                 `json:"status"`
+		Checks map[string]healthCheck `json:"checks"`
+	}{"ok", checks}
+	if status != http.StatusOK {
+		out.Status = "error"
+	}
+
+	return c.JSON(status, out)
+}
+
+// checkTokenizers checks that the tokenizers of all languages are available.
+func checkTokenizers(app *App, dbOK bool) healthCheck {
+	var pgCfgs []string
+	for id, l := range app.data.Langs {
+		if l.TokenizerType == "custom" && l.Tokenizer == nil {
+			return healthCheck{Error: fmt.Sprintf("tokenizer '%s' of %s not loaded", l.TokenizerName, id)}
+		}
+		if l.TokenizerType == "postgres" && l.TokenizerName != "" {
+			pgCfgs = append(pgCfgs, l.TokenizerName)
+		}
+	}
+
+	if len(pgCfgs) == 0 {
+		return healthCheck{OK: true}
+	}
+	if !dbOK {
+		return healthCheck{Error: "DB unavailable"}
+	}
+
+	found, err := app.data.GetTSConfigs(pgCfgs)
+	if err != nil {
+		return healthCheck{Error: err.Error()}
+	}
+
+	has := make(map[string]bool, len(found))
+	for _, f := range found {
+		has[f] = true
+	}
+	for _, name := range pgCfgs {
+		if !has[name] {
+			return healthCheck{Error: fmt.Sprintf("Postgres text search config '%s' not found", name)}
+		}
+	}
+
+	return healthCheck{OK: true}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/koanf/v2"
+)
+
+// ID schemes of new entries (app.id_scheme).
+const (
+	idSchemeUUIDv4 = "uuidv4"
+	idSchemeUUIDv7 = "uuidv7"
+	idSchemeShort  = "short"
+
+	settingIDScheme = "app.id_scheme"
+)
+
+// initIDScheme records the ID scheme in the config in the settings where the
+// DB picks it up to generate the GUIDs (and short IDs) of new entries from all
+// the sources (admin, submissions, imports). With the short ID scheme, short IDs
+// are generated for existing entries that don't have one.
+func initIDScheme(ko *koanf.Koanf, q *data.Queries) {
+	scheme := ko.String("app.id_scheme")
+	switch scheme {
+	case "":
+		scheme = idSchemeUUIDv4
+	case idSchemeUUIDv4, idSchemeUUIDv7, idSchemeShort:
+	default:
+		lo.Fatalf("unknown app.id_scheme '%s'. Should be one of %s, %s, %s", scheme, idSchemeUUIDv4, idSchemeUUIDv7, idSchemeShort)
+	}
+
+	b, _ := json.Marshal(scheme)
+	if _, err := q.UpsertSetting.Exec(settingIDScheme, string(b)); err != nil {
+		lo.Fatalf("error saving app.id_scheme: %v", err)
+	}
+
+	if scheme != idSchemeShort {
+		return
+	}
+
+	var n int
+	if err := q.BackfillShortIDs.Get(&n); err != nil {
+		lo.Fatalf("error generating short IDs: %v", err)
+	}
+	if n > 0 {
+		lo.Printf("generated short IDs for %d entries", n)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Number of index words fetched from the DB at a time.
+	indexBatchSize = 5000
+
+	// Max length (characters) of the short gloss in the search index.
+	indexGlossLen = 100
+)
+
+// handleGetIndex streams the search index (headwords with their GUIDs and short
+// glosses) of a dictionary pair as a JSON array or as ndjson (?format=ndjson).
+func handleGetIndex(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		fromLang = c.Param("fromLang")
+		toLang   = c.Param("toLang")
+		ndjson   = c.QueryParam("format") == "ndjson"
+	)
+
+	if !isDict(fromLang, toLang, app) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown dictionary")
+	}
+
+	if ndjson {
+		c.Response().Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	} else {
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	}
+	c.Response().WriteHeader(http.StatusOK)
+
+	if _, err := writeIndex(c.Response(), fromLang, toLang, ndjson, nil, app); err != nil {
+		// Headers have already been sent.
+		app.lo.Printf("error writing index: %v", err)
+	}
+
+	return nil
+}
+
+// handleGetGlossary streams all the glossary words of a language, optionally
+// for an ?initial, as a JSON array or as ndjson (?format=ndjson). Unlike the
+// paginated glossary pages, words are ordered by their insertion order.
+func handleGetGlossary(c echo.Context) error {
+	var (
+		app     = c.Get("app").(*App)
+		lang    = c.Param("lang")
+		initial = c.QueryParam("initial")
+		ndjson  = c.QueryParam("format") == "ndjson"
+	)
+
+	if _, ok := app.data.Langs[lang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown language")
+	}
+
+	if ndjson {
+		c.Response().Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	} else {
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	}
+	c.Response().WriteHeader(http.StatusOK)
+
+	var (
+		s     = newJSONStream(c.Response(), ndjson)
+		ctx   = c.Request().Context()
+		after data.GlossaryWord
+	)
+	for ctx.Err() == nil {
+		words, err := app.data.GetGlossaryWordsAfter(lang, initial, after, indexBatchSize)
+		if err != nil {
+			// Headers have already been sent.
+			app.lo.Printf("error fetching glossary words: %v", err)
+			return nil
+		}
+		if len(words) == 0 {
+			break
+		}
+
+		after = words[len(words)-1]
+		for _, w := range words {
+			w.ID = 0
+			if err := s.Write(w); err != nil {
+				return nil
+			}
+		}
+
+		if err := s.Flush(); err != nil {
+			return nil
+		}
+	}
+
+	s.Close()
+	return nil
+}
+
+// writeIndex writes the search index of a dictionary pair to w as a JSON array or as
+// ndjson (one JSON object per line) and returns the number of words written. If
+// keep is set, only the words that it returns true for are written.
+func writeIndex(w io.Writer, fromLang, toLang string, ndjson bool, keep func(data.IndexWord) bool, app *App) (int, error) {
+	var (
+		s       = newJSONStream(w, ndjson)
+		afterID = 0
+	)
+
+	for {
+		words, err := app.data.GetIndexWords(fromLang, toLang, afterID, indexBatchSize)
+		if err != nil {
+			return s.n, fmt.Errorf("error fetching index words: %v", err)
+		}
+		if len(words) == 0 {
+			break
+		}
+
+		for _, w := range words {
+			if keep != nil && !keep(w) {
+				continue
+			}
+
+			w.Gloss = truncate(w.Gloss, indexGlossLen)
+			if err := s.Write(w); err != nil {
+				return s.n, err
+			}
+		}
+
+		afterID = words[len(words)-1].ID
+		if err := s.Flush(); err != nil {
+			return s.n, err
+		}
+	}
+
+	return s.n, s.Close()
+}
+
+// jsonStream writes JSON objects to w as a JSON array or as ndjson (one
+// object per line) without buffering all of them. Flush() sends the objects
+// written so far to the client when w is an HTTP response.
+type jsonStream struct {
+	w      io.Writer
+	bw     *bufio.Writer
+	enc    *json.Encoder
+	ndjson bool
+	n      int
+}
+
+func newJSONStream(w io.Writer, ndjson bool) *jsonStream {
+	s := &jsonStream{w: w, bw: bufio.NewWriter(w), ndjson: ndjson}
+	s.enc = json.NewEncoder(s.bw)
+	s.enc.SetEscapeHTML(false)
+
+	if !ndjson {
+		s.bw.WriteString("[")
+	}
+
+	return s
+}
+
+// Write writes an object to the stream.
+func (s *jsonStream) Write(v interface{}) error {
+	if !s.ndjson && s.n > 0 {
+		s.bw.WriteString(",")
+	}
+
+	// Encode() appends a newline after every object.
+	if err := s.enc.Encode(v); err != nil {
+		return err
+	}
+	s.n++
+
+	return nil
+}
+
+// Flush flushes the buffered objects to w and to the client.
+func (s *jsonStream) Flush() error {
+	if err := s.bw.Flush(); err != nil {
+		return err
+	}
+
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
+
+// Close ends the JSON array and flushes the stream.
+func (s *jsonStream) Close() error {
+	if !s.ndjson {
+		s.bw.WriteString("]")
+	}
+
+	return s.Flush()
+}
+
+// isDict checks whether the given language pair is a configured dictionary.
+func isDict(fromLang, toLang string, app *App) bool {
+	for _, d := range app.data.Dicts {
+		if d[0].ID == fromLang && d[1].ID == toLang {
+			return true
+		}
+	}
+
+	return false
+}
+
+// truncate truncates a string to n characters adding an ellipsis.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n]) + "…"
+}
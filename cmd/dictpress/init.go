@@ -10,17 +10,28 @@ import (
 	mrand "math/rand"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strings"
+	"time"
 	"unicode"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/jmoiron/sqlx"
 	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/elastic"
+	"github.com/knadh/dictpress/internal/embedding"
+	"github.com/knadh/dictpress/internal/federation"
+	"github.com/knadh/dictpress/internal/mt"
+	"github.com/knadh/dictpress/internal/oidc"
+	"github.com/knadh/dictpress/internal/sanitize"
+	"github.com/knadh/dictpress/tokenizers/cjk"
+	"github.com/knadh/dictpress/tokenizers/indic"
 	"github.com/knadh/dictpress/tokenizers/indicphone"
+	"github.com/knadh/goyesql"
 	"github.com/knadh/koanf/v2"
 	"github.com/knadh/stuffbin"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/text/language"
 )
 
 func initConstants(ko *koanf.Koanf) Consts {
@@ -31,7 +42,39 @@ func initConstants(ko *koanf.Koanf) Consts {
 		AdminPassword:     ko.MustBytes("app.admin_password"),
 		EnableSubmissions: ko.Bool("app.enable_submissions"),
 		EnableGlossary:    ko.Bool("glossary.enabled"),
+		GlossaryPageNums:  ko.Int("glossary.num_page_nums"),
+		EnableOIDC:        ko.Bool("oidc.enabled"),
 		AdminAssets:       ko.Strings("app.admin_assets"),
+		EntryLockDuration: ko.Duration("app.entry_lock_duration"),
+	}
+
+	// Site themes in embedded or S3 storage don't need a --site directory.
+	if s := ko.String("storage.site"); c.Site == "" && (s == storageEmbedded || s == storageS3) {
+		c.Site = s
+	}
+
+	if err := ko.Unmarshal("pwa", &c.PWA); err != nil {
+		lo.Fatalf("error loading pwa config: %v", err)
+	}
+	if c.PWA.CacheEntries < 1 {
+		c.PWA.CacheEntries = 50
+	}
+
+	if err := ko.Unmarshal("feed", &c.Feed); err != nil {
+		lo.Fatalf("error loading feed config: %v", err)
+	}
+	if c.Feed.NumEntries < 1 {
+		c.Feed.NumEntries = 50
+	}
+
+	if err := ko.Unmarshal("similar", &c.Similar); err != nil {
+		lo.Fatalf("error loading similar config: %v", err)
+	}
+	if c.Similar.Strategy == "" {
+		c.Similar.Strategy = data.SimilarTokens
+	}
+	if c.Similar.NumEntries < 1 {
+		c.Similar.NumEntries = 10
 	}
 
 	if len(c.AdminUsername) < 6 {
@@ -45,17 +88,66 @@ func initConstants(ko *koanf.Koanf) Consts {
 	return c
 }
 
-// initDB initializes a database connection.
-func initDB(host string, port int, user, pwd, dbName string) *sqlx.DB {
-	db, err := sqlx.Connect("postgres",
-		fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", host, port, user, pwd, dbName))
+// dbPoolOpt represents the DB connection pool options.
+type dbPoolOpt struct {
+	MaxOpen     int           `koanf:"max_open"`
+	MaxIdle     int           `koanf:"max_idle"`
+	MaxLifetime time.Duration `koanf:"max_lifetime"`
+	MaxIdleTime time.Duration `koanf:"max_idle_time"`
+}
+
+// initDBPoolOpt loads the DB connection pool options.
+func initDBPoolOpt(ko *koanf.Koanf) dbPoolOpt {
+	var o dbPoolOpt
+	if err := ko.Unmarshal("db", &o); err != nil {
+		lo.Fatalf("error loading db config: %v", err)
+	}
+
+	if o.MaxOpen < 1 {
+		o.MaxOpen = 25
+	}
+	if o.MaxIdle < 1 || o.MaxIdle > o.MaxOpen {
+		o.MaxIdle = o.MaxOpen
+	}
+	if o.MaxLifetime == 0 {
+		o.MaxLifetime = time.Minute * 30
+	}
+	if o.MaxIdleTime == 0 {
+		o.MaxIdleTime = time.Minute * 5
+	}
+
+	return o
+}
+
+// initDB initializes a database connection pool.
+func initDB(host string, port int, user, pwd, dbName string, pool dbPoolOpt) *sqlx.DB {
+	db, err := connectDB(host, port, user, pwd, dbName)
 	if err != nil {
 		lo.Fatalf("error initializing DB: %v", err)
 	}
 
+	// Prepared statements are prepared on every connection that they're run on
+	// and are reused for the lifetime of the connection. Idle connections are
+	// kept around so that busy instances don't keep re-connecting and
+	// re-preparing statements.
+	db.SetMaxOpenConns(pool.MaxOpen)
+	db.SetMaxIdleConns(pool.MaxIdle)
+	db.SetConnMaxLifetime(pool.MaxLifetime)
+	db.SetConnMaxIdleTime(pool.MaxIdleTime)
+
 	return db
 }
 
+// connectDB connects to the database.
+func connectDB(host string, port int, user, pwd, dbName string) (*sqlx.DB, error) {
+	return sqlx.Connect("postgres", dbDSN(host, port, user, pwd, dbName))
+}
+
+// dbDSN returns the connection string of the database.
+func dbDSN(host string, port int, user, pwd, dbName string) string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", host, port, user, pwd, dbName)
+}
+
 // initFS initializes the stuffbin FileSystem to provide
 // access to bunded static assets to the app.
 func initFS() stuffbin.FileSystem {
@@ -79,6 +171,7 @@ func initFS() stuffbin.FileSystem {
 		"queries.sql",
 		"schema.sql",
 		"admin",
+		"demo",
 	}
 
 	fs, err = stuffbin.NewLocalFS("/", files...)
@@ -99,17 +192,26 @@ func initAdminTemplates(app *App) *template.Template {
 	return tpls
 }
 
-// initTokenizers initializes all bundled tokenizers.
+// initTokenizers initializes all bundled tokenizers. The Indic script
+// tokenizers are named after their scripts, eg: kannada, devanagari.
 func initTokenizers() map[string]data.Tokenizer {
-	return map[string]data.Tokenizer{
+	out := map[string]data.Tokenizer{
 		"indicphone": indicphone.New(),
+		"cjk":        cjk.New(),
 	}
+	for _, s := range indic.Scripts {
+		out[s.Name] = indic.New(s)
+	}
+
+	return out
 }
 
 func initHTTPServer(app *App, ko *koanf.Koanf) *echo.Echo {
 	srv := echo.New()
 	srv.Debug = true
 	srv.HideBanner = true
+	srv.JSONSerializer = apiSerializer{}
+	srv.HTTPErrorHandler = httpErrorHandler(srv)
 
 	// Register app (*App) to be injected into all HTTP handlers.
 	srv.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -119,29 +221,86 @@ func initHTTPServer(app *App, ko *koanf.Koanf) *echo.Echo {
 		}
 	})
 
+	// Respond to panics in handlers with 500 errors (error pages on the site).
+	srv.Use(middleware.Recover())
+
+	// Custom and security response headers of the site, admin, and API routes.
+	srv.Use(setHeaders(initHeaders(ko)))
+
+	// Compress API and HTML responses. Uploaded images are already compressed.
+	if ko.Bool("app.enable_compression") {
+		srv.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+			Level:     ko.Int("app.compression_level"),
+			MinLength: ko.Int("app.compression_min_length"),
+			Skipper: func(c echo.Context) bool {
+				return strings.HasPrefix(c.Request().URL.Path, mediaURI+"/")
+			},
+		}))
+	}
+
+	// Liveness and readiness probes.
+	srv.GET("/healthz", handleHealthz)
+	srv.GET("/readyz", handleReadyz)
+
 	var (
 		// Public handlers with no auth.
 		p = srv.Group("")
 
+		// Public site pages that show the maintenance page in maintenance mode.
+		s = p.Group("", filterBots, maintenancePage)
+
 		// Admin handlers with auth.
-		a = srv.Group("", middleware.BasicAuth(basicAuth))
+		a = srv.Group("", authMiddleware(app), auditLog(app))
 	)
 
+	// robots.txt for crawlers that are blocked if they ignore it.
+	if app.bots != nil && app.bots.opt.HonorRobots {
+		p.GET("/robots.txt", handleRobots)
+	}
+
+	// OIDC login for the admin.
+	if app.oidc != nil {
+		p.GET("/admin/login", handleOIDCLogin)
+		p.GET("/admin/oidc/callback", handleOIDCCallback)
+		p.GET("/admin/logout", handleLogout)
+	}
+
+	// Login links e-mailed to readers and embeddable public word lists.
+	if app.readers != nil {
+		p.GET("/readers/login/:token", handleReaderLogin)
+		p.GET("/lists/:slug/embed", handleWordListEmbed)
+	}
+
 	// Dictionary site HTML views.
 	if app.consts.Site != "" {
-		p.GET("/", handleIndexPage)
-		p.GET("/dictionary/:fromLang/:toLang/:q", handleSearchPage)
-		p.GET("/dictionary/:fromLang/:toLang", handleSearchPage)
-		p.GET("/p/:page", handleStaticPage)
+		s.GET("/", handleIndexPage)
+		s.GET("/dictionary/:fromLang/:toLang/:q", handleSearchPage)
+		s.GET("/dictionary/:fromLang/:toLang", handleSearchPage)
+		s.GET("/p/:page", handleStaticPage)
+		s.GET("/word/:lang/:slug", handleWordPage)
+
+		// Progressive Web App manifest and service worker.
+		if app.consts.PWA.Enabled {
+			p.GET("/manifest.json", handleManifest)
+			p.GET("/sw.js", handleServiceWorker)
+		}
 
 		if app.consts.EnableGlossary {
-			p.GET("/glossary/:fromLang/:toLang/:initial", handleGlossaryPage)
+			s.GET("/glossary/:fromLang/:toLang/:initial", handleGlossaryPage)
+		}
+
+		if app.consts.Feed.Enabled {
+			p.GET("/feed.xml", handleFeed)
 		}
 
-		// Static files.
-		fs := http.StripPrefix("/static", http.FileServer(
-			http.Dir(filepath.Join(app.consts.Site, "static"))))
-		srv.GET("/static/*", echo.WrapHandler(fs))
+		if app.readers != nil {
+			s.GET("/lists/:slug", handleWordListPage)
+		}
+
+		// Static files. Only files in the theme's static directory are served.
+		srv.GET("/static/*", func(c echo.Context) error {
+			return app.theme(c).serveStatic(c)
+		})
 
 	} else {
 		// API greeting if there's no site.
@@ -150,60 +309,128 @@ func initHTTPServer(app *App, ko *koanf.Koanf) *echo.Echo {
 		})
 	}
 
-	// Public APIs.
-	p.GET("/api/config", handleGetConfig)
-	p.GET("/api/dictionary/:fromLang/:toLang/:q", handleSearch)
-
-	// Public user submission APIs.
-	if ko.Bool("app.enable_submissions") {
-		p.POST("/api/submissions", handleNewSubmission)
-		p.POST("/api/submissions/comments", handleNewComments)
+	// Public site submission pages.
+	if ko.Bool("app.enable_submissions") && app.consts.Site != "" {
+		s.GET("/submit", handleSubmissionPage)
+		s.POST("/submit", handleSubmissionPage)
+	}
 
-		if app.consts.Site != "" {
-			p.GET("/submit", handleSubmissionPage)
-			p.POST("/submit", handleSubmissionPage)
-		}
+	// Images uploaded to the filesystem media store.
+	if app.consts.Media.Provider == mediaFilesystem {
+		p.Static(mediaURI, app.consts.Media.UploadPath)
 	}
 
-	// Admin handlers and APIs.
-	a.GET("/api/entries/:fromLang/:toLang", handleSearch)
-	a.GET("/api/entries/:fromLang/:toLang/:q", handleSearch)
+	// Admin pages.
 	a.GET("/admin/static/*", echo.WrapHandler(app.fs.FileServer()))
 	a.GET("/admin", adminPage("index"))
 	a.GET("/admin/search", adminPage("search"))
 	a.GET("/admin/pending", adminPage("pending"))
+	a.GET("/admin/worklist", adminPage("worklist"))
+	a.GET("/admin/jobs", adminPage("jobs"))
+	a.GET("/admin/trash", adminPage("trash"))
+	a.GET("/admin/languages", adminPage("languages"))
 
-	a.GET("/api/stats", handleGetStats)
-	a.GET("/api/entries/pending", handleGetPendingEntries)
-	a.GET("/api/entries/comments", handleGetComments)
-	a.DELETE("/api/entries/comments/:commentID", handleDeletecomments)
-	a.DELETE("/api/entries/pending", handleDeletePending)
-	a.GET("/api/entries/:id", handleGetEntry)
-	a.GET("/api/entries/:id/parents", handleGetParentEntries)
-	a.POST("/api/entries", handleInsertEntry)
-	a.PUT("/api/entries/:id", handleUpdateEntry)
-	a.DELETE("/api/entries/:id", handleDeleteEntry)
-	a.DELETE("/api/entries/:fromID/relations/:relID", handleDeleteRelation)
-	a.POST("/api/entries/:fromID/relations/:toID", handleAddRelation)
-	a.PUT("/api/entries/:id/relations/weights", handleReorderRelations)
-	a.PUT("/api/entries/:id/relations/:relID", handleUpdateRelation)
-	a.PUT("/api/entries/:id/submission", handleApproveSubmission)
-	a.DELETE("/api/entries/:id/submission", handleRejectSubmission)
+	// APIs are served under /api/v1 and, for compatibility, optionally
+	// under the unversioned /api with the legacy response format.
+	initAPIRoutes(apiV1, p, a, ko)
+	if !ko.Exists("app.legacy_api") || ko.Bool("app.legacy_api") {
+		initAPIRoutes(apiLegacy, p, a, ko)
+	}
+
+	// OpenAPI spec of the v1 APIs generated from the route registry and the optional Swagger UI.
+	spec, err := makeOpenAPISpec(apiRoutes(ko), app.consts.RootURL, versionString)
+	if err != nil {
+		lo.Fatalf("error generating OpenAPI spec: %v", err)
+	}
+	p.GET(apiLegacy+"/openapi.json", handleOpenAPISpec(spec))
+	if ko.Bool("app.enable_api_docs") {
+		p.GET(apiLegacy+"/docs", handleAPIDocs)
+	}
 
 	// 404 pages.
 	srv.RouteNotFound("/api/*", func(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusNotFound, "Unknown endpoint")
 	})
 	srv.RouteNotFound("/*", func(c echo.Context) error {
-		return c.Render(http.StatusNotFound, "message", pageTpl{
-			Title:   "404 Page not found",
-			Heading: "404 Page not found",
-		})
+		return echo.NewHTTPError(http.StatusNotFound, "Page not found.")
 	})
 
 	return srv
 }
 
+// Route groups that response headers are configured for.
+const (
+	headersSite  = "site"
+	headersAdmin = "admin"
+	headersAPI   = "api"
+)
+
+// initHeaders loads the response headers of every route group ([headers.site],
+// [headers.admin], [headers.api]) merged with the headers common to all
+// groups ([headers.all]). A header with an empty value in a group unsets the
+// common header for the group.
+func initHeaders(ko *koanf.Koanf) map[string]http.Header {
+	var (
+		all = ko.StringMap("headers.all")
+		out = make(map[string]http.Header)
+	)
+
+	for _, g := range []string{headersSite, headersAdmin, headersAPI} {
+		h := http.Header{}
+		for k, v := range all {
+			h.Set(k, v)
+		}
+
+		for k, v := range ko.StringMap("headers." + g) {
+			if v == "" {
+				h.Del(k)
+				continue
+			}
+			h.Set(k, v)
+		}
+		out[g] = h
+	}
+
+	return out
+}
+
+// setHeaders is a middleware that sets the configured response headers of
+// the route group that a request belongs to. Handlers can override them.
+func setHeaders(groups map[string]http.Header) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var (
+				p = c.Request().URL.Path
+				g = headersSite
+			)
+			switch {
+			case p == apiLegacy || strings.HasPrefix(p, apiLegacy+"/"):
+				g = headersAPI
+			case p == "/admin" || strings.HasPrefix(p, "/admin/"):
+				g = headersAdmin
+			}
+
+			h := c.Response().Header()
+			for k, v := range groups[g] {
+				h[k] = v
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// initAPIRoutes registers all public and admin API routes in the route registry under the given prefix.
+func initAPIRoutes(prefix string, p, a *echo.Group, ko *koanf.Koanf) {
+	for _, r := range apiRoutes(ko) {
+		if r.perm == "" {
+			p.Add(r.method, prefix+r.path, r.handler, filterBots, readOnlyAPI, apiKeyAuth(r.tag == "public"))
+			continue
+		}
+		a.Add(r.method, prefix+r.path, r.handler, requirePerm(r.perm))
+	}
+}
+
 // initLangs loads language configuration into a given *App instance.
 func initLangs(ko *koanf.Koanf) data.LangMap {
 	var (
@@ -213,18 +440,9 @@ func initLangs(ko *koanf.Koanf) data.LangMap {
 
 	// Language configuration.
 	for _, l := range ko.MapKeys("lang") {
-		lang := data.Lang{ID: l, Types: make(map[string]string)}
-		if err := ko.UnmarshalWithConf("lang."+l, &lang, koanf.UnmarshalConf{Tag: "json"}); err != nil {
-			lo.Fatalf("error loading languages: %v", err)
-		}
-
-		// Does the language use a bundled tokenizer?
-		if lang.TokenizerType == "custom" {
-			t, ok := tks[lang.TokenizerName]
-			if !ok {
-				lo.Fatalf("unknown custom tokenizer '%s'", lang.TokenizerName)
-			}
-			lang.Tokenizer = t
+		lang, err := loadLang(l, ko, tks)
+		if err != nil {
+			lo.Fatal(err)
 		}
 
 		// Load external plugin.
@@ -236,9 +454,175 @@ func initLangs(ko *koanf.Koanf) data.LangMap {
 		lo.Fatal("0 languages defined in config")
 	}
 
+	// Definition slots of templates can be in any of the languages.
+	for id, l := range out {
+		if err := l.Templates.ValidateDefs(out); err != nil {
+			lo.Fatalf("error in templates config for %s: %v", id, err)
+		}
+	}
+
 	return out
 }
 
+// loadLang loads and validates the config of a language (lang.$id).
+func loadLang(l string, ko *koanf.Koanf, tks map[string]data.Tokenizer) (data.Lang, error) {
+	lang := data.Lang{ID: l, Types: make(map[string]string)}
+	if err := ko.UnmarshalWithConf("lang."+l, &lang, koanf.UnmarshalConf{Tag: "json"}); err != nil {
+		return lang, fmt.Errorf("error loading language %s: %v", l, err)
+	}
+
+	if lang.Match == "" {
+		lang.Match = data.MatchFTS
+	}
+	if !data.MatchModes[lang.Match] {
+		return lang, fmt.Errorf("unknown match mode '%s' for %s", lang.Match, l)
+	}
+
+	if lang.Multiword == "" {
+		lang.Multiword = data.MultiwordAnd
+	}
+	if lang.Multiword != data.MultiwordAnd && lang.Multiword != data.MultiwordOr {
+		return lang, fmt.Errorf("unknown multiword mode '%s' for %s. Should be and|or", lang.Multiword, l)
+	}
+
+	// Does the language use a bundled tokenizer?
+	if lang.TokenizerType == "custom" {
+		t, ok := tks[lang.TokenizerName]
+		if !ok {
+			return lang, fmt.Errorf("unknown custom tokenizer '%s'", lang.TokenizerName)
+		}
+		lang.Tokenizer = t
+	}
+
+	// Optional Postgres text search configuration created in the DB.
+	if lang.TSConfig != nil {
+		if lang.TokenizerType != "postgres" && lang.TokenizerType != "" {
+			return lang, fmt.Errorf("ts_config of %s requires the postgres tokenizer_type", l)
+		}
+		if err := lang.TSConfig.Validate(lang.TokenizerName); err != nil {
+			return lang, fmt.Errorf("%v for %s", err, l)
+		}
+	}
+
+	// Optional query-time stopwords and synonyms.
+	if f := ko.String("lang." + l + ".stopwords_file"); f != "" {
+		words, err := readWordLists(f)
+		if err != nil {
+			return lang, fmt.Errorf("error loading stopwords for %s: %v", l, err)
+		}
+
+		lang.Stopwords = make(map[string]bool)
+		for _, w := range words {
+			for _, s := range w {
+				lang.Stopwords[s] = true
+			}
+		}
+	}
+	if f := ko.String("lang." + l + ".synonyms_file"); f != "" {
+		groups, err := readWordLists(f)
+		if err != nil {
+			return lang, fmt.Errorf("error loading synonyms for %s: %v", l, err)
+		}
+
+		// Every word in a group is a synonym of every other word in the group.
+		lang.Synonyms = make(map[string][]string)
+		for _, g := range groups {
+			for i, w := range g {
+				// Normalize the spacing in multi-word synonyms for matching query phrases.
+				g[i] = strings.Join(strings.Fields(w), " ")
+			}
+			for _, w := range g {
+				lang.Synonyms[w] = append(lang.Synonyms[w], g...)
+				if n := len(strings.Fields(w)); n > lang.SynonymWords {
+					lang.SynonymWords = n
+				}
+			}
+		}
+	}
+
+	switch lang.Direction {
+	case "":
+		lang.Direction = data.DirLTR
+	case data.DirLTR, data.DirRTL:
+	default:
+		return lang, fmt.Errorf("unknown direction '%s' for %s. Should be ltr|rtl", lang.Direction, l)
+	}
+	if lang.Locale != "" {
+		if _, err := language.Parse(lang.Locale); err != nil {
+			return lang, fmt.Errorf("invalid locale '%s' for %s: %v", lang.Locale, l, err)
+		}
+	}
+
+	// Format of entry content and the policy that HTML content is sanitized by.
+	if lang.ContentFormat == "" {
+		lang.ContentFormat = data.ContentText
+	}
+	if !data.ContentFormats[lang.ContentFormat] {
+		return lang, fmt.Errorf("unknown content_format '%s' for %s. Should be text|html|markdown", lang.ContentFormat, l)
+	}
+	// The language's own sanitizer policy replaces the global one.
+	key := "sanitizer"
+	if ko.Exists("lang." + l + ".sanitizer") {
+		key = "lang." + l + ".sanitizer"
+	}
+	p, err := initSanitizer(ko, key)
+	if err != nil {
+		return lang, err
+	}
+	lang.Sanitizer = p
+
+	if err := lang.Normalize.Validate(); err != nil {
+		return lang, fmt.Errorf("error in normalize config for %s: %v", l, err)
+	}
+
+	// Custom fields that are filterable can't shadow the search query params.
+	if err := lang.Fields.Validate(); err != nil {
+		return lang, fmt.Errorf("error in fields config for %s: %v", l, err)
+	}
+	for id, f := range lang.Fields {
+		if f.Filter && searchParams[id] {
+			return lang, fmt.Errorf("filterable field '%s' of %s is a reserved search param", id, l)
+		}
+	}
+
+	if err := lang.Templates.Validate(lang.Fields); err != nil {
+		return lang, fmt.Errorf("error in templates config for %s: %v", l, err)
+	}
+	if lang.RequireTemplate && len(lang.Templates) == 0 {
+		return lang, fmt.Errorf("require_template is set for %s but there are no templates", l)
+	}
+
+	// Scripts and the optional n-gram model for detecting the language of queries.
+	for _, s := range lang.Scripts {
+		if _, ok := unicode.Scripts[s]; !ok {
+			return lang, fmt.Errorf("unknown script '%s' for %s. Should be a Unicode script name, eg: Latin", s, l)
+		}
+	}
+	if f := ko.String("lang." + l + ".ngrams_file"); f != "" {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return lang, fmt.Errorf("error loading n-grams file for %s: %v", l, err)
+		}
+		lang.NGrams = data.NewNGrams(strings.Fields(string(b)))
+	}
+
+	return lang, nil
+}
+
+// initSanitizer loads the policy of HTML elements and attributes that are
+// allowed in entry content from a config key (eg: sanitizer). The defaults are
+// used if they're not configured.
+func initSanitizer(ko *koanf.Koanf, key string) (*sanitize.Policy, error) {
+	var elements map[string][]string
+	if ko.Exists(key + ".elements") {
+		if err := ko.Unmarshal(key+".elements", &elements); err != nil {
+			return nil, fmt.Errorf("error loading %s.elements: %v", key, err)
+		}
+	}
+
+	return sanitize.New(elements, ko.Strings(key+".url_schemes")), nil
+}
+
 // initDicts loads language->language dictionary map.
 func initDicts(langs data.LangMap, ko *koanf.Koanf) data.Dicts {
 	var (
@@ -280,6 +664,435 @@ func initDicts(langs data.LangMap, ko *koanf.Koanf) data.Dicts {
 	return out
 }
 
+// initRankings loads the default search ranking config and optional overrides
+// for dictionary pairs.
+func initRankings(langs data.LangMap, ko *koanf.Koanf) data.Rankings {
+	// Defaults.
+	def := data.Ranking{ExactMatch: 100, FTSRank: 1}
+	if err := ko.UnmarshalWithConf("ranking", &def, koanf.UnmarshalConf{Tag: "json"}); err != nil {
+		lo.Fatalf("error loading ranking config: %v", err)
+	}
+
+	out := data.Rankings{"": def}
+
+	// Per dictionary pair overrides in ranking.dicts.$fromLang.$toLang.
+	for _, from := range ko.MapKeys("ranking.dicts") {
+		if _, ok := langs[from]; !ok {
+			lo.Fatalf("unknown language '%s' defined in ranking.dicts config", from)
+		}
+
+		for _, to := range ko.MapKeys("ranking.dicts." + from) {
+			if _, ok := langs[to]; !ok {
+				lo.Fatalf("unknown language '%s' defined in ranking.dicts config", to)
+			}
+
+			// Inherit the unspecified factors from the defaults.
+			r := def
+			if err := ko.UnmarshalWithConf("ranking.dicts."+from+"."+to, &r, koanf.UnmarshalConf{Tag: "json"}); err != nil {
+				lo.Fatalf("error loading ranking config for %s/%s: %v", from, to, err)
+			}
+
+			out[from+"/"+to] = r
+		}
+	}
+
+	return out
+}
+
+// initLicenses loads the optional default license and attribution of the
+// dictionaries and the licenses of specific dictionary pairs.
+func initLicenses(langs data.LangMap, ko *koanf.Koanf) data.Licenses {
+	var def data.License
+	if err := ko.UnmarshalWithConf("license", &def, koanf.UnmarshalConf{Tag: "json"}); err != nil {
+		lo.Fatalf("error loading license config: %v", err)
+	}
+
+	out := data.Licenses{}
+	if def != (data.License{}) {
+		out[""] = def
+	}
+
+	// Per dictionary pair licenses in license.dicts.$fromLang.$toLang. Unlike
+	// rankings, they don't inherit from the default as the sources differ.
+	for _, from := range ko.MapKeys("license.dicts") {
+		if _, ok := langs[from]; !ok {
+			lo.Fatalf("unknown language '%s' defined in license.dicts config", from)
+		}
+
+		for _, to := range ko.MapKeys("license.dicts." + from) {
+			if _, ok := langs[to]; !ok {
+				lo.Fatalf("unknown language '%s' defined in license.dicts config", to)
+			}
+
+			var l data.License
+			if err := ko.UnmarshalWithConf("license.dicts."+from+"."+to, &l, koanf.UnmarshalConf{Tag: "json"}); err != nil {
+				lo.Fatalf("error loading license config for %s/%s: %v", from, to, err)
+			}
+
+			out[from+"/"+to] = l
+		}
+	}
+
+	return out
+}
+
+// initFrequencyBands loads the optional bands of word frequency ranks
+// that are shown with headwords.
+func initFrequencyBands(d *data.Data, ko *koanf.Koanf) {
+	var bands []data.FrequencyBand
+	if err := ko.UnmarshalWithConf("frequency.bands", &bands, koanf.UnmarshalConf{Tag: "json"}); err != nil {
+		lo.Fatalf("error loading frequency bands config: %v", err)
+	}
+	if err := d.SetFrequencyBands(bands); err != nil {
+		lo.Fatalf("error loading frequency bands config: %v", err)
+	}
+}
+
+// initCollations prepares the queries that order the glossaries of languages
+// that have a `collation` in the language's collation.
+func initCollations(d *data.Data, qMap goyesql.Queries, db *sqlx.DB) {
+	queries := make(map[string]string, len(qMap))
+	for name, q := range qMap {
+		queries[name] = q.Query
+	}
+
+	if err := d.PrepareCollations(db, queries); err != nil {
+		lo.Fatalf("error loading collations: %v", err)
+	}
+}
+
+// initTSConfigs creates (or updates) the Postgres text search configurations of
+// languages that have a ts_config.
+func initTSConfigs(d *data.Data, db *sqlx.DB) {
+	for id, l := range d.Langs {
+		if l.TSConfig == nil {
+			continue
+		}
+
+		ok, err := d.SyncTSConfig(db, l.TokenizerName, *l.TSConfig)
+		if err != nil {
+			lo.Fatalf("error creating text search config '%s' for %s: %v", l.TokenizerName, id, err)
+		}
+		if ok {
+			lo.Printf("created text search config '%s' for %s. Reindex the language's existing entries (reindex job) to apply it", l.TokenizerName, id)
+		}
+	}
+}
+
+// initExplain loads the raw search query for explaining searches in the admin.
+func initExplain(d *data.Data, qMap goyesql.Queries, db *sqlx.DB) {
+	q, ok := qMap["search"]
+	if !ok {
+		lo.Fatal("query 'search' not found")
+	}
+
+	if err := d.PrepareExplain(db, map[string]string{"search": q.Query}); err != nil {
+		lo.Fatalf("error loading explain: %v", err)
+	}
+}
+
+// initSpellers loads the optional spelling correctors of languages from their
+// headwords in the DB and optional user dictionary files.
+func initSpellers(d *data.Data, ko *koanf.Koanf) {
+	for id, lang := range d.Langs {
+		if !ko.Bool("lang." + id + ".spellcheck") {
+			continue
+		}
+
+		words, err := getSpellcheckWords(id, d, ko)
+		if err != nil {
+			lo.Fatal(err)
+		}
+
+		lang.Speller = data.NewSpeller(words)
+		d.Langs[id] = lang
+		lo.Printf("loaded %d spellcheck words for %s", len(words), id)
+	}
+}
+
+// initCompounders loads the optional compound word splitters of languages
+// from their headwords in the DB and optional component word files.
+func initCompounders(d *data.Data, ko *koanf.Koanf) {
+	for id, lang := range d.Langs {
+		if !ko.Bool("lang." + id + ".compounds") {
+			continue
+		}
+
+		words, err := getCompoundWords(id, d, ko)
+		if err != nil {
+			lo.Fatal(err)
+		}
+
+		lang.Compounder = data.NewCompounder(words, ko.Int("lang."+id+".compound_min_length"), ko.Strings("lang."+id+".compound_joiners"))
+		d.Langs[id] = lang
+		lo.Printf("loaded %d compound component words for %s", len(words), id)
+	}
+}
+
+// refreshSpellers reloads the known words of the spelling correctors and
+// compound splitters from the headwords in the database every interval so
+// that new and approved entries are suggested. It's a blocking function that
+// should be run as a goroutine.
+func refreshSpellers(d *data.Data, interval time.Duration, ko *koanf.Koanf) {
+	for {
+		time.Sleep(interval)
+
+		for id, lang := range d.Langs {
+			if lang.Speller != nil {
+				words, err := getSpellcheckWords(id, d, ko)
+				if err != nil {
+					lo.Println(err)
+				} else {
+					lang.Speller.Load(words)
+				}
+			}
+
+			if lang.Compounder != nil {
+				words, err := getCompoundWords(id, d, ko)
+				if err != nil {
+					lo.Println(err)
+				} else {
+					lang.Compounder.Load(words)
+				}
+			}
+		}
+	}
+}
+
+// getCompoundWords returns the headwords of a language along with the words
+// in its optional compound components file.
+func getCompoundWords(lang string, d *data.Data, ko *koanf.Koanf) ([]string, error) {
+	words, err := d.GetHeadwords(lang)
+	if err != nil {
+		return nil, fmt.Errorf("error loading headwords for compounds (%s): %v", lang, err)
+	}
+
+	if f := ko.String("lang." + lang + ".compounds_file"); f != "" {
+		lists, err := readWordLists(f)
+		if err != nil {
+			return nil, fmt.Errorf("error loading compounds file for %s: %v", lang, err)
+		}
+		for _, l := range lists {
+			words = append(words, l...)
+		}
+	}
+
+	return words, nil
+}
+
+// getSpellcheckWords returns the headwords of a language along with the words
+// in its optional spellcheck user dictionary.
+func getSpellcheckWords(lang string, d *data.Data, ko *koanf.Koanf) ([]string, error) {
+	words, err := d.GetHeadwords(lang)
+	if err != nil {
+		return nil, fmt.Errorf("error loading headwords for spellcheck (%s): %v", lang, err)
+	}
+
+	// Additional words from a user dictionary.
+	if f := ko.String("lang." + lang + ".spellcheck_file"); f != "" {
+		lists, err := readWordLists(f)
+		if err != nil {
+			return nil, fmt.Errorf("error loading spellcheck file for %s: %v", lang, err)
+		}
+		for _, l := range lists {
+			words = append(words, l...)
+		}
+	}
+
+	return words, nil
+}
+
+// initSearchBackend initializes the optional external search backend.
+func initSearchBackend(d *data.Data, ko *koanf.Koanf) {
+	if !ko.Bool("elasticsearch.enabled") {
+		return
+	}
+
+	var o elastic.Opt
+	if err := ko.Unmarshal("elasticsearch", &o); err != nil {
+		lo.Fatalf("error loading elasticsearch config: %v", err)
+	}
+
+	es, err := elastic.New(o, lo)
+	if err != nil {
+		lo.Fatalf("error initializing elasticsearch: %v", err)
+	}
+	if err := es.Init(); err != nil {
+		lo.Fatalf("error initializing elasticsearch: %v", err)
+	}
+
+	// Keep the index in sync with the DB in the background.
+	go es.Sync(d)
+
+	d.Backend = es
+	lo.Printf("using elasticsearch search backend: %s", o.URL)
+}
+
+// initSemantic initializes the optional semantic search mode.
+func initSemantic(d *data.Data, qMap goyesql.Queries, db *sqlx.DB, ko *koanf.Koanf) {
+	if !ko.Bool("semantic.enabled") {
+		return
+	}
+
+	var o embedding.Opt
+	if err := ko.Unmarshal("semantic", &o); err != nil {
+		lo.Fatalf("error loading semantic config: %v", err)
+	}
+
+	emb, err := embedding.New(o)
+	if err != nil {
+		lo.Fatalf("error initializing embedding provider: %v", err)
+	}
+
+	queries := make(map[string]string, len(qMap))
+	for name, q := range qMap {
+		queries[name] = q.Query
+	}
+
+	if err := d.PrepareSemantic(db, queries, emb, data.SemanticOpt{
+		Model:       o.Model,
+		Dimensions:  ko.Int("semantic.dimensions"),
+		MaxDistance: ko.Float64("semantic.max_distance"),
+	}); err != nil {
+		lo.Fatalf("error initializing semantic search: %v", err)
+	}
+
+	interval := ko.Duration("semantic.sync_interval")
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	batch := ko.Int("semantic.batch_size")
+	if batch < 1 {
+		batch = 100
+	}
+
+	go syncEmbeddings(d, interval, batch)
+	lo.Printf("semantic search enabled with %s (%s)", o.Model, o.URL)
+}
+
+// syncEmbeddings embeds new and changed headwords every interval. It's a
+// blocking function that should be run as a goroutine.
+func syncEmbeddings(d *data.Data, interval time.Duration, batch int) {
+	for {
+		total := 0
+		for {
+			n, err := d.EmbedEntries(batch)
+			if err != nil {
+				lo.Printf("error embedding entries: %v", err)
+				break
+			}
+			if n == 0 {
+				break
+			}
+			total += n
+		}
+
+		if total > 0 {
+			lo.Printf("embedded %d entries", total)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// initMT initializes the machine translation hook.
+func initMT(ko *koanf.Koanf) *mt.MT {
+	var o mt.Opt
+	if err := ko.Unmarshal("mt", &o); err != nil {
+		lo.Fatalf("error loading mt config: %v", err)
+	}
+
+	m, err := mt.New(o)
+	if err != nil {
+		lo.Fatalf("error initializing machine translation: %v", err)
+	}
+
+	lo.Printf("machine translation fallback enabled with %s", o.Name)
+	return m
+}
+
+// initFederation initializes the federated search client.
+func initFederation(ko *koanf.Koanf) *federation.Federation {
+	var o federation.Opt
+	if err := ko.Unmarshal("federation", &o); err != nil {
+		lo.Fatalf("error loading federation config: %v", err)
+	}
+
+	f, err := federation.New(o, lo)
+	if err != nil {
+		lo.Fatalf("error initializing federation: %v", err)
+	}
+
+	lo.Printf("federated search enabled with %d peer(s)", len(o.Peers))
+	return f
+}
+
+// initOIDC initializes OpenID Connect login for the admin.
+func initOIDC(ko *koanf.Koanf) *oidcAuth {
+	var o oidc.Opt
+	if err := ko.Unmarshal("oidc", &o); err != nil {
+		lo.Fatalf("error loading oidc config: %v", err)
+	}
+
+	client := oidc.New(o)
+	if err := client.Init(); err != nil {
+		lo.Fatalf("error initializing oidc: %v", err)
+	}
+
+	out := &oidcAuth{
+		client:     client,
+		roles:      make(map[string][]string),
+		secret:     []byte(ko.String("oidc.session_secret")),
+		sessionTTL: ko.Duration("oidc.session_ttl"),
+	}
+	if out.sessionTTL == 0 {
+		out.sessionTTL = time.Hour * 12
+	}
+
+	for _, r := range roleOrder {
+		out.roles[r] = ko.Strings("oidc.roles." + r)
+	}
+
+	// Without a configured secret, sessions don't survive restarts.
+	if len(out.secret) == 0 {
+		s, err := randomString(32)
+		if err != nil {
+			lo.Fatalf("error generating session secret: %v", err)
+		}
+		out.secret = []byte(s)
+	}
+
+	lo.Printf("oidc login enabled: %s", o.ProviderURL)
+	return out
+}
+
+// readWordLists reads a text file where every line is a comma separated list
+// of words. Empty lines and lines starting with # are ignored.
+func readWordLists(fPath string) ([][]string, error) {
+	b, err := os.ReadFile(fPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var out [][]string
+	for _, ln := range strings.Split(string(b), "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+
+		var words []string
+		for _, w := range strings.Split(ln, ",") {
+			if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+				words = append(words, w)
+			}
+		}
+		out = append(out, words)
+	}
+
+	return out, nil
+}
+
 func generateNewFiles() error {
 	if _, err := os.Stat("config.toml"); !os.IsNotExist(err) {
 		return errors.New("config.toml exists. Remove it to generate a new one")
@@ -289,13 +1102,31 @@ func generateNewFiles() error {
 	// required static assets (.sql, .js files etc.) are loaded.
 	fs := initFS()
 
-	// Generate config file.
+	// Generate config file with a random password.
+	b, err := sampleConfig(fs, newAdminPassword())
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile("config.toml", b, 0644); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sampleConfig returns the sample config with the given admin password.
+func sampleConfig(fs stuffbin.FileSystem, adminPwd string) ([]byte, error) {
 	b, err := fs.Read("config.sample.toml")
 	if err != nil {
-		return fmt.Errorf("error reading sample config (is binary stuffed?): %v", err)
+		return nil, fmt.Errorf("error reading sample config (is binary stuffed?): %v", err)
 	}
 
-	// Inject a random password.
+	return bytes.Replace(b, []byte("dictpress_admin_password"), []byte(adminPwd), -1), nil
+}
+
+// newAdminPassword generates a random admin password.
+func newAdminPassword() string {
 	p := make([]byte, 12)
 	rand.Read(p)
 	pwd := []byte(fmt.Sprintf("%x", p))
@@ -306,11 +1137,5 @@ func generateNewFiles() error {
 		}
 	}
 
-	b = bytes.Replace(b, []byte("dictpress_admin_password"), pwd, -1)
-
-	if err := ioutil.WriteFile("config.toml", b, 0644); err != nil {
-		return err
-	}
-
-	return nil
+	return string(pwd)
 }
@@ -8,7 +8,7 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-func installSchema(ver string, app *App, prompt bool) {
+func installSchema(ver string, app *App, prompt bool) bool {
 	if prompt {
 		fmt.Println("")
 		fmt.Println("** first time installation **")
@@ -25,7 +25,7 @@ func installSchema(ver string, app *App, prompt bool) {
 			}
 			if strings.ToLower(ok) != "y" {
 				fmt.Println("install cancelled.")
-				return
+				return false
 			}
 		}
 	}
@@ -33,12 +33,12 @@ func installSchema(ver string, app *App, prompt bool) {
 	q, err := app.fs.Read("/schema.sql")
 	if err != nil {
 		app.lo.Fatal(err.Error())
-		return
+		return false
 	}
 
 	if _, err := app.db.Exec(string(q)); err != nil {
 		app.lo.Fatal(err.Error())
-		return
+		return false
 	}
 
 	// Insert the current migration version.
@@ -47,6 +47,7 @@ func installSchema(ver string, app *App, prompt bool) {
 	}
 
 	app.lo.Println("successfully installed schema")
+	return true
 }
 
 // recordMigrationVersion inserts the given version (of DB migration) into the
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/importer"
+	"github.com/knadh/koanf/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// Background job types.
+const (
+	jobImport     = "import"
+	jobImportData = "import-data"
+	jobFrequency  = "frequency"
+	jobReverse    = "reverse"
+	jobExportData = "export-data"
+	jobReindex    = "reindex"
+	jobTTS        = "tts"
+	jobReplace    = "replace"
+)
+
+// Number of entries reindexed in one batch by reindex jobs.
+const reindexBatchSize = 1000
+
+// jobOpt represents the background job options.
+type jobOpt struct {
+	Workers  int           `koanf:"workers"`
+	Dir      string        `koanf:"dir"`
+	Interval time.Duration `koanf:"poll_interval"`
+}
+
+// jobParams represents the params of import and export jobs.
+type jobParams struct {
+	// Path of the uploaded file in the jobs directory to import.
+	File string `json:"file,omitempty"`
+
+	// import: csv | wiktextract | cedict | jmdict, with the languages
+	// as in --import-format and --import-langs.
+	// frequency: the language of the word frequency list.
+	// reverse: the headword and definition languages of the dictionary to reverse.
+	// reindex, tts: the languages to reindex or generate audio for (all if empty).
+	// export-data: the optional headword and definition languages to export.
+	Format string   `json:"format,omitempty"`
+	Langs  []string `json:"langs,omitempty"`
+	DryRun bool     `json:"dry_run,omitempty"`
+
+	// import: import the file from the beginning even if a previous import
+	// of it failed midway or finished (see importer.WithCheckpoints).
+	Restart bool `json:"restart,omitempty"`
+
+	// export-data: optional tags, status, and updated since date of the
+	// headwords to export (see makeExportFilter).
+	// replace: optional tags of the definitions to replace in.
+	Tags   []string `json:"tags,omitempty"`
+	Status string   `json:"status,omitempty"`
+	Since  string   `json:"since,omitempty"`
+
+	// replace: the text, or regular expression with Regex, to find in the
+	// content of definitions in Langs (all if empty), and its replacement.
+	Find    string `json:"find,omitempty"`
+	Replace string `json:"replace,omitempty"`
+	Regex   bool   `json:"regex,omitempty"`
+
+	// ID of the job and the user who created it, for the audit log.
+	jobID int
+	user  string
+}
+
+// jobRunner runs a job and returns its result (eg: the name of an exported file).
+// Runners should stop when ctx is cancelled.
+type jobRunner func(ctx context.Context, p jobParams, l *log.Logger, app *App) (string, error)
+
+var jobRunners = map[string]jobRunner{
+	jobImport:     runImportJob,
+	jobImportData: runImportDataJob,
+	jobFrequency:  runFrequencyJob,
+	jobReverse:    runReverseJob,
+	jobExportData: runExportDataJob,
+	jobReindex:    runReindexJob,
+	jobTTS:        runTTSJob,
+	jobReplace:    runReplaceJob,
+}
+
+// jobs represents a page of background jobs.
+type jobs struct {
+	Jobs       []data.Job `json:"jobs"`
+	Page       int        `json:"page"`
+	PerPage    int        `json:"per_page"`
+	TotalPages int        `json:"total_pages"`
+	Total      int        `json:"total"`
+}
+
+func (j *jobs) pageMeta() *apiMeta {
+	return &apiMeta{Page: j.Page, PerPage: j.PerPage, TotalPages: j.TotalPages, Total: j.Total}
+}
+
+// jobLog is a writer that appends job log lines to the job in the DB.
+type jobLog struct {
+	id  int
+	app *App
+}
+
+func (j *jobLog) Write(b []byte) (int, error) {
+	if err := j.app.data.AppendJobLog(j.id, string(b)); err != nil {
+		j.app.lo.Printf("error writing log of job #%d: %v", j.id, err)
+	}
+	return len(b), nil
+}
+
+// initJobOpt loads the background job options.
+func initJobOpt(ko *koanf.Koanf) jobOpt {
+	var o jobOpt
+	if err := ko.Unmarshal("jobs", &o); err != nil {
+		lo.Fatalf("error loading jobs config: %v", err)
+	}
+	if o.Workers < 0 {
+		o.Workers = 0
+	}
+	if o.Dir == "" {
+		o.Dir = "jobs"
+	}
+	if o.Interval < time.Second {
+		o.Interval = time.Second * 2
+	}
+
+	if err := os.MkdirAll(o.Dir, 0755); err != nil {
+		lo.Fatalf("error creating jobs directory: %v", err)
+	}
+
+	return o
+}
+
+// runJobWorkers starts workers that pick queued jobs from the DB and run them.
+func runJobWorkers(app *App) {
+	for i := 0; i < app.consts.Jobs.Workers; i++ {
+		go func() {
+			for {
+				j, err := app.data.NextJob()
+				if err != nil {
+					if err != sql.ErrNoRows {
+						app.lo.Printf("error fetching queued jobs: %v", err)
+					}
+					time.Sleep(app.consts.Jobs.Interval)
+					continue
+				}
+
+				runJob(j, app)
+			}
+		}()
+	}
+}
+
+// runJob runs a job, recording its log and final status in the DB. The job
+// is stopped if it's cancelled (in the DB) while it's running.
+func runJob(j data.Job, app *App) {
+	var (
+		l           = log.New(io.MultiWriter(app.lo.Writer(), &jobLog{id: j.ID, app: app}), fmt.Sprintf("job #%d: ", j.ID), log.Ldate|log.Ltime)
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan bool)
+	)
+	defer cancel()
+
+	// Watch for cancellation.
+	go func() {
+		t := time.NewTicker(app.consts.Jobs.Interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if s, err := app.data.GetJob(j.ID); err == nil && s.Status == data.JobCancelled {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	var (
+		p      jobParams
+		result string
+		err    = json.Unmarshal(j.Params, &p)
+	)
+	p.jobID, p.user = j.ID, j.CreatedBy
+	if err == nil {
+		if fn, ok := jobRunners[j.Type]; ok {
+			l.Printf("started %s", j.Type)
+			result, err = fn(ctx, p, l, app)
+		} else {
+			err = fmt.Errorf("unknown job type '%s'", j.Type)
+		}
+	}
+	close(done)
+
+	// Uploaded files are removed once they're imported.
+	if p.File != "" {
+		os.Remove(filepath.Join(app.consts.Jobs.Dir, filepath.Base(p.File)))
+	}
+
+	status := data.JobDone
+	switch {
+	case ctx.Err() != nil:
+		status = data.JobCancelled
+		l.Printf("cancelled")
+	case err != nil:
+		status = data.JobFailed
+		l.Printf("error: %v", err)
+	default:
+		l.Printf("finished")
+	}
+
+	if err := app.data.FinishJob(j.ID, status, result); err != nil {
+		app.lo.Printf("error updating job #%d: %v", j.ID, err)
+	}
+}
+
+func runImportJob(ctx context.Context, p jobParams, l *log.Logger, app *App) (string, error) {
+	var (
+		fPath = filepath.Join(app.consts.Jobs.Dir, filepath.Base(p.File))
+		imp   = importer.New(app.data.Langs, app.queries.ImportStaged, app.db, p.DryRun, l).WithContext(ctx).
+			WithCheckpoints(app.queries.GetCheckpoint, app.queries.UpsertCheckpoint, p.Restart)
+	)
+
+	switch p.Format {
+	case "csv", "":
+		return "", imp.Import(fPath)
+	case "wiktextract":
+		return "", imp.ImportWiktextract(fPath, p.Langs)
+	case "cedict", "jmdict":
+		if len(p.Langs) != 2 {
+			return "", fmt.Errorf("langs should have the headword and definition languages")
+		}
+		if p.Format == "cedict" {
+			return "", imp.ImportCEDICT(fPath, p.Langs[0], p.Langs[1])
+		}
+		return "", imp.ImportJMdict(fPath, p.Langs[0], p.Langs[1])
+	}
+
+	return "", fmt.Errorf("unknown import format '%s'", p.Format)
+}
+
+func runImportDataJob(ctx context.Context, p jobParams, l *log.Logger, app *App) (string, error) {
+	return "", importData(ctx, filepath.Join(app.consts.Jobs.Dir, filepath.Base(p.File)), p.DryRun, app, l)
+}
+
+func runFrequencyJob(ctx context.Context, p jobParams, l *log.Logger, app *App) (string, error) {
+	if len(p.Langs) != 1 {
+		return "", fmt.Errorf("langs should have the language of the frequency list")
+	}
+
+	n, err := importFrequency(ctx, filepath.Join(app.consts.Jobs.Dir, filepath.Base(p.File)), p.Langs[0], p.DryRun, app, l)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d entries", n), nil
+}
+
+func runReverseJob(ctx context.Context, p jobParams, l *log.Logger, app *App) (string, error) {
+	if len(p.Langs) != 2 {
+		return "", fmt.Errorf("langs should have the headword and definition languages")
+	}
+
+	return "", generateReverse(ctx, p.Langs[0], p.Langs[1], p.DryRun, app, l)
+}
+
+func runExportDataJob(ctx context.Context, p jobParams, l *log.Logger, app *App) (string, error) {
+	f, err := makeExportFilter(p.Langs, p.Tags, p.Status, p.Since, app)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("export-%s.ndjson", time.Now().Format("2006-01-02-150405"))
+	fPath := filepath.Join(app.consts.Jobs.Dir, name)
+
+	if err := exportData(ctx, fPath, f, app, l); err != nil {
+		os.Remove(fPath)
+		return "", err
+	}
+
+	return name, nil
+}
+
+// runReindexJob re-normalizes and re-tokenizes the entries of the given
+// languages, or all languages.
+func runReindexJob(ctx context.Context, p jobParams, l *log.Logger, app *App) (string, error) {
+	langs := p.Langs
+	if len(langs) == 0 {
+		for id := range app.data.Langs {
+			langs = append(langs, id)
+		}
+		sort.Strings(langs)
+	}
+
+	total := 0
+	for _, lang := range langs {
+		lastID, n := 0, 0
+		for {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+
+			id, num, err := app.data.ReindexEntries(lang, lastID, reindexBatchSize)
+			if err != nil {
+				return "", fmt.Errorf("error reindexing %s: %v", lang, err)
+			}
+			if num == 0 {
+				break
+			}
+			lastID, n = id, n+num
+		}
+
+		l.Printf("reindexed %d entries in %s", n, lang)
+		total += n
+	}
+
+	return fmt.Sprintf("%d entries", total), nil
+}
+
+// handleGetJobs returns background jobs, optionally filtered by ?status.
+func handleGetJobs(c echo.Context) error {
+	var (
+		app    = c.Get("app").(*App)
+		status = c.QueryParam("status")
+		pg     = app.resultsPg.NewFromURL(c.Request().URL.Query())
+	)
+
+	switch status {
+	case "", data.JobQueued, data.JobRunning, data.JobDone, data.JobFailed, data.JobCancelled:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `status`.")
+	}
+
+	res, total, err := app.data.GetJobs(status, pg.Offset, pg.Limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching jobs: %v", err))
+	}
+
+	pg.SetTotal(total)
+	return c.JSON(http.StatusOK, okResp{&jobs{res, pg.Page, pg.PerPage, pg.TotalPages, total}})
+}
+
+// handleGetJob returns a background job with its log.
+func handleGetJob(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	out, err := app.data.GetJob(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "job not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching job: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleInsertJob queues a background job. Import jobs take the file to import
+// as a multipart `file` upload. Job params are a JSON object in the `params`
+// field.
+func handleInsertJob(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		typ = c.FormValue("type")
+	)
+
+	if _, ok := jobRunners[typ]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown job `type`.")
+	}
+
+	var p jobParams
+	if v := c.FormValue("params"); v != "" {
+		if err := json.Unmarshal([]byte(v), &p); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid `params`: %v", err))
+		}
+	}
+
+	// Imports can be dry runs that validate and count the rows without saving them.
+	if isDryRun(c) {
+		if typ != jobImport && typ != jobImportData && typ != jobFrequency && typ != jobReverse && typ != jobReplace {
+			return echo.NewHTTPError(http.StatusBadRequest, "only import, reverse, and replace jobs can be dry runs.")
+		}
+		p.DryRun = true
+	}
+
+	switch typ {
+	case jobTTS:
+		if app.tts == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "tts is not enabled.")
+		}
+		fallthrough
+
+	case jobReindex:
+		for _, l := range p.Langs {
+			if _, ok := app.data.Langs[l]; !ok {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown language `%s`.", l))
+			}
+		}
+
+	case jobImport:
+		switch p.Format {
+		case "", "csv", "wiktextract", "cedict", "jmdict":
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown import `format`.")
+		}
+		for _, l := range p.Langs {
+			if _, ok := app.data.Langs[l]; !ok && p.Format != "wiktextract" {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown language `%s`.", l))
+			}
+		}
+		fallthrough
+
+	case jobReverse:
+		if len(p.Langs) != 2 {
+			return echo.NewHTTPError(http.StatusBadRequest, "`langs` should have the headword and definition languages.")
+		}
+		for _, l := range p.Langs {
+			if _, ok := app.data.Langs[l]; !ok {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown language `%s`.", l))
+			}
+		}
+
+	case jobFrequency:
+		if len(p.Langs) != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "`langs` should have the language of the frequency list.")
+		}
+		if _, ok := app.data.Langs[p.Langs[0]]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown language `%s`.", p.Langs[0]))
+		}
+		name, err := saveJobFile(c, app)
+		if err != nil {
+			return err
+		}
+		p.File = name
+
+	case jobReplace:
+		if _, err := newReplacer(p.Find, p.Replace, p.Regex); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if _, err := makeReplaceFilter(p.Langs, p.Tags, app); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+	case jobImportData:
+		name, err := saveJobFile(c, app)
+		if err != nil {
+			return err
+		}
+		p.File = name
+	}
+
+	username, _ := c.Get(authUser).(string)
+
+	params, _ := json.Marshal(p)
+	out, err := app.data.InsertJob(typ, params, username)
+	if err != nil {
+		if p.File != "" {
+			os.Remove(filepath.Join(app.consts.Jobs.Dir, p.File))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error creating job: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCancelJob cancels a queued or running job.
+func handleCancelJob(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if err := app.data.CancelJob(id); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusBadRequest, "job not found or has already finished")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error cancelling job: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleGetJobFile downloads the file exported by a finished export job.
+func handleGetJobFile(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	j, err := app.data.GetJob(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "job not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching job: %v", err))
+	}
+
+	if j.Type != jobExportData || j.Status != data.JobDone || j.Result == "" {
+		return echo.NewHTTPError(http.StatusNotFound, "job has no file")
+	}
+
+	return c.Attachment(filepath.Join(app.consts.Jobs.Dir, filepath.Base(j.Result)), j.Result)
+}
+
+// saveJobFile saves the uploaded `file` in a request to the jobs directory
+// with a random name and returns the name.
+func saveJobFile(c echo.Context, app *App) (string, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "no `file` given.")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error reading file: %v", err))
+	}
+	defer src.Close()
+
+	rnd := make([]byte, 16)
+	if _, err := rand.Read(rnd); err != nil {
+		return "", echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	name := "upload-" + hex.EncodeToString(rnd)
+
+	dst, err := os.Create(filepath.Join(app.consts.Jobs.Dir, name))
+	if err != nil {
+		app.lo.Printf("error saving job file: %v", err)
+		return "", echo.NewHTTPError(http.StatusInternalServerError, "error saving file")
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(dst.Name())
+		app.lo.Printf("error saving job file: %v", err)
+		return "", echo.NewHTTPError(http.StatusInternalServerError, "error saving file")
+	}
+
+	return name, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+)
+
+// Max number of definitions of an entry to put in its JSON-LD description.
+const ldMaxDefs = 5
+
+// ldTerm represents a schema.org DefinedTerm.
+type ldTerm struct {
+	Context          string     `json:"@context,omitempty"`
+	Type             string     `json:"@type"`
+	Name             string     `json:"name"`
+	Description      string     `json:"description,omitempty"`
+	URL              string     `json:"url,omitempty"`
+	InDefinedTermSet *ldTermSet `json:"inDefinedTermSet,omitempty"`
+}
+
+// ldTermSet represents a schema.org DefinedTermSet.
+type ldTermSet struct {
+	Context        string   `json:"@context,omitempty"`
+	Type           string   `json:"@type"`
+	Name           string   `json:"name"`
+	URL            string   `json:"url,omitempty"`
+	HasDefinedTerm []ldTerm `json:"hasDefinedTerm,omitempty"`
+}
+
+// makeSearchJSONLD returns the DefinedTermSet of a dictionary pair with the
+// entries in search results as its terms.
+func makeSearchJSONLD(res *results, app *App) *ldTermSet {
+	if len(res.Entries) == 0 {
+		return nil
+	}
+
+	out := newLDTermSet(res.Query.FromLang, res.Query.ToLang, app)
+	for _, e := range res.Entries {
+		out.HasDefinedTerm = append(out.HasDefinedTerm, newLDTerm(e, res.Query.FromLang, res.Query.ToLang, app))
+	}
+
+	return out
+}
+
+// makeEntryJSONLD returns the DefinedTerm of an entry in its language's term set.
+func makeEntryJSONLD(e data.Entry, app *App) *ldTerm {
+	t := newLDTerm(e, e.Lang, "", app)
+	t.Context = "https://schema.org"
+	t.InDefinedTermSet = newLDTermSet(e.Lang, "", app)
+	t.InDefinedTermSet.Context = ""
+
+	return &t
+}
+
+// makeGlossaryJSONLD returns the DefinedTermSet of a dictionary pair with the
+// glossary words as its terms.
+func makeGlossaryJSONLD(g *glossary, app *App) *ldTermSet {
+	if len(g.Words) == 0 {
+		return nil
+	}
+
+	out := newLDTermSet(g.FromLang, g.ToLang, app)
+	for _, w := range g.Words {
+		out.HasDefinedTerm = append(out.HasDefinedTerm, ldTerm{
+			Type: "DefinedTerm",
+			Name: w.Content,
+			URL:  ldSearchURL(w.Content, g.FromLang, g.ToLang, app),
+		})
+	}
+
+	return out
+}
+
+// newLDTermSet returns the DefinedTermSet of a dictionary pair. If toLang is
+// empty, it's the set of all words in fromLang.
+func newLDTermSet(fromLang, toLang string, app *App) *ldTermSet {
+	name := app.data.Langs[fromLang].Name
+	if toLang != "" {
+		name += " - " + app.data.Langs[toLang].Name
+	}
+
+	u := app.consts.RootURL
+	if toLang != "" {
+		u = fmt.Sprintf("%s/glossary/%s/%s/*", app.consts.RootURL, fromLang, toLang)
+	}
+
+	return &ldTermSet{
+		Context: "https://schema.org",
+		Type:    "DefinedTermSet",
+		Name:    name + " dictionary",
+		URL:     u,
+	}
+}
+
+// newLDTerm returns the DefinedTerm of an entry with its definitions as the description.
+func newLDTerm(e data.Entry, fromLang, toLang string, app *App) ldTerm {
+	var defs []string
+	for _, d := range e.Relations {
+		if len(defs) == ldMaxDefs {
+			break
+		}
+		defs = append(defs, d.Content)
+	}
+
+	// Link to the entry's permalink if it has one.
+	u := ldSearchURL(e.Content, fromLang, toLang, app)
+	if e.Slug != "" {
+		u = fmt.Sprintf("%s/word/%s/%s", app.consts.RootURL, e.Lang, url.PathEscape(e.Slug))
+	}
+
+	return ldTerm{
+		Type:        "DefinedTerm",
+		Name:        e.Content,
+		Description: strings.Join(defs, "; "),
+		URL:         u,
+	}
+}
+
+// ldSearchURL returns the search page URL of a word.
+func ldSearchURL(word, fromLang, toLang string, app *App) string {
+	if toLang == "" {
+		toLang = "*"
+	}
+
+	return fmt.Sprintf("%s/dictionary/%s/%s/%s", app.consts.RootURL, fromLang, toLang, escapeWordURL(word))
+}
+
+// renderJSONLD is the JSONLD template function that renders a JSON-LD
+// structure in a <script> tag.
+func renderJSONLD(v interface{}) (template.HTML, error) {
+	// Marshal escapes <, >, and & which makes the JSON safe to be put in <script>.
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(`<script type="application/ld+json">` + string(b) + `</script>`), nil
+}
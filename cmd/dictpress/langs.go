@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/koanf/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// Max time that in-flight requests get to finish when the server restarts
+// to apply language changes.
+const restartTimeout = 10 * time.Second
+
+var reLangID = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// langs represents the languages managed from the admin along with the IDs
+// of the languages defined in the config file.
+type langs struct {
+	Langs  []data.LangConfig `json:"langs"`
+	Config []string          `json:"config"`
+}
+
+// initDBLangs loads the languages managed from the admin into the config
+// (lang.* and app.dicts) so that they're loaded along with the languages in
+// the config file. It returns the IDs of the languages in the config file.
+func initDBLangs(q *data.Queries, ko *koanf.Koanf) map[string]bool {
+	inConfig := make(map[string]bool)
+	for _, id := range ko.MapKeys("lang") {
+		inConfig[id] = true
+	}
+
+	var rows []data.LangConfig
+	if err := q.GetLangs.Select(&rows); err != nil {
+		lo.Fatalf("error loading languages from the DB: %v", err)
+	}
+	if len(rows) == 0 {
+		return inConfig
+	}
+
+	var dicts [][]string
+	if err := ko.Unmarshal("app.dicts", &dicts); err != nil {
+		lo.Fatalf("error unmarshalling app.dict in config: %v", err)
+	}
+
+	for _, l := range rows {
+		if err := setLangConfig(l, ko); err != nil {
+			lo.Fatalf("error loading language %s from the DB: %v", l.ID, err)
+		}
+
+		for _, to := range l.Dicts {
+			if !hasDict(dicts, l.ID, to) {
+				dicts = append(dicts, []string{l.ID, to})
+			}
+		}
+		lo.Printf("loaded language %s from the DB", l.ID)
+	}
+
+	if err := ko.Set("app.dicts", dicts); err != nil {
+		lo.Fatalf("error loading dictionaries from the DB: %v", err)
+	}
+
+	return inConfig
+}
+
+// setLangConfig sets the config of a language (lang.$id) replacing any
+// existing config of the language.
+func setLangConfig(l data.LangConfig, ko *koanf.Koanf) error {
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(l.Config, &cfg); err != nil {
+		return err
+	}
+
+	ko.Delete("lang." + l.ID)
+	return ko.Set("lang."+l.ID, cfg)
+}
+
+// hasDict checks whether a from => to dictionary pair is in the list of pairs.
+func hasDict(dicts [][]string, from, to string) bool {
+	for _, d := range dicts {
+		if len(d) == 2 && d[0] == from && d[1] == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleGetLangs returns the languages managed from the admin.
+func handleGetLangs(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	out, err := app.data.GetLangs()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching languages: %v", err))
+	}
+
+	cfg := make([]string, 0, len(app.configLangs))
+	for id := range app.configLangs {
+		cfg = append(cfg, id)
+	}
+	sort.Strings(cfg)
+
+	return c.JSON(http.StatusOK, okResp{langs{out, cfg}})
+}
+
+// handleUpsertLang creates or updates a language and restarts the server
+// to load it.
+func handleUpsertLang(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	var l data.LangConfig
+	if err := c.Bind(&l); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+	if id := c.Param("id"); id != "" {
+		l.ID = id
+	}
+
+	if !reLangID.MatchString(l.ID) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `id`. Should be lowercase letters, numbers, - and _.")
+	}
+	if len(l.Config) == 0 {
+		l.Config = json.RawMessage("{}")
+	}
+	if l.Dicts == nil {
+		l.Dicts = []string{}
+	}
+
+	// Validate the config by loading the language as it's loaded on startup.
+	k := koanf.New(".")
+	if err := setLangConfig(l, k); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid `config`: %v", err))
+	}
+	lang, err := loadLang(l.ID, k, initTokenizers())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	all := data.LangMap{l.ID: lang}
+	for id, lg := range app.data.Langs {
+		if id != l.ID {
+			all[id] = lg
+		}
+	}
+	if err := lang.Templates.ValidateDefs(all); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error in templates config: %v", err))
+	}
+	for _, to := range l.Dicts {
+		if _, ok := app.data.Langs[to]; !ok && to != l.ID {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown dictionary language `%s`.", to))
+		}
+	}
+
+	out, err := app.data.UpsertLang(l)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error saving language: %v", err))
+	}
+
+	restartApp(app)
+	app.notify(clusterLangs)
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteLang deletes a language and restarts the server. Languages that
+// still have entries can't be deleted unless they're also in the config file.
+func handleDeleteLang(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		id  = c.Param("id")
+	)
+
+	// Languages that are in dictionaries other than their own (eg: in app.dicts
+	// or the dictionaries of other languages) can't be deleted as the
+	// dictionaries would be left with an unknown language.
+	if !app.configLangs[id] {
+		rows, err := app.data.GetLangs()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error fetching languages: %v", err))
+		}
+
+		own := map[string]bool{}
+		for _, l := range rows {
+			if l.ID == id {
+				for _, to := range l.Dicts {
+					own[to] = true
+				}
+			}
+		}
+
+		for _, d := range app.data.Dicts {
+			if d[0].ID == id && own[d[1].ID] || d[0].ID != id && d[1].ID != id {
+				continue
+			}
+			return echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("language is in the %s => %s dictionary. Remove the dictionary first.", d[0].ID, d[1].ID))
+		}
+	}
+
+	if err := app.data.DeleteLang(id, app.configLangs[id]); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusBadRequest, "language not found or it has entries")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error deleting language: %v", err))
+	}
+
+	restartApp(app)
+	app.notify(clusterLangs)
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// restartApp signals the server to restart (in the background) to apply changes.
+func restartApp(app *App) {
+	select {
+	case app.chRestart <- struct{}{}:
+	default:
+	}
+}
+
+// awaitRestart waits for a restart signal, and once running background jobs
+// are done, gracefully shuts the server down and replaces the process with
+// a new instance of itself that reloads the config and the languages.
+// It's a blocking function that should be run as a goroutine.
+func awaitRestart(srv *echo.Echo, app *App) {
+	// Processes can't be replaced in-place on Windows, where the server has
+	// to be restarted manually to apply the changes.
+	if runtime.GOOS == "windows" {
+		for range app.chRestart {
+			app.lo.Println("languages have changed. Restart the server to apply the changes")
+		}
+		return
+	}
+
+	<-app.chRestart
+
+	for {
+		_, n, err := app.data.GetJobs(data.JobRunning, 0, 1)
+		if err != nil || n == 0 {
+			break
+		}
+		app.lo.Printf("waiting for %d running job(s) to finish before restarting", n)
+		time.Sleep(app.consts.Jobs.Interval)
+	}
+
+	app.lo.Println("restarting to apply language changes")
+	ctx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		app.lo.Printf("error shutting down server: %v", err)
+	}
+	app.views.flush(app)
+
+	bin, err := os.Executable()
+	if err != nil {
+		bin = os.Args[0]
+	}
+	if err := syscall.Exec(bin, os.Args, os.Environ()); err != nil {
+		app.lo.Fatalf("error restarting: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+)
+
+// Prefix of app.address for Unix domain sockets, eg: unix:/run/dictpress/dictpress.sock.
+const unixSocketPrefix = "unix:"
+
+// First file descriptor passed by systemd socket activation (SD_LISTEN_FDS_START).
+const systemdFDStart = 3
+
+// systemdSocket is the file of the socket inherited from systemd. It's kept
+// open (and isn't closed on exec) so that it's inherited by the new process on
+// in-place restarts and connections are queued by the kernel in the meantime.
+var systemdSocket *os.File
+
+// initListener returns the listener of the HTTP server for a systemd-activated
+// socket or a Unix domain socket in app.address, and a description of it. It
+// returns a nil listener for TCP addresses, which the server listens on itself.
+func initListener(ko *koanf.Koanf) (net.Listener, string, error) {
+	// systemd socket activation. LISTEN_PID is the PID of this process,
+	// which doesn't change on in-place restarts (exec).
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid == os.Getpid() {
+		if n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS")); n > 0 {
+			if n > 1 {
+				lo.Printf("systemd passed %d sockets. Using the first one", n)
+			}
+			if systemdSocket == nil {
+				systemdSocket = os.NewFile(systemdFDStart, "systemd-socket")
+			}
+
+			l, err := net.FileListener(systemdSocket)
+			if err != nil {
+				return nil, "", fmt.Errorf("error using the systemd socket: %v", err)
+			}
+			return l, "systemd socket " + l.Addr().String(), nil
+		}
+	}
+
+	addr := ko.MustString("app.address")
+	if !strings.HasPrefix(addr, unixSocketPrefix) {
+		return nil, addr, nil
+	}
+
+	// Unix domain socket. A stale socket file left behind by a crash is removed.
+	path := strings.TrimPrefix(addr, unixSocketPrefix)
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, "", fmt.Errorf("error removing stale socket %s: %v", path, err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listening on socket %s: %v", path, err)
+	}
+
+	mode := ko.String("app.socket_mode")
+	if mode == "" {
+		mode = "0660"
+	}
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		l.Close()
+		return nil, "", fmt.Errorf("invalid app.socket_mode '%s'. Should be octal, eg: 0660", mode)
+	}
+	if err := os.Chmod(path, os.FileMode(m)); err != nil {
+		l.Close()
+		return nil, "", fmt.Errorf("error setting socket permissions: %v", err)
+	}
+
+	return l, "socket " + path, nil
+}
+
+// newTLSListener returns a TLS listener with HTTP/2 over a socket listener.
+func newTLSListener(l net.Listener, certFile, keyFile string) (net.Listener, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading TLS certificate: %v", err)
+	}
+
+	return tls.NewListener(l, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}), nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+// Page type of public word list pages.
+const pageList = "list"
+
+// Built-in HTML page of a word list that's embedded on other sites in an <iframe>.
+var listEmbedTpl = template.Must(template.New("embed").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .List.Name }}</title>
+<style>
+body { font-family: sans-serif; font-size: 15px; margin: 0; padding: 10px 15px; color: #333; }
+h1 { font-size: 1.2em; margin: 0 0 5px 0; }
+p { margin: 0 0 10px 0; color: #666; }
+ul { list-style-type: none; margin: 0; padding: 0; }
+li { padding: 6px 0; border-bottom: 1px solid #eee; }
+a { color: #0055d4; text-decoration: none; }
+small { color: #666; }
+footer { margin-top: 10px; font-size: 0.85em; }
+</style>
+</head>
+<body>
+<h1><a href="{{ .URL }}" target="_blank" rel="noopener">{{ .List.Name }}</a></h1>
+{{ if .List.Description }}<p>{{ .List.Description }}</p>{{ end }}
+<ul>
+{{ range .List.Entries }}
+<li>
+	<a href="{{ index $.Words .GUID }}" target="_blank" rel="noopener"><strong>{{ .Content }}</strong></a>
+	<small>{{ range $i, $r := .Relations }}{{ if $i }}; {{ end }}{{ $r.Content }}{{ end }}</small>
+</li>
+{{ end }}
+</ul>
+<footer><a href="{{ .RootURL }}" target="_blank" rel="noopener">{{ .RootURL }}</a></footer>
+</body>
+</html>
+`))
+
+// wordLists represents a page of public word lists.
+type wordLists struct {
+	Lists      []data.WordList `json:"lists"`
+	Page       int             `json:"page"`
+	PerPage    int             `json:"per_page"`
+	TotalPages int             `json:"total_pages"`
+	Total      int             `json:"total"`
+}
+
+func (w *wordLists) pageMeta() *apiMeta {
+	return &apiMeta{Page: w.Page, PerPage: w.PerPage, TotalPages: w.TotalPages, Total: w.Total}
+}
+
+// handleGetPublicWordLists returns paginated public word lists, optionally
+// only the featured ones (?featured=true).
+func handleGetPublicWordLists(c echo.Context) error {
+	var (
+		app         = c.Get("app").(*App)
+		featured, _ = strconv.ParseBool(c.QueryParam("featured"))
+		pg          = app.resultsPg.NewFromURL(c.Request().URL.Query())
+	)
+
+	res, total, err := app.data.GetPublicWordLists(featured, pg.Offset, pg.Limit)
+	if err != nil {
+		app.lo.Printf("error fetching word lists: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching word lists")
+	}
+
+	pg.SetTotal(total)
+	return c.JSON(http.StatusOK, okResp{&wordLists{res, pg.Page, pg.PerPage, pg.TotalPages, total}})
+}
+
+// handleGetPublicWordList returns a public word list with its entries and
+// their definitions as JSON, or exports it as CSV or Anki flashcards (?format).
+func handleGetPublicWordList(c echo.Context) error {
+	var (
+		app    = c.Get("app").(*App)
+		format = c.QueryParam("format")
+	)
+
+	switch format {
+	case "", "json", "csv":
+	case "anki":
+		if app.ankiTpls == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "anki export is not enabled")
+		}
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `format`. Should be json|csv|anki")
+	}
+
+	l, err := getPublicWordList(c.Param("slug"), app)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "csv":
+		b, err := makeWordListCSV(l)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error exporting list: %v", err))
+		}
+
+		c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, l.Slug.String))
+		return c.Blob(http.StatusOK, "text/csv; charset=utf-8", b)
+
+	case "anki":
+		b, n, err := makeAnkiCards(l.Entries, l.Name, app.data.GetLicense("", ""), app.ankiTpls[ankiDefaultTpl])
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error rendering card: %v", err))
+		}
+
+		c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.txt"`, l.Slug.String))
+		c.Response().Header().Set("X-Total-Count", strconv.Itoa(n))
+		return c.Blob(http.StatusOK, "text/plain; charset=utf-8", b)
+	}
+
+	return c.JSON(http.StatusOK, okResp{l})
+}
+
+// handleWordListPage renders the page of a public word list with the theme's
+// optional `list` template.
+func handleWordListPage(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	if app.theme(c).tpl.Lookup(pageList) == nil {
+		return renderError(c, http.StatusNotFound, "Page not found.")
+	}
+
+	l, err := getPublicWordList(c.Param("slug"), app)
+	if err != nil {
+		code, msg := http.StatusInternalServerError, "Error fetching list."
+		if e, ok := err.(*echo.HTTPError); ok && e.Code == http.StatusNotFound {
+			code, msg = http.StatusNotFound, "List not found."
+		}
+
+		return renderError(c, code, msg)
+	}
+
+	return c.Render(http.StatusOK, pageList, pageTpl{
+		PageType:    pageList,
+		Title:       l.Name,
+		Description: l.Description,
+		WordList:    &l,
+	})
+}
+
+// handleWordListEmbed renders a minimal, built-in HTML page of a public word
+// list that can be embedded on other sites in an <iframe>.
+func handleWordListEmbed(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	l, err := getPublicWordList(c.Param("slug"), app)
+	if err != nil {
+		return err
+	}
+
+	// Word page URLs of the entries.
+	words := make(map[string]string, len(l.Entries))
+	for _, e := range l.Entries {
+		words[e.GUID] = fmt.Sprintf("%s/word/%s/%s", app.consts.RootURL, e.Lang, url.PathEscape(e.Slug))
+	}
+
+	var b bytes.Buffer
+	if err := listEmbedTpl.Execute(&b, map[string]interface{}{
+		"List":    l,
+		"Words":   words,
+		"URL":     app.consts.RootURL + "/lists/" + url.PathEscape(l.Slug.String),
+		"RootURL": app.consts.RootURL,
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error rendering list: %v", err))
+	}
+
+	// Allow the page to be framed by any site.
+	h := c.Response().Header()
+	h.Del("X-Frame-Options")
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors *")
+
+	return c.HTMLBlob(http.StatusOK, b.Bytes())
+}
+
+// handleUpdateWordListFeatured features or unfeatures a public word list on the site.
+func handleUpdateWordListFeatured(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	var req struct {
+		Featured bool `json:"featured"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	if err := app.data.UpdateWordListFeatured(id, req.Featured); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "public word list not found")
+		}
+
+		app.lo.Printf("error updating word list: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error updating word list")
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// getPublicWordList returns a public word list by its slug with its enabled
+// entries and their definitions.
+func getPublicWordList(slug string, app *App) (data.WordList, error) {
+	l, err := app.data.GetPublicWordList(slug)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return l, echo.NewHTTPError(http.StatusNotFound, "list not found")
+		}
+
+		app.lo.Printf("error fetching word list: %v", err)
+		return l, echo.NewHTTPError(http.StatusInternalServerError, "error fetching list")
+	}
+
+	entries, err := app.data.GetWordListEntries(l.ID)
+	if err != nil {
+		app.lo.Printf("error fetching word list entries: %v", err)
+		return l, echo.NewHTTPError(http.StatusInternalServerError, "error fetching list")
+	}
+
+	if err := app.data.SearchAndLoadRelations(entries, data.Query{Status: data.StatusEnabled}); err != nil {
+		app.lo.Printf("error fetching word list definitions: %v", err)
+		return l, echo.NewHTTPError(http.StatusInternalServerError, "error fetching list")
+	}
+	hideIDs(entries)
+
+	l.Entries = entries
+	return l, nil
+}
+
+// makeWordListCSV returns the entries of a word list as CSV with a header row.
+// Phones and tags are separated by | and definitions by ; in their columns.
+func makeWordListCSV(l data.WordList) ([]byte, error) {
+	var (
+		b bytes.Buffer
+		w = csv.NewWriter(&b)
+	)
+
+	w.Write([]string{"content", "lang", "phones", "definitions", "tags"})
+	for _, e := range l.Entries {
+		defs := make([]string, 0, len(e.Relations))
+		for _, r := range e.Relations {
+			defs = append(defs, r.Content)
+		}
+
+		w.Write([]string{e.Content, e.Lang, strings.Join(e.Phones, "|"), strings.Join(defs, "; "), strings.Join(e.Tags, "|")})
+	}
+	w.Flush()
+
+	return b.Bytes(), w.Error()
+}
@@ -1,16 +1,21 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"html/template"
 	"log"
+	"net/http"
 	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/federation"
 	"github.com/knadh/dictpress/internal/importer"
+	"github.com/knadh/dictpress/internal/media"
+	"github.com/knadh/dictpress/internal/mt"
+	"github.com/knadh/dictpress/internal/sanitize"
 	"github.com/knadh/go-i18n"
 	"github.com/knadh/goyesql"
 	goyesqlx "github.com/knadh/goyesql/sqlx"
@@ -43,7 +48,16 @@ type Consts struct {
 	AdminAssets                      []string
 	EnableSubmissions            bool
 	EnableGlossary               bool
+	GlossaryPageNums             int
+	EnableOIDC                   bool
 	AdminUsername, AdminPassword []byte
+	PWA                          pwaOpt
+	Feed                         feedOpt
+	Media                        mediaOpt
+	Jobs                         jobOpt
+	Similar                      similarOpt
+	Anki                         ankiOpt
+	EntryLockDuration            time.Duration
 }
 
 // App contains the "global" components that are
@@ -54,20 +68,73 @@ type App struct {
 	adminTpl     *template.Template
 	siteTpl      *template.Template
 	sitePageTpls map[string]*template.Template
+	themes       *siteThemes
 
 	db         *sqlx.DB
 	queries    *data.Queries
 	data       *data.Data
 	i18n       *i18n.I18n
 	fs         stuffbin.FileSystem
+	siteFS     stuffbin.FileSystem
 	resultsPg  *paginator.Paginator
 	glossaryPg *paginator.Paginator
 	lo         *log.Logger
+
+	// Optional OIDC login for the admin.
+	oidc *oidcAuth
+
+	// Optional e-mail login for site visitors to save words.
+	readers *readerAuth
+
+	// Verified BasicAuth credentials of DB users.
+	userCache *userCache
+
+	// Store for uploaded images.
+	media media.Store
+
+	// Maintenance mode state.
+	maintenance *maintenanceMode
+
+	// IDs of the languages defined in the config file (and not only in the DB).
+	configLangs map[string]bool
+
+	// Signals the server to restart, eg: to apply language changes.
+	chRestart chan struct{}
+
+	// Optional machine translation hook for queries that yield no results.
+	mt *mt.MT
+
+	// Optional client that searches other instances for queries that yield no results.
+	federation *federation.Federation
+
+	// Optional text-to-speech provider for generating pronunciations.
+	tts *ttsGen
+
+	// Compiled flashcard export templates by name.
+	ankiTpls map[string]ankiTpls
+
+	// Counts of entry views (click-throughs) yet to be written to the DB.
+	views *viewCounter
+
+	// Optional API keys of the public APIs and their request counts.
+	apiKeys *apiKeyLimiter
+
+	// Optional filter of bot requests to the site and the public APIs.
+	bots *botFilter
+
+	// Optional sync of the in-memory state of multiple instances.
+	cluster *clusterSync
+
+	// Policy of the HTML allowed in entry content and rendered Markdown.
+	sanitizer *sanitize.Policy
 }
 
 var (
 	lo = log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile)
 	ko = koanf.New(".")
+
+	// Positional (non-flag) commandline arguments.
+	args []string
 )
 
 func init() {
@@ -81,19 +148,51 @@ func init() {
 	}
 
 	f.Bool("new-config", false, "generate a new sample config.toml file.")
+	f.Bool("new", false, "set up a new installation interactively: prompt for the DB and admin credentials, write config.toml, install the schema, and optionally create a site theme directory")
 	f.StringSlice("config", []string{"config.toml"},
 		"path to one or more config files (will be merged in order)")
 	f.String("site", "", "path to a site theme. If left empty, only HTTP APIs will be available.")
 	f.Bool("install", false, "run first time DB installation")
+	f.Bool("demo", false, "install the DB (wiping it) with a sample English-Italian dictionary and run the app with the default site theme")
 	f.Bool("upgrade", false, "upgrade database to the current version")
-	f.Bool("yes", false, "assume 'yes' to prompts during --install/upgrade")
+	f.Bool("check-config", false, "validate the config, languages, tokenizers, site theme, and DB connection, print all the errors found, and exit")
+	f.Bool("yes", false, "assume 'yes' to prompts during --install/upgrade/demo")
 	f.String("import", "", "import a CSV file into the database. eg: --import=data.csv")
+	f.String("import-format", "csv", "format of the --import file: csv | wiktextract (Wiktextract JSONL dump of Wiktionary) | cedict (CC-CEDICT) | jmdict (JMdict XML)")
+	f.StringSlice("import-langs", nil, "wiktextract: only import main entries in these languages. cedict, jmdict: headword and definition languages. eg: --import-langs=chinese,english")
+	f.Int("import-workers", 0, "number of workers that parse and insert batches of the --import file in parallel. Defaults to the number of CPUs")
+	f.Bool("import-restart", false, "import the --import file from the beginning. By default, re-running a failed import resumes it after the last imported batch and files that have been imported are skipped")
+	f.Bool("import-dry-run", false, "read and validate the --import, --import-data, or --import-frequency file without inserting anything into the database")
+	f.Bool("query", false, "search the dictionary directly from the DB and print results. eg: --query english italian \"apple\"")
+	f.String("query-format", "table", "output format for --query: table | json")
+	f.Int("query-limit", 10, "max number of results to print for --query")
+	f.String("export-site", "", "render the site theme and all entries into a static HTML site in the given directory. eg: --export-site=./out")
+	f.String("export-data", "", "export all entries and relations as JSON lines (- for stdout) for migrating to another instance. eg: --export-data=data.ndjson")
+	f.StringSlice("export-langs", nil, "--export-data, --export-site: only export headwords in the first language with their definitions in the optional second language. eg: --export-langs=english,italian")
+	f.StringSlice("export-tags", nil, "--export-data, --export-site: only export headwords that have any of these tags. eg: --export-tags=medical")
+	f.String("export-status", "", "--export-data: only export headwords and definitions with this status: enabled | disabled | pending")
+	f.String("export-since", "", "--export-data: only export headwords updated since this date or RFC3339 time. --export-site: only write the pages of words updated since. eg: --export-since=2024-01-31")
+	f.String("import-data", "", "import a --export-data file, inserting or updating entries and relations by their GUIDs. eg: --import-data=data.ndjson")
+	f.Bool("generate-reverse", false, "generate the reverse dictionary of the dictionary in --import-langs by inverting its short definitions into headwords tagged auto-generated. eg: --generate-reverse --import-langs=english,kannada generates kannada-english")
+	f.String("import-frequency", "", "import a word frequency list (one word per line, most frequent first) of the language in --import-langs and set the frequency ranks of its headwords. eg: --import-frequency=english.txt --import-langs=english")
+	f.String("backup", "", "back up the database into a file (pg_dump archive) and exit. eg: --backup=dictpress.dump")
+	f.String("restore", "", "restore the database from a --backup file, replacing existing data, and exit. eg: --restore=dictpress.dump")
 	f.Bool("version", false, "current version of the build")
 
 	if err := f.Parse(os.Args[1:]); err != nil {
 		lo.Fatalf("error parsing flags: %v", err)
 	}
 
+	args = f.Args()
+
+	// --query and --export-data=- print their output to stdout. Log to stderr
+	// so that the output can be piped to other programs.
+	if q, _ := f.GetBool("query"); q {
+		lo.SetOutput(os.Stderr)
+	} else if e, _ := f.GetString("export-data"); e == "-" {
+		lo.SetOutput(os.Stderr)
+	}
+
 	if ok, _ := f.GetBool("version"); ok {
 		fmt.Println(buildString)
 		os.Exit(0)
@@ -109,29 +208,68 @@ func init() {
 		os.Exit(0)
 	}
 
+	// Interactive setup of a new installation.
+	if ok, _ := f.GetBool("new"); ok {
+		if err := runNewWizard(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Load config files.
-	cFiles, _ := f.GetStringSlice("config")
-	for _, f := range cFiles {
-		lo.Printf("reading config: %s", f)
+	var (
+		cFiles, _ = f.GetStringSlice("config")
+		env       = envVars()
+	)
+	for _, fPath := range cFiles {
+		// Without a config file, containers can be configured entirely with
+		// environment variables over the sample config.
+		if _, err := os.Stat(fPath); os.IsNotExist(err) && !f.Changed("config") && len(env) > 0 {
+			lo.Printf("%s not found. Using the sample config with the environment variables", fPath)
+			b, err := initFS().Read("/config.sample.toml")
+			if err != nil {
+				lo.Fatalf("error reading sample config: %v", err)
+			}
+			if err := ko.Load(bytesProvider(b), toml.Parser()); err != nil {
+				lo.Fatalf("error loading sample config: %v", err)
+			}
+			continue
+		}
 
-		if err := ko.Load(file.Provider(f), toml.Parser()); err != nil {
+		lo.Printf("reading config: %s", fPath)
+		if err := ko.Load(file.Provider(fPath), toml.Parser()); err != nil {
 			fmt.Printf("error reading config: %v", err)
 			os.Exit(1)
 		}
 	}
 
+	// Environment variables (DICTPRESS_*) override the config files.
+	if err := loadEnv(env, ko); err != nil {
+		lo.Fatal(err)
+	}
+
 	if err := ko.Load(posflag.Provider(f, ".", ko), nil); err != nil {
 		lo.Fatalf("error loading config: %v", err)
 	}
 }
 
 func main() {
+	// Validate the config and exit.
+	if ko.Bool("check-config") {
+		if !checkConfig(ko) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Connect to the DB.
 	db := initDB(ko.MustString("db.host"),
 		ko.MustInt("db.port"),
 		ko.MustString("db.user"),
 		ko.MustString("db.password"),
 		ko.MustString("db.db"),
+		initDBPoolOpt(ko),
 	)
 	defer db.Close()
 
@@ -141,6 +279,8 @@ func main() {
 		db:     db,
 		fs:     initFS(),
 		lo:     lo,
+
+		userCache: newUserCache(time.Minute),
 	}
 
 	// Install schema.
@@ -149,11 +289,34 @@ func main() {
 		return
 	}
 
+	// Install the schema for a demo with sample data that's loaded below.
+	if ko.Bool("demo") {
+		if !installSchema(migList[len(migList)-1].version, app, !ko.Bool("yes")) {
+			return
+		}
+	}
+
 	if ko.Bool("upgrade") {
 		upgrade(db, app.fs, !ko.Bool("yes"))
 		os.Exit(0)
 	}
 
+	// Backup and restore.
+	backup := initBackupOpt(ko)
+	if fPath := ko.String("backup"); fPath != "" {
+		if err := backupDB(fPath, backup, ko); err != nil {
+			lo.Fatal(err)
+		}
+		lo.Printf("backed up database to %s", fPath)
+		os.Exit(0)
+	}
+	if fPath := ko.String("restore"); fPath != "" {
+		if err := restoreDB(fPath, backup, !ko.Bool("yes"), ko); err != nil {
+			lo.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
 	// Before the queries are prepared, see if there are pending upgrades.
 	checkUpgrade(db)
 
@@ -174,23 +337,115 @@ func main() {
 		lo.Fatalf("no SQL queries loaded: %v", err)
 	}
 
-	// Load language config.
+	// ID scheme of new entries, which the DB generates their IDs with.
+	initIDScheme(ko, &q)
+
+	// Load language config, including languages managed from the admin.
+	app.configLangs = initDBLangs(&q, ko)
 	var (
 		langs = initLangs(ko)
 		dicts = initDicts(langs, ko)
 	)
+	// Load the sample dictionary of the demo.
+	if ko.Bool("demo") {
+		loadDemo(langs, &q, db, app)
+	}
+
 	// Run the CSV importer.
 	if fPath := ko.String("import"); fPath != "" {
-		imp := importer.New(langs, q.InsertSubmissionEntry, q.InsertSubmissionRelation, db, lo)
+		imp := importer.New(langs, q.ImportStaged, db, ko.Bool("import-dry-run"), lo).
+			WithCheckpoints(q.GetCheckpoint, q.UpsertCheckpoint, ko.Bool("import-restart")).
+			WithWorkers(ko.Int("import-workers"))
+		if ko.Bool("import-dry-run") {
+			lo.Println("dry run. nothing will be inserted into the database")
+		}
+
 		lo.Printf("importing data from %s ...", fPath)
-		if err := imp.Import(fPath); err != nil {
+		switch ko.String("import-format") {
+		case "csv":
+			err = imp.Import(fPath)
+		case "wiktextract":
+			err = imp.ImportWiktextract(fPath, ko.Strings("import-langs"))
+		case "cedict", "jmdict":
+			l := ko.Strings("import-langs")
+			if len(l) != 2 {
+				lo.Fatalf("--import-langs should have the headword and definition languages. eg: --import-langs=chinese,english")
+			}
+
+			if ko.String("import-format") == "cedict" {
+				err = imp.ImportCEDICT(fPath, l[0], l[1])
+			} else {
+				err = imp.ImportJMdict(fPath, l[0], l[1])
+			}
+		default:
+			err = fmt.Errorf("unknown --import-format: %s", ko.String("import-format"))
+		}
+		if err != nil {
 			lo.Fatal(err)
 		}
 		os.Exit(0)
 	}
 
-	app.data = data.New(&q, langs, dicts)
+	app.data = data.New(&q, langs, dicts, initRankings(langs, ko))
 	app.queries = &q
+	initTSConfigs(app.data, db)
+	initCollations(app.data, qMap, db)
+	initExplain(app.data, qMap, db)
+	initFrequencyBands(app.data, ko)
+	app.data.Licenses = initLicenses(langs, ko)
+	initSpellers(app.data, ko)
+	initCompounders(app.data, ko)
+
+	// Lossless JSON lines data export and import.
+	if fPath := ko.String("export-data"); fPath != "" {
+		f, err := makeExportFilter(ko.Strings("export-langs"), ko.Strings("export-tags"), ko.String("export-status"), ko.String("export-since"), app)
+		if err != nil {
+			lo.Fatalf("error exporting data: %v", err)
+		}
+
+		if err := exportData(context.Background(), fPath, f, app, lo); err != nil {
+			lo.Fatalf("error exporting data: %v", err)
+		}
+		os.Exit(0)
+	}
+	if fPath := ko.String("import-data"); fPath != "" {
+		if err := importData(context.Background(), fPath, ko.Bool("import-dry-run"), app, lo); err != nil {
+			lo.Fatalf("error importing data: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	// Reverse dictionary generation.
+	if ko.Bool("generate-reverse") {
+		l := ko.Strings("import-langs")
+		if len(l) != 2 {
+			lo.Fatalf("--import-langs should have the headword and definition languages of the dictionary to reverse. eg: --import-langs=english,kannada")
+		}
+		if err := generateReverse(context.Background(), l[0], l[1], ko.Bool("import-dry-run"), app, lo); err != nil {
+			lo.Fatalf("error generating reverse dictionary: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	// Word frequency list import.
+	if fPath := ko.String("import-frequency"); fPath != "" {
+		l := ko.Strings("import-langs")
+		if len(l) != 1 {
+			lo.Fatalf("--import-langs should have the language of the frequency list. eg: --import-langs=english")
+		}
+		if _, err := importFrequency(context.Background(), fPath, l[0], ko.Bool("import-dry-run"), app, lo); err != nil {
+			lo.Fatalf("error importing frequency list: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	// Run a search from the commandline and exit.
+	if ko.Bool("query") {
+		if err := runQuery(app, args, ko.String("query-format"), ko.Int("query-limit")); err != nil {
+			lo.Fatal(err)
+		}
+		os.Exit(0)
+	}
 
 	// Result paginators.
 	app.resultsPg = paginator.New(paginator.Opt{
@@ -209,40 +464,185 @@ func main() {
 		})
 	}
 
+	// Load the site theme and admin assets from the configured storage.
+	store := initStorageOpt(ko)
+	app.fs = initAdminFS(store, app.fs)
+	if app.consts.Site != "" {
+		app.siteFS = initSiteFS(store, app.consts.Site, app.fs)
+	}
+
+	// Store for uploaded entry images.
+	app.consts.Media, app.media = initMedia(ko, store)
+
+	// Sanitizer policy for HTML and Markdown content.
+	app.sanitizer, err = initSanitizer(ko, "sanitizer")
+	if err != nil {
+		lo.Fatal(err)
+	}
+
+	// Flashcard (Anki) export.
+	if ko.Bool("anki.enabled") {
+		app.consts.Anki, app.ankiTpls = initAnki(ko)
+	}
+
+	// Optional text-to-speech for generating pronunciation audio in jobs.
+	if ko.Bool("tts.enabled") {
+		app.tts = initTTS(ko)
+	}
+
+	// Background import and export jobs.
+	app.consts.Jobs = initJobOpt(ko)
+	runJobWorkers(app)
+
+	// Maintenance mode, reloaded periodically to pick up changes from other instances.
+	app.maintenance = initMaintenance(app)
+	go refreshMaintenance(app)
+
+	// Optional API keys of the public APIs with their limits, counted in memory
+	// and written to the DB periodically.
+	if ko.Bool("api_keys.enabled") {
+		app.apiKeys = initAPIKeys(ko)
+		if err := app.apiKeys.load(app); err != nil {
+			lo.Fatalf("error loading API keys: %v", err)
+		}
+		go runAPIKeyFlusher(app)
+	}
+
+	// Optional IP, country, and user agent based filtering of bots.
+	if ko.Bool("bots.enabled") {
+		app.bots = initBots(ko)
+	}
+
+	// Entry views (click-throughs), counted in memory and written to the DB periodically.
+	app.views = initViews(ko)
+	go runViewFlusher(app)
+
+	// Optional cache coherence of multiple instances over Postgres LISTEN/NOTIFY.
+	if ko.Bool("cluster.enabled") {
+		app.cluster = initCluster(ko, app)
+	}
+
+	// Refresh the materialized counts of stats and glossaries.
+	if d := ko.Duration("stats.refresh_interval"); d > 0 {
+		go runCountsRefresher(d, app)
+	}
+
+	// Purge old items in the trash.
+	if days := ko.Int("app.trash_retention_days"); days > 0 {
+		go runTrashPurge(days, app)
+	}
+
+	// Publish the entries scheduled for publishing when they're due.
+	go runPublisher(app)
+
 	// Load admin HTML templates.
 	app.adminTpl = initAdminTemplates(app)
 
+	// Optional OIDC login for the admin.
+	if app.consts.EnableOIDC {
+		app.oidc = initOIDC(ko)
+	}
+
+	// Optional site visitor (reader) accounts.
+	if ko.Bool("readers.enabled") {
+		app.readers = initReaders(ko)
+	}
+
 	// Initialize the echo HTTP server.
 	srv := initHTTPServer(app, ko)
 
 	// Load optional HTML website.
 	if app.consts.Site != "" {
 		lo.Printf("loading site theme: %s", app.consts.Site)
-		theme, pages, err := loadSite(app.consts.Site, ko.Bool("app.enable_pages"))
+		theme, err := loadTheme("default", app.siteFS, ko.Bool("app.enable_pages"), app.sanitizer, app.data.Langs)
 		if err != nil {
 			lo.Fatalf("error loading site theme: %v", err)
 		}
 
-		// Optionally load a language pack.
-		langFile := filepath.Join(app.consts.Site, "lang.json")
-		if _, err := os.Stat(langFile); !errors.Is(err, os.ErrNotExist) {
-			i, err := i18n.NewFromFile(langFile)
-			if err != nil {
-				lo.Fatalf("error loading i18n lang.json file: %v", err)
-			}
-			app.i18n = i
-		} else {
-			app.i18n, _ = i18n.New([]byte(`{"_.code": "", "_.name": ""}`))
+		// Optional themes of hostnames and dictionary pairs.
+		app.themes, err = initThemes(theme, ko, app)
+		if err != nil {
+			lo.Fatal(err)
 		}
 
 		// Attach HTML template renderer.
-		app.siteTpl = theme
-		app.sitePageTpls = pages
-		srv.Renderer = &tplRenderer{tpls: theme}
+		app.siteTpl = theme.tpl
+		app.sitePageTpls = theme.pages
+		app.i18n = theme.i18n
+		srv.Renderer = &tplRenderer{themes: app.themes}
+	}
+
+	// Export the site as static HTML files and exit.
+	if dir := ko.String("export-site"); dir != "" {
+		f, err := makeExportFilter(ko.Strings("export-langs"), ko.Strings("export-tags"), ko.String("export-status"), ko.String("export-since"), app)
+		if err != nil {
+			lo.Fatalf("error exporting site: %v", err)
+		}
+
+		if err := exportSite(app, dir, f); err != nil {
+			lo.Fatalf("error exporting site: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	// Optional external search backend. This is only used by the server and
+	// not the one-off commandline operations above.
+	initSearchBackend(app.data, ko)
+	initSemantic(app.data, qMap, db, ko)
+
+	// Optional machine translation of queries that yield no results.
+	if ko.Bool("mt.enabled") {
+		app.mt = initMT(ko)
+	}
+
+	// Optional federated search of other instances for queries that yield no results.
+	if ko.Bool("federation.enabled") {
+		app.federation = initFederation(ko)
+	}
+	// Optional gRPC API server.
+	if ko.Bool("grpc.enabled") {
+		initGRPCServer(app, ko)
+	}
+
+	// Periodically reload the spellcheck words with new headwords.
+	if d := ko.Duration("app.spellcheck_refresh_interval"); d > 0 {
+		go refreshSpellers(app.data, d, ko)
 	}
 
-	lo.Printf("starting server on %s", ko.MustString("app.address"))
-	if err := srv.Start(ko.MustString("app.address")); err != nil {
-		lo.Fatalf("error starting HTTP server: %v", err)
+	// Scheduled backups.
+	if backup.Enabled {
+		lo.Printf("backing up database to %s every %s", backup.Dir, backup.Interval)
+		go runBackups(backup, ko)
+	}
+
+	// Restart the server in-place when languages are changed from the admin.
+	app.chRestart = make(chan struct{}, 1)
+	go awaitRestart(srv, app)
+
+	// With a TLS certificate, the server speaks HTTP/2 to clients that support it.
+	// On a restart, the server is shut down and the process is replaced, so
+	// wait for that instead of exiting.
+	// The server listens on a systemd-activated socket, a Unix domain socket,
+	// or a TCP address.
+	l, addr, err := initListener(ko)
+	if err != nil {
+		lo.Fatal(err)
+	}
+	lo.Printf("starting server on %s", addr)
+	if cert, key := ko.String("app.tls_cert"), ko.String("app.tls_key"); cert != "" && key != "" {
+		if l != nil {
+			if srv.TLSListener, err = newTLSListener(l, cert, key); err != nil {
+				lo.Fatal(err)
+			}
+		}
+		if err := srv.StartTLS(ko.MustString("app.address"), cert, key); err != nil && err != http.ErrServerClosed {
+			lo.Fatalf("error starting HTTPS server: %v", err)
+		}
+	} else {
+		srv.Listener = l
+		if err := srv.Start(ko.MustString("app.address")); err != nil && err != http.ErrServerClosed {
+			lo.Fatalf("error starting HTTP server: %v", err)
+		}
 	}
+	select {}
 }
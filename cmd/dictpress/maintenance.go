@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Key of the maintenance mode state in the settings table.
+const settingMaintenance = "maintenance"
+
+// Interval at which the maintenance mode state is reloaded from the DB so that
+// toggling it on one instance applies to all instances sharing the DB.
+const maintenanceRefreshInterval = 10 * time.Second
+
+// Message shown during maintenance if none is set.
+const maintenanceMsg = "The dictionary is undergoing maintenance and will be back shortly."
+
+// maintenance represents the maintenance mode state. When enabled, the public
+// site shows a maintenance page (503) and public API mutations are rejected,
+// while the public read APIs and the admin remain available.
+type maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+// maintenanceMode holds the maintenance state toggled from the admin (stored
+// in the DB) and the state set in the config, which takes precedence.
+type maintenanceMode struct {
+	conf maintenance
+	db   maintenance
+	mu   sync.RWMutex
+}
+
+// initMaintenance loads the maintenance mode state from the config and the DB.
+func initMaintenance(app *App) *maintenanceMode {
+	m := &maintenanceMode{
+		conf: maintenance{
+			Enabled: ko.Bool("app.maintenance"),
+			Message: ko.String("app.maintenance_message"),
+		},
+	}
+
+	if err := m.load(app); err != nil {
+		lo.Printf("error loading maintenance mode state: %v", err)
+	}
+
+	return m
+}
+
+// get returns the effective maintenance state.
+func (m *maintenanceMode) get() maintenance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := m.db
+	if m.conf.Enabled {
+		out.Enabled = true
+	}
+	if out.Message == "" {
+		out.Message = m.conf.Message
+	}
+	if out.Message == "" {
+		out.Message = maintenanceMsg
+	}
+
+	return out
+}
+
+// load loads the maintenance state saved in the DB.
+func (m *maintenanceMode) load(app *App) error {
+	b, err := app.data.GetSetting(settingMaintenance)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	var v maintenance
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.db = v
+	m.mu.Unlock()
+
+	return nil
+}
+
+// refreshMaintenance periodically reloads the maintenance state from the DB.
+func refreshMaintenance(app *App) {
+	for {
+		time.Sleep(maintenanceRefreshInterval)
+
+		if err := app.maintenance.load(app); err != nil {
+			app.lo.Printf("error loading maintenance mode state: %v", err)
+		}
+	}
+}
+
+// handleGetMaintenance returns the maintenance mode state.
+func handleGetMaintenance(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	out := struct {
+		maintenance
+		Config bool `json:"config"`
+	}{app.maintenance.get(), app.maintenance.conf.Enabled}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateMaintenance turns maintenance mode on or off.
+func handleUpdateMaintenance(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	var req maintenance
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+	req.Message = strings.TrimSpace(req.Message)
+
+	b, _ := json.Marshal(req)
+	if err := app.data.UpsertSetting(settingMaintenance, b); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error saving maintenance mode: %v", err))
+	}
+
+	app.maintenance.mu.Lock()
+	app.maintenance.db = req
+	app.maintenance.mu.Unlock()
+	app.notify(clusterMaintenance)
+
+	return handleGetMaintenance(c)
+}
+
+// maintenancePage is a middleware that renders the maintenance page on public
+// site pages when maintenance mode is on. Themes can define a `maintenance`
+// template. Otherwise, the `message` template is used.
+func maintenancePage(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		app := c.Get("app").(*App)
+
+		m := app.maintenance.get()
+		if !m.Enabled {
+			return next(c)
+		}
+
+		tpl := "maintenance"
+		if app.theme(c).tpl.Lookup(tpl) == nil {
+			tpl = "message"
+		}
+
+		c.Response().Header().Set("Retry-After", "300")
+		return c.Render(http.StatusServiceUnavailable, tpl, pageTpl{
+			Title:       "Under maintenance",
+			Heading:     "Under maintenance",
+			Description: m.Message,
+		})
+	}
+}
+
+// readOnlyAPI is a middleware that rejects mutations on the public APIs (eg:
+// submissions) when maintenance mode is on.
+func readOnlyAPI(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+
+		app := c.Get("app").(*App)
+		if m := app.maintenance.get(); m.Enabled {
+			c.Response().Header().Set("Retry-After", "300")
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "read-only during maintenance: "+m.Message)
+		}
+
+		return next(c)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/media"
+	"github.com/knadh/dictpress/internal/s3"
+	"github.com/knadh/koanf/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// Media store providers.
+const (
+	mediaFilesystem = "filesystem"
+	mediaS3         = "s3"
+)
+
+// URI that images in the filesystem media store are served on.
+const mediaURI = "/uploads"
+
+// mediaOpt represents the media (image upload) options.
+type mediaOpt struct {
+	Provider   string `koanf:"provider"`
+	UploadPath string `koanf:"upload_path"`
+	S3Prefix   string `koanf:"s3_prefix"`
+	S3URL      string `koanf:"s3_url"`
+	MaxSize    int64  `koanf:"max_size"`
+	ThumbWidth int    `koanf:"thumb_width"`
+}
+
+// Content types of images that can be uploaded and their file extensions.
+var mediaTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// initMedia loads the media options and the media store.
+func initMedia(ko *koanf.Koanf, st storageOpt) (mediaOpt, media.Store) {
+	var o mediaOpt
+	if err := ko.Unmarshal("media", &o); err != nil {
+		lo.Fatalf("error loading media config: %v", err)
+	}
+	if o.Provider == "" {
+		o.Provider = mediaFilesystem
+	}
+	if o.UploadPath == "" {
+		o.UploadPath = "uploads"
+	}
+	if o.MaxSize < 1 {
+		o.MaxSize = 5 * 1024 * 1024
+	}
+	if o.ThumbWidth < 1 {
+		o.ThumbWidth = 300
+	}
+
+	switch o.Provider {
+	case mediaFilesystem:
+		s, err := media.NewFilesystem(o.UploadPath, ko.String("app.root_url")+mediaURI)
+		if err != nil {
+			lo.Fatalf("error initializing media upload path: %v", err)
+		}
+		return o, s
+	case mediaS3:
+		if o.S3URL == "" {
+			lo.Fatal("media.s3_url should be set to the bucket's public URL")
+		}
+		return o, media.NewS3(s3.New(st.S3), o.S3Prefix, o.S3URL)
+	}
+
+	lo.Fatalf("unknown media provider '%s'", o.Provider)
+	return o, nil
+}
+
+// handleGetMedia returns the media of an entry and of its relations.
+func handleGetMedia(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	out, err := app.data.GetMedia([]int{id})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching media: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleInsertMedia attaches an image to an entry, or to one of its relations
+// with the relation_id field. The image is either an uploaded file (multipart
+// `file` field) that's stored in the media store along with a generated
+// thumbnail, or the URL of an external image (`url` field).
+func handleInsertMedia(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		id, _    = strconv.Atoi(c.Param("id"))
+		relID, _ = strconv.Atoi(c.FormValue("relation_id"))
+	)
+
+	if id < 1 || relID < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	m := data.Media{
+		EntryID:    id,
+		RelationID: relID,
+		Caption:    strings.TrimSpace(c.FormValue("caption")),
+	}
+
+	if u := strings.TrimSpace(c.FormValue("url")); u != "" {
+		// Linked external image.
+		if p, err := url.Parse(u); err != nil || (p.Scheme != "http" && p.Scheme != "https") {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid `url`.")
+		}
+		m.URL = u
+		m.ThumbURL = u
+	} else {
+		if err := uploadMedia(c, &m, app); err != nil {
+			return err
+		}
+	}
+
+	out, err := app.data.InsertMedia(m)
+	if err != nil {
+		deleteMediaFiles(m, app)
+
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "entry or relation not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error inserting media: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteMedia deletes a media item of an entry and its files.
+func handleDeleteMedia(c echo.Context) error {
+	var (
+		app        = c.Get("app").(*App)
+		id, _      = strconv.Atoi(c.Param("id"))
+		mediaID, _ = strconv.Atoi(c.Param("mediaID"))
+	)
+
+	if id < 1 || mediaID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	m, err := app.data.DeleteMedia(mediaID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "media not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error deleting media: %v", err))
+	}
+
+	deleteMediaFiles(m, app)
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// uploadMedia reads the uploaded image in a request, generates its thumbnail,
+// and stores both in the media store.
+func uploadMedia(c echo.Context, m *data.Media, app *App) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "no `file` or `url` given.")
+	}
+	if file.Size > app.consts.Media.MaxSize {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("file is larger than %d bytes.", app.consts.Media.MaxSize))
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error reading file: %v", err))
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, app.consts.Media.MaxSize))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error reading file: %v", err))
+	}
+
+	typ := http.DetectContentType(b)
+	ext, ok := mediaTypes[typ]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unsupported image type. Should be JPEG, PNG, or GIF.")
+	}
+
+	thumb, thumbType, size, err := media.Thumbnail(b, app.consts.Media.ThumbWidth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Files are stored with random names.
+	rnd := make([]byte, 16)
+	if _, err := rand.Read(rnd); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	name := hex.EncodeToString(rnd)
+
+	m.Filename = name + ext
+	m.ThumbFilename = "thumb_" + name + mediaTypes[thumbType]
+	m.ContentType = typ
+	m.Width = size.X
+	m.Height = size.Y
+
+	if m.URL, err = app.media.Put(m.Filename, typ, b); err != nil {
+		app.lo.Printf("error storing media: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error storing file")
+	}
+	if m.ThumbURL, err = app.media.Put(m.ThumbFilename, thumbType, thumb); err != nil {
+		app.lo.Printf("error storing media thumbnail: %v", err)
+		deleteMediaFiles(*m, app)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error storing file")
+	}
+
+	return nil
+}
+
+// deleteMediaFiles deletes the files of an uploaded media item from the media store.
+func deleteMediaFiles(m data.Media, app *App) {
+	for _, f := range []string{m.Filename, m.ThumbFilename} {
+		if f == "" || filepath.Base(f) != f {
+			continue
+		}
+		if err := app.media.Delete(f); err != nil {
+			app.lo.Printf("error deleting media file %s: %v", f, err)
+		}
+	}
+}
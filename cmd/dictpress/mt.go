@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// Tag of the definitions that are promoted from machine translations.
+const tagMachineTranslated = "machine-translated"
+
+// mtSuggestion is a machine translation of a query that yielded no results.
+type mtSuggestion struct {
+	Content  string `json:"content"`
+	FromLang string `json:"from_lang"`
+	ToLang   string `json:"to_lang"`
+	Provider string `json:"provider"`
+
+	// Always true. Marks the suggestion as machine generated in responses.
+	MachineGenerated bool `json:"machine_generated"`
+}
+
+// mtPromotion is a machine translation to be saved as an entry and definition.
+type mtPromotion struct {
+	Query    string `json:"query"`
+	Content  string `json:"content"`
+	FromLang string `json:"from_lang"`
+	ToLang   string `json:"to_lang"`
+	Type     string `json:"type"`
+}
+
+// handleGetMT returns the machine translation of a query.
+func handleGetMT(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		fromLang = c.Param("fromLang")
+		toLang   = c.Param("toLang")
+	)
+
+	q, err := url.QueryUnescape(c.Param("q"))
+	if err != nil || strings.TrimSpace(q) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid query")
+	}
+	if _, ok := app.data.Langs[fromLang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `from` language")
+	}
+	if _, ok := app.data.Langs[toLang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `to` language")
+	}
+
+	out, err := translate(strings.TrimSpace(q), fromLang, toLang, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, "error fetching machine translation")
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handlePromoteMT saves a machine translation as a headword (or an existing
+// headword with the same content) with the translation as its definition.
+// The definition is tagged as machine-translated.
+func handlePromoteMT(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	var p mtPromotion
+	if err := c.Bind(&p); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	p.Query, p.Content = strings.TrimSpace(p.Query), strings.TrimSpace(p.Content)
+	if p.Query == "" || p.Content == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `query` or `content`")
+	}
+	if _, ok := app.data.Langs[p.FromLang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `from_lang`")
+	}
+	toLang, ok := app.data.Langs[p.ToLang]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `to_lang`")
+	}
+	types := pq.StringArray{}
+	if p.Type != "" {
+		if _, ok := toLang.Types[p.Type]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown `type`")
+		}
+		types = pq.StringArray{p.Type}
+	}
+
+	// Users who can't change statuses can only create pending entries.
+	status := data.StatusEnabled
+	if !hasPerm(c, permEntriesStatus) {
+		status = data.StatusPending
+	}
+
+	fromID, err := app.data.InsertSubmissionEntry(data.Entry{
+		Lang:    p.FromLang,
+		Initial: data.Initial(p.Query),
+		Content: p.Query,
+		Phones:  pq.StringArray{},
+		Tags:    pq.StringArray{},
+		Status:  status,
+	})
+	if err != nil {
+		app.lo.Printf("error inserting promoted entry: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving entry")
+	}
+
+	toID, err := app.data.InsertSubmissionEntry(data.Entry{
+		Lang:    p.ToLang,
+		Initial: data.Initial(p.Content),
+		Content: p.Content,
+		Phones:  pq.StringArray{},
+		Tags:    pq.StringArray{tagMachineTranslated},
+		Status:  status,
+	})
+	if err != nil {
+		app.lo.Printf("error inserting promoted definition: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving definition")
+	}
+
+	if _, err := app.data.InsertSubmissionRelation(fromID, toID, data.Relation{
+		Types:  types,
+		Tags:   pq.StringArray{tagMachineTranslated},
+		Status: status,
+	}); err != nil {
+		app.lo.Printf("error inserting promoted relation: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving relation")
+	}
+	c.Set(auditNewID, fromID)
+
+	// Respond with the headword.
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprintf("%d", fromID))
+	return handleGetEntry(c)
+}
+
+// translate returns the machine translation of a query from one language to another.
+func translate(q, fromLang, toLang string, app *App) (*mtSuggestion, error) {
+	from, to := app.data.Langs[fromLang], app.data.Langs[toLang]
+
+	s, err := app.mt.Translate(q, langCode(from), langCode(to))
+	if err != nil {
+		app.lo.Printf("error fetching machine translation: %v", err)
+		return nil, err
+	}
+	if s == "" || strings.EqualFold(s, q) {
+		return nil, nil
+	}
+
+	return &mtSuggestion{
+		Content:          s,
+		FromLang:         fromLang,
+		ToLang:           toLang,
+		Provider:         app.mt.Name(),
+		MachineGenerated: true,
+	}, nil
+}
+
+// langCode returns the code of a language for external services, which is
+// its locale, or its ID if it doesn't have one.
+func langCode(l data.Lang) string {
+	if l.Locale != "" {
+		return l.Locale
+	}
+
+	return l.ID
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Path params that are numeric IDs. All others are strings.
+var openAPIIntParams = map[string]bool{
+	"id": true, "fromID": true, "toID": true, "relID": true, "commentID": true,
+}
+
+var reRouteParam = regexp.MustCompile(`:(\w+)`)
+
+// swaggerUITpl is the Swagger UI page that renders the OpenAPI spec.
+const swaggerUITpl = `<!doctype html>
+<html>
+<head>
+	<meta charset="utf-8" />
+	<title>dictpress API</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css" />
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+	<script>SwaggerUIBundle({ url: "{{ SPEC_URL }}", dom_id: "#swagger-ui" });</script>
+</body>
+</html>`
+
+// makeOpenAPISpec generates an OpenAPI 3 document for the v1 APIs from the route registry.
+func makeOpenAPISpec(routes []apiRoute, rootURL, version string) ([]byte, error) {
+	type m map[string]interface{}
+
+	var (
+		paths = m{}
+		tags  = []m{}
+		seen  = map[string]bool{}
+	)
+
+	for _, r := range routes {
+		// /entries/:id => /entries/{id}
+		path := reRouteParam.ReplaceAllString(r.path, "{$1}")
+
+		params := []m{}
+		for _, p := range reRouteParam.FindAllStringSubmatch(r.path, -1) {
+			typ := "string"
+			if openAPIIntParams[p[1]] {
+				typ = "integer"
+			}
+			params = append(params, m{"name": p[1], "in": "path", "required": true, "schema": m{"type": typ}})
+		}
+		for _, q := range r.query {
+			params = append(params, m{"name": q, "in": "query", "required": false, "schema": m{"type": "string"}})
+		}
+
+		op := m{
+			"tags":        []string{r.tag},
+			"summary":     r.summary,
+			"operationId": strings.ToLower(r.method) + reRouteParam.ReplaceAllString(strings.ReplaceAll(r.path, "/", "_"), "$1"),
+			"parameters":  params,
+			"responses": m{
+				"200":     m{"description": "OK", "content": m{"application/json": m{"schema": m{"$ref": "#/components/schemas/Response"}}}},
+				"default": m{"description": "Error", "content": m{"application/json": m{"schema": m{"$ref": "#/components/schemas/Response"}}}},
+			},
+		}
+		if r.method == http.MethodPost || r.method == http.MethodPut {
+			op["requestBody"] = m{"content": m{"application/json": m{"schema": m{"type": "object"}}}}
+		}
+		if r.perm != "" {
+			op["security"] = []m{{"basicAuth": []string{}}}
+			op["description"] = "Requires the `" + r.perm + "` permission."
+		} else {
+			op["security"] = []m{}
+		}
+
+		if _, ok := paths[path]; !ok {
+			paths[path] = m{}
+		}
+		paths[path].(m)[strings.ToLower(r.method)] = op
+
+		if !seen[r.tag] {
+			seen[r.tag] = true
+			tags = append(tags, m{"name": r.tag})
+		}
+	}
+
+	spec := m{
+		"openapi": "3.0.3",
+		"info": m{
+			"title":   "dictpress",
+			"version": version,
+		},
+		"servers": []m{{"url": strings.TrimRight(rootURL, "/") + apiV1}},
+		"tags":    tags,
+		"paths":   paths,
+		"components": m{
+			"securitySchemes": m{
+				"basicAuth": m{"type": "http", "scheme": "basic"},
+			},
+			"schemas": m{
+				"Response": m{
+					"type": "object",
+					"properties": m{
+						"data": m{"nullable": true},
+						"error": m{
+							"type":     "object",
+							"nullable": true,
+							"properties": m{
+								"code":    m{"type": "integer"},
+								"message": m{"type": "string"},
+							},
+						},
+						"meta": m{
+							"type":     "object",
+							"nullable": true,
+							"properties": m{
+								"page":        m{"type": "integer"},
+								"per_page":    m{"type": "integer"},
+								"total_pages": m{"type": "integer"},
+								"total":       m{"type": "integer"},
+								"next_cursor": m{"type": "string"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+// handleOpenAPISpec returns a handler that serves a pre-generated OpenAPI spec.
+func handleOpenAPISpec(spec []byte) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSONBlob(http.StatusOK, spec)
+	}
+}
+
+// handleAPIDocs renders the Swagger UI for the OpenAPI spec.
+func handleAPIDocs(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	return c.HTML(http.StatusOK, strings.Replace(swaggerUITpl, "{{ SPEC_URL }}",
+		app.consts.RootURL+apiLegacy+"/openapi.json", 1))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/knadh/paginator"
+)
+
+// pagination is the data of a page's pagination bar for themes, so that
+// templates don't have to compute the window of page links and URLs.
+type pagination struct {
+	Page       int
+	PerPage    int
+	TotalPages int
+	Total      int
+
+	// Links to the window of pages around the current page.
+	Pages []pageLink
+
+	// URLs of the first, last, previous, and next pages. Prev and Next are
+	// empty on the first and last pages.
+	FirstURL string
+	LastURL  string
+	PrevURL  string
+	NextURL  string
+
+	// Whether there are pages before and after the window of pages.
+	HasMoreBefore bool
+	HasMoreAfter  bool
+}
+
+// pageLink is a link in a navigation bar, eg: a page number or a glossary initial.
+type pageLink struct {
+	Label   string
+	Page    int
+	URL     string
+	Current bool
+}
+
+// makePagination returns the pagination data of a paginator set that has its
+// total set, with a window of at most numPages links, and the page URLs made
+// by appending ?page=N to baseURL (page 1 is baseURL).
+func makePagination(pg paginator.Set, numPages int, baseURL string) *pagination {
+	pageURL := func(n int) string {
+		if n <= 1 {
+			return baseURL
+		}
+		return baseURL + "?page=" + strconv.Itoa(n)
+	}
+
+	total := pg.TotalPages
+	if total < 1 {
+		total = 1
+	}
+	if numPages < 1 {
+		numPages = 1
+	}
+
+	// Center the window on the current page.
+	start := pg.Page - numPages/2
+	if start+numPages-1 > total {
+		start = total - numPages + 1
+	}
+	if start < 1 {
+		start = 1
+	}
+	end := start + numPages - 1
+	if end > total {
+		end = total
+	}
+
+	out := &pagination{
+		Page:          pg.Page,
+		PerPage:       pg.PerPage,
+		TotalPages:    total,
+		Total:         pg.Total,
+		Pages:         make([]pageLink, 0, end-start+1),
+		FirstURL:      pageURL(1),
+		LastURL:       pageURL(total),
+		HasMoreBefore: start > 1,
+		HasMoreAfter:  end < total,
+	}
+	for n := start; n <= end; n++ {
+		out.Pages = append(out.Pages, pageLink{
+			Label:   strconv.Itoa(n),
+			Page:    n,
+			URL:     pageURL(n),
+			Current: n == pg.Page,
+		})
+	}
+
+	if pg.Page > 1 {
+		out.PrevURL = pageURL(pg.Page - 1)
+	}
+	if pg.Page < total {
+		out.NextURL = pageURL(pg.Page + 1)
+	}
+
+	return out
+}
+
+// makeInitialLinks returns the links to the glossary pages of initials.
+func makeInitialLinks(initials []string, cur, fromLang, toLang, rootURL string) []pageLink {
+	out := make([]pageLink, 0, len(initials))
+	for _, i := range initials {
+		out = append(out, pageLink{
+			Label:   i,
+			URL:     glossaryURL(rootURL, fromLang, toLang, i),
+			Current: i == cur,
+		})
+	}
+
+	return out
+}
+
+// glossaryURL returns the URL of the glossary page of an initial.
+func glossaryURL(rootURL, fromLang, toLang, initial string) string {
+	return fmt.Sprintf("%s/glossary/%s/%s/%s", rootURL, escapeWordURL(fromLang), escapeWordURL(toLang), escapeWordURL(initial))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/knadh/dictpress/internal/data"
+)
+
+// pageEntry is the optional theme template of entry permalink pages. Themes
+// without it render permalinks with the search template.
+const pageEntry = "entry"
+
+// altLink is a version of a page in another language for <link rel="alternate" hreflang>.
+type altLink struct {
+	// Language ID, name, and the BCP 47 locale of the language (if it's set in the config).
+	Lang     string
+	Name     string
+	HrefLang string
+
+	URL string
+}
+
+// entryURL returns the permalink URL of an entry.
+func entryURL(rootURL, lang, slug string) string {
+	return fmt.Sprintf("%s/word/%s/%s", rootURL, url.PathEscape(lang), url.PathEscape(slug))
+}
+
+// makeEntryAlternates returns the permalinks of an entry and the first
+// definition in each of the other languages that the entry is defined in.
+// Only languages with a locale in the config have an hreflang.
+func makeEntryAlternates(e data.Entry, rootURL string, app *App) []altLink {
+	var (
+		out  = []altLink{newAltLink(e, rootURL, app)}
+		seen = map[string]bool{e.Lang: true}
+	)
+	for _, r := range e.Relations {
+		if seen[r.Lang] || r.Slug == "" || r.Status != data.StatusEnabled {
+			continue
+		}
+		seen[r.Lang] = true
+		out = append(out, newAltLink(r, rootURL, app))
+	}
+
+	// A page doesn't have alternates on its own.
+	if len(out) == 1 {
+		return nil
+	}
+
+	return out
+}
+
+func newAltLink(e data.Entry, rootURL string, app *App) altLink {
+	l := app.data.Langs[e.Lang]
+	return altLink{
+		Lang:     e.Lang,
+		Name:     l.Name,
+		HrefLang: l.Locale,
+		URL:      entryURL(rootURL, e.Lang, e.Slug),
+	}
+}
+
+// makeEntryBreadcrumbs returns the breadcrumbs of an entry's permalink page:
+// the homepage, the entry's language, the glossary page of the entry's initial
+// (if the glossary is enabled), and the entry. The language and initial link
+// to the glossary of the first dictionary pair of the language.
+func makeEntryBreadcrumbs(e data.Entry, rootURL string, app *App) []pageLink {
+	var (
+		lang = pageLink{Label: app.data.Langs[e.Lang].Name}
+		out  = []pageLink{{Label: "Home", URL: rootURL + "/"}}
+	)
+
+	var initial *pageLink
+	if app.consts.EnableGlossary {
+		for _, d := range app.data.Dicts {
+			if d[0].ID != e.Lang {
+				continue
+			}
+
+			lang.URL = glossaryURL(rootURL, e.Lang, d[1].ID, "*")
+			if e.Initial != "" {
+				initial = &pageLink{Label: e.Initial, URL: glossaryURL(rootURL, e.Lang, d[1].ID, e.Initial)}
+			}
+			break
+		}
+	}
+
+	out = append(out, lang)
+	if initial != nil {
+		out = append(out, *initial)
+	}
+
+	return append(out, pageLink{Label: e.Content, URL: entryURL(rootURL, e.Lang, e.Slug), Current: true})
+}
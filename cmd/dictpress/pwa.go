@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pwaOpt represents the Progressive Web App config.
+type pwaOpt struct {
+	Enabled         bool   `koanf:"enabled"`
+	Name            string `koanf:"name"`
+	ShortName       string `koanf:"short_name"`
+	Description     string `koanf:"description"`
+	ThemeColor      string `koanf:"theme_color"`
+	BackgroundColor string `koanf:"background_color"`
+	Icon            string `koanf:"icon"`
+	IconSizes       string `koanf:"icon_sizes"`
+	CacheEntries    int    `koanf:"cache_entries"`
+}
+
+// tplServiceWorker is the service worker that caches the site's static assets on
+// install and the most recently viewed dictionary pages for offline access.
+var tplServiceWorker = template.Must(template.New("sw").Parse(`
+const CACHE_STATIC = "static-{{ .AssetVer }}";
+const CACHE_PAGES = "pages";
+const MAX_PAGES = {{ .MaxPages }};
+
+// URL path of the site (eg: /dict if root_url is https://site.com/dict).
+const BASE = {{ .BasePath }};
+
+// The homepage and all the static files in the site theme.
+const STATIC_FILES = {{ .StaticFiles }};
+
+self.addEventListener("install", (e) => {
+	e.waitUntil(caches.open(CACHE_STATIC).then((c) => c.addAll(STATIC_FILES)));
+	self.skipWaiting();
+});
+
+// Delete static caches of older versions.
+self.addEventListener("activate", (e) => {
+	e.waitUntil(caches.keys().then((keys) => Promise.all(
+		keys.filter((k) => k.startsWith("static-") && k !== CACHE_STATIC).map((k) => caches.delete(k))
+	)));
+	self.clients.claim();
+});
+
+// Keep only the MAX_PAGES most recently viewed pages.
+async function trimPages() {
+	const c = await caches.open(CACHE_PAGES);
+	const keys = await c.keys();
+	for (let i = 0; i < keys.length - MAX_PAGES; i++) {
+		await c.delete(keys[i]);
+	}
+}
+
+self.addEventListener("fetch", (e) => {
+	const req = e.request;
+	if (req.method !== "GET") {
+		return;
+	}
+
+	const url = new URL(req.url);
+
+	// Static files: cache first. Static URLs may have ?v=version cache busters.
+	if (url.pathname.startsWith(BASE + "/static/")) {
+		e.respondWith(caches.match(req, { ignoreSearch: true }).then((r) => r || fetch(req)));
+		return;
+	}
+
+	// Dictionary, word, and glossary pages: network first, falling back to the
+	// recently viewed pages in the cache when offline.
+	const p = url.pathname.substring(BASE.length);
+	if (p.startsWith("/dictionary/") || p.startsWith("/word/") || p.startsWith("/glossary/") || p === "/" || p === "") {
+		e.respondWith(fetch(req).then((r) => {
+			if (r.ok) {
+				const copy = r.clone();
+				caches.open(CACHE_PAGES).then((c) => c.delete(req).then(() => c.put(req, copy))).then(trimPages);
+			}
+			return r;
+		}).catch(() => caches.match(req)));
+	}
+});
+`))
+
+// handleManifest serves the web app manifest generated from the config.
+func handleManifest(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		o   = app.consts.PWA
+	)
+
+	type icon struct {
+		Src   string `json:"src"`
+		Sizes string `json:"sizes"`
+	}
+
+	out := struct {
+		Name            string `json:"name"`
+		ShortName       string `json:"short_name"`
+		Description     string `json:"description"`
+		StartURL        string `json:"start_url"`
+		Scope           string `json:"scope"`
+		Display         string `json:"display"`
+		ThemeColor      string `json:"theme_color"`
+		BackgroundColor string `json:"background_color"`
+		Icons           []icon `json:"icons"`
+	}{
+		Name:            o.Name,
+		ShortName:       o.ShortName,
+		Description:     o.Description,
+		StartURL:        app.consts.RootURL + "/",
+		Scope:           app.consts.RootURL + "/",
+		Display:         "standalone",
+		ThemeColor:      o.ThemeColor,
+		BackgroundColor: o.BackgroundColor,
+		Icons:           []icon{{Src: app.consts.RootURL + o.Icon, Sizes: o.IconSizes}},
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// handleServiceWorker serves the service worker script.
+func handleServiceWorker(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	// URL path prefix of the site.
+	basePath := ""
+	if u, err := url.Parse(app.consts.RootURL); err == nil {
+		basePath = strings.TrimRight(u.Path, "/")
+	}
+
+	// Precache the homepage and the theme's (fingerprinted) static files.
+	files := []string{basePath + "/"}
+	for _, p := range app.theme(c).assets {
+		files = append(files, basePath+p)
+	}
+	sort.Strings(files[1:])
+
+	// JSON encoded strings are valid JS literals.
+	jsBase, _ := json.Marshal(basePath)
+	jsFiles, _ := json.Marshal(files)
+
+	b := bytes.Buffer{}
+	if err := tplServiceWorker.Execute(&b, struct {
+		BasePath    string
+		StaticFiles string
+		AssetVer    string
+		MaxPages    int
+	}{string(jsBase), string(jsFiles), assetVer, app.consts.PWA.CacheEntries}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	// The service worker should always be revalidated by the browser.
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	return c.Blob(http.StatusOK, "application/javascript", b.Bytes())
+}
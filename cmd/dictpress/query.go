@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/knadh/dictpress/internal/data"
+)
+
+// runQuery runs a dictionary search directly against the DB and prints the
+// results to stdout. args are [fromLang, toLang, query...]. toLang can be * to
+// search all languages.
+func runQuery(app *App, args []string, format string, limit int) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: --query fromLang toLang \"search query\"")
+	}
+
+	var (
+		fromLang = args[0]
+		toLang   = args[1]
+		q        = strings.TrimSpace(strings.Join(args[2:], " "))
+	)
+
+	lang, ok := app.data.Langs[fromLang]
+	if !ok {
+		return fmt.Errorf("unknown `from` language '%s'", fromLang)
+	}
+
+	if toLang == "*" {
+		toLang = ""
+	} else if _, ok := app.data.Langs[toLang]; !ok {
+		return fmt.Errorf("unknown `to` language '%s'", toLang)
+	}
+
+	query := data.Query{
+		FromLang: fromLang,
+		ToLang:   toLang,
+		Query:    q,
+		Status:   data.StatusEnabled,
+		Limit:    limit,
+	}
+
+	res, total, err := app.data.Search(query)
+	if err != nil {
+		return fmt.Errorf("error searching: %v", err)
+	}
+
+	if len(res) > 0 {
+		if err := app.data.SearchAndLoadRelations(res, data.Query{
+			ToLang: toLang,
+			Status: data.StatusEnabled,
+		}); err != nil {
+			return fmt.Errorf("error loading relations: %v", err)
+		}
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	// Print the tokenizer output to help debug tokenization.
+	tokens := "(postgres: " + lang.TokenizerName + ")"
+	if lang.Tokenizer != nil {
+		t, err := lang.Tokenizer.ToQuery(q, fromLang)
+		if err != nil {
+			return fmt.Errorf("error tokenizing query: %v", err)
+		}
+		tokens = t
+	}
+	fmt.Printf("query: %s\ntokens: %s\nresults: %d of %d\n\n", q, tokens, len(res), total)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tENTRY\tLANG\tTYPES\tDEFINITION")
+	for i, e := range res {
+		if len(e.Relations) == 0 {
+			fmt.Fprintf(w, "%d\t%s\t%s\t\t\n", i+1, e.Content, e.Lang)
+			continue
+		}
+
+		for j, r := range e.Relations {
+			var types string
+			if r.Relation != nil {
+				types = strings.Join(r.Relation.Types, ",")
+			}
+
+			if j == 0 {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, e.Content, e.Lang, types, r.Content)
+			} else {
+				fmt.Fprintf(w, "\t\t%s\t%s\t%s\n", r.Lang, types, r.Content)
+			}
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+// Quiz question types.
+const (
+	// quizChoice asks for the gloss of a headword among multiple choices.
+	quizChoice = "choice"
+
+	// quizScramble asks for a headword from its scrambled letters and gloss.
+	quizScramble = "scramble"
+)
+
+// Limits of the number of questions and choices in a quiz.
+const (
+	maxQuizQuestions = 50
+	maxQuizChoices   = 8
+)
+
+// Min length of words in scrambled word questions.
+const minScrambleLen = 3
+
+// quizQuestion is a randomized quiz question.
+type quizQuestion struct {
+	Type string `json:"type"`
+
+	// GUID of the headword that the question is about.
+	GUID string `json:"guid"`
+
+	// The headword (choice) or its scrambled letters (scramble).
+	Prompt string `json:"prompt"`
+
+	// The gloss of the headword for scrambled word questions.
+	Hint string `json:"hint,omitempty"`
+
+	// Choices of glosses for multiple choice questions.
+	Choices []string `json:"choices,omitempty"`
+
+	// The correct gloss (choice) or the headword (scramble).
+	Answer string `json:"answer"`
+}
+
+// handleGetQuiz returns randomized quiz questions drawn from the headwords of
+// a dictionary pair, optionally filtered by tags.
+func handleGetQuiz(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		fromLang = c.Param("fromLang")
+		toLang   = c.Param("toLang")
+		typ      = c.QueryParam("type")
+		tags     = c.QueryParams()["tag"]
+		num, _   = strconv.Atoi(c.QueryParam("num"))
+		nChoices = 4
+	)
+
+	if _, ok := app.data.Langs[fromLang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `from` language")
+	}
+	if _, ok := app.data.Langs[toLang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `to` language")
+	}
+
+	switch typ {
+	case "":
+		typ = quizChoice
+	case quizChoice, quizScramble:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown `type`. Should be choice|scramble")
+	}
+
+	if num == 0 {
+		num = 10
+	}
+	if num < 1 || num > maxQuizQuestions {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("`num` should be between 1 and %d", maxQuizQuestions))
+	}
+	if v := c.QueryParam("choices"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 || n > maxQuizChoices {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("`choices` should be between 2 and %d", maxQuizChoices))
+		}
+		nChoices = n
+	}
+
+	// Extra words are fetched for the wrong choices and for skipping words
+	// that are too short to scramble.
+	words, err := app.data.GetQuizWords(fromLang, toLang, tags, num*nChoices)
+	if err != nil {
+		app.lo.Printf("error fetching quiz words: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching quiz words")
+	}
+
+	var out []quizQuestion
+	if typ == quizChoice {
+		out = makeChoiceQuiz(words, num, nChoices)
+	} else {
+		out = makeScrambleQuiz(words, num)
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// makeChoiceQuiz returns up to num multiple choice questions from random words.
+// The wrong choices are the glosses of the other words.
+func makeChoiceQuiz(words []data.QuizWord, num, nChoices int) []quizQuestion {
+	out := []quizQuestion{}
+	for i := 0; i < len(words) && len(out) < num; i++ {
+		w := words[i]
+
+		choices := []string{w.Gloss}
+		for _, j := range rand.Perm(len(words)) {
+			if len(choices) == nChoices {
+				break
+			}
+			if g := words[j].Gloss; !hasFold(choices, g) {
+				choices = append(choices, g)
+			}
+		}
+
+		// Not enough distinct glosses for a question.
+		if len(choices) < 2 {
+			continue
+		}
+
+		rand.Shuffle(len(choices), func(a, b int) { choices[a], choices[b] = choices[b], choices[a] })
+		out = append(out, quizQuestion{
+			Type:    quizChoice,
+			GUID:    w.GUID,
+			Prompt:  w.Content,
+			Choices: choices,
+			Answer:  w.Gloss,
+		})
+	}
+
+	return out
+}
+
+// makeScrambleQuiz returns up to num scrambled word questions from random words.
+func makeScrambleQuiz(words []data.QuizWord, num int) []quizQuestion {
+	out := []quizQuestion{}
+	for _, w := range words {
+		if len(out) == num {
+			break
+		}
+		if utf8.RuneCountInString(strings.ReplaceAll(w.Content, " ", "")) < minScrambleLen {
+			continue
+		}
+
+		s, ok := scramble(w.Content)
+		if !ok {
+			continue
+		}
+
+		out = append(out, quizQuestion{
+			Type:   quizScramble,
+			GUID:   w.GUID,
+			Prompt: s,
+			Hint:   w.Gloss,
+			Answer: w.Content,
+		})
+	}
+
+	return out
+}
+
+// scramble shuffles the letters of every word in a string. It returns false
+// if the string couldn't be scrambled, eg: if all its letters are the same.
+func scramble(s string) (string, bool) {
+	words := strings.Fields(s)
+	for i := 0; i < 5; i++ {
+		out := make([]string, len(words))
+		for n, w := range words {
+			r := []rune(w)
+			rand.Shuffle(len(r), func(a, b int) { r[a], r[b] = r[b], r[a] })
+			out[n] = string(r)
+		}
+
+		if sc := strings.Join(out, " "); !strings.EqualFold(sc, strings.Join(words, " ")) {
+			return sc, true
+		}
+	}
+
+	return "", false
+}
+
+// hasFold checks whether a case insensitive string is in a list.
+func hasFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+
+	return false
+}
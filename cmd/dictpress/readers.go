@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/mailer"
+	"github.com/knadh/koanf/v2"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	readerCookie = "dictpress_reader"
+
+	defaultReaderEmail = `Click the link below to log in. It's valid for {{ .TTL }} and can be used once.
+
+{{ .URL }}
+
+If you didn't request this, you can ignore this e-mail.
+`
+
+	// Context key of the logged in reader's ID.
+	readerID = "reader_id"
+
+	// Min interval between login links e-mailed to an address.
+	readerLinkThrottle = time.Minute
+
+	// Max lengths of word list names and descriptions.
+	maxWordListName = 200
+	maxWordListDesc = 2000
+)
+
+type readerOpt struct {
+	SessionSecret  string        `koanf:"session_secret"`
+	SessionTTL     time.Duration `koanf:"session_ttl"`
+	LinkTTL        time.Duration `koanf:"link_ttl"`
+	DefaultList    string        `koanf:"default_list"`
+	MaxLists       int           `koanf:"max_lists"`
+	MaxListEntries int           `koanf:"max_list_entries"`
+	FeaturedLists  int           `koanf:"featured_lists"`
+	EmailSubject   string        `koanf:"email_subject"`
+	EmailBody      string        `koanf:"email_body"`
+}
+
+// readerAuth represents login for site visitors (readers) with links e-mailed to them.
+type readerAuth struct {
+	opt     readerOpt
+	secret  []byte
+	mailer  *mailer.Mailer
+	bodyTpl *template.Template
+}
+
+// readerSession represents a logged in reader's session stored in a signed cookie.
+type readerSession struct {
+	ID     int   `json:"id"`
+	Expiry int64 `json:"e"`
+}
+
+// initReaders initializes login for site visitors (readers).
+func initReaders(ko *koanf.Koanf) *readerAuth {
+	o := readerOpt{
+		SessionTTL:     time.Hour * 24 * 30,
+		LinkTTL:        time.Minute * 15,
+		DefaultList:    "Favorites",
+		MaxLists:       20,
+		MaxListEntries: 1000,
+		FeaturedLists:  5,
+		EmailSubject:   "Your login link",
+		EmailBody:      defaultReaderEmail,
+	}
+	if err := ko.Unmarshal("readers", &o); err != nil {
+		lo.Fatalf("error loading readers config: %v", err)
+	}
+	if o.EmailBody == "" {
+		o.EmailBody = defaultReaderEmail
+	}
+	if o.DefaultList == "" {
+		lo.Fatal("readers.default_list is empty")
+	}
+
+	var mo mailer.Opt
+	if err := ko.Unmarshal("readers.smtp", &mo); err != nil {
+		lo.Fatalf("error loading readers.smtp config: %v", err)
+	}
+	m, err := mailer.New(mo)
+	if err != nil {
+		lo.Fatalf("error initializing readers smtp: %v", err)
+	}
+
+	tpl, err := template.New("email").Parse(o.EmailBody)
+	if err != nil {
+		lo.Fatalf("error parsing readers.email_body: %v", err)
+	}
+
+	out := &readerAuth{
+		opt:     o,
+		secret:  []byte(o.SessionSecret),
+		mailer:  m,
+		bodyTpl: tpl,
+	}
+
+	// Without a configured secret, sessions don't survive restarts.
+	if len(out.secret) == 0 {
+		s, err := randomString(32)
+		if err != nil {
+			lo.Fatalf("error generating reader session secret: %v", err)
+		}
+		out.secret = []byte(s)
+	}
+
+	lo.Printf("reader accounts enabled")
+	return out
+}
+
+// handleReaderLoginRequest e-mails a login link to a reader. To not reveal
+// whether an address has an account, readers are created when they first log in.
+func handleReaderLoginRequest(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil || len(addr.Address) > 254 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `email`")
+	}
+	email := strings.ToLower(addr.Address)
+
+	token, err := randomString(32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	ok, err := app.data.InsertReaderToken(hashToken(token), email, app.readers.opt.LinkTTL, readerLinkThrottle)
+	if err != nil {
+		app.lo.Printf("error inserting reader login token: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error sending login link")
+	}
+
+	// A link was recently sent to the address.
+	if !ok {
+		return c.JSON(http.StatusOK, okResp{true})
+	}
+
+	var body bytes.Buffer
+	if err := app.readers.bodyTpl.Execute(&body, map[string]interface{}{
+		"URL":     app.consts.RootURL + "/readers/login/" + token,
+		"RootURL": app.consts.RootURL,
+		"TTL":     app.readers.opt.LinkTTL.String(),
+	}); err != nil {
+		app.lo.Printf("error compiling reader login e-mail: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error sending login link")
+	}
+
+	if err := app.readers.mailer.Send(email, app.readers.opt.EmailSubject, body.String()); err != nil {
+		app.lo.Printf("error e-mailing reader login link: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error sending login link")
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleReaderLogin logs a reader in with the token in an e-mailed login link
+// and redirects to the site.
+func handleReaderLogin(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	r, err := app.data.LoginReader(hashToken(c.Param("token")), app.readers.opt.DefaultList)
+	if err != nil {
+		status, msg := http.StatusInternalServerError, "Error logging in."
+		if err == sql.ErrNoRows {
+			status, msg = http.StatusBadRequest, "The login link is invalid or has expired."
+		} else {
+			app.lo.Printf("error logging reader in: %v", err)
+		}
+
+		if app.consts.Site == "" {
+			return echo.NewHTTPError(status, msg)
+		}
+		return c.Render(status, "message", pageTpl{
+			Title:       "Login",
+			Heading:     "Login",
+			Description: msg,
+		})
+	}
+
+	s := readerSession{ID: r.ID, Expiry: time.Now().Add(app.readers.opt.SessionTTL).Unix()}
+	c.SetCookie(app.newCookie(readerCookie, signCookie(app.readers.secret, s), time.Unix(s.Expiry, 0)))
+
+	return c.Redirect(http.StatusFound, app.consts.RootURL+"/")
+}
+
+// handleReaderLogout clears the reader's login session.
+func handleReaderLogout(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	c.SetCookie(app.newCookie(readerCookie, "", time.Unix(0, 0)))
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleGetReader returns the logged in reader.
+func handleGetReader(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	out, err := app.data.GetReader(c.Get(readerID).(int))
+	if err != nil {
+		// The reader has been deleted.
+		if err == sql.ErrNoRows {
+			c.SetCookie(app.newCookie(readerCookie, "", time.Unix(0, 0)))
+			return echo.NewHTTPError(http.StatusUnauthorized, "not logged in")
+		}
+
+		app.lo.Printf("error fetching reader: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching account")
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteReader deletes the logged in reader's account and word lists.
+func handleDeleteReader(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	if err := app.data.DeleteReader(c.Get(readerID).(int)); err != nil {
+		app.lo.Printf("error deleting reader: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error deleting account")
+	}
+
+	c.SetCookie(app.newCookie(readerCookie, "", time.Unix(0, 0)))
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleGetWordLists returns the logged in reader's word lists. If an entry
+// ?guid is given, has_entry is set on the lists that have it.
+func handleGetWordLists(c echo.Context) error {
+	var (
+		app  = c.Get("app").(*App)
+		guid = c.QueryParam("guid")
+	)
+
+	if guid != "" && !isEntryID(guid) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `guid`")
+	}
+
+	out, err := app.data.GetWordLists(c.Get(readerID).(int), guid)
+	if err != nil {
+		app.lo.Printf("error fetching word lists: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching word lists")
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetWordList returns one of the logged in reader's word lists with its entries.
+func handleGetWordList(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	l, err := getWordList(c, app)
+	if err != nil {
+		return err
+	}
+
+	entries, err := app.data.GetWordListEntries(l.ID)
+	if err != nil {
+		app.lo.Printf("error fetching word list entries: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching word list")
+	}
+
+	if err := app.data.SearchAndLoadRelations(entries, data.Query{Status: data.StatusEnabled}); err != nil {
+		app.lo.Printf("error fetching word list definitions: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching word list")
+	}
+	hideIDs(entries)
+
+	l.Entries = entries
+	return c.JSON(http.StatusOK, okResp{l})
+}
+
+// handleInsertWordList creates a word list for the logged in reader.
+func handleInsertWordList(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		rID = c.Get(readerID).(int)
+	)
+
+	l, err := bindWordList(c)
+	if err != nil {
+		return err
+	}
+
+	lists, err := app.data.GetWordLists(rID, "")
+	if err != nil {
+		app.lo.Printf("error fetching word lists: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating word list")
+	}
+	if len(lists) >= app.readers.opt.MaxLists {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("you can have up to %d word lists", app.readers.opt.MaxLists))
+	}
+
+	id, err := app.data.InsertWordList(rID, l)
+	if err != nil {
+		app.lo.Printf("error creating word list: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating word list")
+	}
+
+	out, err := app.data.GetWordList(id, rID)
+	if err != nil {
+		app.lo.Printf("error fetching word list: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching word list")
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateWordList updates one of the logged in reader's word lists. Making
+// a list public publishes it at /lists/$slug.
+func handleUpdateWordList(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		rID   = c.Get(readerID).(int)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	l, err := bindWordList(c)
+	if err != nil {
+		return err
+	}
+
+	if err := app.data.UpdateWordList(id, rID, l); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "word list not found")
+		}
+
+		app.lo.Printf("error updating word list: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error updating word list")
+	}
+
+	out, err := app.data.GetWordList(id, rID)
+	if err != nil {
+		app.lo.Printf("error fetching word list: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching word list")
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteWordList deletes one of the logged in reader's word lists.
+func handleDeleteWordList(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if err := app.data.DeleteWordList(id, c.Get(readerID).(int)); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "word list not found")
+		}
+
+		app.lo.Printf("error deleting word list: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error deleting word list")
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleInsertWordListEntry saves an entry to one of the logged in reader's word lists.
+func handleInsertWordListEntry(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	var req struct {
+		GUID string `json:"guid"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error parsing request: %v", err))
+	}
+	if !isEntryID(req.GUID) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `guid`")
+	}
+
+	l, err := getWordList(c, app)
+	if err != nil {
+		return err
+	}
+	if l.Total >= app.readers.opt.MaxListEntries {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("word lists can have up to %d words", app.readers.opt.MaxListEntries))
+	}
+
+	if err := app.data.InsertWordListEntry(l.ID, req.GUID); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "entry not found")
+		}
+
+		app.lo.Printf("error saving word list entry: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving word")
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleDeleteWordListEntry removes an entry from one of the logged in reader's word lists.
+func handleDeleteWordListEntry(c echo.Context) error {
+	var (
+		app  = c.Get("app").(*App)
+		guid = c.Param("guid")
+	)
+
+	if !isEntryID(guid) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `guid`")
+	}
+
+	l, err := getWordList(c, app)
+	if err != nil {
+		return err
+	}
+
+	if err := app.data.DeleteWordListEntry(l.ID, guid); err != nil {
+		app.lo.Printf("error deleting word list entry: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error removing word")
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// requireReader is a middleware that only allows requests from logged in readers.
+func requireReader(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		app := c.Get("app").(*App)
+
+		ck, err := c.Cookie(readerCookie)
+		if err != nil || ck.Value == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "not logged in")
+		}
+
+		var s readerSession
+		if err := verifyCookie(app.readers.secret, ck.Value, &s); err != nil || time.Now().Unix() > s.Expiry {
+			return echo.NewHTTPError(http.StatusUnauthorized, "not logged in")
+		}
+
+		c.Set(readerID, s.ID)
+		return next(c)
+	}
+}
+
+// getWordList returns the logged in reader's word list by the :id param.
+func getWordList(c echo.Context, app *App) (data.WordList, error) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id < 1 {
+		return data.WordList{}, echo.NewHTTPError(http.StatusBadRequest, "invalid `id`")
+	}
+
+	out, err := app.data.GetWordList(id, c.Get(readerID).(int))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusNotFound, "word list not found")
+		}
+
+		app.lo.Printf("error fetching word list: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError, "error fetching word list")
+	}
+
+	return out, nil
+}
+
+// bindWordList returns the validated word list fields in a request.
+func bindWordList(c echo.Context) (data.WordList, error) {
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return data.WordList{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	out := data.WordList{
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		Public:      req.Public,
+	}
+	var v validator
+	if v.required("name", out.Name) {
+		v.maxLen("name", out.Name, maxWordListName)
+	}
+	v.maxLen("description", out.Description, maxWordListDesc)
+
+	return out, v.err()
+}
+
+// hashToken returns the SHA256 hash of a login token, which is what's stored in the DB.
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// Maximum number of redirects that can be upserted in one request.
+const maxBulkRedirects = 10000
+
+// redirects represents a page of redirects.
+type redirects struct {
+	Redirects  []data.Redirect `json:"redirects"`
+	Page       int             `json:"page"`
+	PerPage    int             `json:"per_page"`
+	TotalPages int             `json:"total_pages"`
+	Total      int             `json:"total"`
+}
+
+func (r *redirects) pageMeta() *apiMeta {
+	return &apiMeta{Page: r.Page, PerPage: r.PerPage, TotalPages: r.TotalPages, Total: r.Total}
+}
+
+// handleGetRedirects returns paginated redirects, optionally with the source
+// or target containing ?q.
+func handleGetRedirects(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		pg  = app.resultsPg.NewFromURL(c.Request().URL.Query())
+	)
+
+	res, total, err := app.data.GetRedirects(strings.TrimSpace(c.QueryParam("q")), pg.Offset, pg.Limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching redirects: %v", err))
+	}
+
+	pg.SetTotal(total)
+	return c.JSON(http.StatusOK, okResp{&redirects{res, pg.Page, pg.PerPage, pg.TotalPages, total}})
+}
+
+// handleInsertRedirect inserts a redirect.
+func handleInsertRedirect(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	r, err := bindRedirect(c)
+	if err != nil {
+		return err
+	}
+
+	out, err := app.data.InsertRedirect(r)
+	if err != nil {
+		return redirectError(err)
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpsertRedirects inserts a list of redirects in bulk, eg: when migrating
+// from another platform, replacing the targets of existing sources.
+func handleUpsertRedirects(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	var req []data.Redirect
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+	if len(req) == 0 || len(req) > maxBulkRedirects {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("there should be 1 to %d redirects.", maxBulkRedirects))
+	}
+
+	// The last redirect of a source in the list wins.
+	var (
+		rs  = make([]data.Redirect, 0, len(req))
+		pos = make(map[string]int, len(req))
+		v   validator
+	)
+	for i, r := range req {
+		r = validateRedirect(r, &v, fmt.Sprintf("[%d].", i))
+
+		if n, ok := pos[r.Source]; ok {
+			rs[n] = r
+			continue
+		}
+		pos[r.Source] = len(rs)
+		rs = append(rs, r)
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	if isDryRun(c) {
+		out, err := app.data.PreviewUpsertRedirects(rs)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error previewing redirects: %v", err))
+		}
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	n, err := app.data.UpsertRedirects(rs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error saving redirects: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{n})
+}
+
+// handleUpdateRedirect updates a redirect.
+func handleUpdateRedirect(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `id`.")
+	}
+
+	r, err := bindRedirect(c)
+	if err != nil {
+		return err
+	}
+
+	out, err := app.data.UpdateRedirect(id, r)
+	if err != nil {
+		return redirectError(err)
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteRedirect deletes a redirect.
+func handleDeleteRedirect(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if err := app.data.DeleteRedirect(id); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "redirect not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error deleting redirect: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// matchRedirect returns the URL and the status code of the redirect of a
+// request URL's path (with or without the query string or a trailing slash).
+func matchRedirect(u *url.URL, app *App) (string, int, bool) {
+	srcs := make([]string, 0, 3)
+
+	if u.RawQuery != "" {
+		srcs = append(srcs, u.Path+"?"+u.RawQuery)
+	}
+	srcs = append(srcs, u.Path)
+	if p := strings.TrimRight(u.Path, "/"); p != "" && p != u.Path {
+		srcs = append(srcs, p)
+	}
+
+	r, err := app.data.MatchRedirect(srcs)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			app.lo.Printf("error looking up redirect: %v", err)
+		}
+		return "", 0, false
+	}
+
+	// Paths are relative to the root URL.
+	if strings.HasPrefix(r.Target, "/") {
+		return app.consts.RootURL + r.Target, r.Code, true
+	}
+
+	return r.Target, r.Code, true
+}
+
+// bindRedirect binds and validates a redirect in a request.
+func bindRedirect(c echo.Context) (data.Redirect, error) {
+	var r data.Redirect
+	if err := c.Bind(&r); err != nil {
+		return r, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	var v validator
+	r = validateRedirect(r, &v, "")
+
+	return r, v.err()
+}
+
+// validateRedirect validates a redirect and sets the default status code.
+// Errors are added to the validator with the field names prefixed.
+func validateRedirect(r data.Redirect, v *validator, prefix string) data.Redirect {
+	r.Source = strings.TrimSpace(r.Source)
+	r.Target = strings.TrimSpace(r.Target)
+
+	if !strings.HasPrefix(r.Source, "/") || strings.HasPrefix(r.Source, "//") {
+		v.add(prefix+"source", "should be a path beginning with /")
+	}
+	for _, p := range []string{"/api", "/admin"} {
+		if r.Source == p || strings.HasPrefix(r.Source, p+"/") || strings.HasPrefix(r.Source, p+"?") {
+			v.add(prefix+"source", "%s paths can't be redirected", p)
+		}
+	}
+
+	if !(strings.HasPrefix(r.Target, "/") && !strings.HasPrefix(r.Target, "//")) &&
+		!strings.HasPrefix(r.Target, "http://") && !strings.HasPrefix(r.Target, "https://") {
+		v.add(prefix+"target", "should be a path beginning with / or an http(s) URL")
+	} else if r.Target == r.Source {
+		v.add(prefix+"target", "can't be the same as `source`")
+	}
+
+	switch r.Code {
+	case 0:
+		r.Code = http.StatusMovedPermanently
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		v.add(prefix+"code", "should be 301, 302, 307, or 308")
+	}
+
+	return r
+}
+
+// redirectError returns the HTTP error for an error saving a redirect.
+func redirectError(err error) error {
+	if err == sql.ErrNoRows {
+		return echo.NewHTTPError(http.StatusNotFound, "redirect not found")
+	}
+	if p, ok := err.(*pq.Error); ok && p.Code == "23505" {
+		return echo.NewHTTPError(http.StatusBadRequest, "a redirect for the `source` already exists.")
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError,
+		fmt.Sprintf("error saving redirect: %v", err))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Number of definitions scanned in one batch by find-and-replace.
+	replaceBatchSize = 1000
+
+	// Max number of changes in find-and-replace previews.
+	replacePreviewLimit = 100
+)
+
+// replacement is a change to the content of a definition by find-and-replace.
+type replacement struct {
+	ID       int    `json:"id"`
+	Lang     string `json:"lang"`
+	Content  string `json:"content"`
+	Replaced string `json:"replaced"`
+}
+
+// replacer finds and replaces literal text or regular expression matches in
+// the content of definitions.
+type replacer struct {
+	find string
+	repl string
+	re   *regexp.Regexp
+}
+
+// newReplacer returns a replacer. With isRegex, find is a regular expression
+// (RE2 syntax) and repl can reference its groups ($1, ${name}).
+func newReplacer(find, repl string, isRegex bool) (*replacer, error) {
+	if find == "" {
+		return nil, errors.New("the text to find is required")
+	}
+
+	r := &replacer{find: find, repl: repl}
+	if isRegex {
+		re, err := regexp.Compile(find)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression to find: %v", err)
+		}
+		r.re = re
+	}
+
+	return r, nil
+}
+
+// replace returns the content with the matches replaced and whether it changed.
+func (r *replacer) replace(s string) (string, bool) {
+	var out string
+	if r.re != nil {
+		out = r.re.ReplaceAllString(s, r.repl)
+	} else {
+		out = strings.ReplaceAll(s, r.find, r.repl)
+	}
+
+	return out, out != s
+}
+
+// scanReplacements scans the definitions that match the filter in batches and
+// calls fn with the ones whose content is changed by the replacer, till fn
+// returns false. Definitions whose content would be empty are skipped, and
+// their number is returned.
+func scanReplacements(ctx context.Context, r *replacer, f data.ReplaceFilter, app *App, fn func(replacement) (bool, error)) (int, error) {
+	// Literal text is matched in the DB to skip the definitions that don't have it.
+	text := ""
+	if r.re == nil {
+		text = r.find
+	}
+
+	var lastID, skipped int
+	for {
+		if err := ctx.Err(); err != nil {
+			return skipped, err
+		}
+
+		entries, err := app.data.GetReplaceEntries(lastID, replaceBatchSize, f, text)
+		if err != nil {
+			return skipped, fmt.Errorf("error fetching definitions: %v", err)
+		}
+		if len(entries) == 0 {
+			return skipped, nil
+		}
+
+		for _, e := range entries {
+			lastID = e.ID
+
+			out, ok := r.replace(e.Content)
+			if !ok {
+				continue
+			}
+			if strings.TrimSpace(out) == "" {
+				skipped++
+				continue
+			}
+
+			more, err := fn(replacement{ID: e.ID, Lang: e.Lang, Content: e.Content, Replaced: out})
+			if err != nil || !more {
+				return skipped, err
+			}
+		}
+	}
+}
+
+// makeReplaceFilter makes the filter of the definitions of a find-and-replace
+// from the definition languages and tags.
+func makeReplaceFilter(langs, tags []string, app *App) (data.ReplaceFilter, error) {
+	var f data.ReplaceFilter
+	for _, l := range langs {
+		if _, ok := app.data.Langs[l]; !ok {
+			return f, fmt.Errorf("unknown language '%s'", l)
+		}
+	}
+	f.Langs = langs
+
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t != "" {
+			f.Tags = append(f.Tags, t)
+		}
+	}
+
+	return f, nil
+}
+
+// handleReplacePreview returns the changes that a find-and-replace job with
+// the given params would make to definitions, up to replacePreviewLimit, with
+// their content before and after.
+func handleReplacePreview(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		q   = c.QueryParams()
+	)
+
+	r, err := newReplacer(q.Get("find"), q.Get("replace"), q.Get("regex") == "true")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	f, err := makeReplaceFilter(q["lang"], q["tag"], app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out := []replacement{}
+	if _, err := scanReplacements(c.Request().Context(), r, f, app, func(rp replacement) (bool, error) {
+		out = append(out, rp)
+		return len(out) < replacePreviewLimit, nil
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// runReplaceJob finds and replaces text in the content of the definitions
+// that match the job's filters. Every change is recorded in the audit log with
+// the definition's content before and after. Definitions that are edited while
+// the job runs are left as they are.
+func runReplaceJob(ctx context.Context, p jobParams, l *log.Logger, app *App) (string, error) {
+	r, err := newReplacer(p.Find, p.Replace, p.Regex)
+	if err != nil {
+		return "", err
+	}
+	f, err := makeReplaceFilter(p.Langs, p.Tags, app)
+	if err != nil {
+		return "", err
+	}
+
+	n := 0
+	skipped, err := scanReplacements(ctx, r, f, app, func(rp replacement) (bool, error) {
+		if p.DryRun {
+			n++
+			return true, nil
+		}
+
+		before, after, err := app.data.ReplaceEntryContent(rp.ID, rp.Lang, rp.Content, rp.Replaced)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				l.Printf("skipping entry %d as it was changed while replacing", rp.ID)
+				return true, nil
+			}
+			return false, fmt.Errorf("error updating entry %d: %v", rp.ID, err)
+		}
+
+		a := data.AuditLog{
+			Username: p.user,
+			Method:   http.MethodPut,
+			Endpoint: fmt.Sprintf("/api/jobs/%d", p.jobID),
+			Entity:   "entry",
+			EntityID: rp.ID,
+			Before:   before,
+			After:    after,
+		}
+		if err := app.data.InsertAuditLog(a); err != nil {
+			l.Printf("error recording audit log of entry %d: %v", rp.ID, err)
+		}
+
+		n++
+		if n%replaceBatchSize == 0 {
+			l.Printf("replaced %d definitions", n)
+		}
+		return true, nil
+	})
+	if skipped > 0 {
+		l.Printf("skipped %d definitions that would be empty", skipped)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if p.DryRun {
+		return fmt.Sprintf("%d definitions would change", n), nil
+	}
+	return fmt.Sprintf("%d definitions", n), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+// missingRefs represents a page of definitions that refer to missing headwords.
+type missingRefs struct {
+	Refs       []data.MissingRef `json:"refs"`
+	Page       int               `json:"page"`
+	PerPage    int               `json:"per_page"`
+	TotalPages int               `json:"total_pages"`
+	Total      int               `json:"total"`
+}
+
+func (m *missingRefs) pageMeta() *apiMeta {
+	return &apiMeta{Page: m.Page, PerPage: m.PerPage, TotalPages: m.TotalPages, Total: m.Total}
+}
+
+// handleGetMissingTranslations returns the headwords in a language (from_lang)
+// that have no definitions in another language (to_lang), optionally with any
+// of the given tags (?tag), most frequent first, as a worklist for editors.
+func handleGetMissingTranslations(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		q   = c.QueryParams()
+		pg  = app.resultsPg.NewFromURL(q)
+
+		fromLang = q.Get("from_lang")
+		toLang   = q.Get("to_lang")
+	)
+
+	for _, l := range []string{fromLang, toLang} {
+		if _, ok := app.data.Langs[l]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown language `%s`.", l))
+		}
+	}
+	if fromLang == toLang {
+		return echo.NewHTTPError(http.StatusBadRequest, "`from_lang` and `to_lang` should be different.")
+	}
+
+	res, total, err := app.data.GetMissingTranslations(fromLang, toLang, q["tag"], pg.Offset, pg.Limit)
+	if err != nil {
+		app.lo.Printf("error fetching missing translations: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching missing translations")
+	}
+
+	// The headwords' definitions in other languages are loaded to help translate them.
+	if len(res) > 0 {
+		if err := app.data.SearchAndLoadRelations(res, data.Query{}); err != nil {
+			app.lo.Printf("error querying db for defs: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	pg.SetTotal(total)
+
+	out := &results{Entries: res}
+	out.Page = pg.Page
+	out.PerPage = pg.PerPage
+	out.TotalPages = pg.TotalPages
+	out.Total = total
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetMissingRefs returns the definitions that refer to other headwords,
+// eg: cross-references, where the referred headwords are disabled or have no
+// definitions, optionally filtered by the headwords' language (?lang) and the
+// definitions' tags (?tag).
+func handleGetMissingRefs(c echo.Context) error {
+	var (
+		app  = c.Get("app").(*App)
+		q    = c.QueryParams()
+		pg   = app.resultsPg.NewFromURL(q)
+		lang = q.Get("lang")
+	)
+
+	if _, ok := app.data.Langs[lang]; lang != "" && !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown language `%s`.", lang))
+	}
+
+	res, total, err := app.data.GetMissingRefs(lang, q["tag"], pg.Offset, pg.Limit)
+	if err != nil {
+		app.lo.Printf("error fetching missing references: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching missing references")
+	}
+
+	pg.SetTotal(total)
+	return c.JSON(http.StatusOK, okResp{&missingRefs{res, pg.Page, pg.PerPage, pg.TotalPages, total}})
+}
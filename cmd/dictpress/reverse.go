@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/importer"
+)
+
+// Number of definitions read in one batch for reverse generation.
+const reverseBatchSize = 1000
+
+// generateReverse generates the toLang -> fromLang dictionary from the
+// definitions of the fromLang -> toLang dictionary (see importer.GenerateReverse).
+func generateReverse(ctx context.Context, fromLang, toLang string, dryRun bool, app *App, l *log.Logger) error {
+	imp := importer.New(app.data.Langs, app.queries.ImportStaged, app.db, dryRun, l).WithContext(ctx)
+	if dryRun {
+		l.Println("dry run. nothing will be inserted into the database")
+	}
+
+	l.Printf("generating %s-%s from %s-%s ...", toLang, fromLang, fromLang, toLang)
+	return imp.GenerateReverse(fromLang, toLang, func(afterID int) ([]data.ReverseDef, error) {
+		return app.data.GetReverseDefs(fromLang, toLang, importer.TagGenerated, afterID, reverseBatchSize)
+	})
+}
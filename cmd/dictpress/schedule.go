@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// Interval at which the entries scheduled for publishing are checked.
+const publishInterval = time.Minute
+
+// handleScheduleEntry sets the time at which a disabled or pending entry is
+// published (enabled), or unschedules it if publish_at is null.
+func handleScheduleEntry(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	var req struct {
+		PublishAt null.Time `json:"publish_at"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+	if req.PublishAt.Valid && req.PublishAt.Time.Before(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "`publish_at` should be in the future.")
+	}
+
+	if err := app.data.ScheduleEntry(id, req.PublishAt); err != nil {
+		if err == sql.ErrNoRows {
+			if _, err := app.data.GetEntry(id); err == sql.ErrNoRows {
+				return echo.NewHTTPError(http.StatusNotFound, "entry not found")
+			}
+			return echo.NewHTTPError(http.StatusBadRequest,
+				"only disabled or pending entries can be scheduled for publishing.")
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error scheduling entry: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleGetScheduledEntries returns the entries scheduled for publishing with
+// their definitions, soonest first, eg: for an editorial calendar.
+func handleGetScheduledEntries(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		pg  = app.resultsPg.NewFromURL(c.Request().URL.Query())
+	)
+
+	res, total, err := app.data.GetScheduledEntries(pg.Offset, pg.Limit)
+	if err != nil {
+		app.lo.Printf("error fetching scheduled entries: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching scheduled entries")
+	}
+
+	if len(res) > 0 {
+		if err := app.data.SearchAndLoadRelations(res, data.Query{}); err != nil {
+			app.lo.Printf("error querying db for defs: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	pg.SetTotal(total)
+
+	out := &results{Entries: res}
+	out.Page = pg.Page
+	out.PerPage = pg.PerPage
+	out.TotalPages = pg.TotalPages
+	out.Total = total
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// runPublisher periodically publishes the scheduled entries that are due.
+// It's a blocking function that should be run as a goroutine.
+func runPublisher(app *App) {
+	for {
+		langs, err := app.data.PublishScheduled()
+		if err != nil {
+			app.lo.Printf("error publishing scheduled entries: %v", err)
+		}
+
+		if len(langs) > 0 {
+			app.lo.Printf("published scheduled entries in %s", strings.Join(langs, ", "))
+
+			// With cluster sync, the caches of all the instances are reset
+			// by the entry change events sent by the DB.
+			if app.cluster == nil {
+				for _, l := range langs {
+					app.views.resetPopular(l)
+				}
+			}
+		}
+
+		time.Sleep(publishInterval)
+	}
+}
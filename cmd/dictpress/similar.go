@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+// Max number of similar entries that can be requested.
+const maxSimilarEntries = 50
+
+type similarOpt struct {
+	Strategy   string `koanf:"strategy"`
+	NumEntries int    `koanf:"num_entries"`
+	OnPages    bool   `koanf:"show_on_pages"`
+}
+
+// handleGetSimilarEntries returns headwords similar to an entry by the
+// configured or the given (?strategy) similarity strategy.
+func handleGetSimilarEntries(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		guid     = c.Param("guid")
+		strategy = c.QueryParam("strategy")
+		limit, _ = strconv.Atoi(c.QueryParam("limit"))
+	)
+
+	if !isEntryID(guid) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `guid`")
+	}
+	if strategy == "" {
+		strategy = app.consts.Similar.Strategy
+	}
+	if limit == 0 {
+		limit = app.consts.Similar.NumEntries
+	}
+	if limit < 1 || limit > maxSimilarEntries {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("`limit` should be between 1 and %d", maxSimilarEntries))
+	}
+
+	e, err := app.data.GetEntryByGUID(guid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "entry not found")
+		}
+
+		app.lo.Printf("error fetching entry: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching entry")
+	}
+
+	out, err := getSimilarEntries(strategy, e, limit, c.Get(isAuthed) != nil, app)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// getSimilarEntries returns entries similar to an entry with their definitions.
+func getSimilarEntries(strategy string, e data.Entry, limit int, isAuthed bool, app *App) ([]data.Entry, error) {
+	known := false
+	for _, s := range app.data.SimilarStrategies() {
+		if s == strategy {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown `strategy`. Should be one of %v", app.data.SimilarStrategies()))
+	}
+
+	out, err := app.data.GetSimilarEntries(strategy, e, limit)
+	if err != nil {
+		app.lo.Printf("error fetching similar entries: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "error fetching similar entries")
+	}
+
+	if err := app.data.SearchAndLoadRelations(out, data.Query{Status: data.StatusEnabled}); err != nil {
+		app.lo.Printf("error fetching similar entry definitions: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "error fetching similar entries")
+	}
+
+	if !isAuthed {
+		hideIDs(out)
+	}
+
+	return out, nil
+}
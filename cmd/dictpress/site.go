@@ -3,20 +3,22 @@ package main
 import (
 	"bytes"
 	"crypto/md5"
+	"database/sql"
 	"fmt"
 	"html/template"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/sanitize"
 	"github.com/knadh/go-i18n"
 	"github.com/knadh/paginator"
+	"github.com/knadh/stuffbin"
 	"github.com/labstack/echo/v4"
 )
 
@@ -25,6 +27,7 @@ const (
 	pageSearch   = "search"
 	pageGlossary = "glossary"
 	pageStatic   = "static"
+	pageError    = "error"
 )
 
 type pageTpl struct {
@@ -43,6 +46,34 @@ type pageTpl struct {
 	Initials []string
 	Pg       *paginator.Set
 	PgBar    template.HTML
+
+	// Structured pagination and glossary initial links for themes to render.
+	Pagination   *pagination
+	InitialLinks []pageLink
+
+	// Optional schema.org JSON-LD structured data for the page's <head>.
+	JSONLD interface{}
+
+	// Etymology chains of the entry on word pages.
+	Etymology *data.Etymology
+
+	// Related headwords of the entry on word pages (if similar.show_on_pages is on).
+	Similar []data.Entry
+
+	// Public word list on list pages, and the lists featured by the admin on
+	// the index page (if readers are enabled).
+	WordList      *data.WordList
+	FeaturedLists []data.WordList
+
+	// HTTP status code and the message on error pages.
+	Status  int
+	Message string
+
+	// Canonical URL of the page, and on entry permalink pages, the permalinks
+	// of the entry's definitions in other languages and the breadcrumbs.
+	Canonical   string
+	Alternates  []altLink
+	Breadcrumbs []pageLink
 }
 
 // tplData is the data container that is injected
@@ -58,11 +89,58 @@ type tplData struct {
 	AssetVer string
 	Path     string
 	Data     interface{}
+
+	app   *App
+	theme *siteTheme
+}
+
+// Asset returns the URL of a file in the theme's static directory with a
+// fingerprint of its contents in the name, eg: {{ .Asset "style.css" }}
+func (t tplData) Asset(name string) string {
+	th := t.theme
+	if th == nil {
+		th = t.app.themes.def
+	}
+
+	return t.Consts.RootURL + th.asset(name)
+}
+
+// License returns the license of the dictionary of the page (the searched
+// dictionary pair) or the default license, and nil if there's none, eg:
+// {{ with .License }}{{ .Attribution }}{{ end }}.
+func (t tplData) License() *data.License {
+	var from, to string
+	if p, ok := t.Data.(pageTpl); ok && p.Query != nil {
+		from, to = p.Query.FromLang, p.Query.ToLang
+	}
+
+	l := t.app.data.GetLicense(from, to)
+	if l == (data.License{}) {
+		return nil
+	}
+
+	return &l
 }
 
-// tplRenderer wraps a template.tplRenderer for echo.
+// Popular returns the most viewed headwords in a language in the past given
+// days with their definitions, eg: {{ range .Popular "english" 7 10 }}.
+func (t tplData) Popular(lang string, days, limit int) []data.Entry {
+	if days < 1 || days > t.app.views.opt.RetentionDays || limit < 1 || limit > maxPopularEntries {
+		return nil
+	}
+
+	out, err := t.app.views.getPopular(lang, days, limit, t.app)
+	if err != nil {
+		t.app.lo.Printf("error fetching popular entries: %v", err)
+		return nil
+	}
+
+	return out
+}
+
+// tplRenderer renders site templates with the theme of the request for echo.
 type tplRenderer struct {
-	tpls *template.Template
+	themes *siteThemes
 }
 
 // Random hash that changes every time the program boots, to append as
@@ -76,8 +154,20 @@ func init() {
 
 // handleIndexPage renders the homepage.
 func handleIndexPage(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	var featured []data.WordList
+	if app.readers != nil && app.readers.opt.FeaturedLists > 0 {
+		res, _, err := app.data.GetPublicWordLists(true, 0, app.readers.opt.FeaturedLists)
+		if err != nil {
+			app.lo.Printf("error fetching featured word lists: %v", err)
+		}
+		featured = res
+	}
+
 	return c.Render(http.StatusOK, "index", pageTpl{
-		PageType: pageIndex,
+		PageType:      pageIndex,
+		FeaturedLists: featured,
 	})
 }
 
@@ -85,17 +175,100 @@ func handleIndexPage(c echo.Context) error {
 func handleSearchPage(c echo.Context) error {
 	query, res, err := doSearch(c, false)
 	if err != nil {
-		return c.Render(http.StatusInternalServerError, "message", pageTpl{
-			Title:       "Error",
-			Heading:     "Error",
-			Description: err.Error(),
-		})
+		return renderError(c, http.StatusInternalServerError, err.Error())
 	}
 
 	return c.Render(http.StatusOK, "search", pageTpl{
 		PageType: pageSearch,
 		Results:  res,
 		Query:    &query,
+		JSONLD:   makeSearchJSONLD(res, c.Get("app").(*App)),
+	})
+}
+
+// handleWordPage renders the permalink page of an entry by its language and slug.
+// Old slugs of entries redirect to their current slugs.
+func handleWordPage(c echo.Context) error {
+	var (
+		app     = c.Get("app").(*App)
+		lang    = c.Param("lang")
+		slug, _ = url.PathUnescape(c.Param("slug"))
+	)
+
+	notFound := func() error {
+		return renderError(c, http.StatusNotFound, "Page not found.")
+	}
+
+	e, err := app.data.GetEntryBySlug(lang, slug)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			app.lo.Printf("error fetching entry by slug: %v", err)
+			return renderError(c, http.StatusInternalServerError, "Error fetching entry.")
+		}
+
+		// The slug may have changed.
+		newSlug, err := app.data.GetSlugRedirect(lang, slug)
+		if err != nil {
+			return notFound()
+		}
+		return c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("%s/word/%s/%s", app.consts.RootURL, url.PathEscape(lang), url.PathEscape(newSlug)))
+	}
+
+	if e.Status != data.StatusEnabled {
+		return notFound()
+	}
+
+	// A permalink visit is a click-through for the popularity ranking.
+	app.views.add(e.GUID, viewer(c, app))
+
+	// Load the definitions and hide the numerical IDs as in public searches.
+	res := []data.Entry{e}
+	if err := app.data.SearchAndLoadRelations(res, data.Query{Status: data.StatusEnabled}); err != nil {
+		app.lo.Printf("error fetching entry definitions: %v", err)
+		return renderError(c, http.StatusInternalServerError, "Error fetching entry.")
+	}
+	hideIDs(res)
+
+	etym, err := app.data.GetEtymology(e, defaultEtymologyDepth)
+	if err != nil {
+		app.lo.Printf("error fetching etymology: %v", err)
+	}
+
+	var similar []data.Entry
+	if app.consts.Similar.OnPages {
+		if similar, err = getSimilarEntries(app.consts.Similar.Strategy, e, app.consts.Similar.NumEntries, false, app); err != nil {
+			similar = nil
+		}
+	}
+
+	var (
+		query = data.Query{Query: e.Content, FromLang: lang}
+		out   = &results{Entries: res}
+	)
+	out.Query.Query = e.Content
+	out.Query.FromLang = lang
+	out.Query.Types = []string{}
+	out.Query.Tags = []string{}
+	out.Total = 1
+
+	// Themes can have a dedicated entry page template.
+	tpl, pageType := pageSearch, pageSearch
+	if app.theme(c).tpl.Lookup(pageEntry) != nil {
+		tpl, pageType = pageEntry, pageEntry
+	}
+
+	rootURL := app.rootURL(c)
+	return c.Render(http.StatusOK, tpl, pageTpl{
+		PageType:    pageType,
+		Title:       e.Content,
+		Results:     out,
+		Query:       &query,
+		JSONLD:      makeEntryJSONLD(res[0], app),
+		Etymology:   &etym,
+		Similar:     similar,
+		Canonical:   entryURL(rootURL, e.Lang, e.Slug),
+		Alternates:  makeEntryAlternates(res[0], rootURL, app),
+		Breadcrumbs: makeEntryBreadcrumbs(res[0], rootURL, app),
 	})
 }
 
@@ -104,11 +277,7 @@ func handleSubmissionPage(c echo.Context) error {
 	if c.Request().Method == http.MethodPost {
 		if err := handleNewSubmission(c); err != nil {
 			e := err.(*echo.HTTPError)
-			return c.Render(e.Code, "message", pageTpl{
-				Title:       "Error",
-				Heading:     "Error",
-				Description: fmt.Sprintf("%s", e.Message),
-			})
+			return renderError(c, e.Code, fmt.Sprintf("%s", e.Message))
 		}
 
 		return c.Render(http.StatusOK, "message", pageTpl{
@@ -134,14 +303,10 @@ func handleGlossaryPage(c echo.Context) error {
 	)
 
 	// Get the alphabets.
-	initials, err := app.data.GetInitials(fromLang)
+	initials, err := app.getInitials(fromLang)
 	if err != nil {
 		app.lo.Printf("error getting initials: %v", err)
-		return c.Render(http.StatusInternalServerError, "message", pageTpl{
-			Title:       "Error",
-			Heading:     "Error",
-			Description: "Error fetching glossary initials.",
-		})
+		return renderError(c, http.StatusInternalServerError, "Error fetching glossary initials.")
 	}
 
 	if len(initials) == 0 {
@@ -166,25 +331,36 @@ func handleGlossaryPage(c echo.Context) error {
 	gloss, err := getGlossaryWords(fromLang, initial, pg, app)
 	if err != nil {
 		app.lo.Printf("error getting glossary words: %v", err)
-		return c.Render(http.StatusInternalServerError, "message", pageTpl{
-			Title:       "Error",
-			Heading:     "Error",
-			Description: "Error fetching glossary words.",
-		})
+		return renderError(c, http.StatusInternalServerError, "Error fetching glossary words.")
 	}
 
 	gloss.FromLang = fromLang
 	gloss.ToLang = toLang
 	pg.SetTotal(gloss.Total)
 
+	var (
+		rootURL   = app.rootURL(c)
+		pgn       = makePagination(pg, app.consts.GlossaryPageNums, glossaryURL(rootURL, fromLang, toLang, initial))
+		canonical = pgn.FirstURL
+	)
+	for _, p := range pgn.Pages {
+		if p.Current {
+			canonical = p.URL
+		}
+	}
+
 	// Render the results.
 	return c.Render(http.StatusOK, "glossary", pageTpl{
-		PageType: pageGlossary,
-		Initial:  initial,
-		Initials: initials,
-		Glossary: gloss,
-		Pg:       &pg,
-		PgBar:    template.HTML(pg.HTML("?page=%d")),
+		PageType:     pageGlossary,
+		Initial:      initial,
+		Initials:     initials,
+		InitialLinks: makeInitialLinks(initials, initial, fromLang, toLang, rootURL),
+		Glossary:     gloss,
+		Pg:           &pg,
+		PgBar:        template.HTML(pg.HTML("?page=%d")),
+		Pagination:   pgn,
+		Canonical:    canonical,
+		JSONLD:       makeGlossaryJSONLD(gloss, app),
 	})
 }
 
@@ -195,49 +371,114 @@ func handleStaticPage(c echo.Context) error {
 		id  = strings.TrimRight(c.Param("page"), "/")
 	)
 
-	tpl, ok := app.sitePageTpls[id]
+	theme := app.theme(c)
+	tpl, ok := theme.pages[id]
 	if !ok {
-		return c.Render(http.StatusNotFound, "message", pageTpl{
-			Title:   "404",
-			Heading: "Page not found",
-		})
+		return renderError(c, http.StatusNotFound, "Page not found.")
 	}
 
 	// Render the body.
 	b := bytes.Buffer{}
 
-	if err := tpl.ExecuteTemplate(&b, "page-"+id, tplData{
-		Path:     c.Path(),
-		AssetVer: assetVer,
-		Consts:   app.consts,
-		Langs:    app.data.Langs,
-		Dicts:    app.data.Dicts,
-		L:        app.i18n,
-		Data: pageTpl{
-			PageType: pageStatic,
-			PageID:   id,
-		},
-	}); err != nil {
+	if err := tpl.ExecuteTemplate(&b, "page-"+id, theme.tplData(app.newTplData(c.Path(), pageTpl{
+		PageType: pageStatic,
+		PageID:   id,
+	}))); err != nil {
 		return err
 	}
 
 	return c.HTMLBlob(http.StatusOK, b.Bytes())
 }
 
+// renderError renders an error page with the theme's `error` template, or if
+// the theme doesn't have one, the `message` template.
+func renderError(c echo.Context, code int, msg string) error {
+	app := c.Get("app").(*App)
+
+	tpl := "error"
+	if app.theme(c).tpl.Lookup(tpl) == nil {
+		tpl = "message"
+	}
+
+	// The description is redundant if it's the default text of the status.
+	title := fmt.Sprintf("%d %s", code, http.StatusText(code))
+	desc := msg
+	if msg == http.StatusText(code) {
+		desc = ""
+	}
+
+	return c.Render(code, tpl, pageTpl{
+		PageType:    pageError,
+		Title:       title,
+		Heading:     title,
+		Description: desc,
+		Status:      code,
+		Message:     msg,
+	})
+}
+
+// isSitePath checks whether a request is for a public site path and not for
+// the APIs or the admin.
+func isSitePath(c echo.Context) bool {
+	p := c.Request().URL.Path
+	for _, prefix := range []string{"/api", "/admin"} {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return false
+		}
+	}
+
+	return true
+}
+
 // loadSite loads HTML site theme templates and any additional pages (in the `pages/` dir)
 // in a map indexed by the page's template name in {{ define "page-$name" }}.
-func loadSite(rootPath string, loadPages bool) (*template.Template, map[string]*template.Template, error) {
+// HTML rendered from Markdown in templates is sanitized by the given policy, or
+// the policy of the content's language.
+func loadSite(fs stuffbin.FileSystem, loadPages bool, pol *sanitize.Policy, langs data.LangMap) (*template.Template, map[string]*template.Template, error) {
 	theme := template.New("site").Funcs(sprig.FuncMap())
 
 	// Go percentage encodes unicode characters printed in <a href>,
 	// but the encoded values are in lowercase hex (for some reason)
 	// See: https://github.com/golang/go/issues/33596
 	theme.Funcs(template.FuncMap{"UnicodeURL": func(s string) template.URL {
-		s = strings.ReplaceAll(s, " ", "+")
-		return template.URL(url.PathEscape(s))
+		return template.URL(escapeWordURL(s))
 	}})
 
-	if _, err := theme.ParseGlob(rootPath + "/*.html"); err != nil {
+	// Renders JSON-LD structured data (eg: .Data.JSONLD) in a <script> tag.
+	theme.Funcs(template.FuncMap{"JSONLD": renderJSONLD})
+
+	// Script aware helpers for rendering text in any direction. TextDir returns
+	// the direction (ltr|rtl) of a string and Script, the name of the Unicode
+	// script it's written in (eg: Arabic).
+	theme.Funcs(template.FuncMap{"TextDir": data.TextDir, "Script": data.Script})
+
+	// Highlight the words of a query in a string, eg: {{ Highlight $d.Content .Data.Query.Query }}
+	theme.Funcs(template.FuncMap{"Highlight": func(s, q string) template.HTML {
+		out, _ := data.Highlight(s, data.Lang{}.HighlightWords(q), 0)
+		return template.HTML(out)
+	}})
+
+	// Render Markdown and HTML content to sanitized HTML, eg: {{ Markdown $d.Notes }}
+	theme.Funcs(template.FuncMap{"Markdown": func(s string) template.HTML {
+		return template.HTML(data.RenderHTML(s, data.ContentMarkdown, pol))
+	}, "Sanitize": func(s string) template.HTML {
+		return template.HTML(data.RenderHTML(s, data.ContentHTML, pol))
+	}})
+
+	// Render content (or notes) in the content format of its language to
+	// sanitized HTML, eg: {{ RenderContent $d.Content $d.Lang }}
+	theme.Funcs(template.FuncMap{"RenderContent": func(s, lang string) template.HTML {
+		return template.HTML(langs[lang].RenderHTML(s))
+	}})
+
+	files, err := fs.Glob("/*.html")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no templates (*.html) found in the site theme")
+	}
+	if _, err := parseFSTemplates(theme, fs, files...); err != nil {
 		return nil, nil, err
 	}
 
@@ -251,7 +492,7 @@ func loadSite(rootPath string, loadPages bool) (*template.Template, map[string]*
 	}
 
 	pages := make(map[string]*template.Template)
-	files, err := filepath.Glob(path.Join(rootPath, "/pages", "*.html"))
+	files, err = fs.Glob("/pages/*.html")
 	if err != nil {
 		return nil, nil, err
 	}
@@ -263,7 +504,7 @@ func loadSite(rootPath string, loadPages bool) (*template.Template, map[string]*
 			return nil, nil, err
 		}
 
-		t, err := copy.ParseFiles(file)
+		t, err := parseFSTemplates(copy, fs, file)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -286,17 +527,54 @@ func loadSite(rootPath string, loadPages bool) (*template.Template, map[string]*
 	return theme, pages, nil
 }
 
+// parseFSTemplates parses template files in a FileSystem into t like
+// template.ParseFiles, naming every template after its file name.
+func parseFSTemplates(t *template.Template, fs stuffbin.FileSystem, files ...string) (*template.Template, error) {
+	for _, f := range files {
+		b, err := fs.Read(f)
+		if err != nil {
+			return nil, err
+		}
+
+		tpl := t
+		if name := path.Base(f); name != t.Name() {
+			tpl = t.New(name)
+		}
+		if _, err := tpl.Parse(string(b)); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", f, err)
+		}
+	}
+
+	return t, nil
+}
+
 // Render executes and renders a template for echo.
 func (t *tplRenderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
-	app := c.Get("app").(*App)
+	var (
+		app   = c.Get("app").(*App)
+		theme = t.themes.get(c)
+	)
+
+	return theme.tpl.ExecuteTemplate(w, name, theme.tplData(app.newTplData(c.Path(), data)))
+}
 
-	return t.tpls.ExecuteTemplate(w, name, tplData{
-		Path:     c.Path(),
+// newTplData returns the data container that's injected into site templates.
+func (app *App) newTplData(path string, data interface{}) tplData {
+	return tplData{
+		Path:     path,
 		AssetVer: assetVer,
 		Consts:   app.consts,
 		Langs:    app.data.Langs,
 		Dicts:    app.data.Dicts,
 		L:        app.i18n,
 		Data:     data,
-	})
+		app:      app,
+	}
+}
+
+// escapeWordURL escapes a word as a URL path segment where spaces are +.
+// Literal +s are escaped so that they are not read as spaces.
+func escapeWordURL(s string) string {
+	s = strings.ReplaceAll(url.PathEscape(s), "+", "%2B")
+	return strings.ReplaceAll(s, "%20", "+")
 }
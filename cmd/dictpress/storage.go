@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/knadh/dictpress/internal/s3"
+	"github.com/knadh/koanf/v2"
+	"github.com/knadh/stuffbin"
+)
+
+// Storage providers for the site theme and admin assets.
+const (
+	storageLocal    = "local"
+	storageEmbedded = "embedded"
+	storageS3       = "s3"
+)
+
+// Path of the site theme stuffed into the binary (make pack-bin SITE=path).
+const embeddedSiteDir = "/site"
+
+// storageOpt represents the site theme and admin asset storage options.
+type storageOpt struct {
+	Site  string `koanf:"site"`
+	Admin string `koanf:"admin"`
+
+	S3            s3.Opt `koanf:"s3"`
+	S3SitePrefix  string `koanf:"s3_site_prefix"`
+	S3AdminPrefix string `koanf:"s3_admin_prefix"`
+}
+
+// memFileInfo is the os.FileInfo of a file loaded into memory.
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (f memFileInfo) Name() string       { return f.name }
+func (f memFileInfo) Size() int64        { return f.size }
+func (f memFileInfo) Mode() os.FileMode  { return 0644 }
+func (f memFileInfo) ModTime() time.Time { return f.modTime }
+func (f memFileInfo) IsDir() bool        { return false }
+func (f memFileInfo) Sys() interface{}   { return nil }
+
+// initStorageOpt loads the storage options from the config.
+func initStorageOpt(ko *koanf.Koanf) storageOpt {
+	var o storageOpt
+	if err := ko.Unmarshal("storage", &o); err != nil {
+		lo.Fatalf("error loading storage config: %v", err)
+	}
+
+	if o.Site == "" {
+		o.Site = storageLocal
+	}
+	if o.Admin == "" {
+		o.Admin = storageEmbedded
+	}
+	if o.S3SitePrefix == "" {
+		o.S3SitePrefix = "site"
+	}
+	if o.S3AdminPrefix == "" {
+		o.S3AdminPrefix = "admin"
+	}
+	o.S3SitePrefix = strings.Trim(o.S3SitePrefix, "/") + "/"
+	o.S3AdminPrefix = strings.Trim(o.S3AdminPrefix, "/") + "/"
+
+	return o
+}
+
+// initSiteFS loads the site theme files into a FileSystem with the theme's
+// root at /, from the theme directory, the binary, or an S3 bucket.
+func initSiteFS(o storageOpt, siteDir string, appFS stuffbin.FileSystem) stuffbin.FileSystem {
+	out, err := loadSiteFS(o, siteDir, appFS)
+	if err != nil {
+		lo.Fatalf("error loading site theme: %v", err)
+	}
+
+	return out
+}
+
+// loadSiteFS loads the site theme from the configured storage.
+func loadSiteFS(o storageOpt, siteDir string, appFS stuffbin.FileSystem) (stuffbin.FileSystem, error) {
+	var (
+		out stuffbin.FileSystem
+		err error
+	)
+
+	switch o.Site {
+	case storageLocal:
+		out, err = loadDirFS(siteDir)
+	case storageEmbedded:
+		out, err = subFS(appFS, embeddedSiteDir, "/")
+		if err == nil && len(out.List()) == 0 {
+			err = fmt.Errorf("no site theme embedded in the binary at %s", embeddedSiteDir)
+		}
+	case storageS3:
+		out, err = loadS3FS(s3.New(o.S3), o.S3SitePrefix, "/")
+	default:
+		err = fmt.Errorf("unknown storage '%s'", o.Site)
+	}
+
+	return out, err
+}
+
+// initAdminFS replaces the admin assets in the app's FileSystem with the ones
+// in the S3 bucket if the admin storage is S3.
+func initAdminFS(o storageOpt, appFS stuffbin.FileSystem) stuffbin.FileSystem {
+	switch o.Admin {
+	case storageEmbedded:
+		return appFS
+	case storageS3:
+	default:
+		lo.Fatalf("unknown admin storage '%s'", o.Admin)
+	}
+
+	admin, err := loadS3FS(s3.New(o.S3), o.S3AdminPrefix, "/admin/")
+	if err != nil {
+		lo.Fatalf("error loading admin assets: %v", err)
+	}
+
+	// Copy the rest of the embedded files (schema, queries etc.) into the new FileSystem.
+	for _, p := range appFS.List() {
+		if strings.HasPrefix(p, "/admin/") {
+			continue
+		}
+
+		b, err := appFS.Read(p)
+		if err != nil {
+			lo.Fatalf("error reading %s: %v", p, err)
+		}
+		if err := admin.Add(stuffbin.NewFile(p, memFileInfo{name: path.Base(p), size: int64(len(b))}, b)); err != nil {
+			lo.Fatalf("error loading %s: %v", p, err)
+		}
+	}
+
+	return admin
+}
+
+// loadDirFS loads all files in a directory into a FileSystem.
+func loadDirFS(dir string) (stuffbin.FileSystem, error) {
+	out, err := stuffbin.NewFS()
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		return out.Add(stuffbin.NewFile("/"+filepath.ToSlash(rel), info, b))
+	})
+
+	return out, err
+}
+
+// subFS returns a FileSystem with the files under dir in a FileSystem moved to root.
+func subFS(src stuffbin.FileSystem, dir, root string) (stuffbin.FileSystem, error) {
+	out, err := stuffbin.NewFS()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range src.List() {
+		if !strings.HasPrefix(p, dir+"/") {
+			continue
+		}
+
+		b, err := src.Read(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := out.Add(stuffbin.NewFile(root+strings.TrimPrefix(p, dir+"/"),
+			memFileInfo{name: path.Base(p), size: int64(len(b))}, b)); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// loadS3FS downloads all objects under a key prefix in an S3 bucket into a
+// FileSystem with the prefix replaced by root.
+func loadS3FS(c *s3.Client, prefix, root string) (stuffbin.FileSystem, error) {
+	objs, err := c.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("error listing bucket: %v", err)
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("no files found in the bucket under '%s'", prefix)
+	}
+
+	out, err := stuffbin.NewFS()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range objs {
+		b, err := c.Get(o.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error downloading %s: %v", o.Key, err)
+		}
+
+		p := root + strings.TrimPrefix(o.Key, prefix)
+		if err := out.Add(stuffbin.NewFile(p, memFileInfo{name: path.Base(p), size: o.Size, modTime: o.LastModified}, b)); err != nil {
+			return nil, err
+		}
+	}
+
+	lo.Printf("loaded %d files from the bucket under '%s'", len(objs), prefix)
+	return out, nil
+}
@@ -43,34 +43,11 @@ func handleNewSubmission(c echo.Context) error {
 	}
 
 	s.EntryContent = strings.TrimSpace(s.EntryContent)
-	if len(s.EntryContent) == 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid `entry_content`.")
-	}
-
-	// Validate input.
-	ln := len(s.RelationLang)
-	if ln == 0 || ln != len(s.RelationContent) || ln != len(s.RelationTypes) {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid submission fields.")
-	}
-
-	// Validate language and type enums.
-	if _, ok := app.data.Langs[s.EntryLang]; !ok {
-		return echo.NewHTTPError(http.StatusBadRequest, "Unknown `entry_lang`.")
-	}
-	for i := range s.RelationLang {
-		lang, ok := app.data.Langs[s.RelationLang[i]]
-		if !ok {
-			return echo.NewHTTPError(http.StatusBadRequest, "Unknown `relation_lang`.")
-		}
-
-		if _, ok := lang.Types[s.RelationTypes[i]]; !ok {
-			return echo.NewHTTPError(http.StatusBadRequest, "Unknown `relation_type`.")
-		}
-
+	for i := range s.RelationContent {
 		s.RelationContent[i] = strings.TrimSpace(s.RelationContent[i])
-		if len(s.RelationContent[i]) == 0 {
-			return echo.NewHTTPError(http.StatusBadRequest, "Invalid `entry_content`.")
-		}
+	}
+	if err := validateSubmission(s, app); err != nil {
+		return err
 	}
 
 	// Check if the main entry and the relational entries already exist.
@@ -87,7 +64,7 @@ func handleNewSubmission(c echo.Context) error {
 
 	e := data.Entry{
 		Lang:    s.EntryLang,
-		Initial: strings.ToUpper(string(s.EntryContent[0])),
+		Initial: data.Initial(s.EntryContent),
 		Content: s.EntryContent,
 		Phones:  pq.StringArray(phones),
 		Tags:    pq.StringArray{},
@@ -113,7 +90,7 @@ func handleNewSubmission(c echo.Context) error {
 
 		toID, err := app.data.InsertSubmissionEntry(data.Entry{
 			Lang:    s.RelationLang[i],
-			Initial: strings.ToUpper(string(s.RelationContent[0][0])),
+			Initial: data.Initial(s.RelationContent[0]),
 			Content: s.RelationContent[i],
 			Phones:  pq.StringArray(phones),
 			Tags:    pq.StringArray{},
@@ -152,12 +129,18 @@ func handleNewComments(c echo.Context) error {
 			fmt.Sprintf("error parsing request: %v", err))
 	}
 
-	if s.FromGUID == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `from_guid`.")
+	var v validator
+	if v.required("from_guid", s.FromGUID) && !isEntryID(s.FromGUID) {
+		v.add("from_guid", "invalid GUID")
 	}
-
-	if len(s.Comments) > 1000 {
-		return echo.NewHTTPError(http.StatusBadRequest, "Comments are too big.")
+	if s.ToGUID != "" && !isEntryID(s.ToGUID) {
+		v.add("to_guid", "invalid GUID")
+	}
+	if v.required("comments", s.Comments) {
+		v.maxLen("comments", s.Comments, 1000)
+	}
+	if err := v.err(); err != nil {
+		return err
 	}
 
 	if err := app.data.InsertComments(s.FromGUID, s.ToGUID, s.Comments); err != nil {
@@ -168,3 +151,36 @@ func handleNewComments(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, okResp{true})
 }
+
+// validateSubmission validates a new entry submission and its definitions.
+func validateSubmission(s newSubmission, app *App) error {
+	var v validator
+
+	v.lang("entry_lang", s.EntryLang, app.data.Langs)
+	if v.required("entry_content", s.EntryContent) {
+		v.maxLen("entry_content", s.EntryContent, maxContentLen)
+	}
+	v.maxLen("entry_phones", s.EntryPhones, maxContentLen)
+	v.maxLen("entry_notes", s.EntryNotes, maxNotesLen)
+
+	ln := len(s.RelationLang)
+	if ln == 0 {
+		v.add("relation_lang", "at least one definition is required")
+	} else if ln != len(s.RelationContent) || ln != len(s.RelationTypes) {
+		v.add("relation_content", "there should be a language, content, and type for every definition")
+		return v.err()
+	}
+
+	for i := range s.RelationLang {
+		if lang, ok := v.lang(fmt.Sprintf("relation_lang[%d]", i), s.RelationLang[i], app.data.Langs); ok {
+			v.label(fmt.Sprintf("relation_type[%d]", i), s.RelationTypes[i], lang.Types)
+		}
+
+		f := fmt.Sprintf("relation_content[%d]", i)
+		if v.required(f, s.RelationContent[i]) {
+			v.maxLen(f, s.RelationContent[i], maxContentLen)
+		}
+	}
+
+	return v.err()
+}
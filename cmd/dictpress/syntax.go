@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Keys of the filters in the search query syntax, eg: tag:idiom, that are
+// the same as the search query params.
+var syntaxFilters = map[string]bool{
+	"tag":      true,
+	"type":     true,
+	"pos":      true,
+	"gender":   true,
+	"register": true,
+	"domain":   true,
+}
+
+// querySyntax is a search query parsed from the search query syntax.
+type querySyntax struct {
+	Query string
+
+	// The query is a single quoted phrase, eg: "kick the bucket".
+	Phrase bool
+
+	// Languages to search from and to (from:english to:italian).
+	From string
+	To   string
+
+	// Filters by the search query param names, eg: tag => [idiom].
+	Filters map[string][]string
+}
+
+// parseQuerySyntax parses the optional syntax in a search query: a "quoted
+// phrase" and key:value filters (tag, type, pos, gender, register, domain,
+// from, to), eg: "kick the bucket" tag:idiom to:italian. Words with unknown
+// keys or no values are left in the query as they are.
+func parseQuerySyntax(q string) querySyntax {
+	var (
+		out    = querySyntax{Filters: map[string][]string{}}
+		words  []string
+		quoted int
+	)
+	for _, t := range splitQuery(q) {
+		if t.quoted {
+			words = append(words, t.text)
+			quoted++
+			continue
+		}
+
+		key, val, ok := strings.Cut(t.text, ":")
+		key = strings.ToLower(key)
+		switch {
+		case !ok || val == "":
+			words = append(words, t.text)
+		case syntaxFilters[key]:
+			out.Filters[key] = append(out.Filters[key], val)
+		case key == "from":
+			out.From = val
+		case key == "to":
+			out.To = val
+		default:
+			words = append(words, t.text)
+		}
+	}
+
+	out.Query = strings.Join(words, " ")
+	out.Phrase = len(words) == 1 && quoted == 1 && strings.ContainsFunc(words[0], unicode.IsSpace)
+
+	return out
+}
+
+// queryToken is a word or a quoted phrase in a search query.
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+// splitQuery splits a search query into words at spaces and "quoted phrases".
+// An unclosed quote runs till the end of the query.
+func splitQuery(q string) []queryToken {
+	var (
+		out    []queryToken
+		cur    strings.Builder
+		quoted bool
+	)
+	flush := func(isQuoted bool) {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			out = append(out, queryToken{text: strings.Join(strings.Fields(s), " "), quoted: isQuoted})
+		}
+		cur.Reset()
+	}
+
+	for _, r := range q {
+		switch {
+		case r == '"':
+			flush(quoted)
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush(false)
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush(quoted)
+
+	return out
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/sanitize"
+	"github.com/knadh/go-i18n"
+	"github.com/knadh/koanf/v2"
+	"github.com/knadh/stuffbin"
+	"github.com/labstack/echo/v4"
+)
+
+// themeOpt represents an additional site theme in the config ([themes.*]).
+type themeOpt struct {
+	// Directory in the site theme with the theme's files. Files that aren't
+	// in it are loaded from the site theme, so that a theme can override
+	// only some templates, static files, or lang.json.
+	Dir string `koanf:"dir"`
+
+	// Hostnames (eg: ta.example.com) whose site pages are rendered with the theme.
+	Hosts []string `koanf:"hosts"`
+
+	// [$fromLang, $toLang] dictionary pairs whose pages are rendered with the theme.
+	Dicts [][]string `koanf:"dicts"`
+
+	// Optional root URL of the site on the theme's hosts.
+	RootURL string `koanf:"root_url"`
+}
+
+// siteTheme is a loaded site theme.
+type siteTheme struct {
+	name       string
+	tpl        *template.Template
+	pages      map[string]*template.Template
+	fs         stuffbin.FileSystem
+	fileServer http.Handler
+	i18n       *i18n.I18n
+	rootURL    string
+
+	// Static file path => fingerprinted path and vice versa.
+	assets map[string]string
+	files  map[string]string
+}
+
+// siteThemes is the default site theme and the themes of hostnames and
+// dictionary pairs.
+type siteThemes struct {
+	def *siteTheme
+
+	// Hostname => theme.
+	hosts map[string]*siteTheme
+
+	// fromLang/toLang and fromLang (for word pages) => theme.
+	dicts map[string]*siteTheme
+}
+
+// loadTheme loads a site theme's templates, pages, and optional language pack
+// (lang.json) from a FileSystem.
+func loadTheme(name string, fs stuffbin.FileSystem, loadPages bool, pol *sanitize.Policy, langs data.LangMap) (*siteTheme, error) {
+	tpl, pages, err := loadSite(fs, loadPages, pol, langs)
+	if err != nil {
+		return nil, err
+	}
+
+	assets, files, err := fingerprintAssets(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &siteTheme{
+		name:       name,
+		tpl:        tpl,
+		pages:      pages,
+		fs:         fs,
+		fileServer: fs.FileServer(),
+		assets:     assets,
+		files:      files,
+	}
+
+	// Optionally load a language pack.
+	if b, err := fs.Read("/lang.json"); err == nil {
+		i, err := i18n.New(b)
+		if err != nil {
+			return nil, fmt.Errorf("error loading i18n lang.json file: %v", err)
+		}
+		t.i18n = i
+	} else {
+		t.i18n, _ = i18n.New([]byte(`{"_.code": "", "_.name": ""}`))
+	}
+
+	return t, nil
+}
+
+// initThemes loads the additional site themes in the config ([themes.*]) over
+// the default site theme and maps them to their hostnames and dictionary pairs.
+func initThemes(def *siteTheme, ko *koanf.Koanf, app *App) (*siteThemes, error) {
+	out := &siteThemes{
+		def:   def,
+		hosts: map[string]*siteTheme{},
+		dicts: map[string]*siteTheme{},
+	}
+
+	for _, name := range ko.MapKeys("themes") {
+		var o themeOpt
+		if err := ko.Unmarshal("themes."+name, &o); err != nil {
+			return nil, fmt.Errorf("error loading theme '%s' config: %v", name, err)
+		}
+
+		dir := "/" + strings.Trim(path.Clean("/"+o.Dir), "/")
+		if dir == "/" {
+			return nil, fmt.Errorf("theme '%s': `dir` should be a directory in the site theme", name)
+		}
+		if len(o.Hosts) == 0 && len(o.Dicts) == 0 {
+			return nil, fmt.Errorf("theme '%s': there should be at least one of `hosts` or `dicts`", name)
+		}
+
+		over, err := subFS(def.fs, dir, "/")
+		if err != nil {
+			return nil, fmt.Errorf("theme '%s': %v", name, err)
+		}
+		if len(over.List()) == 0 {
+			return nil, fmt.Errorf("theme '%s': no files found in %s in the site theme", name, dir)
+		}
+
+		fs, err := overlayFS(def.fs, over)
+		if err != nil {
+			return nil, fmt.Errorf("theme '%s': %v", name, err)
+		}
+
+		t, err := loadTheme(name, fs, ko.Bool("app.enable_pages"), app.sanitizer, app.data.Langs)
+		if err != nil {
+			return nil, fmt.Errorf("error loading theme '%s': %v", name, err)
+		}
+		t.rootURL = strings.TrimRight(o.RootURL, "/")
+
+		for _, h := range o.Hosts {
+			h = strings.ToLower(strings.TrimSpace(h))
+			if old, ok := out.hosts[h]; ok {
+				return nil, fmt.Errorf("theme '%s': host '%s' is already mapped to theme '%s'", name, h, old.name)
+			}
+			out.hosts[h] = t
+		}
+
+		for _, d := range o.Dicts {
+			if len(d) != 2 {
+				return nil, fmt.Errorf("theme '%s': dicts should be [$fromLang, $toLang] pairs", name)
+			}
+			if _, ok := app.data.Langs[d[0]]; !ok {
+				return nil, fmt.Errorf("theme '%s': unknown language '%s' in dicts", name, d[0])
+			}
+			if _, ok := app.data.Langs[d[1]]; !ok {
+				return nil, fmt.Errorf("theme '%s': unknown language '%s' in dicts", name, d[1])
+			}
+
+			key := d[0] + "/" + d[1]
+			if old, ok := out.dicts[key]; ok {
+				return nil, fmt.Errorf("theme '%s': dictionary %s is already mapped to theme '%s'", name, key, old.name)
+			}
+			out.dicts[key] = t
+
+			// Word pages only have the from language. The first pair of the
+			// language picks the theme.
+			if _, ok := out.dicts[d[0]]; !ok {
+				out.dicts[d[0]] = t
+			}
+		}
+
+		lo.Printf("loaded site theme '%s' from %s", name, dir)
+	}
+
+	return out, nil
+}
+
+// get returns the theme of a request's dictionary pair, or its hostname, or
+// the default theme.
+func (s *siteThemes) get(c echo.Context) *siteTheme {
+	if len(s.dicts) > 0 {
+		if from := c.Param("fromLang"); from != "" {
+			if t, ok := s.dicts[from+"/"+c.Param("toLang")]; ok {
+				return t
+			}
+		} else if lang := c.Param("lang"); lang != "" {
+			if t, ok := s.dicts[lang]; ok {
+				return t
+			}
+		}
+	}
+
+	if len(s.hosts) > 0 {
+		host := c.Request().Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if t, ok := s.hosts[strings.ToLower(host)]; ok {
+			return t
+		}
+	}
+
+	return s.def
+}
+
+// theme returns the site theme of a request.
+func (app *App) theme(c echo.Context) *siteTheme {
+	return app.themes.get(c)
+}
+
+// tplData sets the theme's language pack and root URL in template data.
+func (t *siteTheme) tplData(d tplData) tplData {
+	d.L = t.i18n
+	d.theme = t
+	if t.rootURL != "" {
+		d.Consts.RootURL = t.rootURL
+	}
+
+	return d
+}
+
+// rootURL returns the root URL of the site of a request's theme.
+func (app *App) rootURL(c echo.Context) string {
+	if t := app.theme(c); t.rootURL != "" {
+		return t.rootURL
+	}
+
+	return app.consts.RootURL
+}
+
+// overlayFS returns a FileSystem with the files in over replacing the ones at
+// the same paths in base.
+func overlayFS(base, over stuffbin.FileSystem) (stuffbin.FileSystem, error) {
+	out, err := stuffbin.NewFS()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fs := range []stuffbin.FileSystem{over, base} {
+		for _, p := range fs.List() {
+			if _, err := out.Get(p); err == nil {
+				continue
+			}
+
+			f, err := fs.Get(p)
+			if err != nil {
+				return nil, err
+			}
+			if err := out.Add(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return out, nil
+}
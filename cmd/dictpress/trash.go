@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// Interval at which trashed items older than app.trash_retention_days are purged.
+const trashPurgeInterval = time.Hour
+
+// trashItems represents a page of trashed entries and relations.
+type trashItems struct {
+	Items      []data.Trash `json:"items"`
+	Page       int          `json:"page"`
+	PerPage    int          `json:"per_page"`
+	TotalPages int          `json:"total_pages"`
+	Total      int          `json:"total"`
+}
+
+func (t *trashItems) pageMeta() *apiMeta {
+	return &apiMeta{Page: t.Page, PerPage: t.PerPage, TotalPages: t.TotalPages, Total: t.Total}
+}
+
+// handleGetTrash returns paginated trashed entries and relations, optionally
+// filtered by ?type.
+func handleGetTrash(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		typ = c.QueryParam("type")
+		pg  = app.resultsPg.NewFromURL(c.Request().URL.Query())
+	)
+
+	switch typ {
+	case "", "entry", "relation":
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid `type`.")
+	}
+
+	res, total, err := app.data.GetTrash(typ, pg.Offset, pg.Limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching trash: %v", err))
+	}
+
+	pg.SetTotal(total)
+	return c.JSON(http.StatusOK, okResp{&trashItems{res, pg.Page, pg.PerPage, pg.TotalPages, total}})
+}
+
+// handleGetTrashItem returns a trashed entry or relation with the deleted rows.
+func handleGetTrashItem(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	out, err := app.data.GetTrashItem(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "item not found in trash")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching trash: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleRestoreTrash restores a trashed entry or relation.
+func handleRestoreTrash(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	out, err := app.data.RestoreTrash(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "item not found in trash")
+		}
+		if p, ok := err.(*pq.Error); ok && p.Code == "23505" {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				"the entry's `slug` is now used by another entry in the language. Change it and retry.")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error restoring item: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteTrash permanently deletes a trashed item, or all items if
+// there's no :id, along with their uploaded media files.
+func handleDeleteTrash(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if c.Param("id") != "" && id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	if isDryRun(c) {
+		out, err := app.data.PreviewDeleteTrash(id, 0, maxDryRunGUIDs)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error previewing trash deletion: %v", err))
+		}
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	if err := purgeTrash(id, 0, app); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error deleting from trash: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// purgeTrash permanently deletes trashed items (see data.DeleteTrash) and
+// the uploaded files of their media.
+func purgeTrash(id, days int, app *App) error {
+	media, err := app.data.DeleteTrash(id, days)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range media {
+		deleteMediaFiles(m, app)
+	}
+
+	return nil
+}
+
+// runTrashPurge periodically purges items that have been in the trash for
+// longer than the given number of days.
+func runTrashPurge(days int, app *App) {
+	for {
+		if err := purgeTrash(0, days, app); err != nil {
+			app.lo.Printf("error purging trash: %v", err)
+		}
+		time.Sleep(trashPurgeInterval)
+	}
+}
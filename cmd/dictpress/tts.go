@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/dictpress/internal/tts"
+	"github.com/knadh/koanf/v2"
+)
+
+// Number of entries fetched in one batch by tts jobs.
+const ttsBatchSize = 100
+
+// Consecutive failures after which a tts job gives up, eg: if the TTS
+// service is down.
+const ttsMaxFailures = 10
+
+// Caption of generated pronunciation audio.
+const ttsCaption = "pronunciation"
+
+// Content types of pronunciation audio and their file extensions.
+var audioTypes = map[string]string{
+	"audio/mpeg":  ".mp3",
+	"audio/mp3":   ".mp3",
+	"audio/ogg":   ".ogg",
+	"audio/opus":  ".opus",
+	"audio/wav":   ".wav",
+	"audio/x-wav": ".wav",
+	"audio/webm":  ".webm",
+	"audio/aac":   ".aac",
+}
+
+// ttsGen generates pronunciation audio with a TTS provider.
+type ttsGen struct {
+	tts.Provider
+
+	// Optional voices of the provider by language ID.
+	voices map[string]string
+}
+
+// initTTS initializes the TTS provider.
+func initTTS(ko *koanf.Koanf) *ttsGen {
+	var o tts.Opt
+	if err := ko.Unmarshal("tts", &o); err != nil {
+		lo.Fatalf("error loading tts config: %v", err)
+	}
+
+	p, err := tts.NewHTTP(o)
+	if err != nil {
+		lo.Fatalf("error initializing tts: %v", err)
+	}
+
+	return &ttsGen{Provider: p, voices: ko.StringMap("tts.voices")}
+}
+
+// runTTSJob generates pronunciation audio for the enabled headwords of the
+// given languages, or all languages, that don't have any, and stores it in
+// the media store as audio media of the entries.
+func runTTSJob(ctx context.Context, p jobParams, l *log.Logger, app *App) (string, error) {
+	if app.tts == nil {
+		return "", fmt.Errorf("tts is not enabled")
+	}
+
+	langs := p.Langs
+	if len(langs) == 0 {
+		for id := range app.data.Langs {
+			langs = append(langs, id)
+		}
+		sort.Strings(langs)
+	}
+
+	total, failed := 0, 0
+	for _, lang := range langs {
+		lastID, n, fails := 0, 0, 0
+		for {
+			entries, err := app.data.GetEntriesWithoutAudio(lang, lastID, ttsBatchSize)
+			if err != nil {
+				return "", fmt.Errorf("error fetching entries in %s: %v", lang, err)
+			}
+			if len(entries) == 0 {
+				break
+			}
+
+			for _, e := range entries {
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				lastID = e.ID
+
+				if err := generateAudio(e, app); err != nil {
+					l.Printf("error generating audio for %d (%s): %v", e.ID, e.Content, err)
+					failed++
+					if fails++; fails >= ttsMaxFailures {
+						return "", fmt.Errorf("stopping after %d consecutive failures", fails)
+					}
+					continue
+				}
+
+				fails = 0
+				n++
+			}
+		}
+
+		l.Printf("generated audio for %d entries in %s", n, lang)
+		total += n
+	}
+
+	return fmt.Sprintf("%d entries, %d failed", total, failed), nil
+}
+
+// generateAudio generates the pronunciation audio of an entry and attaches it
+// to the entry as media.
+func generateAudio(e data.Entry, app *App) error {
+	b, typ, err := app.tts.Speak(e.Content, langCode(app.data.Langs[e.Lang]), app.tts.voices[e.Lang])
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) > app.consts.Media.MaxSize {
+		return fmt.Errorf("audio is larger than %d bytes", app.consts.Media.MaxSize)
+	}
+
+	ext, ok := audioTypes[typ]
+	if !ok {
+		return fmt.Errorf("unsupported audio type '%s'", typ)
+	}
+
+	// Files are stored with random names.
+	rnd := make([]byte, 16)
+	if _, err := rand.Read(rnd); err != nil {
+		return err
+	}
+
+	m := data.Media{
+		EntryID:     e.ID,
+		Filename:    hex.EncodeToString(rnd) + ext,
+		ContentType: typ,
+		Caption:     ttsCaption,
+	}
+	if m.URL, err = app.media.Put(m.Filename, typ, b); err != nil {
+		return fmt.Errorf("error storing audio: %v", err)
+	}
+
+	if _, err := app.data.InsertMedia(m); err != nil {
+		deleteMediaFiles(m, app)
+		return fmt.Errorf("error inserting media: %v", err)
+	}
+
+	return nil
+}
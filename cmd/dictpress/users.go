@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Permissions that are checked on admin routes.
+const (
+	permEntriesRead   = "entries:read"
+	permEntriesWrite  = "entries:write"
+	permEntriesStatus = "entries:status"
+	permEntriesDelete = "entries:delete"
+	permUsers         = "users:manage"
+	permAudit         = "audit:read"
+	permJobs          = "jobs:manage"
+	permSettings      = "settings:manage"
+)
+
+// rolePerms maps user roles to the permissions they have.
+var rolePerms = map[string]map[string]bool{
+	data.RoleAdmin: {
+		permEntriesRead:   true,
+		permEntriesWrite:  true,
+		permEntriesStatus: true,
+		permEntriesDelete: true,
+		permUsers:         true,
+		permAudit:         true,
+		permJobs:          true,
+		permSettings:      true,
+	},
+
+	// Editors can add and edit entries, but can't publish (change status) or delete them.
+	data.RoleEditor: {
+		permEntriesRead:  true,
+		permEntriesWrite: true,
+	},
+
+	// Reviewers can additionally moderate submissions and change entry statuses.
+	data.RoleReviewer: {
+		permEntriesRead:   true,
+		permEntriesWrite:  true,
+		permEntriesStatus: true,
+	},
+
+	data.RoleReadOnly: {
+		permEntriesRead: true,
+	},
+}
+
+// userCache caches DB users whose BasicAuth credentials have been verified for
+// a short while so that every admin request doesn't do a DB lookup and an
+// expensive bcrypt comparison. Entries are keyed by an HMAC of the credentials
+// with a random per-process key so that passwords are not held in memory.
+type userCache struct {
+	key   []byte
+	ttl   time.Duration
+	users map[string]cachedUser
+	mu    sync.Mutex
+}
+
+type cachedUser struct {
+	user   data.User
+	expiry time.Time
+}
+
+// newUserCache returns a new userCache.
+func newUserCache(ttl time.Duration) *userCache {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		lo.Fatalf("error generating user cache key: %v", err)
+	}
+
+	return &userCache{key: key, ttl: ttl, users: make(map[string]cachedUser)}
+}
+
+func (uc *userCache) hash(username, password string) string {
+	h := hmac.New(sha256.New, uc.key)
+	h.Write([]byte(username + "\x00" + password))
+	return string(h.Sum(nil))
+}
+
+// get returns the cached user for a set of credentials.
+func (uc *userCache) get(username, password string) (data.User, bool) {
+	k := uc.hash(username, password)
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	u, ok := uc.users[k]
+	if !ok {
+		return data.User{}, false
+	}
+	if time.Now().After(u.expiry) {
+		delete(uc.users, k)
+		return data.User{}, false
+	}
+
+	return u.user, true
+}
+
+// set caches a verified user.
+func (uc *userCache) set(username, password string, u data.User) {
+	k := uc.hash(username, password)
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	// Drop expired entries.
+	now := time.Now()
+	for ck, c := range uc.users {
+		if now.After(c.expiry) {
+			delete(uc.users, ck)
+		}
+	}
+
+	uc.users[k] = cachedUser{user: u, expiry: now.Add(uc.ttl)}
+}
+
+// reset clears the cache, eg: when users are updated or deleted.
+func (uc *userCache) reset() {
+	uc.mu.Lock()
+	uc.users = make(map[string]cachedUser)
+	uc.mu.Unlock()
+}
+
+// hasPerm checks whether the authenticated user in the request context has a permission.
+func hasPerm(c echo.Context, perm string) bool {
+	role, _ := c.Get(authRole).(string)
+	return rolePerms[role][perm]
+}
+
+// requirePerm is a route middleware that allows the request only if the
+// authenticated user has the given permission.
+func requirePerm(perm string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !hasPerm(c, perm) {
+				return echo.NewHTTPError(http.StatusForbidden, "permission denied")
+			}
+			return next(c)
+		}
+	}
+}
+
+// handleGetUsers returns all admin users.
+func handleGetUsers(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	out, err := app.data.GetUsers()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching users: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetUser returns an admin user.
+func handleGetUser(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	out, err := app.data.GetUser(id, "")
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusBadRequest, "user not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error fetching user: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleInsertUser creates a new admin user.
+func handleInsertUser(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	u, err := bindUser(c, true)
+	if err != nil {
+		return err
+	}
+
+	id, err := app.data.InsertUser(u)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error inserting user: %v", err))
+	}
+
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprintf("%d", id))
+	return handleGetUser(c)
+}
+
+// handleUpdateUser updates an admin user.
+func handleUpdateUser(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	u, err := bindUser(c, false)
+	if err != nil {
+		return err
+	}
+
+	if err := app.data.UpdateUser(id, u); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error updating user: %v", err))
+	}
+	app.userCache.reset()
+	app.notify(clusterUsers)
+
+	return handleGetUser(c)
+}
+
+// handleDeleteUser deletes an admin user.
+func handleDeleteUser(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid `id`.")
+	}
+
+	if err := app.data.DeleteUser(id); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			fmt.Sprintf("error deleting user: %v", err))
+	}
+	app.userCache.reset()
+	app.notify(clusterUsers)
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// bindUser parses and validates a user create/update request and
+// hashes the password, if there is one.
+func bindUser(c echo.Context, isNew bool) (data.User, error) {
+	var req struct {
+		data.User
+		Password string `json:"password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return data.User{}, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("error parsing request: %v", err))
+	}
+
+	u := req.User
+	u.Username = strings.TrimSpace(u.Username)
+	u.Name = strings.TrimSpace(u.Name)
+
+	var v validator
+	if isNew && len(u.Username) < 3 {
+		v.add("username", "should be min 3 characters")
+	}
+	v.maxLen("username", u.Username, 200)
+	v.maxLen("name", u.Name, 200)
+	if _, ok := rolePerms[u.Role]; !ok {
+		v.add("role", "unknown role '%s'", u.Role)
+	}
+
+	if u.Status == "" {
+		u.Status = data.StatusEnabled
+	}
+	v.oneOf("status", u.Status, data.StatusEnabled, data.StatusDisabled)
+
+	// The password is optional on updates.
+	if (req.Password != "" || isNew) && len(req.Password) < 8 {
+		v.add("password", "should be min 8 characters")
+	}
+	if err := v.err(); err != nil {
+		return u, err
+	}
+
+	if req.Password != "" || isNew {
+
+		h, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return u, echo.NewHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("error hashing password: %v", err))
+		}
+		u.Password = string(h)
+	}
+
+	return u, nil
+}
+
+// checkUser checks a username and password against the users in the DB
+// and returns the user if the credentials are valid.
+func checkUser(username, password string, app *App) (data.User, bool) {
+	if u, ok := app.userCache.get(username, password); ok {
+		return u, true
+	}
+
+	u, err := app.data.GetUser(0, username)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			app.lo.Printf("error fetching user: %v", err)
+		}
+		return u, false
+	}
+
+	if u.Status != data.StatusEnabled {
+		return u, false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)); err != nil {
+		return u, false
+	}
+
+	app.userCache.set(username, password, u)
+	return u, true
+}
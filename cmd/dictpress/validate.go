@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+// Maximum lengths (in characters) and counts of the fields of entries,
+// relations, and examples in requests.
+const (
+	maxContentLen = 5000
+	maxNotesLen   = 20000
+	maxInitialLen = 20
+	maxSlugLen    = 200
+	maxTagLen     = 100
+	maxTags       = 50
+	maxPhones     = 20
+)
+
+// fieldError is the error of a field in a request body, with the path of
+// the field (eg: relations[1].types[0]).
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validationError is the message of a 422 error with all the fields in a
+// request body that failed validation.
+type validationError struct {
+	Message string       `json:"message"`
+	Fields  []fieldError `json:"fields"`
+}
+
+// String returns the summary of the errors, which is the message of the error
+// in the v1 API envelope where the fields are set separately.
+func (v validationError) String() string {
+	return v.Message
+}
+
+// validator collects the errors of the fields in a request body so that all
+// of them are returned together instead of one at a time.
+type validator struct {
+	errs []fieldError
+}
+
+// add adds an error to a field.
+func (v *validator) add(field, msg string, args ...interface{}) {
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	v.errs = append(v.errs, fieldError{Field: field, Message: msg})
+}
+
+// required checks that a string field isn't empty or whitespace.
+func (v *validator) required(field, val string) bool {
+	if strings.TrimSpace(val) == "" {
+		v.add(field, "is required")
+		return false
+	}
+	return true
+}
+
+// maxLen checks that a string field is up to n characters.
+func (v *validator) maxLen(field, val string, n int) bool {
+	if utf8.RuneCountInString(val) > n {
+		v.add(field, "should be up to %d characters", n)
+		return false
+	}
+	return true
+}
+
+// lang checks that a language exists and returns it.
+func (v *validator) lang(field, id string, langs data.LangMap) (data.Lang, bool) {
+	if !v.required(field, id) {
+		return data.Lang{}, false
+	}
+
+	l, ok := langs[id]
+	if !ok {
+		v.add(field, "unknown language '%s'", id)
+		return l, false
+	}
+	return l, true
+}
+
+// oneOf checks that a field is one of the given values.
+func (v *validator) oneOf(field, val string, opts ...string) bool {
+	for _, o := range opts {
+		if val == o {
+			return true
+		}
+	}
+
+	v.add(field, "should be one of %s", strings.Join(opts, ", "))
+	return false
+}
+
+// label checks that a field is one of the keys of a language's labels (eg: types).
+func (v *validator) label(field, val string, labels map[string]string) bool {
+	if _, ok := labels[val]; !ok {
+		v.add(field, "unknown value '%s'", val)
+		return false
+	}
+	return true
+}
+
+// list checks the count and the lengths of the items of a list field.
+func (v *validator) list(field string, vals []string, max, maxItemLen int) {
+	if len(vals) > max {
+		v.add(field, "should have up to %d items", max)
+		return
+	}
+	for i, s := range vals {
+		f := fmt.Sprintf("%s[%d]", field, i)
+		if v.required(f, s) {
+			v.maxLen(f, s, maxItemLen)
+		}
+	}
+}
+
+// meta checks the values of the custom fields of a language in an entry's meta.
+func (v *validator) meta(field string, meta data.JSON, lang data.Lang) {
+	for _, id := range lang.Fields.InvalidMeta(meta) {
+		f := lang.Fields[id]
+		if f.Type == data.FieldEnum {
+			v.add(field+"."+id, "should be one of %s", strings.Join(f.Options, ", "))
+			continue
+		}
+		v.add(field+"."+id, "should be %s", f.Type)
+	}
+}
+
+// err returns a 422 error with the fields that failed validation, if any.
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	msg := v.errs[0].Field + " " + v.errs[0].Message
+	if n := len(v.errs); n > 1 {
+		msg += fmt.Sprintf(" (and %d more)", n-1)
+	}
+
+	return echo.NewHTTPError(http.StatusUnprocessableEntity, validationError{Message: msg, Fields: v.errs})
+}
+
+// entry checks the fields of an entry, with the field names prefixed. On
+// updates (partial), only the fields that are set are checked.
+func (v *validator) entry(prefix string, e data.Entry, partial bool, langs data.LangMap) {
+	lang, langOK := data.Lang{}, false
+	if !partial || e.Lang != "" {
+		lang, langOK = v.lang(prefix+"lang", e.Lang, langs)
+	}
+
+	if !partial || e.Content != "" {
+		if v.required(prefix+"content", e.Content) {
+			v.maxLen(prefix+"content", e.Content, maxContentLen)
+		}
+	}
+	if !partial || e.Initial != "" {
+		if v.required(prefix+"initial", e.Initial) {
+			v.maxLen(prefix+"initial", e.Initial, maxInitialLen)
+		}
+	}
+	v.maxLen(prefix+"notes", e.Notes, maxNotesLen)
+	v.maxLen(prefix+"etymology", e.Etymology, maxNotesLen)
+	if v.maxLen(prefix+"slug", e.Slug, maxSlugLen) && strings.ContainsAny(e.Slug, " \t\n/?#%") {
+		v.add(prefix+"slug", "can't have spaces or /?#%")
+	}
+	v.list(prefix+"tags", e.Tags, maxTags, maxTagLen)
+	v.list(prefix+"phones", e.Phones, maxPhones, maxContentLen)
+
+	if e.Status != "" {
+		v.oneOf(prefix+"status", e.Status, data.StatusPending, data.StatusEnabled, data.StatusDisabled)
+	}
+	if langOK && e.Meta != nil {
+		v.meta(prefix+"meta", e.Meta, lang)
+	}
+}
+
+// relation checks a relation's fields against the labels of the definition's
+// language, with the field names prefixed.
+func (v *validator) relation(prefix string, r data.Relation, lang data.Lang) {
+	for i, t := range r.Types {
+		v.label(fmt.Sprintf("%stypes[%d]", prefix, i), t, lang.Types)
+	}
+	v.list(prefix+"tags", r.Tags, maxTags, maxTagLen)
+	v.maxLen(prefix+"notes", r.Notes, maxNotesLen)
+
+	if r.Status != "" {
+		v.oneOf(prefix+"status", r.Status, data.StatusPending, data.StatusEnabled, data.StatusDisabled)
+	}
+	if r.Gender != "" {
+		v.label(prefix+"gender", r.Gender, lang.Genders)
+	}
+	if r.Register != "" {
+		v.label(prefix+"register", r.Register, lang.Registers)
+	}
+	for i, d := range r.Domains {
+		v.label(fmt.Sprintf("%sdomains[%d]", prefix, i), d, lang.Domains)
+	}
+}
+
+// validateEntry validates an entry. On updates (partial), only the fields
+// that are set are validated.
+func validateEntry(e data.Entry, partial bool, app *App) error {
+	var v validator
+	v.entry("", e, partial, app.data.Langs)
+
+	return v.err()
+}
+
+// validateEntryTree validates a new entry with its definitions, their
+// relations, and usage examples (see data.InsertEntryTree).
+func validateEntryTree(e data.Entry, app *App) error {
+	var v validator
+	v.entry("", e, false, app.data.Langs)
+
+	for i, def := range e.Relations {
+		prefix := fmt.Sprintf("relations[%d].", i)
+
+		// Definitions with IDs are existing entries that are only related.
+		if def.ID == 0 {
+			v.entry(prefix, def, false, app.data.Langs)
+		}
+
+		if def.Relation == nil {
+			continue
+		}
+		v.relation(prefix+"relation.", *def.Relation, app.data.Langs[def.Lang])
+
+		for j, x := range def.Relation.Examples {
+			p := fmt.Sprintf("%srelation.examples[%d].", prefix, j)
+			if v.required(p+"content", x.Content) {
+				v.maxLen(p+"content", x.Content, maxContentLen)
+			}
+			v.maxLen(p+"translation", x.Translation, maxContentLen)
+			v.lang(p+"lang", x.Lang, app.data.Langs)
+		}
+	}
+
+	return v.err()
+}
+
+// validateRelation validates a relation's fields against the labels of the
+// definition's language.
+func validateRelation(r data.Relation, lang data.Lang) error {
+	var v validator
+	v.relation("", r, lang)
+
+	return v.err()
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+	"github.com/knadh/koanf/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// Max number of popular entries that can be requested.
+const maxPopularEntries = 50
+
+type viewsOpt struct {
+	FlushInterval time.Duration `koanf:"flush_interval"`
+	RetentionDays int           `koanf:"retention_days"`
+	CacheTTL      time.Duration `koanf:"cache_ttl"`
+}
+
+// viewCounter counts click-throughs (views) on entries in memory and
+// periodically writes the aggregate counts to the DB, so that popular
+// entries don't cause a DB write on every view. A viewer's views on an entry
+// are counted once per flush interval. Nothing about the viewers is recorded
+// and their IPs are only kept in memory till the next flush.
+type viewCounter struct {
+	opt viewsOpt
+
+	counts map[string]int
+
+	// Viewers (client IPs) of entries since the last flush by $ip/$guid.
+	viewers map[string]bool
+	mu      sync.Mutex
+
+	// Cached popular entries by their lang/days/limit.
+	popular map[string]popularCache
+	pMu     sync.Mutex
+}
+
+type popularCache struct {
+	entries []data.Entry
+	expiry  time.Time
+}
+
+// Max number of distinct entries counted between flushes. Views on other
+// entries are dropped until the next flush.
+const maxViewCounts = 100000
+
+// Max number of distinct viewer and entry pairs tracked between flushes.
+// Views from other viewers are dropped until the next flush.
+const maxViewers = 500000
+
+// initViews initializes the entry view counter.
+func initViews(ko *koanf.Koanf) *viewCounter {
+	o := viewsOpt{
+		FlushInterval: time.Minute,
+		RetentionDays: 90,
+		CacheTTL:      time.Minute * 10,
+	}
+	if err := ko.Unmarshal("views", &o); err != nil {
+		lo.Fatalf("error loading views config: %v", err)
+	}
+	if o.FlushInterval < time.Second {
+		o.FlushInterval = time.Minute
+	}
+	if o.RetentionDays < 1 {
+		o.RetentionDays = 90
+	}
+
+	return &viewCounter{
+		opt:     o,
+		counts:  make(map[string]int),
+		viewers: make(map[string]bool),
+		popular: make(map[string]popularCache),
+	}
+}
+
+// add counts a view on an entry by its GUID from a viewer (client IP) if the
+// viewer hasn't viewed the entry since the last flush.
+func (v *viewCounter) add(guid, viewer string) {
+	k := viewer + "/" + guid
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.viewers[k] || len(v.viewers) >= maxViewers {
+		return
+	}
+	if _, ok := v.counts[guid]; !ok && len(v.counts) >= maxViewCounts {
+		return
+	}
+
+	v.viewers[k] = true
+	v.counts[guid]++
+}
+
+// counted checks whether there are views on an entry since the last flush.
+func (v *viewCounter) counted(guid string) bool {
+	v.mu.Lock()
+	_, ok := v.counts[guid]
+	v.mu.Unlock()
+
+	return ok
+}
+
+// viewer returns the viewer (client IP) of a request whose views are counted.
+// Proxy headers are only trusted if the bot filter is configured to.
+func viewer(c echo.Context, app *App) string {
+	if app.bots != nil {
+		return app.bots.clientIP(c).String()
+	}
+
+	return requestIP(c, false).String()
+}
+
+// flush writes the counted views to the DB and resets the counts.
+func (v *viewCounter) flush(app *App) {
+	v.mu.Lock()
+	counts := v.counts
+	v.counts = make(map[string]int)
+	v.viewers = make(map[string]bool)
+	v.mu.Unlock()
+
+	if len(counts) == 0 {
+		return
+	}
+	if err := app.data.RecordClicks(counts); err != nil {
+		app.lo.Printf("error recording views: %v", err)
+	}
+}
+
+// runViewFlusher periodically writes counted views to the DB and deletes
+// daily counts older than the retention period.
+func runViewFlusher(app *App) {
+	lastPurge := time.Time{}
+	for {
+		time.Sleep(app.views.opt.FlushInterval)
+		app.views.flush(app)
+
+		if time.Since(lastPurge) > time.Hour*24 {
+			if err := app.data.DeleteOldViews(app.views.opt.RetentionDays); err != nil {
+				app.lo.Printf("error deleting old views: %v", err)
+			}
+			lastPurge = time.Now()
+		}
+	}
+}
+
+// resetPopular clears the cached popular entries of a language and of all
+// languages, or all of them if the language is empty.
+func (v *viewCounter) resetPopular(lang string) {
+	v.pMu.Lock()
+	defer v.pMu.Unlock()
+
+	if lang == "" {
+		v.popular = make(map[string]popularCache)
+		return
+	}
+	for k := range v.popular {
+		if strings.HasPrefix(k, lang+"/") || strings.HasPrefix(k, "/") {
+			delete(v.popular, k)
+		}
+	}
+}
+
+// getPopular returns the most viewed enabled headwords, optionally in a
+// language, in the past given days. Results are cached for CacheTTL.
+func (v *viewCounter) getPopular(lang string, days, limit int, app *App) ([]data.Entry, error) {
+	key := fmt.Sprintf("%s/%d/%d", lang, days, limit)
+
+	v.pMu.Lock()
+	c, ok := v.popular[key]
+	v.pMu.Unlock()
+	if ok && time.Now().Before(c.expiry) {
+		return c.entries, nil
+	}
+
+	out, err := app.data.GetPopularEntries(lang, days, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.data.SearchAndLoadRelations(out, data.Query{Status: data.StatusEnabled}); err != nil {
+		return nil, err
+	}
+	hideIDs(out)
+
+	v.pMu.Lock()
+	v.popular[key] = popularCache{entries: out, expiry: time.Now().Add(v.opt.CacheTTL)}
+	v.pMu.Unlock()
+
+	return out, nil
+}
+
+// handleGetPopularEntries returns the most viewed headwords in a language in
+// the past ?days with their definitions.
+func handleGetPopularEntries(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		lang     = c.Param("lang")
+		days, _  = strconv.Atoi(c.QueryParam("days"))
+		limit, _ = strconv.Atoi(c.QueryParam("limit"))
+	)
+
+	if _, ok := app.data.Langs[lang]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown language")
+	}
+	if days == 0 {
+		days = 7
+	}
+	if days < 1 || days > app.views.opt.RetentionDays {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("`days` should be between 1 and %d", app.views.opt.RetentionDays))
+	}
+	if limit == 0 {
+		limit = 10
+	}
+	if limit < 1 || limit > maxPopularEntries {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("`limit` should be between 1 and %d", maxPopularEntries))
+	}
+
+	out, err := app.views.getPopular(lang, days, limit, app)
+	if err != nil {
+		app.lo.Printf("error fetching popular entries: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching popular entries")
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/stuffbin"
+)
+
+// wizard prompts for the values of a new installation on the terminal.
+type wizard struct {
+	in *bufio.Reader
+}
+
+// ask prompts for a value with an optional default that's used if the input is empty.
+func (w *wizard) ask(q, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", q, def)
+	} else {
+		fmt.Printf("%s: ", q)
+	}
+
+	s, err := w.in.ReadString('\n')
+	if err != nil && s == "" {
+		fmt.Println()
+		fmt.Println("install cancelled.")
+		os.Exit(1)
+	}
+	if s = strings.TrimSpace(s); s == "" {
+		return def
+	}
+	return s
+}
+
+// confirm prompts for a yes/no answer.
+func (w *wizard) confirm(q string, def bool) bool {
+	d := "y/N"
+	if def {
+		d = "Y/n"
+	}
+
+	switch strings.ToLower(w.ask(q+" ("+d+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// runNewWizard sets up a new installation interactively: it prompts for the DB
+// credentials (and checks them), the app's address, URL, and admin credentials,
+// writes config.toml, installs the schema, and optionally creates a site theme
+// directory with the default theme to customize.
+func runNewWizard() error {
+	if _, err := os.Stat("config.toml"); !os.IsNotExist(err) {
+		return fmt.Errorf("config.toml exists. Remove it to set up a new installation")
+	}
+
+	var (
+		w  = &wizard{in: bufio.NewReader(os.Stdin)}
+		fs = initFS()
+	)
+
+	fmt.Println("** new dictpress installation **")
+	fmt.Println()
+
+	// DB credentials, retried until the DB can be connected to.
+	var dbOpt [5]string
+	for {
+		dbOpt = [5]string{
+			w.ask("Postgres host", "localhost"),
+			w.ask("Postgres port", "5432"),
+			w.ask("Database name", "dictpress"),
+			w.ask("Database user", "dictpress"),
+			w.ask("Database password", ""),
+		}
+		port, err := strconv.Atoi(dbOpt[1])
+		if err != nil {
+			fmt.Printf("invalid port '%s'\n\n", dbOpt[1])
+			continue
+		}
+
+		db, err := connectDB(dbOpt[0], port, dbOpt[3], dbOpt[4], dbOpt[2])
+		if err == nil {
+			db.Close()
+			fmt.Println("connected to the database")
+			break
+		}
+
+		fmt.Printf("error connecting to the database: %v\n", err)
+		if !w.confirm("try again?", true) {
+			return fmt.Errorf("install cancelled")
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+
+	var (
+		address  = w.ask("Address to listen on", ":9000")
+		rootURL  = w.ask("Public URL of the site", "http://localhost:9000")
+		adminUsr string
+		adminPwd string
+	)
+	for len(adminUsr) < 6 {
+		if adminUsr = w.ask("Admin username (min 6 characters)", "dictpress"); len(adminUsr) < 6 {
+			fmt.Println("admin username should be min 6 characters")
+		}
+	}
+	for len(adminPwd) < 8 {
+		if adminPwd = w.ask("Admin password (min 8 characters)", newAdminPassword()); len(adminPwd) < 8 {
+			fmt.Println("admin password should be min 8 characters")
+		}
+	}
+	fmt.Println()
+
+	// Write the config.
+	b, err := sampleConfig(fs, "dictpress_admin_password")
+	if err != nil {
+		return err
+	}
+	for _, r := range [][2]string{
+		{`address = ":9000"`, "address = " + tomlString(address)},
+		{`root_url = "http://localhost:9000"`, "root_url = " + tomlString(rootURL)},
+		{`admin_username = "dictpress"`, "admin_username = " + tomlString(adminUsr)},
+		{`admin_password = "dictpress_admin_password"`, "admin_password = " + tomlString(adminPwd)},
+		{"[db]\nhost = \"localhost\"\nport = 5432\ndb = \"dbname\"\nuser = \"username\"\npassword = \"password\"",
+			"[db]\nhost = " + tomlString(dbOpt[0]) + "\nport = " + dbOpt[1] + "\ndb = " + tomlString(dbOpt[2]) +
+				"\nuser = " + tomlString(dbOpt[3]) + "\npassword = " + tomlString(dbOpt[4])},
+	} {
+		if b, err = replaceConfigLine(b, r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	if err := ioutil.WriteFile("config.toml", b, 0600); err != nil {
+		return fmt.Errorf("error writing config.toml: %v", err)
+	}
+	fmt.Println("config.toml generated. The languages and dictionaries can be configured in it")
+	fmt.Println()
+
+	// Install the schema.
+	if w.confirm(fmt.Sprintf("Install the schema in the database '%s'? This wipes existing dictpress tables", dbOpt[2]), true) {
+		port, _ := strconv.Atoi(dbOpt[1])
+		db, err := connectDB(dbOpt[0], port, dbOpt[3], dbOpt[4], dbOpt[2])
+		if err != nil {
+			return fmt.Errorf("error connecting to the database: %v", err)
+		}
+		defer db.Close()
+
+		installSchema(migList[len(migList)-1].version, &App{db: db, fs: fs, lo: lo}, false)
+	} else {
+		fmt.Println("skipped. Run --install to install the schema")
+	}
+	fmt.Println()
+
+	// Optional site theme.
+	site := ""
+	if w.confirm("Create a site theme directory with the default theme to customize?", true) {
+		dir := w.ask("Theme directory", "site")
+		n, err := scaffoldTheme(fs, dir)
+		if err != nil {
+			fmt.Printf("error creating the theme: %v\n", err)
+		} else {
+			fmt.Printf("copied %d theme files to %s\n", n, dir)
+			site = dir
+		}
+	}
+	fmt.Println()
+
+	cmd := "./dictpress"
+	if site != "" {
+		cmd += " --site=" + site
+	}
+	fmt.Printf("done. Run `%s` and visit %s/admin\n", cmd, strings.TrimRight(rootURL, "/"))
+
+	return nil
+}
+
+// scaffoldTheme copies the default site theme, embedded in the binary or in the
+// site directory next to it in the release archive, into a new directory.
+func scaffoldTheme(fs stuffbin.FileSystem, dir string) (int, error) {
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		return 0, fmt.Errorf("%s exists", dir)
+	}
+
+	var (
+		src stuffbin.FileSystem
+		err error
+	)
+	if hasEmbeddedSite(fs) {
+		src, err = subFS(fs, embeddedSiteDir, "/")
+	} else {
+		exe, _ := os.Executable()
+		src, err = loadDirFS(filepath.Join(filepath.Dir(exe), demoSiteDir))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("default theme not found: %v", err)
+	}
+	if len(src.List()) == 0 {
+		return 0, fmt.Errorf("default theme not found")
+	}
+
+	for _, p := range src.List() {
+		b, err := src.Read(p)
+		if err != nil {
+			return 0, err
+		}
+
+		fPath := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(fPath), 0755); err != nil {
+			return 0, err
+		}
+		if err := ioutil.WriteFile(fPath, b, 0644); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(src.List()), nil
+}
+
+// replaceConfigLine replaces the first occurrence of one or more lines in the
+// sample config.
+func replaceConfigLine(b []byte, line, with string) ([]byte, error) {
+	i := bytes.Index(b, []byte("\n"+line+"\n"))
+	if i < 0 {
+		return nil, fmt.Errorf("'%s' not found in the sample config", line)
+	}
+
+	out := make([]byte, 0, len(b)+len(with))
+	out = append(out, b[:i+1]...)
+	out = append(out, with...)
+	return append(out, b[i+1+len(line):]...), nil
+}
+
+// tomlString returns a quoted TOML string.
+func tomlString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// GetAPIKeys returns all API keys.
+func (d *Data) GetAPIKeys() ([]APIKey, error) {
+	out := []APIKey{}
+	err := d.queries.GetAPIKeys.Select(&out)
+	return out, err
+}
+
+// GetAPIKey returns an API key by ID.
+func (d *Data) GetAPIKey(id int) (APIKey, error) {
+	var out APIKey
+	err := d.queries.GetAPIKey.Get(&out, id)
+	return out, err
+}
+
+// InsertAPIKey inserts an API key with the hash of the key.
+func (d *Data) InsertAPIKey(k APIKey) (APIKey, error) {
+	var out APIKey
+	err := d.queries.InsertAPIKey.Get(&out, k.Name, k.KeyHash, k.KeyPrefix, k.Notes, k.RateLimit, k.DailyQuota, k.Enabled)
+	return out, err
+}
+
+// UpdateAPIKey updates the name, notes, limits, and the status of an API key.
+// It returns sql.ErrNoRows if the key doesn't exist.
+func (d *Data) UpdateAPIKey(id int, k APIKey) (APIKey, error) {
+	var out APIKey
+	err := d.queries.UpdateAPIKey.Get(&out, id, k.Name, k.Notes, k.RateLimit, k.DailyQuota, k.Enabled)
+	return out, err
+}
+
+// DeleteAPIKey deletes an API key and its usage.
+func (d *Data) DeleteAPIKey(id int) error {
+	res, err := d.queries.DeleteAPIKey.Exec(id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecordAPIKeyUsage adds the request and rejected request counts of API keys
+// (ID => count) to their counts of the day.
+func (d *Data) RecordAPIKeyUsage(requests, rejected map[int]int) error {
+	var (
+		ids  = make([]int64, 0, len(requests))
+		reqs = make([]int64, 0, len(requests))
+		rejs = make([]int64, 0, len(requests))
+	)
+	for id, n := range requests {
+		ids = append(ids, int64(id))
+		reqs = append(reqs, int64(n))
+		rejs = append(rejs, int64(rejected[id]))
+	}
+
+	_, err := d.queries.RecordAPIKeyUsage.Exec(pq.Int64Array(ids), pq.Int64Array(reqs), pq.Int64Array(rejs))
+	return err
+}
+
+// GetAPIKeyUsage returns the daily request counts of an API key between two
+// dates (YYYY-MM-DD).
+func (d *Data) GetAPIKeyUsage(id int, from, to string) ([]APIKeyUsage, error) {
+	out := []APIKeyUsage{}
+	err := d.queries.GetAPIKeyUsage.Select(&out, id, from, to)
+	return out, err
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Placeholder in collated queries that's replaced with a language's collation.
+const collationPlaceholder = "{collation}"
+
+// collatedQueries are the queries of a language that order words with the
+// language's Postgres collation (eg: ICU collations such as de-x-icu). As
+// collations can't be query params, they're prepared for every language.
+type collatedQueries struct {
+	GetInitials      *sqlx.Stmt
+	GetGlossaryWords *sqlx.Stmt
+	GetGlossaryAfter *sqlx.Stmt
+}
+
+// PrepareCollations prepares the collated queries (name => raw SQL) for the
+// languages that have a `collation`.
+func (d *Data) PrepareCollations(db *sqlx.DB, queries map[string]string) error {
+	d.collated = make(map[string]collatedQueries)
+
+	for id, l := range d.Langs {
+		if l.Collation == "" {
+			continue
+		}
+
+		var c collatedQueries
+		for name, stmt := range map[string]**sqlx.Stmt{
+			"get-initials-collated":             &c.GetInitials,
+			"get-glossary-words-collated":       &c.GetGlossaryWords,
+			"get-glossary-words-after-collated": &c.GetGlossaryAfter,
+		} {
+			q, ok := queries[name]
+			if !ok {
+				return fmt.Errorf("query '%s' not found", name)
+			}
+
+			s, err := db.Unsafe().Preparex(strings.ReplaceAll(q, collationPlaceholder, pq.QuoteIdentifier(l.Collation)))
+			if err != nil {
+				return fmt.Errorf("error preparing collation '%s' for %s: %v", l.Collation, id, err)
+			}
+			*stmt = s
+		}
+
+		d.collated[id] = c
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Compounder splits compound words (eg: German Haustür => haus, tür) into
+// their components using a list of known words (eg: the headwords in the
+// dictionary) so that compounds without entries of their own match the
+// entries of their components.
+type Compounder struct {
+	known map[string]bool
+
+	// Min length (runes) of a component.
+	minLen int
+
+	// Linking elements that can join components, eg: the s in Arbeitszimmer.
+	joiners []string
+
+	mu sync.RWMutex
+}
+
+// NewCompounder returns a new Compounder that splits words into the given
+// known words.
+func NewCompounder(words []string, minLen int, joiners []string) *Compounder {
+	if minLen < 1 {
+		minLen = 1
+	}
+
+	c := &Compounder{minLen: minLen}
+	for _, j := range joiners {
+		if j = strings.ToLower(strings.TrimSpace(j)); j != "" {
+			c.joiners = append(c.joiners, j)
+		}
+	}
+	c.Load(words)
+
+	return c
+}
+
+// Load replaces the known words of the Compounder. It's safe to call while
+// words are being split.
+func (c *Compounder) Load(words []string) {
+	known := make(map[string]bool, len(words))
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if utf8.RuneCountInString(w) < c.minLen || strings.ContainsAny(w, " -") {
+			continue
+		}
+		known[w] = true
+	}
+
+	c.mu.Lock()
+	c.known = known
+	c.mu.Unlock()
+}
+
+// Split splits a single word into the fewest known components, optionally
+// joined by linking elements. If the word is known itself, or can't be split
+// into two or more components, false is returned.
+func (c *Compounder) Split(word string) ([]string, bool) {
+	word = strings.ToLower(strings.TrimSpace(word))
+	if word == "" || strings.ContainsAny(word, " \t") {
+		return nil, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.known[word] {
+		return nil, false
+	}
+
+	// parts[i] is the fewest components that the word[i:] splits into
+	// (nil if it can't be split). Byte offsets are only taken at rune boundaries.
+	var (
+		n     = len(word)
+		parts = make([][]string, n+1)
+	)
+	parts[n] = []string{}
+	for i := n - 1; i >= 0; i-- {
+		if !utf8.RuneStart(word[i]) {
+			continue
+		}
+
+		for j := n; j > i; j-- {
+			if j < n && !utf8.RuneStart(word[j]) {
+				continue
+			}
+
+			w := word[i:j]
+			if !c.known[w] {
+				continue
+			}
+
+			// The rest of the word directly or after a linking element.
+			next := [][]string{parts[j]}
+			for _, jn := range c.joiners {
+				if j < n && strings.HasPrefix(word[j:], jn) {
+					next = append(next, parts[j+len(jn)])
+				}
+			}
+
+			for _, rest := range next {
+				if rest == nil {
+					continue
+				}
+				if parts[i] == nil || len(rest)+1 < len(parts[i]) {
+					parts[i] = append([]string{w}, rest...)
+				}
+			}
+		}
+	}
+
+	if len(parts[0]) < 2 {
+		return nil, false
+	}
+
+	return parts[0], true
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"html"
+
+	"github.com/knadh/dictpress/internal/markdown"
+	"github.com/knadh/dictpress/internal/sanitize"
+)
+
+// Formats of the content (and notes) of entries in a language.
+const (
+	// ContentText is plain text that's escaped when rendered.
+	ContentText = "text"
+
+	// ContentHTML is HTML (eg: from a WYSIWYG editor) that's sanitized by
+	// the sanitizer policy when it's written.
+	ContentHTML = "html"
+
+	// ContentMarkdown is Markdown that's stored as is and rendered to
+	// sanitized HTML.
+	ContentMarkdown = "markdown"
+)
+
+// ContentFormats is the list of valid content formats.
+var ContentFormats = map[string]bool{
+	ContentText:     true,
+	ContentHTML:     true,
+	ContentMarkdown: true,
+}
+
+var defaultSanitizer = sanitize.New(nil, nil)
+
+// SanitizeContent returns the content (or notes) of an entry in the language
+// as it should be stored. HTML is sanitized and the other formats are
+// returned as is.
+func (l Lang) SanitizeContent(s string) string {
+	if l.ContentFormat != ContentHTML || s == "" {
+		return s
+	}
+
+	return l.sanitizer().Sanitize(s)
+}
+
+// RenderHTML renders the content (or notes) of an entry in the language's
+// content format to sanitized HTML.
+func (l Lang) RenderHTML(s string) string {
+	return RenderHTML(s, l.ContentFormat, l.sanitizer())
+}
+
+func (l Lang) sanitizer() *sanitize.Policy {
+	if l.Sanitizer == nil {
+		return defaultSanitizer
+	}
+	return l.Sanitizer
+}
+
+// RenderHTML renders a string in the given content format to HTML sanitized
+// by the policy, or the default policy if it's nil.
+func RenderHTML(s, format string, p *sanitize.Policy) string {
+	if p == nil {
+		p = defaultSanitizer
+	}
+
+	switch format {
+	case ContentHTML:
+		return p.Sanitize(s)
+	case ContentMarkdown:
+		return p.Sanitize(markdown.ToHTML(s))
+	}
+
+	return html.EscapeString(s)
+}
@@ -3,11 +3,15 @@ package data
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/knadh/dictpress/internal/sanitize"
 	"github.com/lib/pq"
+	null "gopkg.in/volatiletech/null.v6"
 )
 
 const (
@@ -16,6 +20,57 @@ const (
 	StatusDisabled = "disabled"
 )
 
+// Search match modes.
+const (
+	// Fulltext (tsquery) search along with direct headword matches.
+	MatchFTS       = "fts"
+	MatchExact     = "exact"
+	MatchPrefix    = "prefix"
+	MatchSubstring = "substring"
+)
+
+// MatchModes is the list of valid search match modes.
+var MatchModes = map[string]bool{
+	MatchFTS: true, MatchExact: true, MatchPrefix: true, MatchSubstring: true,
+}
+
+// Interpretations of multi-word fulltext queries.
+const (
+	// The words in the given order next to each other.
+	MultiwordPhrase = "phrase"
+	// All the words in any order.
+	MultiwordAnd = "and"
+	// Any of the words.
+	MultiwordOr = "or"
+)
+
+// multiwordOps maps multi-word interpretations to tsquery operators.
+var multiwordOps = map[string]string{
+	MultiwordPhrase: " <-> ", MultiwordAnd: " & ", MultiwordOr: " | ",
+}
+
+// EtymologyTypes is the list of valid etymological link types.
+var EtymologyTypes = map[string]bool{
+	"borrowed-from": true, "inherited-from": true, "derived-from": true, "calque-of": true, "cognate-of": true,
+}
+
+// Background job statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// User roles.
+const (
+	RoleAdmin    = "admin"
+	RoleEditor   = "editor"
+	RoleReviewer = "reviewer"
+	RoleReadOnly = "readonly"
+)
+
 // Lang represents a language's configuration.
 type Lang struct {
 	ID            string            `json:"id"`
@@ -24,6 +79,67 @@ type Lang struct {
 	TokenizerName string            `json:"tokenizer"`
 	TokenizerType string            `json:"tokenizer_type"`
 	Tokenizer     Tokenizer         `json:"-"`
+
+	// Optional labels for definitions (senses) in the language, like Types.
+	Genders   map[string]string `json:"genders"`
+	Registers map[string]string `json:"registers"`
+	Domains   map[string]string `json:"domains"`
+
+	// Default search match mode (fts|exact|prefix|substring).
+	Match string `json:"match"`
+
+	// Loosest interpretation (and|or) that multi-word fulltext queries fall
+	// back to when the phrase yields no results.
+	Multiword string `json:"multiword"`
+
+	// Optional query-time stopwords that are dropped from search queries
+	// and synonyms that every word in a query is expanded into.
+	Stopwords map[string]bool     `json:"-"`
+	Synonyms  map[string][]string `json:"-"`
+
+	// Number of words in the longest (multi-word) synonym.
+	SynonymWords int `json:"-"`
+
+	// Optional spelling corrector for search queries.
+	Speller *Speller `json:"-"`
+
+	// Optional compound word splitter for search queries.
+	Compounder *Compounder `json:"-"`
+
+	// Unicode scripts (eg: Latin, Kannada) that the language is written in
+	// and an optional n-gram model for detecting the language of queries.
+	Scripts []string `json:"scripts"`
+	NGrams  *NGrams  `json:"-"`
+
+	// Normalization (eg: diacritic and case insensitivity) of headwords and
+	// search queries.
+	Normalize Normalization `json:"normalize"`
+
+	// Text direction (ltr|rtl) and the BCP 47 locale (eg: ar, he) of the
+	// language for rendering and sorting (eg: glossary initials).
+	Direction string `json:"direction"`
+	Locale    string `json:"locale"`
+
+	// Optional Postgres collation (eg: de-x-icu) for ordering glossaries.
+	Collation string `json:"collation"`
+
+	// Optional Postgres text search configuration that's created in the DB
+	// with the tokenizer's name (see SyncTSConfig).
+	TSConfig *TSConfig `json:"ts_config"`
+
+	// Custom typed metadata fields of entries (eg: frequency_rank, dialect)
+	// that are stored in the entries' meta.
+	Fields Fields `json:"fields"`
+
+	// Templates of entries (eg: noun, verb, proverb) that entries can be
+	// created with, and whether new entries have to use one.
+	Templates       Templates `json:"templates"`
+	RequireTemplate bool      `json:"require_template"`
+
+	// Format of the content and notes of entries (text|html|markdown) and
+	// the policy that HTML is sanitized by.
+	ContentFormat string           `json:"content_format"`
+	Sanitizer     *sanitize.Policy `json:"-"`
 }
 
 // LangMap represents a map of language controllers indexed by the language key.
@@ -32,6 +148,30 @@ type LangMap map[string]Lang
 // Dicts represents dictionaries, where each dictionary is a pair of languages.
 type Dicts [][2]Lang
 
+// Ranking represents the factors that make up the rank of a search result.
+// Results are ordered by rank in ascending order, so boosts lower the rank.
+type Ranking struct {
+	// Boost for exact (case insensitive) headword matches.
+	ExactMatch float64 `json:"exact_match"`
+
+	// Multiplier for the Postgres fulltext TS_RANK score.
+	FTSRank float64 `json:"fts_rank"`
+
+	// Multiplier for the entry's manual weight. Lower weights rank higher.
+	Weight float64 `json:"weight"`
+
+	// Multiplier for the (log of) the entry's click-through count.
+	Clicks float64 `json:"clicks"`
+
+	// Multiplier for the (log of) the entry's word frequency rank. More
+	// frequent words rank higher.
+	Frequency float64 `json:"frequency"`
+}
+
+// Rankings represents ranking configuration for dictionary pairs indexed by
+// "fromLang/toLang". The empty key "" holds the default ranking.
+type Rankings map[string]Ranking
+
 // Tokenizer represents a function that takes a string
 // and returns a list of Postgres tsvector tokens.
 type Tokenizer interface {
@@ -44,6 +184,18 @@ type Tokenizer interface {
 	ToQuery(s string, lang string) (string, error)
 }
 
+// SearchBackend represents an optional external search index (eg: Elasticsearch)
+// that search queries are run against instead of Postgres. Entries are still
+// loaded from Postgres, which is the source of truth.
+type SearchBackend interface {
+	// Search returns the IDs of the entries matching the query in the order
+	// of relevance and the total number of matches.
+	Search(q Query) ([]int, int, error)
+
+	// Delete deletes the given entries from the index.
+	Delete(ids []int) error
+}
+
 // Token represents a Postgres tsvector token.
 type Token struct {
 	Token  string
@@ -53,19 +205,51 @@ type Token struct {
 // Queries contains prepared DB queries.
 type Queries struct {
 	Search             *sqlx.Stmt `query:"search"`
+	SearchTSQuery      *sqlx.Stmt `query:"search-tsquery"`
+	Tokenize           *sqlx.Stmt `query:"tokenize"`
 	SearchRelations    *sqlx.Stmt `query:"search-relations"`
 	GetEntry           *sqlx.Stmt `query:"get-entry"`
+	GetEntryByGUID     *sqlx.Stmt `query:"get-entry-by-guid"`
+	EntryExists        *sqlx.Stmt `query:"entry-exists"`
+	GetEntryBySlug     *sqlx.Stmt `query:"get-entry-by-slug"`
+	GetSlugRedirect    *sqlx.Stmt `query:"get-slug-redirect"`
+	RecordClicks       *sqlx.Stmt `query:"record-clicks"`
+	ResetFreqRanks     *sqlx.Stmt `query:"reset-frequency-ranks"`
+	UpdateFreqRanks    *sqlx.Stmt `query:"update-frequency-ranks"`
+	DeleteOldViews     *sqlx.Stmt `query:"delete-old-views"`
+	GetPopularEntries  *sqlx.Stmt `query:"get-popular-entries"`
+	GetEntriesByIDs    *sqlx.Stmt `query:"get-entries-by-ids"`
+	GetSimilarByTokens *sqlx.Stmt `query:"get-similar-by-tokens"`
+	GetSimilarByTags   *sqlx.Stmt `query:"get-similar-by-tags"`
+	GetEntriesForIndex *sqlx.Stmt `query:"get-entries-for-index"`
+	GetReindexEntries  *sqlx.Stmt `query:"get-reindex-entries"`
+	ReindexEntry       *sqlx.Stmt `query:"reindex-entry"`
+	GetDeletedEntries  *sqlx.Stmt `query:"get-deleted-entries"`
 	GetParentRelations *sqlx.Stmt `query:"get-parent-relations"`
+	GetReverseDefs     *sqlx.Stmt `query:"get-reverse-defs"`
 	GetInitials        *sqlx.Stmt `query:"get-initials"`
 	GetGlossaryWords   *sqlx.Stmt `query:"get-glossary-words"`
+	GetGlossaryAfter   *sqlx.Stmt `query:"get-glossary-words-after"`
+	GetHeadwords       *sqlx.Stmt `query:"get-headwords"`
+	GetIndexWords      *sqlx.Stmt `query:"get-index-words"`
+	GetRecentEntries   *sqlx.Stmt `query:"get-recent-entries"`
 	InsertEntry        *sqlx.Stmt `query:"insert-entry"`
 	UpdateEntry        *sqlx.Stmt `query:"update-entry"`
+	LockEntry          *sqlx.Stmt `query:"lock-entry"`
+	GetEntryLock       *sqlx.Stmt `query:"get-entry-lock"`
+	UnlockEntry        *sqlx.Stmt `query:"unlock-entry"`
 	InsertRelation     *sqlx.Stmt `query:"insert-relation"`
+	GetRelationLang    *sqlx.Stmt `query:"get-relation-lang"`
 	UpdateRelation     *sqlx.Stmt `query:"update-relation"`
 	ReorderRelations   *sqlx.Stmt `query:"reorder-relations"`
 	DeleteEntry        *sqlx.Stmt `query:"delete-entry"`
 	DeleteRelation     *sqlx.Stmt `query:"delete-relation"`
 	GetStats           *sqlx.Stmt `query:"get-stats"`
+	RefreshCounts      *sqlx.Stmt `query:"refresh-counts"`
+	InsertSearchMiss   *sqlx.Stmt `query:"insert-search-miss"`
+
+	GetMissingTranslations *sqlx.Stmt `query:"get-missing-translations"`
+	GetMissingRefs         *sqlx.Stmt `query:"get-missing-refs"`
 
 	GetPendingEntries        *sqlx.Stmt `query:"get-pending-entries"`
 	InsertSubmissionEntry    *sqlx.Stmt `query:"insert-submission-entry"`
@@ -76,13 +260,148 @@ type Queries struct {
 	DeleteAllPending         *sqlx.Stmt `query:"delete-all-pending"`
 	ApproveSubmission        *sqlx.Stmt `query:"approve-submission"`
 	RejectSubmission         *sqlx.Stmt `query:"reject-submission"`
+
+	GetEditorComments   *sqlx.Stmt `query:"get-editor-comments"`
+	InsertEditorComment *sqlx.Stmt `query:"insert-editor-comment"`
+	DeleteEditorComment *sqlx.Stmt `query:"delete-editor-comment"`
+
+	GetEtymology    *sqlx.Stmt `query:"get-etymology"`
+	UpdateEtymology *sqlx.Stmt `query:"update-etymology"`
+
+	ScheduleEntry    *sqlx.Stmt `query:"schedule-entry"`
+	GetScheduled     *sqlx.Stmt `query:"get-scheduled-entries"`
+	PublishScheduled *sqlx.Stmt `query:"publish-scheduled-entries"`
+
+	GetMedia    *sqlx.Stmt `query:"get-media"`
+	InsertMedia *sqlx.Stmt `query:"insert-media"`
+	DeleteMedia *sqlx.Stmt `query:"delete-media"`
+
+	GetEntriesWithoutAudio *sqlx.Stmt `query:"get-entries-without-audio"`
+	GetHeadwordsByTags     *sqlx.Stmt `query:"get-headwords-by-tags"`
+	GetQuizWords           *sqlx.Stmt `query:"get-quiz-words"`
+	InsertReaderToken      *sqlx.Stmt `query:"insert-reader-token"`
+	LoginReader            *sqlx.Stmt `query:"login-reader"`
+	GetReader              *sqlx.Stmt `query:"get-reader"`
+	DeleteReader           *sqlx.Stmt `query:"delete-reader"`
+	GetWordLists           *sqlx.Stmt `query:"get-word-lists"`
+	GetWordList            *sqlx.Stmt `query:"get-word-list"`
+	InsertWordList         *sqlx.Stmt `query:"insert-word-list"`
+	UpdateWordList         *sqlx.Stmt `query:"update-word-list"`
+	DeleteWordList         *sqlx.Stmt `query:"delete-word-list"`
+	GetPublicWordList      *sqlx.Stmt `query:"get-public-word-list"`
+	GetPublicWordLists     *sqlx.Stmt `query:"get-public-word-lists"`
+	UpdateWordListFeatured *sqlx.Stmt `query:"update-word-list-featured"`
+	GetWordListEntries     *sqlx.Stmt `query:"get-word-list-entries"`
+	InsertWordListEntry    *sqlx.Stmt `query:"insert-word-list-entry"`
+	DeleteWordListEntry    *sqlx.Stmt `query:"delete-word-list-entry"`
+
+	GetRedirects    *sqlx.Stmt `query:"get-redirects"`
+	GetRedirect     *sqlx.Stmt `query:"get-redirect"`
+	MatchRedirect   *sqlx.Stmt `query:"match-redirect"`
+	InsertRedirect  *sqlx.Stmt `query:"insert-redirect"`
+	UpsertRedirects *sqlx.Stmt `query:"upsert-redirects"`
+	UpdateRedirect  *sqlx.Stmt `query:"update-redirect"`
+	DeleteRedirect  *sqlx.Stmt `query:"delete-redirect"`
+
+	GetAPIKeys        *sqlx.Stmt `query:"get-api-keys"`
+	GetAPIKey         *sqlx.Stmt `query:"get-api-key"`
+	InsertAPIKey      *sqlx.Stmt `query:"insert-api-key"`
+	UpdateAPIKey      *sqlx.Stmt `query:"update-api-key"`
+	DeleteAPIKey      *sqlx.Stmt `query:"delete-api-key"`
+	RecordAPIKeyUsage *sqlx.Stmt `query:"record-api-key-usage"`
+	GetAPIKeyUsage    *sqlx.Stmt `query:"get-api-key-usage"`
+
+	GetRelationExamples *sqlx.Stmt `query:"get-relation-examples"`
+	InsertExample       *sqlx.Stmt `query:"insert-example"`
+	UpdateExample       *sqlx.Stmt `query:"update-example"`
+	DeleteExample       *sqlx.Stmt `query:"delete-example"`
+	SearchExamples      *sqlx.Stmt `query:"search-examples"`
+
+	GetUsers   *sqlx.Stmt `query:"get-users"`
+	GetUser    *sqlx.Stmt `query:"get-user"`
+	InsertUser *sqlx.Stmt `query:"insert-user"`
+	UpdateUser *sqlx.Stmt `query:"update-user"`
+	DeleteUser *sqlx.Stmt `query:"delete-user"`
+
+	InsertAuditLog        *sqlx.Stmt `query:"insert-audit-log"`
+	GetAuditLogs          *sqlx.Stmt `query:"get-audit-logs"`
+	GetAuditRelation      *sqlx.Stmt `query:"get-audit-relation"`
+	GetAuditComment       *sqlx.Stmt `query:"get-audit-comment"`
+	GetAuditEditorComment *sqlx.Stmt `query:"get-audit-editor-comment"`
+	GetAuditExample       *sqlx.Stmt `query:"get-audit-example"`
+	GetAuditMedia         *sqlx.Stmt `query:"get-audit-media"`
+	GetAuditTrash         *sqlx.Stmt `query:"get-audit-trash"`
+
+	GetDumpEntries      *sqlx.Stmt `query:"get-dump-entries"`
+	UpsertDumpEntry     *sqlx.Stmt `query:"upsert-dump-entry"`
+	UpsertDumpRelation  *sqlx.Stmt `query:"upsert-dump-relation"`
+	UpsertDumpEtymology *sqlx.Stmt `query:"upsert-dump-etymology"`
+
+	GetChanges *sqlx.Stmt `query:"get-changes"`
+
+	InsertJob    *sqlx.Stmt `query:"insert-job"`
+	GetJob       *sqlx.Stmt `query:"get-job"`
+	GetJobs      *sqlx.Stmt `query:"get-jobs"`
+	NextJob      *sqlx.Stmt `query:"next-job"`
+	AppendJobLog *sqlx.Stmt `query:"append-job-log"`
+	FinishJob    *sqlx.Stmt `query:"finish-job"`
+	CancelJob    *sqlx.Stmt `query:"cancel-job"`
+
+	GetCheckpoint    *sqlx.Stmt `query:"get-import-checkpoint"`
+	UpsertCheckpoint *sqlx.Stmt `query:"upsert-import-checkpoint"`
+	ImportStaged     *sqlx.Stmt `query:"import-staged"`
+
+	GetReplaceEntries   *sqlx.Stmt `query:"get-replace-entries"`
+	ReplaceEntryContent *sqlx.Stmt `query:"replace-entry-content"`
+
+	GetTrash     *sqlx.Stmt `query:"get-trash"`
+	GetTrashItem *sqlx.Stmt `query:"get-trash-item"`
+	RestoreTrash *sqlx.Stmt `query:"restore-trash"`
+	DeleteTrash  *sqlx.Stmt `query:"delete-trash"`
+
+	GetSetting        *sqlx.Stmt `query:"get-setting"`
+	UpsertSetting     *sqlx.Stmt `query:"upsert-setting"`
+	NotifyEvent       *sqlx.Stmt `query:"notify-event"`
+	BackfillShortIDs  *sqlx.Stmt `query:"backfill-short-ids"`
+	GetTSConfigs      *sqlx.Stmt `query:"get-ts-configs"`
+	GetTSConfigSchema *sqlx.Stmt `query:"get-ts-config-schema"`
+
+	GetLangs   *sqlx.Stmt `query:"get-langs"`
+	UpsertLang *sqlx.Stmt `query:"upsert-lang"`
+	DeleteLang *sqlx.Stmt `query:"delete-lang"`
+
+	PreviewDeleteEntry      *sqlx.Stmt `query:"preview-delete-entry"`
+	PreviewDeleteRelation   *sqlx.Stmt `query:"preview-delete-relation"`
+	PreviewDeleteTrash      *sqlx.Stmt `query:"preview-delete-trash"`
+	PreviewDeleteAllPending *sqlx.Stmt `query:"preview-delete-all-pending"`
+	PreviewUpsertRedirects  *sqlx.Stmt `query:"preview-upsert-redirects"`
 }
 
 // Data represents the dictionary search interface.
 type Data struct {
-	queries *Queries
-	Langs   LangMap
-	Dicts   Dicts
+	queries  *Queries
+	Langs    LangMap
+	Dicts    Dicts
+	Rankings Rankings
+	Licenses Licenses
+
+	// Optional external search backend.
+	Backend SearchBackend
+
+	// Queries ordered by the collations of languages that have one.
+	collated map[string]collatedQueries
+
+	// Strategies for finding similar entries by name.
+	similar map[string]SimilarFunc
+
+	// Optional semantic search mode (see PrepareSemantic).
+	semantic *semantic
+
+	// Raw search query for explaining searches (see PrepareExplain).
+	explain *explainer
+
+	// Bands of word frequency ranks (see SetFrequencyBands).
+	frequencyBands []FrequencyBand
 }
 
 // Query represents the parameters of a single search query.
@@ -95,48 +414,205 @@ type Query struct {
 	Status   string   `json:"status"`
 	Offset   int      `json:"offset"`
 	Limit    int      `json:"limit"`
+
+	// The query as it was entered with the search syntax (eg: tag:idiom), if
+	// it had any, for showing it back in search boxes.
+	Input string `json:"-"`
+
+	// Match mode (fts|exact|prefix|substring). Defaults to the language's match mode.
+	Match string `json:"match"`
+
+	// Search mode. If it's ModeSemantic, headwords are matched by the meaning
+	// of the query with their embeddings instead of the match mode.
+	Mode string `json:"mode,omitempty"`
+
+	// Interpretation (phrase|and|or) of multi-word queries in the fts match mode
+	// for languages with Postgres tokenizers. If it's empty, the words are ANDed.
+	Multiword string `json:"multiword,omitempty"`
+
+	// Sort order of the matches. If it's SortFrequency, the matches are
+	// ordered by their word frequency ranks instead of relevance.
+	Sort string `json:"sort,omitempty"`
+
+	// Levels of nested relations (definitions of definitions) to load into
+	// results. 0 and 1 load only the definitions of the matches.
+	RelationDepth int `json:"-"`
+
+	// Highlight the query's words in the results, optionally in snippets of
+	// up to SnippetWords words of the content.
+	Highlight    bool `json:"-"`
+	SnippetWords int  `json:"-"`
+
+	// Render the content and notes of the results to sanitized HTML.
+	RenderHTML bool `json:"-"`
+
+	// Custom field values (see Lang.Fields) that the matches' meta should have.
+	Fields JSON `json:"fields,omitempty"`
+
+	// Filters on the definitions (relations) of the matches. Matches should
+	// have at least one definition with any of the given parts of speech
+	// (types) and labels.
+	POS       []string `json:"pos,omitempty"`
+	Genders   []string `json:"genders,omitempty"`
+	Registers []string `json:"registers,omitempty"`
+	Domains   []string `json:"domains,omitempty"`
+
+	// Facets (pos|tag|lang) to count the matches by. The counts are returned
+	// in the Facets of the first match.
+	Facets []string `json:"facets,omitempty"`
+
+	// Keyset pagination. If AfterGUID is set, only the matches after the match
+	// with the score and GUID (the last match of the previous page) are
+	// returned and Offset should be 0.
+	AfterScore float64 `json:"-"`
+	AfterGUID  string  `json:"-"`
 }
 
 // New returns an instance of the search interface.
-func New(q *Queries, langs LangMap, dicts Dicts) *Data {
-	return &Data{
-		queries: q,
-		Langs:   langs,
-		Dicts:   dicts,
+func New(q *Queries, langs LangMap, dicts Dicts, rankings Rankings) *Data {
+	d := &Data{
+		queries:  q,
+		Langs:    langs,
+		Dicts:    dicts,
+		Rankings: rankings,
+	}
+
+	d.RegisterSimilar(SimilarTokens, similarByQuery(q.GetSimilarByTokens))
+	d.RegisterSimilar(SimilarTags, similarByQuery(q.GetSimilarByTags))
+
+	return d
+}
+
+// GetRanking returns the ranking configuration for a dictionary pair. If
+// the pair has no specific configuration, the default ranking is returned.
+func (d *Data) GetRanking(fromLang, toLang string) Ranking {
+	if r, ok := d.Rankings[fromLang+"/"+toLang]; ok {
+		return r
 	}
+
+	return d.Rankings[""]
 }
 
 // Search returns the entries filtered and paginated by a
 // given Query along with the total number of matches in the
 // database.
 func (d *Data) Search(q Query) ([]Entry, int, error) {
+	if q.Mode == ModeSemantic {
+		return d.searchSemantic(q)
+	}
+	if d.Backend != nil {
+		return d.searchBackend(q)
+	}
+
+	args, err := d.searchParams(q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var out []Entry
+	if err := d.queries.Search.Select(&out, args...); err != nil {
+		if err == sql.ErrNoRows {
+			return []Entry{}, 0, nil
+		}
+
+		return nil, 0, err
+	}
+
+	if len(out) == 0 {
+		return []Entry{}, 0, nil
+	}
+
+	// Replace nulls with [].
+	for i, _ := range out {
+		if out[i].Relations == nil {
+			out[i].Relations = []Entry{}
+		}
+	}
+
+	return out, out[0].Total, nil
+}
+
+// searchParams returns the params of the search SQL query for a query after
+// normalizing and tokenizing it with its language's config.
+func (d *Data) searchParams(q Query) ([]interface{}, error) {
 	// Is there a Tokenizer?
 	var (
 		tsVectorLang  = ""
 		tsVectorQuery string
-		out           []Entry
 	)
 
 	lang, ok := d.Langs[q.FromLang]
 	if !ok {
-		return out, 0, fmt.Errorf("unknown language %s", q.FromLang)
+		return nil, fmt.Errorf("unknown language %s", q.FromLang)
+	}
+
+	if q.Match == "" {
+		q.Match = lang.Match
+	}
+	if !MatchModes[q.Match] {
+		return nil, fmt.Errorf("unknown match mode %s", q.Match)
+	}
+
+	// Normalize the query the same way the language's headwords are normalized.
+	normalize := lang.Normalize.Enabled()
+	if normalize {
+		q.Query = lang.Normalize.Apply(q.Query)
 	}
 
 	var (
 		tkName = lang.TokenizerName
 		tk     = lang.Tokenizer
+
+		// Stopword filtered and synonym expanded query words, if the language has them.
+		words   [][]string
+		tsExpr  string
+		hasThes = len(lang.Stopwords) > 0 || len(lang.Synonyms) > 0
+
+		// LIKE pattern for the prefix and substring match modes.
+		pattern string
 	)
+	if hasThes && q.Match == MatchFTS {
+		words = lang.ExpandQuery(q.Query)
+	} else if q.Multiword != "" && q.Match == MatchFTS {
+		for _, w := range strings.Fields(q.Query) {
+			words = append(words, []string{w})
+		}
+	}
 
-	if tk == nil {
+	op := " & "
+	if o, ok := multiwordOps[q.Multiword]; ok {
+		op = o
+	}
+
+	switch {
+	case q.Match == MatchPrefix:
+		pattern = escapeLike(q.Query) + "%"
+	case q.Match == MatchSubstring:
+		pattern = "%" + escapeLike(q.Query) + "%"
+	case q.Match == MatchExact:
+		// The query is matched as is.
+	case tk == nil:
 		// No external tokenizer. Use the Postgres tokenizer name.
 		tsVectorLang = tkName
-	} else {
+
+		if hasThes || q.Multiword != "" {
+			tsExpr = toTSQueryExpr(words, op)
+		}
+	case hasThes && len(words) > 0:
+		// Tokenize every alternative of every word with the external tokenizer
+		// and combine them into a single tsquery.
+		var err error
+		tsVectorQuery, err = tokenizeExpanded(words, tk, q.FromLang)
+		if err != nil {
+			return nil, err
+		}
+	default:
 		// If there's an external tokenizer loaded, run it to get the tokens
 		// and pass it to the DB directly instructing the DB not to tokenize internally.
 		var err error
 		tsVectorQuery, err = tk.ToQuery(q.Query, q.FromLang)
 		if err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 	}
 
@@ -149,8 +625,25 @@ func (d *Data) Search(q Query) ([]Entry, int, error) {
 	// $6 - []tags (optional)
 	// $7 - offset
 	// $8 - limit
+	// $9 to $12 - ranking boosts (exact match, fulltext rank, weight, clicks)
+	// $13 - stopword filtered and synonym expanded tsquery expression for $2 (optional)
+	// $14 - match mode
+	// $15 - LIKE pattern for the prefix and substring match modes
+	// $16 - whether the language has normalization and $1 is normalized
+	// $17 - custom field values that the entries' meta should contain (optional)
+	// $18 to $21 - []types, []genders, []registers, []domains of the definitions (optional)
+	// $22 - []facets to count (optional)
+	// $23, $24 - score and GUID of the last result of the previous page for keyset pagination (optional)
+	// $25 - ranking boost for word frequency
+	// $26 - sort order (optional)
+
+	fields := q.Fields
+	if fields == nil {
+		fields = JSON{}
+	}
 
-	if err := d.queries.Search.Select(&out,
+	rk := d.GetRanking(q.FromLang, q.ToLang)
+	return []interface{}{
 		q.Query,
 		tsVectorLang,
 		tsVectorQuery,
@@ -158,26 +651,222 @@ func (d *Data) Search(q Query) ([]Entry, int, error) {
 		pq.StringArray(q.Tags),
 		q.Status,
 		q.Offset, q.Limit,
-	); err != nil {
-		if err == sql.ErrNoRows {
-			return []Entry{}, 0, nil
-		}
+		rk.ExactMatch, rk.FTSRank, rk.Weight, rk.Clicks,
+		tsExpr,
+		q.Match, pattern,
+		normalize,
+		fields,
+		pq.StringArray(q.POS), pq.StringArray(q.Genders), pq.StringArray(q.Registers), pq.StringArray(q.Domains),
+		pq.StringArray(q.Facets),
+		q.AfterScore, q.AfterGUID,
+		rk.Frequency,
+		q.Sort,
+	}, nil
+}
+
+// CheckBackendQuery returns an error if a query has params that the external
+// search backend doesn't support. The search backend matches headwords by
+// their language, definition languages, tags, and status, and the rankings
+// (boosts) of the SQL search don't apply to it.
+func CheckBackendQuery(q Query) error {
+	switch {
+	case len(q.Fields) > 0:
+		return errors.New("custom field filters aren't supported with the search backend")
+	case len(q.POS)+len(q.Genders)+len(q.Registers)+len(q.Domains) > 0:
+		return errors.New("`pos`, `gender`, `register`, and `domain` filters aren't supported with the search backend")
+	case len(q.Facets) > 0:
+		return errors.New("`facets` aren't supported with the search backend")
+	case q.AfterGUID != "":
+		return errors.New("`cursor` isn't supported with the search backend. Use `page`.")
+	case q.Sort == SortFrequency:
+		return errors.New("`sort=frequency` isn't supported with the search backend")
+	}
+
+	return nil
+}
 
+// searchBackend runs the query against the external search backend and
+// loads the matching entries from the DB in the order of relevance.
+func (d *Data) searchBackend(q Query) ([]Entry, int, error) {
+	if err := CheckBackendQuery(q); err != nil {
 		return nil, 0, err
 	}
 
-	if len(out) == 0 {
+	ids, total, err := d.Backend.Search(q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(ids) == 0 {
 		return []Entry{}, 0, nil
 	}
 
-	// Replace nulls with [].
-	for i, _ := range out {
-		if out[i].Relations == nil {
-			out[i].Relations = []Entry{}
+	res, err := d.GetEntriesByIDs(ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Order the entries by the backend's relevance. Entries that may have
+	// been deleted from the DB but not the index are skipped.
+	byID := make(map[int]Entry, len(res))
+	for _, e := range res {
+		byID[e.ID] = e
+	}
+
+	out := make([]Entry, 0, len(ids))
+	for _, id := range ids {
+		e, ok := byID[id]
+		if !ok {
+			continue
 		}
+
+		e.Relations = []Entry{}
+		out = append(out, e)
 	}
 
-	return out, out[0].Total, nil
+	return out, total, nil
+}
+
+// GetEntriesByIDs returns entries by their ids.
+func (d *Data) GetEntriesByIDs(ids []int) ([]Entry, error) {
+	var out []Entry
+	if err := d.queries.GetEntriesByIDs.Select(&out, pq.Array(ids)); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetDeletedEntries returns the tombstones of entries deleted after the given
+// (deleted_at, id) position.
+func (d *Data) GetDeletedEntries(after time.Time, afterID int64, limit int) ([]DeletedEntry, error) {
+	var out []DeletedEntry
+	if err := d.queries.GetDeletedEntries.Select(&out, after, afterID, limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetEntriesForIndex returns entries updated after the given (updated_at, id)
+// position for syncing to an external search index.
+func (d *Data) GetEntriesForIndex(after time.Time, afterID, limit int) ([]IndexEntry, error) {
+	var out []IndexEntry
+	if err := d.queries.GetEntriesForIndex.Select(&out, after, afterID, limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetReverseDefs returns up to limit definitions in a language (toLang) of
+// the headwords in a language (fromLang) after the given relation ID for
+// generating the reverse dictionary. Relations with the tag are skipped.
+func (d *Data) GetReverseDefs(fromLang, toLang, tag string, afterID, limit int) ([]ReverseDef, error) {
+	var out []ReverseDef
+	if err := d.queries.GetReverseDefs.Select(&out, fromLang, toLang, afterID, tag, limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ReindexEntries re-normalizes and re-tokenizes the content of up to limit
+// entries in a language after the given ID, for instance, after the language's
+// normalization config has changed. It returns the last reindexed ID and the
+// number of entries reindexed.
+func (d *Data) ReindexEntries(langID string, afterID, limit int) (int, int, error) {
+	lang, ok := d.Langs[langID]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown language %s", langID)
+	}
+
+	var entries []Entry
+	if err := d.queries.GetReindexEntries.Select(&entries, langID, afterID, limit); err != nil {
+		return 0, 0, err
+	}
+
+	for _, e := range entries {
+		normalized, tsVectorLang, tokens, err := lang.tokenize(e.Content)
+		if err != nil {
+			return afterID, 0, err
+		}
+
+		if _, err := d.queries.ReindexEntry.Exec(e.ID, normalized, tsVectorLang, tokens); err != nil {
+			return afterID, 0, err
+		}
+		afterID = e.ID
+	}
+
+	return afterID, len(entries), nil
+}
+
+// tokenize returns the normalized content of an entry in the language and
+// either the Postgres tokenizer to tokenize it with in the DB or its tokens
+// from the language's tokenizer.
+func (lang Lang) tokenize(content string) (string, string, string, error) {
+	normalized := lang.Normalized(content)
+	if lang.Tokenizer == nil {
+		return normalized, lang.TokenizerName, "", nil
+	}
+
+	if normalized != "" {
+		content = normalized
+	}
+	t, err := lang.Tokenizer.ToTokens(content, lang.ID)
+	if err != nil {
+		return normalized, "", "", err
+	}
+
+	return normalized, "", strings.Join(t, " "), nil
+}
+
+// GetReplaceEntries returns up to limit definition entries (entries that are
+// related to other entries) after the given ID that match the filter, and
+// that contain the given text if it's set, ordered by ID.
+func (d *Data) GetReplaceEntries(afterID, limit int, f ReplaceFilter, text string) ([]Entry, error) {
+	if f.Langs == nil {
+		f.Langs = []string{}
+	}
+	if f.Tags == nil {
+		f.Tags = []string{}
+	}
+
+	var out []Entry
+	if err := d.queries.GetReplaceEntries.Select(&out, afterID, limit,
+		pq.StringArray(f.Langs), pq.StringArray(f.Tags), text); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ReplaceEntryContent replaces the content of an entry with new content, and
+// re-normalizes and re-tokenizes it, if the entry's content is still the
+// given old content. It returns the entry's rows before and after the change
+// as JSON for the audit log, or sql.ErrNoRows if the entry has been changed
+// or deleted since.
+func (d *Data) ReplaceEntryContent(id int, langID, old, content string) (json.RawMessage, json.RawMessage, error) {
+	lang, ok := d.Langs[langID]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown language %s", langID)
+	}
+
+	content = lang.SanitizeContent(content)
+	normalized, tsVectorLang, tokens, err := lang.tokenize(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out struct {
+		Before []byte `db:"before"`
+		After  []byte `db:"after"`
+	}
+	if err := d.queries.ReplaceEntryContent.Get(&out, id, old, content, normalized, tsVectorLang, tokens); err != nil {
+		return nil, nil, err
+	}
+
+	return out.Before, out.After, nil
 }
 
 // GetPendingEntries fetches entries based on the given condition.
@@ -203,7 +892,12 @@ func (d *Data) GetPendingEntries(lang string, tags pq.StringArray, offset, limit
 func (d *Data) GetInitials(lang string) ([]string, error) {
 	out := make([]string, 0, 200)
 
-	rows, err := d.queries.GetInitials.Query(lang)
+	stmt := d.queries.GetInitials
+	if c, ok := d.collated[lang]; ok {
+		stmt = c.GetInitials
+	}
+
+	rows, err := stmt.Query(lang)
 	if err != nil {
 		return out, err
 	}
@@ -224,14 +918,25 @@ func (d *Data) GetInitials(lang string) ([]string, error) {
 		out = append(out, i)
 	}
 
+	// Sort in the alphabetical order of the language's locale, if it has one
+	// and no collation, instead of the DB's collation.
+	if l, ok := d.Langs[lang]; ok && l.Locale != "" && l.Collation == "" {
+		l.SortStrings(out)
+	}
+
 	return out, nil
 }
 
 // GetGlossaryWords gets words ordered by weight for a language
 // to build a glossary.
 func (d *Data) GetGlossaryWords(lang, initial string, offset, limit int) ([]GlossaryWord, int, error) {
+	stmt := d.queries.GetGlossaryWords
+	if c, ok := d.collated[lang]; ok {
+		stmt = c.GetGlossaryWords
+	}
+
 	var out []GlossaryWord
-	if err := d.queries.GetGlossaryWords.Select(&out, lang, initial, offset, limit); err != nil || len(out) == 0 {
+	if err := stmt.Select(&out, lang, initial, offset, limit); err != nil || len(out) == 0 {
 		if len(out) == 0 {
 			return nil, 0, nil
 		}
@@ -242,47 +947,242 @@ func (d *Data) GetGlossaryWords(lang, initial string, offset, limit int) ([]Glos
 	return out, out[0].Total, nil
 }
 
+// GetHeadwords returns the unique, lowercased headwords of a language.
+func (d *Data) GetHeadwords(lang string) ([]string, error) {
+	var out []string
+	if err := d.queries.GetHeadwords.Select(&out, lang); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetGlossaryWordsAfter returns the glossary words of a language, optionally
+// for an initial, after the given word. Words are ordered by ID, or if the
+// language has a collation, alphabetically.
+func (d *Data) GetGlossaryWordsAfter(lang, initial string, after GlossaryWord, limit int) ([]GlossaryWord, error) {
+	var out []GlossaryWord
+	if c, ok := d.collated[lang]; ok {
+		if err := c.GetGlossaryAfter.Select(&out, lang, initial, after.Content, after.ID, limit); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	if err := d.queries.GetGlossaryAfter.Select(&out, lang, initial, after.ID, limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetIndexWords returns the headwords of a language with their first definitions
+// in toLang (optional) as short glosses, after the given ID.
+func (d *Data) GetIndexWords(fromLang, toLang string, afterID, limit int) ([]IndexWord, error) {
+	var out []IndexWord
+	if err := d.queries.GetIndexWords.Select(&out, fromLang, toLang, afterID, limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetRecentEntries returns the latest headwords in fromLang (optional) with their
+// first definitions in toLang (optional).
+func (d *Data) GetRecentEntries(fromLang, toLang string, limit int) ([]FeedEntry, error) {
+	var out []FeedEntry
+	if err := d.queries.GetRecentEntries.Select(&out, fromLang, toLang, limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 // GetEntry returns an entry by its id.
 func (d *Data) GetEntry(id int) (Entry, error) {
 	var out Entry
 	if err := d.queries.GetEntry.Get(&out, id); err != nil {
 		return out, err
 	}
+	out.FrequencyBand = d.frequencyBand(out.FrequencyRank)
 
 	return out, nil
 }
 
-// GetParentEntries returns the parent entries of an entry by its id.
-func (d *Data) GetParentEntries(id int) ([]Entry, error) {
-	var out []Entry
-	if err := d.queries.GetParentRelations.Select(&out, id); err != nil {
-		return out, err
+// EntryExists checks whether an enabled entry with the GUID exists.
+func (d *Data) EntryExists(guid string) (bool, error) {
+	var out bool
+	if err := d.queries.EntryExists.Get(&out, guid); err != nil {
+		return false, err
 	}
 
 	return out, nil
 }
 
-// InsertEntry inserts a new non-unique (content+lang) dictionary entry and returns its id.
-func (d *Data) InsertEntry(e Entry) (int, error) {
-	id, err := d.insertEntry(e, d.queries.InsertEntry)
-	return id, err
-}
+// GetEntryByGUID returns an enabled entry by its GUID.
+func (d *Data) GetEntryByGUID(guid string) (Entry, error) {
+	var out Entry
+	if err := d.queries.GetEntryByGUID.Get(&out, guid); err != nil {
+		return out, err
+	}
+	out.FrequencyBand = d.frequencyBand(out.FrequencyRank)
 
-// InsertSubmissionEntry checks if a given content+lang exists and returns the existing ID.
-// If it doesn't exist, a new entry is inserted and its ID is returned. This is used for
-// accepting public submissions which are conntected to existing entries (if they exist).
-func (d *Data) InsertSubmissionEntry(e Entry) (int, error) {
-	id, err := d.insertEntry(e, d.queries.InsertSubmissionEntry)
-	return id, err
+	return out, nil
 }
 
-// UpdateEntry updates a dictionary entry.
-func (d *Data) UpdateEntry(id int, e Entry) error {
-	if e.Status == "" {
-		e.Status = StatusEnabled
+// GetEntryBySlug returns an entry by its language and slug.
+func (d *Data) GetEntryBySlug(lang, slug string) (Entry, error) {
+	var out Entry
+	if err := d.queries.GetEntryBySlug.Get(&out, lang, slug); err != nil {
+		return out, err
 	}
+	out.FrequencyBand = d.frequencyBand(out.FrequencyRank)
+
+	return out, nil
+}
+
+// RecordClicks records click-throughs (views) on entries by their GUIDs and
+// the number of clicks on each.
+func (d *Data) RecordClicks(clicks map[string]int) error {
+	var (
+		guids  = make([]string, 0, len(clicks))
+		counts = make([]int64, 0, len(clicks))
+	)
+	for g, n := range clicks {
+		guids = append(guids, g)
+		counts = append(counts, int64(n))
+	}
+
+	_, err := d.queries.RecordClicks.Exec(pq.StringArray(guids), pq.Int64Array(counts))
+	return err
+}
+
+// DeleteOldViews deletes the daily view counts of entries older than the given days.
+func (d *Data) DeleteOldViews(days int) error {
+	_, err := d.queries.DeleteOldViews.Exec(days)
+	return err
+}
 
-	_, err := d.queries.UpdateEntry.Exec(id,
+// GetPopularEntries returns up to limit enabled headwords, optionally in a
+// language, with the most views in the past given days, most viewed first.
+func (d *Data) GetPopularEntries(lang string, days, limit int) ([]Entry, error) {
+	out := []Entry{}
+	if err := d.queries.GetPopularEntries.Select(&out, lang, days, limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetSlugRedirect returns the current slug of the entry that an old slug in a language belonged to.
+func (d *Data) GetSlugRedirect(lang, slug string) (string, error) {
+	var out string
+	if err := d.queries.GetSlugRedirect.Get(&out, lang, slug); err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
+
+// GetParentEntries returns the parent entries of an entry by its id.
+func (d *Data) GetParentEntries(id int) ([]Entry, error) {
+	var out []Entry
+	if err := d.queries.GetParentRelations.Select(&out, id); err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
+
+// InsertEntry inserts a new non-unique (content+lang) dictionary entry and returns its id.
+func (d *Data) InsertEntry(e Entry) (int, error) {
+	id, err := d.insertEntry(e, d.queries.InsertEntry)
+	return id, err
+}
+
+// InsertEntryTree inserts a new entry with its definitions (Relations), their
+// relations (Relation), and their usage examples in the given transaction, and
+// returns the entry's id. Definitions with an ID are existing entries that are
+// only related to the new entry. The caller commits or rolls back the transaction.
+func (d *Data) InsertEntryTree(tx *sqlx.Tx, e Entry) (int, error) {
+	var (
+		stmtEntry   = tx.Stmtx(d.queries.InsertEntry)
+		stmtRel     = tx.Stmtx(d.queries.InsertRelation)
+		stmtExample = tx.Stmtx(d.queries.InsertExample)
+	)
+
+	fromID, err := d.insertEntry(e, stmtEntry)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, def := range e.Relations {
+		toID := def.ID
+		if toID == 0 {
+			if toID, err = d.insertEntry(def, stmtEntry); err != nil {
+				return 0, fmt.Errorf("definition %d: %v", i+1, err)
+			}
+		}
+
+		var r Relation
+		if def.Relation != nil {
+			r = *def.Relation
+		}
+		if r.Status == "" {
+			r.Status = e.Status
+		}
+		if r.Weight == 0 {
+			r.Weight = float64(i)
+		}
+
+		relID, err := d.insertRelation(fromID, toID, r, stmtRel)
+		if err != nil {
+			return 0, fmt.Errorf("relation %d: %v", i+1, err)
+		}
+
+		for j, x := range r.Examples {
+			tsVectorLang, tokens, err := d.exampleTokens(x)
+			if err != nil {
+				return 0, err
+			}
+
+			var out Example
+			if err := stmtExample.Get(&out, fromID, relID, x.Lang, x.Content, x.Translation,
+				tsVectorLang, tokens, float64(j)); err != nil {
+				return 0, fmt.Errorf("relation %d example %d: %v", i+1, j+1, err)
+			}
+		}
+	}
+
+	return fromID, nil
+}
+
+// InsertSubmissionEntry checks if a given content+lang exists and returns the existing ID.
+// If it doesn't exist, a new entry is inserted and its ID is returned. This is used for
+// accepting public submissions which are conntected to existing entries (if they exist).
+func (d *Data) InsertSubmissionEntry(e Entry) (int, error) {
+	id, err := d.insertEntry(e, d.queries.InsertSubmissionEntry)
+	return id, err
+}
+
+// UpdateEntry updates a dictionary entry. If the entry's UpdatedAt is set,
+// the entry is only updated if it hasn't been modified since. It returns
+// sql.ErrNoRows if the entry doesn't exist or has been modified.
+func (d *Data) UpdateEntry(id int, e Entry) error {
+	if e.Status == "" {
+		e.Status = StatusEnabled
+	}
+
+	// The normalized content can only be computed and the content sanitized
+	// if the language is known.
+	var normalized string
+	if lang, ok := d.Langs[e.Lang]; ok {
+		e.Content = lang.SanitizeContent(e.Content)
+		e.Notes = lang.SanitizeContent(e.Notes)
+		normalized = lang.Normalized(e.Content)
+	}
+
+	res, err := d.queries.UpdateEntry.Exec(id,
 		e.Content,
 		e.Initial,
 		e.Weight,
@@ -292,7 +1192,42 @@ func (d *Data) UpdateEntry(id int, e Entry) error {
 		e.Phones,
 		e.Notes,
 		e.Meta,
-		e.Status)
+		e.Status,
+		e.Slug,
+		e.UpdatedAt,
+		normalized,
+		e.Source,
+		e.License,
+		e.Attribution)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// LockEntry acquires or renews the edit lock on an entry for a user. If another
+// user holds an unexpired lock, that lock is returned instead.
+func (d *Data) LockEntry(id int, username string, dur time.Duration) (EntryLock, error) {
+	var out EntryLock
+	err := d.queries.LockEntry.Get(&out, id, username, int(dur.Seconds()))
+	return out, err
+}
+
+// GetEntryLock returns the unexpired edit lock on an entry. It returns
+// sql.ErrNoRows if the entry isn't locked.
+func (d *Data) GetEntryLock(id int) (EntryLock, error) {
+	var out EntryLock
+	err := d.queries.GetEntryLock.Get(&out, id)
+	return out, err
+}
+
+// UnlockEntry releases the edit lock held by a user on an entry.
+func (d *Data) UnlockEntry(id int, username string) error {
+	_, err := d.queries.UnlockEntry.Exec(id, username)
 	return err
 }
 
@@ -315,10 +1250,20 @@ func (d *Data) UpdateRelation(id int, r Relation) error {
 		r.Types,
 		r.Tags,
 		r.Notes,
-		r.Weight)
+		r.Weight,
+		r.Gender,
+		r.Register,
+		r.Domains)
 	return err
 }
 
+// GetRelationLang returns the language of the definition entry of a relation.
+func (d *Data) GetRelationLang(id int) (string, error) {
+	var out string
+	err := d.queries.GetRelationLang.Get(&out, id)
+	return out, err
+}
+
 // ReorderRelations updates the weights of the given relation IDs in the given order.
 func (d *Data) ReorderRelations(ids []int) error {
 	_, err := d.queries.ReorderRelations.Exec(pq.Array(ids))
@@ -326,17 +1271,59 @@ func (d *Data) ReorderRelations(ids []int) error {
 }
 
 // DeleteEntry deletes a dictionary entry by its id.
-func (d *Data) DeleteEntry(id int) error {
-	_, err := d.queries.DeleteEntry.Exec(id)
-	return err
+func (d *Data) DeleteEntry(id int, username string) error {
+	if _, err := d.queries.DeleteEntry.Exec(id, username); err != nil {
+		return err
+	}
+
+	if d.Backend != nil {
+		return d.Backend.Delete([]int{id})
+	}
+
+	return nil
 }
 
 // DeleteRelation deletes a dictionary entry by its id.
-func (s *Data) DeleteRelation(fromID, relID int) error {
-	_, err := s.queries.DeleteRelation.Exec(relID)
+func (s *Data) DeleteRelation(fromID, relID int, username string) error {
+	_, err := s.queries.DeleteRelation.Exec(relID, username)
 	return err
 }
 
+// GetTrash returns trashed entries and relations (without their data),
+// optionally filtered by type.
+func (d *Data) GetTrash(typ string, offset, limit int) ([]Trash, int, error) {
+	var out []Trash
+	if err := d.queries.GetTrash.Select(&out, typ, offset, limit); err != nil || len(out) == 0 {
+		return []Trash{}, 0, err
+	}
+
+	return out, out[0].Total, nil
+}
+
+// GetTrashItem returns a trashed entry or relation with its data.
+func (d *Data) GetTrashItem(id int) (Trash, error) {
+	var out Trash
+	err := d.queries.GetTrashItem.Get(&out, id)
+	return out, err
+}
+
+// RestoreTrash restores a trashed entry or relation and removes it from the trash.
+// It returns sql.ErrNoRows if the item isn't in the trash.
+func (d *Data) RestoreTrash(id int) (Trash, error) {
+	var out Trash
+	err := d.queries.RestoreTrash.Get(&out, id)
+	return out, err
+}
+
+// DeleteTrash permanently deletes a trashed item, all items if id is 0,
+// or if days > 0, the items that were deleted more than days ago. It
+// returns the media of the deleted items whose files can be deleted.
+func (d *Data) DeleteTrash(id, days int) ([]Media, error) {
+	var out []Media
+	err := d.queries.DeleteTrash.Select(&out, id, days)
+	return out, err
+}
+
 // InsertComments inserts a change suggestion from the public.
 func (d *Data) InsertComments(fromGUID, toGUID, comments string) error {
 	_, err := d.queries.InsertComments.Exec(fromGUID, toGUID, comments)
@@ -360,19 +1347,413 @@ func (d *Data) DeleteComments(id int) error {
 	return err
 }
 
+// GetEditorComments returns the internal editor comments on an entry.
+func (d *Data) GetEditorComments(guid string) ([]EditorComment, error) {
+	out := []EditorComment{}
+	if err := d.queries.GetEditorComments.Select(&out, guid); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// InsertEditorComment inserts an internal editor comment on an entry.
+func (d *Data) InsertEditorComment(guid, author, comments string) (EditorComment, error) {
+	var out EditorComment
+	err := d.queries.InsertEditorComment.Get(&out, guid, author, comments)
+	return out, err
+}
+
+// DeleteEditorComment deletes an internal editor comment on an entry. If the
+// comment doesn't exist on the entry, sql.ErrNoRows is returned.
+func (d *Data) DeleteEditorComment(id int, guid string) error {
+	res, err := d.queries.DeleteEditorComment.Exec(id, guid)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetEtymology returns the etymology of an entry with its links to other
+// entries, and their links, recursively up to the given depth.
+func (d *Data) GetEtymology(e Entry, depth int) (Etymology, error) {
+	out := Etymology{
+		GUID:      e.GUID,
+		Content:   e.Content,
+		Lang:      e.Lang,
+		Slug:      e.Slug,
+		Etymology: e.Etymology,
+		Links:     []EtymologyLink{},
+	}
+
+	var rows []etymologyRow
+	if err := d.queries.GetEtymology.Select(&rows, e.ID, depth); err != nil {
+		return out, err
+	}
+
+	links := make(map[int][]etymologyRow)
+	for _, r := range rows {
+		links[r.EntryID] = append(links[r.EntryID], r)
+	}
+	out.Links = etymologyLinks(e.ID, links, depth, map[int]bool{e.ID: true})
+
+	return out, nil
+}
+
+// UpdateEtymology updates the etymology of an entry and replaces its links.
+func (d *Data) UpdateEtymology(id int, etymology string, links []EtymologyRef) error {
+	if links == nil {
+		links = []EtymologyRef{}
+	}
+
+	b, err := json.Marshal(links)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.queries.UpdateEtymology.Exec(id, etymology, string(b))
+	return err
+}
+
+// ScheduleEntry sets the time at which a disabled or pending entry is
+// published. A null time unschedules it. It returns sql.ErrNoRows if the
+// entry doesn't exist or is already enabled.
+func (d *Data) ScheduleEntry(id int, at null.Time) error {
+	var out int
+	return d.queries.ScheduleEntry.Get(&out, id, at)
+}
+
+// GetScheduledEntries returns the entries scheduled for publishing, soonest
+// first, and the total number of them.
+func (d *Data) GetScheduledEntries(offset, limit int) ([]Entry, int, error) {
+	var out []Entry
+	if err := d.queries.GetScheduled.Select(&out, offset, limit); err != nil || len(out) == 0 {
+		return []Entry{}, 0, err
+	}
+
+	return out, out[0].Total, nil
+}
+
+// PublishScheduled publishes (enables) the scheduled entries that are due and
+// returns the languages of the published entries.
+func (d *Data) PublishScheduled() ([]string, error) {
+	var out []string
+	err := d.queries.PublishScheduled.Select(&out)
+	return out, err
+}
+
+// GetMedia returns the media of the given entries and of their relations.
+func (d *Data) GetMedia(entryIDs []int) ([]Media, error) {
+	out := []Media{}
+	if err := d.queries.GetMedia.Select(&out, pq.Array(entryIDs)); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// InsertMedia attaches a media item to an entry, or to one of its relations if
+// the relation ID is set. If the entry or the relation on it doesn't exist,
+// sql.ErrNoRows is returned.
+func (d *Data) InsertMedia(m Media) (Media, error) {
+	var out Media
+	err := d.queries.InsertMedia.Get(&out, m.EntryID, m.RelationID, m.Filename, m.ThumbFilename,
+		m.URL, m.ThumbURL, m.ContentType, m.Width, m.Height, m.Caption)
+	return out, err
+}
+
+// DeleteMedia deletes a media item of an entry and returns it. If it doesn't
+// exist on the entry, sql.ErrNoRows is returned.
+func (d *Data) DeleteMedia(id, entryID int) (Media, error) {
+	var out Media
+	err := d.queries.DeleteMedia.Get(&out, id, entryID)
+	return out, err
+}
+
+// GetEntriesWithoutAudio returns enabled headwords in a language after the
+// given ID that don't have pronunciation audio (audio/* media on the entry).
+func (d *Data) GetEntriesWithoutAudio(lang string, afterID, limit int) ([]Entry, error) {
+	var out []Entry
+	if err := d.queries.GetEntriesWithoutAudio.Select(&out, lang, afterID, limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetHeadwordsByTags returns up to limit enabled headwords in a language that
+// have any of the given tags, or all headwords if there are no tags, ordered
+// by weight.
+func (d *Data) GetHeadwordsByTags(lang string, tags []string, limit int) ([]Entry, error) {
+	var out []Entry
+	if err := d.queries.GetHeadwordsByTags.Select(&out, lang, pq.StringArray(tags), limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetQuizWords returns up to limit random enabled headwords in a language that
+// have a definition in another language, optionally with any of the given tags.
+func (d *Data) GetQuizWords(fromLang, toLang string, tags []string, limit int) ([]QuizWord, error) {
+	var out []QuizWord
+	if err := d.queries.GetQuizWords.Select(&out, fromLang, toLang, pq.StringArray(tags), limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetExamples returns the usage examples of the given relations.
+func (d *Data) GetExamples(relIDs []int) ([]Example, error) {
+	out := []Example{}
+	if err := d.queries.GetRelationExamples.Select(&out, pq.Array(relIDs)); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// InsertExample adds a usage example to a relation of an entry. If the relation
+// doesn't belong to the entry, sql.ErrNoRows is returned.
+func (d *Data) InsertExample(entryID, relID int, x Example) (Example, error) {
+	var out Example
+
+	tsVectorLang, tokens, err := d.exampleTokens(x)
+	if err != nil {
+		return out, err
+	}
+
+	err = d.queries.InsertExample.Get(&out, entryID, relID, x.Lang, x.Content, x.Translation,
+		tsVectorLang, tokens, x.Weight)
+	return out, err
+}
+
+// UpdateExample updates a usage example of a relation. If the example doesn't
+// belong to the relation, sql.ErrNoRows is returned.
+func (d *Data) UpdateExample(id, relID int, x Example) (Example, error) {
+	var out Example
+
+	tsVectorLang, tokens, err := d.exampleTokens(x)
+	if err != nil {
+		return out, err
+	}
+
+	err = d.queries.UpdateExample.Get(&out, id, relID, x.Lang, x.Content, x.Translation,
+		tsVectorLang, tokens, x.Weight)
+	return out, err
+}
+
+// DeleteExample deletes a usage example of a relation. If the example doesn't
+// belong to the relation, sql.ErrNoRows is returned.
+func (d *Data) DeleteExample(id, relID int) error {
+	res, err := d.queries.DeleteExample.Exec(id, relID)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// SearchExamples searches the usage examples in a language that contain the
+// query and returns them with their headwords and definitions, optionally
+// only of definitions in toLang, along with the total number of matches.
+func (d *Data) SearchExamples(lang, toLang, query string, offset, limit int) ([]Example, int, error) {
+	l, ok := d.Langs[lang]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown language %s", lang)
+	}
+
+	var (
+		tsVectorLang  string
+		tsVectorQuery string
+		pattern       string
+	)
+	switch {
+	case l.Tokenizer != nil:
+		q, err := l.Tokenizer.ToQuery(query, lang)
+		if err != nil {
+			return nil, 0, err
+		}
+		tsVectorQuery = q
+	case l.TokenizerName != "":
+		tsVectorLang = l.TokenizerName
+	default:
+		// No tokenizer. Match examples containing the query.
+		pattern = "%" + escapeLike(query) + "%"
+	}
+
+	out := []Example{}
+	if err := d.queries.SearchExamples.Select(&out, lang, toLang, tsVectorLang, query, tsVectorQuery,
+		pattern, offset, limit); err != nil || len(out) == 0 {
+		return out, 0, err
+	}
+
+	return out, out[0].Total, nil
+}
+
+// exampleTokens returns the Postgres tokenizer name to tokenize an example with
+// in the DB, or the tokens from the language's external tokenizer.
+func (d *Data) exampleTokens(x Example) (string, string, error) {
+	lang, ok := d.Langs[x.Lang]
+	if !ok {
+		return "", "", fmt.Errorf("unknown language %s", x.Lang)
+	}
+
+	if x.Tokens != "" {
+		return "", x.Tokens, nil
+	}
+	if lang.Tokenizer == nil {
+		return lang.TokenizerName, "", nil
+	}
+
+	t, err := lang.Tokenizer.ToTokens(x.Content, x.Lang)
+	if err != nil {
+		return "", "", err
+	}
+
+	return "", strings.Join(t, " "), nil
+}
+
+// GetUsers returns all admin users.
+func (d *Data) GetUsers() ([]User, error) {
+	out := []User{}
+	if err := d.queries.GetUsers.Select(&out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetUser returns an admin user by ID or username.
+func (d *Data) GetUser(id int, username string) (User, error) {
+	var out User
+	err := d.queries.GetUser.Get(&out, id, username)
+	return out, err
+}
+
+// InsertUser inserts a new admin user. The password should already be hashed.
+func (d *Data) InsertUser(u User) (int, error) {
+	var id int
+	err := d.queries.InsertUser.Get(&id, u.Username, u.Password, u.Name, u.Role, u.Status)
+	return id, err
+}
+
+// UpdateUser updates an admin user. An empty password retains the existing one.
+func (d *Data) UpdateUser(id int, u User) error {
+	_, err := d.queries.UpdateUser.Exec(id, u.Username, u.Password, u.Name, u.Role, u.Status)
+	return err
+}
+
+// DeleteUser deletes an admin user.
+func (d *Data) DeleteUser(id int) error {
+	_, err := d.queries.DeleteUser.Exec(id)
+	return err
+}
+
+// InsertAuditLog records a mutation in the audit log.
+func (d *Data) InsertAuditLog(a AuditLog) error {
+	_, err := d.queries.InsertAuditLog.Exec(a.Username, a.Method, a.Endpoint, a.Entity, a.EntityID,
+		string(a.Before), string(a.After), a.IP)
+	return err
+}
+
+// GetAuditLogs returns paginated audit log records, latest first, and the total count.
+func (d *Data) GetAuditLogs(q AuditQuery, offset, limit int) ([]AuditLog, int, error) {
+	var out []AuditLog
+	if err := d.queries.GetAuditLogs.Select(&out, q.Username, q.Entity, q.EntityID, q.Method,
+		q.From, q.To, offset, limit); err != nil || len(out) == 0 {
+		return []AuditLog{}, 0, err
+	}
+
+	return out, out[0].Total, nil
+}
+
+// GetAuditRow returns a relation, comment, editor_comment, example, or media row as JSON for
+// audit log snapshots.
+func (d *Data) GetAuditRow(entity string, id int) (json.RawMessage, error) {
+	var stmt *sqlx.Stmt
+	switch entity {
+	case "relation":
+		stmt = d.queries.GetAuditRelation
+	case "comment":
+		stmt = d.queries.GetAuditComment
+	case "editor_comment":
+		stmt = d.queries.GetAuditEditorComment
+	case "example":
+		stmt = d.queries.GetAuditExample
+	case "media":
+		stmt = d.queries.GetAuditMedia
+	case "trash":
+		stmt = d.queries.GetAuditTrash
+	default:
+		return nil, fmt.Errorf("unknown audit entity: %s", entity)
+	}
+
+	var out []byte
+	if err := stmt.Get(&out, id); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetDumpEntries returns entries with their relations after the given ID that
+// match the filter (see the get-dump-entries query), ordered by ID.
+func (d *Data) GetDumpEntries(afterID, limit int, f ExportFilter) ([]DumpEntry, error) {
+	if f.Tags == nil {
+		f.Tags = []string{}
+	}
+
+	var out []DumpEntry
+	if err := d.queries.GetDumpEntries.Select(&out, afterID, limit,
+		f.FromLang, f.ToLang, pq.StringArray(f.Tags), f.Status, f.UpdatedSince); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetChanges returns entry changes after the given (changedAt, kind, id) cursor position.
+func (d *Data) GetChanges(changedAt time.Time, kind int, id int64, limit int) ([]Change, error) {
+	var out []Change
+	if err := d.queries.GetChanges.Select(&out, changedAt, kind, id, limit); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 // DeleteAllPending deletes a change suggestion from the public.
 func (d *Data) DeleteAllPending() error {
 	_, err := d.queries.DeleteAllPending.Exec()
 	return err
 }
 
-// GetStats returns DB stats.
-func (d *Data) GetStats() (Stats, error) {
+// RefreshCounts refreshes the materialized entry and relation counts that
+// stats and glossaries are read from.
+func (d *Data) RefreshCounts() error {
+	_, err := d.queries.RefreshCounts.Exec()
+	return err
+}
+
+// GetStats returns DB stats. The time series and top lists cover the given
+// number of days including today.
+func (d *Data) GetStats(days int) (Stats, error) {
 	var (
 		out Stats
 		b   json.RawMessage
 	)
-	if err := d.queries.GetStats.Get(&b); err != nil {
+	if err := d.queries.GetStats.Get(&b, days); err != nil {
 		return out, err
 	}
 
@@ -383,10 +1764,77 @@ func (d *Data) GetStats() (Stats, error) {
 	if out.Languages == nil {
 		out.Languages = map[string]int{}
 	}
+	if out.LanguageStatuses == nil {
+		out.LanguageStatuses = map[string]map[string]int{}
+	}
+	if out.EntriesPerDay == nil {
+		out.EntriesPerDay = []StatsDay{}
+	}
+	if out.Contributors == nil {
+		out.Contributors = []StatsContributor{}
+	}
+	if out.ZeroResultSearches == nil {
+		out.ZeroResultSearches = []SearchMiss{}
+	}
 
 	return out, nil
 }
 
+// InsertSearchMiss records a search query that yielded no results.
+func (d *Data) InsertSearchMiss(fromLang, toLang, query string) error {
+	_, err := d.queries.InsertSearchMiss.Exec(fromLang, toLang, query)
+	return err
+}
+
+// GetMissingTranslations returns the headwords in a language that have no
+// definitions in another language, with any of the given tags, most frequent
+// first, and their total count.
+func (d *Data) GetMissingTranslations(fromLang, toLang string, tags []string, offset, limit int) ([]Entry, int, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+
+	var out []Entry
+	if err := d.queries.GetMissingTranslations.Select(&out, fromLang, toLang, pq.StringArray(tags),
+		offset, limit); err != nil || len(out) == 0 {
+		return []Entry{}, 0, err
+	}
+
+	for i := range out {
+		if out[i].Relations == nil {
+			out[i].Relations = []Entry{}
+		}
+	}
+
+	return out, out[0].Total, nil
+}
+
+// GetMissingRefs returns the definitions that refer to other headwords (see
+// MissingRef) which are disabled or have no definitions of their own, and
+// their total count. The headwords can be filtered by language and the
+// definitions by tags. Same language relations in the languages with same
+// language dictionaries (monolingual) are regular definitions and are left out.
+func (d *Data) GetMissingRefs(lang string, tags []string, offset, limit int) ([]MissingRef, int, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+
+	mono := []string{}
+	for _, dict := range d.Dicts {
+		if dict[0].ID == dict[1].ID {
+			mono = append(mono, dict[0].ID)
+		}
+	}
+
+	var out []MissingRef
+	if err := d.queries.GetMissingRefs.Select(&out, lang, pq.StringArray(tags), pq.StringArray(mono),
+		offset, limit); err != nil || len(out) == 0 {
+		return []MissingRef{}, 0, err
+	}
+
+	return out, out[0].Total, nil
+}
+
 // ApproveSubmission approves a pending submission (entry, relations, related entries).
 func (d *Data) ApproveSubmission(id int) error {
 	_, err := d.queries.ApproveSubmission.Exec(id)
@@ -405,10 +1853,15 @@ func (d *Data) insertEntry(e Entry, stmt *sqlx.Stmt) (int, error) {
 		return 0, fmt.Errorf("unknown language %s", e.Lang)
 	}
 
-	// No tokens. Automatically generate.
+	e.Content = lang.SanitizeContent(e.Content)
+	e.Notes = lang.SanitizeContent(e.Notes)
+
+	// No tokens. Automatically generate. If the language has normalization,
+	// the normalized content is tokenized.
 	var (
 		tsVectorLang = ""
 		tokens       = e.Tokens
+		normalized   = lang.Normalized(e.Content)
 	)
 	if len(e.Tokens) == 0 {
 		if lang.Tokenizer == nil {
@@ -417,7 +1870,11 @@ func (d *Data) insertEntry(e Entry, stmt *sqlx.Stmt) (int, error) {
 		} else {
 			// If there's an external tokenizer loaded, run it to get the tokens
 			// and pass it to the DB directly instructing the DB not to tokenize internally.
-			t, err := lang.Tokenizer.ToTokens(e.Content, e.Lang)
+			content := e.Content
+			if normalized != "" {
+				content = normalized
+			}
+			t, err := lang.Tokenizer.ToTokens(content, e.Lang)
 			if err != nil {
 				return 0, nil
 			}
@@ -430,7 +1887,8 @@ func (d *Data) insertEntry(e Entry, stmt *sqlx.Stmt) (int, error) {
 	}
 
 	var id int
-	err := stmt.Get(&id, e.Content, e.Initial, e.Weight, tokens, tsVectorLang, e.Lang, e.Tags, e.Phones, e.Notes, e.Meta, e.Status)
+	err := stmt.Get(&id, e.Content, e.Initial, e.Weight, tokens, tsVectorLang, e.Lang, e.Tags, e.Phones, e.Notes, e.Meta, e.Status, normalized,
+		e.Source, e.License, e.Attribution)
 	return id, err
 }
 
@@ -439,8 +1897,12 @@ func (d *Data) insertRelation(fromID, toID int, r Relation, stmt *sqlx.Stmt) (in
 		r.Status = StatusEnabled
 	}
 
+	if r.Domains == nil {
+		r.Domains = pq.StringArray{}
+	}
+
 	var id int
-	err := stmt.Get(&id, fromID, toID, r.Types, r.Tags, r.Notes, r.Weight, r.Status)
+	err := stmt.Get(&id, fromID, toID, r.Types, r.Tags, r.Notes, r.Weight, r.Status, r.Gender, r.Register, r.Domains)
 	return id, err
 }
 
@@ -485,15 +1947,173 @@ func (d *Data) SearchAndLoadRelations(e []Entry, q Query) error {
 			Status:    r.Status,
 			CreatedAt: r.RelationCreatedAt,
 			UpdatedAt: r.RelationUpdatedAt,
+			Gender:    r.RelationGender,
+			Register:  r.RelationRegister,
+			Domains:   r.RelationDomains,
 		}
 
 		idx := idMap[r.FromID]
 		e[idx].Relations = append(e[idx].Relations, r)
 	}
 
+	if err := d.loadExamples(e); err != nil {
+		return err
+	}
+
+	return d.loadMedia(e)
+}
+
+// loadMedia loads the media of the given entries and of their relations.
+func (d *Data) loadMedia(e []Entry) error {
+	ids := make([]int, 0, len(e))
+	for _, en := range e {
+		ids = append(ids, en.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	media, err := d.GetMedia(ids)
+	if err != nil {
+		return err
+	}
+
+	var (
+		entries = make(map[int]*Entry, len(e))
+		rels    = map[int]*Relation{}
+	)
+	for i := range e {
+		e[i].Media = nil
+		entries[e[i].ID] = &e[i]
+		for _, r := range e[i].Relations {
+			rels[r.Relation.ID] = r.Relation
+		}
+	}
+
+	for _, m := range media {
+		if m.RelationID == 0 {
+			if en, ok := entries[m.EntryID]; ok {
+				en.Media = append(en.Media, m)
+			}
+			continue
+		}
+
+		if r, ok := rels[m.RelationID]; ok {
+			r.Media = append(r.Media, m)
+		}
+	}
+
+	return nil
+}
+
+// loadExamples loads the usage examples of the relations of the given entries.
+func (d *Data) loadExamples(e []Entry) error {
+	var (
+		relIDs []int
+		rels   = map[int]*Relation{}
+	)
+	for i := range e {
+		for j := range e[i].Relations {
+			r := e[i].Relations[j].Relation
+			r.Examples = []Example{}
+			relIDs = append(relIDs, r.ID)
+			rels[r.ID] = r
+		}
+	}
+	if len(relIDs) == 0 {
+		return nil
+	}
+
+	ex, err := d.GetExamples(relIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range ex {
+		if r, ok := rels[x.RelationID]; ok {
+			r.Examples = append(r.Examples, x)
+		}
+	}
+
+	return nil
+}
+
+// LoadRelationTree loads the relations of the relations of entries (that
+// already have their relations loaded) recursively up to the given depth.
+func (d *Data) LoadRelationTree(e []Entry, q Query, depth int) error {
+	if depth < 2 {
+		return nil
+	}
+
+	// The same entry can be a relation of multiple entries. Load the
+	// relations of every unique entry once.
+	var (
+		uniq  []Entry
+		index = map[int]int{}
+	)
+	for _, p := range e {
+		for _, r := range p.Relations {
+			if _, ok := index[r.ID]; !ok {
+				index[r.ID] = len(uniq)
+				uniq = append(uniq, r)
+			}
+		}
+	}
+	if len(uniq) == 0 {
+		return nil
+	}
+
+	if err := d.SearchAndLoadRelations(uniq, q); err != nil {
+		return err
+	}
+	if err := d.LoadRelationTree(uniq, q, depth-1); err != nil {
+		return err
+	}
+
+	for i := range e {
+		for j, r := range e[i].Relations {
+			e[i].Relations[j].Relations = uniq[index[r.ID]].Relations
+		}
+	}
+
 	return nil
 }
 
+// etymologyLinks builds the tree of links of an entry from the flat list of
+// links of all the entries in the tree. seen has the entries in the current
+// chain so that cycles are not followed.
+func etymologyLinks(id int, links map[int][]etymologyRow, depth int, seen map[int]bool) []EtymologyLink {
+	out := []EtymologyLink{}
+	if depth < 1 {
+		return out
+	}
+
+	for _, r := range links[id] {
+		l := EtymologyLink{
+			Type:  r.Type,
+			Notes: r.Notes,
+			Entry: Etymology{
+				GUID:      r.GUID,
+				Content:   r.Content,
+				Lang:      r.Lang,
+				Slug:      r.Slug,
+				Etymology: r.Etymology,
+				Links:     []EtymologyLink{},
+			},
+		}
+
+		if !seen[r.TargetID] {
+			seen[r.TargetID] = true
+			l.Entry.Links = etymologyLinks(r.TargetID, links, depth-1, seen)
+			delete(seen, r.TargetID)
+		}
+
+		out = append(out, l)
+	}
+
+	return out
+}
+
 // TokensToTSVector takes a list of tokens, de-duplicates them, and returns a
 // Postgres tsvector string.
 func TokensToTSVector(tokens []Token) []string {
@@ -510,3 +2130,117 @@ func TokensToTSVector(tokens []Token) []string {
 
 	return out
 }
+
+// escapeLike escapes the LIKE wildcard characters in a string.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// InsertJob queues a background job.
+func (d *Data) InsertJob(typ string, params json.RawMessage, createdBy string) (Job, error) {
+	var out Job
+	err := d.queries.InsertJob.Get(&out, typ, string(params), createdBy)
+	return out, err
+}
+
+// GetJob returns a background job with its log.
+func (d *Data) GetJob(id int) (Job, error) {
+	var out Job
+	err := d.queries.GetJob.Get(&out, id)
+	return out, err
+}
+
+// GetJobs returns background jobs (without logs), optionally filtered by status.
+func (d *Data) GetJobs(status string, offset, limit int) ([]Job, int, error) {
+	var out []Job
+	if err := d.queries.GetJobs.Select(&out, status, offset, limit); err != nil || len(out) == 0 {
+		return []Job{}, 0, err
+	}
+
+	return out, out[0].Total, nil
+}
+
+// NextJob picks the oldest queued job and marks it as running. It returns
+// sql.ErrNoRows if there are no queued jobs.
+func (d *Data) NextJob() (Job, error) {
+	var out Job
+	err := d.queries.NextJob.Get(&out)
+	return out, err
+}
+
+// AppendJobLog appends a message to the log of a job.
+func (d *Data) AppendJobLog(id int, msg string) error {
+	_, err := d.queries.AppendJobLog.Exec(id, msg)
+	return err
+}
+
+// FinishJob records the final status and result of a job. Cancelled jobs
+// retain their status.
+func (d *Data) FinishJob(id int, status, result string) error {
+	_, err := d.queries.FinishJob.Exec(id, status, result)
+	return err
+}
+
+// CancelJob cancels a queued or running job. It returns sql.ErrNoRows if
+// the job doesn't exist or has already finished.
+func (d *Data) CancelJob(id int) error {
+	var out int
+	return d.queries.CancelJob.Get(&out, id)
+}
+
+// GetSetting returns the JSON value of a setting. It returns sql.ErrNoRows
+// if the setting doesn't exist.
+func (d *Data) GetSetting(key string) (json.RawMessage, error) {
+	var out []byte
+	if err := d.queries.GetSetting.Get(&out, key); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// UpsertSetting creates or updates a setting with a JSON value.
+func (d *Data) UpsertSetting(key string, value json.RawMessage) error {
+	_, err := d.queries.UpsertSetting.Exec(key, string(value))
+	return err
+}
+
+// GetLangs returns the languages managed from the admin.
+func (d *Data) GetLangs() ([]LangConfig, error) {
+	out := []LangConfig{}
+	if err := d.queries.GetLangs.Select(&out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// UpsertLang creates or updates a language managed from the admin.
+func (d *Data) UpsertLang(l LangConfig) (LangConfig, error) {
+	var out LangConfig
+	err := d.queries.UpsertLang.Get(&out, l.ID, string(l.Config), l.Dicts)
+	return out, err
+}
+
+// DeleteLang deletes a language managed from the admin. Languages that have
+// entries can only be deleted if they're also defined in the config file
+// (inConfig). It returns sql.ErrNoRows if nothing was deleted.
+func (d *Data) DeleteLang(id string, inConfig bool) error {
+	res, err := d.queries.DeleteLang.Exec(id, inConfig)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetTSConfigs returns the names of the given Postgres text search
+// configurations that exist in the DB.
+func (d *Data) GetTSConfigs(names []string) ([]string, error) {
+	var out []string
+	err := d.queries.GetTSConfigs.Select(&out, pq.Array(names))
+	return out, err
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/knadh/goyesql"
+	goyesqlx "github.com/knadh/goyesql/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// BenchmarkSearch runs searches in parallel against a test database with
+// dictpress installed and data imported, with an unlimited connection pool
+// and with the default max_open of 25 connections. It's skipped unless
+// DICTPRESS_TEST_DB is set to the database's connection string, eg:
+//
+//	DICTPRESS_TEST_DB="host=localhost user=dictpress password=dictpress dbname=dictpress sslmode=disable" \
+//	DICTPRESS_TEST_LANG=english DICTPRESS_TEST_QUERY=apple go test -bench Search ./internal/data
+func BenchmarkSearch(b *testing.B) {
+	dsn := os.Getenv("DICTPRESS_TEST_DB")
+	if dsn == "" {
+		b.Skip("DICTPRESS_TEST_DB is not set")
+	}
+
+	lang := envOr("DICTPRESS_TEST_LANG", "english")
+	q := Query{
+		Query:    envOr("DICTPRESS_TEST_QUERY", "apple"),
+		FromLang: lang,
+		Match:    MatchFTS,
+		Status:   StatusEnabled,
+		Limit:    10,
+	}
+
+	for _, maxOpen := range []int{0, 25} {
+		b.Run(fmt.Sprintf("max_open=%d", maxOpen), func(b *testing.B) {
+			db, err := sqlx.Connect("postgres", dsn)
+			if err != nil {
+				b.Fatalf("error connecting to DB: %v", err)
+			}
+			defer db.Close()
+
+			db.SetMaxOpenConns(maxOpen)
+			db.SetMaxIdleConns(25)
+
+			d := New(loadTestQueries(b, db), LangMap{
+				lang: {ID: lang, TokenizerName: lang, TokenizerType: "postgres", Match: MatchFTS},
+			}, nil, nil)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, _, err := d.Search(q); err != nil {
+						b.Errorf("error searching: %v", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// loadTestQueries prepares the queries in queries.sql on the DB.
+func loadTestQueries(b *testing.B, db *sqlx.DB) *Queries {
+	qMap, err := goyesql.ParseFile("../../queries.sql")
+	if err != nil {
+		b.Fatalf("error loading SQL queries: %v", err)
+	}
+
+	var q Queries
+	if err := goyesqlx.ScanToStruct(&q, qMap, db.Unsafe()); err != nil {
+		b.Fatalf("error preparing SQL queries: %v", err)
+	}
+
+	return &q
+}
+
+// envOr returns the value of an environment variable or a default value.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return def
+}
@@ -0,0 +1,200 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Language detection methods.
+const (
+	// DetectScript means only one of the candidate languages is written in
+	// the query's script.
+	DetectScript = "script"
+
+	// DetectNGram means the candidate languages that share the query's script
+	// were told apart with their n-gram models.
+	DetectNGram = "ngram"
+
+	// DetectDefault means the language couldn't be told apart and the first
+	// candidate (in the order of the configured dictionaries) was picked.
+	DetectDefault = "default"
+)
+
+// LangDetection is the result of detecting the language of a search query.
+type LangDetection struct {
+	Lang       string   `json:"lang"`
+	Script     string   `json:"script,omitempty"`
+	Method     string   `json:"method"`
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+// NGrams is a character trigram frequency model of a language that's used
+// to tell apart languages that are written in the same script.
+type NGrams struct {
+	counts map[string]int
+	total  int
+}
+
+// NewNGrams builds an n-gram model from sample words or text in a language.
+func NewNGrams(words []string) *NGrams {
+	n := &NGrams{counts: make(map[string]int)}
+	for _, w := range words {
+		for _, t := range trigrams(w) {
+			n.counts[t]++
+			n.total++
+		}
+	}
+
+	return n
+}
+
+// score returns the log probability of the words in a string in the model
+// with add-one smoothing.
+func (n *NGrams) score(s string) float64 {
+	var (
+		out   float64
+		denom = float64(n.total + len(n.counts) + 1)
+	)
+	for _, w := range strings.Fields(s) {
+		for _, t := range trigrams(w) {
+			out += math.Log(float64(n.counts[t]+1) / denom)
+		}
+	}
+
+	return out
+}
+
+// trigrams returns the character trigrams of a word padded with spaces.
+func trigrams(w string) []string {
+	r := []rune(" " + strings.ToLower(strings.TrimSpace(w)) + " ")
+	if len(r) < 3 {
+		return nil
+	}
+
+	out := make([]string, 0, len(r)-2)
+	for i := 0; i < len(r)-2; i++ {
+		out = append(out, string(r[i:i+3]))
+	}
+
+	return out
+}
+
+// DetectLang detects the language of a query among the given languages, or
+// all languages if none are given. Candidates are narrowed down by the
+// dominant Unicode script of the query to the languages written in it
+// (the `scripts` language config), and then by their n-gram models, if any.
+func (d *Data) DetectLang(q string, langs []string) (LangDetection, error) {
+	if len(langs) == 0 {
+		langs = d.langOrder()
+	}
+	if len(langs) == 0 {
+		return LangDetection{}, errors.New("no languages to detect")
+	}
+
+	// Count the letters of the query in each of the candidates' scripts.
+	counts := map[string]int{}
+	for _, r := range q {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, id := range langs {
+			for _, s := range d.Langs[id].Scripts {
+				if unicode.Is(unicode.Scripts[s], r) {
+					counts[s]++
+				}
+			}
+		}
+	}
+
+	// Dominant script, by the highest count and then the name.
+	script := ""
+	for s, n := range counts {
+		if n > counts[script] || (n == counts[script] && s < script) {
+			script = s
+		}
+	}
+
+	// Languages written in the script, or if there are none, the ones that
+	// don't have scripts configured.
+	cand := langs
+	if script != "" {
+		cand = d.filterLangs(langs, func(l Lang) bool {
+			for _, s := range l.Scripts {
+				if s == script {
+					return true
+				}
+			}
+			return false
+		})
+	} else if c := d.filterLangs(langs, func(l Lang) bool { return len(l.Scripts) == 0 }); len(c) > 0 {
+		cand = c
+	}
+
+	out := LangDetection{Lang: cand[0], Script: script, Method: DetectDefault, Candidates: cand}
+	if len(cand) == 1 {
+		if script != "" {
+			out.Method = DetectScript
+		}
+		out.Candidates = nil
+		return out, nil
+	}
+
+	// Pick the best scoring n-gram model among the candidates.
+	best := math.Inf(-1)
+	for _, id := range cand {
+		m := d.Langs[id].NGrams
+		if m == nil {
+			continue
+		}
+
+		if s := m.score(q); s > best {
+			best = s
+			out.Lang = id
+			out.Method = DetectNGram
+		}
+	}
+
+	return out, nil
+}
+
+// langOrder returns the IDs of all languages in the order of their first
+// appearance in the dictionaries followed by the rest in alphabetical order.
+func (d *Data) langOrder() []string {
+	var (
+		out  = make([]string, 0, len(d.Langs))
+		seen = make(map[string]bool, len(d.Langs))
+	)
+	for _, dc := range d.Dicts {
+		for _, l := range dc {
+			if !seen[l.ID] {
+				seen[l.ID] = true
+				out = append(out, l.ID)
+			}
+		}
+	}
+
+	var rest []string
+	for id := range d.Langs {
+		if !seen[id] {
+			rest = append(rest, id)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(out, rest...)
+}
+
+// filterLangs returns the language IDs whose languages match the given function.
+func (d *Data) filterLangs(ids []string, fn func(Lang) bool) []string {
+	var out []string
+	for _, id := range ids {
+		if l, ok := d.Langs[id]; ok && fn(l) {
+			out = append(out, id)
+		}
+	}
+
+	return out
+}
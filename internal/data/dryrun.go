@@ -0,0 +1,51 @@
+package data
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// PreviewDeleteEntry returns the rows that would be deleted with an entry.
+func (d *Data) PreviewDeleteEntry(id int) (DryRun, error) {
+	return d.preview(d.queries.PreviewDeleteEntry, id)
+}
+
+// PreviewDeleteRelation returns the rows that would be deleted with a relation.
+func (d *Data) PreviewDeleteRelation(id int) (DryRun, error) {
+	return d.preview(d.queries.PreviewDeleteRelation, id)
+}
+
+// PreviewDeleteAllPending returns the rows that would be deleted with all
+// pending entries and relations, with up to maxGUIDs of the entries' GUIDs.
+func (d *Data) PreviewDeleteAllPending(maxGUIDs int) (DryRun, error) {
+	return d.preview(d.queries.PreviewDeleteAllPending, maxGUIDs)
+}
+
+// PreviewDeleteTrash returns the trashed items that would be permanently
+// deleted (see DeleteTrash), with up to maxGUIDs of the entries' GUIDs.
+func (d *Data) PreviewDeleteTrash(id, days, maxGUIDs int) (DryRun, error) {
+	return d.preview(d.queries.PreviewDeleteTrash, id, days, maxGUIDs)
+}
+
+// PreviewUpsertRedirects returns the number of redirects that would be
+// inserted and the existing ones that would be replaced (see UpsertRedirects).
+func (d *Data) PreviewUpsertRedirects(rs []Redirect) (DryRun, error) {
+	sources := make([]string, len(rs))
+	for i, r := range rs {
+		sources[i] = r.Source
+	}
+
+	return d.preview(d.queries.PreviewUpsertRedirects, pq.StringArray(sources))
+}
+
+func (d *Data) preview(stmt *sqlx.Stmt, args ...interface{}) (DryRun, error) {
+	out := DryRun{DryRun: true}
+	if err := stmt.Get(&out, args...); err != nil {
+		return out, err
+	}
+	if out.GUIDs == nil {
+		out.GUIDs = pq.StringArray{}
+	}
+
+	return out, nil
+}
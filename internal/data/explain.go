@@ -0,0 +1,153 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// SearchExplain is the query plan of a search query (EXPLAIN ANALYZE) along with
+// how the query was processed, for debugging slow or unexpected matches.
+type SearchExplain struct {
+	// Query after normalization and the match mode.
+	Query string `json:"query"`
+	Match string `json:"match"`
+
+	// Name of the language's tokenizer, whether it's an external (Go)
+	// tokenizer, and the fulltext tsquery of the fts match mode.
+	Tokenizer         string `json:"tokenizer"`
+	ExternalTokenizer bool   `json:"external_tokenizer"`
+	TSQuery           string `json:"tsquery"`
+
+	// SQL search query and its params ($1, $2 ...).
+	SQL    string        `json:"sql"`
+	Params []interface{} `json:"params"`
+
+	// Postgres query plan (EXPLAIN ANALYZE, FORMAT JSON).
+	Plan json.RawMessage `json:"plan"`
+}
+
+// explainer runs search queries with EXPLAIN.
+type explainer struct {
+	db  *sqlx.DB
+	sql string
+}
+
+// PrepareExplain loads the raw search query (name => raw SQL) to explain.
+func (d *Data) PrepareExplain(db *sqlx.DB, queries map[string]string) error {
+	q, ok := queries["search"]
+	if !ok {
+		return errors.New("query 'search' not found")
+	}
+
+	d.explain = &explainer{db: db, sql: q}
+	return nil
+}
+
+// ExplainSearch runs a search query with EXPLAIN ANALYZE and returns its plan.
+// Only the SQL search is explained and not semantic search or external backends.
+func (d *Data) ExplainSearch(q Query) (SearchExplain, error) {
+	var out SearchExplain
+	if d.explain == nil {
+		return out, errors.New("explain is not loaded")
+	}
+	if q.Mode == ModeSemantic || d.Backend != nil {
+		return out, errors.New("only the SQL search can be explained")
+	}
+
+	args, err := d.searchParams(q)
+	if err != nil {
+		return out, err
+	}
+
+	lang := d.Langs[q.FromLang]
+	out = SearchExplain{
+		Query:             args[0].(string),
+		Match:             args[13].(string),
+		Tokenizer:         lang.TokenizerName,
+		ExternalTokenizer: lang.Tokenizer != nil,
+		SQL:               d.explain.sql,
+		Params:            args,
+	}
+
+	// The tsquery that the search query prepares from $1, $2, $3, and $13.
+	if out.Match == MatchFTS {
+		if err := d.queries.SearchTSQuery.Get(&out.TSQuery, args[0], args[1], args[2], args[12]); err != nil {
+			return out, fmt.Errorf("error getting tsquery: %v", err)
+		}
+	}
+
+	// EXPLAIN ANALYZE executes the query. Search is read-only.
+	var plan []byte
+	if err := d.explain.db.Get(&plan, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+d.explain.sql, args...); err != nil {
+		return out, fmt.Errorf("error explaining query: %v", err)
+	}
+	out.Plan = plan
+
+	return out, nil
+}
+
+// Tokenization is how a language's tokenizer tokenizes a string into the
+// tokens of entries (tsvector) and into a search query (tsquery).
+type Tokenization struct {
+	Lang              string `json:"lang"`
+	Tokenizer         string `json:"tokenizer"`
+	ExternalTokenizer bool   `json:"external_tokenizer"`
+
+	// The string after normalization, if the language has it.
+	Normalized string `json:"normalized"`
+
+	TSVector string         `json:"tsvector" db:"tsvector"`
+	Tokens   pq.StringArray `json:"tokens" db:"tokens"`
+	TSQuery  string         `json:"tsquery"`
+}
+
+// Tokenize tokenizes a string with a language's tokenizer the same way entries
+// and search queries are tokenized, without inserting anything.
+func (d *Data) Tokenize(s, langID string) (Tokenization, error) {
+	lang, ok := d.Langs[langID]
+	if !ok {
+		return Tokenization{}, fmt.Errorf("unknown language %s", langID)
+	}
+
+	var (
+		normalized   = lang.Normalized(s)
+		content      = s
+		tsVectorLang = lang.TokenizerName
+		tokens       string
+	)
+	if normalized != "" {
+		content = normalized
+	}
+	if lang.Tokenizer != nil {
+		t, err := lang.Tokenizer.ToTokens(content, langID)
+		if err != nil {
+			return Tokenization{}, err
+		}
+		tsVectorLang, tokens = "", strings.Join(t, " ")
+	}
+
+	var out Tokenization
+	if err := d.queries.Tokenize.Get(&out, tsVectorLang, tokens, content); err != nil {
+		return Tokenization{}, err
+	}
+	out.Lang = langID
+	out.Tokenizer = lang.TokenizerName
+	out.ExternalTokenizer = lang.Tokenizer != nil
+	out.Normalized = normalized
+
+	// The tsquery of the string as a fulltext search query.
+	args, err := d.searchParams(Query{Query: s, FromLang: langID, Match: MatchFTS})
+	if err != nil {
+		return out, err
+	}
+	if err := d.queries.SearchTSQuery.Get(&out.TSQuery, args[0], args[1], args[2], args[12]); err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Custom field types.
+const (
+	FieldString = "string"
+	FieldInt    = "int"
+	FieldFloat  = "float"
+	FieldBool   = "bool"
+	FieldEnum   = "enum"
+)
+
+var reFieldID = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Field is a custom, typed metadata field of the entries in a language (eg:
+// frequency_rank, dialect). Values are stored in the entry's meta by the
+// field's ID.
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// Allowed values of enum fields.
+	Options []string `json:"options"`
+
+	// Whether entries can be filtered by the field in search (?$id=value).
+	Filter bool `json:"filter"`
+}
+
+// Fields represents the custom fields of a language indexed by their IDs.
+type Fields map[string]Field
+
+// Validate checks the field definitions.
+func (fs Fields) Validate() error {
+	for id, f := range fs {
+		if !reFieldID.MatchString(id) {
+			return fmt.Errorf("invalid field '%s'. Should be lowercase letters, numbers, and _", id)
+		}
+
+		switch f.Type {
+		case FieldString, FieldInt, FieldFloat, FieldBool:
+		case FieldEnum:
+			if len(f.Options) == 0 {
+				return fmt.Errorf("enum field '%s' has no options", id)
+			}
+		default:
+			return fmt.Errorf("unknown type '%s' for field '%s'. Should be string|int|float|bool|enum", f.Type, id)
+		}
+	}
+
+	return nil
+}
+
+// ValidateMeta checks the values of the custom fields in an entry's meta. Keys
+// in the meta that aren't fields are left as is.
+func (fs Fields) ValidateMeta(meta JSON) error {
+	for id, f := range fs {
+		v, ok := meta[id]
+		if !ok || v == nil {
+			continue
+		}
+
+		if !f.valid(v) {
+			return fmt.Errorf("invalid value for `%s`. Should be %s", id, f.Type)
+		}
+	}
+
+	return nil
+}
+
+// InvalidMeta returns the sorted IDs of the custom fields in an entry's meta
+// whose values aren't of the fields' types.
+func (fs Fields) InvalidMeta(meta JSON) []string {
+	var out []string
+	for id, f := range fs {
+		if v, ok := meta[id]; ok && v != nil && !f.valid(v) {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Parse parses a string value (eg: from a query param) into the field's type.
+func (f Field) Parse(s string) (interface{}, error) {
+	var (
+		v   interface{} = s
+		err error
+	)
+	switch f.Type {
+	case FieldInt:
+		var n int64
+		n, err = strconv.ParseInt(s, 10, 64)
+		v = float64(n)
+	case FieldFloat:
+		v, err = strconv.ParseFloat(s, 64)
+	case FieldBool:
+		v, err = strconv.ParseBool(s)
+	}
+	if err != nil || !f.valid(v) {
+		return nil, fmt.Errorf("invalid %s value '%s'", f.Type, s)
+	}
+
+	return v, nil
+}
+
+// valid checks whether a value decoded from JSON is of the field's type.
+func (f Field) valid(v interface{}) bool {
+	switch f.Type {
+	case FieldString:
+		_, ok := v.(string)
+		return ok
+	case FieldInt:
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case FieldFloat:
+		_, ok := v.(float64)
+		return ok
+	case FieldBool:
+		_, ok := v.(bool)
+		return ok
+	case FieldEnum:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		for _, o := range f.Options {
+			if o == s {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// SortFrequency is the search sort order by the word frequency ranks of the
+// matches, most frequent first, with the headwords that have no rank last.
+const SortFrequency = "frequency"
+
+// FrequencyBand is a named band of the word frequency ranks of headwords,
+// eg: "common" for the 2000 most frequent words of a language.
+type FrequencyBand struct {
+	Name string `json:"name"`
+
+	// Highest rank in the band. 0 is all the ranks beyond the other bands.
+	MaxRank int `json:"max_rank"`
+}
+
+// SetFrequencyBands validates and sets the bands that the frequency ranks of
+// headwords are grouped into in responses.
+func (d *Data) SetFrequencyBands(bands []FrequencyBand) error {
+	seen := make(map[string]bool, len(bands))
+	for _, b := range bands {
+		if b.Name == "" {
+			return fmt.Errorf("frequency band with no name")
+		}
+		if b.MaxRank < 0 {
+			return fmt.Errorf("invalid max_rank %d of frequency band '%s'", b.MaxRank, b.Name)
+		}
+		if seen[b.Name] {
+			return fmt.Errorf("duplicate frequency band '%s'", b.Name)
+		}
+		seen[b.Name] = true
+	}
+
+	// Order by rank with the open ended band last.
+	sort.SliceStable(bands, func(i, j int) bool {
+		a, b := bands[i].MaxRank, bands[j].MaxRank
+		return b == 0 && a != 0 || a != 0 && a < b
+	})
+
+	d.frequencyBands = bands
+	return nil
+}
+
+// frequencyBand returns the name of the band of a frequency rank. It's empty
+// if there's no rank (the headword isn't in the frequency list) or the rank
+// is beyond all the bands.
+func (d *Data) frequencyBand(rank null.Int) string {
+	if !rank.Valid {
+		return ""
+	}
+
+	for _, b := range d.frequencyBands {
+		if b.MaxRank == 0 || rank.Int <= b.MaxRank {
+			return b.Name
+		}
+	}
+
+	return ""
+}
+
+// LoadFrequencyBands sets the frequency bands of entries from their ranks.
+func (d *Data) LoadFrequencyBands(entries []Entry) {
+	if len(d.frequencyBands) == 0 {
+		return
+	}
+
+	for i := range entries {
+		entries[i].FrequencyBand = d.frequencyBand(entries[i].FrequencyRank)
+	}
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Tags that highlighted words are wrapped in.
+const (
+	HighlightPre  = "<mark>"
+	HighlightPost = "</mark>"
+)
+
+// HighlightWords returns the lowercased words of a search query that are
+// highlighted in results, without the language's stopwords.
+func (l Lang) HighlightWords(q string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(q), isNotWordChar) {
+		if !l.Stopwords[w] {
+			out = append(out, w)
+		}
+	}
+
+	return out
+}
+
+// Highlight returns HTML escaped text with the words in it that begin with any
+// of the given (lowercased) words wrapped in <mark>. If maxWords is > 0, only a
+// snippet of up to maxWords words around the first highlighted word is returned
+// with … marking the omitted text. The bool is true if any word was highlighted.
+func Highlight(s string, words []string, maxWords int) (string, bool) {
+	type span struct {
+		start, end int
+		hl         bool
+	}
+
+	// Find the words in the text and whether they match.
+	var (
+		spans []span
+		first = -1
+		start = -1
+	)
+	for i, r := range s + " " {
+		if !isNotWordChar(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start < 0 {
+			continue
+		}
+
+		sp := span{start: start, end: i, hl: matchesWord(strings.ToLower(s[start:i]), words)}
+		if sp.hl && first < 0 {
+			first = len(spans)
+		}
+		spans = append(spans, sp)
+		start = -1
+	}
+
+	// Snippet of maxWords around the first match.
+	from, to := 0, len(spans)
+	if maxWords > 0 && len(spans) > maxWords {
+		if first > 0 {
+			from = first - maxWords/2
+		}
+		if from < 0 {
+			from = 0
+		}
+		to = from + maxWords
+		if to > len(spans) {
+			to = len(spans)
+			from = to - maxWords
+		}
+	}
+
+	var (
+		b   strings.Builder
+		pos = 0
+		end = len(s)
+	)
+	if from > 0 {
+		pos = spans[from].start
+		b.WriteString("…")
+	}
+	if to < len(spans) {
+		end = spans[to-1].end
+	}
+
+	for _, sp := range spans[from:to] {
+		b.WriteString(html.EscapeString(s[pos:sp.start]))
+		if sp.hl {
+			b.WriteString(HighlightPre)
+			b.WriteString(html.EscapeString(s[sp.start:sp.end]))
+			b.WriteString(HighlightPost)
+		} else {
+			b.WriteString(html.EscapeString(s[sp.start:sp.end]))
+		}
+		pos = sp.end
+	}
+	b.WriteString(html.EscapeString(s[pos:end]))
+	if end < len(s) {
+		b.WriteString("…")
+	}
+
+	return b.String(), first >= 0
+}
+
+// matchesWord checks whether a (lowercased) word in the text begins with any of
+// the query words, so that eg: "apple" highlights "apples".
+func matchesWord(w string, words []string) bool {
+	for _, q := range words {
+		if strings.HasPrefix(w, q) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isNotWordChar(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.Is(unicode.Mn, r) && !unicode.Is(unicode.Mc, r)
+}
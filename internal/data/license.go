@@ -0,0 +1,30 @@
+package data
+
+// License represents the licensing and attribution metadata of a dictionary,
+// eg: of dictionaries built from CC licensed sources, which have to credit
+// their sources wherever their content is shown.
+type License struct {
+	// Name of the license, eg: CC BY-SA 4.0, and the URL of its text.
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+
+	// Name or URL of the source that the dictionary is built from.
+	Source string `json:"source,omitempty"`
+
+	// Attribution text to show with the content, eg: © Wiktionary contributors.
+	Attribution string `json:"attribution,omitempty"`
+}
+
+// Licenses represents the licenses of dictionary pairs indexed by
+// "fromLang/toLang". The empty key "" holds the default license.
+type Licenses map[string]License
+
+// GetLicense returns the license of a dictionary pair. If the pair has no
+// specific license, the default license (which may be empty) is returned.
+func (d *Data) GetLicense(fromLang, toLang string) License {
+	if l, ok := d.Licenses[fromLang+"/"+toLang]; ok {
+		return l
+	}
+
+	return d.Licenses[""]
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/lib/pq"
 	null "gopkg.in/volatiletech/null.v6"
@@ -16,6 +17,7 @@ type JSON map[string]interface{}
 type Entry struct {
 	ID        int            `json:"id,omitempty" db:"id"`
 	GUID      string         `json:"guid" db:"guid"`
+	ShortID   string         `json:"short_id,omitempty" db:"short_id"`
 	Weight    float64        `json:"weight" db:"weight"`
 	Initial   string         `json:"initial" db:"initial"`
 	Lang      string         `json:"lang" db:"lang"`
@@ -24,13 +26,44 @@ type Entry struct {
 	Tags      pq.StringArray `json:"tags" db:"tags"`
 	Phones    pq.StringArray `json:"phones" db:"phones"`
 	Notes     string         `json:"notes" db:"notes"`
+	Etymology string         `json:"etymology" db:"etymology"`
+	Slug      string         `json:"slug" db:"slug"`
 	Meta      JSON           `json:"meta" db:"meta"`
 	Status    string         `json:"status" db:"status"`
+	PublishAt null.Time      `json:"publish_at" db:"publish_at"`
 	Relations []Entry        `json:"relations,omitempty" db:"relations"`
+	Media     []Media        `json:"media,omitempty" db:"-"`
 	Total     int            `json:"-" db:"total"`
 	CreatedAt null.Time      `json:"created_at" db:"created_at"`
 	UpdatedAt null.Time      `json:"updated_at" db:"updated_at"`
 
+	// Facet counts of all the matches of a search (see Facets) and the score
+	// of a match that search results are ordered by (lower is better).
+	Facets json.RawMessage `json:"-" db:"facets"`
+	Score  float64         `json:"-" db:"score"`
+
+	// Number of views in the queried period in "most viewed" lists.
+	Views int `json:"views,omitempty" db:"views"`
+
+	// Optional source, license, and attribution of entries taken from other
+	// dictionaries (see License for the licenses of whole dictionaries).
+	Source      string `json:"source,omitempty" db:"source"`
+	License     string `json:"license,omitempty" db:"license"`
+	Attribution string `json:"attribution,omitempty" db:"attribution"`
+
+	// Rank of the headword in the language's word frequency list (1 is the
+	// most frequent) and the name of its band (see FrequencyBand).
+	FrequencyRank null.Int `json:"frequency_rank" db:"frequency_rank"`
+	FrequencyBand string   `json:"frequency_band,omitempty" db:"-"`
+
+	// HTML escaped content with the words of a search query highlighted.
+	Highlight string `json:"highlight,omitempty" db:"-"`
+
+	// Content and notes rendered from the language's content format to
+	// sanitized HTML (eg: ?render=html).
+	ContentHTML string `json:"content_html,omitempty" db:"-"`
+	NotesHTML   string `json:"notes_html,omitempty" db:"-"`
+
 	// Non-public fields for scanning relationship data and populating Relation.
 	FromID            int            `json:"-" db:"from_id"`
 	RelationID        int            `json:"-" db:"relation_id"`
@@ -41,6 +74,9 @@ type Entry struct {
 	RelationStatus    string         `json:"-" db:"relation_status"`
 	RelationCreatedAt null.Time      `json:"-" db:"relation_created_at"`
 	RelationUpdatedAt null.Time      `json:"-" db:"relation_updated_at"`
+	RelationGender    string         `json:"-" db:"relation_gender"`
+	RelationRegister  string         `json:"-" db:"relation_register"`
+	RelationDomains   pq.StringArray `json:"-" db:"relation_domains"`
 
 	// RelationEntry encompasses an Entry with added fields that
 	// describes its relationship to other []Entry. This is only populated in
@@ -48,6 +84,15 @@ type Entry struct {
 	Relation *Relation `json:"relation,omitempty"`
 }
 
+// Facets represents the counts of search matches by the types (parts of
+// speech) of their definitions, their tags, and the languages of their
+// definitions.
+type Facets struct {
+	POS  map[string]int `json:"pos,omitempty"`
+	Tag  map[string]int `json:"tag,omitempty"`
+	Lang map[string]int `json:"lang,omitempty"`
+}
+
 // Relation represents the relationship between two IDs.
 type Relation struct {
 	ID        int            `json:"id,omitempty"`
@@ -56,22 +101,291 @@ type Relation struct {
 	Notes     string         `json:"notes"`
 	Weight    float64        `json:"weight"`
 	Status    string         `json:"status"`
+	Gender    string         `json:"gender"`
+	Register  string         `json:"register"`
+	Domains   pq.StringArray `json:"domains"`
+	Examples  []Example      `json:"examples"`
+	Media     []Media        `json:"media,omitempty"`
 	CreatedAt null.Time      `json:"created_at"`
 	UpdatedAt null.Time      `json:"updated_at"`
 }
 
+// Media is an image attached to an entry or to one of its definitions (relation).
+type Media struct {
+	ID            int       `json:"id,omitempty" db:"id"`
+	EntryID       int       `json:"-" db:"entry_id"`
+	RelationID    int       `json:"relation_id,omitempty" db:"relation_id"`
+	Filename      string    `json:"-" db:"filename"`
+	ThumbFilename string    `json:"-" db:"thumb_filename"`
+	URL           string    `json:"url" db:"url"`
+	ThumbURL      string    `json:"thumb_url" db:"thumb_url"`
+	ContentType   string    `json:"content_type" db:"content_type"`
+	Width         int       `json:"width" db:"width"`
+	Height        int       `json:"height" db:"height"`
+	Caption       string    `json:"caption" db:"caption"`
+	Weight        float64   `json:"weight" db:"weight"`
+	CreatedAt     null.Time `json:"created_at" db:"created_at"`
+}
+
+// Example is a usage example sentence of a definition (relation).
+type Example struct {
+	ID          int       `json:"id,omitempty" db:"id"`
+	RelationID  int       `json:"relation_id,omitempty" db:"relation_id"`
+	Lang        string    `json:"lang" db:"lang"`
+	Content     string    `json:"content" db:"content"`
+	Translation string    `json:"translation" db:"translation"`
+	Weight      float64   `json:"weight" db:"weight"`
+	CreatedAt   null.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   null.Time `json:"updated_at" db:"updated_at"`
+
+	// Optional externally computed tsvector tokens for languages without
+	// Postgres tokenizers when inserting examples.
+	Tokens string `json:"tokens,omitempty" db:"-"`
+
+	// The headword and definition that the example belongs to in example searches.
+	EntryGUID    string `json:"entry_guid,omitempty" db:"entry_guid"`
+	EntryContent string `json:"entry_content,omitempty" db:"entry_content"`
+	Definition   string `json:"definition,omitempty" db:"definition"`
+
+	Total int `json:"-" db:"total"`
+}
+
+// Etymology is an entry with its etymological links to other entries, which
+// have their own links, forming chains.
+type Etymology struct {
+	GUID      string          `json:"guid"`
+	Content   string          `json:"content"`
+	Lang      string          `json:"lang"`
+	Slug      string          `json:"slug"`
+	Etymology string          `json:"etymology"`
+	Links     []EtymologyLink `json:"links"`
+}
+
+// EtymologyLink is a typed etymological link to an entry, eg: borrowed-from.
+type EtymologyLink struct {
+	Type  string    `json:"type"`
+	Notes string    `json:"notes"`
+	Entry Etymology `json:"entry"`
+}
+
+// EtymologyRef is an etymological link to an entry referenced by its GUID
+// for updating the links of an entry.
+type EtymologyRef struct {
+	GUID   string  `json:"guid"`
+	Type   string  `json:"type"`
+	Notes  string  `json:"notes"`
+	Weight float64 `json:"weight"`
+}
+
+// etymologyRow is a link in the flat list of etymological links of an entry.
+type etymologyRow struct {
+	EntryID   int    `db:"entry_id"`
+	TargetID  int    `db:"target_id"`
+	Type      string `db:"type"`
+	Notes     string `db:"notes"`
+	GUID      string `db:"guid"`
+	Content   string `db:"content"`
+	Lang      string `db:"lang"`
+	Slug      string `db:"slug"`
+	Etymology string `db:"etymology"`
+}
+
+// DeletedEntry represents the tombstone of a deleted entry.
+type DeletedEntry struct {
+	ID        int64     `db:"id"`
+	GUID      string    `db:"guid"`
+	DeletedAt time.Time `db:"deleted_at"`
+}
+
+// ReverseDef represents a definition of a headword that's inverted into a
+// headword of the reverse dictionary.
+type ReverseDef struct {
+	RelationID int            `db:"id"`
+	FromID     int            `db:"from_id"`
+	Types      pq.StringArray `db:"types"`
+	Content    string         `db:"content"`
+}
+
+// IndexEntry represents an entry to be synced to an external search index.
+type IndexEntry struct {
+	ID         int            `db:"id"`
+	GUID       string         `db:"guid"`
+	Lang       string         `db:"lang"`
+	Content    string         `db:"content"`
+	Initial    string         `db:"initial"`
+	Tags       pq.StringArray `db:"tags"`
+	Status     string         `db:"status"`
+	Weight     float64        `db:"weight"`
+	IsHeadword bool           `db:"is_headword"`
+	ToLangs    pq.StringArray `db:"to_langs"`
+	UpdatedAt  time.Time      `db:"updated_at"`
+}
+
+// IndexWord represents a headword and its short gloss in a search index.
+type IndexWord struct {
+	ID      int    `json:"-" db:"id"`
+	GUID    string `json:"guid" db:"guid"`
+	Content string `json:"content" db:"content"`
+	Gloss   string `json:"gloss" db:"gloss"`
+}
+
+// FeedEntry represents a recently added headword with its first definition in a feed.
+type FeedEntry struct {
+	GUID      string    `db:"guid"`
+	Content   string    `db:"content"`
+	Lang      string    `db:"lang"`
+	Slug      string    `db:"slug"`
+	Gloss     string    `db:"gloss"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
 // GlossaryWord to read glosary content from db.
 type GlossaryWord struct {
 	ID      int    `json:"id,omitempty" db:"id"`
+	GUID    string `json:"guid" db:"guid"`
 	Content string `json:"content" db:"content"`
 	Total   int    `json:"-" db:"total"`
 }
 
+// QuizWord is a random headword with its first definition (gloss) for quizzes.
+type QuizWord struct {
+	GUID    string         `json:"guid" db:"guid"`
+	Content string         `json:"content" db:"content"`
+	Tags    pq.StringArray `json:"tags" db:"tags"`
+	Gloss   string         `json:"gloss" db:"gloss"`
+}
+
+// Reader is a site visitor account.
+type Reader struct {
+	ID          int       `json:"id" db:"id"`
+	Email       string    `json:"email" db:"email"`
+	CreatedAt   null.Time `json:"created_at" db:"created_at"`
+	LastLoginAt null.Time `json:"last_login_at" db:"last_login_at"`
+}
+
+// WordList is a list of words saved by a reader.
+type WordList struct {
+	ID          int         `json:"id" db:"id"`
+	ReaderID    int         `json:"-" db:"reader_id"`
+	Name        string      `json:"name" db:"name"`
+	Description string      `json:"description" db:"description"`
+	Slug        null.String `json:"slug" db:"slug"`
+	Public      bool        `json:"public" db:"public"`
+	Featured    bool        `json:"featured" db:"featured"`
+	Total       int         `json:"total" db:"total"`
+	HasEntry    bool        `json:"has_entry" db:"has_entry"`
+	CreatedAt   null.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt   null.Time   `json:"updated_at" db:"updated_at"`
+
+	// Total number of lists in paginated queries.
+	TotalLists int `json:"-" db:"total_lists"`
+
+	Entries []Entry `json:"entries,omitempty" db:"-"`
+}
+
+// Redirect redirects an old site path (Source) to a new path or URL (Target)
+// with an HTTP status code (301, 302, 307, 308).
+type Redirect struct {
+	ID        int       `json:"id" db:"id"`
+	Source    string    `json:"source" db:"source"`
+	Target    string    `json:"target" db:"target"`
+	Code      int       `json:"code" db:"code"`
+	Hits      int       `json:"hits" db:"hits"`
+	Total     int       `json:"-" db:"total"`
+	CreatedAt null.Time `json:"created_at" db:"created_at"`
+	UpdatedAt null.Time `json:"updated_at" db:"updated_at"`
+}
+
+// APIKey represents a key issued to a third-party app for the public APIs.
+type APIKey struct {
+	ID         int    `json:"id" db:"id"`
+	Name       string `json:"name" db:"name"`
+	KeyHash    string `json:"-" db:"key_hash"`
+	KeyPrefix  string `json:"key_prefix" db:"key_prefix"`
+	Notes      string `json:"notes" db:"notes"`
+	RateLimit  int    `json:"rate_limit" db:"rate_limit"`
+	DailyQuota int    `json:"daily_quota" db:"daily_quota"`
+	Enabled    bool   `json:"enabled" db:"enabled"`
+
+	// Number of requests made with the key today.
+	RequestsToday int `json:"requests_today" db:"requests_today"`
+
+	LastUsedAt null.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt  null.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  null.Time `json:"updated_at" db:"updated_at"`
+
+	// The key itself, which is only returned when it's created.
+	Key string `json:"key,omitempty" db:"-"`
+}
+
+// APIKeyUsage represents the request counts of an API key on a day.
+type APIKeyUsage struct {
+	Day      string `json:"day" db:"day"`
+	Requests int    `json:"requests" db:"requests"`
+	Rejected int    `json:"rejected" db:"rejected"`
+}
+
 // Stats contains database statistics.
 type Stats struct {
 	Entries   int            `json:"entries"`
 	Relations int            `json:"relations"`
 	Languages map[string]int `json:"languages"`
+
+	// Number of entries by status per language.
+	LanguageStatuses map[string]map[string]int `json:"language_statuses"`
+
+	// Pending public submissions.
+	Pending         int `json:"pending"`
+	PendingComments int `json:"pending_comments"`
+
+	// Time the materialized entry and relation counts were last refreshed.
+	CountsUpdatedAt null.Time `json:"counts_updated_at"`
+
+	EntriesPerDay      []StatsDay         `json:"entries_per_day"`
+	Contributors       []StatsContributor `json:"contributors"`
+	ZeroResultSearches []SearchMiss       `json:"zero_result_searches"`
+}
+
+// StatsDay is the number of entries added on a day.
+type StatsDay struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// StatsContributor is the number of changes made by an admin user.
+type StatsContributor struct {
+	Username string `json:"username"`
+	Changes  int    `json:"changes"`
+}
+
+// SearchMiss is a public search query that yielded no results.
+type SearchMiss struct {
+	FromLang  string    `json:"from_lang"`
+	ToLang    string    `json:"to_lang"`
+	Query     string    `json:"query"`
+	Count     int       `json:"count"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MissingRef is a definition of a headword that refers to another headword,
+// eg: a cross-reference, where the referred entry (Ref) is missing on the
+// site as it's disabled or has no definitions of its own.
+type MissingRef struct {
+	RelationID int            `json:"relation_id" db:"relation_id"`
+	Types      pq.StringArray `json:"types" db:"types"`
+	Tags       pq.StringArray `json:"tags" db:"tags"`
+
+	EntryID      int    `json:"entry_id" db:"entry_id"`
+	EntryContent string `json:"entry_content" db:"entry_content"`
+	Lang         string `json:"lang" db:"lang"`
+
+	RefID      int    `json:"ref_id" db:"ref_id"`
+	RefContent string `json:"ref_content" db:"ref_content"`
+
+	// Why the referred entry is missing: disabled | no_definitions.
+	Reason string `json:"reason" db:"reason"`
+
+	Total int `json:"-" db:"total"`
 }
 
 type Comments struct {
@@ -81,6 +395,207 @@ type Comments struct {
 	Comments string   `json:"comments" db:"comments"`
 }
 
+// EditorComment is an internal comment on an entry by an editor.
+type EditorComment struct {
+	ID        int       `json:"id" db:"id"`
+	EntryID   int       `json:"entry_id" db:"entry_id"`
+	Author    string    `json:"author" db:"author"`
+	Comments  string    `json:"comments" db:"comments"`
+	CreatedAt null.Time `json:"created_at" db:"created_at"`
+}
+
+// User is an admin user that logs in with a role.
+type User struct {
+	ID        int       `json:"id" db:"id"`
+	Username  string    `json:"username" db:"username"`
+	Password  string    `json:"-" db:"password"`
+	Name      string    `json:"name" db:"name"`
+	Role      string    `json:"role" db:"role"`
+	Status    string    `json:"status" db:"status"`
+	CreatedAt null.Time `json:"created_at" db:"created_at"`
+	UpdatedAt null.Time `json:"updated_at" db:"updated_at"`
+}
+
+// AuditLog is a record of a mutation made via the admin APIs.
+type AuditLog struct {
+	ID        int64           `json:"id" db:"id"`
+	Username  string          `json:"username" db:"username"`
+	Method    string          `json:"method" db:"method"`
+	Endpoint  string          `json:"endpoint" db:"endpoint"`
+	Entity    string          `json:"entity" db:"entity"`
+	EntityID  int             `json:"entity_id" db:"entity_id"`
+	Before    json.RawMessage `json:"before" db:"before"`
+	After     json.RawMessage `json:"after" db:"after"`
+	IP        string          `json:"ip" db:"ip"`
+	CreatedAt null.Time       `json:"created_at" db:"created_at"`
+
+	Total int `json:"-" db:"total"`
+}
+
+// Trash is a deleted entry or relation that can be restored. Data contains
+// the deleted rows.
+type Trash struct {
+	ID        int             `json:"id" db:"id"`
+	Type      string          `json:"type" db:"type"`
+	EntityID  int             `json:"entity_id" db:"entity_id"`
+	Label     string          `json:"label" db:"label"`
+	Data      json.RawMessage `json:"data,omitempty" db:"data"`
+	DeletedBy string          `json:"deleted_by" db:"deleted_by"`
+	DeletedAt null.Time       `json:"deleted_at" db:"deleted_at"`
+
+	Total int `json:"-" db:"total"`
+}
+
+// LangConfig is a language managed from the admin. Config has the same keys
+// as a [lang.*] language in the config file.
+type LangConfig struct {
+	ID        string          `json:"id" db:"id"`
+	Config    json.RawMessage `json:"config" db:"config"`
+	Dicts     pq.StringArray  `json:"dicts" db:"dicts"`
+	CreatedAt null.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt null.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// EntryLock is a short-lived lock held by an editor editing an entry.
+type EntryLock struct {
+	EntryID   int       `json:"entry_id" db:"entry_id"`
+	Username  string    `json:"username" db:"username"`
+	CreatedAt null.Time `json:"created_at" db:"created_at"`
+	ExpiresAt null.Time `json:"expires_at" db:"expires_at"`
+}
+
+// Job is a background job, like an import or export, that's run by workers.
+type Job struct {
+	ID         int             `json:"id" db:"id"`
+	Type       string          `json:"type" db:"type"`
+	Status     string          `json:"status" db:"status"`
+	Params     json.RawMessage `json:"params" db:"params"`
+	Log        string          `json:"log,omitempty" db:"log"`
+	Result     string          `json:"result" db:"result"`
+	CreatedBy  string          `json:"created_by" db:"created_by"`
+	CreatedAt  null.Time       `json:"created_at" db:"created_at"`
+	StartedAt  null.Time       `json:"started_at" db:"started_at"`
+	FinishedAt null.Time       `json:"finished_at" db:"finished_at"`
+
+	Total int `json:"-" db:"total"`
+}
+
+// AuditQuery represents the filters for querying the audit log.
+type AuditQuery struct {
+	Username string
+	Entity   string
+	EntityID int
+	Method   string
+	From     null.Time
+	To       null.Time
+}
+
+// ExportFilter represents the filters for exporting a subset of the entries.
+// Empty fields match all entries.
+type ExportFilter struct {
+	// Language of the headwords and of their definitions.
+	FromLang string
+	ToLang   string
+
+	// Tags that the headwords should have at least one of.
+	Tags []string
+
+	// Status of the headwords and of their definitions.
+	Status string
+
+	// Only headwords that have been updated since.
+	UpdatedSince null.Time
+}
+
+// ReplaceFilter represents the filters of the definitions that a batch
+// find-and-replace is run on. Empty fields match all definitions.
+type ReplaceFilter struct {
+	// Languages of the definitions.
+	Langs []string
+
+	// Tags that the definitions or their relations should have at least one of.
+	Tags []string
+}
+
+// DumpEntry is an entry with its outgoing relations for lossless data export and import.
+type DumpEntry struct {
+	ID        int             `json:"-" db:"id"`
+	GUID      string          `json:"guid" db:"guid"`
+	ShortID   string          `json:"short_id,omitempty" db:"short_id"`
+	Content   string          `json:"content" db:"content"`
+	Initial   string          `json:"initial" db:"initial"`
+	Weight    float64         `json:"weight" db:"weight"`
+	Tokens    string          `json:"tokens" db:"tokens"`
+	Lang      string          `json:"lang" db:"lang"`
+	Tags      pq.StringArray  `json:"tags" db:"tags"`
+	Phones    pq.StringArray  `json:"phones" db:"phones"`
+	Notes     string          `json:"notes" db:"notes"`
+	Slug      string          `json:"slug" db:"slug"`
+	Meta      json.RawMessage `json:"meta" db:"meta"`
+	Status    string          `json:"status" db:"status"`
+	PublishAt null.Time       `json:"publish_at" db:"publish_at"`
+	CreatedAt null.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt null.Time       `json:"updated_at" db:"updated_at"`
+	Relations DumpRelations   `json:"relations" db:"relations"`
+
+	Etymology      string          `json:"etymology,omitempty" db:"etymology"`
+	EtymologyLinks json.RawMessage `json:"etymology_links,omitempty" db:"etymology_links"`
+
+	Source      string `json:"source,omitempty" db:"source"`
+	License     string `json:"license,omitempty" db:"license"`
+	Attribution string `json:"attribution,omitempty" db:"attribution"`
+}
+
+// DumpRelation is a relation from an entry to another entry referenced by its GUID.
+type DumpRelation struct {
+	ToGUID string         `json:"to_guid"`
+	Types  pq.StringArray `json:"types"`
+	Tags   pq.StringArray `json:"tags"`
+	Notes  string         `json:"notes"`
+	Weight float64        `json:"weight"`
+	Status string         `json:"status"`
+
+	Gender   string         `json:"gender,omitempty"`
+	Register string         `json:"register,omitempty"`
+	Domains  pq.StringArray `json:"domains,omitempty"`
+
+	Examples []DumpExample `json:"examples,omitempty"`
+}
+
+// DumpExample is a usage example of a relation.
+type DumpExample struct {
+	Lang        string  `json:"lang"`
+	Content     string  `json:"content"`
+	Translation string  `json:"translation"`
+	Tokens      string  `json:"tokens"`
+	Weight      float64 `json:"weight"`
+}
+
+// DumpRelations is a list of DumpRelation scanned from a JSON aggregate.
+type DumpRelations []DumpRelation
+
+// Scan unmarshals the JSON list of relations from the DB.
+func (d *DumpRelations) Scan(src interface{}) error {
+	if src == nil {
+		*d = DumpRelations{}
+		return nil
+	}
+
+	if b, ok := src.([]byte); ok {
+		return json.Unmarshal(b, d)
+	}
+	return fmt.Errorf("could not not decode type %T -> %T", src, d)
+}
+
+// Change represents an entry that was created, updated, or deleted.
+type Change struct {
+	ID        int64     `db:"id"`
+	GUID      string    `db:"guid"`
+	Action    string    `db:"action"`
+	Kind      int       `db:"kind"`
+	ChangedAt time.Time `db:"changed_at"`
+}
+
 // Value returns the JSON marshalled SubscriberAttribs.
 func (s JSON) Value() (driver.Value, error) {
 	return json.Marshal(s)
@@ -98,3 +613,12 @@ func (s JSON) Scan(src interface{}) error {
 	}
 	return fmt.Errorf("could not not decode type %T -> %T", src, s)
 }
+
+// DryRun is the preview of a destructive operation (eg: a deletion) with the
+// counts of the rows that it would change by type, and the GUIDs of the
+// affected entries, without making the changes.
+type DryRun struct {
+	DryRun bool           `json:"dry_run" db:"-"`
+	Counts JSON           `json:"counts" db:"counts"`
+	GUIDs  pq.StringArray `json:"guids" db:"guids"`
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"fmt"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Unicode normalization forms.
+var normForms = map[string]norm.Form{
+	"nfc":  norm.NFC,
+	"nfd":  norm.NFD,
+	"nfkc": norm.NFKC,
+	"nfkd": norm.NFKD,
+}
+
+// Normalization represents how the headwords of a language and search queries
+// in it are normalized before they are matched, so that eg: "café" and "cafe"
+// match each other when diacritics are stripped.
+type Normalization struct {
+	// Unicode normalization form: nfc | nfd | nfkc | nfkd.
+	Form string `json:"form"`
+
+	// Remove combining diacritical marks (eg: the acute in é). Only the marks
+	// shared by scripts are removed and not script specific marks such as
+	// the vowel signs of Indic scripts.
+	StripDiacritics bool `json:"strip_diacritics"`
+
+	// Unicode case folding.
+	CaseFold bool `json:"case_fold"`
+}
+
+// Enabled returns true if any normalization is configured.
+func (n Normalization) Enabled() bool {
+	return n.Form != "" || n.StripDiacritics || n.CaseFold
+}
+
+// Validate checks the normalization config.
+func (n Normalization) Validate() error {
+	if _, ok := normForms[n.Form]; n.Form != "" && !ok {
+		return fmt.Errorf("unknown normalization form '%s'. Should be nfc|nfd|nfkc|nfkd", n.Form)
+	}
+
+	return nil
+}
+
+// Apply normalizes a string.
+func (n Normalization) Apply(s string) string {
+	if n.StripDiacritics {
+		// Decompose, drop the combining marks, and recompose.
+		t := transform.Chain(norm.NFD, runes.Remove(runes.Predicate(isDiacritic)), norm.NFC)
+		if out, _, err := transform.String(t, s); err == nil {
+			s = out
+		}
+	}
+
+	if n.CaseFold {
+		s = cases.Fold().String(s)
+	}
+
+	if f, ok := normForms[n.Form]; ok {
+		s = f.String(s)
+	}
+
+	return s
+}
+
+// isDiacritic checks whether a rune is a combining mark that's not specific
+// to a script (eg: U+0301 combining acute accent).
+func isDiacritic(r rune) bool {
+	return unicode.Is(unicode.Mn, r) && unicode.Is(unicode.Inherited, r)
+}
+
+// Normalized returns the normalized form of a string in the language that's
+// stored along with entries and matched against normalized queries. It's
+// empty if the language has no normalization configured.
+func (l Lang) Normalized(s string) string {
+	if !l.Normalize.Enabled() {
+		return ""
+	}
+
+	return l.Normalize.Apply(s)
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+)
+
+// InsertReaderToken inserts the hash of a login token for an e-mail that's
+// valid for ttl. If a token was already issued to the e-mail in the past
+// throttle duration, nothing is inserted and false is returned.
+func (d *Data) InsertReaderToken(hash, email string, ttl, throttle time.Duration) (bool, error) {
+	res, err := d.queries.InsertReaderToken.Exec(hash, email, int(ttl.Seconds()), int(throttle.Seconds()))
+	if err != nil {
+		return false, err
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// LoginReader consumes a valid login token by its hash and returns its reader,
+// creating the reader with an empty word list (defaultList) on their first
+// login. If the token doesn't exist or has expired, sql.ErrNoRows is returned.
+func (d *Data) LoginReader(hash, defaultList string) (Reader, error) {
+	var out Reader
+	err := d.queries.LoginReader.Get(&out, hash, defaultList)
+	return out, err
+}
+
+// GetReader returns a reader by ID.
+func (d *Data) GetReader(id int) (Reader, error) {
+	var out Reader
+	err := d.queries.GetReader.Get(&out, id)
+	return out, err
+}
+
+// DeleteReader deletes a reader and their word lists.
+func (d *Data) DeleteReader(id int) error {
+	_, err := d.queries.DeleteReader.Exec(id)
+	return err
+}
+
+// GetWordLists returns the word lists of a reader. If an entry GUID is given,
+// HasEntry is set on the lists that have the entry.
+func (d *Data) GetWordLists(readerID int, guid string) ([]WordList, error) {
+	out := []WordList{}
+	if err := d.queries.GetWordLists.Select(&out, readerID, guid); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetWordList returns a reader's word list by ID.
+func (d *Data) GetWordList(id, readerID int) (WordList, error) {
+	var out WordList
+	err := d.queries.GetWordList.Get(&out, id, readerID)
+	return out, err
+}
+
+// InsertWordList creates a word list for a reader and returns its ID.
+func (d *Data) InsertWordList(readerID int, l WordList) (int, error) {
+	var id int
+	err := d.queries.InsertWordList.Get(&id, readerID, l.Name, l.Description, l.Public)
+	return id, err
+}
+
+// UpdateWordList updates the name, description, and visibility of a reader's
+// word list. If the list doesn't exist, sql.ErrNoRows is returned.
+func (d *Data) UpdateWordList(id, readerID int, l WordList) error {
+	res, err := d.queries.UpdateWordList.Exec(id, readerID, l.Name, l.Description, l.Public)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteWordList deletes a reader's word list. If the list doesn't exist,
+// sql.ErrNoRows is returned.
+func (d *Data) DeleteWordList(id, readerID int) error {
+	res, err := d.queries.DeleteWordList.Exec(id, readerID)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetWordListEntries returns the enabled entries in a word list, most recently
+// saved first.
+func (d *Data) GetWordListEntries(listID int) ([]Entry, error) {
+	out := []Entry{}
+	if err := d.queries.GetWordListEntries.Select(&out, listID); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// InsertWordListEntry adds an enabled entry by its GUID to a word list. Adding
+// an entry that's already in the list is a no-op. If the entry doesn't exist,
+// sql.ErrNoRows is returned.
+func (d *Data) InsertWordListEntry(listID int, guid string) error {
+	var n int
+	if err := d.queries.InsertWordListEntry.Get(&n, listID, guid); err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteWordListEntry removes an entry by its GUID from a word list.
+func (d *Data) DeleteWordListEntry(listID int, guid string) error {
+	_, err := d.queries.DeleteWordListEntry.Exec(listID, guid)
+	return err
+}
+
+// GetPublicWordList returns a public word list by its slug.
+func (d *Data) GetPublicWordList(slug string) (WordList, error) {
+	var out WordList
+	err := d.queries.GetPublicWordList.Get(&out, slug)
+	return out, err
+}
+
+// GetPublicWordLists returns paginated public word lists, optionally only the
+// featured ones, most recently updated first, and the total number of lists.
+func (d *Data) GetPublicWordLists(featured bool, offset, limit int) ([]WordList, int, error) {
+	var out []WordList
+	if err := d.queries.GetPublicWordLists.Select(&out, featured, offset, limit); err != nil || len(out) == 0 {
+		return []WordList{}, 0, err
+	}
+
+	return out, out[0].TotalLists, nil
+}
+
+// UpdateWordListFeatured features or unfeatures a public word list. If the
+// list doesn't exist or isn't public, sql.ErrNoRows is returned.
+func (d *Data) UpdateWordListFeatured(id int, featured bool) error {
+	res, err := d.queries.UpdateWordListFeatured.Exec(id, featured)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
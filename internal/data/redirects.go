@@ -0,0 +1,79 @@
+package data
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// GetRedirects returns paginated redirects, optionally with the source or
+// target containing a string, and the total count.
+func (d *Data) GetRedirects(q string, offset, limit int) ([]Redirect, int, error) {
+	var out []Redirect
+	if err := d.queries.GetRedirects.Select(&out, q, offset, limit); err != nil || len(out) == 0 {
+		return []Redirect{}, 0, err
+	}
+
+	return out, out[0].Total, nil
+}
+
+// GetRedirect returns a redirect by ID.
+func (d *Data) GetRedirect(id int) (Redirect, error) {
+	var out Redirect
+	err := d.queries.GetRedirect.Get(&out, id)
+	return out, err
+}
+
+// MatchRedirect returns the redirect of the first of the given source paths
+// that has one and counts the hit. If none of them have a redirect,
+// sql.ErrNoRows is returned.
+func (d *Data) MatchRedirect(sources []string) (Redirect, error) {
+	var out Redirect
+	err := d.queries.MatchRedirect.Get(&out, pq.StringArray(sources))
+	return out, err
+}
+
+// InsertRedirect inserts a redirect.
+func (d *Data) InsertRedirect(r Redirect) (Redirect, error) {
+	var out Redirect
+	err := d.queries.InsertRedirect.Get(&out, r.Source, r.Target, r.Code)
+	return out, err
+}
+
+// UpsertRedirects inserts redirects in bulk, replacing the targets of the
+// existing sources, and returns the number of redirects upserted.
+func (d *Data) UpsertRedirects(rs []Redirect) (int, error) {
+	var (
+		sources = make([]string, len(rs))
+		targets = make([]string, len(rs))
+		codes   = make([]int64, len(rs))
+	)
+	for i, r := range rs {
+		sources[i], targets[i], codes[i] = r.Source, r.Target, int64(r.Code)
+	}
+
+	var n int
+	err := d.queries.UpsertRedirects.Get(&n, pq.StringArray(sources), pq.StringArray(targets), pq.Int64Array(codes))
+	return n, err
+}
+
+// UpdateRedirect updates a redirect. It returns sql.ErrNoRows if the redirect
+// doesn't exist.
+func (d *Data) UpdateRedirect(id int, r Redirect) (Redirect, error) {
+	var out Redirect
+	err := d.queries.UpdateRedirect.Get(&out, id, r.Source, r.Target, r.Code)
+	return out, err
+}
+
+// DeleteRedirect deletes a redirect.
+func (d *Data) DeleteRedirect(id int) error {
+	res, err := d.queries.DeleteRedirect.Exec(id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/bidi"
+)
+
+// Text directions.
+const (
+	DirLTR = "ltr"
+	DirRTL = "rtl"
+)
+
+// Dir returns the text direction (ltr|rtl) of the language.
+func (l Lang) Dir() string {
+	if l.Direction == DirRTL {
+		return DirRTL
+	}
+
+	return DirLTR
+}
+
+// SortStrings sorts strings in the language (eg: initials) in the
+// alphabetical order of the language's locale. Without a locale, strings
+// are sorted in the Unicode code point order.
+func (l Lang) SortStrings(s []string) {
+	if l.Locale == "" {
+		sort.Strings(s)
+		return
+	}
+
+	// Collators aren't safe for concurrent use.
+	collate.New(language.Make(l.Locale)).SortStrings(s)
+}
+
+// Initial returns the first character (not byte) of a string in uppercase.
+func Initial(s string) string {
+	r, _ := utf8.DecodeRuneInString(strings.TrimSpace(s))
+	if r == utf8.RuneError {
+		return ""
+	}
+
+	return strings.ToUpper(string(r))
+}
+
+// TextDir returns the direction (ltr|rtl) of a string by its first strongly
+// directional character.
+func TextDir(s string) string {
+	for _, r := range s {
+		p, _ := bidi.LookupRune(r)
+		switch p.Class() {
+		case bidi.R, bidi.AL:
+			return DirRTL
+		case bidi.L:
+			return DirLTR
+		}
+	}
+
+	return DirLTR
+}
+
+// Script returns the name of the Unicode script (eg: Latin, Arabic) that
+// most of the letters in a string are written in.
+func Script(s string) string {
+	counts := map[string]int{}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		for name, tbl := range unicode.Scripts {
+			if unicode.Is(tbl, r) {
+				counts[name]++
+				break
+			}
+		}
+	}
+
+	out := ""
+	for name, n := range counts {
+		if n > counts[out] || (n == counts[out] && name < out) {
+			out = name
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,218 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ModeSemantic is the search mode that matches headwords by the meaning of
+// the query with the embeddings of the headwords and their definitions.
+const ModeSemantic = "semantic"
+
+// SimilarEmbedding ranks headwords in the same language by the distance
+// of their embeddings to the entry's embedding.
+const SimilarEmbedding = "embedding"
+
+// Placeholder in the semantic search schema that's replaced with the number
+// of dimensions of the embedding vectors.
+const dimensionsPlaceholder = "{dimensions}"
+
+// Embedder computes the embedding vectors of texts for semantic search.
+type Embedder interface {
+	Embed(texts []string) ([][]float32, error)
+}
+
+// SemanticOpt represents the options of the semantic search mode.
+type SemanticOpt struct {
+	// Name of the embedding model. Entries that were embedded with a different
+	// model are embedded again.
+	Model string
+
+	// Number of dimensions of the model's vectors.
+	Dimensions int
+
+	// Max cosine distance (0 to 2) of matches. 0 matches all headwords.
+	MaxDistance float64
+}
+
+// semantic holds the embedding provider and the queries of the semantic
+// search mode, which are only prepared if it's enabled as they need the
+// pgvector extension.
+type semantic struct {
+	opt SemanticOpt
+	emb Embedder
+
+	getEntriesToEmbed *sqlx.Stmt
+	upsertEmbeddings  *sqlx.Stmt
+	search            *sqlx.Stmt
+	getSimilar        *sqlx.Stmt
+}
+
+// embedEntry is an entry whose embedding is missing or outdated.
+type embedEntry struct {
+	ID          int    `db:"id"`
+	Content     string `db:"content"`
+	Definitions string `db:"definitions"`
+}
+
+// PrepareSemantic enables the semantic search mode. It creates the pgvector
+// extension and the embeddings table if they don't exist and prepares the
+// semantic queries (name => raw SQL).
+func (d *Data) PrepareSemantic(db *sqlx.DB, queries map[string]string, emb Embedder, o SemanticOpt) error {
+	if o.Dimensions < 1 {
+		return fmt.Errorf("invalid embedding dimensions %d", o.Dimensions)
+	}
+
+	q, ok := queries["create-embeddings"]
+	if !ok {
+		return fmt.Errorf("query 'create-embeddings' not found")
+	}
+	if _, err := db.Exec(strings.ReplaceAll(q, dimensionsPlaceholder, strconv.Itoa(o.Dimensions))); err != nil {
+		return fmt.Errorf("error creating embeddings table (is pgvector installed?): %v", err)
+	}
+
+	s := &semantic{opt: o, emb: emb}
+	for name, stmt := range map[string]**sqlx.Stmt{
+		"get-entries-to-embed":     &s.getEntriesToEmbed,
+		"upsert-embeddings":        &s.upsertEmbeddings,
+		"search-semantic":          &s.search,
+		"get-similar-by-embedding": &s.getSimilar,
+	} {
+		q, ok := queries[name]
+		if !ok {
+			return fmt.Errorf("query '%s' not found", name)
+		}
+
+		st, err := db.Unsafe().Preparex(q)
+		if err != nil {
+			return fmt.Errorf("error preparing query '%s': %v", name, err)
+		}
+		*stmt = st
+	}
+
+	d.semantic = s
+	d.RegisterSimilar(SimilarEmbedding, similarByQuery(s.getSimilar))
+
+	return nil
+}
+
+// HasSemantic returns true if the semantic search mode is enabled.
+func (d *Data) HasSemantic() bool {
+	return d.semantic != nil
+}
+
+// EmbedEntries computes and stores the embeddings of up to limit headwords
+// whose embeddings are missing, outdated, or from another model, and returns
+// the number of entries that were embedded. A headword is embedded with its
+// definitions so that it can be matched by meaning in any language.
+func (d *Data) EmbedEntries(limit int) (int, error) {
+	s := d.semantic
+	if s == nil {
+		return 0, nil
+	}
+
+	var entries []embedEntry
+	if err := s.getEntriesToEmbed.Select(&entries, s.opt.Model, limit); err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	var (
+		ids   = make([]int, len(entries))
+		texts = make([]string, len(entries))
+	)
+	for i, e := range entries {
+		ids[i] = e.ID
+		texts[i] = e.Content
+		if e.Definitions != "" {
+			texts[i] += ": " + e.Definitions
+		}
+	}
+
+	vecs, err := s.emb.Embed(texts)
+	if err != nil {
+		return 0, err
+	}
+
+	lits := make([]string, len(vecs))
+	for i, v := range vecs {
+		if len(v) != s.opt.Dimensions {
+			return 0, fmt.Errorf("embedding has %d dimensions, expected %d", len(v), s.opt.Dimensions)
+		}
+		lits[i] = vectorLiteral(v)
+	}
+
+	if _, err := s.upsertEmbeddings.Exec(pq.Array(ids), pq.Array(lits), s.opt.Model); err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
+
+// searchSemantic returns the headwords whose embeddings are the closest to the
+// query's embedding. The score of the matches is their cosine distance.
+func (d *Data) searchSemantic(q Query) ([]Entry, int, error) {
+	s := d.semantic
+	if s == nil {
+		return nil, 0, fmt.Errorf("semantic search is not enabled")
+	}
+
+	vecs, err := s.emb.Embed([]string{q.Query})
+	if err != nil {
+		return nil, 0, fmt.Errorf("error embedding query: %v", err)
+	}
+
+	fields := q.Fields
+	if fields == nil {
+		fields = JSON{}
+	}
+
+	var out []Entry
+	if err := s.search.Select(&out,
+		vectorLiteral(vecs[0]),
+		q.FromLang,
+		pq.StringArray(q.Tags),
+		q.Status,
+		fields,
+		s.opt.MaxDistance,
+		q.Offset, q.Limit,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return []Entry{}, 0, nil
+		}
+
+		return nil, 0, err
+	}
+
+	if len(out) == 0 {
+		return []Entry{}, 0, nil
+	}
+
+	for i := range out {
+		out[i].Relations = []Entry{}
+	}
+
+	return out, out[0].Total, nil
+}
+
+// vectorLiteral returns the pgvector text representation of a vector, eg: [1,2.5,3].
+func vectorLiteral(v []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Built-in strategies for finding similar entries.
+const (
+	// SimilarTokens ranks headwords in the same language by the search tokens
+	// they share with the entry.
+	SimilarTokens = "tokens"
+
+	// SimilarTags ranks headwords in the same language by the number of tags
+	// they share with the entry.
+	SimilarTags = "tags"
+)
+
+// SimilarFunc returns up to limit enabled headwords that are similar to an
+// entry, most similar first.
+type SimilarFunc func(e Entry, limit int) ([]Entry, error)
+
+// RegisterSimilar registers a strategy for finding similar entries (eg: by
+// embedding distance), replacing any existing strategy with the name.
+func (d *Data) RegisterSimilar(name string, fn SimilarFunc) {
+	if d.similar == nil {
+		d.similar = make(map[string]SimilarFunc)
+	}
+	d.similar[name] = fn
+}
+
+// SimilarStrategies returns the names of the registered similarity strategies.
+func (d *Data) SimilarStrategies() []string {
+	out := make([]string, 0, len(d.similar))
+	for name := range d.similar {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// GetSimilarEntries returns up to limit headwords similar to an entry by the
+// given strategy.
+func (d *Data) GetSimilarEntries(strategy string, e Entry, limit int) ([]Entry, error) {
+	fn, ok := d.similar[strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown similarity strategy '%s'", strategy)
+	}
+
+	return fn(e, limit)
+}
+
+// similarByQuery returns a SimilarFunc that runs a query with the entry's ID
+// and the limit.
+func similarByQuery(stmt *sqlx.Stmt) SimilarFunc {
+	return func(e Entry, limit int) ([]Entry, error) {
+		var out []Entry
+		if err := stmt.Select(&out, e.ID, limit); err != nil {
+			if err == sql.ErrNoRows {
+				return []Entry{}, nil
+			}
+			return nil, err
+		}
+
+		return out, nil
+	}
+}
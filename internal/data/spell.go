@@ -0,0 +1,142 @@
+package data
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Speller is a simple edit distance based spelling corrector that
+// corrects words against a list of known words (eg: headwords in the dictionary).
+type Speller struct {
+	known map[string]bool
+
+	// Known words bucketed by their length in runes to limit the number
+	// of distance computations for a given word.
+	byLen map[int][]string
+
+	mu sync.RWMutex
+}
+
+// NewSpeller returns a new Speller that corrects words to the given known words.
+func NewSpeller(words []string) *Speller {
+	s := &Speller{}
+	s.Load(words)
+
+	return s
+}
+
+// Load replaces the known words of the Speller, eg: when the headwords in the
+// dictionary change. It's safe to call while words are being corrected.
+func (s *Speller) Load(words []string) {
+	var (
+		known = make(map[string]bool, len(words))
+		byLen = make(map[int][]string)
+	)
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w == "" || known[w] {
+			continue
+		}
+
+		known[w] = true
+		n := utf8.RuneCountInString(w)
+		byLen[n] = append(byLen[n], w)
+	}
+
+	s.mu.Lock()
+	s.known, s.byLen = known, byLen
+	s.mu.Unlock()
+}
+
+// Correct returns the closest known word to the given word. If the word is
+// already known, or if there are no known words close enough, false is returned.
+func (s *Speller) Correct(word string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	word = strings.ToLower(word)
+	if s.known[word] {
+		return "", false
+	}
+
+	// Short words tolerate fewer edits.
+	var (
+		n       = utf8.RuneCountInString(word)
+		maxDist = 1
+	)
+	if n < 3 {
+		return "", false
+	} else if n > 5 {
+		maxDist = 2
+	}
+
+	var (
+		best     = ""
+		bestDist = maxDist + 1
+		w        = []rune(word)
+	)
+	for l := n - maxDist; l <= n+maxDist; l++ {
+		for _, k := range s.byLen[l] {
+			if d := editDistance(w, []rune(k), bestDist); d < bestDist {
+				best, bestDist = k, d
+			}
+		}
+	}
+
+	if best == "" {
+		return "", false
+	}
+
+	return best, true
+}
+
+// CorrectQuery corrects every word in a query and returns the corrected query.
+// If no word was corrected, false is returned.
+func (s *Speller) CorrectQuery(q string) (string, bool) {
+	var (
+		words   = strings.Fields(q)
+		changed = false
+	)
+	for i, w := range words {
+		if c, ok := s.Correct(w); ok {
+			words[i] = c
+			changed = true
+		}
+	}
+
+	return strings.Join(words, " "), changed
+}
+
+// editDistance returns the Levenshtein distance between a and b. Once the
+// distance is known to be >= max, it stops early and returns max.
+func editDistance(a, b []rune, max int) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+
+		if rowMin >= max {
+			return max
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,173 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Entry fields that templates can require in addition to the custom fields
+// of the language.
+var templateFields = map[string]bool{
+	"phones":      true,
+	"notes":       true,
+	"etymology":   true,
+	"tags":        true,
+	"definitions": true,
+}
+
+// Template is a preset for creating entries of a kind (eg: noun, verb,
+// proverb) in a language with pre-filled tags and definition slots, and the
+// fields that such entries should have, so that they're consistent across
+// editors.
+type Template struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+
+	// Definition slots that are pre-filled with their language and types
+	// (parts of speech).
+	Definitions []TemplateDef `json:"definitions"`
+
+	// Fields that are required: phones|notes|etymology|tags|definitions or
+	// the IDs of custom fields.
+	Required []string `json:"required"`
+}
+
+// TemplateDef is a definition slot in a template.
+type TemplateDef struct {
+	Lang  string   `json:"lang"`
+	Types []string `json:"types"`
+}
+
+// Templates represents the entry templates of a language indexed by their IDs.
+type Templates map[string]Template
+
+// Validate checks the template definitions against the custom fields of
+// the language.
+func (ts Templates) Validate(fields Fields) error {
+	for id, t := range ts {
+		if !reFieldID.MatchString(id) {
+			return fmt.Errorf("invalid template '%s'. Should be lowercase letters, numbers, and _", id)
+		}
+
+		for _, f := range t.Required {
+			if _, ok := fields[f]; !ok && !templateFields[f] {
+				return fmt.Errorf("unknown required field '%s' in template '%s'", f, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateDefs checks the languages and types of the definition slots of
+// the templates.
+func (ts Templates) ValidateDefs(langs LangMap) error {
+	for id, t := range ts {
+		for _, d := range t.Definitions {
+			l, ok := langs[d.Lang]
+			if !ok {
+				return fmt.Errorf("unknown definition language '%s' in template '%s'", d.Lang, id)
+			}
+
+			for _, typ := range d.Types {
+				if _, ok := l.Types[typ]; !ok {
+					return fmt.Errorf("unknown type '%s' for %s in template '%s'", typ, d.Lang, id)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Apply adds the template's tags to an entry and sets the types of its
+// definitions that have none from the template's definition slots. The Nth
+// definition in a language gets the types of the Nth slot in the language.
+func (t Template) Apply(e Entry) Entry {
+	for _, tag := range t.Tags {
+		if !hasString(e.Tags, tag) {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+
+	var (
+		rels = make([]Entry, len(e.Relations))
+		seen = map[string]int{}
+	)
+	for i, r := range e.Relations {
+		rels[i] = r
+
+		slot, ok := t.def(r.Lang, seen[r.Lang])
+		seen[r.Lang]++
+		if !ok || len(slot.Types) == 0 || (r.Relation != nil && len(r.Relation.Types) > 0) {
+			continue
+		}
+
+		rel := Relation{}
+		if r.Relation != nil {
+			rel = *r.Relation
+		}
+		rel.Types = append([]string{}, slot.Types...)
+		rels[i].Relation = &rel
+	}
+	e.Relations = rels
+
+	return e
+}
+
+// Missing returns the required fields of the template that are empty in an
+// entry. Custom fields are returned as meta.$id.
+func (t Template) Missing(e Entry) []string {
+	var out []string
+	for _, f := range t.Required {
+		var empty bool
+		switch f {
+		case "phones":
+			empty = len(e.Phones) == 0
+		case "notes":
+			empty = strings.TrimSpace(e.Notes) == ""
+		case "etymology":
+			empty = strings.TrimSpace(e.Etymology) == ""
+		case "tags":
+			empty = len(e.Tags) == 0
+		case "definitions":
+			empty = len(e.Relations) == 0
+		default:
+			v, ok := e.Meta[f]
+			empty = !ok || v == nil || v == ""
+			f = "meta." + f
+		}
+
+		if empty {
+			out = append(out, f)
+		}
+	}
+
+	return out
+}
+
+// def returns the nth definition slot of the template in a language.
+func (t Template) def(lang string, n int) (TemplateDef, bool) {
+	for _, d := range t.Definitions {
+		if d.Lang != lang {
+			continue
+		}
+		if n == 0 {
+			return d, true
+		}
+		n--
+	}
+
+	return TemplateDef{}, false
+}
+
+// hasString checks whether a string is in a list of strings.
+func hasString(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
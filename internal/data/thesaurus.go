@@ -0,0 +1,98 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExpandQuery splits a search query into words, drops the language's stopwords,
+// and expands every remaining word into its synonyms. Multi-word synonyms
+// (eg: "motor car") are matched first, longest phrase first. It returns the
+// list of alternatives (the word or phrase itself being the first) for every
+// word or phrase in the query. If every word in the query is a stopword,
+// the query is left untouched.
+func (l Lang) ExpandQuery(s string) [][]string {
+	var (
+		chunks = strings.Fields(strings.ToLower(s))
+		out    = make([][]string, 0, len(chunks))
+	)
+	for i := 0; i < len(chunks); {
+		// Find the longest phrase starting at this word that has synonyms.
+		w, n := chunks[i], 1
+		for j := min(l.SynonymWords, len(chunks)-i); j > 1; j-- {
+			if p := strings.Join(chunks[i:i+j], " "); len(l.Synonyms[p]) > 0 {
+				w, n = p, j
+				break
+			}
+		}
+		i += n
+
+		if n == 1 && l.Stopwords[w] {
+			continue
+		}
+
+		alts := []string{w}
+		for _, syn := range l.Synonyms[w] {
+			if syn != w {
+				alts = append(alts, syn)
+			}
+		}
+		out = append(out, alts)
+	}
+
+	// A query made only of stopwords (eg: "the") should still be searchable.
+	if len(out) == 0 {
+		for _, w := range chunks {
+			out = append(out, []string{w})
+		}
+	}
+
+	return out
+}
+
+// toTSQueryExpr takes a list of word alternatives and returns a Postgres tsquery
+// expression to be passed to TO_TSQUERY() with the words joined by the given
+// operator, for example: ('car' | 'automobile') & 'red'.
+// Multi-word synonyms become phrases as TO_TSQUERY() splits quoted strings.
+func toTSQueryExpr(words [][]string, op string) string {
+	groups := make([]string, 0, len(words))
+	for _, alts := range words {
+		q := make([]string, 0, len(alts))
+		for _, a := range alts {
+			q = append(q, quoteTSQuery(a))
+		}
+		groups = append(groups, "("+strings.Join(q, " | ")+")")
+	}
+
+	return strings.Join(groups, op)
+}
+
+// tokenizeExpanded converts a list of word alternatives into a tsquery using an
+// external Tokenizer to tokenize every individual alternative.
+func tokenizeExpanded(words [][]string, tk Tokenizer, lang string) (string, error) {
+	groups := make([]string, 0, len(words))
+	for _, alts := range words {
+		q := make([]string, 0, len(alts))
+		for _, a := range alts {
+			t, err := tk.ToQuery(a, lang)
+			if err != nil {
+				return "", err
+			}
+			if t != "" {
+				q = append(q, "("+t+")")
+			}
+		}
+
+		if len(q) > 0 {
+			groups = append(groups, "("+strings.Join(q, " | ")+")")
+		}
+	}
+
+	return strings.Join(groups, " & "), nil
+}
+
+// quoteTSQuery quotes a string as a tsquery lexeme.
+func quoteTSQuery(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return fmt.Sprintf("'%s'", strings.ReplaceAll(s, "'", "''"))
+}
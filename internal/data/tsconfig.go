@@ -0,0 +1,125 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Token types of the default Postgres parser that are words and are mapped to
+// the dictionaries of text search configurations. Other types (eg: numbers,
+// URLs) are mapped to the simple dictionary.
+const tsWordTypes = "asciiword, asciihword, hword_asciipart, word, hword, hword_part"
+
+var reTSName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// TSConfig is a Postgres text search configuration of a language that's
+// created in the DB with the name of the language's (Postgres) tokenizer.
+type TSConfig struct {
+	// Snowball stemmer language (eg: german). Empty for no stemming.
+	Stemmer string `json:"stemmer"`
+
+	// Stopwords file in Postgres' tsearch_data directory without the .stop
+	// extension (eg: german). Empty for no stopwords.
+	Stopwords string `json:"stopwords"`
+
+	// Remove accents (diacritics) from words with the unaccent extension.
+	Unaccent bool `json:"unaccent"`
+}
+
+// Validate validates a text search configuration and its name.
+func (c TSConfig) Validate(name string) error {
+	if !reTSName.MatchString(name) {
+		return fmt.Errorf("invalid tokenizer name '%s' for ts_config. Should be lowercase letters, numbers, and _", name)
+	}
+	if c.Stemmer != "" && !reTSName.MatchString(c.Stemmer) {
+		return fmt.Errorf("invalid ts_config stemmer '%s'", c.Stemmer)
+	}
+	if c.Stopwords != "" && !reTSName.MatchString(c.Stopwords) {
+		return fmt.Errorf("invalid ts_config stopwords '%s'", c.Stopwords)
+	}
+
+	return nil
+}
+
+// SyncTSConfig creates the text search configuration of a language in the DB,
+// or recreates it if its definition has changed since it was created. It
+// returns true if the configuration was (re)created, after which the entries
+// of the language should be reindexed.
+func (d *Data) SyncTSConfig(db *sqlx.DB, name string, c TSConfig) (bool, error) {
+	if err := c.Validate(name); err != nil {
+		return false, err
+	}
+
+	var schema string
+	if err := d.queries.GetTSConfigSchema.Get(&schema, name); err != nil {
+		return false, err
+	}
+	if schema == "pg_catalog" {
+		return false, fmt.Errorf("'%s' is a built-in Postgres text search configuration. Use a different tokenizer name with ts_config", name)
+	}
+
+	// The definition of the configuration when it was last created.
+	key := "ts_config." + name
+	if schema != "" {
+		b, err := d.GetSetting(key)
+		if err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+
+		var old TSConfig
+		if err == nil && json.Unmarshal(b, &old) == nil && old == c {
+			return false, nil
+		}
+	}
+
+	var (
+		cfg   = pq.QuoteIdentifier(name)
+		dict  = pq.QuoteIdentifier(name + "_dict")
+		opt   = "TEMPLATE = pg_catalog.simple"
+		dicts = dict
+	)
+	if c.Stemmer != "" {
+		opt = "TEMPLATE = snowball, Language = " + pq.QuoteLiteral(c.Stemmer)
+	}
+	if c.Stopwords != "" {
+		opt += ", StopWords = " + pq.QuoteLiteral(c.Stopwords)
+	}
+	if c.Unaccent {
+		dicts = "unaccent, " + dict
+	}
+
+	stmts := []string{
+		"DROP TEXT SEARCH CONFIGURATION IF EXISTS " + cfg,
+		"DROP TEXT SEARCH DICTIONARY IF EXISTS " + dict,
+		"CREATE TEXT SEARCH DICTIONARY " + dict + " (" + opt + ")",
+		"CREATE TEXT SEARCH CONFIGURATION " + cfg + " (COPY = pg_catalog.simple)",
+		"ALTER TEXT SEARCH CONFIGURATION " + cfg + " ALTER MAPPING FOR " + tsWordTypes + " WITH " + dicts,
+	}
+	if c.Unaccent {
+		stmts = append([]string{"CREATE EXTENSION IF NOT EXISTS unaccent"}, stmts...)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	for _, s := range stmts {
+		if _, err := tx.Exec(s); err != nil {
+			return false, err
+		}
+	}
+
+	b, _ := json.Marshal(c)
+	if _, err := tx.Stmtx(d.queries.UpsertSetting).Exec(key, string(b)); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
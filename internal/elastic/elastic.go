@@ -0,0 +1,420 @@
+// package elastic implements an optional Elasticsearch / OpenSearch search
+// backend. Postgres remains the source of truth and entries are periodically
+// synced to the search index.
+package elastic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+)
+
+// Opt represents the Elasticsearch backend options.
+type Opt struct {
+	URL          string        `koanf:"url"`
+	Index        string        `koanf:"index"`
+	Username     string        `koanf:"username"`
+	Password     string        `koanf:"password"`
+	SyncInterval time.Duration `koanf:"sync_interval"`
+	SyncLag      time.Duration `koanf:"sync_lag"`
+	BatchSize    int           `koanf:"batch_size"`
+	Timeout      time.Duration `koanf:"timeout"`
+}
+
+// Elastic is an Elasticsearch / OpenSearch search backend.
+type Elastic struct {
+	opt Opt
+	hc  *http.Client
+	lo  *log.Logger
+}
+
+// doc represents an entry document in the search index.
+type doc struct {
+	ID         int      `json:"id"`
+	GUID       string   `json:"guid"`
+	Lang       string   `json:"lang"`
+	Content    string   `json:"content"`
+	Initial    string   `json:"initial"`
+	Tags       []string `json:"tags"`
+	Status     string   `json:"status"`
+	Weight     float64  `json:"weight"`
+	IsHeadword bool     `json:"is_headword"`
+
+	// Languages of the entry's definitions.
+	ToLangs []string `json:"to_langs"`
+}
+
+// Index settings and mappings. content.raw is a lowercased keyword
+// used for boosting exact headword matches.
+const indexMapping = `{
+	"settings": {
+		"analysis": {
+			"normalizer": {
+				"lower": {"type": "custom", "filter": ["lowercase"]}
+			}
+		}
+	},
+	"mappings": {
+		"properties": {
+			"id": {"type": "integer"},
+			"guid": {"type": "keyword"},
+			"lang": {"type": "keyword"},
+			"content": {
+				"type": "text",
+				"fields": {"raw": {"type": "keyword", "normalizer": "lower", "ignore_above": 256}}
+			},
+			"initial": {"type": "keyword"},
+			"tags": {"type": "keyword"},
+			"status": {"type": "keyword"},
+			"weight": {"type": "float"},
+			"is_headword": {"type": "boolean"},
+			"to_langs": {"type": "keyword"}
+		}
+	}
+}`
+
+// Fields added to the mapping after the index was first created, which are
+// added to existing indexes.
+const indexMappingUpdate = `{
+	"properties": {
+		"to_langs": {"type": "keyword"}
+	}
+}`
+
+// New returns a new instance of the Elasticsearch backend.
+func New(o Opt, lo *log.Logger) (*Elastic, error) {
+	if o.BatchSize < 1 {
+		o.BatchSize = 1000
+	}
+	if o.Timeout == 0 {
+		o.Timeout = time.Second * 10
+	}
+	if o.SyncInterval == 0 {
+		o.SyncInterval = time.Minute
+	}
+	if o.SyncLag == 0 {
+		o.SyncLag = time.Minute * 5
+	}
+	if o.SyncInterval < 0 || o.SyncLag < 0 {
+		return nil, fmt.Errorf("invalid sync_interval or sync_lag")
+	}
+
+	return &Elastic{
+		opt: o,
+		hc:  &http.Client{Timeout: o.Timeout},
+		lo:  lo,
+	}, nil
+}
+
+// Init creates the search index if it doesn't exist, or adds new fields to
+// the mapping of an existing index. Entries are (re)indexed with the new
+// fields by the first sync.
+func (e *Elastic) Init() error {
+	code, _, err := e.do(http.MethodHead, "/"+e.opt.Index, nil)
+	if err != nil {
+		return err
+	}
+	if code == http.StatusOK {
+		if _, _, err := e.do(http.MethodPut, "/"+e.opt.Index+"/_mapping", []byte(indexMappingUpdate)); err != nil {
+			return fmt.Errorf("error updating index mapping: %v", err)
+		}
+		return nil
+	}
+
+	if _, _, err := e.do(http.MethodPut, "/"+e.opt.Index, []byte(indexMapping)); err != nil {
+		return fmt.Errorf("error creating index: %v", err)
+	}
+
+	return nil
+}
+
+// Search searches the index and returns the IDs of the matching entries
+// in the order of relevance along with the total number of matches.
+// Queries with params that aren't supported (see data.CheckBackendQuery)
+// are rejected by the caller.
+func (e *Elastic) Search(q data.Query) ([]int, int, error) {
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"is_headword": true}},
+	}
+	if q.FromLang != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"lang": q.FromLang}})
+	}
+	if q.ToLang != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"to_langs": q.ToLang}})
+	}
+	if q.Status != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"status": q.Status}})
+	}
+	if len(q.Tags) > 0 {
+		filters = append(filters, map[string]interface{}{"terms": map[string]interface{}{"tags": q.Tags}})
+	}
+
+	// Match mode. Non-fulltext modes match the lowercased keyword field.
+	var (
+		raw  = strings.ToLower(q.Query)
+		must interface{}
+	)
+	switch q.Match {
+	case data.MatchExact:
+		must = map[string]interface{}{"term": map[string]interface{}{"content.raw": raw}}
+	case data.MatchPrefix:
+		must = map[string]interface{}{"prefix": map[string]interface{}{"content.raw": raw}}
+	case data.MatchSubstring:
+		must = map[string]interface{}{"wildcard": map[string]interface{}{
+			"content.raw": "*" + strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`).Replace(raw) + "*",
+		}}
+	case data.MatchFTS, "":
+		// Multi-word queries are matched as phrases, or with all (the default)
+		// or any of the words, as in the SQL search.
+		switch q.Multiword {
+		case data.MultiwordPhrase:
+			must = map[string]interface{}{"match_phrase": map[string]interface{}{"content": q.Query}}
+		case data.MultiwordOr:
+			must = map[string]interface{}{"match": map[string]interface{}{"content": map[string]interface{}{"query": q.Query, "operator": "or"}}}
+		default:
+			must = map[string]interface{}{"match": map[string]interface{}{"content": map[string]interface{}{"query": q.Query, "operator": "and"}}}
+		}
+	default:
+		return nil, 0, fmt.Errorf("unknown match mode '%s'", q.Match)
+	}
+
+	body := map[string]interface{}{
+		"from":             q.Offset,
+		"size":             q.Limit,
+		"track_total_hits": true,
+		"_source":          []string{"id"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": must,
+				// Rank exact headword matches on top.
+				"should": map[string]interface{}{
+					"term": map[string]interface{}{
+						"content.raw": map[string]interface{}{"value": raw, "boost": 10},
+					},
+				},
+				"filter": filters,
+			},
+		},
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	_, resp, err := e.do(http.MethodPost, "/"+e.opt.Index+"/_search", b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var res struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Source doc `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(resp, &res); err != nil {
+		return nil, 0, fmt.Errorf("error parsing search response: %v", err)
+	}
+
+	ids := make([]int, 0, len(res.Hits.Hits))
+	for _, h := range res.Hits.Hits {
+		ids = append(ids, h.Source.ID)
+	}
+
+	return ids, res.Hits.Total.Value, nil
+}
+
+// Delete deletes the given entry IDs from the index.
+func (e *Elastic) Delete(ids []int) error {
+	var b bytes.Buffer
+	for _, id := range ids {
+		fmt.Fprintf(&b, `{"delete": {"_index": %q, "_id": "%d"}}`+"\n", e.opt.Index, id)
+	}
+
+	_, _, err := e.do(http.MethodPost, "/_bulk", b.Bytes())
+	return err
+}
+
+// Sync indexes all entries that have been updated since the last sync and
+// removes deleted entries from the index every sync_interval. It's a blocking
+// function that should be run as a goroutine. The first sync indexes all entries.
+//
+// updated_at is the start time of the transaction that updated an entry, which
+// may commit after entries with later timestamps have been synced. Every sync
+// re-scans the changes in the sync_lag window before the last position so that
+// such entries are not skipped.
+func (e *Elastic) Sync(d *data.Data) {
+	var (
+		after   = time.Time{}
+		afterID = 0
+
+		deletedAfter   = time.Time{}
+		deletedAfterID = int64(0)
+	)
+
+	for {
+		// Rewind the positions by the lag window.
+		if !after.IsZero() {
+			after, afterID = after.Add(-e.opt.SyncLag), 0
+		}
+		if !deletedAfter.IsZero() {
+			deletedAfter, deletedAfterID = deletedAfter.Add(-e.opt.SyncLag), 0
+		}
+
+		n := 0
+		for {
+			entries, err := d.GetEntriesForIndex(after, afterID, e.opt.BatchSize)
+			if err != nil {
+				e.lo.Printf("error fetching entries for indexing: %v", err)
+				break
+			}
+			if len(entries) == 0 {
+				break
+			}
+
+			if err := e.index(entries); err != nil {
+				e.lo.Printf("error indexing entries: %v", err)
+				break
+			}
+
+			last := entries[len(entries)-1]
+			after, afterID = last.UpdatedAt, last.ID
+			n += len(entries)
+		}
+
+		// Remove deleted entries (including rejected and purged submissions) from the index.
+		nDel := 0
+		for {
+			dels, err := d.GetDeletedEntries(deletedAfter, deletedAfterID, e.opt.BatchSize)
+			if err != nil {
+				e.lo.Printf("error fetching deleted entries: %v", err)
+				break
+			}
+			if len(dels) == 0 {
+				break
+			}
+
+			guids := make([]string, 0, len(dels))
+			for _, del := range dels {
+				guids = append(guids, del.GUID)
+			}
+			if err := e.deleteGUIDs(guids); err != nil {
+				e.lo.Printf("error deleting entries from the index: %v", err)
+				break
+			}
+
+			last := dels[len(dels)-1]
+			deletedAfter, deletedAfterID = last.DeletedAt, last.ID
+			nDel += len(dels)
+		}
+
+		if n > 0 || nDel > 0 {
+			e.lo.Printf("indexed %d entries, deleted %d entries", n, nDel)
+		}
+
+		time.Sleep(e.opt.SyncInterval)
+	}
+}
+
+// deleteGUIDs deletes the entries with the given GUIDs from the index.
+func (e *Elastic) deleteGUIDs(guids []string) error {
+	b, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{"terms": map[string]interface{}{"guid": guids}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, _, err = e.do(http.MethodPost, "/"+e.opt.Index+"/_delete_by_query", b)
+	return err
+}
+
+// index bulk indexes the given entries.
+func (e *Elastic) index(entries []data.IndexEntry) error {
+	var b bytes.Buffer
+	for _, en := range entries {
+		d, err := json.Marshal(doc{
+			ID:         en.ID,
+			GUID:       en.GUID,
+			Lang:       en.Lang,
+			Content:    en.Content,
+			Initial:    en.Initial,
+			Tags:       en.Tags,
+			Status:     en.Status,
+			Weight:     en.Weight,
+			IsHeadword: en.IsHeadword,
+			ToLangs:    en.ToLangs,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&b, `{"index": {"_index": %q, "_id": "%d"}}`+"\n", e.opt.Index, en.ID)
+		b.Write(d)
+		b.WriteByte('\n')
+	}
+
+	_, resp, err := e.do(http.MethodPost, "/_bulk", b.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.Unmarshal(resp, &res); err != nil {
+		return err
+	}
+	if res.Errors {
+		return fmt.Errorf("bulk indexing returned errors: %s", string(resp))
+	}
+
+	return nil
+}
+
+// do makes an HTTP request to the Elasticsearch server and returns the response.
+func (e *Elastic) do(method, path string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(e.opt.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if strings.HasSuffix(path, "/_bulk") {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if e.opt.Username != "" {
+		req.SetBasicAuth(e.opt.Username, e.opt.Password)
+	}
+
+	resp, err := e.hc.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	// HEAD requests for non-existent indexes return 404 which is not an error.
+	if resp.StatusCode >= 400 && method != http.MethodHead {
+		return resp.StatusCode, b, fmt.Errorf("elasticsearch error (%d): %s", resp.StatusCode, string(b))
+	}
+
+	return resp.StatusCode, b, nil
+}
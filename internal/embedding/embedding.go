@@ -0,0 +1,106 @@
+// package embedding implements a client for external text embedding providers
+// (eg: OpenAI, Ollama, llama.cpp, or a custom HTTP hook) that compute the
+// vectors used for semantic search. The provider should expose an OpenAI
+// compatible embeddings endpoint that accepts {"model": "", "input": [""]}
+// and responds with {"data": [{"index": 0, "embedding": [0.1, ...]}]}.
+package embedding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Opt represents the embedding provider options.
+type Opt struct {
+	URL     string        `koanf:"url"`
+	Model   string        `koanf:"model"`
+	APIKey  string        `koanf:"api_key"`
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// Client is an embedding provider client.
+type Client struct {
+	opt Opt
+	hc  *http.Client
+}
+
+type embedReq struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embedResp struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// New returns a new instance of the embedding client.
+func New(o Opt) (*Client, error) {
+	if o.URL == "" {
+		return nil, fmt.Errorf("embedding provider url is empty")
+	}
+	if o.Timeout == 0 {
+		o.Timeout = time.Second * 30
+	}
+
+	return &Client{
+		opt: o,
+		hc:  &http.Client{Timeout: o.Timeout},
+	}, nil
+}
+
+// Embed returns the embedding vectors of the given texts in the same order.
+func (c *Client) Embed(texts []string) ([][]float32, error) {
+	b, err := json.Marshal(embedReq{Model: c.opt.Model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.opt.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.opt.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opt.APIKey)
+	}
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding provider error (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var res embedResp
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("error parsing embedding response: %v", err)
+	}
+	if len(res.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding provider returned %d vectors for %d texts", len(res.Data), len(texts))
+	}
+
+	// Order the vectors by the index of their texts.
+	out := make([][]float32, len(texts))
+	for _, d := range res.Data {
+		if d.Index < 0 || d.Index >= len(out) || len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("invalid embedding at index %d", d.Index)
+		}
+		out[d.Index] = d.Embedding
+	}
+
+	return out, nil
+}
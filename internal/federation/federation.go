@@ -0,0 +1,237 @@
+// package federation implements a client that searches other dictpress
+// instances (peers) over their public search APIs when searches yield no
+// results locally, so that their results can be shown with attribution.
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knadh/dictpress/internal/data"
+)
+
+// Header is set on the search requests sent to peers. Instances don't
+// federate searches with the header so that peers that federate to each
+// other don't loop.
+const Header = "X-Dictpress-Federated"
+
+// Max number of search results that are cached in memory.
+const maxCache = 5000
+
+// Peer represents another dictpress instance.
+type Peer struct {
+	// Name of the peer that's shown with its results.
+	Name string `koanf:"name"`
+
+	// Root URL of the peer, eg: https://dict.example.com.
+	URL string `koanf:"url"`
+
+	// Optional request headers, eg: for API keys.
+	Headers map[string]string `koanf:"headers"`
+
+	// Optional local language IDs mapped to the peer's IDs if they differ,
+	// eg: english = "en".
+	Langs map[string]string `koanf:"langs"`
+}
+
+// Opt represents the federation options.
+type Opt struct {
+	Peers []Peer `koanf:"peers"`
+
+	// Max number of results fetched from every peer.
+	MaxResults int `koanf:"max_results"`
+
+	Timeout  time.Duration `koanf:"timeout"`
+	CacheTTL time.Duration `koanf:"cache_ttl"`
+}
+
+// Result represents the results of a search from a peer.
+type Result struct {
+	Peer string `json:"peer"`
+
+	// URL of the search results page on the peer.
+	URL string `json:"url"`
+
+	Entries []data.Entry `json:"entries"`
+}
+
+// Federation searches peers.
+type Federation struct {
+	opt Opt
+	hc  *http.Client
+	lo  *log.Logger
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	res []Result
+	exp time.Time
+}
+
+// New returns a new instance of the federation client.
+func New(o Opt, lo *log.Logger) (*Federation, error) {
+	if len(o.Peers) == 0 {
+		return nil, fmt.Errorf("no federation peers configured")
+	}
+	for i, p := range o.Peers {
+		u, err := url.Parse(p.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid url '%s' of federation peer '%s'", p.URL, p.Name)
+		}
+		if p.Name == "" {
+			o.Peers[i].Name = u.Host
+		}
+		o.Peers[i].URL = strings.TrimRight(p.URL, "/")
+	}
+	if o.MaxResults < 1 {
+		o.MaxResults = 5
+	}
+	if o.Timeout == 0 {
+		o.Timeout = time.Second * 3
+	}
+
+	return &Federation{
+		opt:   o,
+		hc:    &http.Client{Timeout: o.Timeout},
+		lo:    lo,
+		cache: make(map[string]cached),
+	}, nil
+}
+
+// Search searches all the peers for a query in a dictionary pair concurrently
+// and returns the results of the peers that have any, in the order of the
+// peers. Peers that fail or time out are skipped.
+func (f *Federation) Search(ctx context.Context, q, fromLang, toLang string) []Result {
+	key := fromLang + "\x00" + toLang + "\x00" + q
+	f.mu.Lock()
+	c, ok := f.cache[key]
+	f.mu.Unlock()
+	if ok && time.Now().Before(c.exp) {
+		return c.res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.opt.Timeout)
+	defer cancel()
+
+	var (
+		res = make([]*Result, len(f.opt.Peers))
+		wg  sync.WaitGroup
+	)
+	for i, p := range f.opt.Peers {
+		wg.Add(1)
+		go func(i int, p Peer) {
+			defer wg.Done()
+
+			r, err := f.search(ctx, p, q, fromLang, toLang)
+			if err != nil {
+				f.lo.Printf("error searching federation peer %s: %v", p.Name, err)
+				return
+			}
+			res[i] = r
+		}(i, p)
+	}
+	wg.Wait()
+
+	out := []Result{}
+	for _, r := range res {
+		if r != nil && len(r.Entries) > 0 {
+			out = append(out, *r)
+		}
+	}
+
+	// Results of searches that were cancelled by the caller aren't cached.
+	if f.opt.CacheTTL > 0 && ctx.Err() != context.Canceled {
+		f.mu.Lock()
+		if len(f.cache) >= maxCache {
+			f.cache = make(map[string]cached)
+		}
+		f.cache[key] = cached{res: out, exp: time.Now().Add(f.opt.CacheTTL)}
+		f.mu.Unlock()
+	}
+
+	return out
+}
+
+// search searches a peer.
+func (f *Federation) search(ctx context.Context, p Peer, q, fromLang, toLang string) (*Result, error) {
+	var (
+		from = peerLang(p, fromLang)
+		to   = peerLang(p, toLang)
+		path = "/dictionary/" + url.PathEscape(from) + "/" + url.PathEscape(to) + "/" + url.PathEscape(q)
+	)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		p.URL+"/api/v1"+path+"?per_page="+strconv.Itoa(f.opt.MaxResults), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(Header, "true")
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := f.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("peer error (%d): %s", resp.StatusCode, string(b))
+	}
+
+	var res struct {
+		Data struct {
+			Entries []data.Entry `json:"entries"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("error parsing peer response: %v", err)
+	}
+
+	entries := res.Data.Entries
+	if len(entries) > f.opt.MaxResults {
+		entries = entries[:f.opt.MaxResults]
+	}
+	localLangs(p, entries)
+
+	return &Result{Peer: p.Name, URL: p.URL + path, Entries: entries}, nil
+}
+
+// peerLang returns the peer's ID of a local language.
+func peerLang(p Peer, lang string) string {
+	if l, ok := p.Langs[lang]; ok {
+		return l
+	}
+	return lang
+}
+
+// localLangs replaces the peer's language IDs in entries and their relations
+// with the local IDs.
+func localLangs(p Peer, entries []data.Entry) {
+	if len(p.Langs) == 0 {
+		return
+	}
+
+	for i := range entries {
+		for local, peer := range p.Langs {
+			if entries[i].Lang == peer {
+				entries[i].Lang = local
+				break
+			}
+		}
+		localLangs(p, entries[i].Relations)
+	}
+}
@@ -0,0 +1,259 @@
+// Protobuf schema for the dictpress gRPC API. This mirrors the public
+// REST APIs for high-throughput programmatic consumers.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.24.4
+// source: proto/dictpress.proto
+
+package dictpresspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Dictpress_Search_FullMethodName       = "/dictpress.v1.Dictpress/Search"
+	Dictpress_GetEntry_FullMethodName     = "/dictpress.v1.Dictpress/GetEntry"
+	Dictpress_ListGlossary_FullMethodName = "/dictpress.v1.Dictpress/ListGlossary"
+	Dictpress_Export_FullMethodName       = "/dictpress.v1.Dictpress/Export"
+)
+
+// DictpressClient is the client API for Dictpress service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DictpressClient interface {
+	// Search a dictionary (from_lang -> to_lang) for a query.
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// Get a single entry with its definitions by its GUID.
+	GetEntry(ctx context.Context, in *GetEntryRequest, opts ...grpc.CallOption) (*Entry, error)
+	// List the headwords in a language starting with an initial.
+	ListGlossary(ctx context.Context, in *ListGlossaryRequest, opts ...grpc.CallOption) (*ListGlossaryResponse, error)
+	// Stream every headword of a dictionary with its definitions.
+	Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (Dictpress_ExportClient, error)
+}
+
+type dictpressClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDictpressClient(cc grpc.ClientConnInterface) DictpressClient {
+	return &dictpressClient{cc}
+}
+
+func (c *dictpressClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, Dictpress_Search_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dictpressClient) GetEntry(ctx context.Context, in *GetEntryRequest, opts ...grpc.CallOption) (*Entry, error) {
+	out := new(Entry)
+	err := c.cc.Invoke(ctx, Dictpress_GetEntry_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dictpressClient) ListGlossary(ctx context.Context, in *ListGlossaryRequest, opts ...grpc.CallOption) (*ListGlossaryResponse, error) {
+	out := new(ListGlossaryResponse)
+	err := c.cc.Invoke(ctx, Dictpress_ListGlossary_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dictpressClient) Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (Dictpress_ExportClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Dictpress_ServiceDesc.Streams[0], Dictpress_Export_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &dictpressExportClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Dictpress_ExportClient interface {
+	Recv() (*Entry, error)
+	grpc.ClientStream
+}
+
+type dictpressExportClient struct {
+	grpc.ClientStream
+}
+
+func (x *dictpressExportClient) Recv() (*Entry, error) {
+	m := new(Entry)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DictpressServer is the server API for Dictpress service.
+// All implementations must embed UnimplementedDictpressServer
+// for forward compatibility
+type DictpressServer interface {
+	// Search a dictionary (from_lang -> to_lang) for a query.
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	// Get a single entry with its definitions by its GUID.
+	GetEntry(context.Context, *GetEntryRequest) (*Entry, error)
+	// List the headwords in a language starting with an initial.
+	ListGlossary(context.Context, *ListGlossaryRequest) (*ListGlossaryResponse, error)
+	// Stream every headword of a dictionary with its definitions.
+	Export(*ExportRequest, Dictpress_ExportServer) error
+	mustEmbedUnimplementedDictpressServer()
+}
+
+// UnimplementedDictpressServer must be embedded to have forward compatible implementations.
+type UnimplementedDictpressServer struct {
+}
+
+func (UnimplementedDictpressServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedDictpressServer) GetEntry(context.Context, *GetEntryRequest) (*Entry, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetEntry not implemented")
+}
+func (UnimplementedDictpressServer) ListGlossary(context.Context, *ListGlossaryRequest) (*ListGlossaryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListGlossary not implemented")
+}
+func (UnimplementedDictpressServer) Export(*ExportRequest, Dictpress_ExportServer) error {
+	return status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedDictpressServer) mustEmbedUnimplementedDictpressServer() {}
+
+// UnsafeDictpressServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DictpressServer will
+// result in compilation errors.
+type UnsafeDictpressServer interface {
+	mustEmbedUnimplementedDictpressServer()
+}
+
+func RegisterDictpressServer(s grpc.ServiceRegistrar, srv DictpressServer) {
+	s.RegisterService(&Dictpress_ServiceDesc, srv)
+}
+
+func _Dictpress_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DictpressServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Dictpress_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DictpressServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Dictpress_GetEntry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetEntryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DictpressServer).GetEntry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Dictpress_GetEntry_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DictpressServer).GetEntry(ctx, req.(*GetEntryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Dictpress_ListGlossary_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGlossaryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DictpressServer).ListGlossary(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Dictpress_ListGlossary_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DictpressServer).ListGlossary(ctx, req.(*ListGlossaryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Dictpress_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DictpressServer).Export(m, &dictpressExportServer{stream})
+}
+
+type Dictpress_ExportServer interface {
+	Send(*Entry) error
+	grpc.ServerStream
+}
+
+type dictpressExportServer struct {
+	grpc.ServerStream
+}
+
+func (x *dictpressExportServer) Send(m *Entry) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Dictpress_ServiceDesc is the grpc.ServiceDesc for Dictpress service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Dictpress_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dictpress.v1.Dictpress",
+	HandlerType: (*DictpressServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Search",
+			Handler:    _Dictpress_Search_Handler,
+		},
+		{
+			MethodName: "GetEntry",
+			Handler:    _Dictpress_GetEntry_Handler,
+		},
+		{
+			MethodName: "ListGlossary",
+			Handler:    _Dictpress_ListGlossary_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Export",
+			Handler:       _Dictpress_Export_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/dictpress.proto",
+}
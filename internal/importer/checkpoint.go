@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// checkpoint is the progress of a file import that's recorded with every
+// inserted batch so that a failed import can be resumed by re-running it.
+type checkpoint struct {
+	// Hash of the file's contents and the import's params.
+	key  string
+	name string
+
+	// Number of rows (records) of the file and main entries that were
+	// imported before this run. The rows are skipped.
+	rows    int
+	entries int
+
+	stmt *sqlx.Stmt
+}
+
+// WithCheckpoints enables the checkpointing of file imports. Re-running an
+// import of the same file with the same params resumes it after the last
+// imported batch, and a file that has been fully imported isn't imported
+// again, unless restart is set, which imports the file from the beginning.
+func (im *Importer) WithCheckpoints(stmtGet, stmtUpsert *sqlx.Stmt, restart bool) *Importer {
+	im.stmtGetCheckpoint = stmtGet
+	im.stmtUpsertCheckpoint = stmtUpsert
+	im.restart = restart
+	return im
+}
+
+// loadCheckpoint loads the checkpoint of the import of a file with the given
+// params. It returns true if the file has already been imported.
+func (im *Importer) loadCheckpoint(fp *os.File, params ...string) (bool, error) {
+	im.cp = nil
+	if im.stmtGetCheckpoint == nil || im.dryRun {
+		return false, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return false, fmt.Errorf("error reading file %s: %v", fp.Name(), err)
+	}
+	if _, err := fp.Seek(0, io.SeekStart); err != nil {
+		return false, fmt.Errorf("error reading file %s: %v", fp.Name(), err)
+	}
+	for _, p := range params {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+
+	im.cp = &checkpoint{
+		key:  hex.EncodeToString(h.Sum(nil)),
+		name: filepath.Base(fp.Name()),
+		stmt: im.stmtUpsertCheckpoint,
+	}
+	if im.restart {
+		return false, nil
+	}
+
+	var c struct {
+		Rows    int  `db:"rows"`
+		Entries int  `db:"entries"`
+		Done    bool `db:"done"`
+	}
+	if err := im.stmtGetCheckpoint.Get(&c, im.cp.key); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("error fetching import checkpoint: %v", err)
+	}
+
+	if c.Done {
+		im.lo.Printf("%s has already been imported. skipping. Import it again with the restart option", im.cp.name)
+		return true, nil
+	}
+	if c.Rows > 0 {
+		im.lo.Printf("resuming the import of %s after row %d (%d entries)", im.cp.name, c.Rows, c.Entries)
+	}
+	im.cp.rows, im.cp.entries = c.Rows, c.Entries
+
+	return false, nil
+}
+
+// imported checks whether a row of the file was imported by a previous run
+// of the import, and should be skipped.
+func (im *Importer) imported(row int) bool {
+	return im.cp != nil && row <= im.cp.rows
+}
+
+// finishCheckpoint marks the import of the file as done.
+func (im *Importer) finishCheckpoint(rows, entries int) error {
+	if im.cp == nil || im.dryRun {
+		return nil
+	}
+
+	if err := im.cp.save(nil, rows, entries, true); err != nil {
+		return fmt.Errorf("error saving import checkpoint: %v", err)
+	}
+	return nil
+}
+
+// save records the number of rows of the file and main entries that have been
+// imported, in the given transaction if it's set.
+func (c *checkpoint) save(tx *sqlx.Tx, rows, entries int, done bool) error {
+	stmt := c.stmt
+	if tx != nil {
+		stmt = tx.Stmtx(c.stmt)
+	}
+
+	_, err := stmt.Exec(c.key, c.name, rows, entries, done)
+	return err
+}
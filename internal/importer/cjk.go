@@ -0,0 +1,391 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Relation tag for definitions that are cross-references to other headwords.
+const tagXref = "xref"
+
+var (
+	// CC-CEDICT line: Traditional Simplified [pin1 yin1] /gloss 1/gloss 2/
+	reCedictLine = regexp.MustCompile(`^(\S+)\s+(\S+)\s+\[([^\]]*)\]\s+/(.*)/\s*$`)
+
+	// Glosses that refer to other headwords, eg: variant of 個|个[ge4]
+	reCedictXref = regexp.MustCompile(`^(?:see also|see|(?:old |archaic )?variant of|also written|abbr\. for|same as)\s+([^\s\[,;]+)(?:\[([^\]]*)\])?`)
+)
+
+// JMdict gloss languages (ISO 639-2/B) by their common names and ISO 639-1 codes
+// that dictpress language IDs are matched against.
+var jmdictLangs = map[string]string{
+	"english": "eng", "en": "eng",
+	"german": "ger", "de": "ger",
+	"french": "fre", "fr": "fre",
+	"russian": "rus", "ru": "rus",
+	"dutch": "dut", "nl": "dut",
+	"hungarian": "hun", "hu": "hun",
+	"spanish": "spa", "es": "spa",
+	"slovenian": "slv", "sl": "slv",
+	"swedish": "swe", "sv": "swe",
+}
+
+// jmEntry represents an <entry> in a JMdict XML file.
+type jmEntry struct {
+	Kanji []struct {
+		Keb string `xml:"keb"`
+	} `xml:"k_ele"`
+	Readings []struct {
+		Reb string `xml:"reb"`
+	} `xml:"r_ele"`
+	Senses []struct {
+		POS     []string `xml:"pos"`
+		Xrefs   []string `xml:"xref"`
+		Misc    []string `xml:"misc"`
+		Glosses []struct {
+			Lang string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+			Text string `xml:",chardata"`
+		} `xml:"gloss"`
+	} `xml:"sense"`
+}
+
+// ImportCEDICT imports a CC-CEDICT dictionary file into the DB. Simplified
+// headwords are imported as main entries in fromLang with the pinyin reading
+// as the phone and the traditional form in meta, and glosses are imported as
+// definitions in toLang. Cross-reference glosses (see, variant of etc.) are
+// imported as definitions in fromLang tagged `xref`.
+func (im *Importer) ImportCEDICT(filePath, fromLang, toLang string) error {
+	if err := im.checkLangs(fromLang, toLang); err != nil {
+		return err
+	}
+
+	fp, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("error opening file %s: %v", filePath, err)
+	}
+	defer fp.Close()
+
+	if done, err := im.loadCheckpoint(fp, "cedict", fromLang, toLang); err != nil || done {
+		return err
+	}
+
+	var (
+		b       = im.newPipeline()
+		n       = 0
+		skipped = 0
+	)
+	defer b.close()
+
+	sc := bufio.NewScanner(fp)
+	for sc.Scan() {
+		n++
+		if im.imported(n) {
+			continue
+		}
+
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		m := reCedictLine.FindStringSubmatch(line)
+		if m == nil {
+			skipped++
+			continue
+		}
+
+		num := n
+		if err := b.add(n, func() (entry, bool, error) {
+			e, ok, err := im.cedictEntry(m, fromLang, toLang)
+			if err != nil {
+				return e, false, fmt.Errorf("error reading line %d: %v", num, err)
+			}
+			return e, ok, nil
+		}); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("error reading file %s: %v", filePath, err)
+	}
+
+	return b.finish(n, skipped)
+}
+
+// cedictEntry converts a CC-CEDICT line's submatches (traditional, simplified,
+// pinyin, glosses) into a main entry with definitions.
+func (im *Importer) cedictEntry(m []string, fromLang, toLang string) (entry, bool, error) {
+	trad, simp, pinyin, glosses := m[1], m[2], m[3], strings.Split(m[4], "/")
+
+	e, err := im.newEntry(typeEntry, simp, fromLang)
+	if err != nil {
+		return e, false, err
+	}
+	if pinyin != "" {
+		e.Phones = []string{pinyin}
+	}
+
+	meta := map[string]interface{}{}
+	if trad != simp {
+		meta["traditional"] = trad
+	}
+
+	for _, g := range glosses {
+		g = cleanString(g)
+		if g == "" {
+			continue
+		}
+
+		// Measure words (classifiers) go into meta.
+		if strings.HasPrefix(g, "CL:") {
+			meta["classifiers"] = strings.Split(strings.TrimPrefix(g, "CL:"), ",")
+			continue
+		}
+
+		if x := reCedictXref.FindStringSubmatch(g); x != nil {
+			// Traditional|Simplified
+			word := x[1]
+			if i := strings.Index(word, "|"); i >= 0 {
+				word = word[i+1:]
+			}
+
+			d, err := im.newEntry(typeDef, word, fromLang)
+			if err != nil {
+				return e, false, err
+			}
+			if x[2] != "" {
+				d.Phones = []string{x[2]}
+			}
+			d.Tags = []string{tagXref}
+			d.Notes = g
+			e.defs = append(e.defs, d)
+			continue
+		}
+
+		d, err := im.newEntry(typeDef, g, toLang)
+		if err != nil {
+			return e, false, err
+		}
+		e.defs = append(e.defs, d)
+	}
+
+	if len(e.defs) == 0 {
+		return e, false, nil
+	}
+
+	if len(meta) > 0 {
+		mb, _ := json.Marshal(meta)
+		e.Meta = string(mb)
+	}
+
+	return e, true, nil
+}
+
+// ImportJMdict imports a JMdict (or JMnedict) XML file into the DB. The first
+// kanji form (or the first reading if there's none) of every entry is imported
+// as a main entry in fromLang with the kana readings as phones. Glosses in toLang
+// are imported as definitions in toLang with the JMdict part of speech codes (eg: n, v1)
+// as the definition types if they are configured for the language. Cross-references
+// are imported as definitions in fromLang tagged `xref`.
+func (im *Importer) ImportJMdict(filePath, fromLang, toLang string) error {
+	if err := im.checkLangs(fromLang, toLang); err != nil {
+		return err
+	}
+
+	glossLang, err := jmdictLang(toLang)
+	if err != nil {
+		return err
+	}
+
+	fp, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("error opening file %s: %v", filePath, err)
+	}
+	defer fp.Close()
+
+	if done, err := im.loadCheckpoint(fp, "jmdict", fromLang, toLang); err != nil || done {
+		return err
+	}
+
+	var (
+		b = im.newPipeline()
+		n = 0
+	)
+	defer b.close()
+
+	// JMdict uses entities declared in its DTD (eg: &n;) for codes, which
+	// the non-strict decoder retains as literal text.
+	dec := xml.NewDecoder(bufio.NewReader(fp))
+	dec.Strict = false
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("error reading file %s: %v", filePath, err)
+		}
+
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "entry" {
+			continue
+		}
+
+		// Entries are the rows of JMdict.
+		n++
+		if im.imported(n) {
+			if err := dec.Skip(); err != nil {
+				return fmt.Errorf("error reading file %s: %v", filePath, err)
+			}
+			continue
+		}
+
+		var j jmEntry
+		if err := dec.DecodeElement(&j, &se); err != nil {
+			return fmt.Errorf("error reading entry: %v", err)
+		}
+
+		if err := b.add(n, func() (entry, bool, error) {
+			return im.jmdictEntry(j, fromLang, toLang, glossLang)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return b.finish(n, 0)
+}
+
+// jmdictEntry converts a JMdict entry into a main entry with definitions.
+// Only glosses in glossLang (JMdict language code) are imported.
+func (im *Importer) jmdictEntry(j jmEntry, fromLang, toLang, glossLang string) (entry, bool, error) {
+	var content string
+	if len(j.Kanji) > 0 {
+		content = j.Kanji[0].Keb
+	} else if len(j.Readings) > 0 {
+		content = j.Readings[0].Reb
+	}
+	if content == "" {
+		return entry{}, false, nil
+	}
+
+	e, err := im.newEntry(typeEntry, content, fromLang)
+	if err != nil {
+		return e, false, err
+	}
+	for _, r := range j.Readings {
+		e.Phones = append(e.Phones, r.Reb)
+	}
+
+	// Alternate kanji forms go into meta.
+	if len(j.Kanji) > 1 {
+		forms := make([]string, 0, len(j.Kanji)-1)
+		for _, k := range j.Kanji[1:] {
+			forms = append(forms, k.Keb)
+		}
+		mb, _ := json.Marshal(map[string]interface{}{"forms": forms})
+		e.Meta = string(mb)
+	}
+
+	// Part of speech in JMdict applies to all subsequent senses until it's redefined.
+	var pos []string
+	for _, s := range j.Senses {
+		if len(s.POS) > 0 {
+			pos = s.POS
+		}
+
+		var glosses []string
+		for _, g := range s.Glosses {
+			// Glosses without a language are English.
+			l := g.Lang
+			if l == "" {
+				l = "eng"
+			}
+			if l == glossLang {
+				glosses = append(glosses, cleanString(g.Text))
+			}
+		}
+
+		if len(glosses) > 0 {
+			d, err := im.newEntry(typeDef, strings.Join(glosses, "; "), toLang)
+			if err != nil {
+				return e, false, err
+			}
+			d.DefTypes = im.jmdictTypes(pos, toLang)
+			for _, m := range s.Misc {
+				d.Tags = append(d.Tags, jmdictCode(m))
+			}
+			e.defs = append(e.defs, d)
+		}
+
+		// Cross-references are of the form keb・reb・sense number.
+		for _, x := range s.Xrefs {
+			word := strings.Split(x, "・")[0]
+			if word == "" {
+				continue
+			}
+
+			d, err := im.newEntry(typeDef, word, fromLang)
+			if err != nil {
+				return e, false, err
+			}
+			d.Tags = []string{tagXref}
+			e.defs = append(e.defs, d)
+		}
+	}
+
+	return e, len(e.defs) > 0, nil
+}
+
+// jmdictTypes returns the JMdict part of speech codes that are configured as
+// definition types for the language.
+func (im *Importer) jmdictTypes(pos []string, lang string) []string {
+	out := []string{}
+	for _, p := range pos {
+		p = jmdictCode(p)
+		if _, ok := im.langs[lang].Types[p]; ok {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
+
+// jmdictCode converts a JMdict entity (eg: &v1;) retained by the XML decoder into its code (v1).
+func jmdictCode(s string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "&"), ";")
+}
+
+// jmdictLang returns the JMdict gloss language code for a definition language.
+// The language ID can either be a language name (eg: german), or an ISO 639-1
+// or JMdict (ISO 639-2/B) code.
+func jmdictLang(lang string) (string, error) {
+	l := strings.ToLower(lang)
+	if code, ok := jmdictLangs[l]; ok {
+		return code, nil
+	}
+	for _, code := range jmdictLangs {
+		if code == l {
+			return code, nil
+		}
+	}
+
+	return "", fmt.Errorf("JMdict has no glosses in the definition language '%s'", lang)
+}
+
+// checkLangs checks if the from and to languages of an importer are configured.
+func (im *Importer) checkLangs(fromLang, toLang string) error {
+	for _, l := range []string{fromLang, toLang} {
+		if _, ok := im.langs[l]; !ok {
+			return fmt.Errorf("unknown language '%s'. Set the headword and definition languages with --import-langs", l)
+		}
+	}
+
+	return nil
+}
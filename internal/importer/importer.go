@@ -2,6 +2,7 @@
 package importer
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -12,7 +13,6 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/knadh/dictpress/internal/data"
-	"github.com/lib/pq"
 )
 
 const (
@@ -48,6 +48,13 @@ type entry struct {
 	DefTypes       []string // 9 - Only read in definition entries (0=^)
 	Meta           string   // 10
 
+	// Normalized content if the language has normalization.
+	Normalized string
+
+	// ID of an existing entry that a definition links to instead of
+	// inserting (or reusing) an entry with its content.
+	id int
+
 	defs []entry
 }
 
@@ -55,41 +62,87 @@ type entry struct {
 type Importer struct {
 	langs data.LangMap
 
-	db              *sqlx.DB
-	stmtInsertEntry *sqlx.Stmt
-	stmtInsertRel   *sqlx.Stmt
-	lo              *log.Logger
+	// If set, entries are only read and validated, and not inserted.
+	dryRun bool
+
+	// Cancelling the context stops the import before the next batch.
+	ctx context.Context
+
+	db         *sqlx.DB
+	stmtImport *sqlx.Stmt
+	lo         *log.Logger
+
+	// Number of workers that parse and insert batches in parallel (see WithWorkers).
+	workers int
+
+	// Optional checkpointing of file imports (see WithCheckpoints) and the
+	// checkpoint of the file being imported.
+	stmtGetCheckpoint    *sqlx.Stmt
+	stmtUpsertCheckpoint *sqlx.Stmt
+	restart              bool
+	cp                   *checkpoint
 }
 
 var (
 	reSpaces, _ = regexp.Compile("\\s+")
 )
 
-// New returns a new instance of the CSV importer.
-func New(langs data.LangMap, stmtInsertEntry *sqlx.Stmt, stmtInsertRel *sqlx.Stmt, db *sqlx.DB, lo *log.Logger) *Importer {
+// New returns a new instance of the CSV importer. stmtImport inserts the
+// batches of entries that are copied into the import_stage table.
+func New(langs data.LangMap, stmtImport *sqlx.Stmt, db *sqlx.DB, dryRun bool, lo *log.Logger) *Importer {
 	return &Importer{
-		langs:           langs,
-		stmtInsertEntry: stmtInsertEntry,
-		stmtInsertRel:   stmtInsertRel,
-		db:              db,
-		lo:              lo,
+		langs:      langs,
+		dryRun:     dryRun,
+		stmtImport: stmtImport,
+		db:         db,
+		lo:         lo,
+		ctx:        context.Background(),
 	}
 }
 
+// WithContext sets a context that stops the import before inserting the next
+// batch of entries when it's cancelled.
+func (im *Importer) WithContext(ctx context.Context) *Importer {
+	im.ctx = ctx
+	return im
+}
+
 // Import imports a CSV file into the DB.
 func (im *Importer) Import(filePath string) error {
 	fp, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("error opening file %s: %v", filePath, err)
 	}
+	defer fp.Close()
+
+	if done, err := im.loadCheckpoint(fp, "csv"); err != nil || done {
+		return err
+	}
 
 	var (
-		// Holds all main entries.
-		entries []entry
-		n       = 0
-		numMain = 0
-		numDefs = 0
+		b = im.newPipeline()
+		n = 0
+
+		// Rows of the main entry being read and its definitions.
+		cur [][]string
 	)
+	defer b.close()
+
+	// Adds the main entry read till the given row to the pipeline.
+	flush := func(rows int) error {
+		if len(cur) == 0 {
+			return nil
+		}
+
+		var (
+			rs   = cur
+			line = rows - len(rs) + 1
+		)
+		cur = nil
+		return b.add(rows, func() (entry, bool, error) {
+			return im.readEntries(rs, line)
+		})
+	}
 
 	rd := csv.NewReader(fp)
 	rd.FieldsPerRecord = -1
@@ -108,49 +161,45 @@ func (im *Importer) Import(filePath string) error {
 		}
 		n++
 
-		e, err := im.readEntry(row)
-		if err != nil {
-			return fmt.Errorf("error reading line %d: %v", n, err)
-		}
-
-		// First entry is always a main entry.
-		if len(entries) == 0 {
-			entries = append(entries, e)
+		// Skip the rows imported by a previous run of the import.
+		if im.imported(n) {
 			continue
 		}
 
-		// Add all definitions to the last main entry in the list.
-		if e.Type == typeDef {
-			i := len(entries) - 1
-			entries[i].defs = append(entries[i].defs, e)
-			numDefs++
-			continue
+		// A new main entry. Definitions are added to the last main entry.
+		if cleanString(row[0]) != typeDef {
+			if err := flush(n - 1); err != nil {
+				return err
+			}
 		}
+		cur = append(cur, row)
+	}
 
-		// On hitting the batchsize, insert to DB.
-		if len(entries)%insertBatchSize == 0 {
-			if err := im.insertEntries(entries, numMain); err != nil {
-				return fmt.Errorf("error inserting entries to DB: %v", err)
-			}
+	if err := flush(n); err != nil {
+		return err
+	}
 
-			numMain += len(entries)
-			entries = []entry{}
+	return b.finish(n, 0)
+}
 
-			im.lo.Printf("imported %d entries and %d definitions", numMain, numDefs)
+// readEntries reads the rows of a main entry followed by the rows of its
+// definitions, starting at the given line of the file.
+func (im *Importer) readEntries(rows [][]string, line int) (entry, bool, error) {
+	var out entry
+	for i, r := range rows {
+		e, err := im.readEntry(r)
+		if err != nil {
+			return out, false, fmt.Errorf("error reading line %d: %v", line+i, err)
 		}
 
-		// New main entry.
-		entries = append(entries, e)
-	}
-
-	if len(entries) > 0 {
-		if err := im.insertEntries(entries, numMain); err != nil {
-			return fmt.Errorf("error inserting entries to DB: %v", err)
+		if i == 0 {
+			out = e
+			continue
 		}
+		out.defs = append(out.defs, e)
 	}
 
-	im.lo.Printf("finished. imported %d entries and %d definitions", numMain+len(entries), numDefs)
-	return nil
+	return out, true, nil
 }
 
 // initial, content, lang, notes, tsvector_language, [tokens|], [tags|], [pronunciations|]
@@ -175,6 +224,7 @@ func (im *Importer) readEntry(r []string) (entry, error) {
 	if len(r) != colCount {
 		return e, fmt.Errorf("every line should have exactly %d columns. Found %d", colCount, len(r))
 	}
+	e.Meta = r[10]
 
 	lang, ok := im.langs[e.Lang]
 	if !ok {
@@ -186,13 +236,19 @@ func (im *Importer) readEntry(r []string) (entry, error) {
 	}
 
 	if e.Initial == "" {
-		e.Initial = strings.ToUpper(string(e.Content[0]))
+		e.Initial = data.Initial(e.Content)
 	}
 
 	// If the Postgres tokenizer is not set, and there are no tokens supplied,
-	// see if the language has a custom one and use it.
+	// see if the language has a custom one and use it. If the language has
+	// normalization, the normalized content is tokenized.
+	e.Normalized = lang.Normalized(e.Content)
 	if lang.Tokenizer != nil && e.TSVectorLang == "" && e.TSVectorTokens == "" {
-		tks, err := lang.Tokenizer.ToTokens(e.Content, lang.ID)
+		content := e.Content
+		if e.Normalized != "" {
+			content = e.Normalized
+		}
+		tks, err := lang.Tokenizer.ToTokens(content, lang.ID)
 		if err != nil {
 			return e, fmt.Errorf("error tokenizing content (word) at column 1: %v", err)
 		}
@@ -223,95 +279,6 @@ func (im *Importer) readEntry(r []string) (entry, error) {
 	return e, nil
 }
 
-func (im *Importer) insertEntries(entries []entry, lineStart int) error {
-	var (
-		tx   *sqlx.Tx
-		stmt *sqlx.Stmt
-		err  error
-	)
-
-	// Insert entries.
-	entryIDs := make([]int, len(entries))
-	if tx, err = im.db.Beginx(); err != nil {
-		return err
-	}
-	stmt = tx.Stmtx(im.stmtInsertEntry)
-	for i, e := range entries {
-		if err := stmt.Get(&entryIDs[i],
-			e.Content,
-			e.Initial,
-			lineStart,
-			e.TSVectorTokens,
-			e.TSVectorLang,
-			e.Lang,
-			pq.StringArray(e.Tags),
-			pq.StringArray(e.Phones),
-			e.Notes,
-			data.StatusEnabled); err != nil {
-			return err
-		}
-		lineStart++
-	}
-
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
-	// Insert definition entries and collect their IDs for every main entry.
-	relIDs := make([][]int, len(entries))
-
-	if tx, err = im.db.Beginx(); err != nil {
-		return err
-	}
-	stmt = tx.Stmtx(im.stmtInsertEntry)
-
-	// Iterate through all main entries again, inserting their definition entries.
-	for i, mainEntry := range entries {
-		relIDs[i] = make([]int, len(mainEntry.defs))
-
-		for j, e := range mainEntry.defs {
-			// Insert the definition entry and record the resulting ID
-			// against the parent ID.
-			if err := stmt.Get(&relIDs[i][j],
-				e.Content,
-				e.Initial,
-				i+j,
-				e.TSVectorTokens,
-				e.TSVectorLang,
-				e.Lang,
-				pq.StringArray{},
-				pq.StringArray(e.Phones),
-				"",
-				data.StatusEnabled); err != nil {
-				return err
-			}
-		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
-	// Insert relationships.
-	if tx, err = im.db.Beginx(); err != nil {
-		return err
-	}
-	stmt = tx.Stmtx(im.stmtInsertRel)
-	for i, defIDs := range relIDs {
-		for j, toID := range defIDs {
-			d := entries[i].defs[j]
-			if _, err := stmt.Exec(entryIDs[i], toID, pq.StringArray(d.DefTypes), pq.StringArray(d.Tags), d.Notes, j, data.StatusEnabled); err != nil {
-				return err
-			}
-		}
-	}
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func cleanString(s string) string {
 	return reSpaces.ReplaceAllString(strings.TrimSpace(s), " ")
 }
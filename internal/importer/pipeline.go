@@ -0,0 +1,317 @@
+package importer
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Columns of the import_stage table that batches are copied into.
+var stageCols = []string{"seq", "pos", "entry_id", "content", "initial", "weight", "tokens", "tokenizer",
+	"lang", "tags", "phones", "notes", "meta", "normalized", "types", "rel_tags", "rel_notes"}
+
+// record is a record (row) of an import file that's parsed into a main entry
+// with its definitions by a pipeline worker. ok is false if the record should
+// be skipped.
+type record func() (e entry, ok bool, err error)
+
+// batch is a batch of records that's parsed and inserted by a worker.
+type batch struct {
+	// Sequence of the batch in the import.
+	seq     int
+	records []record
+
+	// Number of rows of the file read till the last record of the batch,
+	// which is checkpointed with the batch.
+	rows int
+}
+
+// pipeline parses records into entries and inserts them into the DB in
+// batches with a pool of workers. The workers parse (and tokenize) their
+// batches and copy them into the DB's staging table in parallel. The staged
+// batches are then inserted one at a time in the order they were read so that
+// entries that repeat across batches (eg: common definitions) are deduplicated,
+// and the import's checkpoint covers all the preceding batches.
+type pipeline struct {
+	im      *Importer
+	cur     *batch
+	batches chan *batch
+	wg      sync.WaitGroup
+	closed  bool
+
+	// Sequence of the next batch to insert, the first error, and the counts
+	// of the inserted batches, guarded by mu.
+	mu      sync.Mutex
+	turn    *sync.Cond
+	next    int
+	err     error
+	numMain int
+	numDefs int
+	skipped int
+}
+
+// WithWorkers sets the number of workers that parse and insert batches of
+// entries in parallel. It defaults to the number of CPUs and is capped at
+// the DB's max open connections, as every worker holds a connection.
+func (im *Importer) WithWorkers(n int) *Importer {
+	im.workers = n
+	return im
+}
+
+// newPipeline starts a new pipeline with the importer's workers.
+func (im *Importer) newPipeline() *pipeline {
+	n := im.workers
+	if n < 1 {
+		n = runtime.NumCPU()
+	}
+	if max := im.db.Stats().MaxOpenConnections; max > 0 && n > max {
+		n = max
+	}
+
+	p := &pipeline{
+		im:      im,
+		cur:     &batch{},
+		batches: make(chan *batch, n),
+	}
+	p.turn = sync.NewCond(&p.mu)
+	if im.cp != nil {
+		p.numMain = im.cp.entries
+	}
+
+	p.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// add adds a record that's read till the given row of the file to the
+// current batch, and sends the batch to the workers on hitting the batch size.
+func (p *pipeline) add(rows int, r record) error {
+	if err := p.failed(); err != nil {
+		return err
+	}
+
+	p.cur.records = append(p.cur.records, r)
+	p.cur.rows = rows
+	if len(p.cur.records) < insertBatchSize {
+		return nil
+	}
+
+	p.batches <- p.cur
+	p.cur = &batch{seq: p.cur.seq + 1}
+	return nil
+}
+
+// finish inserts the remaining records, waits for the workers to finish, and
+// marks the import of the file that has the given number of rows as done.
+// skipped is the number of records that were skipped before adding them.
+func (p *pipeline) finish(rows, skipped int) error {
+	if len(p.cur.records) > 0 && p.failed() == nil {
+		p.batches <- p.cur
+	}
+	p.close()
+
+	if p.err != nil {
+		return p.err
+	}
+	if err := p.im.finishCheckpoint(rows, p.numMain); err != nil {
+		return err
+	}
+
+	p.im.lo.Printf("finished. imported %d entries and %d definitions. skipped %d",
+		p.numMain, p.numDefs, p.skipped+skipped)
+	return nil
+}
+
+// close stops the workers after the batches sent to them are done. It should
+// be deferred by importers to stop the workers when they return early.
+func (p *pipeline) close() {
+	if p.closed {
+		return
+	}
+	p.closed = true
+
+	close(p.batches)
+	p.wg.Wait()
+}
+
+// work parses and inserts batches till the pipeline is closed. After an error,
+// the remaining batches are discarded.
+func (p *pipeline) work() {
+	defer p.wg.Done()
+
+	for b := range p.batches {
+		if p.failed() != nil {
+			continue
+		}
+
+		if err := p.insert(b); err != nil {
+			p.mu.Lock()
+			if p.err == nil {
+				p.err = err
+			}
+			p.turn.Broadcast()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// insert parses a batch, copies it into the staging table, and inserts it
+// from there after the preceding batches have been inserted, along with the
+// import's checkpoint, in a single transaction.
+func (p *pipeline) insert(b *batch) error {
+	if err := p.im.ctx.Err(); err != nil {
+		return err
+	}
+
+	var (
+		entries = make([]entry, 0, len(b.records))
+		skipped = 0
+		numDefs = 0
+	)
+	for _, r := range b.records {
+		e, ok, err := r()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+
+		entries = append(entries, e)
+		numDefs += len(e.defs)
+	}
+
+	var tx *sqlx.Tx
+	if !p.im.dryRun && len(entries) > 0 {
+		var err error
+		if tx, err = p.im.db.Beginx(); err != nil {
+			return fmt.Errorf("error inserting entries to DB: %v", err)
+		}
+		defer tx.Rollback()
+
+		if err := stageEntries(tx, entries); err != nil {
+			return fmt.Errorf("error inserting entries to DB: %v", err)
+		}
+	}
+
+	// Wait for the preceding batches to be inserted.
+	p.mu.Lock()
+	for p.next != b.seq && p.err == nil {
+		p.turn.Wait()
+	}
+	err, numMain := p.err, p.numMain
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		if _, err := tx.Stmtx(p.im.stmtImport).Exec(numMain); err != nil {
+			return fmt.Errorf("error inserting entries to DB: %v", err)
+		}
+
+		if p.im.cp != nil && b.rows > 0 {
+			if err := p.im.cp.save(tx, b.rows, numMain+len(entries), false); err != nil {
+				return fmt.Errorf("error saving import checkpoint: %v", err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error inserting entries to DB: %v", err)
+		}
+	}
+
+	p.mu.Lock()
+	p.numMain += len(entries)
+	p.numDefs += numDefs
+	p.skipped += skipped
+	p.next++
+	p.im.lo.Printf("imported %d entries and %d definitions", p.numMain, p.numDefs)
+	p.turn.Broadcast()
+	p.mu.Unlock()
+
+	return nil
+}
+
+// failed returns the first error of the workers, if any.
+func (p *pipeline) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
+
+// stageEntries copies a batch of main entries and their definitions into the
+// import_stage table with COPY. seq is the position of the main entry in the
+// batch and pos is 0 for main entries and 1..N for their definitions.
+func stageEntries(tx *sqlx.Tx, entries []entry) error {
+	stmt, err := tx.Prepare(pq.CopyIn("import_stage", stageCols...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, e := range entries {
+		if _, err := stmt.Exec(i, 0, 0,
+			e.Content,
+			e.Initial,
+			i,
+			e.TSVectorTokens,
+			e.TSVectorLang,
+			e.Lang,
+			strArray(e.Tags),
+			strArray(e.Phones),
+			e.Notes,
+			e.Meta,
+			e.Normalized,
+			pq.StringArray{}, pq.StringArray{}, ""); err != nil {
+			return err
+		}
+
+		for j, d := range e.defs {
+			if d.Meta == "" {
+				d.Meta = "{}"
+			}
+
+			if _, err := stmt.Exec(i, j+1, d.id,
+				d.Content,
+				d.Initial,
+				i+j,
+				d.TSVectorTokens,
+				d.TSVectorLang,
+				d.Lang,
+				pq.StringArray{},
+				strArray(d.Phones),
+				"",
+				d.Meta,
+				d.Normalized,
+				strArray(d.DefTypes), strArray(d.Tags), d.Notes); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Flush the copied rows.
+	if _, err := stmt.Exec(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// strArray returns a Postgres array of strings that's empty and not NULL
+// for nil slices.
+func strArray(s []string) pq.StringArray {
+	if s == nil {
+		return pq.StringArray{}
+	}
+
+	return pq.StringArray(s)
+}
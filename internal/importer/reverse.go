@@ -0,0 +1,140 @@
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/knadh/dictpress/internal/data"
+)
+
+// TagGenerated is the tag of the headwords and definitions generated from
+// the definitions of the other direction of a dictionary.
+const TagGenerated = "auto-generated"
+
+// Max words in a definition for it to be inverted into a headword. Longer
+// definitions are descriptions and not translations.
+const reverseMaxWords = 3
+
+// Parenthesized and bracketed notes in definitions, eg: (informal).
+var reReverseNotes = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+
+// ReverseFunc returns a batch of the definitions (in toLang) of headwords (in
+// fromLang) after the given relation ID, ordered by relation ID.
+type ReverseFunc func(afterID int) ([]data.ReverseDef, error)
+
+// GenerateReverse generates the toLang -> fromLang dictionary from the
+// definitions of the fromLang -> toLang dictionary. Every short definition
+// (or its comma or semicolon separated terms) is inverted into a headword in
+// toLang that's defined by the headword it was a definition of. Existing
+// headwords with the same content are reused and the new headwords and all
+// the generated definitions are tagged TagGenerated so that they can be
+// reviewed and edited. Definitions that were themselves generated aren't
+// reversed again and re-running the generation doesn't duplicate definitions.
+func (im *Importer) GenerateReverse(fromLang, toLang string, next ReverseFunc) error {
+	if err := im.checkLangs(fromLang, toLang); err != nil {
+		return err
+	}
+	if fromLang == toLang {
+		return fmt.Errorf("the headword and definition languages should be different")
+	}
+
+	var (
+		b       = im.newPipeline()
+		afterID = 0
+		skipped = 0
+	)
+	defer b.close()
+
+	for {
+		if err := im.ctx.Err(); err != nil {
+			return err
+		}
+
+		defs, err := next(afterID)
+		if err != nil {
+			return fmt.Errorf("error fetching definitions: %v", err)
+		}
+		if len(defs) == 0 {
+			break
+		}
+		afterID = defs[len(defs)-1].RelationID
+
+		for _, d := range defs {
+			terms := reverseTerms(d.Content)
+			if len(terms) == 0 {
+				skipped++
+				continue
+			}
+
+			for _, t := range terms {
+				var (
+					term = t
+					def  = d
+				)
+				if err := b.add(0, func() (entry, bool, error) {
+					e, err := im.newEntry(typeEntry, term, toLang)
+					if err != nil {
+						return e, false, err
+					}
+					e.Tags = []string{TagGenerated}
+					e.defs = []entry{{
+						Type:     typeDef,
+						Lang:     fromLang,
+						DefTypes: im.reverseTypes(def.Types, toLang),
+						Tags:     []string{TagGenerated},
+						id:       def.FromID,
+					}}
+
+					return e, true, nil
+				}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return b.finish(0, skipped)
+}
+
+// reverseTerms returns the terms in a definition that can be headwords: the
+// comma, semicolon, or slash separated parts of the definition without notes
+// in parentheses that have up to reverseMaxWords words.
+func reverseTerms(s string) []string {
+	s = reReverseNotes.ReplaceAllString(s, "")
+
+	var (
+		out  []string
+		seen = map[string]bool{}
+	)
+	for _, t := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == '/'
+	}) {
+		t = cleanString(strings.TrimRight(strings.TrimSpace(t), ".!?"))
+		if t == "" || len(strings.Fields(t)) > reverseMaxWords {
+			continue
+		}
+
+		k := strings.ToLower(t)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, t)
+	}
+
+	return out
+}
+
+// reverseTypes returns the definition types (parts of speech) of a definition
+// that are configured in the language of the generated headword.
+func (im *Importer) reverseTypes(types []string, lang string) []string {
+	out := []string{}
+	for _, t := range types {
+		if _, ok := im.langs[lang].Types[t]; ok {
+			out = append(out, t)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,218 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// wiktWord represents a single word+part-of-speech line in a Wiktextract
+// (https://github.com/tatuylonen/wiktextract) JSONL dump.
+type wiktWord struct {
+	Word     string `json:"word"`
+	Lang     string `json:"lang"`
+	LangCode string `json:"lang_code"`
+	POS      string `json:"pos"`
+	Etym     string `json:"etymology_text"`
+
+	Senses []struct {
+		Glosses []string `json:"glosses"`
+		Tags    []string `json:"tags"`
+	} `json:"senses"`
+
+	Sounds []struct {
+		IPA string `json:"ipa"`
+	} `json:"sounds"`
+
+	Translations []struct {
+		Lang  string `json:"lang"`
+		Code  string `json:"code"`
+		Word  string `json:"word"`
+		Sense string `json:"sense"`
+	} `json:"translations"`
+}
+
+// ImportWiktextract imports a Wiktextract JSONL dump into the DB. Every line is imported
+// as a main entry with its senses as definitions in the same language and its
+// translations as definitions in other languages. Wiktionary languages are matched
+// to the configured languages by their names or IDs and words in other languages
+// are skipped. If filterLangs is given, only main entries in those languages are imported.
+func (im *Importer) ImportWiktextract(filePath string, filterLangs []string) error {
+	fp, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("error opening file %s: %v", filePath, err)
+	}
+	defer fp.Close()
+
+	// Wiktionary language name/code => configured language ID.
+	langMap := make(map[string]string)
+	for id, l := range im.langs {
+		langMap[strings.ToLower(id)] = id
+		langMap[strings.ToLower(l.Name)] = id
+	}
+
+	filter := make(map[string]bool)
+	for _, l := range filterLangs {
+		if _, ok := im.langs[l]; !ok {
+			return fmt.Errorf("unknown language '%s' in the filter", l)
+		}
+		filter[l] = true
+	}
+
+	if done, err := im.loadCheckpoint(fp, append([]string{"wiktextract"}, filterLangs...)...); err != nil || done {
+		return err
+	}
+
+	var (
+		b = im.newPipeline()
+		n = 0
+	)
+	defer b.close()
+
+	sc := bufio.NewScanner(fp)
+	sc.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	for sc.Scan() {
+		n++
+		if im.imported(n) {
+			continue
+		}
+
+		var (
+			line = n
+			buf  = append([]byte(nil), sc.Bytes()...)
+		)
+		if err := b.add(n, func() (entry, bool, error) {
+			var w wiktWord
+			if err := json.Unmarshal(buf, &w); err != nil {
+				return entry{}, false, fmt.Errorf("error reading line %d: %v", line, err)
+			}
+
+			lang := matchLang(langMap, w.Lang, w.LangCode)
+			if lang == "" || (len(filter) > 0 && !filter[lang]) || strings.TrimSpace(w.Word) == "" {
+				return entry{}, false, nil
+			}
+
+			e, err := im.wiktEntry(w, lang, langMap)
+			if err != nil {
+				return e, false, fmt.Errorf("error reading line %d: %v", line, err)
+			}
+
+			return e, len(e.defs) > 0, nil
+		}); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("error reading file %s: %v", filePath, err)
+	}
+
+	return b.finish(n, 0)
+}
+
+// wiktEntry converts a Wiktextract word into a main entry with definitions.
+func (im *Importer) wiktEntry(w wiktWord, lang string, langMap map[string]string) (entry, error) {
+	e, err := im.newEntry(typeEntry, w.Word, lang)
+	if err != nil {
+		return e, err
+	}
+
+	for _, s := range w.Sounds {
+		if s.IPA != "" {
+			e.Phones = append(e.Phones, s.IPA)
+		}
+	}
+
+	if w.Etym != "" {
+		b, _ := json.Marshal(map[string]string{"etymology": w.Etym})
+		e.Meta = string(b)
+	}
+
+	// Senses are definitions in the same language.
+	for _, s := range w.Senses {
+		if len(s.Glosses) == 0 {
+			continue
+		}
+
+		d, err := im.newEntry(typeDef, strings.Join(s.Glosses, "; "), lang)
+		if err != nil {
+			return e, err
+		}
+		d.DefTypes = im.wiktTypes(w.POS, lang)
+		d.Tags = append(d.Tags, s.Tags...)
+		e.defs = append(e.defs, d)
+	}
+
+	// Translations are definitions in other configured languages.
+	for _, t := range w.Translations {
+		toLang := matchLang(langMap, t.Lang, t.Code)
+		if toLang == "" || toLang == lang || strings.TrimSpace(t.Word) == "" {
+			continue
+		}
+
+		d, err := im.newEntry(typeDef, t.Word, toLang)
+		if err != nil {
+			return e, err
+		}
+		d.DefTypes = im.wiktTypes(w.POS, toLang)
+		d.Notes = cleanString(t.Sense)
+		e.defs = append(e.defs, d)
+	}
+
+	return e, nil
+}
+
+// newEntry returns a new entry in a language with its search tokens.
+func (im *Importer) newEntry(typ, content, lang string) (entry, error) {
+	l := im.langs[lang]
+
+	e := entry{
+		Type:    typ,
+		Content: cleanString(content),
+		Lang:    lang,
+		Tags:    []string{},
+		Phones:  []string{},
+		Meta:    "{}",
+	}
+
+	r, _ := utf8.DecodeRuneInString(e.Content)
+	e.Initial = strings.ToUpper(string(r))
+	e.Normalized = l.Normalized(e.Content)
+
+	if l.Tokenizer != nil {
+		content := e.Content
+		if e.Normalized != "" {
+			content = e.Normalized
+		}
+		tks, err := l.Tokenizer.ToTokens(content, l.ID)
+		if err != nil {
+			return e, fmt.Errorf("error tokenizing '%s': %v", e.Content, err)
+		}
+		e.TSVectorTokens = strings.Join(tks, " ")
+	} else {
+		e.TSVectorLang = l.TokenizerName
+	}
+
+	return e, nil
+}
+
+// wiktTypes returns the Wiktionary part of speech as a definition type
+// if the language has it configured.
+func (im *Importer) wiktTypes(pos, lang string) []string {
+	if _, ok := im.langs[lang].Types[pos]; ok {
+		return []string{pos}
+	}
+
+	return []string{}
+}
+
+// matchLang returns the configured language ID for a Wiktionary language name or code.
+func matchLang(langMap map[string]string, name, code string) string {
+	if l, ok := langMap[strings.ToLower(name)]; ok {
+		return l
+	}
+
+	return langMap[strings.ToLower(code)]
+}
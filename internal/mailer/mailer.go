@@ -0,0 +1,158 @@
+// package mailer implements a minimal SMTP client for sending plain text
+// e-mails, eg: login links to site visitors.
+package mailer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TLS modes of the connection to the SMTP server.
+const (
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSTLS      = "tls"
+)
+
+// Opt represents the SMTP server options.
+type Opt struct {
+	Host     string `koanf:"host"`
+	Port     int    `koanf:"port"`
+	Username string `koanf:"username"`
+	Password string `koanf:"password"`
+
+	// none|starttls|tls
+	TLS string `koanf:"tls"`
+
+	// Sender address, eg: "Dictionary <noreply@site.com>".
+	From string `koanf:"from"`
+
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// Mailer sends e-mails via an SMTP server.
+type Mailer struct {
+	opt  Opt
+	from *mail.Address
+}
+
+// New returns a new Mailer.
+func New(o Opt) (*Mailer, error) {
+	if o.Host == "" {
+		return nil, errors.New("no SMTP host")
+	}
+
+	from, err := mail.ParseAddress(o.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address '%s': %v", o.From, err)
+	}
+
+	switch o.TLS {
+	case "":
+		o.TLS = TLSStartTLS
+	case TLSNone, TLSStartTLS, TLSTLS:
+	default:
+		return nil, fmt.Errorf("unknown tls '%s'. Should be none|starttls|tls", o.TLS)
+	}
+
+	if o.Port == 0 {
+		o.Port = 587
+		if o.TLS == TLSTLS {
+			o.Port = 465
+		}
+	}
+	if o.Timeout == 0 {
+		o.Timeout = time.Second * 10
+	}
+
+	return &Mailer{opt: o, from: from}, nil
+}
+
+// Send sends a plain text e-mail to an address.
+func (m *Mailer) Send(to, subject, body string) error {
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid address '%s': %v", to, err)
+	}
+
+	var (
+		addr   = net.JoinHostPort(m.opt.Host, strconv.Itoa(m.opt.Port))
+		dialer = &net.Dialer{Timeout: m.opt.Timeout}
+		tlsCfg = &tls.Config{ServerName: m.opt.Host}
+		conn   net.Conn
+	)
+	if m.opt.TLS == TLSTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsCfg)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(m.opt.Timeout))
+
+	c, err := smtp.NewClient(conn, m.opt.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.opt.TLS == TLSStartTLS {
+		if err := c.StartTLS(tlsCfg); err != nil {
+			return err
+		}
+	}
+	if m.opt.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.opt.Username, m.opt.Password, m.opt.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(m.from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(rcpt.Address); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.message(rcpt, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// message returns the headers and body of an e-mail message.
+func (m *Mailer) message(to *mail.Address, subject, body string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + m.from.String() + "\r\n")
+	b.WriteString("To: " + to.String() + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+
+	// Lines beginning with a dot are escaped by the SMTP client's data writer.
+	for _, l := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		b.WriteString(l + "\r\n")
+	}
+
+	return []byte(b.String())
+}
@@ -0,0 +1,318 @@
+// Package markdown renders a small, safe subset of Markdown that's useful in
+// dictionary definitions to HTML: paragraphs, line breaks, bulleted and
+// numbered lists, blockquotes, **strong**, *emphasis*, `code`, and links.
+// Raw HTML in the source is escaped and never passed through. URLs in links
+// aren't checked and the output should be run through a sanitizer policy.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	reUL = regexp.MustCompile(`^\s{0,3}[-*+]\s+`)
+	reOL = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+`)
+	reBQ = regexp.MustCompile(`^\s{0,3}>\s?`)
+)
+
+// Block types.
+const (
+	blockPara = iota
+	blockUL
+	blockOL
+	blockQuote
+)
+
+type block struct {
+	typ   int
+	lines []string
+}
+
+// ToHTML renders Markdown to HTML.
+func ToHTML(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+
+	var b strings.Builder
+	for _, bl := range parseBlocks(strings.Split(src, "\n")) {
+		switch bl.typ {
+		case blockPara:
+			b.WriteString("<p>" + renderLines(bl.lines) + "</p>")
+		case blockUL, blockOL:
+			tag := "ul"
+			if bl.typ == blockOL {
+				tag = "ol"
+			}
+			b.WriteString("<" + tag + ">")
+			for _, l := range bl.lines {
+				b.WriteString("<li>" + renderInline(l) + "</li>")
+			}
+			b.WriteString("</" + tag + ">")
+		case blockQuote:
+			b.WriteString("<blockquote>" + ToHTML(strings.Join(bl.lines, "\n")) + "</blockquote>")
+		}
+	}
+
+	return b.String()
+}
+
+// parseBlocks groups lines into blocks. Blank lines separate paragraphs, and
+// lines that don't begin a list item are continuations of the previous item.
+func parseBlocks(lines []string) []block {
+	var (
+		out []block
+		cur *block
+	)
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			cur = nil
+			continue
+		}
+
+		typ, text := blockPara, l
+		if m := reUL.FindString(l); m != "" {
+			typ, text = blockUL, l[len(m):]
+		} else if m := reOL.FindString(l); m != "" {
+			typ, text = blockOL, l[len(m):]
+		} else if m := reBQ.FindString(l); m != "" {
+			typ, text = blockQuote, l[len(m):]
+		}
+
+		switch {
+		case cur != nil && typ == blockPara && (cur.typ == blockUL || cur.typ == blockOL):
+			// Lazy continuation of a list item.
+			cur.lines[len(cur.lines)-1] += " " + strings.TrimSpace(text)
+		case cur != nil && (typ == cur.typ || (typ == blockPara && cur.typ == blockQuote)):
+			cur.lines = append(cur.lines, text)
+		default:
+			out = append(out, block{typ: typ, lines: []string{text}})
+			cur = &out[len(out)-1]
+		}
+	}
+
+	return out
+}
+
+// renderLines renders the lines of a paragraph. Lines ending in two spaces or
+// a backslash are hard line breaks.
+func renderLines(lines []string) string {
+	var b strings.Builder
+	for i, l := range lines {
+		brk := false
+		if strings.HasSuffix(l, "  ") {
+			brk = true
+		} else if strings.HasSuffix(l, `\`) && !strings.HasSuffix(l, `\\`) {
+			brk = true
+			l = l[:len(l)-1]
+		}
+
+		b.WriteString(renderInline(strings.TrimSpace(l)))
+		if i < len(lines)-1 {
+			if brk {
+				b.WriteString("<br>")
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+// renderInline renders inline formatting in a line of text.
+func renderInline(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch c {
+		case '\\':
+			// Escaped punctuation.
+			if i+1 < len(s) && strings.IndexByte("\\`*_[]()<>#+-.!|~", s[i+1]) >= 0 {
+				b.WriteString(html.EscapeString(s[i+1 : i+2]))
+				i += 2
+				continue
+			}
+
+		case '`':
+			n := runLen(s, i, '`')
+			if end := strings.Index(s[i+n:], s[i:i+n]); end >= 0 {
+				code := strings.TrimSpace(s[i+n : i+n+end])
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += n + end + n
+				continue
+			}
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case '*', '_':
+			n := runLen(s, i, c)
+			if n > 2 {
+				n = 2
+			}
+			if end := findCloser(s, i, n, c); end > 0 {
+				tag := "em"
+				if n == 2 {
+					tag = "strong"
+				}
+				b.WriteString("<" + tag + ">" + renderInline(s[i+n:end]) + "</" + tag + ">")
+				i = end + n
+				continue
+			}
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case '[':
+			if text, url, title, n := parseLink(s[i:]); n > 0 {
+				b.WriteString(`<a href="` + html.EscapeString(url) + `"`)
+				if title != "" {
+					b.WriteString(` title="` + html.EscapeString(title) + `"`)
+				}
+				b.WriteString(">" + renderInline(text) + "</a>")
+				i += n
+				continue
+			}
+
+		case '<':
+			// Autolinks, eg: <https://example.com>.
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				u := s[i+1 : i+end]
+				if (strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")) && !strings.ContainsAny(u, " <") {
+					b.WriteString(`<a href="` + html.EscapeString(u) + `">` + html.EscapeString(u) + `</a>`)
+					i += end + 1
+					continue
+				}
+			}
+		}
+
+		b.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+
+	return b.String()
+}
+
+// runLen returns the number of consecutive c bytes from s[i].
+func runLen(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// findCloser returns the position of the emphasis delimiter run of length n
+// that closes the one at s[i], or -1. Openers can't be followed by and closers
+// can't be preceded by whitespace, and underscores within words (eg: snake_case)
+// aren't delimiters.
+func findCloser(s string, i, n int, c byte) int {
+	if i+n >= len(s) || isSpaceAt(s, i+n) {
+		return -1
+	}
+	if c == '_' && i > 0 && isWordBefore(s, i) {
+		return -1
+	}
+
+	for j := i + n; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '`':
+			// Emphasis doesn't close inside code spans.
+			m := runLen(s, j, '`')
+			if end := strings.Index(s[j+m:], s[j:j+m]); end >= 0 {
+				j += m + end + m - 1
+			}
+			continue
+		case c:
+		default:
+			continue
+		}
+
+		m := runLen(s, j, c)
+		if m >= n && !isSpaceAt(s, j-1) && j > i+n {
+			// Surplus delimiters in the closing run close the ones opened
+			// within, eg: **a *b***.
+			k := j
+			if m > n && strings.IndexByte(s[i+n:j], c) >= 0 {
+				k = j + m - n
+			}
+			if c == '_' && k+n < len(s) && isWordAfter(s, k+n) {
+				j += m - 1
+				continue
+			}
+			return k
+		}
+		j += m - 1
+	}
+
+	return -1
+}
+
+// parseLink parses a [text](url "title") link at the beginning of s and
+// returns its parts and length, or 0 if it isn't a link.
+func parseLink(s string) (string, string, string, int) {
+	depth := 0
+	end := -1
+	for i := 0; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				end = i
+			}
+		}
+	}
+	if end < 0 || end+1 >= len(s) || s[end+1] != '(' {
+		return "", "", "", 0
+	}
+
+	rp := strings.IndexByte(s[end+2:], ')')
+	if rp < 0 {
+		return "", "", "", 0
+	}
+
+	var (
+		text  = s[1:end]
+		dest  = strings.TrimSpace(s[end+2 : end+2+rp])
+		url   = dest
+		title = ""
+	)
+	if i := strings.IndexAny(dest, " \t"); i > 0 {
+		url = dest[:i]
+		t := strings.TrimSpace(dest[i:])
+		if len(t) >= 2 && t[0] == '"' && t[len(t)-1] == '"' {
+			title = t[1 : len(t)-1]
+		}
+	}
+	url = strings.TrimSuffix(strings.TrimPrefix(url, "<"), ">")
+
+	return text, url, title, end + 2 + rp + 1
+}
+
+func isSpaceAt(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return unicode.IsSpace(r)
+}
+
+func isWordBefore(s string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+func isWordAfter(s string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
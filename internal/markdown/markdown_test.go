@@ -0,0 +1,64 @@
+package markdown
+
+import "testing"
+
+func TestToHTML(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{"empty", "", ""},
+		{"paragraph", "a cat", "<p>a cat</p>"},
+		{"paragraphs", "one\n\ntwo", "<p>one</p><p>two</p>"},
+		{"soft break", "one\ntwo", "<p>one\ntwo</p>"},
+		{"hard break spaces", "one  \ntwo", "<p>one<br>\ntwo</p>"},
+		{"hard break backslash", "one\\\ntwo", "<p>one<br>\ntwo</p>"},
+		{"crlf", "one\r\n\r\ntwo", "<p>one</p><p>two</p>"},
+
+		// Lists and blockquotes.
+		{"bulleted list", "- one\n* two\n+ three", "<ul><li>one</li><li>two</li><li>three</li></ul>"},
+		{"numbered list", "1. one\n2) two", "<ol><li>one</li><li>two</li></ol>"},
+		{"list continuation", "- one\n  more\n- two", "<ul><li>one more</li><li>two</li></ul>"},
+		{"paragraph and list", "para\n\n- one", "<p>para</p><ul><li>one</li></ul>"},
+		{"blockquote", "> quoted\n> text", "<blockquote><p>quoted\ntext</p></blockquote>"},
+		{"blockquote lazy", "> quoted\ntext", "<blockquote><p>quoted\ntext</p></blockquote>"},
+		{"blockquote list", "> - one", "<blockquote><ul><li>one</li></ul></blockquote>"},
+
+		// Inline formatting.
+		{"strong", "a **bold** word", "<p>a <strong>bold</strong> word</p>"},
+		{"emphasis", "an *italic* and _italic_ word", "<p>an <em>italic</em> and <em>italic</em> word</p>"},
+		{"nested", "**bold *italic***", "<p><strong>bold <em>italic</em></strong></p>"},
+		{"surplus closer", "*a**", "<p><em>a</em>*</p>"},
+		{"snake case", "snake_case_word", "<p>snake_case_word</p>"},
+		{"unclosed", "a *b", "<p>a *b</p>"},
+		{"spaced delimiters", "a * b * c", "<p>a * b * c</p>"},
+		{"code", "use `a < b` here", "<p>use <code>a &lt; b</code> here</p>"},
+		{"code with backticks", "``a ` b``", "<p><code>a ` b</code></p>"},
+		{"no emphasis in code", "`*a*`", "<p><code>*a*</code></p>"},
+		{"escaped", `\*not italic\*`, "<p>*not italic*</p>"},
+
+		// Links.
+		{"link", "[cat](https://example.com/cat)", `<p><a href="https://example.com/cat">cat</a></p>`},
+		{"link title", `[cat](/word/cat "A cat")`, `<p><a href="/word/cat" title="A cat">cat</a></p>`},
+		{"link formatting", "[**cat**](/cat)", `<p><a href="/cat"><strong>cat</strong></a></p>`},
+		{"link quotes", `[x](/a?b="c")`, `<p><a href="/a?b=&#34;c&#34;">x</a></p>`},
+		{"not a link", "[cat] (x)", "<p>[cat] (x)</p>"},
+		{"autolink", "<https://example.com>", `<p><a href="https://example.com">https://example.com</a></p>`},
+
+		// Raw HTML is escaped.
+		{"html", "<b>x</b>", "<p>&lt;b&gt;x&lt;/b&gt;</p>"},
+		{"script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"html in link text", "[<img src=x>](/a)", `<p><a href="/a">&lt;img src=x&gt;</a></p>`},
+		{"attribute breakout", `[x](/a"onclick="alert(1))`, `<p><a href="/a&#34;onclick=&#34;alert(1">x</a>)</p>`},
+		{"entities", "a &amp; b", "<p>a &amp;amp; b</p>"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ToHTML(c.in); got != c.out {
+				t.Errorf("ToHTML(%q)\ngot:  %q\nwant: %q", c.in, got, c.out)
+			}
+		})
+	}
+}
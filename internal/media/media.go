@@ -0,0 +1,173 @@
+// package media stores uploaded media files (images) in a directory on disk
+// or in an S3 bucket and generates image thumbnails.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// Image decoders.
+	_ "image/gif"
+
+	"github.com/knadh/dictpress/internal/s3"
+)
+
+// Store represents a media store.
+type Store interface {
+	// Put stores a file and returns its public URL.
+	Put(name, contentType string, b []byte) (string, error)
+
+	// Delete deletes a file.
+	Delete(name string) error
+}
+
+// Filesystem stores files in a directory on disk that's served on a URI.
+type Filesystem struct {
+	dir string
+	uri string
+}
+
+// S3 stores files in an S3 bucket under a key prefix.
+type S3 struct {
+	c      *s3.Client
+	prefix string
+	url    string
+}
+
+// NewFilesystem returns a Store that stores files in a directory, creating it
+// if it doesn't exist.
+func NewFilesystem(dir, uri string) (*Filesystem, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Filesystem{dir: dir, uri: strings.TrimRight(uri, "/")}, nil
+}
+
+// Put writes a file to the directory.
+func (f *Filesystem) Put(name, contentType string, b []byte) (string, error) {
+	if err := os.WriteFile(filepath.Join(f.dir, filepath.Base(name)), b, 0644); err != nil {
+		return "", err
+	}
+
+	return f.uri + "/" + name, nil
+}
+
+// Delete deletes a file from the directory.
+func (f *Filesystem) Delete(name string) error {
+	err := os.Remove(filepath.Join(f.dir, filepath.Base(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// NewS3 returns a Store that uploads files to an S3 bucket under a key prefix.
+// url is the public URL of the bucket that file URLs begin with.
+func NewS3(c *s3.Client, prefix, url string) *S3 {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3{c: c, prefix: prefix, url: strings.TrimRight(url, "/")}
+}
+
+// Put uploads a file to the bucket.
+func (s *S3) Put(name, contentType string, b []byte) (string, error) {
+	if err := s.c.Put(s.prefix+name, contentType, b); err != nil {
+		return "", err
+	}
+
+	return s.url + "/" + s.prefix + name, nil
+}
+
+// Delete deletes a file from the bucket.
+func (s *S3) Delete(name string) error {
+	return s.c.Delete(s.prefix + name)
+}
+
+// Thumbnail decodes a JPEG, PNG, or GIF image and returns a thumbnail scaled
+// down to the given width (JPEG for JPEG images and PNG for others), its
+// content type, and the dimensions of the original image. Images narrower than
+// the width are re-encoded as they are.
+func Thumbnail(b []byte, width int) ([]byte, string, image.Point, error) {
+	src, format, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", image.Point{}, fmt.Errorf("error decoding image: %v", err)
+	}
+
+	var (
+		size = src.Bounds().Size()
+		img  = src
+	)
+	if size.X > width {
+		h := size.Y * width / size.X
+		if h < 1 {
+			h = 1
+		}
+		img = scale(src, width, h)
+	}
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), "image/jpeg", size, err
+	}
+
+	err = png.Encode(&buf, img)
+	return buf.Bytes(), "image/png", size, err
+}
+
+// scale scales down an image to the given dimensions by averaging the source
+// pixels that fall into each destination pixel.
+func scale(src image.Image, w, h int) image.Image {
+	var (
+		b   = src.Bounds()
+		sw  = b.Dx()
+		sh  = b.Dy()
+		out = image.NewRGBA64(image.Rect(0, 0, w, h))
+	)
+
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*sh/h
+		y1 := b.Min.Y + (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*sw/w
+			x1 := b.Min.X + (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+
+			out.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n),
+			})
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,644 @@
+package migrations
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/knadh/koanf/v2"
+	"github.com/knadh/stuffbin"
+)
+
+// V2_1_0 performs the DB migrations.
+func V2_1_0(db *sqlx.DB, fs stuffbin.FileSystem, ko *koanf.Koanf) error {
+	if _, err := db.Exec(`ALTER TABLE entries ADD COLUMN IF NOT EXISTS clicks INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_entries_updated_at ON entries(updated_at, id)`); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS editor_comments (
+			id              SERIAL PRIMARY KEY,
+			entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			author          TEXT NOT NULL DEFAULT '',
+			comments        TEXT NOT NULL CHECK (comments <> ''),
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_editor_comments_entry ON editor_comments(entry_id);
+	`); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'user_role') THEN
+				CREATE TYPE user_role AS ENUM ('admin', 'editor', 'reviewer', 'readonly');
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'user_status') THEN
+				CREATE TYPE user_status AS ENUM ('enabled', 'disabled');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS users (
+			id              SERIAL PRIMARY KEY,
+			username        TEXT NOT NULL UNIQUE CHECK (username <> ''),
+			password        TEXT NOT NULL,
+			name            TEXT NOT NULL DEFAULT '',
+			role            user_role NOT NULL DEFAULT 'readonly',
+			status          user_status NOT NULL DEFAULT 'enabled',
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id              BIGSERIAL PRIMARY KEY,
+			username        TEXT NOT NULL DEFAULT '',
+			method          TEXT NOT NULL,
+			endpoint        TEXT NOT NULL,
+			entity          TEXT NOT NULL DEFAULT '',
+			entity_id       INTEGER NOT NULL DEFAULT 0,
+			before          JSONB NOT NULL DEFAULT 'null',
+			after           JSONB NOT NULL DEFAULT 'null',
+			ip              TEXT NOT NULL DEFAULT '',
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity, entity_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_username ON audit_log(username);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+	`); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS deleted_entries (
+			id              BIGSERIAL PRIMARY KEY,
+			guid            UUID NOT NULL,
+			lang            TEXT NOT NULL,
+			deleted_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_deleted_entries_deleted_at ON deleted_entries(deleted_at, id);
+
+		CREATE OR REPLACE FUNCTION log_deleted_entry() RETURNS TRIGGER AS $$
+		BEGIN
+			INSERT INTO deleted_entries (guid, lang) VALUES (OLD.guid, OLD.lang);
+			RETURN OLD;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS trg_log_deleted_entry ON entries;
+		CREATE TRIGGER trg_log_deleted_entry AFTER DELETE ON entries FOR EACH ROW EXECUTE PROCEDURE log_deleted_entry();
+
+		-- Changes to relations (definitions) mark their parent entries as updated.
+		-- The triggers run per statement so that bulk inserts and reorders touch every
+		-- parent entry only once.
+		CREATE OR REPLACE FUNCTION touch_relation_entry() RETURNS TRIGGER AS $$
+		BEGIN
+			IF TG_OP = 'INSERT' THEN
+				UPDATE entries SET updated_at = NOW() WHERE id IN (SELECT from_id FROM new_rows);
+			ELSIF TG_OP = 'UPDATE' THEN
+				UPDATE entries SET updated_at = NOW() WHERE id IN (SELECT from_id FROM new_rows UNION SELECT from_id FROM old_rows);
+			ELSE
+				UPDATE entries SET updated_at = NOW() WHERE id IN (SELECT from_id FROM old_rows);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS trg_touch_relation_entry ON relations;
+		DROP TRIGGER IF EXISTS trg_touch_relation_entry_insert ON relations;
+		DROP TRIGGER IF EXISTS trg_touch_relation_entry_update ON relations;
+		DROP TRIGGER IF EXISTS trg_touch_relation_entry_delete ON relations;
+		CREATE TRIGGER trg_touch_relation_entry_insert AFTER INSERT ON relations
+			REFERENCING NEW TABLE AS new_rows FOR EACH STATEMENT EXECUTE PROCEDURE touch_relation_entry();
+		CREATE TRIGGER trg_touch_relation_entry_update AFTER UPDATE ON relations
+			REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows FOR EACH STATEMENT EXECUTE PROCEDURE touch_relation_entry();
+		CREATE TRIGGER trg_touch_relation_entry_delete AFTER DELETE ON relations
+			REFERENCING OLD TABLE AS old_rows FOR EACH STATEMENT EXECUTE PROCEDURE touch_relation_entry();
+	`); err != nil {
+		return err
+	}
+
+	// Entry slugs. Existing entries get slugs from their content with duplicates
+	// in a language suffixed with their IDs before the slug trigger is created.
+	if _, err := db.Exec(`
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS slug TEXT NOT NULL DEFAULT '';
+
+		CREATE TABLE IF NOT EXISTS entry_slugs (
+			lang            TEXT NOT NULL,
+			slug            TEXT NOT NULL,
+			entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+			PRIMARY KEY (lang, slug)
+		);
+
+		CREATE OR REPLACE FUNCTION make_slug(s TEXT) RETURNS TEXT AS $$
+			SELECT COALESCE(NULLIF(TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(s), '[[:space:][:punct:]]+', '-', 'g')), ''), 'entry');
+		$$ LANGUAGE SQL IMMUTABLE;
+
+		DROP TRIGGER IF EXISTS trg_set_entry_slug ON entries;
+		UPDATE entries SET slug = s.slug || (CASE WHEN s.n > 1 THEN '-' || entries.id ELSE '' END)
+			FROM (
+				SELECT id, make_slug(content) AS slug, ROW_NUMBER() OVER (PARTITION BY lang, make_slug(content) ORDER BY id) AS n
+				FROM entries
+			) s
+			WHERE entries.id = s.id AND entries.slug = '';
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_entries_slug ON entries(lang, slug);
+
+		CREATE OR REPLACE FUNCTION set_entry_slug() RETURNS TRIGGER AS $$
+		BEGIN
+			-- If the slug from the content is taken, the entry's ID is appended to it.
+			-- The advisory lock serializes concurrent inserts of the same slug until
+			-- their transactions end.
+			IF NEW.slug = '' OR (TG_OP = 'UPDATE' AND NEW.lang != OLD.lang AND NEW.slug = OLD.slug) THEN
+				NEW.slug := make_slug(NEW.content);
+				PERFORM PG_ADVISORY_XACT_LOCK(HASHTEXT(NEW.lang || '/' || NEW.slug));
+				IF EXISTS (SELECT 1 FROM entries WHERE lang = NEW.lang AND slug = NEW.slug AND id != NEW.id) THEN
+					NEW.slug := NEW.slug || '-' || NEW.id;
+				END IF;
+			END IF;
+
+			IF TG_OP = 'UPDATE' AND OLD.slug != '' AND (NEW.slug != OLD.slug OR NEW.lang != OLD.lang) THEN
+				INSERT INTO entry_slugs (lang, slug, entry_id) VALUES (OLD.lang, OLD.slug, OLD.id)
+					ON CONFLICT (lang, slug) DO UPDATE SET entry_id = EXCLUDED.entry_id, created_at = NOW();
+			END IF;
+
+			-- A slug in use can't redirect elsewhere.
+			DELETE FROM entry_slugs WHERE lang = NEW.lang AND slug = NEW.slug;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER trg_set_entry_slug BEFORE INSERT OR UPDATE OF content, lang, slug ON entries FOR EACH ROW EXECUTE PROCEDURE set_entry_slug();
+	`); err != nil {
+		return err
+	}
+
+	// Trigram index for substring and prefix (ILIKE) search and an index for
+	// case insensitive exact search.
+	if _, err := db.Exec(`
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		CREATE INDEX IF NOT EXISTS idx_entries_content_trgm ON entries USING GIN(content gin_trgm_ops);
+		CREATE INDEX IF NOT EXISTS idx_entries_content_lower ON entries(lang, LOWER(content));
+	`); err != nil {
+		return err
+	}
+
+	// Structured labels on definitions.
+	if _, err := db.Exec(`
+		ALTER TABLE relations ADD COLUMN IF NOT EXISTS gender TEXT NOT NULL DEFAULT '';
+		ALTER TABLE relations ADD COLUMN IF NOT EXISTS register TEXT NOT NULL DEFAULT '';
+		ALTER TABLE relations ADD COLUMN IF NOT EXISTS domains TEXT[] NOT NULL DEFAULT '{}';
+	`); err != nil {
+		return err
+	}
+
+	// Usage example sentences of definitions.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS examples (
+			id              SERIAL PRIMARY KEY,
+			relation_id     INTEGER NOT NULL REFERENCES relations(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			lang            TEXT NOT NULL CHECK (lang <> ''),
+			content         TEXT NOT NULL CHECK (content <> ''),
+			translation     TEXT NOT NULL DEFAULT '',
+			tokens          TSVECTOR NOT NULL DEFAULT '',
+			weight          DECIMAL NOT NULL DEFAULT 0,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_examples_relation ON examples(relation_id);
+		CREATE INDEX IF NOT EXISTS idx_examples_tokens ON examples USING GIN(tokens);
+		CREATE INDEX IF NOT EXISTS idx_examples_content_trgm ON examples USING GIN(content gin_trgm_ops);
+	`); err != nil {
+		return err
+	}
+
+	// Etymology of entries with typed links to other entries.
+	if _, err := db.Exec(`
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS etymology TEXT NOT NULL DEFAULT '';
+
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'etymology_type') THEN
+				CREATE TYPE etymology_type AS ENUM ('borrowed-from', 'inherited-from', 'derived-from', 'calque-of', 'cognate-of');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS etymology_links (
+			id              SERIAL PRIMARY KEY,
+			entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			target_id       INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			type            etymology_type NOT NULL,
+			notes           TEXT NOT NULL DEFAULT '',
+			weight          DECIMAL NOT NULL DEFAULT 0,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+			CHECK (entry_id <> target_id)
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_etymology_links ON etymology_links(entry_id, target_id, type);
+		CREATE INDEX IF NOT EXISTS idx_etymology_links_target ON etymology_links(target_id);
+	`); err != nil {
+		return err
+	}
+
+	// Images attached to entries and definitions.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS media (
+			id              SERIAL PRIMARY KEY,
+			entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			relation_id     INTEGER NULL REFERENCES relations(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			filename        TEXT NOT NULL DEFAULT '',
+			thumb_filename  TEXT NOT NULL DEFAULT '',
+			url             TEXT NOT NULL CHECK (url <> ''),
+			thumb_url       TEXT NOT NULL DEFAULT '',
+			content_type    TEXT NOT NULL DEFAULT '',
+			width           INTEGER NOT NULL DEFAULT 0,
+			height          INTEGER NOT NULL DEFAULT 0,
+			caption         TEXT NOT NULL DEFAULT '',
+			weight          DECIMAL NOT NULL DEFAULT 0,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_media_entry ON media(entry_id);
+	`); err != nil {
+		return err
+	}
+
+	// Background jobs.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'job_status') THEN
+				CREATE TYPE job_status AS ENUM ('queued', 'running', 'done', 'failed', 'cancelled');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS jobs (
+			id              SERIAL PRIMARY KEY,
+			type            TEXT NOT NULL CHECK (type <> ''),
+			status          job_status NOT NULL DEFAULT 'queued',
+			params          JSONB NOT NULL DEFAULT '{}',
+			log             TEXT NOT NULL DEFAULT '',
+			result          TEXT NOT NULL DEFAULT '',
+			created_by      TEXT NOT NULL DEFAULT '',
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			started_at      TIMESTAMP WITH TIME ZONE NULL,
+			finished_at     TIMESTAMP WITH TIME ZONE NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+	`); err != nil {
+		return err
+	}
+
+	// Public searches that yielded no results.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS search_misses (
+			id              SERIAL PRIMARY KEY,
+			from_lang       TEXT NOT NULL,
+			to_lang         TEXT NOT NULL DEFAULT '',
+			query           TEXT NOT NULL,
+			count           INTEGER NOT NULL DEFAULT 1,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_search_misses ON search_misses(from_lang, to_lang, query);
+		CREATE INDEX IF NOT EXISTS idx_search_misses_updated_at ON search_misses(updated_at);
+	`); err != nil {
+		return err
+	}
+
+	// Edit locks on entries.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS entry_locks (
+			entry_id        INTEGER PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			username        TEXT NOT NULL,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			expires_at      TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Trash of deleted entries and relations.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS trash (
+			id              SERIAL PRIMARY KEY,
+			type            TEXT NOT NULL CHECK (type IN ('entry', 'relation')),
+			entity_id       INTEGER NOT NULL,
+			label           TEXT NOT NULL DEFAULT '',
+			data            JSONB NOT NULL DEFAULT '{}',
+			deleted_by      TEXT NOT NULL DEFAULT '',
+			deleted_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_trash_deleted_at ON trash(deleted_at);
+	`); err != nil {
+		return err
+	}
+
+	// Languages managed from the admin.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS langs (
+			id              TEXT PRIMARY KEY CHECK (id <> ''),
+			config          JSONB NOT NULL DEFAULT '{}',
+			dicts           TEXT[] NOT NULL DEFAULT '{}',
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Normalized content of entries.
+	if _, err := db.Exec(`
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS normalized TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS idx_entries_normalized ON entries(lang, normalized);
+		CREATE INDEX IF NOT EXISTS idx_entries_normalized_trgm ON entries USING GIN(normalized gin_trgm_ops);
+	`); err != nil {
+		return err
+	}
+
+	// Filtering entries by custom fields in their meta and by the labels of their definitions.
+	if _, err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_entries_meta ON entries USING GIN(meta jsonb_path_ops);
+		CREATE INDEX IF NOT EXISTS idx_relations_types ON relations USING GIN(types);
+		CREATE INDEX IF NOT EXISTS idx_relations_domains ON relations USING GIN(domains);
+	`); err != nil {
+		return err
+	}
+
+	// Site visitor (reader) accounts and their saved word lists.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS readers (
+			id              SERIAL PRIMARY KEY,
+			email           TEXT NOT NULL UNIQUE CHECK (email <> ''),
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			last_login_at   TIMESTAMP WITH TIME ZONE NULL
+		);
+		CREATE TABLE IF NOT EXISTS reader_tokens (
+			token           TEXT PRIMARY KEY,
+			email           TEXT NOT NULL,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			expires_at      TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_reader_tokens_email ON reader_tokens(email, created_at);
+		CREATE TABLE IF NOT EXISTS word_lists (
+			id              SERIAL PRIMARY KEY,
+			reader_id       INTEGER NOT NULL REFERENCES readers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			name            TEXT NOT NULL CHECK (name <> ''),
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_word_lists_reader ON word_lists(reader_id);
+		CREATE TABLE IF NOT EXISTS word_list_entries (
+			list_id         INTEGER NOT NULL REFERENCES word_lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (list_id, entry_id)
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Daily view counts of entries.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS entry_views (
+			entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			day             DATE NOT NULL DEFAULT CURRENT_DATE,
+			views           INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (entry_id, day)
+		);
+		CREATE INDEX IF NOT EXISTS idx_entry_views_day ON entry_views(day);
+	`); err != nil {
+		return err
+	}
+
+	// Publishing and featuring word lists.
+	if _, err := db.Exec(`
+		ALTER TABLE word_lists ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+		ALTER TABLE word_lists ADD COLUMN IF NOT EXISTS slug TEXT NULL UNIQUE;
+		ALTER TABLE word_lists ADD COLUMN IF NOT EXISTS public BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE word_lists ADD COLUMN IF NOT EXISTS featured BOOLEAN NOT NULL DEFAULT FALSE;
+		CREATE INDEX IF NOT EXISTS idx_word_lists_public ON word_lists(public, featured);
+	`); err != nil {
+		return err
+	}
+
+	// Redirects of old site paths.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS redirects (
+			id              SERIAL PRIMARY KEY,
+			source          TEXT NOT NULL UNIQUE CHECK (source LIKE '/%'),
+			target          TEXT NOT NULL CHECK (target <> ''),
+			code            SMALLINT NOT NULL DEFAULT 301 CHECK (code IN (301, 302, 307, 308)),
+			hits            INTEGER NOT NULL DEFAULT 0,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// API keys of the public APIs and their daily usage.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id              SERIAL PRIMARY KEY,
+			name            TEXT NOT NULL CHECK (name <> ''),
+			key_hash        TEXT NOT NULL UNIQUE,
+			key_prefix      TEXT NOT NULL,
+			notes           TEXT NOT NULL DEFAULT '',
+			rate_limit      INTEGER NOT NULL DEFAULT 0 CHECK (rate_limit >= 0),
+			daily_quota     INTEGER NOT NULL DEFAULT 0 CHECK (daily_quota >= 0),
+			enabled         BOOLEAN NOT NULL DEFAULT TRUE,
+			last_used_at    TIMESTAMP WITH TIME ZONE NULL,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE TABLE IF NOT EXISTS api_key_usage (
+			key_id          INTEGER NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			day             DATE NOT NULL DEFAULT CURRENT_DATE,
+			requests        INTEGER NOT NULL DEFAULT 0,
+			rejected        INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (key_id, day)
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Pluggable ID schemes (UUIDv4, UUIDv7, short IDs) of new entries.
+	if _, err := db.Exec(`
+		CREATE EXTENSION IF NOT EXISTS pgcrypto;
+		CREATE OR REPLACE FUNCTION id_scheme() RETURNS TEXT AS $$
+		BEGIN
+		    RETURN COALESCE((SELECT value #>> '{}' FROM settings WHERE key = 'app.id_scheme'), 'uuidv4');
+		END;
+		$$ LANGUAGE plpgsql STABLE;
+		CREATE OR REPLACE FUNCTION uuid_v7() RETURNS UUID AS $$
+		DECLARE
+		    b BYTEA := GEN_RANDOM_BYTES(16);
+		BEGIN
+		    b := OVERLAY(b PLACING SUBSTRING(INT8SEND(FLOOR(EXTRACT(EPOCH FROM CLOCK_TIMESTAMP()) * 1000)::BIGINT) FROM 3) FROM 1 FOR 6);
+		    b := SET_BYTE(b, 6, (GET_BYTE(b, 6) & 15) | 112);
+		    b := SET_BYTE(b, 8, (GET_BYTE(b, 8) & 63) | 128);
+		    RETURN ENCODE(b, 'hex')::UUID;
+		END;
+		$$ LANGUAGE plpgsql VOLATILE;
+		CREATE OR REPLACE FUNCTION new_guid() RETURNS UUID AS $$
+		BEGIN
+		    IF id_scheme() = 'uuidv7' THEN
+		        RETURN uuid_v7();
+		    END IF;
+		    RETURN GEN_RANDOM_UUID();
+		END;
+		$$ LANGUAGE plpgsql VOLATILE;
+		CREATE OR REPLACE FUNCTION new_short_id() RETURNS TEXT AS $$
+		DECLARE
+		    chars TEXT := '123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz';
+		    b BYTEA;
+		    sid TEXT := '';
+		BEGIN
+		    IF id_scheme() != 'short' THEN
+		        RETURN '';
+		    END IF;
+
+		    b := GEN_RANDOM_BYTES(10);
+		    FOR i IN 0..9 LOOP
+		        sid := sid || SUBSTR(chars, (GET_BYTE(b, i) % 58) + 1, 1);
+		    END LOOP;
+		    RETURN sid;
+		END;
+		$$ LANGUAGE plpgsql VOLATILE;
+		CREATE OR REPLACE FUNCTION entry_guid(ref TEXT) RETURNS UUID AS $$
+		BEGIN
+		    IF ref ~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$' THEN
+		        RETURN ref::UUID;
+		    END IF;
+		    RETURN (SELECT guid FROM entries WHERE short_id = ref AND ref != '');
+		END;
+		$$ LANGUAGE plpgsql STABLE;
+
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS short_id TEXT NOT NULL DEFAULT '';
+		ALTER TABLE entries ALTER COLUMN short_id SET DEFAULT new_short_id();
+		ALTER TABLE entries ALTER COLUMN guid SET DEFAULT new_guid();
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_entries_short_id ON entries(short_id) WHERE short_id != '';
+	`); err != nil {
+		return err
+	}
+
+	// Notifications of entry changes to instances over LISTEN/NOTIFY.
+	if _, err := db.Exec(`
+		CREATE OR REPLACE FUNCTION notify_entry_change() RETURNS TRIGGER AS $$
+		BEGIN
+		    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		        PERFORM PG_NOTIFY('dictpress', JSON_BUILD_OBJECT('type', 'entries', 'lang', OLD.lang)::TEXT);
+		    END IF;
+		    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		        PERFORM PG_NOTIFY('dictpress', JSON_BUILD_OBJECT('type', 'entries', 'lang', NEW.lang)::TEXT);
+		    END IF;
+		    RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS trg_notify_entry_change ON entries;
+		CREATE TRIGGER trg_notify_entry_change AFTER INSERT OR DELETE OR UPDATE OF content, initial, lang, status ON entries
+		    FOR EACH ROW EXECUTE PROCEDURE notify_entry_change();
+	`); err != nil {
+		return err
+	}
+
+	// Materialized entry and relation counts for stats and glossaries.
+	if _, err := db.Exec(`
+		CREATE MATERIALIZED VIEW IF NOT EXISTS mat_entry_counts AS
+		    SELECT e.lang, e.status, e.initial, COUNT(*) AS num,
+		        COUNT(*) FILTER (WHERE NOT EXISTS (SELECT 1 FROM relations r WHERE r.to_id = e.id)) AS glossary_num
+		    FROM entries e GROUP BY e.lang, e.status, e.initial;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_mat_entry_counts ON mat_entry_counts(lang, status, initial);
+
+		CREATE MATERIALIZED VIEW IF NOT EXISTS mat_relation_counts AS
+		    SELECT status, COUNT(*) AS num FROM relations GROUP BY status;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_mat_relation_counts ON mat_relation_counts(status);
+
+		CREATE OR REPLACE FUNCTION refresh_counts() RETURNS VOID AS $$
+		BEGIN
+		    REFRESH MATERIALIZED VIEW CONCURRENTLY mat_entry_counts;
+		    REFRESH MATERIALIZED VIEW CONCURRENTLY mat_relation_counts;
+
+		    INSERT INTO settings (key, value) VALUES ('stats.counts_updated_at', TO_JSONB(NOW()))
+		        ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW();
+		END;
+		$$ LANGUAGE plpgsql;
+	`); err != nil {
+		return err
+	}
+
+	// Ranks of headwords in imported word frequency lists.
+	if _, err := db.Exec(`
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS frequency_rank INTEGER NULL;
+		CREATE INDEX IF NOT EXISTS idx_entries_frequency_rank ON entries(lang, frequency_rank) WHERE frequency_rank IS NOT NULL;
+	`); err != nil {
+		return err
+	}
+
+	// Licensing metadata of entries.
+	if _, err := db.Exec(`
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT '';
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS license TEXT NOT NULL DEFAULT '';
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS attribution TEXT NOT NULL DEFAULT '';
+	`); err != nil {
+		return err
+	}
+
+	// Scheduled publishing of entries.
+	if _, err := db.Exec(`
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP WITH TIME ZONE NULL;
+		CREATE INDEX IF NOT EXISTS idx_entries_publish_at ON entries(publish_at) WHERE publish_at IS NOT NULL;
+	`); err != nil {
+		return err
+	}
+
+	// Checkpoints of file imports.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS import_checkpoints (
+			key             TEXT NOT NULL PRIMARY KEY,
+			name            TEXT NOT NULL DEFAULT '',
+			rows            INTEGER NOT NULL DEFAULT 0,
+			entries         INTEGER NOT NULL DEFAULT 0,
+			done            BOOLEAN NOT NULL DEFAULT false,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Staging table for the COPY based importer.
+	if _, err := db.Exec(`
+		CREATE UNLOGGED TABLE IF NOT EXISTS import_stage (
+			seq             INTEGER NOT NULL,
+			pos             INTEGER NOT NULL,
+			entry_id        INTEGER NOT NULL DEFAULT 0,
+			content         TEXT NOT NULL DEFAULT '',
+			initial         TEXT NOT NULL DEFAULT '',
+			weight          DECIMAL NOT NULL DEFAULT 0,
+			tokens          TEXT NOT NULL DEFAULT '',
+			tokenizer       TEXT NOT NULL DEFAULT '',
+			lang            TEXT NOT NULL DEFAULT '',
+			tags            TEXT[] NOT NULL DEFAULT '{}',
+			phones          TEXT[] NOT NULL DEFAULT '{}',
+			notes           TEXT NOT NULL DEFAULT '',
+			meta            TEXT NOT NULL DEFAULT '{}',
+			normalized      TEXT NOT NULL DEFAULT '',
+			types           TEXT[] NOT NULL DEFAULT '{}',
+			rel_tags        TEXT[] NOT NULL DEFAULT '{}',
+			rel_notes       TEXT NOT NULL DEFAULT ''
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Index for looking up the headwords of definitions, eg: in the worklist reports.
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_relations_to_id ON relations(to_id);`); err != nil {
+		return err
+	}
+
+	return nil
+}
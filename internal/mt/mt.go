@@ -0,0 +1,200 @@
+// package mt implements a generic HTTP hook for external machine translation
+// services (eg: LibreTranslate, DeepL, Google Translate) whose suggestions
+// are offered when dictionary searches yield no results. The request URL and
+// body are Go templates and the translation is picked from the JSON response
+// by a dot separated path.
+package mt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Max number of translations that are cached in memory.
+const maxCache = 5000
+
+// Opt represents the machine translation hook options.
+type Opt struct {
+	// Name of the service that's shown with the suggestions.
+	Name string `koanf:"name"`
+
+	// URL and body templates. The templates get .Text, .From, and .To (the
+	// locales of the languages, or their IDs if they have no locale) and the
+	// `json` function that encodes a value as JSON, eg: {"q": {{ json .Text }}}.
+	URL     string            `koanf:"url"`
+	Method  string            `koanf:"method"`
+	Headers map[string]string `koanf:"headers"`
+	Body    string            `koanf:"body"`
+
+	// Dot separated path of the translation in the JSON response, eg:
+	// translatedText or data.translations.0.translatedText.
+	ResponsePath string `koanf:"response_path"`
+
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// MT is a machine translation hook.
+type MT struct {
+	opt  Opt
+	url  *template.Template
+	body *template.Template
+	hc   *http.Client
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+type tplData struct {
+	Text string
+	From string
+	To   string
+}
+
+var tplFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// New returns a new instance of the machine translation hook.
+func New(o Opt) (*MT, error) {
+	if o.URL == "" {
+		return nil, fmt.Errorf("mt url is empty")
+	}
+	if o.ResponsePath == "" {
+		return nil, fmt.Errorf("mt response_path is empty")
+	}
+	if o.Method == "" {
+		o.Method = http.MethodPost
+	}
+	if o.Timeout == 0 {
+		o.Timeout = time.Second * 5
+	}
+
+	u, err := template.New("url").Funcs(tplFuncs).Parse(o.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing mt url template: %v", err)
+	}
+	b, err := template.New("body").Funcs(tplFuncs).Parse(o.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing mt body template: %v", err)
+	}
+
+	return &MT{
+		opt:   o,
+		url:   u,
+		body:  b,
+		hc:    &http.Client{Timeout: o.Timeout},
+		cache: make(map[string]string),
+	}, nil
+}
+
+// Name returns the name of the translation service.
+func (m *MT) Name() string {
+	return m.opt.Name
+}
+
+// Translate translates text from one language (locale) to another. An empty
+// string is returned if the service didn't return a translation.
+func (m *MT) Translate(text, from, to string) (string, error) {
+	key := from + "\x00" + to + "\x00" + text
+	m.mu.Lock()
+	out, ok := m.cache[key]
+	m.mu.Unlock()
+	if ok {
+		return out, nil
+	}
+
+	var (
+		d       = tplData{Text: text, From: from, To: to}
+		u, body bytes.Buffer
+	)
+	if err := m.url.Execute(&u, d); err != nil {
+		return "", fmt.Errorf("error compiling mt url: %v", err)
+	}
+	if err := m.body.Execute(&body, d); err != nil {
+		return "", fmt.Errorf("error compiling mt body: %v", err)
+	}
+
+	req, err := http.NewRequest(m.opt.Method, u.String(), &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range m.opt.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := m.hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mt service error (%d): %s", resp.StatusCode, string(b))
+	}
+
+	var res interface{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return "", fmt.Errorf("error parsing mt response: %v", err)
+	}
+
+	out, err = lookup(res, m.opt.ResponsePath)
+	if err != nil {
+		return "", err
+	}
+	out = strings.TrimSpace(out)
+
+	m.mu.Lock()
+	if len(m.cache) >= maxCache {
+		m.cache = make(map[string]string)
+	}
+	m.cache[key] = out
+	m.mu.Unlock()
+
+	return out, nil
+}
+
+// lookup returns the string at a dot separated path of object keys and
+// array indexes in a decoded JSON value.
+func lookup(v interface{}, path string) (string, error) {
+	for _, p := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[p]
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(t) {
+				return "", nil
+			}
+			v = t[i]
+		default:
+			return "", nil
+		}
+	}
+
+	if v == nil {
+		return "", nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("mt response_path '%s' is not a string", path)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,224 @@
+// package oidc implements a minimal OpenID Connect authorization code flow
+// client for logging into the admin with an external identity provider
+// (Google, Keycloak etc.).
+package oidc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Opt represents the OIDC provider options.
+type Opt struct {
+	ProviderURL  string   `koanf:"provider_url"`
+	ClientID     string   `koanf:"client_id"`
+	ClientSecret string   `koanf:"client_secret"`
+	RedirectURL  string   `koanf:"redirect_url"`
+	Scopes       []string `koanf:"scopes"`
+
+	// Claim in the ID token that has the user's groups.
+	GroupsClaim string `koanf:"groups_claim"`
+
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// Claims represents the relevant claims in a verified ID token.
+type Claims struct {
+	Subject  string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// OIDC is an OpenID Connect client.
+type OIDC struct {
+	opt Opt
+	hc  *http.Client
+
+	// Discovered provider configuration.
+	issuer   string
+	authURL  string
+	tokenURL string
+}
+
+// New returns a new OIDC client.
+func New(o Opt) *OIDC {
+	if len(o.Scopes) == 0 {
+		o.Scopes = []string{"openid", "profile", "email"}
+	}
+	if o.GroupsClaim == "" {
+		o.GroupsClaim = "groups"
+	}
+	if o.Timeout == 0 {
+		o.Timeout = time.Second * 10
+	}
+
+	return &OIDC{
+		opt: o,
+		hc:  &http.Client{Timeout: o.Timeout},
+	}
+}
+
+// Init fetches the provider's configuration from its discovery endpoint.
+func (o *OIDC) Init() error {
+	u := strings.TrimRight(o.opt.ProviderURL, "/") + "/.well-known/openid-configuration"
+
+	resp, err := o.hc.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discovery returned %d", resp.StatusCode)
+	}
+
+	var cfg struct {
+		Issuer   string `json:"issuer"`
+		AuthURL  string `json:"authorization_endpoint"`
+		TokenURL string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return fmt.Errorf("error decoding discovery response: %v", err)
+	}
+
+	if cfg.AuthURL == "" || cfg.TokenURL == "" {
+		return errors.New("discovery response has no authorization or token endpoints")
+	}
+
+	o.issuer = cfg.Issuer
+	o.authURL = cfg.AuthURL
+	o.tokenURL = cfg.TokenURL
+	return nil
+}
+
+// AuthURL returns the provider URL to redirect the user to for logging in.
+func (o *OIDC) AuthURL(state, nonce string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", o.opt.ClientID)
+	q.Set("redirect_uri", o.opt.RedirectURL)
+	q.Set("scope", strings.Join(o.opt.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+
+	sep := "?"
+	if strings.Contains(o.authURL, "?") {
+		sep = "&"
+	}
+	return o.authURL + sep + q.Encode()
+}
+
+// Exchange exchanges an authorization code for an ID token and returns its claims.
+//
+// The ID token is received directly from the token endpoint over TLS, which
+// the spec (OIDC Core 3.1.3.7) allows in place of verifying its signature.
+// The issuer, audience, expiry, and nonce are still validated.
+func (o *OIDC) Exchange(code, nonce string) (Claims, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.opt.RedirectURL)
+	form.Set("client_id", o.opt.ClientID)
+	form.Set("client_secret", o.opt.ClientSecret)
+
+	resp, err := o.hc.PostForm(o.tokenURL, form)
+	if err != nil {
+		return Claims{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return Claims{}, fmt.Errorf("error decoding token response: %v", err)
+	}
+
+	return o.parseIDToken(tok.IDToken, nonce)
+}
+
+// parseIDToken decodes and validates the claims in an ID token.
+func (o *OIDC) parseIDToken(token, nonce string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errors.New("invalid id_token")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, fmt.Errorf("error decoding id_token: %v", err)
+	}
+
+	var c map[string]interface{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Claims{}, fmt.Errorf("error decoding id_token: %v", err)
+	}
+
+	if iss, _ := c["iss"].(string); o.issuer != "" && iss != o.issuer {
+		return Claims{}, fmt.Errorf("unknown issuer: %s", iss)
+	}
+	if !hasString(c["aud"], o.opt.ClientID) {
+		return Claims{}, errors.New("id_token audience mismatch")
+	}
+	if exp, _ := c["exp"].(float64); time.Now().Unix() > int64(exp) {
+		return Claims{}, errors.New("id_token has expired")
+	}
+	if n, _ := c["nonce"].(string); n != nonce {
+		return Claims{}, errors.New("id_token nonce mismatch")
+	}
+
+	out := Claims{
+		Groups: toStrings(c[o.opt.GroupsClaim]),
+	}
+	out.Subject, _ = c["sub"].(string)
+	out.Email, _ = c["email"].(string)
+
+	// Pick the most human friendly identifier available as the username.
+	out.Username, _ = c["preferred_username"].(string)
+	if out.Username == "" {
+		out.Username = out.Email
+	}
+	if out.Username == "" {
+		out.Username = out.Subject
+	}
+
+	return out, nil
+}
+
+// hasString checks whether a claim that can be a string or a list of strings has a value.
+func hasString(v interface{}, s string) bool {
+	for _, a := range toStrings(v) {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
+
+// toStrings converts a claim that can be a string or a list of strings to a list.
+func toStrings(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, a := range t {
+			if s, ok := a.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+// package s3 implements a minimal client for S3 and S3 compatible (Minio,
+// Backblaze B2, Cloudflare R2 etc.) object stores for listing, downloading,
+// uploading, and deleting objects with AWS Signature V4 request signing.
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Hash of an empty request payload.
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Opt represents the S3 bucket options.
+type Opt struct {
+	// Endpoint of the S3 API, eg: https://s3.amazonaws.com. Buckets are
+	// addressed with paths (endpoint/bucket/key).
+	Endpoint  string `koanf:"endpoint"`
+	Region    string `koanf:"region"`
+	Bucket    string `koanf:"bucket"`
+	AccessKey string `koanf:"access_key"`
+	SecretKey string `koanf:"secret_key"`
+
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// Object represents an object in a bucket.
+type Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// Client is an S3 client.
+type Client struct {
+	opt Opt
+	hc  *http.Client
+}
+
+type listResp struct {
+	Contents              []Object `xml:"Contents"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// New returns a new S3 client.
+func New(o Opt) *Client {
+	if o.Endpoint == "" {
+		o.Endpoint = "https://s3.amazonaws.com"
+	}
+	if o.Region == "" {
+		o.Region = "us-east-1"
+	}
+	if o.Timeout == 0 {
+		o.Timeout = time.Second * 30
+	}
+	o.Endpoint = strings.TrimRight(o.Endpoint, "/")
+
+	return &Client{opt: o, hc: &http.Client{Timeout: o.Timeout}}
+}
+
+// List returns all objects in the bucket whose keys begin with prefix.
+func (c *Client) List(prefix string) ([]Object, error) {
+	var (
+		out   []Object
+		token = ""
+	)
+
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		b, err := c.do(http.MethodGet, "/"+c.opt.Bucket, q, nil, "")
+		if err != nil {
+			return nil, err
+		}
+
+		var r listResp
+		if err := xml.Unmarshal(b, &r); err != nil {
+			return nil, fmt.Errorf("error parsing bucket listing: %v", err)
+		}
+
+		for _, o := range r.Contents {
+			// Skip "directory" placeholder objects.
+			if !strings.HasSuffix(o.Key, "/") {
+				out = append(out, o)
+			}
+		}
+
+		if !r.IsTruncated || r.NextContinuationToken == "" {
+			break
+		}
+		token = r.NextContinuationToken
+	}
+
+	return out, nil
+}
+
+// Get returns the body of an object.
+func (c *Client) Get(key string) ([]byte, error) {
+	return c.do(http.MethodGet, "/"+c.opt.Bucket+"/"+key, nil, nil, "")
+}
+
+// Put uploads an object, replacing it if it exists.
+func (c *Client) Put(key, contentType string, b []byte) error {
+	_, err := c.do(http.MethodPut, "/"+c.opt.Bucket+"/"+key, nil, b, contentType)
+	return err
+}
+
+// Delete deletes an object.
+func (c *Client) Delete(key string) error {
+	_, err := c.do(http.MethodDelete, "/"+c.opt.Bucket+"/"+key, nil, nil, "")
+	return err
+}
+
+// do makes a signed request to a path in the API and returns the response body.
+func (c *Client) do(method, path string, q url.Values, body []byte, contentType string) ([]byte, error) {
+	u, err := url.Parse(c.opt.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %v", err)
+	}
+
+	// Encode the path and query as S3 expects them in the signature.
+	u.Path += path
+	u.RawPath = uriEncode(u.Path, false)
+	if q != nil {
+		u.RawQuery = canonicalQuery(q)
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	// Anonymous requests for public buckets are not signed.
+	if c.opt.AccessKey != "" {
+		c.sign(req, body, time.Now().UTC())
+	}
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return nil, fmt.Errorf("%s: %s", path, resp.Status)
+	}
+
+	return b, nil
+}
+
+// sign signs a request and its body with AWS Signature V4.
+func (c *Client) sign(req *http.Request, body []byte, t time.Time) {
+	var (
+		amzDate = t.Format("20060102T150405Z")
+		date    = t.Format("20060102")
+		scope   = date + "/" + c.opt.Region + "/s3/aws4_request"
+
+		bodyHash = emptyHash
+	)
+	if len(body) > 0 {
+		h := sha256.Sum256(body)
+		bodyHash = hex.EncodeToString(h[:])
+	}
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", bodyHash)
+
+	var (
+		signed = "host;x-amz-content-sha256;x-amz-date"
+		canon  = strings.Join([]string{
+			req.Method,
+			req.URL.EscapedPath(),
+			req.URL.RawQuery,
+			"host:" + req.URL.Host + "\n" +
+				"x-amz-content-sha256:" + bodyHash + "\n" +
+				"x-amz-date:" + amzDate + "\n",
+			signed,
+			bodyHash,
+		}, "\n")
+
+		h      = sha256.Sum256([]byte(canon))
+		toSign = "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+	)
+
+	key := hmacSHA256([]byte("AWS4"+c.opt.SecretKey), date)
+	key = hmacSHA256(key, c.opt.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.opt.AccessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+// canonicalQuery encodes query params sorted by key as required by Signature V4.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			out = append(out, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(out, "&")
+}
+
+// uriEncode percent encodes all characters in s other than the RFC 3986
+// unreserved characters, and optionally, slashes.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9'),
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
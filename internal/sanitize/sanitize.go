@@ -0,0 +1,206 @@
+// Package sanitize cleans up untrusted HTML (eg: definitions authored in a
+// WYSIWYG editor) by an allowlist policy of elements and their attributes.
+package sanitize
+
+import (
+	"html"
+	"io"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// DefaultElements are the elements and their attributes that are allowed by
+// default. These cover basic inline formatting, lists, and links in definitions.
+var DefaultElements = map[string][]string{
+	"a":          {"href", "title"},
+	"abbr":       {"title"},
+	"b":          nil,
+	"blockquote": nil,
+	"br":         nil,
+	"code":       nil,
+	"em":         nil,
+	"i":          nil,
+	"li":         nil,
+	"ol":         nil,
+	"p":          nil,
+	"small":      nil,
+	"strong":     nil,
+	"sub":        nil,
+	"sup":        nil,
+	"u":          nil,
+	"ul":         nil,
+}
+
+// DefaultURLSchemes are the URL schemes that are allowed by default in URL
+// attributes (href, src).
+var DefaultURLSchemes = []string{"http", "https", "mailto"}
+
+// Elements whose contents are dropped along with them instead of being
+// retained as text.
+var dropContent = map[string]bool{
+	"script":    true,
+	"style":     true,
+	"iframe":    true,
+	"object":    true,
+	"embed":     true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"plaintext": true,
+	"template":  true,
+	"textarea":  true,
+	"title":     true,
+	"head":      true,
+	"xmp":       true,
+}
+
+// Void elements that don't have closing tags.
+var voidElements = map[string]bool{
+	"br":  true,
+	"hr":  true,
+	"img": true,
+	"wbr": true,
+}
+
+// Policy is an allowlist of HTML elements, their attributes, and the URL
+// schemes allowed in links.
+type Policy struct {
+	elements map[string]map[string]bool
+	schemes  map[string]bool
+}
+
+// New returns a policy that allows the given elements (tag => attributes) and
+// URL schemes. If elements or schemes are empty, the defaults are used.
+func New(elements map[string][]string, schemes []string) *Policy {
+	if len(elements) == 0 {
+		elements = DefaultElements
+	}
+	if len(schemes) == 0 {
+		schemes = DefaultURLSchemes
+	}
+
+	p := &Policy{
+		elements: make(map[string]map[string]bool, len(elements)),
+		schemes:  make(map[string]bool, len(schemes)),
+	}
+	for tag, attrs := range elements {
+		a := make(map[string]bool, len(attrs))
+		for _, at := range attrs {
+			a[strings.ToLower(at)] = true
+		}
+		p.elements[strings.ToLower(tag)] = a
+	}
+	for _, s := range schemes {
+		p.schemes[strings.ToLower(s)] = true
+	}
+
+	return p
+}
+
+// Sanitize returns the HTML with only the allowed elements and attributes
+// retained. Disallowed elements are stripped retaining their text, except for
+// the likes of <script> and <style> that are dropped with their contents.
+// Unclosed elements are closed and stray closing tags are dropped, so that the
+// output doesn't break the markup it's embedded in.
+func (p *Policy) Sanitize(s string) string {
+	var (
+		b     strings.Builder
+		open  []string
+		skip  = 0
+		z     = xhtml.NewTokenizer(strings.NewReader(s))
+		depth = map[string]int{}
+	)
+
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			if z.Err() == io.EOF {
+				break
+			}
+			return html.EscapeString(s)
+		}
+
+		tok := z.Token()
+		switch tt {
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			if dropContent[tok.Data] {
+				if tt == xhtml.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+
+			attrs, ok := p.elements[tok.Data]
+			if !ok {
+				continue
+			}
+
+			b.WriteString("<" + tok.Data)
+			for _, a := range tok.Attr {
+				if a.Namespace != "" || !attrs[a.Key] {
+					continue
+				}
+				if (a.Key == "href" || a.Key == "src") && !p.allowedURL(a.Val) {
+					continue
+				}
+				b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+			}
+			b.WriteString(">")
+
+			if tt == xhtml.StartTagToken && !voidElements[tok.Data] {
+				open = append(open, tok.Data)
+				depth[tok.Data]++
+			}
+
+		case xhtml.EndTagToken:
+			if dropContent[tok.Data] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 || depth[tok.Data] == 0 {
+				continue
+			}
+
+			// Close the elements opened within the one that's being closed.
+			for len(open) > 0 {
+				t := open[len(open)-1]
+				open = open[:len(open)-1]
+				depth[t]--
+				b.WriteString("</" + t + ">")
+				if t == tok.Data {
+					break
+				}
+			}
+
+		case xhtml.TextToken:
+			if skip == 0 {
+				b.WriteString(html.EscapeString(tok.Data))
+			}
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+
+	return b.String()
+}
+
+// allowedURL checks whether a URL is relative or has an allowed scheme.
+func (p *Policy) allowedURL(u string) bool {
+	u = strings.TrimSpace(u)
+
+	// Relative URLs don't have a scheme before the first /, ?, or #.
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' {
+		return true
+	}
+
+	return p.schemes[strings.ToLower(u[:i])]
+}
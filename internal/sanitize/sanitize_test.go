@@ -0,0 +1,82 @@
+package sanitize
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	p := New(nil, nil)
+
+	cases := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{"plain text", "a cat", "a cat"},
+		{"allowed elements", "<p><b>bold</b> and <i>italic</i></p>", "<p><b>bold</b> and <i>italic</i></p>"},
+		{"disallowed element keeps text", `<div class="x">text</div>`, "text"},
+		{"disallowed attributes", `<p onclick="alert(1)" style="color: red">text</p>`, "<p>text</p>"},
+		{"void element", "a<br>b<br/>c", "a<br>b<br>c"},
+
+		// Elements dropped with their contents.
+		{"script", "a<script>alert(1)</script>b", "ab"},
+		{"style", "a<style>p { color: red }</style>b", "ab"},
+		{"nested in allowed", "<p>a<script>alert('<b>x</b>')</script>b</p>", "<p>ab</p>"},
+		{"iframe", `a<iframe src="https://example.com">fallback</iframe>b`, "ab"},
+		{"unclosed script", "a<script>alert(1)", "a"},
+
+		// URL schemes.
+		{"http link", `<a href="https://example.com/?a=1&b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{"relative link", `<a href="/word/english/cat">x</a>`, `<a href="/word/english/cat">x</a>`},
+		{"mailto link", `<a href="mailto:a@example.com">x</a>`, `<a href="mailto:a@example.com">x</a>`},
+		{"javascript", `<a href="javascript:alert(1)">x</a>`, "<a>x</a>"},
+		{"javascript mixed case", `<a href=" JavaScript:alert(1)">x</a>`, "<a>x</a>"},
+		{"javascript entity encoded", `<a href="jav&#x61;script&#58;alert(1)">x</a>`, "<a>x</a>"},
+		{"javascript named entity", `<a href="javascript&colon;alert(1)">x</a>`, "<a>x</a>"},
+		{"javascript with tab", "<a href=\"java\tscript:alert(1)\">x</a>", "<a>x</a>"},
+		{"javascript with control char", "<a href=\"\x01javascript:alert(1)\">x</a>", "<a>x</a>"},
+		{"data", `<a href="data:text/html,<script>alert(1)</script>">x</a>`, "<a>x</a>"},
+		{"colon after path", `<a href="/a:b">x</a>`, `<a href="/a:b">x</a>`},
+
+		// Unclosed and stray tags.
+		{"unclosed", "<p><b>bold", "<p><b>bold</b></p>"},
+		{"stray closing tag", "text</p></div>", "text"},
+		{"misnested", "<b><i>x</b>y</i>", "<b><i>x</i></b>y"},
+		{"closing outer closes inner", "<ul><li>a<li>b</ul>c", "<ul><li>a<li>b</li></li></ul>c"},
+		{"broken tag", "a <b", "a "},
+
+		// Attribute quoting and text escaping.
+		{"attribute breakout", `<a title='x" onclick="alert(1)'>x</a>`, `<a title="x&#34; onclick=&#34;alert(1)">x</a>`},
+		{"unquoted attribute", `<abbr title=a&b>x</abbr>`, `<abbr title="a&amp;b">x</abbr>`},
+		{"escaped text", "1 &lt; 2 &amp; <b>3 > 2</b>", "1 &lt; 2 &amp; <b>3 &gt; 2</b>"},
+		{"text entities", "&lt;script&gt;alert(1)&lt;/script&gt;", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"comment", "a<!-- <script>alert(1)</script> -->b", "ab"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := p.Sanitize(c.in); got != c.out {
+				t.Errorf("Sanitize(%q)\ngot:  %q\nwant: %q", c.in, got, c.out)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := New(map[string][]string{"a": {"href"}, "IMG": {"SRC", "alt"}}, []string{"https"})
+
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{`<a href="http://example.com" title="t">x</a>`, "<a>x</a>"},
+		{`<a href="https://example.com">x</a>`, `<a href="https://example.com">x</a>`},
+		{`<img src="https://example.com/a.png" alt="a">`, `<img src="https://example.com/a.png" alt="a">`},
+		{`<img src="javascript:alert(1)">`, "<img>"},
+		{"<b>x</b>", "x"},
+	}
+
+	for _, c := range cases {
+		if got := p.Sanitize(c.in); got != c.out {
+			t.Errorf("Sanitize(%q)\ngot:  %q\nwant: %q", c.in, got, c.out)
+		}
+	}
+}
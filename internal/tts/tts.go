@@ -0,0 +1,182 @@
+// package tts implements text-to-speech providers that generate the
+// pronunciation audio of entries. The HTTP provider is a generic hook for
+// external TTS services (eg: Google Cloud TTS, Amazon Polly via a proxy,
+// Piper, or a custom service) whose request URL and body are templates.
+package tts
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Provider generates speech audio for text.
+type Provider interface {
+	// Speak returns the audio of a text spoken in a language (locale) with
+	// an optional voice, and the audio's content type.
+	Speak(text, lang, voice string) ([]byte, string, error)
+}
+
+// Opt represents the HTTP TTS provider options.
+type Opt struct {
+	// URL and body templates. The templates get .Text, .Lang (the locale of
+	// the language, or its ID if it has no locale), and .Voice, and the `json`
+	// function that encodes a value as JSON, eg: {"text": {{ json .Text }}}.
+	URL     string            `koanf:"url"`
+	Method  string            `koanf:"method"`
+	Headers map[string]string `koanf:"headers"`
+	Body    string            `koanf:"body"`
+
+	// If the service responds with JSON, the dot separated path of the base64
+	// encoded audio in it (eg: audioContent) and its content type. Otherwise,
+	// the response body is the audio with the response's content type.
+	ResponsePath string `koanf:"response_path"`
+	ContentType  string `koanf:"content_type"`
+
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// HTTP is a TTS provider that calls an external service.
+type HTTP struct {
+	opt  Opt
+	url  *template.Template
+	body *template.Template
+	hc   *http.Client
+}
+
+type tplData struct {
+	Text  string
+	Lang  string
+	Voice string
+}
+
+var tplFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// NewHTTP returns a new instance of the HTTP TTS provider.
+func NewHTTP(o Opt) (*HTTP, error) {
+	if o.URL == "" {
+		return nil, fmt.Errorf("tts url is empty")
+	}
+	if o.ResponsePath != "" && o.ContentType == "" {
+		return nil, fmt.Errorf("tts content_type is required with response_path")
+	}
+	if o.Method == "" {
+		o.Method = http.MethodPost
+	}
+	if o.Timeout == 0 {
+		o.Timeout = time.Second * 30
+	}
+
+	u, err := template.New("url").Funcs(tplFuncs).Parse(o.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tts url template: %v", err)
+	}
+	b, err := template.New("body").Funcs(tplFuncs).Parse(o.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tts body template: %v", err)
+	}
+
+	return &HTTP{
+		opt:  o,
+		url:  u,
+		body: b,
+		hc:   &http.Client{Timeout: o.Timeout},
+	}, nil
+}
+
+// Speak calls the TTS service and returns the audio.
+func (h *HTTP) Speak(text, lang, voice string) ([]byte, string, error) {
+	var (
+		d       = tplData{Text: text, Lang: lang, Voice: voice}
+		u, body bytes.Buffer
+	)
+	if err := h.url.Execute(&u, d); err != nil {
+		return nil, "", fmt.Errorf("error compiling tts url: %v", err)
+	}
+	if err := h.body.Execute(&body, d); err != nil {
+		return nil, "", fmt.Errorf("error compiling tts body: %v", err)
+	}
+
+	req, err := http.NewRequest(h.opt.Method, u.String(), &body)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.opt.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.hc.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("tts service error (%d): %s", resp.StatusCode, string(b))
+	}
+
+	// Raw audio.
+	if h.opt.ResponsePath == "" {
+		typ := h.opt.ContentType
+		if typ == "" {
+			typ, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		}
+		if !strings.HasPrefix(typ, "audio/") {
+			return nil, "", fmt.Errorf("tts service returned non-audio content type '%s'", typ)
+		}
+		return b, typ, nil
+	}
+
+	// Base64 encoded audio in a JSON response.
+	var res interface{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, "", fmt.Errorf("error parsing tts response: %v", err)
+	}
+
+	var v interface{} = res
+	for _, p := range strings.Split(h.opt.ResponsePath, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[p]
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(t) {
+				v = nil
+			} else {
+				v = t[i]
+			}
+		default:
+			v = nil
+		}
+	}
+
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return nil, "", fmt.Errorf("no audio at tts response_path '%s'", h.opt.ResponsePath)
+	}
+
+	audio, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, "", fmt.Errorf("error decoding tts audio: %v", err)
+	}
+
+	return audio, h.opt.ContentType, nil
+}
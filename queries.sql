@@ -3,8 +3,13 @@ WITH q AS (
     -- Prepare TS_QUERY tokens for querying with either:
     -- a) built in Postgres dictionary/tokenizer ($1=query, $2=Postgres dictionary name)
     -- b) externally computed and supplied tokens ($3)
+    -- c) built in Postgres dictionary with a stopword filtered and synonym expanded
+    --    tsquery expression ($13) that is normalized by the dictionary ($2)
+    -- Only used in the 'fts' match mode ($14).
     SELECT (
-        CASE WHEN $2 != '' THEN
+        CASE WHEN $2 != '' AND $13 != '' THEN
+            TO_TSQUERY($2::regconfig, $13)
+        WHEN $2 != '' THEN
             CASE WHEN POSITION(' ' IN $1::TEXT) > 0 OR POSITION('-' IN $1::TEXT) > 0 THEN
                 PLAINTO_TSQUERY($2::regconfig, $1) || PLAINTO_TSQUERY($2::regconfig, REPLACE(REPLACE($1, ' ', ''), '-', ''))
             ELSE
@@ -20,31 +25,77 @@ directMatch AS (
     -- "simple" (Postgres token dictionary that merely removes English stopwords) tokens.
     -- Rank is the inverted string length so that all results in this query have a negative
     -- value to rank higher than results from tokenMatch.
-    SELECT DISTINCT ON (entries.id) entries.*, -1 * ( 50 - LENGTH(content)) AS rank FROM entries
+    -- Exact (case insensitive) headword matches are further boosted by $9.
+    -- If the language has normalization ($16), $1 is the normalized query that's also
+    -- matched against the normalized headwords. All matches are filtered by the
+    -- custom field values ($17) in their meta, which is '{}' if there are none, and
+    -- by the types ($18), genders ($19), registers ($20), and domains ($21) of
+    -- their definitions.
+    SELECT DISTINCT ON (entries.id) entries.*,
+        -1 * ( 50 - LENGTH(content)) - (CASE WHEN LOWER(content) = LOWER($1) OR ($16::BOOLEAN AND normalized = $1) THEN $9::DECIMAL ELSE 0 END) AS rank
+    FROM entries
         INNER JOIN relations ON entries.id = relations.from_id
         WHERE
-        ($4 = '' OR lang=$4)
+        $14 = 'fts'
+        AND ($4 = '' OR lang=$4)
         AND (COALESCE(CARDINALITY($5::TEXT[]), 0) = 0 OR entries.tags && $5)
+        AND entries.meta @> $17::JSONB
+        AND (COALESCE(CARDINALITY($18::TEXT[]), 0) = 0 OR relations.types && $18)
+        AND (COALESCE(CARDINALITY($19::TEXT[]), 0) = 0 OR relations.gender = ANY($19))
+        AND (COALESCE(CARDINALITY($20::TEXT[]), 0) = 0 OR relations.register = ANY($20))
+        AND (COALESCE(CARDINALITY($21::TEXT[]), 0) = 0 OR relations.domains && $21)
         AND (
             CASE WHEN $1 = '' THEN TRUE ELSE
                 REGEXP_REPLACE(LOWER(SUBSTRING(content, 0, 50)), '[0-9\s]+', '', 'g') = REGEXP_REPLACE(LOWER(SUBSTRING($1, 0, 50)), '[0-9\s]+', '', 'g')
                 OR tokens @@ PLAINTO_TSQUERY('simple', $1)
+                OR ($16::BOOLEAN AND normalized = $1)
             END
         )
         AND (CASE WHEN $6 != '' THEN entries.status = $6::entry_status ELSE TRUE END)
 ),
 tokenMatch AS (
     -- Full text search for words with proper tokens either from a built-in Postgres dictionary
-    -- or externally computed tokens ($3) 
-    SELECT DISTINCT ON (entries.id) entries.*, 1 - TS_RANK(tokens, (SELECT query FROM q), 0) AS rank FROM entries
+    -- or externally computed tokens ($3). The fulltext rank is scaled by $10.
+    SELECT DISTINCT ON (entries.id) entries.*, 1 - ($10::DECIMAL * TS_RANK(tokens, (SELECT query FROM q), 0)) AS rank FROM entries
         INNER JOIN relations ON entries.id = relations.from_id
         WHERE
-        ($4 = '' OR lang=$4)
+        $14 = 'fts'
+        AND ($4 = '' OR lang=$4)
         AND (COALESCE(CARDINALITY($5::TEXT[]), 0) = 0 OR entries.tags && $5)
+        AND entries.meta @> $17::JSONB
+        AND (COALESCE(CARDINALITY($18::TEXT[]), 0) = 0 OR relations.types && $18)
+        AND (COALESCE(CARDINALITY($19::TEXT[]), 0) = 0 OR relations.gender = ANY($19))
+        AND (COALESCE(CARDINALITY($20::TEXT[]), 0) = 0 OR relations.register = ANY($20))
+        AND (COALESCE(CARDINALITY($21::TEXT[]), 0) = 0 OR relations.domains && $21)
         AND tokens @@ (SELECT query FROM q)
         AND entries.id NOT IN (SELECT id FROM directMatch)
         AND (CASE WHEN $6 != '' THEN entries.status = $6::entry_status ELSE TRUE END)
 ),
+patternMatch AS (
+    -- Case insensitive headword match for the 'exact', 'prefix', and 'substring' match
+    -- modes ($14) with the LIKE pattern ($15). Exact matches use the (lang, LOWER(content))
+    -- index and prefix and substring matches use the trigram index. Shorter headwords
+    -- rank higher and exact matches are boosted by $9. Normalized headwords are also
+    -- matched if the language has normalization ($16).
+    SELECT DISTINCT ON (entries.id) entries.*,
+        -1 * ( 50 - LENGTH(content)) - (CASE WHEN LOWER(content) = LOWER($1) OR ($16::BOOLEAN AND normalized = $1) THEN $9::DECIMAL ELSE 0 END) AS rank
+    FROM entries
+        INNER JOIN relations ON entries.id = relations.from_id
+        WHERE
+        $14 != 'fts'
+        AND ($4 = '' OR lang=$4)
+        AND (COALESCE(CARDINALITY($5::TEXT[]), 0) = 0 OR entries.tags && $5)
+        AND entries.meta @> $17::JSONB
+        AND (COALESCE(CARDINALITY($18::TEXT[]), 0) = 0 OR relations.types && $18)
+        AND (COALESCE(CARDINALITY($19::TEXT[]), 0) = 0 OR relations.gender = ANY($19))
+        AND (COALESCE(CARDINALITY($20::TEXT[]), 0) = 0 OR relations.register = ANY($20))
+        AND (COALESCE(CARDINALITY($21::TEXT[]), 0) = 0 OR relations.domains && $21)
+        AND (
+            ($14 = 'exact' AND (LOWER(content) = LOWER($1) OR ($16::BOOLEAN AND normalized = $1)))
+            OR ($14 != 'exact' AND (content ILIKE $15 OR ($16::BOOLEAN AND normalized LIKE $15)))
+        )
+        AND (CASE WHEN $6 != '' THEN entries.status = $6::entry_status ELSE TRUE END)
+),
 results AS (
     -- Combine results from direct matches and token matches. As directMatches ranks are
     -- forced to be negative, they will rank on top. 
@@ -53,9 +104,58 @@ results AS (
         SELECT * FROM directMatch
         UNION ALL
         SELECT * FROM tokenMatch
+        UNION ALL
+        SELECT * FROM patternMatch
     ) AS combined
+),
+facets AS (
+    -- Optional counts of all the matches (and not just the page) by the requested
+    -- facets ($22): the types (pos) of their definitions, their tags, and the
+    -- languages of their definitions.
+    SELECT JSONB_STRIP_NULLS(JSONB_BUILD_OBJECT(
+        'pos', (CASE WHEN 'pos' = ANY($22::TEXT[]) THEN (
+            SELECT COALESCE(JSONB_OBJECT_AGG(t, n), '{}') FROM (
+                SELECT t, COUNT(DISTINCT r.from_id) AS n FROM results
+                INNER JOIN relations r ON r.from_id = results.id, UNNEST(r.types) t
+                GROUP BY t
+            ) f
+        ) END),
+        'tag', (CASE WHEN 'tag' = ANY($22::TEXT[]) THEN (
+            SELECT COALESCE(JSONB_OBJECT_AGG(t, n), '{}') FROM (
+                SELECT t, COUNT(*) AS n FROM results, UNNEST(results.tags) t GROUP BY t
+            ) f
+        ) END),
+        'lang', (CASE WHEN 'lang' = ANY($22::TEXT[]) THEN (
+            SELECT COALESCE(JSONB_OBJECT_AGG(l, n), '{}') FROM (
+                SELECT d.lang AS l, COUNT(DISTINCT r.from_id) AS n FROM results
+                INNER JOIN relations r ON r.from_id = results.id
+                INNER JOIN entries d ON d.id = r.to_id
+                GROUP BY d.lang
+            ) f
+        ) END)
+    )) AS facets
+    WHERE COALESCE(CARDINALITY($22::TEXT[]), 0) > 0
+),
+scored AS (
+    -- Lower score is better. The score is the rank with the manual weight ($11),
+    -- click-through popularity ($12), and word frequency ($25) boosts applied.
+    -- Headwords that aren't in the frequency list count as rank 1,000,000.
+    -- With the frequency sort order ($26), the score is the frequency rank, with
+    -- the headwords that aren't in the list last.
+    SELECT COUNT(*) OVER () AS total, (SELECT facets FROM facets) AS facets,
+        (CASE WHEN $26 = 'frequency' THEN COALESCE(frequency_rank, 2147483647)
+        ELSE
+            rank + ($11::DECIMAL * weight) - ($12::DECIMAL * LN(1 + clicks))
+            + ($25::DECIMAL * LN(COALESCE(frequency_rank, 1000000)))
+        END)::DOUBLE PRECISION AS score, *
+    FROM results
 )
-SELECT COUNT(*) OVER () AS total, * FROM results ORDER BY rank OFFSET $7 LIMIT $8;
+SELECT * FROM scored
+    -- Keyset pagination: only the results after the (score, guid) of the last
+    -- result of the previous page ($23, $24), if it's given. The public GUID
+    -- breaks ties so that the order is stable.
+    WHERE ($24 = '' OR (score, guid) > ($23::DOUBLE PRECISION, NULLIF($24, '')::UUID))
+    ORDER BY score, guid OFFSET $7 LIMIT $8;
 
 -- name: search-relations
 SELECT entries.*,
@@ -67,7 +167,10 @@ SELECT entries.*,
     relations.weight as relation_weight,
     relations.status as relation_status,
     relations.created_at as relation_created_at,
-    relations.updated_at as relation_updated_at
+    relations.updated_at as relation_updated_at,
+    relations.gender as relation_gender,
+    relations.register as relation_register,
+    relations.domains as relation_domains
 FROM entries
 LEFT JOIN relations ON (relations.to_id = entries.id)
 WHERE
@@ -109,45 +212,337 @@ UPDATE relations WHERE from_id = $1;
 -- name: get-entry
 SELECT * FROM entries WHERE id=$1;
 
+-- name: get-entry-by-guid
+SELECT * FROM entries WHERE guid = entry_guid($1) AND status='enabled';
+
+-- name: get-entry-by-slug
+SELECT * FROM entries WHERE lang=$1 AND slug=$2;
+
+-- name: entry-exists
+-- Checks whether an enabled entry with the GUID (or short ID) exists.
+SELECT EXISTS (SELECT 1 FROM entries WHERE guid = entry_guid($1) AND status='enabled');
+
+-- name: record-clicks
+-- Records click-throughs on enabled entries by their GUIDs ($1) and counts ($2) in
+-- their all-time count for the popularity ranking boost, and in today's view count.
+WITH c AS (
+    SELECT e.id, c.n FROM UNNEST($1::TEXT[], $2::INT[]) AS c(guid, n)
+    INNER JOIN entries e ON (e.guid = entry_guid(c.guid) AND e.status = 'enabled')
+),
+upd AS (
+    UPDATE entries SET clicks = entries.clicks + c.n FROM c WHERE entries.id = c.id
+)
+INSERT INTO entry_views (entry_id, day, views) SELECT id, CURRENT_DATE, n FROM c
+    ON CONFLICT (entry_id, day) DO UPDATE SET views = entry_views.views + EXCLUDED.views;
+
+-- name: reset-frequency-ranks
+-- Clears the frequency ranks of the entries of a language ($1) before a new
+-- frequency list is imported.
+UPDATE entries SET frequency_rank = NULL WHERE lang = $1 AND frequency_rank IS NOT NULL;
+
+-- name: update-frequency-ranks
+-- Sets the frequency ranks ($3) of the entries of a language ($1) that have the
+-- (lowercased) words ($2) as their case insensitive headwords.
+WITH f AS (
+    SELECT * FROM UNNEST($2::TEXT[], $3::INT[]) AS f(word, rank)
+)
+UPDATE entries SET frequency_rank = f.rank FROM f
+    WHERE entries.lang = $1 AND LOWER(entries.content) = f.word;
+
+-- name: delete-old-views
+DELETE FROM entry_views WHERE day < CURRENT_DATE - $1::INT;
+
+-- name: get-popular-entries
+-- Enabled headwords, optionally in a language ($1), with the most views in the past $2 days.
+WITH v AS (
+    SELECT entry_id, SUM(views) AS views FROM entry_views
+        WHERE day > CURRENT_DATE - $2::INT GROUP BY entry_id
+)
+SELECT e.*, v.views FROM v
+    INNER JOIN entries e ON (e.id = v.entry_id)
+    WHERE e.status = 'enabled' AND ($1 = '' OR e.lang = $1)
+    ORDER BY v.views DESC, e.id LIMIT $3;
+
+-- name: get-slug-redirect
+-- Gets the current slug of the entry that an old slug belonged to.
+SELECT e.slug FROM entry_slugs s
+    JOIN entries e ON (e.id = s.entry_id)
+    WHERE s.lang=$1 AND s.slug=$2;
+
+-- name: get-entries-by-ids
+SELECT * FROM entries WHERE id = ANY($1::INT[]);
+
+-- name: get-similar-by-tokens
+-- Enabled headwords in the language of the entry ($1) that share any of its
+-- search tokens, ranked by the fulltext rank of the shared tokens. Tokens are
+-- already normalized, so they're matched with the 'simple' config.
+WITH s AS (
+    SELECT id, lang, TO_TSQUERY('simple', ARRAY_TO_STRING(
+        ARRAY(SELECT QUOTE_LITERAL(t) FROM UNNEST(TSVECTOR_TO_ARRAY(tokens)) t), ' | ')) AS query
+    FROM entries WHERE id = $1
+)
+SELECT e.* FROM entries e, s
+    WHERE e.lang = s.lang AND e.id != s.id AND e.status = 'enabled'
+    AND e.tokens @@ s.query
+    AND EXISTS (SELECT 1 FROM relations r WHERE r.from_id = e.id)
+    ORDER BY TS_RANK(e.tokens, s.query) DESC, e.weight, e.id
+    LIMIT $2;
+
+-- name: get-similar-by-tags
+-- Enabled headwords in the language of the entry ($1) that share any of its
+-- tags, ranked by the number of shared tags.
+SELECT e.* FROM entries e
+    INNER JOIN entries s ON (s.id = $1 AND e.lang = s.lang AND e.id != s.id)
+    WHERE e.status = 'enabled' AND e.tags && s.tags
+    AND EXISTS (SELECT 1 FROM relations r WHERE r.from_id = e.id)
+    ORDER BY CARDINALITY(ARRAY(SELECT UNNEST(e.tags) INTERSECT SELECT UNNEST(s.tags))) DESC, e.weight, e.id
+    LIMIT $2;
+
+-- The *-embedding(s) and search-semantic queries are only prepared if semantic
+-- search is enabled as they need the pgvector extension. In create-embeddings,
+-- {dimensions} is replaced with the dimensions of the embedding model's vectors.
+
+-- name: create-embeddings
+CREATE EXTENSION IF NOT EXISTS vector;
+CREATE TABLE IF NOT EXISTS entry_embeddings (
+    entry_id       INTEGER NOT NULL PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    model          TEXT NOT NULL,
+    embedding      VECTOR({dimensions}) NOT NULL,
+    updated_at     TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_entry_embeddings ON entry_embeddings USING HNSW(embedding vector_cosine_ops);
+
+-- name: get-entries-to-embed
+-- Headwords whose embeddings are missing, older than the entry, or from a model
+-- other than $1, with the content of their definitions.
+SELECT e.id, e.content, COALESCE((
+    SELECT STRING_AGG(d.content, '; ' ORDER BY r.weight, r.id) FROM relations r
+    INNER JOIN entries d ON d.id = r.to_id WHERE r.from_id = e.id
+), '') AS definitions
+FROM entries e
+LEFT JOIN entry_embeddings emb ON emb.entry_id = e.id
+WHERE (emb.entry_id IS NULL OR emb.model != $1 OR emb.updated_at < e.updated_at)
+    AND EXISTS (SELECT 1 FROM relations r WHERE r.from_id = e.id)
+ORDER BY e.id LIMIT $2;
+
+-- name: upsert-embeddings
+-- $1 = entry IDs, $2 = vectors as pgvector literals ('[1,2,3]'), $3 = model.
+INSERT INTO entry_embeddings (entry_id, model, embedding)
+    SELECT id, $3, vec::VECTOR FROM UNNEST($1::INT[], $2::TEXT[]) AS t(id, vec)
+    ON CONFLICT (entry_id) DO UPDATE SET model = $3, embedding = EXCLUDED.embedding, updated_at = NOW();
+
+-- name: search-semantic
+-- Headwords ordered by the cosine distance of their embeddings to the query's
+-- embedding ($1). Only matches within the max distance ($6) are counted, if it's > 0.
+WITH results AS (
+    SELECT entries.*, (emb.embedding <=> $1::VECTOR)::DOUBLE PRECISION AS score
+    FROM entry_embeddings emb
+    INNER JOIN entries ON entries.id = emb.entry_id
+    WHERE ($2 = '' OR entries.lang = $2)
+        AND (COALESCE(CARDINALITY($3::TEXT[]), 0) = 0 OR entries.tags && $3)
+        AND (CASE WHEN $4 != '' THEN entries.status = $4::entry_status ELSE TRUE END)
+        AND entries.meta @> $5::JSONB
+        AND ($6::DOUBLE PRECISION = 0 OR (emb.embedding <=> $1::VECTOR) <= $6)
+)
+SELECT COUNT(*) OVER () AS total, * FROM results ORDER BY score, guid OFFSET $7 LIMIT $8;
+
+-- name: get-similar-by-embedding
+-- Enabled headwords in the language of the entry ($1) ordered by the cosine
+-- distance of their embeddings to the entry's embedding.
+SELECT e.* FROM entry_embeddings src
+    INNER JOIN entries s ON s.id = src.entry_id
+    INNER JOIN entry_embeddings emb ON emb.entry_id != src.entry_id
+    INNER JOIN entries e ON (e.id = emb.entry_id AND e.lang = s.lang)
+    WHERE src.entry_id = $1 AND e.status = 'enabled'
+    ORDER BY emb.embedding <=> src.embedding, e.id
+    LIMIT $2;
+
+-- name: get-entries-for-index
+-- Gets entries updated after the given (updated_at, id) position, ordered by
+-- the position, for syncing to an external search index.
+SELECT id, guid, lang, content, initial, tags, status, weight, updated_at,
+    EXISTS (SELECT 1 FROM relations WHERE from_id = entries.id) AS is_headword,
+    ARRAY(SELECT DISTINCT d.lang FROM relations r JOIN entries d ON (d.id = r.to_id)
+        WHERE r.from_id = entries.id) AS to_langs
+    FROM entries
+    WHERE (updated_at, id) > ($1, $2)
+    ORDER BY updated_at, id LIMIT $3;
+
+-- name: get-deleted-entries
+-- Gets entry tombstones after the given (deleted_at, id) position, ordered by
+-- the position, for removing deleted entries from an external search index.
+SELECT id, guid, deleted_at FROM deleted_entries
+    WHERE (deleted_at, id) > ($1, $2)
+    ORDER BY deleted_at, id LIMIT $3;
+
 -- name: get-parent-relations
 SELECT entries.*, relations.id as relation_id FROM entries
     LEFT JOIN relations ON (relations.from_id = entries.id)
     WHERE to_id = $1
     ORDER BY weight;
 
+-- name: get-reverse-defs
+-- Enabled definitions in a language ($2) of the enabled headwords in a language
+-- ($1) after the given relation ID ($3) for generating the reverse dictionary.
+-- Relations that were themselves generated ($4 tag) aren't reversed again.
+SELECT r.id, r.from_id, r.types, d.content FROM relations r
+    INNER JOIN entries e ON e.id = r.from_id
+    INNER JOIN entries d ON d.id = r.to_id
+    WHERE e.lang = $1 AND d.lang = $2 AND r.id > $3
+        AND e.status = 'enabled' AND d.status = 'enabled' AND r.status = 'enabled'
+        AND NOT ($4 = ANY(r.tags))
+    ORDER BY r.id LIMIT $5;
+
+-- name: get-reindex-entries
+-- Entries in a language ($1) after the given ID ($2) for re-normalizing and re-tokenizing.
+SELECT id, content, lang FROM entries WHERE lang = $1 AND id > $2 ORDER BY id LIMIT $3;
+
+-- name: reindex-entry
+-- Update the normalized content ($2) and the tokens of an entry, either by tokenizing
+-- the (normalized) content with the Postgres tokenizer ($3) or with the given tokens ($4).
+UPDATE entries SET
+    normalized = $2,
+    tokens = (CASE WHEN $3 != '' THEN TO_TSVECTOR($3::regconfig, COALESCE(NULLIF($2, ''), content)) ELSE $4::TSVECTOR END)
+    WHERE id = $1;
+
+-- name: search-tsquery
+-- Returns the fulltext tsquery that the search query prepares from the query ($1),
+-- the Postgres dictionary ($2), the external tokens ($3), and the tsquery expression ($4).
+SELECT (
+    CASE WHEN $2 != '' AND $4 != '' THEN
+        TO_TSQUERY($2::regconfig, $4)
+    WHEN $2 != '' THEN
+        CASE WHEN POSITION(' ' IN $1::TEXT) > 0 OR POSITION('-' IN $1::TEXT) > 0 THEN
+            PLAINTO_TSQUERY($2::regconfig, $1) || PLAINTO_TSQUERY($2::regconfig, REPLACE(REPLACE($1, ' ', ''), '-', ''))
+        ELSE
+            PLAINTO_TSQUERY($2::regconfig, $1)
+        END
+    ELSE
+        $3::TSQUERY
+    END
+)::TEXT;
+
+-- name: tokenize
+-- Tokenizes a string ($3) into a tsvector with a Postgres dictionary ($1) or from
+-- externally computed tokens ($2), the same way as entries, and returns its lexemes.
+WITH v AS (
+    SELECT (CASE WHEN $1 != '' THEN TO_TSVECTOR($1::regconfig, $3::TEXT) ELSE $2::TSVECTOR END) AS tokens
+)
+SELECT tokens::TEXT AS tsvector, ARRAY(SELECT lexeme FROM UNNEST(tokens)) AS tokens FROM v;
+
 -- name: get-initials
 -- Gets the list of unique "initial"s (first character) across all the words
--- for a given language. Useful for building indexes and glossaries.
-SELECT DISTINCT(initial) as initial FROM entries
+-- for a given language from the materialized counts. Useful for building
+-- indexes and glossaries.
+SELECT initial FROM mat_entry_counts
     WHERE lang=$1 AND initial != '' AND status='enabled'
     ORDER BY initial;
 
 
 -- name: get-glossary-words
--- Gets words for a language to build a glossary.
-SELECT COUNT(*) OVER () AS total, e.id, e.content FROM entries e
+-- Gets words for a language to build a glossary. The total is from the materialized counts.
+SELECT (SELECT COALESCE(SUM(glossary_num), 0)::INT FROM mat_entry_counts
+        WHERE lang=$1 AND initial=$2 AND status='enabled') AS total, e.id, e.guid, e.content FROM entries e
     LEFT JOIN relations ON (relations.to_id = e.id)
     WHERE relations.to_id IS NULL AND e.lang=$1 AND e.initial=$2 AND e.status='enabled'
     ORDER BY e.weight OFFSET $3 LIMIT $4;
 
+-- The *-collated queries are prepared for every language that has a `collation`
+-- config with {collation} replaced by the quoted collation name (eg: "de-x-icu").
+
+-- name: get-initials-collated
+SELECT initial FROM mat_entry_counts
+    WHERE lang=$1 AND initial != '' AND status='enabled'
+    ORDER BY initial COLLATE {collation};
+
+-- name: get-glossary-words-collated
+-- Gets words for a language to build a glossary in the language's alphabetical order.
+SELECT (SELECT COALESCE(SUM(glossary_num), 0)::INT FROM mat_entry_counts
+        WHERE lang=$1 AND initial=$2 AND status='enabled') AS total, e.id, e.guid, e.content FROM entries e
+    LEFT JOIN relations ON (relations.to_id = e.id)
+    WHERE relations.to_id IS NULL AND e.lang=$1 AND e.initial=$2 AND e.status='enabled'
+    ORDER BY e.content COLLATE {collation}, e.id OFFSET $3 LIMIT $4;
+
+-- name: get-glossary-words-after-collated
+-- Gets the glossary words for a language (and an optional initial) after the
+-- given (content, ID) in the language's alphabetical order, for streaming the full glossary.
+SELECT e.id, e.guid, e.content FROM entries e
+    WHERE e.lang=$1 AND ($2 = '' OR e.initial=$2) AND e.status='enabled'
+    AND ($4 = 0 OR (e.content COLLATE {collation}, e.id) > ($3::TEXT COLLATE {collation}, $4))
+    AND NOT EXISTS (SELECT 1 FROM relations r WHERE r.to_id = e.id)
+    ORDER BY e.content COLLATE {collation}, e.id LIMIT $5;
+
+-- name: get-glossary-words-after
+-- Gets the glossary words for a language (and an optional initial) after the
+-- given ID, ordered by ID, for streaming the full glossary.
+SELECT e.id, e.guid, e.content FROM entries e
+    WHERE e.lang=$1 AND ($2 = '' OR e.initial=$2) AND e.status='enabled' AND e.id > $3
+    AND NOT EXISTS (SELECT 1 FROM relations r WHERE r.to_id = e.id)
+    ORDER BY e.id LIMIT $4;
+
+-- name: get-headwords
+-- Gets the unique lowercased headwords (entries with definitions) of a language.
+-- Used for building spelling correctors.
+SELECT DISTINCT LOWER(e.content) FROM entries e
+    WHERE e.lang=$1 AND e.status='enabled'
+    AND EXISTS (SELECT 1 FROM relations r WHERE r.from_id = e.id);
+
+-- name: get-index-words
+-- Gets the headwords of a language along with their first definition (gloss)
+-- in the target language ($2, optional) after the given ID, ordered by ID.
+-- Used for building search indexes for client side search.
+SELECT e.id, e.guid, e.content, COALESCE((
+        SELECT d.content FROM relations r
+        INNER JOIN entries d ON (d.id = r.to_id)
+        WHERE r.from_id = e.id AND ($2 = '' OR d.lang = $2) AND r.status = 'enabled' AND d.status = 'enabled'
+        ORDER BY r.weight LIMIT 1
+    ), '') AS gloss
+    FROM entries e
+    WHERE e.lang = $1 AND e.status = 'enabled' AND e.id > $3
+    AND EXISTS (SELECT 1 FROM relations WHERE from_id = e.id)
+    ORDER BY e.id LIMIT $4;
+
+-- name: get-recent-entries
+-- Gets the latest enabled headwords in a language ($1, optional) along with
+-- their first definition in the target language ($2, optional) for feeds.
+SELECT e.guid, e.content, e.lang, e.slug, e.created_at, COALESCE((
+        SELECT d.content FROM relations r
+        INNER JOIN entries d ON (d.id = r.to_id)
+        WHERE r.from_id = e.id AND ($2 = '' OR d.lang = $2) AND r.status = 'enabled' AND d.status = 'enabled'
+        ORDER BY r.weight LIMIT 1
+    ), '') AS gloss
+    FROM entries e
+    WHERE ($1 = '' OR e.lang = $1) AND e.status = 'enabled'
+    AND EXISTS (
+        SELECT 1 FROM relations r
+        INNER JOIN entries d ON (d.id = r.to_id)
+        WHERE r.from_id = e.id AND ($2 = '' OR d.lang = $2)
+    )
+    ORDER BY e.id DESC LIMIT $3;
+
 -- name: insert-entry
 WITH w AS (
     -- If weight ($4) is 0, compute a new weight by looking up the last weight
     -- for the initial of the given word and add +1 to it.
     SELECT MAX(weight) + 1 AS weight FROM entries WHERE $3=0 AND (initial=$2 AND lang=$6)
 )
-INSERT INTO entries (content, initial, weight, tokens, lang, tags, phones, notes, meta, status)
+-- If the language has normalization, the normalized content ($12) is tokenized.
+INSERT INTO entries (content, initial, weight, tokens, lang, tags, phones, notes, meta, status, normalized, source, license, attribution)
     VALUES(
         $1,
         $2,
         COALESCE((SELECT weight FROM w), $3),
-        (CASE WHEN $5 != '' THEN TO_TSVECTOR($5::regconfig, $1::TEXT) ELSE $4::TSVECTOR END),
+        (CASE WHEN $5 != '' THEN TO_TSVECTOR($5::regconfig, COALESCE(NULLIF($12, ''), $1)::TEXT) ELSE $4::TSVECTOR END),
         $6,
         $7,
         $8,
         $9,
         $10,
-        $11
+        $11,
+        $12,
+        $13,
+        $14,
+        $15
     )
     RETURNING id;
 
@@ -163,8 +558,36 @@ UPDATE entries SET
     notes = (CASE WHEN $9 != '' THEN $9 ELSE notes END),
     meta = (CASE WHEN $10 != '' THEN $10::JSONB ELSE meta END),
     status = (CASE WHEN $11 != '' THEN $11::entry_status ELSE status END),
+    -- Entries that are enabled aren't published by the scheduler anymore.
+    publish_at = (CASE WHEN $11 = 'enabled' THEN NULL ELSE publish_at END),
+    slug = (CASE WHEN $12 != '' THEN $12 ELSE slug END),
+    -- Normalized content ($14) of the updated content in the given language.
+    normalized = (CASE WHEN $2 != '' AND $6 != '' THEN $14 ELSE normalized END),
+    source = (CASE WHEN $15 != '' THEN $15 ELSE source END),
+    license = (CASE WHEN $16 != '' THEN $16 ELSE license END),
+    attribution = (CASE WHEN $17 != '' THEN $17 ELSE attribution END),
     updated_at = NOW()
-    WHERE id = $1;
+    -- If the updated_at ($13) of the entry as loaded by the client is given, only update
+    -- the entry if it hasn't been modified since (optimistic concurrency).
+    WHERE id = $1 AND ($13::TIMESTAMP WITH TIME ZONE IS NULL OR updated_at = $13);
+
+-- name: lock-entry
+-- Acquire or renew the edit lock on an entry for $3 seconds. A lock held by another
+-- user is only taken over once it has expired. Returns the current lock either way.
+WITH l AS (
+    INSERT INTO entry_locks (entry_id, username, expires_at) VALUES($1, $2, NOW() + ($3 * INTERVAL '1 second'))
+    ON CONFLICT (entry_id) DO UPDATE SET username = EXCLUDED.username, expires_at = EXCLUDED.expires_at,
+        created_at = (CASE WHEN entry_locks.username = EXCLUDED.username THEN entry_locks.created_at ELSE NOW() END)
+        WHERE entry_locks.username = EXCLUDED.username OR entry_locks.expires_at < NOW()
+    RETURNING *
+)
+SELECT * FROM l UNION ALL SELECT * FROM entry_locks WHERE entry_id = $1 AND NOT EXISTS (SELECT 1 FROM l);
+
+-- name: get-entry-lock
+SELECT * FROM entry_locks WHERE entry_id = $1 AND expires_at > NOW();
+
+-- name: unlock-entry
+DELETE FROM entry_locks WHERE entry_id = $1 AND username = $2;
 
 -- name: insert-relation
 WITH w AS (
@@ -172,8 +595,8 @@ WITH w AS (
     -- for the initial of the given word and add +1 to it.
     SELECT MAX(weight) + 1 AS weight FROM relations WHERE $6=0 AND from_id=$1
 )
-INSERT INTO relations (from_id, to_id, types, tags, notes, weight, status)
-    VALUES($1, $2, $3, $4, $5, COALESCE((SELECT weight FROM w), $6), $7) RETURNING id;
+INSERT INTO relations (from_id, to_id, types, tags, notes, weight, status, gender, register, domains)
+    VALUES($1, $2, $3, $4, $5, COALESCE((SELECT weight FROM w), $6), $7, $8, $9, $10) RETURNING id;
 
 -- name: reorder-relations
 -- Updates the weights from 1 to N given ordered relation IDs in an array. 
@@ -182,20 +605,250 @@ UPDATE relations AS r SET weight = c.weight
     WHERE c.id = r.id;
 
 -- name: delete-entry
+-- Move an entry to the trash along with the rows that are deleted with it,
+-- its relations (in both directions), their examples and media, etymology links,
+-- and editor comments, and delete it.
+WITH e AS (
+    SELECT * FROM entries WHERE id = $1
+),
+rels AS (
+    SELECT * FROM relations WHERE from_id = $1 OR to_id = $1
+),
+t AS (
+    INSERT INTO trash (type, entity_id, label, data, deleted_by)
+    SELECT 'entry', e.id, e.content, JSONB_BUILD_OBJECT(
+        'entry', TO_JSONB(e),
+        'relations', COALESCE((SELECT JSONB_AGG(TO_JSONB(r)) FROM rels r), '[]'),
+        'examples', COALESCE((SELECT JSONB_AGG(TO_JSONB(x)) FROM examples x WHERE x.relation_id IN (SELECT id FROM rels)), '[]'),
+        'media', COALESCE((SELECT JSONB_AGG(TO_JSONB(m)) FROM media m WHERE m.entry_id = $1 OR m.relation_id IN (SELECT id FROM rels)), '[]'),
+        'etymology_links', COALESCE((SELECT JSONB_AGG(TO_JSONB(l)) FROM etymology_links l WHERE l.entry_id = $1 OR l.target_id = $1), '[]'),
+        'editor_comments', COALESCE((SELECT JSONB_AGG(TO_JSONB(c)) FROM editor_comments c WHERE c.entry_id = $1), '[]')
+    ), $2 FROM e
+)
 DELETE FROM entries WHERE id=$1;
 
+-- name: preview-delete-entry
+-- Counts of the rows that would be deleted with an entry ($1) (see delete-entry),
+-- and the GUIDs of the entry and the entries related to it.
+WITH rels AS (
+    SELECT * FROM relations WHERE from_id = $1 OR to_id = $1
+)
+SELECT JSON_BUILD_OBJECT(
+        'entries', (SELECT COUNT(*) FROM entries WHERE id = $1),
+        'relations', (SELECT COUNT(*) FROM rels),
+        'examples', (SELECT COUNT(*) FROM examples WHERE relation_id IN (SELECT id FROM rels)),
+        'media', (SELECT COUNT(*) FROM media WHERE entry_id = $1 OR relation_id IN (SELECT id FROM rels)),
+        'etymology_links', (SELECT COUNT(*) FROM etymology_links WHERE entry_id = $1 OR target_id = $1),
+        'editor_comments', (SELECT COUNT(*) FROM editor_comments WHERE entry_id = $1)
+    ) AS counts,
+    ARRAY(
+        SELECT guid::TEXT FROM entries WHERE id = $1
+        UNION ALL
+        SELECT DISTINCT e.guid::TEXT FROM rels r
+            JOIN entries e ON (e.id = (CASE WHEN r.from_id = $1 THEN r.to_id ELSE r.from_id END))
+            WHERE e.id != $1
+    ) AS guids;
+
 -- name: delete-relation
+-- Move a relation to the trash along with its examples and media, and delete it.
+WITH r AS (
+    SELECT * FROM relations WHERE id = $1
+),
+t AS (
+    INSERT INTO trash (type, entity_id, label, data, deleted_by)
+    SELECT 'relation', r.id, CONCAT(f.content, ' → ', d.content), JSONB_BUILD_OBJECT(
+        'relations', JSONB_BUILD_ARRAY(TO_JSONB(r)),
+        'examples', COALESCE((SELECT JSONB_AGG(TO_JSONB(x)) FROM examples x WHERE x.relation_id = $1), '[]'),
+        'media', COALESCE((SELECT JSONB_AGG(TO_JSONB(m)) FROM media m WHERE m.relation_id = $1), '[]')
+    ), $2 FROM r
+    JOIN entries f ON (f.id = r.from_id)
+    JOIN entries d ON (d.id = r.to_id)
+)
 DELETE FROM relations WHERE id=$1;
 
+-- name: preview-delete-relation
+-- Counts of the rows that would be deleted with a relation ($1) (see delete-relation),
+-- and the GUIDs of the entries it relates.
+SELECT JSON_BUILD_OBJECT(
+        'relations', (SELECT COUNT(*) FROM relations WHERE id = $1),
+        'examples', (SELECT COUNT(*) FROM examples WHERE relation_id = $1),
+        'media', (SELECT COUNT(*) FROM media WHERE relation_id = $1)
+    ) AS counts,
+    ARRAY(SELECT e.guid::TEXT FROM relations r JOIN entries e ON (e.id IN (r.from_id, r.to_id)) WHERE r.id = $1) AS guids;
+
+-- name: get-trash
+SELECT COUNT(*) OVER () AS total, id, type, entity_id, label, deleted_by, deleted_at FROM trash
+    WHERE ($1 = '' OR type = $1)
+    ORDER BY deleted_at DESC, id DESC OFFSET $2 LIMIT $3;
+
+-- name: get-trash-item
+SELECT * FROM trash WHERE id = $1;
+
+-- name: restore-trash
+-- Restore a trashed entry or relation and its dependent rows, and remove it from the trash.
+-- Rows that link to entries or relations that no longer exist are skipped. Restored
+-- entries are marked as updated so that they're picked up by incremental syncs.
+WITH t AS (
+    DELETE FROM trash WHERE id = $1 RETURNING type, entity_id, data
+),
+e AS (
+    INSERT INTO entries
+    SELECT (JSONB_POPULATE_RECORD(NULL::entries, t.data->'entry' || JSONB_BUILD_OBJECT('updated_at', NOW()))).*
+        FROM t WHERE t.type = 'entry'
+    RETURNING id
+),
+r AS (
+    INSERT INTO relations
+    SELECT r.* FROM t, JSONB_POPULATE_RECORDSET(NULL::relations, t.data->'relations') r
+        WHERE (r.from_id IN (SELECT id FROM e) OR r.from_id IN (SELECT id FROM entries))
+        AND (r.to_id IN (SELECT id FROM e) OR r.to_id IN (SELECT id FROM entries))
+    ON CONFLICT DO NOTHING
+    RETURNING id
+),
+x AS (
+    INSERT INTO examples
+    SELECT x.* FROM t, JSONB_POPULATE_RECORDSET(NULL::examples, t.data->'examples') x
+        WHERE x.relation_id IN (SELECT id FROM r)
+    ON CONFLICT DO NOTHING
+),
+m AS (
+    INSERT INTO media
+    SELECT m.* FROM t, JSONB_POPULATE_RECORDSET(NULL::media, t.data->'media') m
+        WHERE (m.entry_id IN (SELECT id FROM e) OR m.entry_id IN (SELECT id FROM entries))
+        AND (m.relation_id IS NULL OR m.relation_id IN (SELECT id FROM r))
+    ON CONFLICT DO NOTHING
+),
+l AS (
+    INSERT INTO etymology_links
+    SELECT l.* FROM t, JSONB_POPULATE_RECORDSET(NULL::etymology_links, t.data->'etymology_links') l
+        WHERE (l.entry_id IN (SELECT id FROM e) OR l.entry_id IN (SELECT id FROM entries))
+        AND (l.target_id IN (SELECT id FROM e) OR l.target_id IN (SELECT id FROM entries))
+    ON CONFLICT DO NOTHING
+),
+c AS (
+    INSERT INTO editor_comments
+    SELECT c.* FROM t, JSONB_POPULATE_RECORDSET(NULL::editor_comments, t.data->'editor_comments') c
+        WHERE c.entry_id IN (SELECT id FROM e)
+    ON CONFLICT DO NOTHING
+)
+SELECT type, entity_id FROM t;
+
+-- name: delete-trash
+-- Permanently delete a trashed item ($1), all items ($1 = 0 and $2 = 0), or items
+-- deleted more than $2 days ago. Returns the uploaded files of their media.
+WITH t AS (
+    DELETE FROM trash WHERE
+        (CASE WHEN $1 > 0 THEN id = $1
+              WHEN $2 > 0 THEN deleted_at < NOW() - ($2 * INTERVAL '1 day')
+              ELSE TRUE END)
+    RETURNING data
+)
+SELECT COALESCE(m->>'filename', '') AS filename, COALESCE(m->>'thumb_filename', '') AS thumb_filename
+    FROM t, JSONB_ARRAY_ELEMENTS(COALESCE(t.data->'media', '[]')) m;
+
+-- name: preview-delete-trash
+-- Counts of the trashed items that would be permanently deleted (see delete-trash),
+-- and the GUIDs of up to $3 of their entries.
+WITH t AS (
+    SELECT * FROM trash WHERE
+        (CASE WHEN $1 > 0 THEN id = $1
+              WHEN $2 > 0 THEN deleted_at < NOW() - ($2 * INTERVAL '1 day')
+              ELSE TRUE END)
+)
+SELECT JSON_BUILD_OBJECT(
+        'trash', (SELECT COUNT(*) FROM t),
+        'entries', (SELECT COUNT(*) FROM t WHERE type = 'entry'),
+        'relations', (SELECT COUNT(*) FROM t WHERE type = 'relation'),
+        'media', (SELECT COUNT(*) FROM t, JSONB_ARRAY_ELEMENTS(COALESCE(t.data->'media', '[]')))
+    ) AS counts,
+    ARRAY(SELECT t.data->'entry'->>'guid' FROM t WHERE type = 'entry' ORDER BY id LIMIT $3) AS guids;
+
 -- name: get-stats
-SELECT JSON_BUILD_OBJECT('entries', (SELECT COUNT(*) FROM entries),
-                            'relations', (SELECT COUNT(*) FROM relations),
+-- $1: number of days (including today) of the time series and top lists.
+-- The entry and relation counts are from the materialized counts.
+WITH days AS (
+    SELECT d::DATE AS day FROM GENERATE_SERIES(CURRENT_DATE - ($1::INT - 1), CURRENT_DATE, '1 day') d
+)
+SELECT JSON_BUILD_OBJECT('entries', (SELECT COALESCE(SUM(num), 0) FROM mat_entry_counts),
+                            'relations', (SELECT COALESCE(SUM(num), 0) FROM mat_relation_counts),
                             'languages', (
                                 SELECT JSON_OBJECT_AGG (lang, num) FROM
-                                (SELECT lang, COUNT(*) AS num FROM entries GROUP BY lang) r
+                                (SELECT lang, SUM(num) AS num FROM mat_entry_counts GROUP BY lang) r
+                            ),
+                            'language_statuses', (
+                                SELECT JSON_OBJECT_AGG(lang, statuses) FROM (
+                                    SELECT lang, JSON_OBJECT_AGG(status, num) AS statuses FROM
+                                    (SELECT lang, status, SUM(num) AS num FROM mat_entry_counts GROUP BY lang, status) s
+                                    GROUP BY lang
+                                ) r
+                            ),
+                            'pending', (SELECT COALESCE(SUM(num), 0) FROM mat_entry_counts WHERE status = 'pending'),
+                            'counts_updated_at', (SELECT value FROM settings WHERE key = 'stats.counts_updated_at'),
+                            'pending_comments', (SELECT COUNT(*) FROM comments),
+                            'entries_per_day', (
+                                SELECT JSON_AGG(JSON_BUILD_OBJECT('date', days.day, 'count', COALESCE(n.num, 0)) ORDER BY days.day)
+                                FROM days LEFT JOIN (
+                                    SELECT created_at::DATE AS day, COUNT(*) AS num FROM entries
+                                    WHERE created_at >= (SELECT MIN(day) FROM days) GROUP BY created_at::DATE
+                                ) n ON n.day = days.day
+                            ),
+                            'contributors', (
+                                SELECT JSON_AGG(c) FROM (
+                                    SELECT username, COUNT(*) AS changes FROM audit_log
+                                    WHERE username != '' AND created_at >= (SELECT MIN(day) FROM days)
+                                    GROUP BY username ORDER BY changes DESC LIMIT 10
+                                ) c
+                            ),
+                            'zero_result_searches', (
+                                SELECT JSON_AGG(s) FROM (
+                                    SELECT from_lang, to_lang, query, count, updated_at FROM search_misses
+                                    WHERE updated_at >= (SELECT MIN(day) FROM days)
+                                    ORDER BY count DESC, updated_at DESC LIMIT 20
+                                ) s
                             )
                         );
 
+-- name: insert-search-miss
+INSERT INTO search_misses (from_lang, to_lang, query) VALUES($1, $2, LOWER(LEFT($3, 200)))
+    ON CONFLICT (from_lang, to_lang, query) DO UPDATE SET count = search_misses.count + 1, updated_at = NOW();
+
+-- name: get-missing-translations
+-- Headwords in a language ($1) that have no definitions in another language ($2), optionally
+-- with any of the tags ($3), most frequent first. Entries that are only the definitions of
+-- other entries aren't headwords, and disabled entries are left out.
+SELECT COUNT(*) OVER () AS total, e.* FROM entries e
+    WHERE e.lang = $1 AND e.status != 'disabled'
+    AND (CARDINALITY($3::TEXT[]) = 0 OR e.tags && $3::TEXT[])
+    AND (
+        EXISTS (SELECT 1 FROM relations WHERE from_id = e.id)
+        OR NOT EXISTS (SELECT 1 FROM relations WHERE to_id = e.id)
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM relations r INNER JOIN entries d ON (d.id = r.to_id)
+        WHERE r.from_id = e.id AND d.lang = $2
+    )
+    ORDER BY e.frequency_rank NULLS LAST, e.weight, e.id
+    OFFSET $4 LIMIT $5;
+
+-- name: get-missing-refs
+-- Definitions that refer to other headwords, that is, relations tagged xref (cross-references)
+-- or between entries in the same language (except in the same language dictionaries of the
+-- languages in $3), where the referred entry is disabled or has no definitions of its own.
+-- The optional filters select the headwords' language ($1) and the relations' tags ($2).
+SELECT COUNT(*) OVER () AS total, r.id AS relation_id, r.types, r.tags,
+    e.id AS entry_id, e.content AS entry_content, e.lang,
+    d.id AS ref_id, d.content AS ref_content,
+    (CASE WHEN d.status = 'disabled' THEN 'disabled' ELSE 'no_definitions' END) AS reason
+    FROM relations r
+    INNER JOIN entries e ON (e.id = r.from_id)
+    INNER JOIN entries d ON (d.id = r.to_id)
+    WHERE ($1 = '' OR e.lang = $1)
+    AND (CARDINALITY($2::TEXT[]) = 0 OR r.tags && $2::TEXT[])
+    AND (r.tags @> '{xref}' OR (d.lang = e.lang AND e.lang != ALL($3::TEXT[])))
+    AND (d.status = 'disabled' OR NOT EXISTS (SELECT 1 FROM relations WHERE from_id = d.id))
+    ORDER BY r.id
+    OFFSET $4 LIMIT $5;
+
 -- name: insert-submission-entry
 -- This differs from insert-entry which always inserts a new non-unique entry for content+lang.
 -- This query checks if content+lang exists and returns its ID. If it doesn't exist, the entry
@@ -210,18 +863,22 @@ old AS (
     LIMIT 1
 ),
 e AS (
-    INSERT INTO entries (content, initial, weight, tokens, lang, tags, phones, notes, meta, status)
+    INSERT INTO entries (content, initial, weight, tokens, lang, tags, phones, notes, meta, status, normalized, source, license, attribution)
     SELECT
         $1,
         $2,
         COALESCE((SELECT weight FROM w), $3),
-        (CASE WHEN $5::TEXT != '' THEN TO_TSVECTOR($5::regconfig, $1::TEXT) ELSE $4::TSVECTOR END),
+        (CASE WHEN $5::TEXT != '' THEN TO_TSVECTOR($5::regconfig, COALESCE(NULLIF($12, ''), $1)::TEXT) ELSE $4::TSVECTOR END),
         $6,
         $7,
         $8,
         $9,
         $10,
-        $11
+        $11,
+        $12,
+        $13,
+        $14,
+        $15
     WHERE NOT EXISTS (SELECT * FROM old)
     RETURNING id
 )
@@ -238,22 +895,102 @@ w AS (
     SELECT MAX(weight) + 1 AS weight FROM relations WHERE from_id=$1 AND $6=0
 ),
 e AS (
-    INSERT INTO relations (from_id, to_id, types, tags, notes, weight, status)
-    SELECT $1, $2, $3, $4, $5, COALESCE((SELECT weight FROM w), $6), $7
+    INSERT INTO relations (from_id, to_id, types, tags, notes, weight, status, gender, register, domains)
+    SELECT $1, $2, $3, $4, $5, COALESCE((SELECT weight FROM w), $6), $7, $8, $9, $10
     WHERE NOT EXISTS (SELECT * FROM old)
     RETURNING id
 )
 SELECT id FROM e UNION ALL SELECT id FROM old;
 
+-- name: import-staged
+-- Inserts a batch of entries that the importer has copied into import_stage in
+-- the same transaction, and deletes them from the stage. seq is the position of
+-- the main entry in the batch and pos is 0 for main entries and 1..N for their
+-- definitions. Like insert-submission-entry, entries with the same content+lang
+-- as existing entries (or earlier entries in the batch) aren't inserted and the
+-- existing ones are related instead. Definitions with an entry_id are related to
+-- that existing entry. $1 is the number of main entries imported before the batch,
+-- which offsets their weights.
+WITH s AS (
+    DELETE FROM import_stage RETURNING *, LOWER(SUBSTRING(content, 0, 50)) AS key
+),
+old AS (
+    SELECT DISTINCT ON (s.key, s.lang) s.key, s.lang, e.id FROM s
+    JOIN entries e ON (LOWER(SUBSTRING(e.content, 0, 50)) = s.key AND e.lang = s.lang AND e.status != 'disabled')
+    WHERE s.entry_id = 0
+    ORDER BY s.key, s.lang, e.id
+),
+new AS (
+    SELECT DISTINCT ON (key, lang) * FROM s
+    WHERE entry_id = 0 AND NOT EXISTS (SELECT 1 FROM old WHERE old.key = s.key AND old.lang = s.lang)
+    ORDER BY key, lang, seq, pos
+),
+ins AS (
+    INSERT INTO entries (content, initial, weight, tokens, lang, tags, phones, notes, meta, status, normalized)
+    SELECT
+        content,
+        initial,
+        -- As in insert-entry, a weight of 0 is computed from the last weight of the initial.
+        COALESCE(
+            NULLIF(CASE WHEN pos = 0 THEN weight + $1 ELSE weight END, 0),
+            (SELECT MAX(e.weight) + 1 FROM entries e WHERE e.initial = new.initial AND e.lang = new.lang),
+            0
+        ),
+        (CASE WHEN tokenizer != '' THEN TO_TSVECTOR(tokenizer::regconfig, COALESCE(NULLIF(normalized, ''), content)) ELSE tokens::TSVECTOR END),
+        lang,
+        tags,
+        phones,
+        notes,
+        meta::JSONB,
+        'enabled',
+        normalized
+    FROM new ORDER BY seq, pos
+    RETURNING id, LOWER(SUBSTRING(content, 0, 50)) AS key, lang
+),
+ids AS (
+    SELECT key, lang, id FROM old UNION ALL SELECT key, lang, id FROM ins
+),
+-- Entry IDs of all the staged rows.
+e AS (
+    SELECT s.seq, s.pos, (CASE WHEN s.entry_id != 0 THEN s.entry_id ELSE ids.id END) AS id, s.types, s.rel_tags, s.rel_notes
+    FROM s LEFT JOIN ids ON (s.entry_id = 0 AND ids.key = s.key AND ids.lang = s.lang)
+),
+-- Definitions are added after the existing definitions of main entries, and
+-- existing relations are skipped as in insert-submission-relation.
+rels AS (
+    INSERT INTO relations (from_id, to_id, types, tags, notes, weight, status)
+    SELECT DISTINCT ON (m.id, d.id)
+        m.id,
+        d.id,
+        d.types,
+        d.rel_tags,
+        d.rel_notes,
+        COALESCE((SELECT MAX(r.weight) + 1 FROM relations r WHERE r.from_id = m.id), 0) + d.pos - 1,
+        'enabled'
+    FROM e d JOIN e m ON (m.seq = d.seq AND m.pos = 0)
+    WHERE d.pos > 0
+    ORDER BY m.id, d.id, d.seq, d.pos
+    ON CONFLICT (from_id, to_id) DO NOTHING
+    RETURNING id
+)
+SELECT (SELECT COUNT(*) FROM ins) AS entries, (SELECT COUNT(*) FROM rels) AS relations;
+
 -- name: update-relation
 UPDATE relations SET
     types = (CASE WHEN $2::TEXT[] IS NOT NULL THEN $2 ELSE types END),
     tags = (CASE WHEN $3::TEXT[] IS NOT NULL THEN $3 ELSE tags END),
     notes = $4,
     weight = (CASE WHEN $5::DECIMAL != 0 THEN $5 ELSE weight END),
+    gender = $6,
+    register = $7,
+    domains = (CASE WHEN $8::TEXT[] IS NOT NULL THEN $8 ELSE domains END),
     updated_at = NOW()
 WHERE id = $1;
 
+-- name: get-relation-lang
+-- Gets the language of the definition (to) entry of a relation.
+SELECT e.lang FROM relations r INNER JOIN entries e ON (e.id = r.to_id) WHERE r.id = $1;
+
 -- name: approve-submission
 WITH e AS (
     -- Approve the pending main entry.
@@ -278,8 +1015,8 @@ DELETE FROM relations WHERE from_id = $1 AND status = 'pending';
 
 -- name: insert-comments
 -- Insert comments / suggestions coming from the public.
-WITH f AS (SELECT id FROM entries WHERE $1::TEXT != '' AND guid = $1::UUID),
-     t AS (SELECT id FROM entries WHERE $2::TEXT != '' AND guid = $2::UUID)
+WITH f AS (SELECT id FROM entries WHERE $1::TEXT != '' AND guid = entry_guid($1)),
+     t AS (SELECT id FROM entries WHERE $2::TEXT != '' AND guid = entry_guid($2))
 INSERT INTO comments (from_id, to_id, comments)
     VALUES((SELECT id FROM f), (SELECT id FROM t), $3);
 
@@ -296,3 +1033,739 @@ WITH d1 AS (
     DELETE FROM relations WHERE status = 'pending'
 )
 DELETE FROM comments;
+
+-- name: preview-delete-all-pending
+-- Counts of the rows that would be deleted with all pending entries and relations
+-- (see delete-all-pending), and the GUIDs of up to $1 of the entries.
+WITH e AS (
+    SELECT id, guid FROM entries WHERE status = 'pending'
+)
+SELECT JSON_BUILD_OBJECT(
+        'entries', (SELECT COUNT(*) FROM e),
+        'relations', (SELECT COUNT(*) FROM relations WHERE status = 'pending'
+            OR from_id IN (SELECT id FROM e) OR to_id IN (SELECT id FROM e)),
+        'comments', (SELECT COUNT(*) FROM comments)
+    ) AS counts,
+    ARRAY(SELECT guid::TEXT FROM e ORDER BY id LIMIT $1) AS guids;
+
+-- name: get-editor-comments
+SELECT c.* FROM editor_comments c
+    INNER JOIN entries e ON (e.id = c.entry_id)
+    WHERE e.guid = entry_guid($1)
+    ORDER BY c.created_at;
+
+-- name: insert-editor-comment
+-- Inserts nothing (and returns no rows) if the entry doesn't exist.
+INSERT INTO editor_comments (entry_id, author, comments)
+    SELECT id, $2, $3 FROM entries WHERE guid = entry_guid($1)
+    RETURNING *;
+
+-- name: delete-editor-comment
+DELETE FROM editor_comments WHERE id = $1 AND entry_id = (SELECT id FROM entries WHERE guid = entry_guid($2));
+
+-- name: get-etymology
+-- Gets the etymological links of an entry ($1) and those of the linked entries
+-- recursively up to the given depth ($2) as a flat list of links to enabled entries.
+WITH RECURSIVE links AS (
+    SELECT l.id, l.entry_id, l.target_id, l.type, l.notes, l.weight, 1 AS depth,
+        ARRAY[l.entry_id, l.target_id] AS path
+        FROM etymology_links l WHERE l.entry_id = $1
+    UNION ALL
+    SELECT l.id, l.entry_id, l.target_id, l.type, l.notes, l.weight, links.depth + 1,
+        links.path || l.target_id
+        FROM etymology_links l
+        INNER JOIN links ON (l.entry_id = links.target_id)
+        -- Stop at cycles.
+        WHERE links.depth < $2 AND NOT l.target_id = ANY(links.path)
+),
+uniq AS (
+    SELECT DISTINCT ON (id) * FROM links ORDER BY id, depth
+)
+SELECT uniq.entry_id, uniq.target_id, uniq.type, uniq.notes, e.guid, e.content, e.lang, e.slug, e.etymology
+    FROM uniq INNER JOIN entries e ON (e.id = uniq.target_id)
+    WHERE e.status = 'enabled'
+    ORDER BY uniq.entry_id, uniq.weight, uniq.id;
+
+-- name: update-etymology
+-- Updates the etymology of an entry ($1) and replaces its links with the given JSON
+-- list of links ($3) to entries referenced by GUIDs. Unknown GUIDs violate the
+-- NOT NULL target_id constraint and fail the update.
+WITH e AS (
+    UPDATE entries SET etymology = $2, updated_at = NOW() WHERE id = $1 RETURNING id
+),
+del AS (
+    DELETE FROM etymology_links WHERE entry_id = (SELECT id FROM e) RETURNING id
+)
+INSERT INTO etymology_links (entry_id, target_id, type, notes, weight)
+    SELECT e.id, t.id, l.type::etymology_type, COALESCE(l.notes, ''), l.weight
+    FROM e, JSON_TO_RECORDSET($3::JSON) AS l(guid TEXT, type TEXT, notes TEXT, weight DECIMAL)
+    LEFT JOIN entries t ON (t.guid = entry_guid(l.guid))
+    -- Delete the existing links before inserting so that unchanged links don't conflict.
+    WHERE (SELECT COUNT(*) FROM del) >= 0;
+
+-- name: schedule-entry
+-- Sets the time ($2) at which a disabled or pending entry is published, or
+-- unschedules it if it's NULL. Enabled entries can't be scheduled.
+UPDATE entries SET publish_at = $2
+    WHERE id = $1 AND ($2::TIMESTAMP WITH TIME ZONE IS NULL OR status != 'enabled')
+    RETURNING id;
+
+-- name: get-scheduled-entries
+-- Gets the entries scheduled for publishing, soonest first.
+SELECT COUNT(*) OVER () AS total, e.* FROM entries e
+    WHERE publish_at IS NOT NULL
+    ORDER BY publish_at, id
+    OFFSET $1 LIMIT $2;
+
+-- name: publish-scheduled-entries
+-- Publishes (enables) the scheduled entries that are due and returns their languages.
+WITH e AS (
+    UPDATE entries SET status = 'enabled', publish_at = NULL, updated_at = NOW()
+        WHERE publish_at <= NOW()
+        RETURNING lang
+)
+SELECT DISTINCT lang FROM e;
+
+-- name: get-media
+-- Gets the media of the given entries and of their relations.
+SELECT id, entry_id, COALESCE(relation_id, 0) AS relation_id, filename, thumb_filename, url, thumb_url,
+    content_type, width, height, caption, weight, created_at
+    FROM media WHERE entry_id = ANY($1::INT[])
+    ORDER BY entry_id, weight, id;
+
+-- name: insert-media
+-- Inserts nothing (and returns no rows) if the entry doesn't exist or if the
+-- relation ($2), if it's set, doesn't belong to the entry.
+INSERT INTO media (entry_id, relation_id, filename, thumb_filename, url, thumb_url, content_type, width, height, caption, weight)
+    SELECT e.id, NULLIF($2, 0), $3, $4, $5, $6, $7, $8, $9, $10,
+        COALESCE((SELECT MAX(weight) + 1 FROM media WHERE entry_id = e.id), 0)
+    FROM entries e WHERE e.id = $1
+    AND ($2 = 0 OR EXISTS (SELECT 1 FROM relations WHERE id = $2 AND from_id = e.id))
+    RETURNING id, entry_id, COALESCE(relation_id, 0) AS relation_id, filename, thumb_filename, url, thumb_url,
+        content_type, width, height, caption, weight, created_at;
+
+-- name: get-entries-without-audio
+-- Enabled headwords in a language ($1) after the given ID ($2) that don't have
+-- pronunciation audio, that is, audio media on the entry itself.
+SELECT id, content, lang FROM entries e
+    WHERE lang = $1 AND id > $2 AND status = 'enabled'
+    AND EXISTS (SELECT 1 FROM relations WHERE from_id = e.id)
+    AND NOT EXISTS (SELECT 1 FROM media WHERE entry_id = e.id AND relation_id IS NULL AND content_type LIKE 'audio/%')
+    ORDER BY id LIMIT $3;
+
+-- name: get-headwords-by-tags
+-- Enabled headwords in a language ($1) with any of the tags ($2), if given.
+SELECT * FROM entries e
+    WHERE lang = $1 AND status = 'enabled'
+    AND (COALESCE(CARDINALITY($2::TEXT[]), 0) = 0 OR tags && $2)
+    AND EXISTS (SELECT 1 FROM relations WHERE from_id = e.id)
+    ORDER BY weight, content, id LIMIT $3;
+
+-- name: get-quiz-words
+-- Random enabled headwords in a language ($1), optionally with any of the tags ($3),
+-- with the content of their first enabled definition in the `to` language ($2).
+SELECT e.guid, e.content, e.tags, d.content AS gloss FROM entries e
+    INNER JOIN LATERAL (
+        SELECT def.content FROM relations r
+        INNER JOIN entries def ON def.id = r.to_id
+        WHERE r.from_id = e.id AND def.lang = $2 AND r.status = 'enabled' AND def.status = 'enabled'
+        ORDER BY r.weight, r.id LIMIT 1
+    ) d ON TRUE
+    WHERE e.lang = $1 AND e.status = 'enabled'
+    AND (COALESCE(CARDINALITY($3::TEXT[]), 0) = 0 OR e.tags && $3)
+    ORDER BY RANDOM() LIMIT $4;
+
+-- name: delete-media
+-- Deletes a media item of an entry and returns it to delete its files.
+DELETE FROM media WHERE id = $1 AND entry_id = $2
+    RETURNING id, entry_id, COALESCE(relation_id, 0) AS relation_id, filename, thumb_filename, url, thumb_url,
+        content_type, width, height, caption, weight, created_at;
+
+-- name: get-relation-examples
+-- Gets the usage examples of the given relations.
+SELECT id, relation_id, lang, content, translation, weight, created_at, updated_at
+    FROM examples WHERE relation_id = ANY($1::INT[])
+    ORDER BY relation_id, weight, id;
+
+-- name: insert-example
+-- Inserts nothing (and returns no rows) if the relation doesn't belong to the entry.
+-- If the tokenizer language ($6) is set, the content is tokenized in the DB. Otherwise,
+-- the externally computed tokens ($7) are stored.
+INSERT INTO examples (relation_id, lang, content, translation, tokens, weight)
+    SELECT id, $3, $4, $5,
+        (CASE WHEN $6 != '' THEN TO_TSVECTOR($6::regconfig, $4::TEXT) ELSE $7::TSVECTOR END),
+        $8
+    FROM relations WHERE id = $2 AND from_id = $1
+    RETURNING id, relation_id, lang, content, translation, weight, created_at, updated_at;
+
+-- name: update-example
+UPDATE examples SET
+    lang = $3,
+    content = $4,
+    translation = $5,
+    tokens = (CASE WHEN $6 != '' THEN TO_TSVECTOR($6::regconfig, $4::TEXT) ELSE $7::TSVECTOR END),
+    weight = $8,
+    updated_at = NOW()
+    WHERE id = $1 AND relation_id = $2
+    RETURNING id, relation_id, lang, content, translation, weight, created_at, updated_at;
+
+-- name: delete-example
+DELETE FROM examples WHERE id = $1 AND relation_id = $2;
+
+-- name: search-examples
+-- Searches the examples in a language ($1) of enabled definitions, optionally in a
+-- definition language ($2), with the tokenizer language ($3) and the query ($4), or
+-- an externally tokenized tsquery ($5), or a case insensitive substring ($6) for
+-- languages without tokenizers.
+SELECT COUNT(*) OVER () AS total,
+    x.id, x.relation_id, x.lang, x.content, x.translation, x.weight, x.created_at, x.updated_at,
+    h.guid AS entry_guid, h.content AS entry_content, d.content AS definition
+    FROM examples x
+    INNER JOIN relations r ON (r.id = x.relation_id)
+    INNER JOIN entries h ON (h.id = r.from_id)
+    INNER JOIN entries d ON (d.id = r.to_id)
+    WHERE x.lang = $1
+    AND ($2 = '' OR d.lang = $2)
+    AND (CASE
+        WHEN $3 != '' THEN x.tokens @@ PLAINTO_TSQUERY($3::regconfig, $4::TEXT)
+        WHEN $5 != '' THEN x.tokens @@ $5::TSQUERY
+        ELSE x.content ILIKE $6
+    END)
+    AND r.status = 'enabled' AND h.status = 'enabled' AND d.status = 'enabled'
+    ORDER BY LENGTH(x.content), x.id
+    OFFSET $7 LIMIT $8;
+
+-- name: get-users
+SELECT * FROM users ORDER BY username;
+
+-- name: get-user
+SELECT * FROM users WHERE
+    CASE
+        WHEN $1 > 0 THEN id = $1
+        ELSE username = $2
+    END;
+
+-- name: insert-user
+INSERT INTO users (username, password, name, role, status)
+    VALUES($1, $2, $3, $4, $5)
+    RETURNING id;
+
+-- name: update-user
+-- An empty password retains the existing one.
+UPDATE users SET
+    username = (CASE WHEN $2 != '' THEN $2 ELSE username END),
+    password = (CASE WHEN $3 != '' THEN $3 ELSE password END),
+    name = $4,
+    role = $5,
+    status = $6,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: delete-user
+DELETE FROM users WHERE id = $1;
+
+-- name: insert-audit-log
+INSERT INTO audit_log (username, method, endpoint, entity, entity_id, before, after, ip)
+    VALUES($1, $2, $3, $4, $5, COALESCE(NULLIF($6, ''), 'null')::JSONB, COALESCE(NULLIF($7, ''), 'null')::JSONB, $8);
+
+-- name: get-audit-relation
+-- Gets a relation, comment, or editor comment as JSON for audit log snapshots.
+SELECT ROW_TO_JSON(r) FROM relations r WHERE id = $1;
+
+-- name: get-audit-comment
+SELECT ROW_TO_JSON(c) FROM comments c WHERE id = $1;
+
+-- name: get-audit-editor-comment
+SELECT ROW_TO_JSON(c) FROM editor_comments c WHERE id = $1;
+
+-- name: get-audit-example
+SELECT ROW_TO_JSON(x) FROM examples x WHERE id = $1;
+
+-- name: get-audit-media
+SELECT ROW_TO_JSON(m) FROM media m WHERE id = $1;
+
+-- name: get-audit-trash
+SELECT ROW_TO_JSON(t) FROM trash t WHERE id = $1;
+
+-- name: get-audit-logs
+SELECT COUNT(*) OVER () AS total, * FROM audit_log
+    WHERE ($1 = '' OR username = $1)
+    AND ($2 = '' OR entity = $2)
+    AND ($3 = 0 OR entity_id = $3)
+    AND ($4 = '' OR method = $4)
+    AND ($5::TIMESTAMP WITH TIME ZONE IS NULL OR created_at >= $5)
+    AND ($6::TIMESTAMP WITH TIME ZONE IS NULL OR created_at < $6)
+    ORDER BY id DESC
+    OFFSET $7 LIMIT $8;
+
+-- name: get-replace-entries
+-- Definition entries (that are related to other entries) after the given ID ($1) for a
+-- batch find-and-replace. The optional filters select definitions in the languages ($3),
+-- with any of the tags ($4) on the definitions or on their relations, and that contain
+-- the text ($5).
+SELECT id, content, lang FROM entries e
+    WHERE id > $1
+    AND (CARDINALITY($3::TEXT[]) = 0 OR lang = ANY($3::TEXT[]))
+    AND ($5 = '' OR STRPOS(content, $5) > 0)
+    AND EXISTS (
+        SELECT 1 FROM relations r WHERE r.to_id = e.id
+        AND (CARDINALITY($4::TEXT[]) = 0 OR e.tags && $4::TEXT[] OR r.tags && $4::TEXT[])
+    )
+    ORDER BY id LIMIT $2;
+
+-- name: replace-entry-content
+-- Replaces the content of an entry ($1) if it's unchanged ($2) with the new content ($3)
+-- and its normalized content ($4) and tokens (as in reindex-entry), and returns the
+-- entry's rows before and after the change.
+WITH old AS (
+    SELECT ROW_TO_JSON(e) AS row FROM entries e WHERE id = $1 AND content = $2
+),
+upd AS (
+    UPDATE entries SET
+        content = $3,
+        normalized = $4,
+        tokens = (CASE WHEN $5 != '' THEN TO_TSVECTOR($5::regconfig, COALESCE(NULLIF($4, ''), $3)) ELSE $6::TSVECTOR END),
+        updated_at = NOW()
+    WHERE id = $1 AND content = $2
+    RETURNING *
+)
+SELECT (SELECT row FROM old) AS before, ROW_TO_JSON(u) AS after FROM upd u;
+
+-- name: get-dump-entries
+-- Gets entries with their outgoing relations (referencing the related entries by GUIDs)
+-- after the given ID for a lossless data export. The optional filters select headwords
+-- by language ($3), tags ($5, any of), status ($6), and updated time ($7). The
+-- definitions of the selected headwords are exported with them, and their relations
+-- are limited to definitions in $4 and with the status $6 if they're set.
+SELECT e.id, e.guid, e.short_id, e.content, e.initial, e.weight, e.tokens::TEXT AS tokens, e.lang,
+    e.tags, e.phones, e.notes, e.slug, e.meta, e.status, e.created_at, e.updated_at, e.etymology,
+    e.source, e.license, e.attribution, e.publish_at,
+    COALESCE((
+        SELECT JSON_AGG(JSON_BUILD_OBJECT(
+            'guid', t.guid, 'type', l.type, 'notes', l.notes, 'weight', l.weight
+        ) ORDER BY l.weight, l.id)
+        FROM etymology_links l INNER JOIN entries t ON (t.id = l.target_id)
+        WHERE l.entry_id = e.id
+    ), '[]') AS etymology_links,
+    COALESCE((
+        SELECT JSON_AGG(JSON_BUILD_OBJECT(
+            'to_guid', t.guid, 'types', r.types, 'tags', r.tags, 'notes', r.notes,
+            'weight', r.weight, 'status', r.status, 'gender', r.gender, 'register', r.register,
+            'domains', r.domains,
+            'examples', COALESCE((
+                SELECT JSON_AGG(JSON_BUILD_OBJECT(
+                    'lang', x.lang, 'content', x.content, 'translation', x.translation,
+                    'tokens', x.tokens::TEXT, 'weight', x.weight
+                ) ORDER BY x.weight, x.id)
+                FROM examples x WHERE x.relation_id = r.id
+            ), '[]')
+        ) ORDER BY r.weight, r.id)
+        FROM relations r INNER JOIN entries t ON (t.id = r.to_id)
+        WHERE r.from_id = e.id
+        AND ($4 = '' OR t.lang = $4)
+        AND ($6 = '' OR (r.status = $6::entry_status AND t.status = $6::entry_status))
+    ), '[]') AS relations
+    FROM entries e
+    WHERE e.id > $1
+    AND (
+        -- Headwords that match the filters.
+        (
+            ($3 = '' OR e.lang = $3)
+            AND (CARDINALITY($5::TEXT[]) = 0 OR e.tags && $5)
+            AND ($6 = '' OR e.status = $6::entry_status)
+            AND ($7::TIMESTAMP WITH TIME ZONE IS NULL OR e.updated_at >= $7)
+            AND ($4 = '' OR EXISTS (
+                SELECT 1 FROM relations r INNER JOIN entries t ON (t.id = r.to_id)
+                WHERE r.from_id = e.id AND t.lang = $4
+            ))
+        )
+        -- Definitions of the headwords that match the filters.
+        OR EXISTS (
+            SELECT 1 FROM relations r INNER JOIN entries h ON (h.id = r.from_id)
+            WHERE r.to_id = e.id
+            AND ($4 = '' OR e.lang = $4)
+            AND ($6 = '' OR (r.status = $6::entry_status AND e.status = $6::entry_status))
+            AND ($3 = '' OR h.lang = $3)
+            AND (CARDINALITY($5::TEXT[]) = 0 OR h.tags && $5)
+            AND ($6 = '' OR h.status = $6::entry_status)
+            AND ($7::TIMESTAMP WITH TIME ZONE IS NULL OR h.updated_at >= $7)
+        )
+    )
+    ORDER BY e.id
+    LIMIT $2;
+
+-- name: upsert-dump-entry
+-- Entries without a short ID ($17) get one as per the ID scheme.
+INSERT INTO entries (guid, content, initial, weight, tokens, lang, tags, phones, notes, meta, status, created_at, updated_at, slug, etymology, normalized, short_id,
+    source, license, attribution, publish_at)
+    VALUES($1, $2, $3, $4, $5::TSVECTOR, $6, $7, $8, $9, $10, $11, COALESCE($12, NOW()), COALESCE($13, NOW()), $14, $15, $16,
+        COALESCE(NULLIF($17::TEXT, ''), new_short_id()), $18, $19, $20, $21)
+    ON CONFLICT (guid) DO UPDATE SET
+        content = EXCLUDED.content,
+        normalized = EXCLUDED.normalized,
+        initial = EXCLUDED.initial,
+        weight = EXCLUDED.weight,
+        tokens = EXCLUDED.tokens,
+        lang = EXCLUDED.lang,
+        tags = EXCLUDED.tags,
+        phones = EXCLUDED.phones,
+        notes = EXCLUDED.notes,
+        etymology = EXCLUDED.etymology,
+        source = EXCLUDED.source,
+        license = EXCLUDED.license,
+        attribution = EXCLUDED.attribution,
+        publish_at = EXCLUDED.publish_at,
+        meta = EXCLUDED.meta,
+        status = EXCLUDED.status,
+        slug = (CASE WHEN EXCLUDED.slug != '' THEN EXCLUDED.slug ELSE entries.slug END),
+        short_id = (CASE WHEN $17::TEXT != '' THEN $17::TEXT ELSE entries.short_id END),
+        updated_at = EXCLUDED.updated_at;
+
+-- name: upsert-dump-relation
+-- Relations are only inserted if both the entries exist. The examples of the relation
+-- are replaced with the given JSON list of examples ($11).
+WITH r AS (
+    INSERT INTO relations (from_id, to_id, types, tags, notes, weight, status, gender, register, domains)
+        SELECT f.id, t.id, $3, $4, $5, $6, $7, $8, $9, $10
+        FROM entries f, entries t WHERE f.guid = $1::UUID AND t.guid = $2::UUID
+        ON CONFLICT (from_id, to_id) DO UPDATE SET
+            types = EXCLUDED.types,
+            tags = EXCLUDED.tags,
+            notes = EXCLUDED.notes,
+            weight = EXCLUDED.weight,
+            status = EXCLUDED.status,
+            gender = EXCLUDED.gender,
+            register = EXCLUDED.register,
+            domains = EXCLUDED.domains,
+            updated_at = NOW()
+        RETURNING id
+),
+del AS (
+    DELETE FROM examples WHERE relation_id = (SELECT id FROM r)
+)
+INSERT INTO examples (relation_id, lang, content, translation, tokens, weight)
+    SELECT r.id, x.lang, x.content, COALESCE(x.translation, ''), COALESCE(x.tokens, '')::TSVECTOR, COALESCE(x.weight, 0)
+    FROM r, JSON_TO_RECORDSET($11::JSON) AS x(lang TEXT, content TEXT, translation TEXT, tokens TEXT, weight DECIMAL);
+
+-- name: upsert-dump-etymology
+-- Replaces the etymological links of an entry ($1) with the given JSON list of links ($2)
+-- to entries referenced by GUIDs. Links to entries that don't exist are skipped.
+WITH e AS (
+    SELECT id FROM entries WHERE guid = $1::UUID
+),
+del AS (
+    DELETE FROM etymology_links WHERE entry_id = (SELECT id FROM e) RETURNING id
+)
+INSERT INTO etymology_links (entry_id, target_id, type, notes, weight)
+    SELECT e.id, t.id, l.type::etymology_type, COALESCE(l.notes, ''), COALESCE(l.weight, 0)
+    FROM e, JSON_TO_RECORDSET($2::JSON) AS l(guid UUID, type TEXT, notes TEXT, weight DECIMAL)
+    INNER JOIN entries t ON (t.guid = l.guid)
+    WHERE (SELECT COUNT(*) FROM del) >= 0 AND t.id != e.id
+    ON CONFLICT DO NOTHING;
+
+-- name: get-changes
+-- Gets entries that were created, updated, or deleted after the given (changed_at, kind, id)
+-- cursor position. Entries that are not enabled are reported as deleted.
+WITH changes AS (
+    SELECT id, guid, (CASE WHEN status = 'enabled' THEN 'update' ELSE 'delete' END) AS action,
+        0 AS kind, updated_at AS changed_at
+        FROM entries
+        WHERE (updated_at, 0, id) > ($1, $2::INT, $3::BIGINT)
+    UNION ALL
+    SELECT id, guid, 'delete' AS action, 1 AS kind, deleted_at AS changed_at
+        FROM deleted_entries
+        WHERE (deleted_at, 1, id) > ($1, $2::INT, $3::BIGINT)
+)
+SELECT * FROM changes ORDER BY changed_at, kind, id LIMIT $4;
+
+-- name: insert-job
+INSERT INTO jobs (type, params, created_by) VALUES($1, $2, $3) RETURNING *;
+
+-- name: get-job
+SELECT * FROM jobs WHERE id = $1;
+
+-- name: get-jobs
+-- The (potentially large) logs are not fetched in the list.
+SELECT COUNT(*) OVER () AS total, id, type, status, params, result, created_by, created_at, started_at, finished_at
+    FROM jobs WHERE ($1 = '' OR status = $1::job_status)
+    ORDER BY id DESC
+    OFFSET $2 LIMIT $3;
+
+-- name: next-job
+-- Picks the oldest queued job and marks it as running. Workers in multiple
+-- instances don't pick the same job.
+UPDATE jobs SET status = 'running', started_at = NOW()
+    WHERE id = (
+        SELECT id FROM jobs WHERE status = 'queued' ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED
+    )
+    RETURNING *;
+
+-- name: append-job-log
+UPDATE jobs SET log = log || $2 WHERE id = $1;
+
+-- name: finish-job
+-- Cancelled jobs retain their status.
+UPDATE jobs SET status = (CASE WHEN status = 'cancelled' THEN status ELSE $2::job_status END),
+    result = $3, finished_at = NOW()
+    WHERE id = $1;
+
+-- name: cancel-job
+-- Queued jobs are finished right away. Running jobs are finished by their
+-- workers when they stop.
+UPDATE jobs SET status = 'cancelled', finished_at = (CASE WHEN status = 'queued' THEN NOW() ELSE NULL END)
+    WHERE id = $1 AND status IN ('queued', 'running')
+    RETURNING id;
+
+-- name: get-import-checkpoint
+SELECT * FROM import_checkpoints WHERE key = $1;
+
+-- name: upsert-import-checkpoint
+-- Records the number of rows of a file ($3) and main entries ($4) that have been imported.
+INSERT INTO import_checkpoints (key, name, rows, entries, done) VALUES($1, $2, $3, $4, $5)
+    ON CONFLICT (key) DO UPDATE SET name = EXCLUDED.name, rows = EXCLUDED.rows,
+        entries = EXCLUDED.entries, done = EXCLUDED.done, updated_at = NOW();
+
+-- name: get-setting
+SELECT value FROM settings WHERE key = $1;
+
+-- name: upsert-setting
+INSERT INTO settings (key, value) VALUES($1, $2)
+    ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW();
+
+-- name: refresh-counts
+-- Refreshes the materialized entry and relation counts.
+SELECT refresh_counts();
+
+-- name: notify-event
+-- Notifies other instances of a change ([cluster] in the config).
+SELECT PG_NOTIFY('dictpress', $1);
+
+-- name: backfill-short-ids
+-- Generates short IDs for the entries that don't have one with the short ID scheme.
+WITH u AS (
+    UPDATE entries SET short_id = new_short_id() WHERE short_id = '' AND id_scheme() = 'short' RETURNING 1
+)
+SELECT COUNT(*) FROM u;
+
+-- name: get-langs
+SELECT * FROM langs ORDER BY id;
+
+-- name: upsert-lang
+INSERT INTO langs (id, config, dicts) VALUES($1, $2, $3)
+    ON CONFLICT (id) DO UPDATE SET config = EXCLUDED.config, dicts = EXCLUDED.dicts, updated_at = NOW()
+    RETURNING *;
+
+-- name: delete-lang
+-- Deletes a language unless there are entries in it, or it's also in the config file ($2).
+DELETE FROM langs WHERE id = $1 AND ($2 OR NOT EXISTS (SELECT 1 FROM entries WHERE lang = $1));
+
+-- name: get-ts-configs
+-- Postgres text search configurations that exist out of the given names.
+SELECT cfgname FROM pg_ts_config WHERE cfgname = ANY($1::TEXT[]);
+
+-- name: get-ts-config-schema
+-- Schema of a Postgres text search configuration ($1) or '' if it doesn't exist.
+-- Built-in configurations are in pg_catalog.
+SELECT COALESCE((SELECT n.nspname FROM pg_ts_config c JOIN pg_namespace n ON n.oid = c.cfgnamespace
+    WHERE c.cfgname = $1 ORDER BY n.nspname = 'pg_catalog' DESC LIMIT 1), '');
+
+-- name: insert-reader-token
+-- Inserts a login token ($1, hashed) for an e-mail ($2) that expires in $3 seconds
+-- unless one was issued to it in the past $4 seconds, and clears out expired tokens.
+WITH del AS (
+    DELETE FROM reader_tokens WHERE expires_at < NOW()
+)
+INSERT INTO reader_tokens (token, email, expires_at)
+    SELECT $1, $2, NOW() + ($3 * INTERVAL '1 second')
+    WHERE NOT EXISTS (
+        SELECT 1 FROM reader_tokens WHERE email = $2 AND created_at > NOW() - ($4 * INTERVAL '1 second')
+    );
+
+-- name: login-reader
+-- Consumes a login token ($1, hashed) and creates the reader if it's their first
+-- login, with an empty word list named $2.
+WITH t AS (
+    DELETE FROM reader_tokens WHERE token = $1 AND expires_at > NOW() RETURNING email
+),
+r AS (
+    INSERT INTO readers (email, last_login_at) SELECT email, NOW() FROM t
+    ON CONFLICT (email) DO UPDATE SET last_login_at = NOW()
+    RETURNING *
+),
+l AS (
+    INSERT INTO word_lists (reader_id, name)
+        SELECT r.id, $2 FROM r WHERE NOT EXISTS (SELECT 1 FROM word_lists WHERE reader_id = r.id)
+)
+SELECT * FROM r;
+
+-- name: get-reader
+SELECT * FROM readers WHERE id = $1;
+
+-- name: delete-reader
+DELETE FROM readers WHERE id = $1;
+
+-- name: get-word-lists
+-- Word lists of a reader ($1). has_entry is true for the lists that have the
+-- entry with the GUID $2, if it's given.
+SELECT l.*,
+    (SELECT COUNT(*) FROM word_list_entries WHERE list_id = l.id) AS total,
+    ($2 != '' AND EXISTS (
+        SELECT 1 FROM word_list_entries we INNER JOIN entries e ON (e.id = we.entry_id)
+        WHERE we.list_id = l.id AND e.guid = entry_guid($2)
+    )) AS has_entry
+    FROM word_lists l WHERE l.reader_id = $1
+    ORDER BY l.created_at, l.id;
+
+-- name: get-word-list
+SELECT l.*, (SELECT COUNT(*) FROM word_list_entries WHERE list_id = l.id) AS total, FALSE AS has_entry
+    FROM word_lists l WHERE l.id = $1 AND l.reader_id = $2;
+
+-- name: insert-word-list
+-- A slug is given to the list if it's public ($4).
+WITH seq AS (
+    SELECT NEXTVAL('word_lists_id_seq') AS id
+)
+INSERT INTO word_lists (id, reader_id, name, description, public, slug)
+    SELECT seq.id, $1, $2, $3, $4, (CASE WHEN $4 THEN make_slug($2) || '-' || seq.id ELSE NULL END) FROM seq
+    RETURNING id;
+
+-- name: update-word-list
+-- The slug is set when the list is first made public ($5) and stays after, so that
+-- its links don't break. Lists that are made private are no longer featured.
+UPDATE word_lists SET name = $3, description = $4, public = $5,
+    slug = (CASE WHEN $5 THEN COALESCE(slug, make_slug($3) || '-' || id) ELSE slug END),
+    featured = (featured AND $5),
+    updated_at = NOW()
+    WHERE id = $1 AND reader_id = $2;
+
+-- name: get-public-word-list
+SELECT l.*, (SELECT COUNT(*) FROM word_list_entries WHERE list_id = l.id) AS total, FALSE AS has_entry
+    FROM word_lists l WHERE l.slug = $1 AND l.public = TRUE;
+
+-- name: get-public-word-lists
+-- Public word lists, optionally only the featured ones ($1), most recently updated first.
+SELECT COUNT(*) OVER () AS total_lists, l.*,
+    (SELECT COUNT(*) FROM word_list_entries WHERE list_id = l.id) AS total, FALSE AS has_entry
+    FROM word_lists l WHERE l.public = TRUE AND ($1 = FALSE OR l.featured = TRUE)
+    ORDER BY l.updated_at DESC, l.id DESC OFFSET $2 LIMIT $3;
+
+-- name: update-word-list-featured
+UPDATE word_lists SET featured = $2 WHERE id = $1 AND public = TRUE;
+
+-- name: delete-word-list
+DELETE FROM word_lists WHERE id = $1 AND reader_id = $2;
+
+-- name: get-word-list-entries
+-- Enabled entries in a word list, most recently saved first.
+SELECT e.* FROM word_list_entries we
+    INNER JOIN entries e ON (e.id = we.entry_id)
+    WHERE we.list_id = $1 AND e.status = 'enabled'
+    ORDER BY we.created_at DESC, e.id;
+
+-- name: insert-word-list-entry
+-- Adds an enabled entry by its GUID ($2) to a list ($1). Returns the number of
+-- matching entries (0 if it doesn't exist), whether or not it was already in the list.
+WITH e AS (
+    SELECT id FROM entries WHERE guid = entry_guid($2) AND status = 'enabled'
+),
+ins AS (
+    INSERT INTO word_list_entries (list_id, entry_id) SELECT $1, id FROM e
+    ON CONFLICT (list_id, entry_id) DO NOTHING
+),
+upd AS (
+    UPDATE word_lists SET updated_at = NOW() WHERE id = $1 AND EXISTS (SELECT 1 FROM e)
+)
+SELECT COUNT(*) FROM e;
+
+-- name: delete-word-list-entry
+DELETE FROM word_list_entries WHERE list_id = $1 AND entry_id = (SELECT id FROM entries WHERE guid = entry_guid($2));
+
+-- name: get-redirects
+-- Redirects, optionally with the source or target containing $1, ordered by source.
+SELECT COUNT(*) OVER () AS total, * FROM redirects
+    WHERE $1 = '' OR source ILIKE '%' || $1 || '%' OR target ILIKE '%' || $1 || '%'
+    ORDER BY source OFFSET $2 LIMIT $3;
+
+-- name: get-redirect
+SELECT * FROM redirects WHERE id = $1;
+
+-- name: match-redirect
+-- Returns the redirect of the first of the candidate source paths ($1) that has
+-- one and counts the hit.
+WITH r AS (
+    SELECT id FROM redirects WHERE source = ANY($1::TEXT[])
+    ORDER BY ARRAY_POSITION($1::TEXT[], source) LIMIT 1
+)
+UPDATE redirects SET hits = hits + 1 FROM r WHERE redirects.id = r.id RETURNING redirects.*;
+
+-- name: insert-redirect
+INSERT INTO redirects (source, target, code) VALUES($1, $2, $3) RETURNING *;
+
+-- name: upsert-redirects
+-- Inserts redirects in bulk ($1 sources, $2 targets, $3 codes), replacing
+-- the targets of existing sources. Returns the number of redirects.
+WITH r AS (
+    INSERT INTO redirects (source, target, code)
+        SELECT * FROM UNNEST($1::TEXT[], $2::TEXT[], $3::SMALLINT[])
+    ON CONFLICT (source) DO UPDATE SET target = EXCLUDED.target, code = EXCLUDED.code, updated_at = NOW()
+    RETURNING id
+)
+SELECT COUNT(*) FROM r;
+
+-- name: preview-upsert-redirects
+-- Counts of the redirects that would be inserted and replaced (see upsert-redirects).
+SELECT JSON_BUILD_OBJECT(
+        'redirects', CARDINALITY($1::TEXT[]),
+        'replaced', (SELECT COUNT(*) FROM redirects WHERE source = ANY($1::TEXT[]))
+    ) AS counts,
+    '{}'::TEXT[] AS guids;
+
+-- name: update-redirect
+UPDATE redirects SET source = $2, target = $3, code = $4, updated_at = NOW()
+    WHERE id = $1 RETURNING *;
+
+-- name: delete-redirect
+DELETE FROM redirects WHERE id = $1;
+
+-- name: get-api-keys
+-- API keys with their request counts of the day.
+SELECT api_keys.*, COALESCE(u.requests, 0) AS requests_today FROM api_keys
+    LEFT JOIN api_key_usage u ON (u.key_id = api_keys.id AND u.day = CURRENT_DATE)
+    ORDER BY api_keys.id;
+
+-- name: get-api-key
+SELECT api_keys.*, COALESCE(u.requests, 0) AS requests_today FROM api_keys
+    LEFT JOIN api_key_usage u ON (u.key_id = api_keys.id AND u.day = CURRENT_DATE)
+    WHERE api_keys.id = $1;
+
+-- name: insert-api-key
+INSERT INTO api_keys (name, key_hash, key_prefix, notes, rate_limit, daily_quota, enabled)
+    VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING *, 0 AS requests_today;
+
+-- name: update-api-key
+WITH k AS (
+    UPDATE api_keys SET name = $2, notes = $3, rate_limit = $4, daily_quota = $5, enabled = $6, updated_at = NOW()
+        WHERE id = $1 RETURNING *
+)
+SELECT k.*, COALESCE(u.requests, 0) AS requests_today FROM k
+    LEFT JOIN api_key_usage u ON (u.key_id = k.id AND u.day = CURRENT_DATE);
+
+-- name: delete-api-key
+DELETE FROM api_keys WHERE id = $1;
+
+-- name: record-api-key-usage
+-- Adds the request and rejected counts ($2, $3) of keys ($1) to their counts of
+-- the day. Keys that have been deleted in the meantime are skipped.
+WITH k AS (
+    UPDATE api_keys SET last_used_at = NOW() WHERE id = ANY($1::INT[]) RETURNING id
+)
+INSERT INTO api_key_usage (key_id, requests, rejected)
+    SELECT u.* FROM UNNEST($1::INT[], $2::INT[], $3::INT[]) AS u(key_id, requests, rejected)
+    WHERE u.key_id IN (SELECT id FROM k)
+    ON CONFLICT (key_id, day) DO UPDATE SET requests = api_key_usage.requests + EXCLUDED.requests,
+        rejected = api_key_usage.rejected + EXCLUDED.rejected;
+
+-- name: get-api-key-usage
+-- Daily request counts of a key between two dates.
+SELECT TO_CHAR(day, 'YYYY-MM-DD') AS day, requests, rejected FROM api_key_usage
+    WHERE key_id = $1 AND day >= $2::DATE AND day <= $3::DATE ORDER BY day;
@@ -1,7 +1,59 @@
 CREATE EXTENSION IF NOT EXISTS pgcrypto;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
 
 DROP TYPE IF EXISTS entry_status CASCADE; CREATE TYPE entry_status AS ENUM ('pending', 'enabled', 'disabled');
 
+-- ID scheme of new entries (app.id_scheme in the config: uuidv4 | uuidv7 | short)
+-- that the app records in the settings.
+CREATE OR REPLACE FUNCTION id_scheme() RETURNS TEXT AS $$
+BEGIN
+    RETURN COALESCE((SELECT value #>> '{}' FROM settings WHERE key = 'app.id_scheme'), 'uuidv4');
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+-- Generates a UUIDv7 with a 48 bit Unix timestamp (ms) followed by random bits
+-- so that new GUIDs are ordered by time, which keeps index inserts local.
+CREATE OR REPLACE FUNCTION uuid_v7() RETURNS UUID AS $$
+DECLARE
+    b BYTEA := GEN_RANDOM_BYTES(16);
+BEGIN
+    b := OVERLAY(b PLACING SUBSTRING(INT8SEND(FLOOR(EXTRACT(EPOCH FROM CLOCK_TIMESTAMP()) * 1000)::BIGINT) FROM 3) FROM 1 FOR 6);
+    b := SET_BYTE(b, 6, (GET_BYTE(b, 6) & 15) | 112);
+    b := SET_BYTE(b, 8, (GET_BYTE(b, 8) & 63) | 128);
+    RETURN ENCODE(b, 'hex')::UUID;
+END;
+$$ LANGUAGE plpgsql VOLATILE;
+
+-- Generates the GUID of a new entry as per the ID scheme.
+CREATE OR REPLACE FUNCTION new_guid() RETURNS UUID AS $$
+BEGIN
+    IF id_scheme() = 'uuidv7' THEN
+        RETURN uuid_v7();
+    END IF;
+    RETURN GEN_RANDOM_UUID();
+END;
+$$ LANGUAGE plpgsql VOLATILE;
+
+-- Generates a random 10 character base58 short ID (eg: 3xK9pQz7Ab) for the
+-- pretty URLs of a new entry with the short ID scheme, or an empty string.
+CREATE OR REPLACE FUNCTION new_short_id() RETURNS TEXT AS $$
+DECLARE
+    chars TEXT := '123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz';
+    b BYTEA;
+    sid TEXT := '';
+BEGIN
+    IF id_scheme() != 'short' THEN
+        RETURN '';
+    END IF;
+
+    b := GEN_RANDOM_BYTES(10);
+    FOR i IN 0..9 LOOP
+        sid := sid || SUBSTR(chars, (GET_BYTE(b, i) % 58) + 1, 1);
+    END LOOP;
+    RETURN sid;
+END;
+$$ LANGUAGE plpgsql VOLATILE;
+
 -- entries
 DROP TABLE IF EXISTS entries CASCADE;
 CREATE TABLE entries (
@@ -9,7 +61,11 @@ CREATE TABLE entries (
     id              SERIAL PRIMARY KEY,
 
     -- Publicly visible unique ID (used in public APIs such as submissions and corrections).
-    guid            UUID NOT NULL UNIQUE DEFAULT GEN_RANDOM_UUID(),
+    guid            UUID NOT NULL UNIQUE DEFAULT new_guid(),
+
+    -- Optional short ID for pretty URLs (with the short ID scheme) that can be
+    -- used in place of the GUID.
+    short_id        TEXT NOT NULL DEFAULT new_short_id(),
 
     -- Actual language content. Dictionary word or definition entries
     content         TEXT NOT NULL CHECK (content <> ''),
@@ -35,18 +91,68 @@ CREATE TABLE entries (
     -- Optional text notes
     notes           TEXT NOT NULL DEFAULT '',
 
+    -- Optional text describing the origin of the entry. Typed links to the entries
+    -- (usually in other languages) that it originates from are in etymology_links.
+    etymology       TEXT NOT NULL DEFAULT '',
+
+    -- URL slug for the entry's permalink (/word/lang/slug), unique per language.
+    -- Automatically generated from the content if it's empty.
+    slug            TEXT NOT NULL DEFAULT '',
+
     -- Optional arbitrary metadata
     meta            JSONB NOT NULL DEFAULT '{}',
 
+    -- Optional licensing metadata of entries taken from other sources (eg: CC-BY-SA
+    -- dictionaries): the name or URL of the source, its license, and the attribution text.
+    source          TEXT NOT NULL DEFAULT '',
+    license         TEXT NOT NULL DEFAULT '',
+    attribution     TEXT NOT NULL DEFAULT '',
+
+    -- Content normalized as per the language's normalization config (eg: diacritics
+    -- stripped and case folded). Empty if the language has no normalization.
+    normalized      TEXT NOT NULL DEFAULT '',
+
+    -- Click-through (popularity) count that can optionally boost the entry in search rankings.
+    clicks          INTEGER NOT NULL DEFAULT 0,
+
+    -- Rank of the headword in the language's imported word frequency list, where
+    -- 1 is the most frequent word. NULL if the word isn't in the list.
+    frequency_rank  INTEGER NULL,
+
     status          entry_status NOT NULL DEFAULT 'enabled',
+
+    -- Optional time at which a disabled or pending entry is published (enabled)
+    -- by the scheduler, eg: for word of the day editorial calendars.
+    publish_at      TIMESTAMP WITH TIME ZONE NULL,
+
     created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 DROP INDEX IF EXISTS idx_content; CREATE INDEX idx_entries_content ON entries((LOWER(SUBSTRING(content, 0, 50))));
+DROP INDEX IF EXISTS idx_entries_content_trgm; CREATE INDEX idx_entries_content_trgm ON entries USING GIN(content gin_trgm_ops);
+DROP INDEX IF EXISTS idx_entries_content_lower; CREATE INDEX idx_entries_content_lower ON entries(lang, LOWER(content));
+DROP INDEX IF EXISTS idx_entries_normalized; CREATE INDEX idx_entries_normalized ON entries(lang, normalized);
+DROP INDEX IF EXISTS idx_entries_normalized_trgm; CREATE INDEX idx_entries_normalized_trgm ON entries USING GIN(normalized gin_trgm_ops);
 DROP INDEX IF EXISTS idx_entries_initial; CREATE INDEX idx_entries_initial ON entries(initial);
 DROP INDEX IF EXISTS idx_entries_lang; CREATE INDEX idx_entries_lang ON entries(lang);
 DROP INDEX IF EXISTS idx_entries_tokens; CREATE INDEX idx_entries_tokens ON entries USING GIN(tokens);
 DROP INDEX IF EXISTS idx_entries_tags; CREATE INDEX idx_entries_tags ON entries(tags);
+DROP INDEX IF EXISTS idx_entries_meta; CREATE INDEX idx_entries_meta ON entries USING GIN(meta jsonb_path_ops);
+DROP INDEX IF EXISTS idx_entries_updated_at; CREATE INDEX idx_entries_updated_at ON entries(updated_at, id);
+DROP INDEX IF EXISTS idx_entries_slug; CREATE UNIQUE INDEX idx_entries_slug ON entries(lang, slug);
+DROP INDEX IF EXISTS idx_entries_frequency_rank; CREATE INDEX idx_entries_frequency_rank ON entries(lang, frequency_rank) WHERE frequency_rank IS NOT NULL;
+DROP INDEX IF EXISTS idx_entries_publish_at; CREATE INDEX idx_entries_publish_at ON entries(publish_at) WHERE publish_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_entries_short_id; CREATE UNIQUE INDEX idx_entries_short_id ON entries(short_id) WHERE short_id != '';
+
+-- Returns the GUID of an entry by its GUID or short ID.
+CREATE OR REPLACE FUNCTION entry_guid(ref TEXT) RETURNS UUID AS $$
+BEGIN
+    IF ref ~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$' THEN
+        RETURN ref::UUID;
+    END IF;
+    RETURN (SELECT guid FROM entries WHERE short_id = ref AND ref != '');
+END;
+$$ LANGUAGE plpgsql STABLE;
 
 -- relations
 DROP TABLE IF EXISTS relations CASCADE;
@@ -60,11 +166,81 @@ CREATE TABLE relations (
     notes           TEXT NOT NULL DEFAULT '',
     weight          DECIMAL DEFAULT 0,
 
+    -- Structured labels of the definition (sense) from the definition language's
+    -- config like types: grammatical gender, register (eg: formal, slang), and subject domains.
+    gender          TEXT NOT NULL DEFAULT '',
+    register        TEXT NOT NULL DEFAULT '',
+    domains         TEXT[] NOT NULL DEFAULT '{}',
+
     status          entry_status NOT NULL DEFAULT 'enabled',
     created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 DROP INDEX IF EXISTS idx_relations; CREATE UNIQUE INDEX idx_relations ON relations(from_id, to_id);
+DROP INDEX IF EXISTS idx_relations_to_id; CREATE INDEX idx_relations_to_id ON relations(to_id);
+DROP INDEX IF EXISTS idx_relations_types; CREATE INDEX idx_relations_types ON relations USING GIN(types);
+DROP INDEX IF EXISTS idx_relations_domains; CREATE INDEX idx_relations_domains ON relations USING GIN(domains);
+
+-- etymology_links
+-- Typed etymological links from entries to other entries, usually in other languages,
+-- that form chains. eg: English "algebra" borrowed-from Latin "algebra" borrowed-from Arabic "al-jabr".
+DROP TYPE IF EXISTS etymology_type CASCADE; CREATE TYPE etymology_type AS ENUM ('borrowed-from', 'inherited-from', 'derived-from', 'calque-of', 'cognate-of');
+DROP TABLE IF EXISTS etymology_links CASCADE;
+CREATE TABLE etymology_links (
+    id              SERIAL PRIMARY KEY,
+    entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    target_id       INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    type            etymology_type NOT NULL,
+    notes           TEXT NOT NULL DEFAULT '',
+    weight          DECIMAL NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CHECK (entry_id <> target_id)
+);
+DROP INDEX IF EXISTS idx_etymology_links; CREATE UNIQUE INDEX idx_etymology_links ON etymology_links(entry_id, target_id, type);
+DROP INDEX IF EXISTS idx_etymology_links_target; CREATE INDEX idx_etymology_links_target ON etymology_links(target_id);
+
+-- media
+-- Images attached to entries or their definitions (relations). Uploaded images are stored
+-- in the media store with server generated thumbnails. Linked images only have URLs.
+DROP TABLE IF EXISTS media CASCADE;
+CREATE TABLE media (
+    id              SERIAL PRIMARY KEY,
+    entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    relation_id     INTEGER NULL REFERENCES relations(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    -- Names of the uploaded file and its thumbnail in the media store. Empty for linked images.
+    filename        TEXT NOT NULL DEFAULT '',
+    thumb_filename  TEXT NOT NULL DEFAULT '',
+
+    url             TEXT NOT NULL CHECK (url <> ''),
+    thumb_url       TEXT NOT NULL DEFAULT '',
+    content_type    TEXT NOT NULL DEFAULT '',
+    width           INTEGER NOT NULL DEFAULT 0,
+    height          INTEGER NOT NULL DEFAULT 0,
+    caption         TEXT NOT NULL DEFAULT '',
+    weight          DECIMAL NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_media_entry; CREATE INDEX idx_media_entry ON media(entry_id);
+
+-- examples
+-- Usage example sentences of definitions (relations) with optional translations.
+DROP TABLE IF EXISTS examples CASCADE;
+CREATE TABLE examples (
+    id              SERIAL PRIMARY KEY,
+    relation_id     INTEGER NOT NULL REFERENCES relations(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    lang            TEXT NOT NULL CHECK (lang <> ''),
+    content         TEXT NOT NULL CHECK (content <> ''),
+    translation     TEXT NOT NULL DEFAULT '',
+    tokens          TSVECTOR NOT NULL DEFAULT '',
+    weight          DECIMAL NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_examples_relation; CREATE INDEX idx_examples_relation ON examples(relation_id);
+DROP INDEX IF EXISTS idx_examples_tokens; CREATE INDEX idx_examples_tokens ON examples USING GIN(tokens);
+DROP INDEX IF EXISTS idx_examples_content_trgm; CREATE INDEX idx_examples_content_trgm ON examples USING GIN(content gin_trgm_ops);
 
 -- comments
 -- This table holds change suggestions submitted by the public. It can either be on an entry
@@ -79,6 +255,163 @@ CREATE TABLE comments (
     created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- editor_comments
+-- Internal discussion threads on entries between editors that are only visible in the admin.
+DROP TABLE IF EXISTS editor_comments CASCADE;
+CREATE TABLE editor_comments (
+    id              SERIAL PRIMARY KEY,
+    entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    author          TEXT NOT NULL DEFAULT '',
+    comments        TEXT NOT NULL CHECK (comments <> ''),
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_editor_comments_entry; CREATE INDEX idx_editor_comments_entry ON editor_comments(entry_id);
+
+-- users
+-- Admin users other than the superadmin in the config. The role decides what a user can do.
+DROP TYPE IF EXISTS user_role CASCADE; CREATE TYPE user_role AS ENUM ('admin', 'editor', 'reviewer', 'readonly');
+DROP TYPE IF EXISTS user_status CASCADE; CREATE TYPE user_status AS ENUM ('enabled', 'disabled');
+DROP TABLE IF EXISTS users CASCADE;
+CREATE TABLE users (
+    id              SERIAL PRIMARY KEY,
+    username        TEXT NOT NULL UNIQUE CHECK (username <> ''),
+    password        TEXT NOT NULL,
+    name            TEXT NOT NULL DEFAULT '',
+    role            user_role NOT NULL DEFAULT 'readonly',
+    status          user_status NOT NULL DEFAULT 'enabled',
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- audit_log
+-- Log of all mutations made via the admin APIs.
+DROP TABLE IF EXISTS audit_log CASCADE;
+CREATE TABLE audit_log (
+    id              BIGSERIAL PRIMARY KEY,
+    username        TEXT NOT NULL DEFAULT '',
+    method          TEXT NOT NULL,
+    endpoint        TEXT NOT NULL,
+    entity          TEXT NOT NULL DEFAULT '',
+    entity_id       INTEGER NOT NULL DEFAULT 0,
+    before          JSONB NOT NULL DEFAULT 'null',
+    after           JSONB NOT NULL DEFAULT 'null',
+    ip              TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_audit_log_entity; CREATE INDEX idx_audit_log_entity ON audit_log(entity, entity_id);
+DROP INDEX IF EXISTS idx_audit_log_username; CREATE INDEX idx_audit_log_username ON audit_log(username);
+DROP INDEX IF EXISTS idx_audit_log_created_at; CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+
+-- deleted_entries
+-- Tombstones of deleted entries for the incremental sync (changes) API.
+DROP TABLE IF EXISTS deleted_entries CASCADE;
+CREATE TABLE deleted_entries (
+    id              BIGSERIAL PRIMARY KEY,
+    guid            UUID NOT NULL,
+    lang            TEXT NOT NULL,
+    deleted_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_deleted_entries_deleted_at; CREATE INDEX idx_deleted_entries_deleted_at ON deleted_entries(deleted_at, id);
+
+CREATE OR REPLACE FUNCTION log_deleted_entry() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO deleted_entries (guid, lang) VALUES (OLD.guid, OLD.lang);
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS trg_log_deleted_entry ON entries;
+CREATE TRIGGER trg_log_deleted_entry AFTER DELETE ON entries FOR EACH ROW EXECUTE PROCEDURE log_deleted_entry();
+
+-- Changes to relations (definitions) mark their parent entries as updated.
+-- The triggers run per statement so that bulk inserts and reorders touch every
+-- parent entry only once.
+CREATE OR REPLACE FUNCTION touch_relation_entry() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE entries SET updated_at = NOW() WHERE id IN (SELECT from_id FROM new_rows);
+    ELSIF TG_OP = 'UPDATE' THEN
+        UPDATE entries SET updated_at = NOW() WHERE id IN (SELECT from_id FROM new_rows UNION SELECT from_id FROM old_rows);
+    ELSE
+        UPDATE entries SET updated_at = NOW() WHERE id IN (SELECT from_id FROM old_rows);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS trg_touch_relation_entry ON relations;
+DROP TRIGGER IF EXISTS trg_touch_relation_entry_insert ON relations;
+DROP TRIGGER IF EXISTS trg_touch_relation_entry_update ON relations;
+DROP TRIGGER IF EXISTS trg_touch_relation_entry_delete ON relations;
+CREATE TRIGGER trg_touch_relation_entry_insert AFTER INSERT ON relations
+    REFERENCING NEW TABLE AS new_rows FOR EACH STATEMENT EXECUTE PROCEDURE touch_relation_entry();
+CREATE TRIGGER trg_touch_relation_entry_update AFTER UPDATE ON relations
+    REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows FOR EACH STATEMENT EXECUTE PROCEDURE touch_relation_entry();
+CREATE TRIGGER trg_touch_relation_entry_delete AFTER DELETE ON relations
+    REFERENCING OLD TABLE AS old_rows FOR EACH STATEMENT EXECUTE PROCEDURE touch_relation_entry();
+
+-- entry_slugs
+-- Previous slugs of entries that redirect to their current permalinks.
+DROP TABLE IF EXISTS entry_slugs CASCADE;
+CREATE TABLE entry_slugs (
+    lang            TEXT NOT NULL,
+    slug            TEXT NOT NULL,
+    entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (lang, slug)
+);
+
+-- Generates a URL slug by lowercasing a string and replacing spaces and punctuation with hyphens.
+CREATE OR REPLACE FUNCTION make_slug(s TEXT) RETURNS TEXT AS $$
+    SELECT COALESCE(NULLIF(TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(s), '[[:space:][:punct:]]+', '-', 'g')), ''), 'entry');
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Generates unique slugs for entries that don't have one and records the
+-- old slugs of entries when they change.
+CREATE OR REPLACE FUNCTION set_entry_slug() RETURNS TRIGGER AS $$
+BEGIN
+    -- If the slug from the content is taken, the entry's ID is appended to it.
+    -- The advisory lock serializes concurrent inserts of the same slug until
+    -- their transactions end.
+    IF NEW.slug = '' OR (TG_OP = 'UPDATE' AND NEW.lang != OLD.lang AND NEW.slug = OLD.slug) THEN
+        NEW.slug := make_slug(NEW.content);
+        PERFORM PG_ADVISORY_XACT_LOCK(HASHTEXT(NEW.lang || '/' || NEW.slug));
+        IF EXISTS (SELECT 1 FROM entries WHERE lang = NEW.lang AND slug = NEW.slug AND id != NEW.id) THEN
+            NEW.slug := NEW.slug || '-' || NEW.id;
+        END IF;
+    END IF;
+
+    IF TG_OP = 'UPDATE' AND OLD.slug != '' AND (NEW.slug != OLD.slug OR NEW.lang != OLD.lang) THEN
+        INSERT INTO entry_slugs (lang, slug, entry_id) VALUES (OLD.lang, OLD.slug, OLD.id)
+            ON CONFLICT (lang, slug) DO UPDATE SET entry_id = EXCLUDED.entry_id, created_at = NOW();
+    END IF;
+
+    -- A slug in use can't redirect elsewhere.
+    DELETE FROM entry_slugs WHERE lang = NEW.lang AND slug = NEW.slug;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS trg_set_entry_slug ON entries;
+CREATE TRIGGER trg_set_entry_slug BEFORE INSERT OR UPDATE OF content, lang, slug ON entries FOR EACH ROW EXECUTE PROCEDURE set_entry_slug();
+
+-- Notifies instances of the languages whose entries have changed over
+-- LISTEN/NOTIFY so that they invalidate their caches ([cluster] in the config).
+-- Identical notifications in a transaction are sent once, so bulk changes send
+-- one per language.
+CREATE OR REPLACE FUNCTION notify_entry_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM PG_NOTIFY('dictpress', JSON_BUILD_OBJECT('type', 'entries', 'lang', OLD.lang)::TEXT);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM PG_NOTIFY('dictpress', JSON_BUILD_OBJECT('type', 'entries', 'lang', NEW.lang)::TEXT);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS trg_notify_entry_change ON entries;
+CREATE TRIGGER trg_notify_entry_change AFTER INSERT OR DELETE OR UPDATE OF content, initial, lang, status ON entries
+    FOR EACH ROW EXECUTE PROCEDURE notify_entry_change();
+
 -- settings
 DROP TABLE IF EXISTS settings CASCADE;
 CREATE TABLE settings (
@@ -87,3 +420,256 @@ CREATE TABLE settings (
     updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 DROP INDEX IF EXISTS idx_settings_key; CREATE INDEX idx_settings_key ON settings(key);
+
+-- langs
+-- Languages managed from the admin in addition to the [lang.*] languages in the
+-- config file. A language here overrides a config language with the same ID.
+DROP TABLE IF EXISTS langs CASCADE;
+CREATE TABLE langs (
+    id              TEXT PRIMARY KEY CHECK (id <> ''),
+
+    -- Language config with the same keys as [lang.*] in the config file.
+    config          JSONB NOT NULL DEFAULT '{}',
+
+    -- Target languages of the dictionary pairs (id => dict) that the language is the source of.
+    dicts           TEXT[] NOT NULL DEFAULT '{}',
+
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- jobs
+-- Background jobs (imports, exports) that are picked up by workers.
+DROP TYPE IF EXISTS job_status CASCADE; CREATE TYPE job_status AS ENUM ('queued', 'running', 'done', 'failed', 'cancelled');
+DROP TABLE IF EXISTS jobs CASCADE;
+CREATE TABLE jobs (
+    id              SERIAL PRIMARY KEY,
+    type            TEXT NOT NULL CHECK (type <> ''),
+    status          job_status NOT NULL DEFAULT 'queued',
+    params          JSONB NOT NULL DEFAULT '{}',
+    log             TEXT NOT NULL DEFAULT '',
+    result          TEXT NOT NULL DEFAULT '',
+    created_by      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    started_at      TIMESTAMP WITH TIME ZONE NULL,
+    finished_at     TIMESTAMP WITH TIME ZONE NULL
+);
+DROP INDEX IF EXISTS idx_jobs_status; CREATE INDEX idx_jobs_status ON jobs(status);
+
+-- entry_views
+-- Daily view (click-through) counts of entries for "most viewed" lists. Only
+-- the aggregate counts are stored and not who viewed them.
+DROP TABLE IF EXISTS entry_views CASCADE;
+CREATE TABLE entry_views (
+    entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    day             DATE NOT NULL DEFAULT CURRENT_DATE,
+    views           INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (entry_id, day)
+);
+DROP INDEX IF EXISTS idx_entry_views_day; CREATE INDEX idx_entry_views_day ON entry_views(day);
+
+-- search_misses
+-- Public searches that yielded no results, for the admin dashboard.
+DROP TABLE IF EXISTS search_misses CASCADE;
+CREATE TABLE search_misses (
+    id              SERIAL PRIMARY KEY,
+    from_lang       TEXT NOT NULL,
+    to_lang         TEXT NOT NULL DEFAULT '',
+    query           TEXT NOT NULL,
+    count           INTEGER NOT NULL DEFAULT 1,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_search_misses; CREATE UNIQUE INDEX idx_search_misses ON search_misses(from_lang, to_lang, query);
+DROP INDEX IF EXISTS idx_search_misses_updated_at; CREATE INDEX idx_search_misses_updated_at ON search_misses(updated_at);
+
+-- entry_locks
+-- Short-lived locks held by editors editing entries in the admin.
+DROP TABLE IF EXISTS entry_locks CASCADE;
+CREATE TABLE entry_locks (
+    entry_id        INTEGER PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    username        TEXT NOT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at      TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- trash
+-- Deleted entries and relations with the rows that were deleted along with them,
+-- kept until they're restored or purged.
+DROP TABLE IF EXISTS trash CASCADE;
+CREATE TABLE trash (
+    id              SERIAL PRIMARY KEY,
+    type            TEXT NOT NULL CHECK (type IN ('entry', 'relation')),
+    entity_id       INTEGER NOT NULL,
+    label           TEXT NOT NULL DEFAULT '',
+    data            JSONB NOT NULL DEFAULT '{}',
+    deleted_by      TEXT NOT NULL DEFAULT '',
+    deleted_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_trash_deleted_at; CREATE INDEX idx_trash_deleted_at ON trash(deleted_at);
+
+-- readers
+-- Optional accounts of site visitors who log in with e-mailed links to save words.
+DROP TABLE IF EXISTS readers CASCADE;
+CREATE TABLE readers (
+    id              SERIAL PRIMARY KEY,
+    email           TEXT NOT NULL UNIQUE CHECK (email <> ''),
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_login_at   TIMESTAMP WITH TIME ZONE NULL
+);
+
+-- reader_tokens
+-- SHA256 hashes of the single-use login links e-mailed to readers.
+DROP TABLE IF EXISTS reader_tokens CASCADE;
+CREATE TABLE reader_tokens (
+    token           TEXT PRIMARY KEY,
+    email           TEXT NOT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at      TIMESTAMP WITH TIME ZONE NOT NULL
+);
+DROP INDEX IF EXISTS idx_reader_tokens_email; CREATE INDEX idx_reader_tokens_email ON reader_tokens(email, created_at);
+
+-- word_lists
+-- Lists of words saved by readers. Public lists are published at /lists/$slug
+-- and featured ones are picked by the admin for the homepage.
+DROP TABLE IF EXISTS word_lists CASCADE;
+CREATE TABLE word_lists (
+    id              SERIAL PRIMARY KEY,
+    reader_id       INTEGER NOT NULL REFERENCES readers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    name            TEXT NOT NULL CHECK (name <> ''),
+    description     TEXT NOT NULL DEFAULT '',
+
+    -- Set when the list is first made public and doesn't change after.
+    slug            TEXT NULL UNIQUE,
+    public          BOOLEAN NOT NULL DEFAULT FALSE,
+    featured        BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_word_lists_reader; CREATE INDEX idx_word_lists_reader ON word_lists(reader_id);
+DROP INDEX IF EXISTS idx_word_lists_public; CREATE INDEX idx_word_lists_public ON word_lists(public, featured);
+
+DROP TABLE IF EXISTS word_list_entries CASCADE;
+CREATE TABLE word_list_entries (
+    list_id         INTEGER NOT NULL REFERENCES word_lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    entry_id        INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (list_id, entry_id)
+);
+
+-- Redirects of old site paths (eg: of a legacy dictionary platform) to new
+-- paths or URLs. Paths that aren't found on the site are looked up here.
+DROP TABLE IF EXISTS redirects CASCADE;
+CREATE TABLE redirects (
+    id              SERIAL PRIMARY KEY,
+
+    -- Path with an optional query string, eg: /define.php?word=apple
+    source          TEXT NOT NULL UNIQUE CHECK (source LIKE '/%'),
+    target          TEXT NOT NULL CHECK (target <> ''),
+    code            SMALLINT NOT NULL DEFAULT 301 CHECK (code IN (301, 302, 307, 308)),
+    hits            INTEGER NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- api_keys
+-- Keys issued to third-party apps for the public APIs with their rate limits
+-- and daily quotas. Only the SHA256 hashes of the keys are stored.
+DROP TABLE IF EXISTS api_keys CASCADE;
+CREATE TABLE api_keys (
+    id              SERIAL PRIMARY KEY,
+    name            TEXT NOT NULL CHECK (name <> ''),
+    key_hash        TEXT NOT NULL UNIQUE,
+
+    -- The first few characters of the key to identify it, eg: dp_3f9a1c.
+    key_prefix      TEXT NOT NULL,
+    notes           TEXT NOT NULL DEFAULT '',
+
+    -- Max requests per minute and per day. 0 is unlimited.
+    rate_limit      INTEGER NOT NULL DEFAULT 0 CHECK (rate_limit >= 0),
+    daily_quota     INTEGER NOT NULL DEFAULT 0 CHECK (daily_quota >= 0),
+    enabled         BOOLEAN NOT NULL DEFAULT TRUE,
+    last_used_at    TIMESTAMP WITH TIME ZONE NULL,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Daily request counts of API keys, including the requests rejected for
+-- exceeding the limits.
+DROP TABLE IF EXISTS api_key_usage CASCADE;
+CREATE TABLE api_key_usage (
+    key_id          INTEGER NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    day             DATE NOT NULL DEFAULT CURRENT_DATE,
+    requests        INTEGER NOT NULL DEFAULT 0,
+    rejected        INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (key_id, day)
+);
+
+-- import_checkpoints
+-- Progress of file imports for resuming failed imports. Imports are identified by
+-- a hash of the file's contents and the import's params. rows is the number of rows
+-- (records) of the file that have been imported, which are skipped on re-runs.
+DROP TABLE IF EXISTS import_checkpoints CASCADE;
+CREATE TABLE import_checkpoints (
+    key             TEXT NOT NULL PRIMARY KEY,
+    name            TEXT NOT NULL DEFAULT '',
+    rows            INTEGER NOT NULL DEFAULT 0,
+    entries         INTEGER NOT NULL DEFAULT 0,
+    done            BOOLEAN NOT NULL DEFAULT false,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- import_stage
+-- Staging table that the importer copies (COPY) batches of entries into, which are
+-- inserted into entries and relations and deleted in the same transaction (see
+-- the import-staged query). Rows are never committed, so it's unlogged.
+DROP TABLE IF EXISTS import_stage CASCADE;
+CREATE UNLOGGED TABLE import_stage (
+    seq             INTEGER NOT NULL,
+    pos             INTEGER NOT NULL,
+    entry_id        INTEGER NOT NULL DEFAULT 0,
+    content         TEXT NOT NULL DEFAULT '',
+    initial         TEXT NOT NULL DEFAULT '',
+    weight          DECIMAL NOT NULL DEFAULT 0,
+    tokens          TEXT NOT NULL DEFAULT '',
+    tokenizer       TEXT NOT NULL DEFAULT '',
+    lang            TEXT NOT NULL DEFAULT '',
+    tags            TEXT[] NOT NULL DEFAULT '{}',
+    phones          TEXT[] NOT NULL DEFAULT '{}',
+    notes           TEXT NOT NULL DEFAULT '',
+    meta            TEXT NOT NULL DEFAULT '{}',
+    normalized      TEXT NOT NULL DEFAULT '',
+    types           TEXT[] NOT NULL DEFAULT '{}',
+    rel_tags        TEXT[] NOT NULL DEFAULT '{}',
+    rel_notes       TEXT NOT NULL DEFAULT ''
+);
+
+-- Materialized counts of entries per language, status, and initial, and of
+-- relations, for stats and glossaries, as counting them on every request gets
+-- slow on large dictionaries. They're refreshed periodically by the app with
+-- refresh_counts(). glossary_num is the number of entries that aren't
+-- definitions of other entries (glossary words).
+DROP MATERIALIZED VIEW IF EXISTS mat_entry_counts;
+CREATE MATERIALIZED VIEW mat_entry_counts AS
+    SELECT e.lang, e.status, e.initial, COUNT(*) AS num,
+        COUNT(*) FILTER (WHERE NOT EXISTS (SELECT 1 FROM relations r WHERE r.to_id = e.id)) AS glossary_num
+    FROM entries e GROUP BY e.lang, e.status, e.initial;
+CREATE UNIQUE INDEX idx_mat_entry_counts ON mat_entry_counts(lang, status, initial);
+
+DROP MATERIALIZED VIEW IF EXISTS mat_relation_counts;
+CREATE MATERIALIZED VIEW mat_relation_counts AS
+    SELECT status, COUNT(*) AS num FROM relations GROUP BY status;
+CREATE UNIQUE INDEX idx_mat_relation_counts ON mat_relation_counts(status);
+
+-- Refreshes the materialized counts without blocking reads and records the time
+-- of the refresh in the settings.
+CREATE OR REPLACE FUNCTION refresh_counts() RETURNS VOID AS $$
+BEGIN
+    REFRESH MATERIALIZED VIEW CONCURRENTLY mat_entry_counts;
+    REFRESH MATERIALIZED VIEW CONCURRENTLY mat_relation_counts;
+
+    INSERT INTO settings (key, value) VALUES ('stats.counts_updated_at', TO_JSONB(NOW()))
+        ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW();
+END;
+$$ LANGUAGE plpgsql;
@@ -138,7 +138,7 @@
 
       // Handle form submission.
       form.onsubmit = () => {
-        fetch(`${window._ROOT_URL}/api/submissions/comments`, {
+        fetch(`${window._ROOT_URL}/api/v1/submissions/comments`, {
           method: "POST",
           headers: {
             "Content-Type": "application/json"
@@ -0,0 +1,117 @@
+// Package cjk is a tokenizer for Chinese, Japanese, and Korean, which aren't
+// written with spaces between words. Runs of CJK characters are segmented into
+// overlapping bigrams (eg: 中华人民 = 中华 华人 人民) along with their single
+// characters, so that words in headwords match without a dictionary of words.
+// Other words (eg: Latin) are tokenized at spaces and punctuation.
+package cjk
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/knadh/dictpress/internal/data"
+	"golang.org/x/text/unicode/norm"
+)
+
+// CJK is a bigram tokenizer for CJK text.
+type CJK struct{}
+
+// New returns a new instance of the CJK tokenizer.
+func New() *CJK {
+	return &CJK{}
+}
+
+// ToTokens tokenizes a string into an array of tsvector tokens with the
+// bigrams and the characters of CJK runs, and other words. eg: [中国:2 中:1 国:1].
+func (c *CJK) ToTokens(s string, lang string) ([]string, error) {
+	var tokens []data.Token
+	for _, w := range segment(s) {
+		r := []rune(w.text)
+		if !w.cjk {
+			tokens = append(tokens, data.Token{Token: w.text, Weight: 3})
+			continue
+		}
+
+		for i := 0; i < len(r)-1; i++ {
+			tokens = append(tokens, data.Token{Token: string(r[i : i+2]), Weight: 2})
+		}
+		for _, ch := range r {
+			tokens = append(tokens, data.Token{Token: string(ch), Weight: 1})
+		}
+	}
+
+	return data.TokensToTSVector(tokens), nil
+}
+
+// ToQuery tokenizes a string into a Postgres tsquery string that matches all
+// the bigrams of CJK runs (or the character of single character runs), and
+// other words. eg: '中国' & '国人'.
+func (c *CJK) ToQuery(s string, lang string) (string, error) {
+	var out []string
+	for _, w := range segment(s) {
+		r := []rune(w.text)
+		if !w.cjk || len(r) == 1 {
+			out = append(out, fmt.Sprintf("'%s'", w.text))
+			continue
+		}
+
+		for i := 0; i < len(r)-1; i++ {
+			out = append(out, fmt.Sprintf("'%s'", string(r[i:i+2])))
+		}
+	}
+
+	return strings.Join(out, " & "), nil
+}
+
+// word is a run of CJK characters or another word in a string.
+type word struct {
+	text string
+	cjk  bool
+}
+
+// segment splits a string into runs of CJK characters and other words
+// (letters and digits). Full width Latin letters and digits and half width
+// Katakana are normalized (NFKC).
+func segment(s string) []word {
+	var (
+		out []word
+		cur []rune
+		cjk bool
+	)
+	flush := func() {
+		if len(cur) > 0 {
+			out = append(out, word{text: string(cur), cjk: cjk})
+			cur = cur[:0]
+		}
+	}
+
+	for _, r := range norm.NFKC.String(strings.ToLower(s)) {
+		switch {
+		case isCJK(r):
+			if !cjk {
+				flush()
+			}
+			cjk = true
+			cur = append(cur, r)
+		case unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r):
+			if cjk {
+				flush()
+			}
+			cjk = false
+			cur = append(cur, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return out
+}
+
+// isCJK checks whether a character is a Han ideograph, Hiragana, Katakana
+// (with the prolonged sound mark), or Hangul, or the ideographic iteration mark.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		r == 'ー' || r == '々'
+}
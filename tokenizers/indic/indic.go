@@ -0,0 +1,162 @@
+// Package indic is a tokenizer for the Indic scripts (Devanagari, Kannada,
+// Malayalam, Tamil, and Telugu) that Postgres has no fulltext dictionaries for.
+// Words are normalized into a canonical spelling (Unicode NFC, atomic Malayalam
+// chillus, no zero width joiners) and each word is tokenized into its exact form
+// and a loose form without vowel signs, viramas, and anusvaras, and with short
+// independent vowels, so that common spelling variations of words match.
+package indic
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/knadh/dictpress/internal/data"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Script is an Indic script with its spelling variations.
+type Script struct {
+	Name string
+
+	// Sequences that are replaced with their canonical forms in all tokens.
+	canonical *strings.Replacer
+
+	// Letters that are replaced in the loose tokens, eg: long vowels with short ones.
+	loose map[rune]rune
+}
+
+// Zero width joiners that only affect the rendering of words.
+var joiners = []string{"\u200d", "", "\u200c", ""}
+
+var (
+	// Devanagari is used by Hindi, Marathi, Nepali, Sanskrit, and others.
+	Devanagari = &Script{
+		Name: "devanagari",
+		// Candrabindu, commonly spelt with an anusvara, and nukta letters (which
+		// are decomposed by NFC) are dropped in the loose tokens with the marks.
+		canonical: strings.NewReplacer(joiners...),
+		loose: map[rune]rune{
+			'आ': 'अ', 'ई': 'इ', 'ऊ': 'उ', 'ऐ': 'ए', 'औ': 'ओ',
+		},
+	}
+
+	Kannada = &Script{
+		Name:      "kannada",
+		canonical: strings.NewReplacer(joiners...),
+		loose: map[rune]rune{
+			'ಆ': 'ಅ', 'ಈ': 'ಇ', 'ಊ': 'ಉ', 'ಏ': 'ಎ', 'ಓ': 'ಒ',
+		},
+	}
+
+	Malayalam = &Script{
+		Name: "malayalam",
+		// Chillus spelt with a virama and a ZWJ (pre Unicode 5.1) are replaced
+		// with the atomic chillus.
+		canonical: strings.NewReplacer(append([]string{
+			"ണ്\u200d", "ൺ", "ന്\u200d", "ൻ", "ര്\u200d", "ർ",
+			"ല്\u200d", "ൽ", "ള്\u200d", "ൾ", "ക്\u200d", "ൿ",
+		}, joiners...)...),
+		loose: map[rune]rune{
+			'ആ': 'അ', 'ഈ': 'ഇ', 'ഊ': 'ഉ', 'ഏ': 'എ', 'ഓ': 'ഒ',
+			'ൺ': 'ണ', 'ൻ': 'ന', 'ർ': 'ര', 'ൽ': 'ല', 'ൾ': 'ള', 'ൿ': 'ക',
+		},
+	}
+
+	Tamil = &Script{
+		Name:      "tamil",
+		canonical: strings.NewReplacer(joiners...),
+		loose: map[rune]rune{
+			'ஆ': 'அ', 'ஈ': 'இ', 'ஊ': 'உ', 'ஏ': 'எ', 'ஓ': 'ஒ',
+		},
+	}
+
+	Telugu = &Script{
+		Name:      "telugu",
+		canonical: strings.NewReplacer(joiners...),
+		loose: map[rune]rune{
+			'ఆ': 'అ', 'ఈ': 'ఇ', 'ఊ': 'ఉ', 'ఏ': 'ఎ', 'ఓ': 'ఒ',
+		},
+	}
+
+	// Scripts is the list of all supported scripts.
+	Scripts = []*Script{Devanagari, Kannada, Malayalam, Tamil, Telugu}
+)
+
+// Indic is a tokenizer for an Indic script.
+type Indic struct {
+	script *Script
+}
+
+// New returns a new instance of the tokenizer for a script.
+func New(s *Script) *Indic {
+	return &Indic{script: s}
+}
+
+// ToTokens tokenizes a string into an array of tsvector tokens with the exact
+// and loose forms of its words. eg: [ಕಾಮನ:3 ಕಮನ:1].
+func (in *Indic) ToTokens(s string, lang string) ([]string, error) {
+	var (
+		words  = in.words(s)
+		tokens = make([]data.Token, 0, len(words)*2)
+	)
+	for _, w := range words {
+		tokens = append(tokens,
+			data.Token{Token: w, Weight: 3},
+			data.Token{Token: in.loose(w), Weight: 1})
+	}
+
+	return data.TokensToTSVector(tokens), nil
+}
+
+// ToQuery tokenizes a string into a Postgres tsquery string that matches
+// all the words in their exact or loose forms. eg: ('ಕಾಮನ' | 'ಕಮನ').
+func (in *Indic) ToQuery(s string, lang string) (string, error) {
+	words := in.words(s)
+	if len(words) == 0 {
+		return "", nil
+	}
+
+	out := make([]string, 0, len(words))
+	for _, w := range words {
+		if l := in.loose(w); l != w {
+			out = append(out, fmt.Sprintf("('%s' | '%s')", w, l))
+		} else {
+			out = append(out, fmt.Sprintf("'%s'", w))
+		}
+	}
+
+	return strings.Join(out, " & "), nil
+}
+
+// words returns the canonical forms of the words (runs of letters, marks, and
+// digits) in a string.
+func (in *Indic) words(s string) []string {
+	s = in.script.canonical.Replace(norm.NFC.String(strings.ToLower(s)))
+
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsMark(r) && !unicode.IsDigit(r)
+	})
+}
+
+// loose returns the loose form of a word without vowel signs, viramas,
+// anusvaras, and other marks, and with the script's loose letters replaced.
+func (in *Indic) loose(w string) string {
+	var b strings.Builder
+	for _, r := range w {
+		if unicode.IsMark(r) {
+			continue
+		}
+		if l, ok := in.script.loose[r]; ok {
+			r = l
+		}
+		b.WriteRune(r)
+	}
+
+	// A word that's only marks.
+	if b.Len() == 0 {
+		return w
+	}
+
+	return b.String()
+}